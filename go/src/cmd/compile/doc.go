@@ -102,6 +102,10 @@ Flags:
 		and diagnose imports that would cause a circular dependency.
 	-pack
 		Write a package (archive) file rather than an object file
+	-pgoprofile file
+		Use the CPU profile in file, as written by runtime/pprof, for
+		profile-guided optimization: inline hot calls more aggressively
+		and devirtualize hot interface method calls.
 	-race
 		Compile with race detector enabled.
 	-s
@@ -42,6 +42,9 @@ type DebugFlags struct {
 	NoOpenDefer          int    `help:"disable open-coded defers"`
 	PCTab                string `help:"print named pc-value table"`
 	Panic                int    `help:"show all compiler panics"`
+	PGODebug             int    `help:"print information about profile-guided optimizations"`
+	PGOHotThreshold      int    `help:"percentage of profile call weight attributed to hot call sites (default 99)"`
+	PGOInlineBudget      int    `help:"inline budget for hot functions (default 2000)"`
 	Slice                int    `help:"print information about slice compilation"`
 	SoftFloat            int    `help:"force compiler to emit soft-float code"`
 	TypeAssert           int    `help:"print information about type assertion inlining"`
@@ -0,0 +1,248 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package devirtualize
+
+import (
+	"strings"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/pgo"
+	"cmd/compile/internal/typecheck"
+	"cmd/compile/internal/types"
+	"cmd/internal/objabi"
+	"cmd/internal/src"
+)
+
+// ProfileGuided devirtualizes the interface method calls within fn
+// that the profile shows are hot and mostly call a single concrete
+// method. A call
+//
+//	x.M(args)
+//
+// whose hottest callee is T.M is rewritten to
+//
+//	if t, ok := x.(T); ok {
+//		t.M(args)
+//	} else {
+//		x.M(args)
+//	}
+//
+// with x and args evaluated once beforehand. The direct call can then
+// be inlined. ProfileGuided must run before inlining.
+func ProfileGuided(fn *ir.Func, p *pgo.Profile) {
+	ir.CurFunc = fn
+
+	var edit func(n ir.Node) ir.Node
+	edit = func(n ir.Node) ir.Node {
+		if n == nil {
+			return n
+		}
+		switch n.Op() {
+		case ir.ODEFER, ir.OGO:
+			// The call must stay the operand of the go or
+			// defer statement.
+			return n
+		}
+
+		ir.EditChildren(n, edit)
+
+		switch n.Op() {
+		case ir.OCALLINTER:
+			call := n.(*ir.CallExpr)
+			if call.Use == ir.CallUseList {
+				// Rewritten along with the assignment below.
+				return n
+			}
+			typ := hotConcreteType(call, p)
+			if typ == nil {
+				return n
+			}
+			lno := ir.SetPos(call)
+			defer func() { base.Pos = lno }()
+			use := call.Use
+			init, results := condCall(call, typ)
+			if use == ir.CallUseStmt {
+				return ir.NewBlockStmt(call.Pos(), init)
+			}
+			return ir.InitExpr(init, results[0])
+
+		case ir.OAS2FUNC:
+			as := n.(*ir.AssignListStmt)
+			call, ok := as.Rhs[0].(*ir.CallExpr)
+			if !ok || call.Op() != ir.OCALLINTER {
+				return n
+			}
+			typ := hotConcreteType(call, p)
+			if typ == nil {
+				return n
+			}
+			lno := ir.SetPos(call)
+			defer func() { base.Pos = lno }()
+			init, results := condCall(call, typ)
+			results[0] = ir.InitExpr(init, results[0])
+			as.Rhs = results
+			as.SetOp(ir.OAS2)
+			as.SetTypecheck(0)
+			return typecheck.Stmt(as)
+		}
+		return n
+	}
+	ir.EditChildren(fn, edit)
+}
+
+// hotConcreteType returns the concrete type to test for at the
+// interface method call, or nil if the call shouldn't be devirtualized.
+func hotConcreteType(call *ir.CallExpr, p *pgo.Profile) *types.Type {
+	sel := call.X.(*ir.SelectorExpr)
+	if ir.StaticValue(sel.X).Op() == ir.OCONVIFACE {
+		// Left to static devirtualization.
+		return nil
+	}
+	iface := sel.X.Type()
+
+	// Edges leave a call site in decreasing order of weight,
+	// so the hot ones come first.
+	for _, e := range p.Callees(pgo.NodeCallSite(call, ir.CurFunc)) {
+		if !e.Hot {
+			break
+		}
+		typ, method := methodType(e.Callee)
+		if typ == nil || method != sel.Sel.Name {
+			continue
+		}
+		if op, _ := typecheck.Assignop(typ, iface); op != ir.OCONVIFACE {
+			continue
+		}
+
+		// The method may be promoted from an embedded
+		// interface, in which case the call would still be
+		// indirect.
+		dt := ir.NewTypeAssertExpr(sel.Pos(), sel.X, nil)
+		dt.SetType(typ)
+		if x := typecheck.Callee(ir.NewSelectorExpr(sel.Pos(), ir.OXDOT, dt, sel.Sel)); x.Op() != ir.ODOTMETH {
+			continue
+		}
+
+		if base.Flag.LowerM != 0 {
+			base.WarnfAt(call.Pos(), "PGO devirtualizing %v to %v", sel, typ)
+		}
+		if base.Debug.PGODebug > 0 {
+			base.WarnfAt(call.Pos(), "hot interface call to %s in %s (weight %d)", e.Callee, e.Caller, e.Weight)
+		}
+		return typ
+	}
+	return nil
+}
+
+// methodType parses the symbol name of a method, as it appears in
+// profiles, and returns the method's receiver type and name. It
+// returns a nil type if name isn't a method or if its receiver type
+// is unknown to this compilation.
+func methodType(name string) (*types.Type, string) {
+	// The package path is everything up to the first dot after
+	// the last slash; dots in the last path element are escaped.
+	i := strings.LastIndex(name, "/") + 1
+	j := strings.Index(name[i:], ".")
+	if j < 0 {
+		return nil, ""
+	}
+	prefix, rest := name[:i+j], name[i+j+1:]
+
+	ptr := false
+	if strings.HasPrefix(rest, "(*") {
+		ptr = true
+		rest = strings.Replace(rest[len("(*"):], ").", ".", 1)
+	}
+	k := strings.Index(rest, ".")
+	if k < 0 {
+		return nil, ""
+	}
+	tname, method := rest[:k], rest[k+1:]
+
+	var pkg *types.Pkg
+	if prefix == objabi.PathToPrefix(base.Ctxt.Pkgpath) {
+		pkg = types.LocalPkg
+	} else {
+		pkg = types.PkgByPrefix(prefix)
+	}
+	if pkg == nil {
+		return nil, ""
+	}
+	sym, ok := pkg.LookupOK(tname)
+	if !ok {
+		return nil, ""
+	}
+	n := typecheck.Resolve(ir.NewIdent(src.NoXPos, sym))
+	if n.Op() != ir.OTYPE || n.Type() == nil || n.Type().IsInterface() {
+		return nil, ""
+	}
+	typ := n.Type()
+	if ptr {
+		typ = types.NewPtr(typ)
+	}
+	return typ, method
+}
+
+// condCall rewrites the interface method call into a call to the method
+// of the concrete type typ, guarded by a type assertion, and falling
+// back to the original call. It returns the statements performing the
+// call, and the temporaries that hold its results afterward.
+func condCall(call *ir.CallExpr, typ *types.Type) (init []ir.Node, results []ir.Node) {
+	pos := call.Pos()
+	sel := call.X.(*ir.SelectorExpr)
+	init = ir.TakeInit(call)
+
+	// Evaluate the receiver and the arguments once, and in order.
+	recv := typecheck.TempAt(pos, ir.CurFunc, sel.X.Type())
+	lhs := []ir.Node{recv}
+	rhs := []ir.Node{sel.X}
+	args := make([]ir.Node, len(call.Args))
+	for i, arg := range call.Args {
+		tmp := typecheck.TempAt(pos, ir.CurFunc, arg.Type())
+		lhs = append(lhs, tmp)
+		rhs = append(rhs, arg)
+		args[i] = tmp
+	}
+	init = append(init, typecheck.Stmt(ir.NewAssignListStmt(pos, ir.OAS2, lhs, rhs)))
+
+	// t, ok := recv.(typ)
+	t := typecheck.TempAt(pos, ir.CurFunc, typ)
+	ok := typecheck.TempAt(pos, ir.CurFunc, types.Types[types.TBOOL])
+	dt := ir.NewTypeAssertExpr(pos, recv, nil)
+	dt.SetType(typ)
+	init = append(init, typecheck.Stmt(ir.NewAssignListStmt(pos, ir.OAS2, []ir.Node{t, ok}, []ir.Node{dt})))
+
+	direct := ir.NewCallExpr(pos, ir.OCALL, typecheck.Callee(ir.NewSelectorExpr(pos, ir.OXDOT, t, sel.Sel)), append([]ir.Node(nil), args...))
+	direct.IsDDD = call.IsDDD
+
+	sel.X = recv
+	call.Args = args
+
+	ft := sel.Type()
+	for _, r := range ft.Results().FieldSlice() {
+		results = append(results, typecheck.TempAt(pos, ir.CurFunc, r.Type))
+	}
+	var then, els ir.Node
+	switch len(results) {
+	case 0:
+		typecheck.Call(direct)
+		call.Use = ir.CallUseStmt
+		then, els = direct, call
+	case 1:
+		call.Use = ir.CallUseExpr
+		then = typecheck.Stmt(ir.NewAssignStmt(pos, results[0], direct))
+		els = typecheck.Stmt(ir.NewAssignStmt(pos, results[0], call))
+	default:
+		call.Use = ir.CallUseList
+		then = typecheck.Stmt(ir.NewAssignListStmt(pos, ir.OAS2, append([]ir.Node(nil), results...), []ir.Node{direct}))
+		els = typecheck.Stmt(ir.NewAssignListStmt(pos, ir.OAS2, append([]ir.Node(nil), results...), []ir.Node{call}))
+	}
+
+	nif := ir.NewIfStmt(pos, ok, []ir.Node{then}, []ir.Node{els})
+	nif.Likely = true
+	init = append(init, typecheck.Stmt(nif))
+	return init, results
+}
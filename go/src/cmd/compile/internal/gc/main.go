@@ -16,6 +16,7 @@ import (
 	"cmd/compile/internal/ir"
 	"cmd/compile/internal/logopt"
 	"cmd/compile/internal/noder"
+	"cmd/compile/internal/pgo"
 	"cmd/compile/internal/pkginit"
 	"cmd/compile/internal/reflectdata"
 	"cmd/compile/internal/ssa"
@@ -223,10 +224,33 @@ func Main(archInit func(*ssagen.ArchInfo)) {
 		typecheck.AllImportedBodies()
 	}
 
+	// Read the profile for profile-guided optimizations.
+	var profile *pgo.Profile
+	if base.Flag.PGOProfile != "" {
+		base.Timer.Start("fe", "pgoprofile")
+		var err error
+		profile, err = pgo.New(base.Flag.PGOProfile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	// Profile-guided devirtualization. Must happen before inlining,
+	// so that the resulting direct calls can be inlined.
+	if profile != nil && base.Flag.N == 0 {
+		base.Timer.Start("fe", "pgodevirtualize")
+		for _, n := range typecheck.Target.Decls {
+			if n.Op() == ir.ODCLFUNC {
+				devirtualize.ProfileGuided(n.(*ir.Func), profile)
+			}
+		}
+		ir.CurFunc = nil
+	}
+
 	// Inlining
 	base.Timer.Start("fe", "inlining")
 	if base.Flag.LowerL != 0 {
-		inline.InlinePackage()
+		inline.InlinePackage(profile)
 	}
 
 	// Devirtualize.
@@ -34,6 +34,7 @@ import (
 	"cmd/compile/internal/base"
 	"cmd/compile/internal/ir"
 	"cmd/compile/internal/logopt"
+	"cmd/compile/internal/pgo"
 	"cmd/compile/internal/typecheck"
 	"cmd/compile/internal/types"
 	"cmd/internal/obj"
@@ -51,10 +52,25 @@ const (
 
 	inlineBigFunctionNodes   = 5000 // Functions with this many nodes are considered "big".
 	inlineBigFunctionMaxCost = 20   // Max cost of inlinee when inlining into a "big" function.
+
+	// Functions called from hot call sites of the profile given to
+	// -pgoprofile may cost this much and still be inlined at those
+	// call sites. Overridden by -d=pgoinlinebudget.
+	inlineHotMaxBudget = 2000
 )
 
+// hotMaxBudget returns the inlining budget for hot functions.
+func hotMaxBudget() int32 {
+	if b := base.Debug.PGOInlineBudget; b != 0 {
+		return int32(b)
+	}
+	return inlineHotMaxBudget
+}
+
 // InlinePackage finds functions that can be inlined and clones them before walk expands them.
-func InlinePackage() {
+// If profile is non-nil, functions and call sites that are hot in the profile
+// are allowed a larger inlining budget.
+func InlinePackage(profile *pgo.Profile) {
 	ir.VisitFuncsBottomUp(typecheck.Target.Decls, func(list []*ir.Func, recursive bool) {
 		numfns := numNonClosures(list)
 		for _, n := range list {
@@ -62,13 +78,13 @@ func InlinePackage() {
 				// We allow inlining if there is no
 				// recursion, or the recursion cycle is
 				// across more than one function.
-				CanInline(n)
+				CanInline(n, profile)
 			} else {
 				if base.Flag.LowerM > 1 {
 					fmt.Printf("%v: cannot inline %v: recursive\n", ir.Line(n), n.Nname)
 				}
 			}
-			InlineCalls(n)
+			InlineCalls(n, profile)
 		}
 	})
 }
@@ -76,7 +92,9 @@ func InlinePackage() {
 // CanInline determines whether fn is inlineable.
 // If so, CanInline saves copies of fn.Body and fn.Dcl in fn.Inl.
 // fn and fn.Body will already have been typechecked.
-func CanInline(fn *ir.Func) {
+// If fn is hot in profile, it is allowed a larger budget, but it will then
+// only be inlined at hot call sites.
+func CanInline(fn *ir.Func, profile *pgo.Profile) {
 	if fn.Nname == nil {
 		base.Fatalf("CanInline no nname %+v", fn)
 	}
@@ -166,9 +184,19 @@ func CanInline(fn *ir.Func) {
 	// locals, and we use this map to produce a pruned Inline.Dcl
 	// list. See issue 25249 for more context.
 
+	budget := int32(inlineMaxBudget)
+	if profile != nil && profile.IsHotCallee(pgo.FuncName(fn)) {
+		budget = hotMaxBudget()
+		if base.Debug.PGODebug > 0 {
+			fmt.Printf("%v: hot function %v: inline budget raised to %d\n", ir.Line(fn), ir.PkgFuncName(fn), budget)
+		}
+	}
+
 	visitor := hairyVisitor{
-		budget:        inlineMaxBudget,
+		budget:        budget,
+		maxBudget:     budget,
 		extraCallCost: cc,
+		profile:       profile,
 	}
 	if visitor.tooHairy(fn) {
 		reason = visitor.reason
@@ -176,18 +204,18 @@ func CanInline(fn *ir.Func) {
 	}
 
 	n.Func.Inl = &ir.Inline{
-		Cost: inlineMaxBudget - visitor.budget,
+		Cost: budget - visitor.budget,
 		Dcl:  pruneUnusedAutos(n.Defn.(*ir.Func).Dcl, &visitor),
 		Body: inlcopylist(fn.Body),
 	}
 
 	if base.Flag.LowerM > 1 {
-		fmt.Printf("%v: can inline %v with cost %d as: %v { %v }\n", ir.Line(fn), n, inlineMaxBudget-visitor.budget, fn.Type(), ir.Nodes(n.Func.Inl.Body))
+		fmt.Printf("%v: can inline %v with cost %d as: %v { %v }\n", ir.Line(fn), n, budget-visitor.budget, fn.Type(), ir.Nodes(n.Func.Inl.Body))
 	} else if base.Flag.LowerM != 0 {
 		fmt.Printf("%v: can inline %v\n", ir.Line(fn), n)
 	}
 	if logopt.Enabled() {
-		logopt.LogOpt(fn.Pos(), "canInlineFunction", "inline", ir.FuncName(fn), fmt.Sprintf("cost: %d", inlineMaxBudget-visitor.budget))
+		logopt.LogOpt(fn.Pos(), "canInlineFunction", "inline", ir.FuncName(fn), fmt.Sprintf("cost: %d", budget-visitor.budget))
 	}
 }
 
@@ -251,9 +279,11 @@ func Inline_Flood(n *ir.Name, exportsym func(*ir.Name)) {
 // hairiness and whether or not it can be inlined.
 type hairyVisitor struct {
 	budget        int32
+	maxBudget     int32
 	reason        string
 	extraCallCost int32
 	usedLocals    ir.NameSet
+	profile       *pgo.Profile
 	do            func(ir.Node) bool
 }
 
@@ -263,12 +293,24 @@ func (v *hairyVisitor) tooHairy(fn *ir.Func) bool {
 		return true
 	}
 	if v.budget < 0 {
-		v.reason = fmt.Sprintf("function too complex: cost %d exceeds budget %d", inlineMaxBudget-v.budget, inlineMaxBudget)
+		v.reason = fmt.Sprintf("function too complex: cost %d exceeds budget %d", v.maxBudget-v.budget, v.maxBudget)
 		return true
 	}
 	return false
 }
 
+// calleeCost returns the cost of a call to the inlinable function fn.
+func (v *hairyVisitor) calleeCost(fn *ir.Func) int32 {
+	if fn.Inl.Cost > inlineMaxBudget {
+		// fn could only be inlined because it is hot, and is
+		// inlined only at hot call sites of its callers. Once
+		// the caller is itself inlined elsewhere, the call is
+		// no longer at such a site, so charge a regular call.
+		return v.extraCallCost
+	}
+	return fn.Inl.Cost
+}
+
 func (v *hairyVisitor) doNode(n ir.Node) bool {
 	if n == nil {
 		return false
@@ -301,8 +343,8 @@ func (v *hairyVisitor) doNode(n ir.Node) bool {
 			break
 		}
 
-		if fn := inlCallee(n.X); fn != nil && fn.Inl != nil {
-			v.budget -= fn.Inl.Cost
+		if fn := inlCallee(n.X, v.profile); fn != nil && fn.Inl != nil {
+			v.budget -= v.calleeCost(fn)
 			break
 		}
 
@@ -326,7 +368,7 @@ func (v *hairyVisitor) doNode(n ir.Node) bool {
 			break
 		}
 		if fn.Inl != nil {
-			v.budget -= fn.Inl.Cost
+			v.budget -= v.calleeCost(fn)
 			break
 		}
 		// Call cost for non-leaf inlining.
@@ -522,7 +564,8 @@ func inlcopy(n ir.Node) ir.Node {
 
 // InlineCalls/inlnode walks fn's statements and expressions and substitutes any
 // calls made to inlineable functions. This is the external entry point.
-func InlineCalls(fn *ir.Func) {
+// If profile is non-nil, hot call sites may inline larger functions.
+func InlineCalls(fn *ir.Func, profile *pgo.Profile) {
 	savefn := ir.CurFunc
 	ir.CurFunc = fn
 	maxCost := int32(inlineMaxBudget)
@@ -538,7 +581,7 @@ func InlineCalls(fn *ir.Func) {
 	inlMap := make(map[*ir.Func]bool)
 	var edit func(ir.Node) ir.Node
 	edit = func(n ir.Node) ir.Node {
-		return inlnode(n, maxCost, inlMap, edit)
+		return inlnode(n, maxCost, inlMap, profile, edit)
 	}
 	ir.EditChildren(fn, edit)
 	ir.CurFunc = savefn
@@ -588,7 +631,7 @@ func inlconv2list(n *ir.InlinedCallExpr) []ir.Node {
 // shorter and less complicated.
 // The result of inlnode MUST be assigned back to n, e.g.
 // 	n.Left = inlnode(n.Left)
-func inlnode(n ir.Node, maxCost int32, inlMap map[*ir.Func]bool, edit func(ir.Node) ir.Node) ir.Node {
+func inlnode(n ir.Node, maxCost int32, inlMap map[*ir.Func]bool, profile *pgo.Profile, edit func(ir.Node) ir.Node) ir.Node {
 	if n == nil {
 		return n
 	}
@@ -650,8 +693,8 @@ func inlnode(n ir.Node, maxCost int32, inlMap map[*ir.Func]bool, edit func(ir.No
 		if ir.IsIntrinsicCall(call) {
 			break
 		}
-		if fn := inlCallee(call.X); fn != nil && fn.Inl != nil {
-			n = mkinlcall(call, fn, maxCost, inlMap, edit)
+		if fn := inlCallee(call.X, profile); fn != nil && fn.Inl != nil {
+			n = mkinlcall(call, fn, maxCost, inlMap, profile, edit)
 		}
 
 	case ir.OCALLMETH:
@@ -665,7 +708,7 @@ func inlnode(n ir.Node, maxCost int32, inlMap map[*ir.Func]bool, edit func(ir.No
 			base.Fatalf("no function type for [%p] %+v\n", call.X, call.X)
 		}
 
-		n = mkinlcall(call, ir.MethodExprName(call.X).Func, maxCost, inlMap, edit)
+		n = mkinlcall(call, ir.MethodExprName(call.X).Func, maxCost, inlMap, profile, edit)
 	}
 
 	base.Pos = lno
@@ -688,9 +731,25 @@ func inlnode(n ir.Node, maxCost int32, inlMap map[*ir.Func]bool, edit func(ir.No
 	return n
 }
 
+// hotCallOK reports whether the call n to fn, whose inlining cost
+// exceeds maxCost, may be inlined anyway because n is a hot call site
+// in profile. Big callers still get no more than maxCost.
+func hotCallOK(n *ir.CallExpr, fn *ir.Func, maxCost int32, profile *pgo.Profile) bool {
+	if profile == nil || maxCost < inlineMaxBudget || fn.Inl.Cost > hotMaxBudget() {
+		return false
+	}
+	if !profile.IsHotCallSite(pgo.NodeCallSite(n, ir.CurFunc)) {
+		return false
+	}
+	if base.Debug.PGODebug > 0 {
+		fmt.Printf("%v: inlining %v (cost %d) at hot call site in %v\n", ir.Line(n), ir.PkgFuncName(fn), fn.Inl.Cost, ir.PkgFuncName(ir.CurFunc))
+	}
+	return true
+}
+
 // inlCallee takes a function-typed expression and returns the underlying function ONAME
 // that it refers to if statically known. Otherwise, it returns nil.
-func inlCallee(fn ir.Node) *ir.Func {
+func inlCallee(fn ir.Node, profile *pgo.Profile) *ir.Func {
 	fn = ir.StaticValue(fn)
 	switch fn.Op() {
 	case ir.OMETHEXPR:
@@ -711,7 +770,7 @@ func inlCallee(fn ir.Node) *ir.Func {
 	case ir.OCLOSURE:
 		fn := fn.(*ir.ClosureExpr)
 		c := fn.Func
-		CanInline(c)
+		CanInline(c, profile)
 		return c
 	}
 	return nil
@@ -747,7 +806,7 @@ var SSADumpInline = func(*ir.Func) {}
 // parameters.
 // The result of mkinlcall MUST be assigned back to n, e.g.
 // 	n.Left = mkinlcall(n.Left, fn, isddd)
-func mkinlcall(n *ir.CallExpr, fn *ir.Func, maxCost int32, inlMap map[*ir.Func]bool, edit func(ir.Node) ir.Node) ir.Node {
+func mkinlcall(n *ir.CallExpr, fn *ir.Func, maxCost int32, inlMap map[*ir.Func]bool, profile *pgo.Profile, edit func(ir.Node) ir.Node) ir.Node {
 	if fn.Inl == nil {
 		if logopt.Enabled() {
 			logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc),
@@ -755,7 +814,7 @@ func mkinlcall(n *ir.CallExpr, fn *ir.Func, maxCost int32, inlMap map[*ir.Func]b
 		}
 		return n
 	}
-	if fn.Inl.Cost > maxCost {
+	if fn.Inl.Cost > maxCost && !hotCallOK(n, fn, maxCost, profile) {
 		// The inlined function body is too big. Typically we use this check to restrict
 		// inlining into very big functions.  See issue 26546 and 17566.
 		if logopt.Enabled() {
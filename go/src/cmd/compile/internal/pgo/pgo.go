@@ -0,0 +1,241 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pgo reads CPU profiles for profile-guided optimization.
+//
+// A profile is reduced to a weighted call graph: each edge is a call
+// from a caller to a callee at a particular line of the caller, and
+// its weight is the number of samples in which that call was on the
+// stack. The heaviest edges, which together account for most of the
+// total weight, are considered hot. The inliner uses hot edges to
+// raise its budget, and the devirtualizer uses them to pick a likely
+// concrete type at interface method calls.
+//
+// Functions are identified by their symbol names, as recorded in the
+// profile (for example "example.com/pkg.(*T).M"), and call sites by
+// their line number. A profile collected from an older version of
+// the source remains usable, but calls whose lines have moved are no
+// longer matched.
+package pgo
+
+import (
+	"fmt"
+	"internal/profile"
+	"os"
+	"sort"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/types"
+	"cmd/internal/objabi"
+	"cmd/internal/src"
+)
+
+// DefaultHotThreshold is the default percentage of the total call
+// edge weight covered by hot edges.
+const DefaultHotThreshold = 99
+
+// A CallSite identifies a call within a function.
+type CallSite struct {
+	Caller string // symbol name of the calling function
+	Line   int    // line number of the call
+}
+
+// A CallEdge is a call from a call site to a callee.
+type CallEdge struct {
+	CallSite
+	Callee string // symbol name of the called function
+	Weight int64  // number of samples containing this call
+	Hot    bool   // whether the edge is among the hottest edges
+}
+
+// A Profile is a weighted call graph derived from a CPU profile.
+type Profile struct {
+	// TotalWeight is the sum of the weights of all edges.
+	TotalWeight int64
+
+	// Edges holds all edges, in decreasing order of weight.
+	Edges []*CallEdge
+
+	sites      map[CallSite][]*CallEdge // edges by call site, heaviest first
+	hotSites   map[CallSite]bool
+	hotCallees map[string]bool
+}
+
+// New reads the CPU profile in file and builds its call graph. The
+// set of hot edges is determined by the -d=pgohotthreshold setting.
+func New(file string) (*Profile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %v", err)
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing profile %s: %v", file, err)
+	}
+	threshold := base.Debug.PGOHotThreshold
+	if threshold == 0 {
+		threshold = DefaultHotThreshold
+	}
+	prof, err := FromProfile(p, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return prof, nil
+}
+
+// FromProfile builds the call graph of the CPU profile p. The edges
+// are marked hot in decreasing order of weight until they cover
+// threshold percent of the total weight.
+func FromProfile(p *profile.Profile, threshold int) (*Profile, error) {
+	if threshold < 0 || threshold > 100 {
+		return nil, fmt.Errorf("hot threshold %d%% out of range", threshold)
+	}
+
+	// Raw sample counts and CPU time are proportional to each
+	// other, so either will do.
+	valueIndex := -1
+	for i, st := range p.SampleType {
+		if (st.Type == "samples" && st.Unit == "count") || (st.Type == "cpu" && st.Unit == "nanoseconds") {
+			valueIndex = i
+			break
+		}
+	}
+	if valueIndex < 0 {
+		return nil, fmt.Errorf("not a CPU profile: no samples/count or cpu/nanoseconds sample type")
+	}
+
+	type edgeKey struct {
+		site   CallSite
+		callee string
+	}
+	edges := make(map[edgeKey]*CallEdge)
+	var frames []*profile.Line
+	seen := make(map[edgeKey]bool)
+	for _, s := range p.Sample {
+		w := s.Value[valueIndex]
+		if w == 0 {
+			continue
+		}
+
+		// Flatten the stack, including inlined frames, from
+		// the leaf to the root. Within a location, Line[0] is
+		// the innermost inlined call.
+		frames = frames[:0]
+		for _, loc := range s.Location {
+			for i := range loc.Line {
+				if loc.Line[i].Function != nil {
+					frames = append(frames, &loc.Line[i])
+				}
+			}
+		}
+
+		// Count each edge once per sample, even if recursion
+		// puts it on the stack more than once.
+		for k := range seen {
+			delete(seen, k)
+		}
+		for i := 0; i+1 < len(frames); i++ {
+			caller, callee := frames[i+1], frames[i]
+			k := edgeKey{
+				site:   CallSite{Caller: caller.Function.Name, Line: int(caller.Line)},
+				callee: callee.Function.Name,
+			}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			e := edges[k]
+			if e == nil {
+				e = &CallEdge{CallSite: k.site, Callee: k.callee}
+				edges[k] = e
+			}
+			e.Weight += w
+		}
+	}
+
+	prof := &Profile{
+		sites:      make(map[CallSite][]*CallEdge),
+		hotSites:   make(map[CallSite]bool),
+		hotCallees: make(map[string]bool),
+	}
+	for _, e := range edges {
+		prof.Edges = append(prof.Edges, e)
+		prof.TotalWeight += e.Weight
+	}
+	sort.Sort(byWeight(prof.Edges))
+
+	var cum int64
+	for _, e := range prof.Edges {
+		if cum*100 >= prof.TotalWeight*int64(threshold) {
+			break
+		}
+		cum += e.Weight
+		e.Hot = true
+		prof.hotSites[e.CallSite] = true
+		prof.hotCallees[e.Callee] = true
+	}
+	for _, e := range prof.Edges {
+		prof.sites[e.CallSite] = append(prof.sites[e.CallSite], e)
+	}
+	return prof, nil
+}
+
+// byWeight sorts edges by decreasing weight, breaking ties by call
+// site and callee so that the order is deterministic.
+type byWeight []*CallEdge
+
+func (a byWeight) Len() int      { return len(a) }
+func (a byWeight) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byWeight) Less(i, j int) bool {
+	x, y := a[i], a[j]
+	if x.Weight != y.Weight {
+		return x.Weight > y.Weight
+	}
+	if x.Caller != y.Caller {
+		return x.Caller < y.Caller
+	}
+	if x.Line != y.Line {
+		return x.Line < y.Line
+	}
+	return x.Callee < y.Callee
+}
+
+// IsHotCallee reports whether the function named name is the callee
+// of a hot edge.
+func (p *Profile) IsHotCallee(name string) bool {
+	return p.hotCallees[name]
+}
+
+// IsHotCallSite reports whether a hot edge leaves the call site.
+func (p *Profile) IsHotCallSite(site CallSite) bool {
+	return p.hotSites[site]
+}
+
+// Callees returns the edges leaving the call site, heaviest first.
+func (p *Profile) Callees(site CallSite) []*CallEdge {
+	return p.sites[site]
+}
+
+// FuncName returns the symbol name of fn, as it appears in profiles.
+func FuncName(fn *ir.Func) string {
+	s := fn.Sym()
+	path := base.Ctxt.Pkgpath
+	if s.Pkg != types.LocalPkg {
+		path = s.Pkg.Path
+	}
+	return objabi.PathToPrefix(path) + "." + s.Name
+}
+
+// NodeCallSite returns the call site of the call n within fn.
+func NodeCallSite(n ir.Node, fn *ir.Func) CallSite {
+	return CallSite{Caller: FuncName(fn), Line: Line(n.Pos())}
+}
+
+// Line returns the line number recorded for pos in profiles, which
+// accounts for //line directives.
+func Line(pos src.XPos) int {
+	return int(base.Ctxt.InnermostPos(pos).RelLine())
+}
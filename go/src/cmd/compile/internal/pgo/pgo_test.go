@@ -0,0 +1,172 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgo
+
+import (
+	"internal/profile"
+	"testing"
+)
+
+// frame is a function and line within a stack location.
+type frame struct {
+	fn   string
+	line int64
+}
+
+// testProfile builds a CPU profile from samples. Each sample is a
+// weight and a stack, leaf first, of locations, each of which may have
+// several frames if calls were inlined (innermost first).
+func testProfile(samples map[int64][][]frame) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+	}
+	funcs := make(map[string]*profile.Function)
+	for w, stack := range samples {
+		s := &profile.Sample{Value: []int64{w, w * 1000}}
+		for _, frames := range stack {
+			loc := &profile.Location{ID: uint64(len(p.Location) + 1)}
+			for _, f := range frames {
+				fn := funcs[f.fn]
+				if fn == nil {
+					fn = &profile.Function{ID: uint64(len(funcs) + 1), Name: f.fn}
+					funcs[f.fn] = fn
+					p.Function = append(p.Function, fn)
+				}
+				loc.Line = append(loc.Line, profile.Line{Function: fn, Line: f.line})
+			}
+			p.Location = append(p.Location, loc)
+			s.Location = append(s.Location, loc)
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+func TestFromProfile(t *testing.T) {
+	p := testProfile(map[int64][][]frame{
+		// main calls a.F, which calls the inlined a.G, which
+		// calls a.(*T).M.
+		60: {
+			{{"a.(*T).M", 3}},
+			{{"a.G", 10}, {"a.F", 20}},
+			{{"main.main", 30}},
+		},
+		// a.R calls itself recursively. The edge counts once.
+		30: {
+			{{"a.R", 40}},
+			{{"a.R", 41}},
+			{{"a.R", 41}},
+			{{"main.main", 31}},
+		},
+		// main calls a.F, which calls a.U.M.
+		10: {
+			{{"a.U.M", 5}},
+			{{"a.F", 21}},
+			{{"main.main", 30}},
+		},
+	})
+	prof, err := FromProfile(p, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []CallEdge{
+		{CallSite{"a.F", 20}, "a.G", 60, true},
+		{CallSite{"a.G", 10}, "a.(*T).M", 60, true},
+		{CallSite{"main.main", 30}, "a.F", 70, true},
+		{CallSite{"a.R", 41}, "a.R", 30, true},
+		{CallSite{"main.main", 31}, "a.R", 30, true},
+		{CallSite{"a.F", 21}, "a.U.M", 10, false},
+	}
+	if len(prof.Edges) != len(want) {
+		for _, e := range prof.Edges {
+			t.Logf("%+v", *e)
+		}
+		t.Fatalf("got %d edges, want %d", len(prof.Edges), len(want))
+	}
+	var total int64
+	for _, w := range want {
+		total += w.Weight
+		var got *CallEdge
+		for _, e := range prof.Callees(w.CallSite) {
+			if e.Callee == w.Callee {
+				got = e
+			}
+		}
+		if got == nil {
+			t.Errorf("missing edge %+v", w)
+			continue
+		}
+		if *got != w {
+			t.Errorf("got edge %+v, want %+v", *got, w)
+		}
+		if prof.IsHotCallSite(w.CallSite) != w.Hot {
+			t.Errorf("IsHotCallSite(%+v) = %v, want %v", w.CallSite, !w.Hot, w.Hot)
+		}
+		if prof.IsHotCallee(w.Callee) != w.Hot {
+			t.Errorf("IsHotCallee(%s) = %v, want %v", w.Callee, !w.Hot, w.Hot)
+		}
+	}
+	if prof.TotalWeight != total {
+		t.Errorf("TotalWeight = %d, want %d", prof.TotalWeight, total)
+	}
+	for i := 1; i < len(prof.Edges); i++ {
+		if prof.Edges[i-1].Weight < prof.Edges[i].Weight {
+			t.Errorf("edges not sorted by decreasing weight: %d before %d", prof.Edges[i-1].Weight, prof.Edges[i].Weight)
+		}
+	}
+}
+
+func TestFromProfileThreshold(t *testing.T) {
+	p := testProfile(map[int64][][]frame{
+		5: {{{"a.F", 1}}, {{"main.main", 10}}},
+		3: {{{"a.G", 1}}, {{"main.main", 11}}},
+		2: {{{"a.H", 1}}, {{"main.main", 12}}},
+	})
+	for _, tt := range []struct {
+		threshold int
+		hot       []string
+	}{
+		{0, nil},
+		{50, []string{"a.F"}},
+		{51, []string{"a.F", "a.G"}},
+		{80, []string{"a.F", "a.G"}},
+		{100, []string{"a.F", "a.G", "a.H"}},
+	} {
+		prof, err := FromProfile(p, tt.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hot []string
+		for _, e := range prof.Edges {
+			if e.Hot {
+				hot = append(hot, e.Callee)
+			}
+		}
+		if len(hot) != len(tt.hot) {
+			t.Errorf("threshold %d: hot callees %v, want %v", tt.threshold, hot, tt.hot)
+			continue
+		}
+		for i := range hot {
+			if hot[i] != tt.hot[i] {
+				t.Errorf("threshold %d: hot callees %v, want %v", tt.threshold, hot, tt.hot)
+				break
+			}
+		}
+	}
+}
+
+func TestFromProfileErrors(t *testing.T) {
+	p := testProfile(map[int64][][]frame{
+		1: {{{"a.F", 1}}, {{"main.main", 10}}},
+	})
+	if _, err := FromProfile(p, 101); err == nil {
+		t.Errorf("FromProfile with threshold 101 succeeded")
+	}
+	p.SampleType = []*profile.ValueType{{Type: "alloc_objects", Unit: "count"}, {Type: "alloc_space", Unit: "bytes"}}
+	if _, err := FromProfile(p, DefaultHotThreshold); err == nil {
+		t.Errorf("FromProfile of a heap profile succeeded")
+	}
+}
@@ -1862,7 +1862,7 @@ func methodWrapper(rcvr *types.Type, method *types.Field) *obj.LSym {
 	// generate those wrappers within the same compilation unit as (T).M.
 	// TODO(mdempsky): Investigate why we can't enable this more generally.
 	if rcvr.IsPtr() && rcvr.Elem() == method.Type.Recv().Type && rcvr.Elem().Sym() != nil {
-		inline.InlineCalls(fn)
+		inline.InlineCalls(fn, nil)
 	}
 	escape.Batch([]*ir.Func{fn}, false)
 
@@ -0,0 +1,142 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"internal/profile"
+	"internal/testenv"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const pgoSrc = `
+package p
+
+type I interface{ M(int) int }
+
+type A struct{ x int }
+
+func (a *A) M(y int) int { return a.x + y }
+
+type B struct{}
+
+func (B) M(y int) int { return y * 2 }
+
+func Run(i I, n int) int {
+	s := 0
+	for j := 0; j < n; j++ {
+		s += i.M(j) // devirt
+	}
+	return s
+}
+
+func Big(a []int) int {
+	s := a[0]*3 + a[1]*5 + a[2]*7 + a[3]*11
+	s ^= a[0]>>1 + a[1]>>2 + a[2]>>3 + a[3]>>4
+	s += a[0]*13 + a[1]*17 + a[2]*19 + a[3]*23
+	s ^= a[0]>>5 + a[1]>>6 + a[2]>>7 + a[3]>>8
+	s += a[0]*29 + a[1]*31 + a[2]*37 + a[3]*41
+	s ^= a[0]>>9 + a[1]>>10 + a[2]>>11 + a[3]>>12
+	return s
+}
+
+func Hot(a []int) int {
+	return Big(a) + 1 // hot
+}
+
+func Cold(a []int) int {
+	return Big(a) + 2 // cold
+}
+`
+
+// pgoLine returns the line of pgoSrc that ends in the comment marker.
+func pgoLine(t *testing.T, marker string) int64 {
+	for i, l := range strings.Split(pgoSrc, "\n") {
+		if strings.HasSuffix(l, "// "+marker) {
+			return int64(i + 1)
+		}
+	}
+	t.Fatalf("no line marked %q", marker)
+	return 0
+}
+
+// pgoProfile returns a CPU profile in which Run mostly calls (*A).M,
+// and Big is called mostly from Hot.
+func pgoProfile(t *testing.T) []byte {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10000000,
+	}
+	funcs := make(map[string]*profile.Function)
+	loc := func(name string, line int64) *profile.Location {
+		f := funcs[name]
+		if f == nil {
+			f = &profile.Function{ID: uint64(len(funcs) + 1), Name: name, SystemName: name, Filename: "p.go"}
+			funcs[name] = f
+			p.Function = append(p.Function, f)
+		}
+		l := &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: f, Line: line}}}
+		p.Location = append(p.Location, l)
+		return l
+	}
+	sample := func(n int64, stack ...*profile.Location) {
+		p.Sample = append(p.Sample, &profile.Sample{Location: stack, Value: []int64{n, n * p.Period}})
+	}
+	sample(900, loc("p.(*A).M", 8), loc("p.Run", pgoLine(t, "devirt")))
+	sample(1, loc("p.B.M", 12), loc("p.Run", pgoLine(t, "devirt")))
+	sample(800, loc("p.Big", 20), loc("p.Hot", pgoLine(t, "hot")))
+	sample(1, loc("p.Big", 20), loc("p.Cold", pgoLine(t, "cold")))
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestPGO checks that the compiler devirtualizes and inlines the calls
+// that are hot in the profile given by -pgoprofile.
+func TestPGO(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "p.go")
+	if err := ioutil.WriteFile(src, []byte(pgoSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prof := filepath.Join(dir, "cpu.pprof")
+	if err := ioutil.WriteFile(prof, pgoProfile(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(testenv.GoToolPath(t), "tool", "compile", "-p", "p", "-m", "-pgoprofile", prof, "-o", filepath.Join(dir, "p.o"), src)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("compile failed: %v\n%s", err, out)
+	}
+	t.Logf("%s", out)
+
+	devirt, hot, cold := pgoLine(t, "devirt"), pgoLine(t, "hot"), pgoLine(t, "cold")
+	for _, want := range []string{
+		fmt.Sprintf(`:%d:\d+: PGO devirtualizing i.M to \*A`, devirt),
+		fmt.Sprintf(`:%d:\d+: inlining call to \(\*A\).M`, devirt),
+		fmt.Sprintf(`:%d:\d+: inlining call to Big`, hot),
+	} {
+		if !regexp.MustCompile(want).Match(out) {
+			t.Errorf("output does not match %q", want)
+		}
+	}
+	if regexp.MustCompile(fmt.Sprintf(`:%d:\d+: inlining call to Big`, cold)).Match(out) {
+		t.Errorf("Big inlined at cold call site")
+	}
+}
@@ -55,6 +55,17 @@ func NewPkg(path, name string) *Pkg {
 	return p
 }
 
+// PkgByPrefix returns the package whose symbol prefix is prefix
+// (see objabi.PathToPrefix), or nil if no such package is known.
+func PkgByPrefix(prefix string) *Pkg {
+	for _, p := range pkgMap {
+		if p.Prefix == prefix {
+			return p
+		}
+	}
+	return nil
+}
+
 // ImportedPkgList returns the list of directly imported packages.
 // The list is sorted by package path.
 func ImportedPkgList() []*Pkg {
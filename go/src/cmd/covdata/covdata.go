@@ -0,0 +1,96 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: go tool covdata {merge|subtract|intersect|textfmt} -i=dir1,dir2,... -o=output\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+var (
+	inputFlag  = flag.String("i", "", "comma-separated list of input directories")
+	outputFlag = flag.String("o", "", "output directory, or output file for textfmt")
+)
+
+func main() {
+	log.SetPrefix("covdata: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+	flag.CommandLine.Parse(os.Args[2:])
+	if flag.NArg() != 0 || *inputFlag == "" || *outputFlag == "" {
+		usage()
+	}
+
+	switch cmd {
+	case "merge", "textfmt":
+	case "subtract", "intersect":
+		if !strings.Contains(*inputFlag, ",") {
+			log.Fatalf("%s needs at least two input directories", cmd)
+		}
+	default:
+		log.Printf("unknown command %q", cmd)
+		usage()
+	}
+
+	var inputs []*profile
+	for _, dir := range strings.Split(*inputFlag, ",") {
+		if filepath.Clean(dir) == filepath.Clean(*outputFlag) {
+			log.Fatalf("output %s is also an input", *outputFlag)
+		}
+		p, err := readDir(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inputs = append(inputs, p)
+	}
+
+	var p *profile
+	var err error
+	switch cmd {
+	case "merge", "textfmt":
+		p, err = merge(inputs)
+	case "subtract":
+		p, err = subtract(inputs)
+	case "intersect":
+		p, err = intersect(inputs)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cmd != "textfmt" {
+		if err := p.writeDir(*outputFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	f, err := os.Create(*outputFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	p.writeText(w)
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
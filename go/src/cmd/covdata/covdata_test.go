@@ -0,0 +1,236 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"internal/coverage"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	fileA = coverage.MetaFile{
+		Name: "example.com/p/a.go",
+		Blocks: []coverage.Block{
+			{StartLine: 3, StartCol: 14, EndLine: 5, EndCol: 2, NumStmt: 1},
+			{StartLine: 7, StartCol: 14, EndLine: 9, EndCol: 2, NumStmt: 2},
+			{StartLine: 11, StartCol: 14, EndLine: 13, EndCol: 2, NumStmt: 3},
+		},
+	}
+	fileB = coverage.MetaFile{
+		Name:   "example.com/p/b.go",
+		Blocks: []coverage.Block{{StartLine: 3, StartCol: 20, EndLine: 6, EndCol: 2, NumStmt: 2}},
+	}
+)
+
+// writeRun writes the meta-data m and the counters of a run into dir,
+// as a program built with -cover would.
+func writeRun(t *testing.T, dir string, m *coverage.Meta, pid int, counts ...[]uint32) {
+	t.Helper()
+	h := m.Hash()
+	if err := writeFile(filepath.Join(dir, coverage.MetaFileName(h)), func(w io.Writer) error {
+		return coverage.WriteMeta(w, m)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	c := &coverage.Counters{MetaHash: h, Counts: counts}
+	if err := writeFile(filepath.Join(dir, coverage.CountersFileName(h, pid, 1)), func(w io.Writer) error {
+		return coverage.WriteCounters(w, c)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func text(p *profile) string {
+	var buf bytes.Buffer
+	p.writeText(&buf)
+	return buf.String()
+}
+
+func TestMergeDirs(t *testing.T) {
+	dir := t.TempDir()
+	// Two programs share a.go; the second has not run at all.
+	prog1 := &coverage.Meta{Mode: "count", Files: []coverage.MetaFile{fileA}}
+	prog2 := &coverage.Meta{Mode: "count", Files: []coverage.MetaFile{fileA, fileB}}
+	writeRun(t, dir, prog1, 1, []uint32{1, 0, 2})
+	writeRun(t, dir, prog1, 2, []uint32{3, 0, 0})
+	writeRun(t, dir, prog2, 3, []uint32{0, 1, 0}, []uint32{5})
+	if err := os.WriteFile(filepath.Join(dir, "unrelated"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := readDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `mode: count
+example.com/p/a.go:3.14,5.2 1 4
+example.com/p/a.go:7.14,9.2 2 1
+example.com/p/a.go:11.14,13.2 3 2
+example.com/p/b.go:3.20,6.2 2 5
+`
+	if got := text(p); got != want {
+		t.Errorf("merged profile:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Writing the merged profile and reading it back
+	// yields the same profile.
+	out := t.TempDir()
+	if err := p.writeDir(out); err != nil {
+		t.Fatal(err)
+	}
+	q, err := readDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := text(q); got != want {
+		t.Errorf("merged profile read back:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	m := &coverage.Meta{Mode: "set", Files: []coverage.MetaFile{fileB}}
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	writeRun(t, dir1, m, 1, []uint32{1})
+	writeRun(t, dir2, m, 1, []uint32{1})
+	p1, err := readDir(dir1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := readDir(dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := merge([]*profile{p1, p2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "mode: set\nexample.com/p/b.go:3.20,6.2 2 1\n"
+	if got := text(p); got != want {
+		t.Errorf("merged profile:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSubtractIntersect(t *testing.T) {
+	m := &coverage.Meta{Mode: "count", Files: []coverage.MetaFile{fileA, fileB}}
+	mA := &coverage.Meta{Mode: "count", Files: []coverage.MetaFile{fileA}}
+	var profiles []*profile
+	for _, run := range []struct {
+		m      *coverage.Meta
+		counts [][]uint32
+	}{
+		{m, [][]uint32{{1, 2, 3}, {4}}},
+		{m, [][]uint32{{0, 5, 6}, {0}}},
+		{mA, [][]uint32{{7, 8, 0}}},
+	} {
+		dir := t.TempDir()
+		writeRun(t, dir, run.m, 1, run.counts...)
+		p, err := readDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profiles = append(profiles, p)
+	}
+
+	p, err := subtract(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `mode: count
+example.com/p/a.go:3.14,5.2 1 0
+example.com/p/a.go:7.14,9.2 2 0
+example.com/p/a.go:11.14,13.2 3 0
+example.com/p/b.go:3.20,6.2 2 4
+`
+	if got := text(p); got != want {
+		t.Errorf("subtract:\n%s\nwant:\n%s", got, want)
+	}
+
+	p, err = intersect(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `mode: count
+example.com/p/a.go:3.14,5.2 1 0
+example.com/p/a.go:7.14,9.2 2 15
+example.com/p/a.go:11.14,13.2 3 0
+example.com/p/b.go:3.20,6.2 2 0
+`
+	if got := text(p); got != want {
+		t.Errorf("intersect:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The inputs are unchanged.
+	want = `mode: count
+example.com/p/a.go:3.14,5.2 1 1
+example.com/p/a.go:7.14,9.2 2 2
+example.com/p/a.go:11.14,13.2 3 3
+example.com/p/b.go:3.20,6.2 2 4
+`
+	if got := text(profiles[0]); got != want {
+		t.Errorf("first input after subtract and intersect:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestReadDirErrors(t *testing.T) {
+	m := &coverage.Meta{Mode: "count", Files: []coverage.MetaFile{fileA}}
+	for _, tt := range []struct {
+		name  string
+		setup func(dir string)
+		err   string
+	}{
+		{
+			name:  "empty",
+			setup: func(dir string) {},
+			err:   "no coverage meta-data files",
+		},
+		{
+			name: "missing meta-data",
+			setup: func(dir string) {
+				writeRun(t, dir, m, 1, []uint32{1, 2, 3})
+				os.Remove(filepath.Join(dir, coverage.MetaFileName(m.Hash())))
+				writeRun(t, dir, &coverage.Meta{Mode: "count"}, 2)
+			},
+			err: "no meta-data file",
+		},
+		{
+			name: "wrong number of counters",
+			setup: func(dir string) {
+				writeRun(t, dir, m, 1, []uint32{1, 2})
+			},
+			err: "counter data has 2 blocks",
+		},
+		{
+			name: "conflicting modes",
+			setup: func(dir string) {
+				writeRun(t, dir, m, 1, []uint32{1, 2, 3})
+				writeRun(t, dir, &coverage.Meta{Mode: "set", Files: []coverage.MetaFile{fileB}}, 2, []uint32{1})
+			},
+			err: "conflicting coverage modes",
+		},
+		{
+			name: "conflicting meta-data",
+			setup: func(dir string) {
+				writeRun(t, dir, m, 1, []uint32{1, 2, 3})
+				a := coverage.MetaFile{Name: fileA.Name, Blocks: fileA.Blocks[:2]}
+				writeRun(t, dir, &coverage.Meta{Mode: "count", Files: []coverage.MetaFile{a}}, 2, []uint32{1, 2})
+			},
+			err: "conflicting meta-data for example.com/p/a.go",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(dir)
+			_, err := readDir(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readDir: %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Covdata is a program for manipulating the coverage data files written
+by programs built with 'go build -cover'.
+
+Usage:
+	go tool covdata command -i=dir1,dir2,... -o=output
+
+Each input directory holds the files written by one or more runs of one
+or more programs, as directed by the GOCOVERDIR environment variable.
+The commands are:
+
+	merge
+		merge the coverage data of the input directories, and write
+		it into the output directory.
+	subtract
+		write into the output directory the coverage data of the first
+		input directory, minus the blocks covered in any of the others.
+	intersect
+		write into the output directory the coverage data of the blocks
+		covered in all the input directories.
+	textfmt
+		merge the coverage data of the input directories, and write it
+		to the output file in the text profile format read by
+		'go tool cover', as written by 'go test -coverprofile'.
+
+For example, to view the coverage of the runs of an integration test
+as HTML:
+
+	go build -cover -o myprogram .
+	mkdir covdata
+	GOCOVERDIR=covdata ./run-integration-tests.sh
+	go tool covdata textfmt -i=covdata -o=cover.out
+	go tool cover -html=cover.out
+
+Counts are merged according to the coverage mode: in set mode, a block
+is covered if it is covered by any run; in count and atomic modes, the
+counts of the runs are added. The inputs must all have the same coverage
+mode, and must agree on the blocks of the source files they have in
+common.
+*/
+package main
@@ -0,0 +1,333 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"internal/coverage"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A profile is the coverage data of a set of runs: the blocks of each
+// instrumented source file, and their counters merged over the runs.
+type profile struct {
+	mode  string
+	files map[string]*fileData // by file name
+}
+
+// fileData is the coverage data of a source file.
+type fileData struct {
+	blocks []coverage.Block
+	counts []uint32
+}
+
+func newProfile() *profile {
+	return &profile{files: make(map[string]*fileData)}
+}
+
+// readDir reads the coverage data files in dir, and merges them.
+func readDir(dir string) (*profile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	metas := make(map[coverage.Hash]*coverage.Meta)
+	var hashes []coverage.Hash
+	var counters []string
+	for _, e := range entries {
+		name := e.Name()
+		if h, ok := coverage.ParseMetaFileName(name); ok {
+			m, err := readMeta(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			if m.Hash() != h {
+				return nil, fmt.Errorf("%s: meta-data does not match file name", filepath.Join(dir, name))
+			}
+			metas[h] = m
+			hashes = append(hashes, h)
+		} else if _, ok := coverage.ParseCountersFileName(name); ok {
+			counters = append(counters, name)
+		}
+	}
+	if len(metas) == 0 {
+		return nil, fmt.Errorf("no coverage meta-data files in %s", dir)
+	}
+
+	p := newProfile()
+
+	// Files that no run has written counters for are still part of
+	// the profile, with zero counts.
+	for _, h := range hashes {
+		if err := p.add(metas[h], nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Join(dir, coverage.MetaFileName(h)), err)
+		}
+	}
+
+	for _, name := range counters {
+		file := filepath.Join(dir, name)
+		c, err := readCounters(file)
+		if err != nil {
+			return nil, err
+		}
+		h, _ := coverage.ParseCountersFileName(name)
+		m := metas[h]
+		if m == nil {
+			return nil, fmt.Errorf("%s: no meta-data file %s", file, coverage.MetaFileName(h))
+		}
+		if c.MetaHash != h {
+			return nil, fmt.Errorf("%s: counter data does not match file name", file)
+		}
+		if err := c.Check(m); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if err := p.add(m, c); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return p, nil
+}
+
+func readMeta(file string) (*coverage.Meta, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := coverage.ReadMeta(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return m, nil
+}
+
+func readCounters(file string) (*coverage.Counters, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := coverage.ReadCounters(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return c, nil
+}
+
+// add merges the counters c, described by the meta-data m, into p.
+// If c is nil, add only adds the files of m.
+func (p *profile) add(m *coverage.Meta, c *coverage.Counters) error {
+	if err := p.setMode(m.Mode); err != nil {
+		return err
+	}
+	for i, mf := range m.Files {
+		f, err := p.file(mf.Name, mf.Blocks)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			for j, n := range c.Counts[i] {
+				f.counts[j] = p.combine(f.counts[j], n)
+			}
+		}
+	}
+	return nil
+}
+
+// addProfile merges the profile q into p.
+func (p *profile) addProfile(q *profile) error {
+	if err := p.setMode(q.mode); err != nil {
+		return err
+	}
+	for _, name := range q.names() {
+		g := q.files[name]
+		f, err := p.file(name, g.blocks)
+		if err != nil {
+			return err
+		}
+		for j, n := range g.counts {
+			f.counts[j] = p.combine(f.counts[j], n)
+		}
+	}
+	return nil
+}
+
+func (p *profile) setMode(mode string) error {
+	if p.mode == "" {
+		p.mode = mode
+	} else if p.mode != mode {
+		return fmt.Errorf("conflicting coverage modes %s and %s", p.mode, mode)
+	}
+	return nil
+}
+
+// file returns the data of the named file, which has the given blocks,
+// adding it to p if needed.
+func (p *profile) file(name string, blocks []coverage.Block) (*fileData, error) {
+	f := p.files[name]
+	if f == nil {
+		f = &fileData{
+			blocks: blocks,
+			counts: make([]uint32, len(blocks)),
+		}
+		p.files[name] = f
+		return f, nil
+	}
+	if !sameBlocks(f.blocks, blocks) {
+		return nil, fmt.Errorf("conflicting meta-data for %s", name)
+	}
+	return f, nil
+}
+
+func sameBlocks(x, y []coverage.Block) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// combine returns the merge of the counts x and y of a block.
+func (p *profile) combine(x, y uint32) uint32 {
+	if p.mode == "set" {
+		if x|y != 0 {
+			return 1
+		}
+		return 0
+	}
+	if x+y < x {
+		return math.MaxUint32
+	}
+	return x + y
+}
+
+// names returns the names of the files of p, in sorted order.
+func (p *profile) names() []string {
+	var names []string
+	for name := range p.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// merge returns the merge of the profiles.
+func merge(profiles []*profile) (*profile, error) {
+	p := newProfile()
+	for _, q := range profiles {
+		if err := p.addProfile(q); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// subtract returns the first profile, with the counts of the blocks
+// covered in any of the other profiles cleared.
+func subtract(profiles []*profile) (*profile, error) {
+	p, err := merge(profiles[:1])
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range profiles[1:] {
+		if err := p.setMode(q.mode); err != nil {
+			return nil, err
+		}
+		for name, f := range p.files {
+			g := q.files[name]
+			if g == nil {
+				continue
+			}
+			if !sameBlocks(f.blocks, g.blocks) {
+				return nil, fmt.Errorf("conflicting meta-data for %s", name)
+			}
+			for j, n := range g.counts {
+				if n != 0 {
+					f.counts[j] = 0
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// intersect returns the merge of the profiles, with the counts of the
+// blocks not covered in all of them cleared.
+func intersect(profiles []*profile) (*profile, error) {
+	p, err := merge(profiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range profiles {
+		for name, f := range p.files {
+			g := q.files[name]
+			for j := range f.counts {
+				if g == nil || g.counts[j] == 0 {
+					f.counts[j] = 0
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// writeDir writes p into dir, as a meta-data file and a counter data
+// file.
+func (p *profile) writeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	m := &coverage.Meta{Mode: p.mode}
+	c := new(coverage.Counters)
+	for _, name := range p.names() {
+		f := p.files[name]
+		m.Files = append(m.Files, coverage.MetaFile{Name: name, Blocks: f.blocks})
+		c.Counts = append(c.Counts, f.counts)
+	}
+	c.MetaHash = m.Hash()
+
+	err := writeFile(filepath.Join(dir, coverage.MetaFileName(c.MetaHash)), func(w io.Writer) error {
+		return coverage.WriteMeta(w, m)
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, coverage.CountersFileName(c.MetaHash, os.Getpid(), time.Now().UnixNano())), func(w io.Writer) error {
+		return coverage.WriteCounters(w, c)
+	})
+}
+
+func writeFile(file string, write func(io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeText writes p in the text profile format read by
+// 'go tool cover'.
+func (p *profile) writeText(w io.Writer) {
+	fmt.Fprintf(w, "mode: %s\n", p.mode)
+	for _, name := range p.names() {
+		f := p.files[name]
+		for j, b := range f.blocks {
+			fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", name, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, f.counts[j])
+		}
+	}
+}
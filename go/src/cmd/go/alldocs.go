@@ -135,6 +135,23 @@
 // 		build mode to use. See 'go help buildmode' for more.
 // 	-compiler name
 // 		name of compiler to use, as in runtime.Compiler (gccgo or gc).
+// 	-cover
+// 		instrument the built binaries for code coverage. When such a
+// 		binary exits, it writes coverage data files into the directory
+// 		named by the GOCOVERDIR environment variable; see
+// 		'go doc runtime/coverage' and 'go tool covdata'.
+// 		The coverage flags apply to the build, install and run
+// 		commands; for the test command, see 'go help testflag'.
+// 	-covermode set,count,atomic
+// 		set the mode of coverage analysis: whether, how many times,
+// 		or how many times with atomic updates, each statement runs.
+// 		The default is "set" unless -race is enabled, in which case
+// 		it is "atomic". Sets -cover.
+// 	-coverpkg pattern1,pattern2,pattern3
+// 		instrument the packages matching the patterns, rather than
+// 		the packages named on the command line and, in module mode,
+// 		the packages of the main module. See 'go help packages'
+// 		for a description of package patterns. Sets -cover.
 // 	-gccgoflags '[pattern=]arg list'
 // 		arguments to pass on each gccgo compiler/linker invocation.
 // 	-gcflags '[pattern=]arg list'
@@ -178,6 +195,12 @@
 // 		include path must be in the same directory as the Go package they are
 // 		included from, and overlays will not appear when binaries and tests are
 // 		run through go run and go test respectively.
+// 	-pgo file
+// 		use the CPU profile in file, as written by runtime/pprof, for
+// 		profile-guided optimization: the compiler inlines and devirtualizes
+// 		the calls that are hot in the profile more aggressively. A profile
+// 		collected from an older version of the program remains useful.
+// 		Profile-guided optimization is disabled by default or with -pgo=off.
 // 	-pkgdir dir
 // 		install and load all packages from dir instead of the usual locations.
 // 		For example, when building with a non-standard configuration,
@@ -284,6 +307,13 @@
 // download cache, including unpacked source code of versioned
 // dependencies.
 //
+// The -fuzzcache flag causes clean to remove files stored in the Go build
+// cache for fuzz testing. The fuzzing engine caches files that expand
+// code coverage, so removing them may make fuzzing less effective until
+// new inputs are found that provide the same coverage. These files are
+// distinct from those stored in testdata directory; clean does not remove
+// those files.
+//
 // For more about build flags, see 'go help build'.
 //
 // For more about specifying packages, see 'go help packages'.
@@ -1387,8 +1417,8 @@
 //
 // 'Go test' recompiles each package along with any files with names matching
 // the file pattern "*_test.go".
-// These additional files can contain test functions, benchmark functions, and
-// example functions. See 'go help testfunc' for more.
+// These additional files can contain test functions, benchmark functions, fuzz
+// targets and example functions. See 'go help testfunc' for more.
 // Each listed package causes the execution of a separate test binary.
 // Files whose names begin with "_" (including "_test.go") or "." are ignored.
 //
@@ -1791,6 +1821,9 @@
 // 	GOCACHE
 // 		The directory where the go command will store cached
 // 		information for reuse in future builds.
+// 	GOCOVERDIR
+// 		The directory into which programs built with 'go build -cover'
+// 		write their coverage data files when they exit.
 // 	GOMODCACHE
 // 		The directory where the go command will store downloaded modules.
 // 	GODEBUG
@@ -2658,10 +2691,34 @@
 // 	-failfast
 // 	    Do not start new tests after the first test failure.
 //
+// 	-fuzz regexp
+// 	    Run the fuzz target matching the regular expression. When specified,
+// 	    the command line argument must match exactly one package within the
+// 	    main module, and regexp must match exactly one fuzz target within
+// 	    that package. Fuzzing will occur after tests, benchmarks, seed corpora
+// 	    of other fuzz targets, and examples have completed. See the Fuzzing
+// 	    section of the testing package documentation for details.
+//
+// 	-fuzztime t
+// 	    Run enough iterations of the fuzz target to take t, specified as a
+// 	    time.Duration (for example, -fuzztime 1h30s).
+// 	    The default is to run forever.
+// 	    The special syntax Nx means to run the fuzz target N times
+// 	    (for example, -fuzztime 1000x).
+//
+// 	-fuzzminimizetime t
+// 	    Run enough iterations of the fuzz target during each minimization
+// 	    attempt to take t, as specified as a time.Duration (for example,
+// 	    -fuzzminimizetime 30s).
+// 	    The default is 60s.
+// 	    The special syntax Nx means to run the fuzz target N times
+// 	    (for example, -fuzzminimizetime 100x).
+//
 // 	-list regexp
-// 	    List tests, benchmarks, or examples matching the regular expression.
-// 	    No tests, benchmarks or examples will be run. This will only
-// 	    list top-level tests. No subtest or subbenchmarks will be shown.
+// 	    List tests, benchmarks, fuzz targets, or examples matching the
+// 	    regular expression. No tests, benchmarks, fuzz targets, or examples
+// 	    will be run. This will only list top-level tests. No subtest or
+// 	    subbenchmarks will be shown.
 //
 // 	-parallel n
 // 	    Allow parallel execution of test functions that call t.Parallel.
@@ -2831,8 +2888,9 @@
 //
 // Testing functions
 //
-// The 'go test' command expects to find test, benchmark, and example functions
-// in the "*_test.go" files corresponding to the package under test.
+// The 'go test' command expects to find test, benchmark, fuzz target, and
+// example functions in the "*_test.go" files corresponding to the package
+// under test.
 //
 // A test function is one named TestXxx (where Xxx does not start with a
 // lower case letter) and should have the signature,
@@ -2843,6 +2901,10 @@
 //
 // 	func BenchmarkXxx(b *testing.B) { ... }
 //
+// A fuzz target is one named FuzzXxx and should have the signature,
+//
+// 	func FuzzXxx(f *testing.F) { ... }
+//
 // An example function is similar to a test function but, instead of using
 // *testing.T to report success or failure, prints output to os.Stdout.
 // If the last comment in the function starts with "Output:" then the output
@@ -2882,7 +2944,7 @@
 //
 // The entire test file is presented as the example when it contains a single
 // example function, at least one other function, type, variable, or constant
-// declaration, and no test or benchmark functions.
+// declaration, and no test, benchmark, or fuzz target functions.
 //
 // See the documentation of the testing package for more information.
 //
@@ -6,6 +6,7 @@ package base
 
 import (
 	"flag"
+	"strings"
 
 	"cmd/go/internal/cfg"
 	"cmd/go/internal/fsys"
@@ -29,6 +30,23 @@ func (v *StringsFlag) String() string {
 	return "<StringsFlag>"
 }
 
+// A CommaListFlag is a command-line flag that interprets its argument
+// as a comma-separated list of strings.
+type CommaListFlag []string
+
+func (v *CommaListFlag) Set(s string) error {
+	if s == "" {
+		*v = nil
+	} else {
+		*v = strings.Split(s, ",")
+	}
+	return nil
+}
+
+func (v *CommaListFlag) String() string {
+	return strings.Join(*v, ",")
+}
+
 // explicitStringFlag is like a regular string flag, but it also tracks whether
 // the string was set explicitly to a non-empty value.
 type explicitStringFlag struct {
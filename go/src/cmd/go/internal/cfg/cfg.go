@@ -27,6 +27,9 @@ var (
 	BuildA                 bool   // -a flag
 	BuildBuildmode         string // -buildmode flag
 	BuildContext           = defaultContext()
+	BuildCover             bool                    // -cover flag
+	BuildCoverMode         string                  // -covermode flag
+	BuildCoverPkg          []string                // -coverpkg flag
 	BuildMod               string                  // -mod flag
 	BuildModExplicit       bool                    // whether -mod was set explicitly
 	BuildModReason         string                  // reason -mod was set, if set by default
@@ -35,6 +38,7 @@ var (
 	BuildMSan              bool                    // -msan flag
 	BuildN                 bool                    // -n flag
 	BuildO                 string                  // -o flag
+	BuildPGOFile           string                  // -pgo flag
 	BuildP                 = runtime.GOMAXPROCS(0) // -p flag
 	BuildPkgdir            string                  // -pkgdir flag
 	BuildRace              bool                    // -race flag
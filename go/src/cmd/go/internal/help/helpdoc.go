@@ -498,6 +498,9 @@ General-purpose environment variables:
 	GOCACHE
 		The directory where the go command will store cached
 		information for reuse in future builds.
+	GOCOVERDIR
+		The directory into which programs built with 'go build -cover'
+		write their coverage data files when they exit.
 	GOMODCACHE
 		The directory where the go command will store downloaded modules.
 	GODEBUG
@@ -0,0 +1,157 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package load
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cmd/go/internal/base"
+	"cmd/go/internal/cfg"
+	"cmd/go/internal/str"
+)
+
+// PrepareForCoverageBuild prepares pkgs and their dependencies for a
+// build with -cover. It selects the packages to instrument: those
+// matching the -coverpkg patterns or, by default, the packages named
+// on the command line and the packages of the main modules. The
+// instrumented packages register their counters with
+// internal/coverage/rtcov, and main packages link runtime/coverage,
+// which writes the counters out when the program exits.
+func PrepareForCoverageBuild(pkgs []*Package) {
+	var match []func(*Package) bool
+	for _, pattern := range cfg.BuildCoverPkg {
+		match = append(match, MatchPackage(pattern, base.Cwd()))
+	}
+	matched := make([]bool, len(match))
+	selected := func(p *Package) bool {
+		if len(match) == 0 {
+			return p.Internal.CmdlinePkg || p.Module != nil && p.Module.Main
+		}
+		haveMatch := false
+		for i := range match {
+			if match[i](p) {
+				matched[i] = true
+				haveMatch = true
+			}
+		}
+		return haveMatch
+	}
+
+	// Add the imports of main packages first, so that the packages
+	// they bring in are considered for coverage too.
+	for _, p := range pkgs {
+		if p.Name == "main" && !p.Internal.ForceLibrary {
+			p.Internal.CoverRuntime = true
+			ensureCoverImport(p, "runtime/coverage")
+		}
+	}
+
+	for _, p := range PackageList(pkgs) {
+		if !selected(p) || coverExcluded(p) {
+			continue
+		}
+		// A package with only test files has nothing to instrument.
+		if len(p.GoFiles)+len(p.CgoFiles) == 0 {
+			continue
+		}
+		p.Internal.CoverMode = cfg.BuildCoverMode
+		p.Internal.CoverVars = DeclareCoverVars(p, str.StringList(p.GoFiles, p.CgoFiles)...)
+		p.Internal.CoverRuntime = true
+		ensureCoverImport(p, "internal/coverage/rtcov")
+		if cfg.BuildCoverMode == "atomic" {
+			// sync/atomic import is inserted by the cover tool.
+			ensureCoverImport(p, "sync/atomic")
+		}
+	}
+
+	// Warn about -coverpkg arguments that match nothing.
+	for i, pattern := range cfg.BuildCoverPkg {
+		if !matched[i] {
+			fmt.Fprintf(os.Stderr, "warning: no packages being built depend on matches for pattern %s\n", pattern)
+		}
+	}
+}
+
+// coverExcluded reports whether the standard package p must not be
+// instrumented for a build with -cover.
+func coverExcluded(p *Package) bool {
+	if !p.Standard {
+		return false
+	}
+	switch p.ImportPath {
+	case "unsafe":
+		// There is nothing to cover in package unsafe;
+		// it comes from the compiler.
+		return true
+	case "internal/coverage/rtcov":
+		// The instrumented packages import it.
+		return true
+	case "sync/atomic":
+		// Atomic coverage mode uses sync/atomic, so we can't
+		// also do coverage on it.
+		return cfg.BuildCoverMode == "atomic"
+	}
+	// The runtime runs code in contexts, such as signal handlers and
+	// before the heap is set up, that must not run instrumented code.
+	return p.ImportPath == "runtime" || strings.HasPrefix(p.ImportPath, "runtime/internal/")
+}
+
+// ensureCoverImport makes p import the standard package pkg, which
+// the code added by coverage instrumentation depends on.
+func ensureCoverImport(p *Package, pkg string) {
+	for _, p1 := range p.Internal.Imports {
+		if p1.ImportPath == pkg {
+			return
+		}
+	}
+	p1 := LoadImportWithFlags(pkg, "", nil, &ImportStack{}, nil, 0)
+	if p1.Error != nil {
+		base.Fatalf("load %s: %v", pkg, p1.Error)
+	}
+	p.Internal.Imports = append(p.Internal.Imports, p1)
+}
+
+// DeclareCoverVars attaches the required cover variables names
+// to the files, to be used when annotating the files.
+func DeclareCoverVars(p *Package, files ...string) map[string]*CoverVar {
+	coverVars := make(map[string]*CoverVar)
+	coverIndex := 0
+	// We create the cover counters as new top-level variables in the package.
+	// We need to avoid collisions with user variables (GoCover_0 is unlikely but still)
+	// and more importantly with dot imports of other covered packages,
+	// so we append 12 hex digits from the SHA-256 of the import path.
+	// The point is only to avoid accidents, not to defeat users determined to
+	// break things.
+	sum := sha256.Sum256([]byte(p.ImportPath))
+	h := fmt.Sprintf("%x", sum[:6])
+	for _, file := range files {
+		// We don't cover tests, only the code they test.
+		if base.IsTestFile(file) {
+			continue
+		}
+		// For a package that is "local" (imported via ./ import or command line, outside GOPATH),
+		// we record the full path to the file name.
+		// Otherwise we record the import path, then a forward slash, then the file name.
+		// This makes profiles within GOPATH file system-independent.
+		// These names appear in the cmd/cover HTML interface.
+		var longFile string
+		if p.Internal.Local {
+			longFile = filepath.Join(p.Dir, file)
+		} else {
+			longFile = path.Join(p.ImportPath, file)
+		}
+		coverVars[file] = &CoverVar{
+			File: longFile,
+			Var:  fmt.Sprintf("GoCover_%d_%x", coverIndex, h),
+		}
+		coverIndex++
+	}
+	return coverVars
+}
@@ -205,6 +205,8 @@ type PackageInternal struct {
 	ExeName           string               // desired name for temporary executable
 	CoverMode         string               // preprocess Go source files with the coverage tool in this mode
 	CoverVars         map[string]*CoverVar // variables created by coverage analysis
+	CoverRuntime      bool                 // register coverage variables with the runtime (go build -cover)
+	FuzzInstrument    bool                 // package should be instrumented for fuzzing
 	OmitDebug         bool                 // tell linker not to write debug information
 	GobinSubdir       bool                 // install target would be subdir of GOBIN
 	BuildInfo         string               // add this info to package main
@@ -64,7 +64,7 @@ func testFlags() []string {
 		name := strings.TrimPrefix(f.Name, "test.")
 
 		switch name {
-		case "testlogfile", "paniconexit0":
+		case "testlogfile", "paniconexit0", "fuzzcachedir":
 			// These flags are only for use by cmd/go.
 		default:
 			names = append(names, name)
@@ -37,7 +37,7 @@ func init() {
 
 	cf.BoolVar(&testCover, "cover", false, "")
 	cf.Var(coverFlag{(*coverModeFlag)(&testCoverMode)}, "covermode", "")
-	cf.Var(coverFlag{commaListFlag{&testCoverPaths}}, "coverpkg", "")
+	cf.Var(coverFlag{(*base.CommaListFlag)(&testCoverPaths)}, "coverpkg", "")
 
 	cf.Var((*base.StringsFlag)(&work.ExecCmd), "exec", "")
 	cf.BoolVar(&testJSON, "json", false, "")
@@ -57,6 +57,9 @@ func init() {
 	cf.String("cpu", "", "")
 	cf.StringVar(&testCPUProfile, "cpuprofile", "", "")
 	cf.Bool("failfast", false, "")
+	cf.StringVar(&testFuzz, "fuzz", "", "")
+	cf.String("fuzzminimizetime", "", "")
+	cf.String("fuzztime", "", "")
 	cf.StringVar(&testList, "list", "", "")
 	cf.StringVar(&testMemProfile, "memprofile", "", "")
 	cf.String("memprofilerate", "", "")
@@ -102,20 +105,6 @@ func (f *coverModeFlag) Set(value string) error {
 	}
 }
 
-// A commaListFlag is a flag.Value representing a comma-separated list.
-type commaListFlag struct{ vals *[]string }
-
-func (f commaListFlag) String() string { return strings.Join(*f.vals, ",") }
-
-func (f commaListFlag) Set(value string) error {
-	if value == "" {
-		*f.vals = nil
-	} else {
-		*f.vals = strings.Split(value, ",")
-	}
-	return nil
-}
-
 // A stringFlag is a flag.Value representing a single string.
 type stringFlag struct{ val *string }
 
@@ -89,6 +89,23 @@ and test commands:
 		build mode to use. See 'go help buildmode' for more.
 	-compiler name
 		name of compiler to use, as in runtime.Compiler (gccgo or gc).
+	-cover
+		instrument the built binaries for code coverage. When such a
+		binary exits, it writes coverage data files into the directory
+		named by the GOCOVERDIR environment variable; see
+		'go doc runtime/coverage' and 'go tool covdata'.
+		The coverage flags apply to the build, install and run
+		commands; for the test command, see 'go help testflag'.
+	-covermode set,count,atomic
+		set the mode of coverage analysis: whether, how many times,
+		or how many times with atomic updates, each statement runs.
+		The default is "set" unless -race is enabled, in which case
+		it is "atomic". Sets -cover.
+	-coverpkg pattern1,pattern2,pattern3
+		instrument the packages matching the patterns, rather than
+		the packages named on the command line and, in module mode,
+		the packages of the main module. See 'go help packages'
+		for a description of package patterns. Sets -cover.
 	-gccgoflags '[pattern=]arg list'
 		arguments to pass on each gccgo compiler/linker invocation.
 	-gcflags '[pattern=]arg list'
@@ -132,6 +149,12 @@ and test commands:
 		include path must be in the same directory as the Go package they are
 		included from, and overlays will not appear when binaries and tests are
 		run through go run and go test respectively.
+	-pgo file
+		use the CPU profile in file, as written by runtime/pprof, for
+		profile-guided optimization: the compiler inlines and devirtualizes
+		the calls that are hot in the profile more aggressively. A profile
+		collected from an older version of the program remains useful.
+		Profile-guided optimization is disabled by default or with -pgo=off.
 	-pkgdir dir
 		install and load all packages from dir instead of the usual locations.
 		For example, when building with a non-standard configuration,
@@ -201,6 +224,8 @@ func init() {
 
 	AddBuildFlags(CmdBuild, DefaultBuildFlags)
 	AddBuildFlags(CmdInstall, DefaultBuildFlags)
+	AddCoverFlags(CmdBuild)
+	AddCoverFlags(CmdInstall)
 }
 
 // Note that flags consulted by other parts of the code
@@ -289,6 +314,7 @@ func AddBuildFlags(cmd *base.Command, mask BuildFlagMask) {
 	cmd.Flag.StringVar(&cfg.BuildPkgdir, "pkgdir", "", "")
 	cmd.Flag.BoolVar(&cfg.BuildRace, "race", false, "")
 	cmd.Flag.BoolVar(&cfg.BuildMSan, "msan", false, "")
+	cmd.Flag.StringVar(&cfg.BuildPGOFile, "pgo", "", "")
 	cmd.Flag.Var((*tagsFlag)(&cfg.BuildContext.BuildTags), "tags", "")
 	cmd.Flag.Var((*base.StringsFlag)(&cfg.BuildToolexec), "toolexec", "")
 	cmd.Flag.BoolVar(&cfg.BuildTrimpath, "trimpath", false, "")
@@ -299,6 +325,15 @@ func AddBuildFlags(cmd *base.Command, mask BuildFlagMask) {
 	cmd.Flag.StringVar(&cfg.DebugTrace, "debug-trace", "", "")
 }
 
+// AddCoverFlags adds the flags that instrument binaries for coverage
+// to the build, install and run commands. The test command has its own
+// coverage flags of the same names.
+func AddCoverFlags(cmd *base.Command) {
+	cmd.Flag.BoolVar(&cfg.BuildCover, "cover", false, "")
+	cmd.Flag.StringVar(&cfg.BuildCoverMode, "covermode", "", "")
+	cmd.Flag.Var((*base.CommaListFlag)(&cfg.BuildCoverPkg), "coverpkg", "")
+}
+
 // tagsFlag is the implementation of the -tags flag.
 type tagsFlag []string
 
@@ -400,6 +435,9 @@ func runBuild(ctx context.Context, cmd *base.Command, args []string) {
 	}
 
 	pkgs = omitTestOnly(pkgsFilter(pkgs))
+	if cfg.BuildCover {
+		load.PrepareForCoverageBuild(pkgs)
+	}
 
 	// Special case -o /dev/null by not writing at all.
 	if cfg.BuildO == os.DevNull {
@@ -654,6 +692,9 @@ func InstallPackages(ctx context.Context, patterns []string, pkgs []*load.Packag
 	}
 
 	pkgs = omitTestOnly(pkgsFilter(pkgs))
+	if cfg.BuildCover {
+		load.PrepareForCoverageBuild(pkgs)
+	}
 	for _, p := range pkgs {
 		if p.Target == "" {
 			switch {
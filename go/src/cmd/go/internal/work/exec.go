@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -281,6 +282,12 @@ func (b *Builder) buildActionID(a *Action) cache.ActionID {
 	if p.Internal.CoverMode != "" {
 		fmt.Fprintf(h, "cover %q %q\n", p.Internal.CoverMode, b.toolID("cover"))
 	}
+	if p.Internal.CoverRuntime {
+		fmt.Fprintf(h, "coverruntime\n")
+	}
+	if p.Internal.FuzzInstrument {
+		fmt.Fprintf(h, "fuzz\n")
+	}
 	fmt.Fprintf(h, "modinfo %q\n", p.Internal.BuildInfo)
 
 	// Configuration specific to compiler toolchain.
@@ -289,6 +296,11 @@ func (b *Builder) buildActionID(a *Action) cache.ActionID {
 		base.Fatalf("buildActionID: unknown build toolchain %q", cfg.BuildToolchainName)
 	case "gc":
 		fmt.Fprintf(h, "compile %s %q %q\n", b.toolID("compile"), forcedGcflags, p.Internal.Gcflags)
+		if cfg.BuildPGOFile != "" {
+			// The profile affects the generated code, but its
+			// location doesn't.
+			fmt.Fprintf(h, "pgofile %s\n", b.fileHash(cfg.BuildPGOFile))
+		}
 		if len(p.SFiles) > 0 {
 			fmt.Fprintf(h, "asm %q %q %q\n", b.toolID("asm"), forcedAsmflags, p.Internal.Asmflags)
 		}
@@ -637,6 +649,17 @@ OverlayLoop:
 		}
 	}
 
+	// For a build with -cover, add a file that registers the coverage
+	// variables with the runtime and, in a main package, links the
+	// package that writes them out when the program exits.
+	if a.Package.Internal.CoverRuntime {
+		coverFile := objdir + "_cover_runtime_.go"
+		if err := b.writeFile(coverFile, coverRuntimeFile(a.Package)); err != nil {
+			return err
+		}
+		gofiles = append(gofiles, coverFile)
+	}
+
 	// Run cgo.
 	if a.Package.UsesCgo() || a.Package.UsesSwig() {
 		// In a package using cgo, cgo compiles the C, C++ and assembly files with gcc.
@@ -1865,6 +1888,39 @@ func (b *Builder) cover(a *Action, dst, src string, varName string) error {
 		src)
 }
 
+// coverRuntimeFile returns the content of the file added to package p
+// for a build with -cover. It registers the coverage variables of p
+// with internal/coverage/rtcov, and imports runtime/coverage into
+// main packages.
+func coverRuntimeFile(p *load.Package) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by 'go build -cover'. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", p.Name)
+	if p.Name == "main" {
+		fmt.Fprintf(&buf, "import _ \"runtime/coverage\"\n")
+	}
+	if len(p.Internal.CoverVars) == 0 {
+		return buf.Bytes()
+	}
+
+	// Register the files in a deterministic order.
+	var files []string
+	for file := range p.Internal.CoverVars {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	fmt.Fprintf(&buf, "import _cover_rtcov_ \"internal/coverage/rtcov\"\n\n")
+	fmt.Fprintf(&buf, "func init() {\n")
+	for _, file := range files {
+		cv := p.Internal.CoverVars[file]
+		fmt.Fprintf(&buf, "\t_cover_rtcov_.RegisterFile(%q, %q, %s.Count[:], %s.Pos[:], %s.NumStmt[:])\n",
+			cv.File, p.Internal.CoverMode, cv.Var, cv.Var, cv.Var)
+	}
+	fmt.Fprintf(&buf, "}\n")
+	return buf.Bytes()
+}
+
 var objectMagic = [][]byte{
 	{'!', '<', 'a', 'r', 'c', 'h', '>', '\n'}, // Package archive
 	{'<', 'b', 'i', 'g', 'a', 'f', '>', '\n'}, // Package AIX big archive
@@ -109,7 +109,7 @@ func (gcToolchain) gc(b *Builder, a *Action, archive string, importcfg, embedcfg
 		switch p.ImportPath {
 		case "bytes", "internal/poll", "net", "os":
 			fallthrough
-		case "runtime/metrics", "runtime/pprof", "runtime/trace":
+		case "runtime/coverage", "runtime/metrics", "runtime/pprof", "runtime/trace":
 			fallthrough
 		case "sync", "syscall", "time":
 			extFiles++
@@ -133,6 +133,12 @@ func (gcToolchain) gc(b *Builder, a *Action, archive string, importcfg, embedcfg
 	if symabis != "" {
 		gcargs = append(gcargs, "-symabis", symabis)
 	}
+	if p.Internal.FuzzInstrument {
+		gcargs = append(gcargs, "-d=libfuzzer")
+	}
+	if cfg.BuildPGOFile != "" {
+		gcargs = append(gcargs, "-pgoprofile", cfg.BuildPGOFile)
+	}
 
 	gcflags := str.StringList(forcedGcflags, p.Internal.Gcflags)
 	if compilingRuntime {
@@ -39,6 +39,46 @@ func BuildInit() {
 		cfg.BuildPkgdir = p
 	}
 
+	// Make sure -pgo is absolute, because the compiler runs in
+	// different directories.
+	if cfg.BuildPGOFile == "off" {
+		cfg.BuildPGOFile = ""
+	}
+	if cfg.BuildPGOFile != "" {
+		if cfg.BuildToolchainName == "gccgo" {
+			base.Fatalf("go %s: -pgo is not supported by gccgo", flag.Args()[0])
+		}
+		p, err := filepath.Abs(cfg.BuildPGOFile)
+		if err != nil {
+			base.Fatalf("go %s: evaluating -pgo: %v", flag.Args()[0], err)
+		}
+		if _, err := os.Stat(p); err != nil {
+			base.Fatalf("go %s: -pgo: %v", flag.Args()[0], err)
+		}
+		cfg.BuildPGOFile = p
+	}
+
+	// -covermode and -coverpkg imply -cover.
+	if cfg.BuildCoverMode != "" || len(cfg.BuildCoverPkg) > 0 {
+		cfg.BuildCover = true
+	}
+	if cfg.BuildCover {
+		switch cfg.BuildCoverMode {
+		case "":
+			cfg.BuildCoverMode = "set"
+			if cfg.BuildRace {
+				// Default coverage mode is atomic when -race is set.
+				cfg.BuildCoverMode = "atomic"
+			}
+		case "set", "count", "atomic":
+		default:
+			base.Fatalf(`go %s: -covermode: valid modes are "set", "count", or "atomic"`, flag.Args()[0])
+		}
+		if cfg.BuildRace && cfg.BuildCoverMode != "atomic" {
+			base.Fatalf(`go %s: -covermode must be "atomic", not %q, when -race is enabled`, flag.Args()[0], cfg.BuildCoverMode)
+		}
+	}
+
 	// Make sure CC and CXX are absolute paths
 	for _, key := range []string{"CC", "CXX"} {
 		if path := cfg.Getenv(key); !filepath.IsAbs(path) && path != "" && path != filepath.Base(path) {
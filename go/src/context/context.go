@@ -62,6 +62,12 @@
 // Use context Values only for request-scoped data that transits processes and
 // APIs, not for passing optional parameters to functions.
 //
+// The WithCancelCause function returns a CancelCauseFunc, which
+// takes an error and records it as the cancellation cause. Calling
+// Cause on the canceled context or any of its children retrieves
+// the cause. If no cause is specified, Cause(ctx) returns the same
+// value as ctx.Err().
+//
 // The same Context may be passed to functions running in different goroutines;
 // Contexts are safe for simultaneous use by multiple goroutines.
 //
@@ -283,9 +289,126 @@ func WithCancel(parent Context) (ctx Context, cancel CancelFunc) {
 		panic("cannot create context from nil parent")
 	}
 	c := newCancelCtx(parent)
-	propagateCancel(parent, &c) //尝试把c与父节点绑定(写入父节点的hashmap)
+	c.propagateCancel(parent, &c) //尝试把c与父节点绑定(写入父节点的hashmap)
 	// 外部主动调用cancel 那么removeFromParent 就为true 表示从parent 摘除这个ctx
-	return &c, func() { c.cancel(true, Canceled) }
+	return &c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// A CancelCauseFunc behaves like a CancelFunc but additionally sets the cancellation cause.
+// This cause can be retrieved by calling Cause on the canceled Context or on
+// any of its derived Contexts.
+//
+// If the context has already been canceled, CancelCauseFunc does not set the cause.
+// For example, if childContext is derived from parentContext:
+//   - if parentContext is canceled with cause1 before childContext is canceled with cause2,
+//     then Cause(parentContext) == Cause(childContext) == cause1
+//   - if childContext is canceled with cause2 before parentContext is canceled with cause1,
+//     then Cause(parentContext) == cause1 and Cause(childContext) == cause2
+type CancelCauseFunc func(cause error)
+
+// WithCancelCause behaves like WithCancel but returns a CancelCauseFunc instead of a CancelFunc.
+// Calling cancel with a non-nil error (the "cause") records that error in ctx;
+// it can then be retrieved using Cause(ctx).
+// Calling cancel with nil sets the cause to Canceled.
+//
+// Example use:
+//
+// 	ctx, cancel := context.WithCancelCause(parent)
+// 	cancel(myError)
+// 	ctx.Err() // returns context.Canceled
+// 	context.Cause(ctx) // returns myError
+func WithCancelCause(parent Context) (ctx Context, cancel CancelCauseFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := newCancelCtx(parent)
+	c.propagateCancel(parent, &c)
+	return &c, func(cause error) { c.cancel(true, Canceled, cause) }
+}
+
+// Cause returns a non-nil error explaining why c was canceled.
+// The first cancellation of c or one of its parents sets the cause.
+// If that cancellation happened via a call to CancelCauseFunc(err),
+// then Cause returns err.
+// Otherwise Cause(c) returns the same value as c.Err().
+// Cause returns nil if c has not been canceled yet.
+// Cause 沿着父context链找到最近的cancelCtx, 返回其记录的取消原因
+func Cause(c Context) error {
+	if cc, ok := c.Value(&cancelCtxKey).(*cancelCtx); ok {
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+		return cc.cause
+	}
+	// There is no cancelCtxKey value, so we know that c is
+	// not a descendant of some Context created by WithCancelCause.
+	// Therefore, there is no specific cause to return.
+	// If this is not one of the standard Context types,
+	// it might still have an error even though it won't have a cause.
+	return c.Err()
+}
+
+// AfterFunc arranges to call f in its own goroutine after ctx is done
+// (canceled or timed out).
+// If ctx is already done, AfterFunc calls f immediately in its own goroutine.
+//
+// Multiple calls to AfterFunc on a context operate independently;
+// one does not replace another.
+//
+// Calling the returned stop function stops the association of ctx with f.
+// It returns true if the call stopped f from being run.
+// If stop returns false,
+// either the context is done and f has been started in its own goroutine;
+// or f was already stopped.
+// The stop function does not wait for f to complete before returning.
+// If the caller needs to know whether f is completed,
+// it must coordinate with f explicitly.
+//
+// If ctx has a "AfterFunc(func()) func() bool" method,
+// AfterFunc will use it to schedule the call.
+// AfterFunc 不会为每个等待者单独启动goroutine, 而是把自己挂到父节点的children上
+func AfterFunc(ctx Context, f func()) (stop func() bool) {
+	a := &afterFuncCtx{
+		f: f,
+	}
+	a.cancelCtx.propagateCancel(ctx, a)
+	return func() bool {
+		stopped := false
+		a.once.Do(func() {
+			stopped = true
+		})
+		if stopped {
+			a.cancel(true, Canceled, nil)
+		}
+		return stopped
+	}
+}
+
+type afterFuncer interface {
+	AfterFunc(func()) func() bool
+}
+
+type afterFuncCtx struct {
+	cancelCtx
+	once sync.Once // either starts running f or stops f from running
+	f    func()
+}
+
+func (a *afterFuncCtx) cancel(removeFromParent bool, err, cause error) {
+	a.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(a.Context, a)
+	}
+	a.once.Do(func() {
+		go a.f()
+	})
+}
+
+// A stopCtx is used as the parent context of a cancelCtx when
+// an AfterFunc has been registered with the parent.
+// It holds the stop function used to unregister the AfterFunc.
+type stopCtx struct {
+	Context
+	stop func() bool
 }
 
 // newCancelCtx returns an initialized cancelCtx.
@@ -297,8 +420,11 @@ func newCancelCtx(parent Context) cancelCtx {
 var goroutines int32
 
 // propagateCancel arranges for child to be canceled when parent is.
+// It sets the parent context of cancelCtx.
 // 父ctx取消的时候，传递cancel 给它的子ctx
-func propagateCancel(parent Context, child canceler) {
+func (c *cancelCtx) propagateCancel(parent Context, child canceler) {
+	c.Context = parent
+
 	// 如果返回nil，说明当前父`context`从来不会被取消，是一个空节点，直接返回即可
 	done := parent.Done()
 	if done == nil {
@@ -309,7 +435,7 @@ func propagateCancel(parent Context, child canceler) {
 	select {
 	case <-done:
 		// parent is already canceled
-		child.cancel(false, parent.Err())
+		child.cancel(false, parent.Err(), Cause(parent))
 		return
 	default:
 	}
@@ -320,7 +446,7 @@ func propagateCancel(parent Context, child canceler) {
 		// 继续挂靠了，取消即可
 		if p.err != nil {
 			// parent has already been canceled
-			child.cancel(false, p.err)
+			child.cancel(false, p.err, p.cause)
 		} else {
 			if p.children == nil {
 				// 将当前节点挂到父节点的childrn map中，外面调用cancel时可以层层取消
@@ -329,17 +455,33 @@ func propagateCancel(parent Context, child canceler) {
 			p.children[child] = struct{}{}
 		}
 		p.mu.Unlock()
-	} else {
-		// 没有找到 就开一个goroutine
-		atomic.AddInt32(&goroutines, +1)
-		go func() {
-			select { //当父context为不识别的或emptyctx时创建独立goroutine维护生命周期
-			case <-parent.Done():
-				child.cancel(false, parent.Err())
-			case <-child.Done():
-			}
-		}()
+		return
 	}
+
+	if a, ok := parent.(afterFuncer); ok {
+		// parent implements an AfterFunc method.
+		// 父context自己提供了AfterFunc, 直接注册回调, 不需要额外的goroutine
+		c.mu.Lock()
+		stop := a.AfterFunc(func() {
+			child.cancel(false, parent.Err(), Cause(parent))
+		})
+		c.Context = stopCtx{
+			Context: parent,
+			stop:    stop,
+		}
+		c.mu.Unlock()
+		return
+	}
+
+	// 没有找到 就开一个goroutine
+	atomic.AddInt32(&goroutines, +1)
+	go func() {
+		select { //当父context为不识别的或emptyctx时创建独立goroutine维护生命周期
+		case <-parent.Done():
+			child.cancel(false, parent.Err(), Cause(parent))
+		case <-child.Done():
+		}
+	}()
 }
 
 // &cancelCtxKey is the key that a cancelCtx returns itself for.
@@ -369,6 +511,10 @@ func parentCancelCtx(parent Context) (*cancelCtx, bool) {
 
 // removeChild removes a context from its parent.
 func removeChild(parent Context, child canceler) {
+	if s, ok := parent.(stopCtx); ok {
+		s.stop()
+		return
+	}
 	// 查找parent ctx
 	p, ok := parentCancelCtx(parent)
 	if !ok {
@@ -383,9 +529,9 @@ func removeChild(parent Context, child canceler) {
 }
 
 // A canceler is a context type that can be canceled directly. The
-// implementations are *cancelCtx and *timerCtx.
+// implementations are *cancelCtx, *timerCtx and *afterFuncCtx.
 type canceler interface {
-	cancel(removeFromParent bool, err error)
+	cancel(removeFromParent bool, err, cause error)
 	Done() <-chan struct{}
 }
 
@@ -411,6 +557,7 @@ type cancelCtx struct {
 	// 通过这个map寻找所有指向本节点的子节点,并调用他们的cancel方法.
 	children map[canceler]struct{} // set to nil by the first cancel call
 	err      error                 // set to non-nil by the first cancel call 描述context 生命周期结束的原因
+	cause    error                 // set to non-nil by the first cancel call 调用者给出的取消原因
 }
 
 func (c *cancelCtx) Value(key interface{}) interface{} {
@@ -460,16 +607,20 @@ func (c *cancelCtx) String() string {
 
 // cancel closes c.done, cancels each of c's children, and, if
 // removeFromParent is true, removes c from its parent's children.
+// cancel sets c.cause to cause if this is the first time c is canceled.
 // cancel方法 关闭当前channel ， 并且依次关闭它的子ctx
 // 这个cancel 是幂等的
 // cancel() 方法的功能就是关闭 channel：c.done；递归地取消它的所有子节点；
 // 从父节点从删除自己。达到的效果是通过关闭 channel，将取消信号传递给了它的所有子节点。
 // goroutine 接收到取消信号的方式就是 select 语句中的读 c.done 被选中。
-func (c *cancelCtx) cancel(removeFromParent bool, err error) {
+func (c *cancelCtx) cancel(removeFromParent bool, err, cause error) {
 	// 取消时传入的error信息不能为nil, context定义了默认error:var Canceled = errors.New("context canceled")
 	if err == nil {
 		panic("context: internal error: missing cancel error")
 	}
+	if cause == nil {
+		cause = err
+	}
 	c.mu.Lock()
 	// 已经有错误信息了，说明当前节点已经被取消过了
 	if c.err != nil {
@@ -477,6 +628,7 @@ func (c *cancelCtx) cancel(removeFromParent bool, err error) {
 		return // already canceled
 	}
 	c.err = err
+	c.cause = cause
 
 	d, _ := c.done.Load().(chan struct{})
 	if d == nil {
@@ -488,7 +640,7 @@ func (c *cancelCtx) cancel(removeFromParent bool, err error) {
 	// 取消子ctx
 	for child := range c.children {
 		// NOTE: acquiring the child's lock while holding parent's lock.
-		child.cancel(false, err) // 这里是内部调用 这里的removeFromParent = false
+		child.cancel(false, err, cause) // 这里是内部调用 这里的removeFromParent = false
 	}
 	c.children = nil // 手动赋值为nil
 	c.mu.Unlock()
@@ -509,6 +661,13 @@ func (c *cancelCtx) cancel(removeFromParent bool, err error) {
 // Canceling this context releases resources associated with it, so code should
 // call cancel as soon as the operations running in this Context complete.
 func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
+	return WithDeadlineCause(parent, d, nil)
+}
+
+// WithDeadlineCause behaves like WithDeadline but also sets the cause of the
+// returned Context when the deadline is exceeded. The returned CancelFunc does
+// not set the cause.
+func WithDeadlineCause(parent Context, d time.Time, cause error) (Context, CancelFunc) {
 	if parent == nil {
 		panic("cannot create context from nil parent")
 	}
@@ -522,21 +681,21 @@ func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
 		deadline:  d,
 	}
 	// 将当前节点挂到父节点上
-	propagateCancel(parent, c)
+	c.cancelCtx.propagateCancel(parent, c)
 	dur := time.Until(d)
 	if dur <= 0 { // 过期了也主动摘除这个子ctx
-		c.cancel(true, DeadlineExceeded) // deadline has already passed
-		return c, func() { c.cancel(false, Canceled) }
+		c.cancel(true, DeadlineExceeded, cause) // deadline has already passed
+		return c, func() { c.cancel(false, Canceled, nil) }
 	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	// 如果没被取消，则直接添加一个定时器，定时去取消
 	if c.err == nil {
 		c.timer = time.AfterFunc(dur, func() {
-			c.cancel(true, DeadlineExceeded)
+			c.cancel(true, DeadlineExceeded, cause)
 		})
 	}
-	return c, func() { c.cancel(true, Canceled) }
+	return c, func() { c.cancel(true, Canceled, nil) }
 }
 
 // A timerCtx carries a timer and a deadline. It embeds a cancelCtx to
@@ -559,9 +718,9 @@ func (c *timerCtx) String() string {
 		time.Until(c.deadline).String() + "])"
 }
 
-func (c *timerCtx) cancel(removeFromParent bool, err error) {
+func (c *timerCtx) cancel(removeFromParent bool, err, cause error) {
 	// 调用cancelCtx的cancel方法取消掉子节点context
-	c.cancelCtx.cancel(false, err)
+	c.cancelCtx.cancel(false, err, cause)
 	if removeFromParent {
 		// Remove this timerCtx from its parent cancelCtx's children.
 		removeChild(c.cancelCtx.Context, c)
@@ -589,6 +748,13 @@ func WithTimeout(parent Context, timeout time.Duration) (Context, CancelFunc) {
 	return WithDeadline(parent, time.Now().Add(timeout))
 }
 
+// WithTimeoutCause behaves like WithTimeout but also sets the cause of the
+// returned Context when the timeout expires. The returned CancelFunc does
+// not set the cause.
+func WithTimeoutCause(parent Context, timeout time.Duration, cause error) (Context, CancelFunc) {
+	return WithDeadlineCause(parent, time.Now().Add(timeout), cause)
+}
+
 // WithValue returns a copy of parent in which the value associated with key is
 // val.
 //
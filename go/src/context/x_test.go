@@ -29,3 +29,12 @@ func TestWithValueChecksKey(t *testing.T)              { XTestWithValueChecksKey
 func TestInvalidDerivedFail(t *testing.T)              { XTestInvalidDerivedFail(t) }
 func TestDeadlineExceededSupportsTimeout(t *testing.T) { XTestDeadlineExceededSupportsTimeout(t) }
 func TestCustomContextGoroutines(t *testing.T)         { XTestCustomContextGoroutines(t) }
+func TestCause(t *testing.T)                           { XTestCause(t) }
+func TestCauseRace(t *testing.T)                       { XTestCauseRace(t) }
+func TestCustomContextPropagation(t *testing.T)        { XTestCustomContextPropagation(t) }
+func TestAfterFuncCalledAfterCancel(t *testing.T)      { XTestAfterFuncCalledAfterCancel(t) }
+func TestAfterFuncCalledAfterTimeout(t *testing.T)     { XTestAfterFuncCalledAfterTimeout(t) }
+func TestAfterFuncCalledImmediately(t *testing.T)      { XTestAfterFuncCalledImmediately(t) }
+func TestAfterFuncNotCalledAfterStop(t *testing.T)     { XTestAfterFuncNotCalledAfterStop(t) }
+func TestAfterFuncCalledAsynchronously(t *testing.T)   { XTestAfterFuncCalledAsynchronously(t) }
+func TestAfterFuncNoGoroutine(t *testing.T)            { XTestAfterFuncNoGoroutine(t) }
@@ -0,0 +1,295 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ecdh_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+// Check that PublicKey and PrivateKey implement the interfaces documented in
+// crypto.PublicKey and crypto.PrivateKey.
+var _ interface {
+	Equal(x crypto.PublicKey) bool
+} = &ecdh.PublicKey{}
+var _ interface {
+	Public() crypto.PublicKey
+	Equal(x crypto.PrivateKey) bool
+} = &ecdh.PrivateKey{}
+
+var curves = []struct {
+	name  string
+	curve ecdh.Curve
+}{
+	{"P256", ecdh.P256()},
+	{"P384", ecdh.P384()},
+	{"P521", ecdh.P521()},
+	{"X25519", ecdh.X25519()},
+}
+
+func TestECDH(t *testing.T) {
+	for _, tt := range curves {
+		t.Run(tt.name, func(t *testing.T) {
+			curve := tt.curve
+			aliceKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bobKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			alicePubKey, err := curve.NewPublicKey(aliceKey.PublicKey().Bytes())
+			if err != nil {
+				t.Error(err)
+			}
+			if !alicePubKey.Equal(aliceKey.PublicKey()) {
+				t.Error("encoded and decoded public keys are different")
+			}
+			if !alicePubKey.Equal(aliceKey.Public()) {
+				t.Error("encoded and decoded public keys are different")
+			}
+
+			alicePrivKey, err := curve.NewPrivateKey(aliceKey.Bytes())
+			if err != nil {
+				t.Error(err)
+			}
+			if !alicePrivKey.Equal(aliceKey) {
+				t.Error("encoded and decoded private keys are different")
+			}
+
+			bobSecret, err := bobKey.ECDH(aliceKey.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			aliceSecret, err := aliceKey.ECDH(bobKey.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(bobSecret, aliceSecret) {
+				t.Error("two ECDH computations came out different")
+			}
+		})
+	}
+}
+
+type vector struct {
+	priv, pub, peer, shared string
+}
+
+var vectors = map[string]vector{
+	"P256": {
+		priv:   "934c6a04ca96d05c889915088bd99138e7cf28312ce891ca8e9662748ba3afa4",
+		pub:    "0433e883805502b91bc25f4d6b89cfa20a78b95ce93605659f7f0e488bf5647ac4e02d4c0a6f9d435a01ce930ecc91a9a1a9bb0919635e8e89e0fb2ec1b5415955",
+		peer:   "0465b388f0621d57196c4b810674f90e397072357bd2f8f2d4d87ae5e25cd8096248a2cbd8d4d09b58217da34885e3e6b71c93745fa8898f77ee8d85da55ddd8b8",
+		shared: "51a7b34f13ee08c96958407f68c168d06672d891c791156408121201cd4b22ec",
+	},
+	"P384": {
+		priv:   "be80632821378f719813db9ab7cdd753737b3ef9ca803bd4ecabb1026c12ef98bb3c1f52affe7d8ae7026e96f7795c79",
+		pub:    "04ccf74598a03aeae7cdb1e4ad737bf0618722a9ee09a31b9b401029e738517ee68b1a64365d23319b3ac508f7b10fa9a2b2a8d8e9b34b88ce7e062fd2113ee91a1fa4e901b3865fc21086d13e0bfa0731610bbc18d381cf8600118c2ceeb38ff2",
+		peer:   "04c85375ee5bb743bc65676517228e712fa3659ada57c64619eb65fb1bb89428920d196c3183388c2cfbf361ab9db96ba2a54bf8da8b38170dbf6be3cfdf8c9e53be48c9583fae70e46b402a8567591f88f7622e4bf6920c0f5cda72a58ce6d0f3",
+		shared: "a27dbad07b4ca1ac6332b9caded64d7c0c40904adec9b2b8a83aa6ab9f911eed2fea5b2cad3b9d95f39ae3ed4bdcfd7b",
+	},
+	"P521": {
+		priv:   "005f9a8a98ef2071b39ac67774c503866f5e6462b6f95871fea7457cc2d422868babd590e10b283fda9b6d8b5eb501db61d866d38a02bd9ae69b5da03b4454f224dd",
+		pub:    "04008f03b958f8a1ad24aa8af998d927fd4420bb820781f80057d582678e388c890eac352da7e71156717c6364623e77ee4c3ee24b196e11106a291e1438eaaac705990145b16d4bde07043e8f4a8bf963f3384c153d086f6fe307d3ee84fcfb5069c3824fde26c4896aa55227b8e6805e59aa48d82b1d8d334e2065b37a71e0af9d375a55",
+		peer:   "0400dd99e7269f5a82b1b0234d8a3c1427bfa98f5164a4892fd5e257954da27a6f6ae5864fce4e0c27c79b9ece1c2afcf8ddf207e7e54f27ba9e5e10c69940ae52800e0188dd9f0650f10756d9dc36dbd7566c52233326ee3df91255c07173b51b45107635bd98ee890b1ba0ebf72bb363ba0807d0802e029321541e56c6b1fe139c800162",
+		shared: "01a046a46f692260ff0fe739ecbb2d6ed65acb8fcd9ad17a6bc65d582cfd1262a46c4240cdc29bda4045964f969a7b6f944484148e07f2003ee9b662b3424eb528db",
+	},
+	// X25519 test vector from RFC 7748, Section 6.1.
+	"X25519": {
+		priv:   "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a",
+		pub:    "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a",
+		peer:   "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f",
+		shared: "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for _, tt := range curves {
+		t.Run(tt.name, func(t *testing.T) {
+			v := vectors[tt.name]
+			key, err := tt.curve.NewPrivateKey(hexDecode(t, v.priv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := key.PublicKey().Bytes(); !bytes.Equal(got, hexDecode(t, v.pub)) {
+				t.Errorf("public key: got %x, want %s", got, v.pub)
+			}
+			peer, err := tt.curve.NewPublicKey(hexDecode(t, v.peer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			secret, err := key.ECDH(peer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(secret, hexDecode(t, v.shared)) {
+				t.Errorf("shared secret: got %x, want %s", secret, v.shared)
+			}
+		})
+	}
+}
+
+func hexDecode(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal("invalid hex string:", s)
+	}
+	return b
+}
+
+func TestX25519Failure(t *testing.T) {
+	identity := hexDecode(t, "0000000000000000000000000000000000000000000000000000000000000000")
+	lowOrderPoint := hexDecode(t, "e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800")
+	randomScalar := make([]byte, 32)
+	rand.Read(randomScalar)
+
+	for _, point := range [][]byte{identity, lowOrderPoint} {
+		k, err := ecdh.X25519().NewPrivateKey(randomScalar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := ecdh.X25519().NewPublicKey(point)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := k.ECDH(p); err == nil {
+			t.Errorf("ECDH with low order point %x succeeded, want error", point)
+		}
+	}
+}
+
+var invalidPrivateKeys = map[string][]string{
+	"P256": {
+		// Bad lengths.
+		"",
+		"01",
+		"01010101010101010101010101010101010101010101010101010101010101",
+		"000101010101010101010101010101010101010101010101010101010101010101",
+		// Zero.
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		// Order of the curve and above.
+		"ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551",
+		"ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632552",
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	},
+	"P384": {
+		"",
+		"01",
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"ffffffffffffffffffffffffffffffffffffffffffffffffc7634d81f4372ddf581a0db248b0a77aecec196accc52973",
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	},
+	"P521": {
+		"",
+		"01",
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"01fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffa51868783bf2f966b7fcc0148f709a5d03bb5c9b8899c47aebb6fb71e91386409",
+		"03ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	},
+	"X25519": {
+		"",
+		"01",
+		"01010101010101010101010101010101010101010101010101010101010101",
+		"000101010101010101010101010101010101010101010101010101010101010101",
+	},
+}
+
+func TestNewPrivateKey(t *testing.T) {
+	for _, tt := range curves {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, input := range invalidPrivateKeys[tt.name] {
+				k, err := tt.curve.NewPrivateKey(hexDecode(t, input))
+				if err == nil {
+					t.Errorf("unexpectedly accepted %q", input)
+				} else if k != nil {
+					t.Error("PrivateKey was not nil on error")
+				}
+			}
+		})
+	}
+}
+
+func TestNewPublicKey(t *testing.T) {
+	invalid := map[string][]string{
+		"P256": {
+			"",
+			"00",
+			"01",
+			"04",
+			// Point at infinity.
+			"0400000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+			// Compressed encoding of the generator.
+			"036b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296",
+			// Not on the curve.
+			"046b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c2964fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f6",
+		},
+		"X25519": {
+			"",
+			"01",
+			"0101010101010101010101010101010101010101010101010101010101010101010101",
+		},
+	}
+	for _, tt := range curves {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, input := range invalid[tt.name] {
+				k, err := tt.curve.NewPublicKey(hexDecode(t, input))
+				if err == nil {
+					t.Errorf("unexpectedly accepted %q", input)
+				} else if k != nil {
+					t.Error("PublicKey was not nil on error")
+				}
+			}
+		})
+	}
+}
+
+func TestMismatchedCurves(t *testing.T) {
+	a, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ecdh.P384().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ECDH(b.PublicKey()); err == nil {
+		t.Error("ECDH across curves succeeded, want error")
+	}
+}
+
+func TestECDSAConversion(t *testing.T) {
+	for _, c := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		t.Run(c.Params().Name, func(t *testing.T) {
+			priv, err := ecdsa.GenerateKey(c, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k, err := priv.ECDH()
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := priv.PublicKey.ECDH()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !k.PublicKey().Equal(p) {
+				t.Error("converted private and public keys do not match")
+			}
+			if got, want := p.Bytes(), elliptic.Marshal(c, priv.X, priv.Y); !bytes.Equal(got, want) {
+				t.Errorf("public key encoding: got %x, want %x", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ecdh
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"io"
+)
+
+// nistCurve implements Curve on top of the constant-time crypto/elliptic
+// implementations of the NIST curves.
+type nistCurve struct {
+	name  string
+	curve func() elliptic.Curve
+}
+
+func (c *nistCurve) String() string {
+	return c.name
+}
+
+var errInvalidPrivateKey = errors.New("crypto/ecdh: invalid private key")
+
+func (c *nistCurve) GenerateKey(rand io.Reader) (*PrivateKey, error) {
+	curve := c.curve()
+	for {
+		key, x, y, err := elliptic.GenerateKey(curve, rand)
+		if err != nil {
+			return nil, err
+		}
+		// elliptic.GenerateKey never returns a scalar larger than the order,
+		// but it might, with negligible probability, return zero.
+		if isZero(key) {
+			continue
+		}
+		return &PrivateKey{
+			curve:      c,
+			privateKey: key,
+			publicKey: &PublicKey{
+				curve:     c,
+				publicKey: elliptic.Marshal(curve, x, y),
+			},
+		}, nil
+	}
+}
+
+func (c *nistCurve) NewPrivateKey(key []byte) (*PrivateKey, error) {
+	curve := c.curve()
+	if len(key) != scalarSize(curve) {
+		return nil, errInvalidPrivateKey
+	}
+	if isZero(key) || !isLess(key, curve.Params().N.Bytes()) {
+		return nil, errInvalidPrivateKey
+	}
+	x, y := curve.ScalarBaseMult(key)
+	return &PrivateKey{
+		curve:      c,
+		privateKey: append([]byte{}, key...),
+		publicKey: &PublicKey{
+			curve:     c,
+			publicKey: elliptic.Marshal(curve, x, y),
+		},
+	}, nil
+}
+
+func (c *nistCurve) NewPublicKey(key []byte) (*PublicKey, error) {
+	// Reject the point at infinity and compressed encodings.
+	if len(key) == 0 || key[0] != 4 {
+		return nil, errors.New("crypto/ecdh: invalid public key")
+	}
+	if x, _ := elliptic.Unmarshal(c.curve(), key); x == nil {
+		return nil, errors.New("crypto/ecdh: invalid public key")
+	}
+	return &PublicKey{
+		curve:     c,
+		publicKey: append([]byte{}, key...),
+	}, nil
+}
+
+func (c *nistCurve) ecdh(local *PrivateKey, remote *PublicKey) ([]byte, error) {
+	// NewPublicKey rejects invalid points and the point at infinity, and
+	// NewPrivateKey rejects invalid scalars and the zero value. Since all NIST
+	// curves have a prime order, the product of a valid point and a valid
+	// scalar is never the point at infinity, so the errors below are
+	// unreachable in practice.
+	curve := c.curve()
+	x, y := elliptic.Unmarshal(curve, remote.publicKey)
+	if x == nil {
+		return nil, errors.New("crypto/ecdh: invalid public key")
+	}
+	x, y = curve.ScalarMult(x, y, local.privateKey)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, errors.New("crypto/ecdh: ECDH result is the point at infinity")
+	}
+	return x.FillBytes(make([]byte, fieldSize(curve))), nil
+}
+
+// scalarSize returns the length of a fixed size big endian encoding of a
+// scalar, which is the size in bytes of the order of curve.
+func scalarSize(curve elliptic.Curve) int {
+	return (curve.Params().N.BitLen() + 7) / 8
+}
+
+// fieldSize returns the length of a fixed size big endian encoding of a
+// field element of curve.
+func fieldSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// isLess returns whether a < b, where a and b are big-endian buffers and b
+// is no longer than a. It runs in time that only depends on the length of a.
+func isLess(a, b []byte) bool {
+	// Pad b to the length of a. b is a public value (the curve order).
+	bb := make([]byte, len(a))
+	copy(bb[len(a)-len(b):], b)
+
+	// Compute a - b over the whole buffer, and return the final borrow.
+	var borrow uint
+	for i := len(a) - 1; i >= 0; i-- {
+		diff := uint(a[i]) - uint(bb[i]) - borrow
+		borrow = (diff >> 8) & 1
+	}
+	return borrow == 1
+}
+
+// P256 returns a Curve which implements NIST P-256 (FIPS 186-3, section D.2.3),
+// also known as secp256r1 or prime256v1.
+//
+// Multiple invocations of this function will return the same value, which can
+// be used for equality checks and switch statements.
+func P256() Curve { return p256 }
+
+var p256 = &nistCurve{name: "P-256", curve: elliptic.P256}
+
+// P384 returns a Curve which implements NIST P-384 (FIPS 186-3, section D.2.4),
+// also known as secp384r1.
+//
+// Multiple invocations of this function will return the same value, which can
+// be used for equality checks and switch statements.
+func P384() Curve { return p384 }
+
+var p384 = &nistCurve{name: "P-384", curve: elliptic.P384}
+
+// P521 returns a Curve which implements NIST P-521 (FIPS 186-3, section D.2.5),
+// also known as secp521r1.
+//
+// Multiple invocations of this function will return the same value, which can
+// be used for equality checks and switch statements.
+func P521() Curve { return p521 }
+
+var p521 = &nistCurve{name: "P-521", curve: elliptic.P521}
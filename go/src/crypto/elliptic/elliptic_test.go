@@ -16,7 +16,7 @@ import (
 // the specified curve. This is used to avoid the logic for
 // upgrading a curve to it's specific implementation, forcing
 // usage of the generic implementation. This is only relevant
-// for the P224, P256, and P521 curves.
+// for the P224, P256, P384, and P521 curves.
 func genericParamsForCurve(c Curve) *CurveParams {
 	d := *(c.Params())
 	return &d
@@ -0,0 +1,53 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fiat_test
+
+import (
+	"crypto/elliptic/internal/fiat"
+	"crypto/rand"
+	"testing"
+)
+
+func p384Random(t *testing.T) *fiat.P384Element {
+	buf := make([]byte, 48)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	buf[47] &= 0x7f
+	e, err := new(fiat.P384Element).SetBytes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestP384Invert(t *testing.T) {
+	a := p384Random(t)
+	inv := new(fiat.P384Element).Invert(a)
+	one := new(fiat.P384Element).Mul(a, inv)
+	if new(fiat.P384Element).One().Equal(one) != 1 {
+		t.Errorf("a * 1/a != 1; got %x for %x", one.Bytes(), a.Bytes())
+	}
+	inv.Invert(new(fiat.P384Element))
+	if new(fiat.P384Element).Equal(inv) != 1 {
+		t.Errorf("1/0 != 0; got %x", inv.Bytes())
+	}
+}
+
+func TestP384SetBytes(t *testing.T) {
+	// p - 1 is the largest canonical encoding, p itself must be rejected.
+	minusOne := new(fiat.P384Element).Sub(new(fiat.P384Element), new(fiat.P384Element).One())
+	b := minusOne.Bytes()
+	if _, err := new(fiat.P384Element).SetBytes(b); err != nil {
+		t.Errorf("SetBytes(p - 1) = %v", err)
+	}
+	b[0]++
+	if _, err := new(fiat.P384Element).SetBytes(b); err == nil {
+		t.Errorf("SetBytes(p) succeeded, want error")
+	}
+	if _, err := new(fiat.P384Element).SetBytes(b[:47]); err == nil {
+		t.Errorf("SetBytes with short input succeeded, want error")
+	}
+}
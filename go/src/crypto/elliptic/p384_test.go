@@ -0,0 +1,48 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elliptic
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+// TestP384MatchesGeneric checks the fiat-based P-384 implementation against
+// the generic CurveParams one for random scalars.
+func TestP384MatchesGeneric(t *testing.T) {
+	p384 := P384()
+	generic := genericParamsForCurve(p384)
+
+	iterations := 20
+	if testing.Short() {
+		iterations = 2
+	}
+	var k1, k2 [48]byte
+	for i := 0; i < iterations; i++ {
+		rand.Read(k1[:])
+		rand.Read(k2[:])
+
+		x, y := p384.ScalarBaseMult(k1[:])
+		x2, y2 := generic.ScalarBaseMult(k1[:])
+		if x.Cmp(x2) != 0 || y.Cmp(y2) != 0 {
+			t.Fatalf("ScalarBaseMult(%x) does not match generic result", k1)
+		}
+
+		xx, yy := p384.ScalarMult(x, y, k2[:])
+		xx2, yy2 := generic.ScalarMult(x2, y2, k2[:])
+		if xx.Cmp(xx2) != 0 || yy.Cmp(yy2) != 0 {
+			t.Fatalf("ScalarMult(%x) does not match generic result", k2)
+		}
+
+		sx, sy := p384.Add(x, y, xx, yy)
+		sx2, sy2 := generic.Add(x2, y2, xx2, yy2)
+		if sx.Cmp(sx2) != 0 || sy.Cmp(sy2) != 0 {
+			t.Fatalf("Add does not match generic result")
+		}
+		if !p384.IsOnCurve(sx, sy) {
+			t.Fatalf("Add result is not on the curve")
+		}
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hpke implements Hybrid Public Key Encryption (HPKE), as defined in
+// RFC 9180.
+//
+// The base and PSK modes are supported, with the DHKEM(X25519, HKDF-SHA256)
+// and DHKEM(P-256, HKDF-SHA256) KEMs, the HKDF-SHA256, HKDF-SHA384 and
+// HKDF-SHA512 KDFs, and the AES-128-GCM, AES-256-GCM, ChaCha20Poly1305 and
+// export-only AEADs.
+//
+// A ciphersuite is selected by the identifiers of its KEM, KDF and AEAD, as
+// registered in the IANA HPKE registry. The sender sets up a context with
+// SetupSender or SetupSenderPSK, and sends the returned encapsulated key to
+// the recipient, which sets up the matching context with SetupRecipient or
+// SetupRecipientPSK. Messages must be opened in the order they were sealed.
+package hpke
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// KEM identifiers, from RFC 9180, Section 7.1.
+const (
+	DHKEMP256HKDFSHA256   = 0x0010
+	DHKEMX25519HKDFSHA256 = 0x0020
+)
+
+// KDF identifiers, from RFC 9180, Section 7.2.
+const (
+	KDFHKDFSHA256 = 0x0001
+	KDFHKDFSHA384 = 0x0002
+	KDFHKDFSHA512 = 0x0003
+)
+
+// AEAD identifiers, from RFC 9180, Section 7.3.
+//
+// A context set up with AEADExportOnly can only be used to export secrets,
+// and its Seal and Open methods always return an error.
+const (
+	AEADAES128GCM        = 0x0001
+	AEADAES256GCM        = 0x0002
+	AEADChaCha20Poly1305 = 0x0003
+	AEADExportOnly       = 0xffff
+)
+
+// HPKE modes, from RFC 9180, Section 5.
+const (
+	modeBase = 0x00
+	modePSK  = 0x01
+)
+
+// testingOnlyGenerateKey is only used during testing, to provide
+// a fixed test key to use when checking the RFC 9180 vectors.
+var testingOnlyGenerateKey func() (*ecdh.PrivateKey, error)
+
+type hkdfKDF struct {
+	hash crypto.Hash
+}
+
+func (kdf *hkdfKDF) LabeledExtract(suiteID []byte, salt []byte, label string, inputKey []byte) []byte {
+	labeledIKM := make([]byte, 0, 7+len(suiteID)+len(label)+len(inputKey))
+	labeledIKM = append(labeledIKM, "HPKE-v1"...)
+	labeledIKM = append(labeledIKM, suiteID...)
+	labeledIKM = append(labeledIKM, label...)
+	labeledIKM = append(labeledIKM, inputKey...)
+	return hkdf.Extract(kdf.hash.New, labeledIKM, salt)
+}
+
+func (kdf *hkdfKDF) LabeledExpand(suiteID []byte, randomKey []byte, label string, info []byte, length uint16) []byte {
+	labeledInfo := make([]byte, 2, 2+7+len(suiteID)+len(label)+len(info))
+	binary.BigEndian.PutUint16(labeledInfo, length)
+	labeledInfo = append(labeledInfo, "HPKE-v1"...)
+	labeledInfo = append(labeledInfo, suiteID...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+	out := make([]byte, length)
+	n, err := hkdf.Expand(kdf.hash.New, randomKey, labeledInfo).Read(out)
+	if err != nil || n != int(length) {
+		panic("hpke: LabeledExpand failed unexpectedly")
+	}
+	return out
+}
+
+// dhKEM implements the KEM specified in RFC 9180, Section 4.1.
+type dhKEM struct {
+	dh  ecdh.Curve
+	kdf hkdfKDF
+
+	suiteID []byte
+	nSecret uint16
+}
+
+var supportedKEMs = map[uint16]struct {
+	curve   ecdh.Curve
+	hash    crypto.Hash
+	nSecret uint16
+}{
+	// RFC 9180 Section 7.1
+	DHKEMP256HKDFSHA256:   {ecdh.P256(), crypto.SHA256, 32},
+	DHKEMX25519HKDFSHA256: {ecdh.X25519(), crypto.SHA256, 32},
+}
+
+func newDHKem(kemID uint16) (*dhKEM, error) {
+	suite, ok := supportedKEMs[kemID]
+	if !ok {
+		return nil, errors.New("hpke: unsupported KEM id")
+	}
+	suiteID := make([]byte, 5)
+	copy(suiteID, "KEM")
+	binary.BigEndian.PutUint16(suiteID[3:], kemID)
+	return &dhKEM{
+		dh:      suite.curve,
+		kdf:     hkdfKDF{suite.hash},
+		suiteID: suiteID,
+		nSecret: suite.nSecret,
+	}, nil
+}
+
+func (dh *dhKEM) ExtractAndExpand(dhKey, kemContext []byte) []byte {
+	eaePRK := dh.kdf.LabeledExtract(dh.suiteID, nil, "eae_prk", dhKey)
+	return dh.kdf.LabeledExpand(dh.suiteID, eaePRK, "shared_secret", kemContext, dh.nSecret)
+}
+
+func (dh *dhKEM) Encap(pubRecipient *ecdh.PublicKey) (sharedSecret []byte, encapPub []byte, err error) {
+	if pubRecipient.Curve() != dh.dh {
+		return nil, nil, errors.New("hpke: public key does not match the KEM")
+	}
+	var privEph *ecdh.PrivateKey
+	if testingOnlyGenerateKey != nil {
+		privEph, err = testingOnlyGenerateKey()
+	} else {
+		privEph, err = dh.dh.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	dhVal, err := privEph.ECDH(pubRecipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	encPubEph := privEph.PublicKey().Bytes()
+
+	encPubRecip := pubRecipient.Bytes()
+	kemContext := append(encPubEph[:len(encPubEph):len(encPubEph)], encPubRecip...)
+
+	return dh.ExtractAndExpand(dhVal, kemContext), encPubEph, nil
+}
+
+func (dh *dhKEM) Decap(encPubEph []byte, secRecipient *ecdh.PrivateKey) ([]byte, error) {
+	if secRecipient.Curve() != dh.dh {
+		return nil, errors.New("hpke: private key does not match the KEM")
+	}
+	pubEph, err := dh.dh.NewPublicKey(encPubEph)
+	if err != nil {
+		return nil, errors.New("hpke: invalid encapsulated key")
+	}
+	dhVal, err := secRecipient.ECDH(pubEph)
+	if err != nil {
+		return nil, err
+	}
+	kemContext := make([]byte, 0, len(encPubEph)+len(secRecipient.PublicKey().Bytes()))
+	kemContext = append(kemContext, encPubEph...)
+	kemContext = append(kemContext, secRecipient.PublicKey().Bytes()...)
+
+	return dh.ExtractAndExpand(dhVal, kemContext), nil
+}
+
+type context struct {
+	kdf  *hkdfKDF
+	aead cipher.AEAD // nil for AEADExportOnly
+
+	sharedSecret []byte
+
+	suiteID []byte
+
+	key            []byte
+	baseNonce      []byte
+	exporterSecret []byte
+
+	seqNum uint64
+}
+
+// Sender is the sending side of an HPKE context. Each call to Seal uses the
+// next nonce in sequence.
+type Sender struct {
+	*context
+}
+
+// Recipient is the receiving side of an HPKE context. Each successful call to
+// Open uses the next nonce in sequence.
+type Recipient struct {
+	*context
+}
+
+var aesGCMNew = func(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var supportedAEADs = map[uint16]struct {
+	keySize   int
+	nonceSize int
+	aead      func([]byte) (cipher.AEAD, error)
+}{
+	// RFC 9180, Section 7.3
+	AEADAES128GCM:        {keySize: 16, nonceSize: 12, aead: aesGCMNew},
+	AEADAES256GCM:        {keySize: 32, nonceSize: 12, aead: aesGCMNew},
+	AEADChaCha20Poly1305: {keySize: chacha20poly1305.KeySize, nonceSize: chacha20poly1305.NonceSize, aead: chacha20poly1305.New},
+	AEADExportOnly:       {},
+}
+
+var supportedKDFs = map[uint16]crypto.Hash{
+	// RFC 9180, Section 7.2
+	KDFHKDFSHA256: crypto.SHA256,
+	KDFHKDFSHA384: crypto.SHA384,
+	KDFHKDFSHA512: crypto.SHA512,
+}
+
+// SuiteSupported reports whether the ciphersuite made of the KEM, KDF and AEAD
+// with the given identifiers is supported by this package.
+func SuiteSupported(kemID, kdfID, aeadID uint16) bool {
+	_, kemOK := supportedKEMs[kemID]
+	_, kdfOK := supportedKDFs[kdfID]
+	_, aeadOK := supportedAEADs[aeadID]
+	return kemOK && kdfOK && aeadOK
+}
+
+// newContext implements the KeySchedule function of RFC 9180, Section 5.1.
+func newContext(sharedSecret []byte, kemID, kdfID, aeadID uint16, mode uint8, info, psk, pskID []byte) (*context, error) {
+	sid := suiteID(kemID, kdfID, aeadID)
+
+	hash, ok := supportedKDFs[kdfID]
+	if !ok {
+		return nil, errors.New("hpke: unsupported KDF id")
+	}
+	kdf := &hkdfKDF{hash}
+
+	aeadInfo, ok := supportedAEADs[aeadID]
+	if !ok {
+		return nil, errors.New("hpke: unsupported AEAD id")
+	}
+
+	// VerifyPSKInputs, RFC 9180, Section 5.1.
+	switch mode {
+	case modeBase:
+		if len(psk) != 0 || len(pskID) != 0 {
+			return nil, errors.New("hpke: unexpected PSK input in base mode")
+		}
+	case modePSK:
+		if len(psk) == 0 || len(pskID) == 0 {
+			return nil, errors.New("hpke: missing PSK or PSK ID")
+		}
+	}
+
+	pskIDHash := kdf.LabeledExtract(sid, nil, "psk_id_hash", pskID)
+	infoHash := kdf.LabeledExtract(sid, nil, "info_hash", info)
+	ksContext := append([]byte{mode}, pskIDHash...)
+	ksContext = append(ksContext, infoHash...)
+
+	secret := kdf.LabeledExtract(sid, sharedSecret, "secret", psk)
+
+	exporterSecret := kdf.LabeledExpand(sid, secret, "exp", ksContext, uint16(kdf.hash.Size()))
+
+	ctx := &context{
+		kdf:            kdf,
+		sharedSecret:   sharedSecret,
+		suiteID:        sid,
+		exporterSecret: exporterSecret,
+	}
+	if aeadInfo.aead == nil {
+		return ctx, nil
+	}
+
+	ctx.key = kdf.LabeledExpand(sid, secret, "key", ksContext, uint16(aeadInfo.keySize))
+	ctx.baseNonce = kdf.LabeledExpand(sid, secret, "base_nonce", ksContext, uint16(aeadInfo.nonceSize))
+	aead, err := aeadInfo.aead(ctx.key)
+	if err != nil {
+		return nil, err
+	}
+	ctx.aead = aead
+	return ctx, nil
+}
+
+func setupSender(kemID, kdfID, aeadID uint16, pub *ecdh.PublicKey, mode uint8, info, psk, pskID []byte) ([]byte, *Sender, error) {
+	kem, err := newDHKem(kemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedSecret, encapsulatedKey, err := kem.Encap(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	context, err := newContext(sharedSecret, kemID, kdfID, aeadID, mode, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encapsulatedKey, &Sender{context}, nil
+}
+
+func setupRecipient(kemID, kdfID, aeadID uint16, priv *ecdh.PrivateKey, mode uint8, info, encPubEph, psk, pskID []byte) (*Recipient, error) {
+	kem, err := newDHKem(kemID)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := kem.Decap(encPubEph, priv)
+	if err != nil {
+		return nil, err
+	}
+
+	context, err := newContext(sharedSecret, kemID, kdfID, aeadID, mode, info, psk, pskID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recipient{context}, nil
+}
+
+// SetupSender sets up a base mode HPKE context for sending to the holder of
+// the private key corresponding to pub. It returns the encapsulated key,
+// which must be sent to the recipient, and the sending context.
+func SetupSender(kemID, kdfID, aeadID uint16, pub *ecdh.PublicKey, info []byte) ([]byte, *Sender, error) {
+	return setupSender(kemID, kdfID, aeadID, pub, modeBase, info, nil, nil)
+}
+
+// SetupSenderPSK is like SetupSender, but sets up a PSK mode context, which
+// additionally authenticates the sender as a holder of the pre-shared key psk,
+// identified by pskID. Both psk and pskID must be non-empty.
+func SetupSenderPSK(kemID, kdfID, aeadID uint16, pub *ecdh.PublicKey, info, psk, pskID []byte) ([]byte, *Sender, error) {
+	return setupSender(kemID, kdfID, aeadID, pub, modePSK, info, psk, pskID)
+}
+
+// SetupRecipient sets up a base mode HPKE context for receiving messages
+// sent with the encapsulated key encPubEph to the holder of priv.
+func SetupRecipient(kemID, kdfID, aeadID uint16, priv *ecdh.PrivateKey, info, encPubEph []byte) (*Recipient, error) {
+	return setupRecipient(kemID, kdfID, aeadID, priv, modeBase, info, encPubEph, nil, nil)
+}
+
+// SetupRecipientPSK is like SetupRecipient, but sets up a PSK mode context for
+// a sender that used SetupSenderPSK with the same psk and pskID.
+func SetupRecipientPSK(kemID, kdfID, aeadID uint16, priv *ecdh.PrivateKey, info, encPubEph, psk, pskID []byte) (*Recipient, error) {
+	return setupRecipient(kemID, kdfID, aeadID, priv, modePSK, info, encPubEph, psk, pskID)
+}
+
+var errExportOnly = errors.New("hpke: context is export-only")
+
+func (ctx *context) nextNonce() ([]byte, error) {
+	// The sequence number is 64 bits, which is smaller than the nonce, so it
+	// is enough to check that it never wraps around.
+	if ctx.seqNum == 1<<64-1 {
+		return nil, errors.New("hpke: message limit reached")
+	}
+	nonce := make([]byte, len(ctx.baseNonce))
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], ctx.seqNum)
+	for i := range ctx.baseNonce {
+		nonce[i] ^= ctx.baseNonce[i]
+	}
+	return nonce, nil
+}
+
+// export implements the secret export interface of RFC 9180, Section 5.3.
+func (ctx *context) export(exporterContext []byte, length int) ([]byte, error) {
+	if length < 0 || length > 255*ctx.kdf.hash.Size() {
+		return nil, errors.New("hpke: invalid export length")
+	}
+	return ctx.kdf.LabeledExpand(ctx.suiteID, ctx.exporterSecret, "sec", exporterContext, uint16(length)), nil
+}
+
+// Seal encrypts and authenticates plaintext, authenticates aad, and returns
+// the ciphertext.
+func (s *Sender) Seal(aad, plaintext []byte) ([]byte, error) {
+	if s.aead == nil {
+		return nil, errExportOnly
+	}
+	nonce, err := s.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := s.aead.Seal(nil, nonce, plaintext, aad)
+	s.seqNum++
+	return ciphertext, nil
+}
+
+// Export derives a secret of length bytes from the context, bound to
+// exporterContext. The recipient derives the same secret with
+// Recipient.Export. length must be at most 255 times the KDF output size.
+func (s *Sender) Export(exporterContext []byte, length int) ([]byte, error) {
+	return s.export(exporterContext, length)
+}
+
+// Open decrypts and authenticates ciphertext, authenticates aad, and returns
+// the plaintext.
+func (r *Recipient) Open(aad, ciphertext []byte) ([]byte, error) {
+	if r.aead == nil {
+		return nil, errExportOnly
+	}
+	nonce, err := r.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, err
+	}
+	r.seqNum++
+	return plaintext, nil
+}
+
+// Export derives a secret of length bytes from the context, bound to
+// exporterContext. It returns the same secret as Sender.Export.
+func (r *Recipient) Export(exporterContext []byte, length int) ([]byte, error) {
+	return r.export(exporterContext, length)
+}
+
+func suiteID(kemID, kdfID, aeadID uint16) []byte {
+	suiteID := make([]byte, 10)
+	copy(suiteID, "HPKE")
+	binary.BigEndian.PutUint16(suiteID[4:], kemID)
+	binary.BigEndian.PutUint16(suiteID[6:], kdfID)
+	binary.BigEndian.PutUint16(suiteID[8:], aeadID)
+	return suiteID
+}
+
+// ParsePublicKey parses the serialized public key of the KEM kemID, as
+// encoded by SerializePublicKey in RFC 9180, Section 7.1.1.
+func ParsePublicKey(kemID uint16, bytes []byte) (*ecdh.PublicKey, error) {
+	kemInfo, ok := supportedKEMs[kemID]
+	if !ok {
+		return nil, errors.New("hpke: unsupported KEM id")
+	}
+	return kemInfo.curve.NewPublicKey(bytes)
+}
+
+// ParsePrivateKey parses the serialized private key of the KEM kemID, as
+// encoded by SerializePrivateKey in RFC 9180, Section 7.1.2.
+func ParsePrivateKey(kemID uint16, bytes []byte) (*ecdh.PrivateKey, error) {
+	kemInfo, ok := supportedKEMs[kemID]
+	if !ok {
+		return nil, errors.New("hpke: unsupported KEM id")
+	}
+	return kemInfo.curve.NewPrivateKey(bytes)
+}
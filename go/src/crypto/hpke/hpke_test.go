@@ -0,0 +1,483 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpke
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha3"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, in string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// deriveKeyPair implements DeriveKeyPair from RFC 9180, Section 7.1.3, for
+// DHKEM(X25519, HKDF-SHA256) and DHKEM(P-256, HKDF-SHA256).
+func deriveKeyPair(t *testing.T, kem *dhKEM, ikm []byte) *ecdh.PrivateKey {
+	t.Helper()
+	dkpPRK := kem.kdf.LabeledExtract(kem.suiteID, nil, "dkp_prk", ikm)
+	if kem.dh == ecdh.X25519() {
+		sk := kem.kdf.LabeledExpand(kem.suiteID, dkpPRK, "sk", nil, kem.nSecret)
+		priv, err := kem.dh.NewPrivateKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return priv
+	}
+	// For the NIST curves, candidates are rejected until one is a valid
+	// scalar. The bitmask is 0xff for P-256, so it's a no-op.
+	for counter := 0; counter < 256; counter++ {
+		sk := kem.kdf.LabeledExpand(kem.suiteID, dkpPRK, "candidate", []byte{byte(counter)}, kem.nSecret)
+		if priv, err := kem.dh.NewPrivateKey(sk); err == nil {
+			return priv
+		}
+	}
+	t.Fatal("DeriveKeyPair failed")
+	return nil
+}
+
+func drawRandomInput(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	l := make([]byte, 1)
+	if _, err := r.Read(l); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, int(l[0]))
+	if _, err := r.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestRFC9180Vectors checks the base mode test vectors for the supported
+// ciphersuites. Rather than checking each encryption and export, 1000
+// messages with pseudo-random aad and plaintext are sealed, and 1000 secrets
+// of increasing length are exported with pseudo-random contexts, and the
+// outputs are hashed and compared with the accumulated values in the vector.
+func TestRFC9180Vectors(t *testing.T) {
+	vectorsJSON, err := os.ReadFile("testdata/rfc9180.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []struct {
+		Mode           uint16 `json:"mode"`
+		KEM            uint16 `json:"kem_id"`
+		KDF            uint16 `json:"kdf_id"`
+		AEAD           uint16 `json:"aead_id"`
+		Info           string `json:"info"`
+		IkmE           string `json:"ikmE"`
+		IkmR           string `json:"ikmR"`
+		SkRm           string `json:"skRm"`
+		PkRm           string `json:"pkRm"`
+		Enc            string `json:"enc"`
+		AccEncryptions string `json:"encryptions_accumulated"`
+		AccExports     string `json:"exports_accumulated"`
+	}
+	if err := json.Unmarshal(vectorsJSON, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vector := range vectors {
+		vector := vector
+		name := fmt.Sprintf("mode %04x kem %04x kdf %04x aead %04x",
+			vector.Mode, vector.KEM, vector.KDF, vector.AEAD)
+		t.Run(name, func(t *testing.T) {
+			kem, err := newDHKem(vector.KEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pkR := mustDecodeHex(t, vector.PkRm)
+			pub, err := ParsePublicKey(vector.KEM, pkR)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			skR := mustDecodeHex(t, vector.SkRm)
+			priv, err := ParsePrivateKey(vector.KEM, skR)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(priv.PublicKey().Bytes(), pkR) {
+				t.Errorf("unexpected recipient public key: got %x, want %x", priv.PublicKey().Bytes(), pkR)
+			}
+			if derived := deriveKeyPair(t, kem, mustDecodeHex(t, vector.IkmR)); !derived.Equal(priv) {
+				t.Errorf("unexpected recipient key derived from ikmR")
+			}
+
+			ephemeral := deriveKeyPair(t, kem, mustDecodeHex(t, vector.IkmE))
+			testingOnlyGenerateKey = func() (*ecdh.PrivateKey, error) {
+				return ephemeral, nil
+			}
+			defer func() { testingOnlyGenerateKey = nil }()
+
+			info := mustDecodeHex(t, vector.Info)
+			encap, sender, err := SetupSender(vector.KEM, vector.KDF, vector.AEAD, pub, info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := mustDecodeHex(t, vector.Enc); !bytes.Equal(encap, expected) {
+				t.Errorf("unexpected encapsulated key: got %x, want %x", encap, expected)
+			}
+
+			recipient, err := SetupRecipient(vector.KEM, vector.KDF, vector.AEAD, priv, info, encap)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if vector.AEAD == AEADExportOnly {
+				if _, err := sender.Seal(nil, nil); err == nil {
+					t.Error("Seal succeeded with the export-only AEAD")
+				}
+				if _, err := recipient.Open(nil, nil); err == nil {
+					t.Error("Open succeeded with the export-only AEAD")
+				}
+			} else {
+				source, sink := sha3.NewSHAKE128(), sha3.NewSHAKE128()
+				for i := 0; i < 1000; i++ {
+					aad, plaintext := drawRandomInput(t, source), drawRandomInput(t, source)
+					ciphertext, err := sender.Seal(aad, plaintext)
+					if err != nil {
+						t.Fatal(err)
+					}
+					sink.Write(ciphertext)
+					got, err := recipient.Open(aad, ciphertext)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, plaintext) {
+						t.Errorf("unexpected plaintext: got %x, want %x", got, plaintext)
+					}
+				}
+				encryptions := make([]byte, 16)
+				sink.Read(encryptions)
+				if expected := mustDecodeHex(t, vector.AccEncryptions); !bytes.Equal(encryptions, expected) {
+					t.Errorf("unexpected accumulated encryptions: got %x, want %x", encryptions, expected)
+				}
+			}
+
+			source, sink := sha3.NewSHAKE128(), sha3.NewSHAKE128()
+			for l := 0; l < 1000; l++ {
+				context := drawRandomInput(t, source)
+				value, err := sender.Export(context, l)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sink.Write(value)
+				got, err := recipient.Export(context, l)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, value) {
+					t.Errorf("recipient exported %x, sender exported %x", got, value)
+				}
+			}
+			exports := make([]byte, 16)
+			sink.Read(exports)
+			if expected := mustDecodeHex(t, vector.AccExports); !bytes.Equal(exports, expected) {
+				t.Errorf("unexpected accumulated exports: got %x, want %x", exports, expected)
+			}
+		})
+	}
+}
+
+// TestRFC9180PSKVectors checks the PSK mode test vectors from RFC 9180,
+// Appendix A.1.2, A.2.2 and A.3.2, including the output of the key schedule,
+// the encryptions listed in the RFC, and the exported values.
+func TestRFC9180PSKVectors(t *testing.T) {
+	vectorsJSON, err := os.ReadFile("testdata/rfc9180-psk.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []struct {
+		Mode           uint16 `json:"mode"`
+		KEM            uint16 `json:"kem_id"`
+		KDF            uint16 `json:"kdf_id"`
+		AEAD           uint16 `json:"aead_id"`
+		Info           string `json:"info"`
+		IkmE           string `json:"ikmE"`
+		SkRm           string `json:"skRm"`
+		PkRm           string `json:"pkRm"`
+		PSK            string `json:"psk"`
+		PSKID          string `json:"psk_id"`
+		Enc            string `json:"enc"`
+		SharedSecret   string `json:"shared_secret"`
+		Key            string `json:"key"`
+		BaseNonce      string `json:"base_nonce"`
+		ExporterSecret string `json:"exporter_secret"`
+		Encryptions    []struct {
+			Seq   uint64 `json:"seq"`
+			AAD   string `json:"aad"`
+			PT    string `json:"pt"`
+			Nonce string `json:"nonce"`
+			CT    string `json:"ct"`
+		} `json:"encryptions"`
+		Exports []struct {
+			Context string `json:"exporter_context"`
+			L       int    `json:"L"`
+			Value   string `json:"exported_value"`
+		} `json:"exports"`
+	}
+	if err := json.Unmarshal(vectorsJSON, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vector := range vectors {
+		vector := vector
+		name := fmt.Sprintf("mode %04x kem %04x kdf %04x aead %04x",
+			vector.Mode, vector.KEM, vector.KDF, vector.AEAD)
+		t.Run(name, func(t *testing.T) {
+			kem, err := newDHKem(vector.KEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := ParsePublicKey(vector.KEM, mustDecodeHex(t, vector.PkRm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			priv, err := ParsePrivateKey(vector.KEM, mustDecodeHex(t, vector.SkRm))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ephemeral := deriveKeyPair(t, kem, mustDecodeHex(t, vector.IkmE))
+			testingOnlyGenerateKey = func() (*ecdh.PrivateKey, error) {
+				return ephemeral, nil
+			}
+			defer func() { testingOnlyGenerateKey = nil }()
+
+			info := mustDecodeHex(t, vector.Info)
+			psk, pskID := mustDecodeHex(t, vector.PSK), mustDecodeHex(t, vector.PSKID)
+			encap, sender, err := SetupSenderPSK(vector.KEM, vector.KDF, vector.AEAD, pub, info, psk, pskID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := mustDecodeHex(t, vector.Enc); !bytes.Equal(encap, expected) {
+				t.Errorf("unexpected encapsulated key: got %x, want %x", encap, expected)
+			}
+			recipient, err := SetupRecipientPSK(vector.KEM, vector.KDF, vector.AEAD, priv, info, encap, psk, pskID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for side, ctx := range map[string]*context{"sender": sender.context, "recipient": recipient.context} {
+				for _, v := range []struct {
+					name      string
+					got, want []byte
+				}{
+					{"shared secret", ctx.sharedSecret, mustDecodeHex(t, vector.SharedSecret)},
+					{"key", ctx.key, mustDecodeHex(t, vector.Key)},
+					{"base nonce", ctx.baseNonce, mustDecodeHex(t, vector.BaseNonce)},
+					{"exporter secret", ctx.exporterSecret, mustDecodeHex(t, vector.ExporterSecret)},
+				} {
+					if !bytes.Equal(v.got, v.want) {
+						t.Errorf("unexpected %s %s: got %x, want %x", side, v.name, v.got, v.want)
+					}
+				}
+			}
+
+			for _, enc := range vector.Encryptions {
+				// Skip ahead to the sequence number of the encryption.
+				sender.seqNum, recipient.seqNum = enc.Seq, enc.Seq
+				nonce, err := sender.nextNonce()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected := mustDecodeHex(t, enc.Nonce); !bytes.Equal(nonce, expected) {
+					t.Errorf("unexpected nonce for sequence number %d: got %x, want %x", enc.Seq, nonce, expected)
+				}
+				aad, plaintext := mustDecodeHex(t, enc.AAD), mustDecodeHex(t, enc.PT)
+				ciphertext, err := sender.Seal(aad, plaintext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected := mustDecodeHex(t, enc.CT); !bytes.Equal(ciphertext, expected) {
+					t.Errorf("unexpected ciphertext for sequence number %d: got %x, want %x", enc.Seq, ciphertext, expected)
+				}
+				got, err := recipient.Open(aad, ciphertext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, plaintext) {
+					t.Errorf("unexpected plaintext for sequence number %d: got %x, want %x", enc.Seq, got, plaintext)
+				}
+			}
+
+			for _, exp := range vector.Exports {
+				exporterContext := mustDecodeHex(t, exp.Context)
+				expected := mustDecodeHex(t, exp.Value)
+				for side, export := range map[string]func([]byte, int) ([]byte, error){"sender": sender.Export, "recipient": recipient.Export} {
+					value, err := export(exporterContext, exp.L)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(value, expected) {
+						t.Errorf("unexpected %s export for context %x: got %x, want %x", side, exporterContext, value, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOpenOutOfOrder(t *testing.T) {
+	priv, err := ParsePrivateKey(DHKEMX25519HKDFSHA256, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encap, sender, err := SetupSender(DHKEMX25519HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM, priv.PublicKey(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := SetupRecipient(DHKEMX25519HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM, priv, nil, encap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := sender.Seal(nil, []byte("first"))
+	second, _ := sender.Seal(nil, []byte("second"))
+	if _, err := recipient.Open(nil, second); err == nil {
+		t.Error("Open succeeded out of order")
+	}
+	// A failed Open must not advance the sequence number.
+	if pt, err := recipient.Open(nil, first); err != nil || string(pt) != "first" {
+		t.Errorf("Open(first) = %q, %v", pt, err)
+	}
+	if pt, err := recipient.Open(nil, second); err != nil || string(pt) != "second" {
+		t.Errorf("Open(second) = %q, %v", pt, err)
+	}
+}
+
+func TestPSKMode(t *testing.T) {
+	psk := bytes.Repeat([]byte{0x42}, 32)
+	pskID := []byte("test psk")
+	for _, kemID := range []uint16{DHKEMX25519HKDFSHA256, DHKEMP256HKDFSHA256} {
+		kem, err := newDHKem(kemID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, err := kem.dh.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := []byte("info")
+
+		encap, sender, err := SetupSenderPSK(kemID, KDFHKDFSHA384, AEADAES256GCM, priv.PublicKey(), info, psk, pskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := sender.Seal([]byte("aad"), []byte("plaintext"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipient, err := SetupRecipientPSK(kemID, KDFHKDFSHA384, AEADAES256GCM, priv, info, encap, psk, pskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pt, err := recipient.Open([]byte("aad"), ciphertext); err != nil || string(pt) != "plaintext" {
+			t.Errorf("%04x: Open = %q, %v", kemID, pt, err)
+		}
+		senderSecret, _ := sender.Export([]byte("context"), 48)
+		recipientSecret, _ := recipient.Export([]byte("context"), 48)
+		if !bytes.Equal(senderSecret, recipientSecret) {
+			t.Errorf("%04x: exported secrets don't match", kemID)
+		}
+
+		// A recipient without the same PSK, or in base mode, can't open the
+		// message.
+		for name, setup := range map[string]func() (*Recipient, error){
+			"wrong PSK": func() (*Recipient, error) {
+				return SetupRecipientPSK(kemID, KDFHKDFSHA384, AEADAES256GCM, priv, info, encap, bytes.Repeat([]byte{0x43}, 32), pskID)
+			},
+			"wrong PSK ID": func() (*Recipient, error) {
+				return SetupRecipientPSK(kemID, KDFHKDFSHA384, AEADAES256GCM, priv, info, encap, psk, []byte("other psk"))
+			},
+			"base mode": func() (*Recipient, error) {
+				return SetupRecipient(kemID, KDFHKDFSHA384, AEADAES256GCM, priv, info, encap)
+			},
+		} {
+			r, err := setup()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Open([]byte("aad"), ciphertext); err == nil {
+				t.Errorf("%04x: Open succeeded with %s", kemID, name)
+			}
+		}
+
+		if _, _, err := SetupSenderPSK(kemID, KDFHKDFSHA384, AEADAES256GCM, priv.PublicKey(), info, nil, pskID); err == nil {
+			t.Errorf("%04x: SetupSenderPSK succeeded without a PSK", kemID)
+		}
+		if _, err := SetupRecipientPSK(kemID, KDFHKDFSHA384, AEADAES256GCM, priv, info, encap, psk, nil); err == nil {
+			t.Errorf("%04x: SetupRecipientPSK succeeded without a PSK ID", kemID)
+		}
+	}
+}
+
+func TestExportLength(t *testing.T) {
+	priv, err := ParsePrivateKey(DHKEMX25519HKDFSHA256, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kdfID, max := range map[uint16]int{
+		KDFHKDFSHA256: 255 * 32,
+		KDFHKDFSHA384: 255 * 48,
+		KDFHKDFSHA512: 255 * 64,
+	} {
+		_, sender, err := SetupSender(DHKEMX25519HKDFSHA256, kdfID, AEADExportOnly, priv.PublicKey(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret, err := sender.Export(nil, max); err != nil || len(secret) != max {
+			t.Errorf("%04x: Export(%d) = %d bytes, %v", kdfID, max, len(secret), err)
+		}
+		if _, err := sender.Export(nil, max+1); err == nil {
+			t.Errorf("%04x: Export(%d) succeeded", kdfID, max+1)
+		}
+		if _, err := sender.Export(nil, -1); err == nil {
+			t.Errorf("%04x: Export(-1) succeeded", kdfID)
+		}
+	}
+}
+
+func TestUnsupportedSuites(t *testing.T) {
+	priv, err := ParsePrivateKey(DHKEMX25519HKDFSHA256, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []struct{ kem, kdf, aead uint16 }{
+		{0x0011, KDFHKDFSHA256, AEADAES128GCM},
+		{DHKEMX25519HKDFSHA256, 0x0004, AEADAES128GCM},
+		{DHKEMX25519HKDFSHA256, KDFHKDFSHA256, 0x0004},
+	} {
+		if SuiteSupported(s.kem, s.kdf, s.aead) {
+			t.Errorf("SuiteSupported(%04x, %04x, %04x) = true", s.kem, s.kdf, s.aead)
+		}
+		if _, _, err := SetupSender(s.kem, s.kdf, s.aead, priv.PublicKey(), nil); err == nil {
+			t.Errorf("SetupSender(%04x, %04x, %04x) succeeded", s.kem, s.kdf, s.aead)
+		}
+	}
+	if _, err := ParsePublicKey(0x0011, make([]byte, 97)); err == nil {
+		t.Error("ParsePublicKey succeeded for unsupported KEM")
+	}
+	// The key must match the KEM.
+	if _, _, err := SetupSender(DHKEMP256HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM, priv.PublicKey(), nil); err == nil {
+		t.Error("SetupSender succeeded with an X25519 key for the P-256 KEM")
+	}
+}
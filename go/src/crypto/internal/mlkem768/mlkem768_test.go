@@ -0,0 +1,264 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mlkem768
+
+import (
+	"bytes"
+	"crypto/sha3"
+	"encoding/hex"
+	"testing"
+)
+
+func TestFieldReduce(t *testing.T) {
+	for a := uint32(0); a < 2*q*q; a++ {
+		got := fieldReduce(a)
+		exp := fieldElement(a % q)
+		if got != exp {
+			t.Fatalf("reduce(%d) = %d, expected %d", a, got, exp)
+		}
+	}
+}
+
+func TestCompressDecompress(t *testing.T) {
+	for _, d := range []uint8{1, 4, 10} {
+		for x := fieldElement(0); x < q; x++ {
+			c := compress(x, d)
+			if c >= 1<<d {
+				t.Fatalf("compress(%d, %d) = %d, out of range", x, d, c)
+			}
+			y := decompress(c, d)
+			// The round-trip error is at most ⌈q/2^(d+1)⌋.
+			diff := int(x) - int(y)
+			if diff < 0 {
+				diff = -diff
+			}
+			if q-diff < diff {
+				diff = q - diff
+			}
+			if diff > (q+(1<<(d+1))-1)>>(d+1) {
+				t.Fatalf("decompress(compress(%d, %d)) = %d", x, d, y)
+			}
+		}
+	}
+}
+
+func TestNTT(t *testing.T) {
+	var f ringElement
+	for i := range f {
+		f[i] = fieldElement(i * 13 % q)
+	}
+	if g := inverseNTT(ntt(f)); g != f {
+		t.Errorf("inverseNTT(ntt(f)) != f")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dk, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, Ke, err := Encapsulate(dk.EncapsulationKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	Kd, err := Decapsulate(dk, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Ke, Kd) {
+		t.Fail()
+	}
+
+	dk1, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(dk.EncapsulationKey(), dk1.EncapsulationKey()) {
+		t.Fail()
+	}
+	if bytes.Equal(dk.Bytes(), dk1.Bytes()) {
+		t.Fail()
+	}
+
+	dk2, err := NewKeyFromSeed(dk.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dk.EncapsulationKey(), dk2.EncapsulationKey()) {
+		t.Fail()
+	}
+
+	c1, Ke1, err := Encapsulate(dk.EncapsulationKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(c, c1) {
+		t.Fail()
+	}
+	if bytes.Equal(Ke, Ke1) {
+		t.Fail()
+	}
+}
+
+func TestBadLengths(t *testing.T) {
+	dk, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+
+	for i := 0; i < len(ek)-1; i++ {
+		if _, _, err := Encapsulate(ek[:i]); err == nil {
+			t.Errorf("expected error for ek length %d", i)
+		}
+	}
+	ekLong := ek
+	for i := 0; i < 100; i++ {
+		ekLong = append(ekLong, 0)
+		if _, _, err := Encapsulate(ekLong); err == nil {
+			t.Errorf("expected error for ek length %d", len(ekLong))
+		}
+	}
+
+	c, _, err := Encapsulate(ek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(c)-1; i++ {
+		if _, err := Decapsulate(dk, c[:i]); err == nil {
+			t.Errorf("expected error for c length %d", i)
+		}
+	}
+	cLong := c
+	for i := 0; i < 100; i++ {
+		cLong = append(cLong, 0)
+		if _, err := Decapsulate(dk, cLong); err == nil {
+			t.Errorf("expected error for c length %d", len(cLong))
+		}
+	}
+
+	for _, l := range []int{0, SeedSize - 1, SeedSize + 1} {
+		if _, err := NewKeyFromSeed(make([]byte, l)); err == nil {
+			t.Errorf("expected error for seed length %d", l)
+		}
+	}
+}
+
+func TestUnreducedEncapsulationKey(t *testing.T) {
+	dk, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+	// Set the first coefficient to q, which is not reduced.
+	ek[0] = byte(q & 0xff)
+	ek[1] = ek[1]&0xf0 | byte(q>>8)
+	if _, _, err := Encapsulate(ek); err == nil {
+		t.Error("expected error for unreduced encapsulation key")
+	}
+}
+
+// TestAccumulated accumulates the outputs of key generation, encapsulation,
+// and decapsulation, including implicit rejection of random ciphertexts, and
+// checks the hash of the result against values computed with an independent
+// implementation.
+func TestAccumulated(t *testing.T) {
+	n := 10000
+	expected := "8a518cc63da366322a8e7a818c7a0d63483cb3528d34a4cf42f35d5ad73f22fc"
+	if testing.Short() {
+		n = 100
+		expected = "1114b1b6699ed191734fa339376afa7e285c9e6acf6ff0177d346696ce564415"
+	}
+
+	s := sha3.NewSHAKE128()
+	o := sha3.NewSHAKE128()
+	seed := make([]byte, SeedSize)
+	var msg [messageSize]byte
+	ct1 := make([]byte, CiphertextSize)
+
+	for i := 0; i < n; i++ {
+		s.Read(seed)
+		dk, err := NewKeyFromSeed(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ek := dk.EncapsulationKey()
+		o.Write(ek)
+
+		s.Read(msg[:])
+		ct, k, err := encapsulate(ek, &msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Write(ct)
+		o.Write(k)
+
+		kk, err := Decapsulate(dk, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(kk, k) {
+			t.Errorf("k: got %x, expected %x", kk, k)
+		}
+
+		s.Read(ct1)
+		k1, err := Decapsulate(dk, ct1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Write(k1)
+	}
+
+	got := make([]byte, 32)
+	o.Read(got)
+	if hex.EncodeToString(got) != expected {
+		t.Errorf("got %x, expected %s", got, expected)
+	}
+}
+
+var sink byte
+
+func BenchmarkKeyGen(b *testing.B) {
+	var d, z [32]byte
+	var dk DecapsulationKey
+	for i := 0; i < b.N; i++ {
+		kemKeyGen(&dk, &d, &z)
+		sink ^= dk.EncapsulationKey()[0]
+	}
+}
+
+func BenchmarkEncaps(b *testing.B) {
+	dk, err := GenerateKey()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+	var m [messageSize]byte
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, K, err := encapsulate(ek, &m)
+		if err != nil {
+			b.Fatal(err)
+		}
+		sink ^= c[0] ^ K[0]
+	}
+}
+
+func BenchmarkDecaps(b *testing.B) {
+	dk, err := GenerateKey()
+	if err != nil {
+		b.Fatal(err)
+	}
+	c, _, err := Encapsulate(dk.EncapsulationKey())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		K, _ := Decapsulate(dk, c)
+		sink ^= K[0]
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sha3 implements the SHA-3 fixed-output-length hash functions and
+// the SHAKE variable-output-length functions defined by FIPS 202, as well as
+// the cSHAKE extendable-output-length functions defined by NIST SP 800-185.
+//
+// The SHA-3 hash functions are registered with the crypto package as
+// crypto.SHA3_224, crypto.SHA3_256, crypto.SHA3_384 and crypto.SHA3_512.
+package sha3
+
+import (
+	"crypto"
+	"hash"
+)
+
+func init() {
+	crypto.RegisterHash(crypto.SHA3_224, func() hash.Hash { return New224() })
+	crypto.RegisterHash(crypto.SHA3_256, func() hash.Hash { return New256() })
+	crypto.RegisterHash(crypto.SHA3_384, func() hash.Hash { return New384() })
+	crypto.RegisterHash(crypto.SHA3_512, func() hash.Hash { return New512() })
+}
+
+// SHA3 is an instance of a SHA-3 hash. It implements hash.Hash, as well as
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler to marshal and
+// unmarshal the internal state of the hash.
+type SHA3 struct {
+	s state
+}
+
+// New224 creates a new SHA3-224 hash.
+func New224() *SHA3 {
+	return &SHA3{state{rate: rateK448, outputLen: 28, dsbyte: dsbyteSHA3}}
+}
+
+// New256 creates a new SHA3-256 hash.
+func New256() *SHA3 {
+	return &SHA3{state{rate: rateK512, outputLen: 32, dsbyte: dsbyteSHA3}}
+}
+
+// New384 creates a new SHA3-384 hash.
+func New384() *SHA3 {
+	return &SHA3{state{rate: rateK768, outputLen: 48, dsbyte: dsbyteSHA3}}
+}
+
+// New512 creates a new SHA3-512 hash.
+func New512() *SHA3 {
+	return &SHA3{state{rate: rateK1024, outputLen: 64, dsbyte: dsbyteSHA3}}
+}
+
+// Sum224 returns the SHA3-224 hash of data.
+func Sum224(data []byte) [28]byte {
+	var out [28]byte
+	h := New224()
+	h.Write(data)
+	h.s.read(out[:])
+	return out
+}
+
+// Sum256 returns the SHA3-256 hash of data.
+func Sum256(data []byte) [32]byte {
+	var out [32]byte
+	h := New256()
+	h.Write(data)
+	h.s.read(out[:])
+	return out
+}
+
+// Sum384 returns the SHA3-384 hash of data.
+func Sum384(data []byte) [48]byte {
+	var out [48]byte
+	h := New384()
+	h.Write(data)
+	h.s.read(out[:])
+	return out
+}
+
+// Sum512 returns the SHA3-512 hash of data.
+func Sum512(data []byte) [64]byte {
+	var out [64]byte
+	h := New512()
+	h.Write(data)
+	h.s.read(out[:])
+	return out
+}
+
+// Write absorbs more data into the hash's state.
+func (s *SHA3) Write(p []byte) (n int, err error) {
+	return s.s.write(p)
+}
+
+// Sum appends the current hash to b and returns the resulting slice.
+// It does not change the underlying hash state.
+func (s *SHA3) Sum(b []byte) []byte {
+	return s.s.sum(b)
+}
+
+// Reset resets the hash to its initial state.
+func (s *SHA3) Reset() {
+	s.s.reset()
+}
+
+// Size returns the number of bytes Sum will produce.
+func (s *SHA3) Size() int {
+	return s.s.outputLen
+}
+
+// BlockSize returns the hash's rate.
+func (s *SHA3) BlockSize() int {
+	return s.s.rate
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *SHA3) MarshalBinary() ([]byte, error) {
+	return s.s.appendBinary(make([]byte, 0, marshaledSize)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *SHA3) UnmarshalBinary(data []byte) error {
+	return s.s.unmarshalBinary(data)
+}
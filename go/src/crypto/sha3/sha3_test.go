@@ -0,0 +1,383 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sha3
+
+import (
+	"bytes"
+	"crypto"
+	"encoding"
+	"encoding/hex"
+	"hash"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var testDigests = map[string]func() hash.Hash{
+	"SHA3-224": func() hash.Hash { return New224() },
+	"SHA3-256": func() hash.Hash { return New256() },
+	"SHA3-384": func() hash.Hash { return New384() },
+	"SHA3-512": func() hash.Hash { return New512() },
+	"SHAKE128": func() hash.Hash { return &shakeHash{NewSHAKE128(), 32} },
+	"SHAKE256": func() hash.Hash { return &shakeHash{NewSHAKE256(), 64} },
+}
+
+// shakeHash adapts a SHAKE to hash.Hash with a fixed output length, so that
+// the same tests can run on the SHA-3 and SHAKE functions.
+type shakeHash struct {
+	*SHAKE
+	size int
+}
+
+func (h *shakeHash) Size() int { return h.size }
+
+func (h *shakeHash) Sum(b []byte) []byte {
+	out := make([]byte, h.size)
+	h.Clone().Read(out)
+	return append(b, out...)
+}
+
+var golden = []struct {
+	input   []byte
+	digests map[string]string
+}{
+	{
+		input: nil,
+		digests: map[string]string{
+			"SHA3-224": "6b4e03423667dbb73b6e15454f0eb1abd4597f9a1b078e3f5b5a6bc7",
+			"SHA3-256": "a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a",
+			"SHA3-384": "0c63a75b845e4f7d01107d852e4c2485c51a50aaaa94fc61995e71bbee983a2ac3713831264adb47fb6bd1e058d5f004",
+			"SHA3-512": "a69f73cca23a9ac5c8b567dc185a756e97c982164fe25859e0d1dcc1475c80a615b2123af1f5f94c11e3e9402c3ac558f500199d95b6d3e301758586281dcd26",
+			"SHAKE128": "7f9c2ba4e88f827d616045507605853ed73b8093f6efbc88eb1a6eacfa66ef26",
+			"SHAKE256": "46b9dd2b0ba88d13233b3feb743eeb243fcd52ea62b81b82b50c27646ed5762fd75dc4ddd8c0f200cb05019d67b592f6fc821c49479ab48640292eacb3b7c4be",
+		},
+	},
+	{
+		input: []byte("abc"),
+		digests: map[string]string{
+			"SHA3-224": "e642824c3f8cf24ad09234ee7d3c766fc9a3a5168d0c94ad73b46fdf",
+			"SHA3-256": "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532",
+			"SHA3-384": "ec01498288516fc926459f58e2c6ad8df9b473cb0fc08c2596da7cf0e49be4b298d88cea927ac7f539f1edf228376d25",
+			"SHA3-512": "b751850b1a57168a5693cd924b6b096e08f621827444f70d884f5d0240d2712e10e116e9192af3c91a7ec57647e3934057340b4cf408d5a56592f8274eec53f0",
+			"SHAKE128": "5881092dd818bf5cf8a3ddb793fbcba74097d5c526a6d35f97b83351940f2cc8",
+			"SHAKE256": "483366601360a8771c6863080cc4114d8db44530f8f1e1ee4f94ea37e78b5739d5a15bef186a5386c75744c0527e1faa9f8726e462a12a4feb06bd8801e751e4",
+		},
+	},
+	{
+		// The 1600-bit message from the NIST examples, which is longer than
+		// the rate of every function.
+		input: bytes.Repeat([]byte{0xa3}, 200),
+		digests: map[string]string{
+			"SHA3-224": "9376816aba503f72f96ce7eb65ac095deee3be4bf9bbc2a1cb7e11e0",
+			"SHA3-256": "79f38adec5c20307a98ef76e8324afbfd46cfd81b22e3973c65fa1bd9de31787",
+			"SHA3-384": "1881de2ca7e41ef95dc4732b8f5f002b189cc1e42b74168ed1732649ce1dbcdd76197a31fd55ee989f2d7050dd473e8f",
+			"SHA3-512": "e76dfad22084a8b1467fcf2ffa58361bec7628edf5f3fdc0e4805dc48caeeca81b7c13c30adf52a3659584739a2df46be589c51ca1a4a8416df6545a1ce8ba00",
+			"SHAKE128": "131ab8d2b594946b9c81333f9bb6e0ce75c3b93104fa3469d3917457385da037",
+			"SHAKE256": "cd8a920ed141aa0407a22d59288652e9d9f1a7ee0c1e7c1ca699424da84a904d2d700caae7396ece96604440577da4f3aa22aeb8857f961c4cd8e06f0ae6610b",
+		},
+	},
+}
+
+func TestGolden(t *testing.T) {
+	for i, g := range golden {
+		for name, newHash := range testDigests {
+			want := g.digests[name]
+			h := newHash()
+			h.Write(g.input)
+			if got := hex.EncodeToString(h.Sum(nil)); got != want {
+				t.Errorf("%s(golden[%d]) = %s, want %s", name, i, got, want)
+			}
+
+			// Write the input one byte at a time, to exercise the
+			// buffering of partial blocks.
+			h.Reset()
+			for j := range g.input {
+				h.Write(g.input[j : j+1])
+			}
+			if got := hex.EncodeToString(h.Sum(nil)); got != want {
+				t.Errorf("%s(golden[%d]) after byte writes = %s, want %s", name, i, got, want)
+			}
+		}
+
+		sums := map[string][]byte{
+			"SHA3-224": func() []byte { s := Sum224(g.input); return s[:] }(),
+			"SHA3-256": func() []byte { s := Sum256(g.input); return s[:] }(),
+			"SHA3-384": func() []byte { s := Sum384(g.input); return s[:] }(),
+			"SHA3-512": func() []byte { s := Sum512(g.input); return s[:] }(),
+			"SHAKE128": SumSHAKE128(g.input, 32),
+			"SHAKE256": SumSHAKE256(g.input, 64),
+		}
+		for name, sum := range sums {
+			if got, want := hex.EncodeToString(sum), g.digests[name]; got != want {
+				t.Errorf("Sum %s(golden[%d]) = %s, want %s", name, i, got, want)
+			}
+		}
+	}
+}
+
+// TestCSHAKE checks the cSHAKE samples from NIST SP 800-185.
+func TestCSHAKE(t *testing.T) {
+	data200 := make([]byte, 200)
+	for i := range data200 {
+		data200[i] = byte(i)
+	}
+	for _, tc := range []struct {
+		newXOF func(N, S []byte) *SHAKE
+		data   []byte
+		want   string
+	}{
+		{NewCSHAKE128, []byte{0, 1, 2, 3}, "c1c36925b6409a04f1b504fcbca9d82b4017277cb5ed2b2065fc1d3814d5aaf5"},
+		{NewCSHAKE128, data200, "c5221d50e4f822d96a2e8881a961420f294b7b24fe3d2094baed2c6524cc166b"},
+		{NewCSHAKE256, []byte{0, 1, 2, 3}, "d008828e2b80ac9d2218ffee1d070c48b8e4c87bff32c9699d5b6896eee0edd164020e2be0560858d9c00c037e34a96937c561a74c412bb4c746469527281c8c"},
+		{NewCSHAKE256, data200, "07dc27b11e51fbac75bc7b3c1d983e8b4b85fb1defaf218912ac86430273091727f42b17ed1df63e8ec118f04b23633c1dfb1574c8fb55cb45da8e25afb092bb"},
+	} {
+		want := mustDecodeHex(tc.want)
+		c := tc.newXOF(nil, []byte("Email Signature"))
+		for i := 0; i < 2; i++ {
+			c.Write(tc.data)
+			got := make([]byte, len(want))
+			c.Read(got)
+			if !bytes.Equal(got, want) {
+				t.Errorf("cSHAKE(%d bytes) = %x, want %x", len(tc.data), got, want)
+			}
+			// Reset must restore the customization.
+			c.Reset()
+		}
+	}
+
+	// With empty N and S, cSHAKE is SHAKE.
+	c := NewCSHAKE128(nil, nil)
+	c.Write([]byte("abc"))
+	got := make([]byte, 32)
+	c.Read(got)
+	if want := SumSHAKE128([]byte("abc"), 32); !bytes.Equal(got, want) {
+		t.Errorf("cSHAKE128 with empty N and S = %x, want %x", got, want)
+	}
+}
+
+// TestSqueezing checks that squeezing the full output all at once produces
+// the same output as squeezing it in chunks.
+func TestSqueezing(t *testing.T) {
+	for _, newXOF := range []func() *SHAKE{NewSHAKE128, NewSHAKE256} {
+		d0 := newXOF()
+		d0.Write([]byte("input"))
+		ref := make([]byte, 1000)
+		d0.Read(ref)
+
+		d1 := newXOF()
+		d1.Write([]byte("input"))
+		var multiple []byte
+		for range ref {
+			one := make([]byte, 1)
+			d1.Read(one)
+			multiple = append(multiple, one...)
+		}
+		if !bytes.Equal(ref, multiple) {
+			t.Errorf("squeezing %d bytes one at a time failed", len(ref))
+		}
+	}
+}
+
+// TestUnalignedWrite checks that writing data in an arbitrary pattern with
+// small input buffers produces the same result as a single large write.
+func TestUnalignedWrite(t *testing.T) {
+	buf := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(buf)
+	for name, newHash := range testDigests {
+		d := newHash()
+		d.Write(buf)
+		want := d.Sum(nil)
+		d.Reset()
+		for i := 0; i < len(buf); {
+			// Cycle through offsets which make a 137 byte sequence.
+			// Because 137 is prime this sequence should exercise all corner
+			// cases.
+			offsets := [17]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 1}
+			for _, j := range offsets {
+				if v := len(buf) - i; v < j {
+					j = v
+				}
+				d.Write(buf[i : i+j])
+				i += j
+			}
+		}
+		if got := d.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("%s: unaligned writes = %x, want %x", name, got, want)
+		}
+	}
+}
+
+// TestAppend checks that Sum appends to its argument and doesn't change the
+// state of the hash.
+func TestAppend(t *testing.T) {
+	d := New224()
+	for capacity := 2; capacity <= 66; capacity += 64 {
+		// The first time around the loop, Sum will have to reallocate.
+		// The second time, it will not.
+		buf := make([]byte, 2, capacity)
+		d.Reset()
+		d.Write([]byte{0xcc})
+		buf = d.Sum(buf)
+		want := "0000df70adc49b2e76eee3a6931b93fa41841c3af2cdf5b32a18b5478c39"
+		if got := hex.EncodeToString(buf); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+
+	d.Reset()
+	d.Write([]byte("ab"))
+	first := d.Sum(nil)
+	if second := d.Sum(nil); !bytes.Equal(first, second) {
+		t.Errorf("Sum changed the state of the hash")
+	}
+	d.Write([]byte("c"))
+	if got, want := d.Sum(nil), Sum224([]byte("abc")); !bytes.Equal(got, want[:]) {
+		t.Errorf("Write after Sum = %x, want %x", got, want)
+	}
+}
+
+func TestWriteAfterRead(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Write after Read did not panic")
+		}
+	}()
+	s := NewSHAKE128()
+	s.Read(make([]byte, 1))
+	s.Write([]byte("x"))
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	type marshaler interface {
+		io.Writer
+		encoding.BinaryMarshaler
+		encoding.BinaryUnmarshaler
+	}
+	for name, newState := range map[string]func() marshaler{
+		"SHA3-224":  func() marshaler { return New224() },
+		"SHA3-512":  func() marshaler { return New512() },
+		"SHAKE128":  func() marshaler { return NewSHAKE128() },
+		"cSHAKE256": func() marshaler { return NewCSHAKE256([]byte("N"), []byte("S")) },
+	} {
+		for _, split := range []int{0, 1, 100, 168, 500} {
+			input := make([]byte, 1000)
+			rand.New(rand.NewSource(int64(split))).Read(input)
+
+			h := newState()
+			h.Write(input[:split])
+			state, err := h.MarshalBinary()
+			if err != nil {
+				t.Fatalf("%s: MarshalBinary failed: %v", name, err)
+			}
+			h2 := newState()
+			if err := h2.UnmarshalBinary(state); err != nil {
+				t.Fatalf("%s: UnmarshalBinary failed: %v", name, err)
+			}
+			h.Write(input[split:])
+			h2.Write(input[split:])
+
+			got, want := digestOf(h2), digestOf(h)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s split at %d: got %x, want %x", name, split, got, want)
+			}
+		}
+
+		if err := newState().UnmarshalBinary([]byte("sha\x08")); err == nil {
+			t.Errorf("%s: UnmarshalBinary accepted a truncated state", name)
+		}
+	}
+
+	// A state can't be restored into a different function.
+	state, _ := New256().MarshalBinary()
+	if err := New512().UnmarshalBinary(state); err == nil {
+		t.Error("UnmarshalBinary accepted a SHA3-256 state into SHA3-512")
+	}
+	if err := NewSHAKE128().UnmarshalBinary(state); err == nil {
+		t.Error("UnmarshalBinary accepted a SHA3-256 state into SHAKE128")
+	}
+}
+
+func digestOf(w io.Writer) []byte {
+	switch h := w.(type) {
+	case hash.Hash:
+		return h.Sum(nil)
+	case *SHAKE:
+		out := make([]byte, 64)
+		h.Read(out)
+		return out
+	}
+	panic("unexpected type")
+}
+
+func TestRegistered(t *testing.T) {
+	for _, tc := range []struct {
+		h    crypto.Hash
+		name string
+	}{
+		{crypto.SHA3_224, "SHA3-224"},
+		{crypto.SHA3_256, "SHA3-256"},
+		{crypto.SHA3_384, "SHA3-384"},
+		{crypto.SHA3_512, "SHA3-512"},
+	} {
+		if !tc.h.Available() {
+			t.Errorf("%s is not available", tc.name)
+			continue
+		}
+		h := tc.h.New()
+		if h.Size() != tc.h.Size() {
+			t.Errorf("%s: Size() = %d, want %d", tc.name, h.Size(), tc.h.Size())
+		}
+		h.Write([]byte("abc"))
+		if got, want := hex.EncodeToString(h.Sum(nil)), golden[1].digests[tc.name]; got != want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, want)
+		}
+	}
+}
+
+var bench = New256()
+var buf [16384]byte
+
+func benchmarkHash(b *testing.B, h hash.Hash, size int) {
+	b.SetBytes(int64(size))
+	sum := make([]byte, h.Size())
+	for i := 0; i < b.N; i++ {
+		h.Reset()
+		h.Write(buf[:size])
+		h.Sum(sum[:0])
+	}
+}
+
+func BenchmarkSha3_512_MTU(b *testing.B) { benchmarkHash(b, New512(), 1350) }
+func BenchmarkSha3_384_MTU(b *testing.B) { benchmarkHash(b, New384(), 1350) }
+func BenchmarkSha3_256_MTU(b *testing.B) { benchmarkHash(b, New256(), 1350) }
+func BenchmarkSha3_224_MTU(b *testing.B) { benchmarkHash(b, New224(), 1350) }
+
+func BenchmarkSha3_256_8Bytes(b *testing.B) { benchmarkHash(b, bench, 8) }
+func BenchmarkSha3_256_1K(b *testing.B)     { benchmarkHash(b, bench, 1024) }
+
+func benchmarkShake(b *testing.B, h *SHAKE, size, num int) {
+	b.SetBytes(int64(size * num))
+	out := make([]byte, 32)
+	for i := 0; i < b.N; i++ {
+		h.Reset()
+		for j := 0; j < num; j++ {
+			h.Write(buf[:size])
+		}
+		h.Read(out)
+	}
+}
+
+func BenchmarkShake128_MTU(b *testing.B)  { benchmarkShake(b, NewSHAKE128(), 1350, 1) }
+func BenchmarkShake256_MTU(b *testing.B)  { benchmarkShake(b, NewSHAKE256(), 1350, 1) }
+func BenchmarkShake256_16x(b *testing.B)  { benchmarkShake(b, NewSHAKE256(), 16, 1024) }
+func BenchmarkShake256_1MiB(b *testing.B) { benchmarkShake(b, NewSHAKE256(), 1024, 1024) }
@@ -0,0 +1,293 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hpke"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func marshalECHConfig(id uint8, pubKey []byte, publicName string, maxNameLen uint8) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16(extensionEncryptedClientHello)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(id)
+		b.AddUint16(hpke.DHKEMX25519HKDFSHA256)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(pubKey)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, aeadID := range []uint16{hpke.AEADAES128GCM, hpke.AEADChaCha20Poly1305} {
+				b.AddUint16(hpke.KDFHKDFSHA256)
+				b.AddUint16(aeadID)
+			}
+		})
+		b.AddUint8(maxNameLen)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(publicName))
+		})
+		b.AddUint16(0) // extensions
+	})
+	return b.BytesOrPanic()
+}
+
+func marshalECHConfigList(configs ...[]byte) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, c := range configs {
+			b.AddBytes(c)
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+func TestECHConfigList(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := marshalECHConfig(42, key.PublicKey().Bytes(), "public.example", 32)
+
+	// A config with an unknown version must be skipped.
+	unknown := append([]byte{0xfe, 0x0c, 0, 3}, 1, 2, 3)
+	list := marshalECHConfigList(unknown, config)
+
+	configs, err := parseECHConfigList(list)
+	if err != nil {
+		t.Fatalf("parseECHConfigList failed: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("parseECHConfigList returned %d configs, want 1", len(configs))
+	}
+	ec, pub, cs := pickECHConfig(configs)
+	if ec == nil {
+		t.Fatal("pickECHConfig returned no config")
+	}
+	if ec.ConfigID != 42 || string(ec.PublicName) != "public.example" || !bytes.Equal(ec.raw, config) {
+		t.Errorf("unexpected config: %+v", ec)
+	}
+	if !bytes.Equal(pub.Bytes(), key.PublicKey().Bytes()) {
+		t.Errorf("unexpected public key")
+	}
+	if cs.KDFID != hpke.KDFHKDFSHA256 || cs.AEADID != hpke.AEADAES128GCM {
+		t.Errorf("unexpected cipher suite: %+v", cs)
+	}
+
+	for _, bad := range [][]byte{
+		nil,
+		list[:len(list)-1],
+		append(list, 0),
+		marshalECHConfigList(config[:len(config)-1]),
+	} {
+		if _, err := parseECHConfigList(bad); err == nil {
+			t.Errorf("parseECHConfigList(%x) succeeded", bad)
+		}
+	}
+
+	invalidName := marshalECHConfig(1, key.PublicKey().Bytes(), "localhost", 32)
+	configs, err = parseECHConfigList(marshalECHConfigList(invalidName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec, _, _ := pickECHConfig(configs); ec != nil {
+		t.Errorf("pickECHConfig picked a config with an invalid public name")
+	}
+}
+
+func TestValidDNSName(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		valid bool
+	}{
+		{"example.com", true},
+		{"a.b-c.example", true},
+		{"EXAMPLE.com", true},
+		{"com", false},
+		{"example..com", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"exa_mple.com", false},
+		{"example.com.", false},
+		{"192.168.0.1", true},
+	} {
+		if got := validDNSName(tc.name); got != tc.valid {
+			t.Errorf("validDNSName(%q) = %v, want %v", tc.name, got, tc.valid)
+		}
+	}
+}
+
+func echTestConfigs(t *testing.T) (client, server *Config) {
+	issuer, err := x509.ParseCertificate(testRSACertificateIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer)
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echConfig := marshalECHConfig(1, key.PublicKey().Bytes(), "public.example", 32)
+
+	now := func() time.Time { return time.Unix(1476984729, 0) }
+	client = &Config{
+		Time:                           now,
+		ServerName:                     "example.golang",
+		RootCAs:                        roots,
+		MinVersion:                     VersionTLS13,
+		EncryptedClientHelloConfigList: marshalECHConfigList(echConfig),
+	}
+	server = &Config{
+		Time:         now,
+		Certificates: testConfig.Certificates,
+		EncryptedClientHelloKeys: []EncryptedClientHelloKey{
+			{Config: echConfig, PrivateKey: key.Bytes()},
+		},
+	}
+	return client, server
+}
+
+func TestECHHandshake(t *testing.T) {
+	clientConfig, serverConfig := echTestConfigs(t)
+	ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if !ss.ECHAccepted || !cs.ECHAccepted {
+		t.Errorf("ECH not accepted: server %v, client %v", ss.ECHAccepted, cs.ECHAccepted)
+	}
+	if ss.ServerName != "example.golang" || cs.ServerName != "example.golang" {
+		t.Errorf("unexpected server names: server %q, client %q", ss.ServerName, cs.ServerName)
+	}
+	if len(cs.VerifiedChains) == 0 {
+		t.Errorf("server certificate was not verified")
+	}
+}
+
+func TestECHHandshakeHelloRetryRequest(t *testing.T) {
+	clientConfig, serverConfig := echTestConfigs(t)
+	clientConfig.CurvePreferences = []CurveID{X25519, CurveP256}
+	serverConfig.CurvePreferences = []CurveID{CurveP256}
+	ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if !ss.ECHAccepted || !cs.ECHAccepted {
+		t.Errorf("ECH not accepted: server %v, client %v", ss.ECHAccepted, cs.ECHAccepted)
+	}
+	if cs.ServerName != "example.golang" {
+		t.Errorf("unexpected server name %q", cs.ServerName)
+	}
+}
+
+func TestECHHandshakeResumption(t *testing.T) {
+	clientConfig, serverConfig := echTestConfigs(t)
+	clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("resumption failed: %v", err)
+	}
+	if !ss.DidResume || !cs.DidResume {
+		t.Errorf("session was not resumed: server %v, client %v", ss.DidResume, cs.DidResume)
+	}
+	if !ss.ECHAccepted || !cs.ECHAccepted {
+		t.Errorf("ECH not accepted: server %v, client %v", ss.ECHAccepted, cs.ECHAccepted)
+	}
+}
+
+// echRejectionHandshake runs a handshake and returns the client error, which
+// testHandshake does not preserve.
+func echRejectionHandshake(t *testing.T, clientConfig, serverConfig *Config) error {
+	c, s := localPipe(t)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		defer s.Close()
+		Server(s, serverConfig).Handshake()
+	}()
+	defer func() { <-done }()
+	defer c.Close()
+	return Client(c, clientConfig).Handshake()
+}
+
+func TestECHRejected(t *testing.T) {
+	clientConfig, serverConfig := echTestConfigs(t)
+
+	// The server knows a different key, and advertises it for retries.
+	retryKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryConfig := marshalECHConfig(2, retryKey.PublicKey().Bytes(), "public.example", 32)
+	serverConfig.EncryptedClientHelloKeys = []EncryptedClientHelloKey{
+		{Config: retryConfig, PrivateKey: retryKey.Bytes(), SendAsRetry: true},
+	}
+
+	// The server certificate is not valid for the public name, so use the
+	// rejection callback to authenticate the client-facing server instead.
+	var rejectionServerName string
+	clientConfig.EncryptedClientHelloRejectionVerify = func(cs ConnectionState) error {
+		rejectionServerName = cs.ServerName
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificates")
+		}
+		return nil
+	}
+	clientConfig.VerifyConnection = func(ConnectionState) error {
+		return errors.New("VerifyConnection called on ECH rejection")
+	}
+
+	err = echRejectionHandshake(t, clientConfig, serverConfig)
+	var echErr *ECHRejectionError
+	if !errors.As(err, &echErr) {
+		t.Fatalf("expected ECHRejectionError, got %v", err)
+	}
+	if !bytes.Equal(echErr.RetryConfigList, marshalECHConfigList(retryConfig)) {
+		t.Errorf("unexpected retry configs: %x", echErr.RetryConfigList)
+	}
+	if rejectionServerName != "public.example" {
+		t.Errorf("rejection verified for server name %q, want %q", rejectionServerName, "public.example")
+	}
+
+	// Retrying with the configs provided by the server succeeds.
+	clientConfig.EncryptedClientHelloConfigList = echErr.RetryConfigList
+	clientConfig.EncryptedClientHelloRejectionVerify = nil
+	clientConfig.VerifyConnection = nil
+	ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("retry handshake failed: %v", err)
+	}
+	if !ss.ECHAccepted || !cs.ECHAccepted {
+		t.Errorf("ECH not accepted on retry: server %v, client %v", ss.ECHAccepted, cs.ECHAccepted)
+	}
+}
+
+func TestECHRejectedVerifiesPublicName(t *testing.T) {
+	clientConfig, serverConfig := echTestConfigs(t)
+	serverConfig.EncryptedClientHelloKeys = nil
+	// InsecureSkipVerify must not apply to the client-facing server.
+	clientConfig.InsecureSkipVerify = true
+
+	err := echRejectionHandshake(t, clientConfig, serverConfig)
+	if err == nil {
+		t.Fatal("handshake succeeded with a certificate invalid for the public name")
+	}
+	var echErr *ECHRejectionError
+	if errors.As(err, &echErr) {
+		t.Fatalf("unexpected ECHRejectionError: %v", err)
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"context"
 	"crypto"
 	"crypto/hmac"
+	"crypto/internal/mlkem768"
 	"crypto/rsa"
+	"crypto/subtle"
 	"errors"
 	"hash"
 	"sync/atomic"
@@ -17,15 +19,16 @@ import (
 )
 
 type clientHandshakeStateTLS13 struct {
-	c           *Conn
-	ctx         context.Context
-	serverHello *serverHelloMsg
-	hello       *clientHelloMsg
-	ecdheParams ecdheParameters
+	c            *Conn
+	ctx          context.Context
+	serverHello  *serverHelloMsg
+	hello        *clientHelloMsg
+	keyShareKeys *keySharePrivateKeys
 
-	session     *ClientSessionState
+	session     *SessionState
 	earlySecret []byte
 	binderKey   []byte
+	echContext  *echClientContext
 
 	certReq       *certificateRequestMsgTLS13
 	usingPSK      bool
@@ -36,8 +39,9 @@ type clientHandshakeStateTLS13 struct {
 	trafficSecret []byte // client_application_traffic_secret_0
 }
 
-// handshake requires hs.c, hs.hello, hs.serverHello, hs.ecdheParams, and,
-// optionally, hs.session, hs.earlySecret and hs.binderKey to be set.
+// handshake requires hs.c, hs.hello, hs.serverHello, hs.keyShareKeys, and,
+// optionally, hs.session, hs.earlySecret, hs.binderKey and hs.echContext to be
+// set.
 func (hs *clientHandshakeStateTLS13) handshake() error {
 	c := hs.c
 
@@ -49,7 +53,7 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 	}
 
 	// Consistency check on the presence of a keyShare and its parameters.
-	if hs.ecdheParams == nil || len(hs.hello.keyShares) != 1 {
+	if hs.keyShareKeys == nil || hs.keyShareKeys.ecdhe == nil || len(hs.hello.keyShares) == 0 {
 		return c.sendAlert(alertInternalError)
 	}
 
@@ -60,6 +64,11 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 	hs.transcript = hs.suite.hash.New()
 	hs.transcript.Write(hs.hello.marshal())
 
+	if hs.echContext != nil {
+		hs.echContext.innerTranscript = hs.suite.hash.New()
+		hs.echContext.innerTranscript.Write(hs.echContext.innerHello.marshal())
+	}
+
 	if bytes.Equal(hs.serverHello.random, helloRetryRequestRandom) {
 		if err := hs.sendDummyChangeCipherSpec(); err != nil {
 			return err
@@ -69,6 +78,12 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 		}
 	}
 
+	if hs.echContext != nil {
+		if err := hs.checkECHAcceptance(); err != nil {
+			return err
+		}
+	}
+
 	hs.transcript.Write(hs.serverHello.marshal())
 
 	c.buffering = true
@@ -100,11 +115,55 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 		return err
 	}
 
+	if hs.echContext != nil && hs.echContext.echRejected {
+		c.sendAlert(alertECHRequired)
+		return &ECHRejectionError{hs.echContext.retryConfigs}
+	}
+
 	atomic.StoreUint32(&c.handshakeStatus, 1)
 
 	return nil
 }
 
+// checkECHAcceptance checks the ServerHello for the signal that the server
+// accepted the ClientHelloInner, see RFC 9849, Section 6.1.4. If it did, the
+// handshake continues with the inner hello and transcript.
+func (hs *clientHandshakeStateTLS13) checkECHAcceptance() error {
+	c := hs.c
+
+	if c.didHRR && !c.echAccepted {
+		// A server that accepts ECH must signal so in the HelloRetryRequest.
+		hs.echContext.echRejected = true
+		return nil
+	}
+
+	confTranscript := cloneHash(hs.echContext.innerTranscript, hs.suite.hash)
+	if confTranscript == nil {
+		return c.sendAlert(alertInternalError)
+	}
+	serverHello := hs.serverHello.marshal()
+	confTranscript.Write(serverHello[:30])
+	confTranscript.Write(make([]byte, 8))
+	confTranscript.Write(serverHello[38:])
+	acceptConfirmation := hs.suite.echAcceptConfirmation(hs.echContext.innerHello.random,
+		echAcceptConfirmationLabel, confTranscript)
+	if subtle.ConstantTimeCompare(acceptConfirmation, hs.serverHello.random[24:]) != 1 {
+		if c.echAccepted {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server accepted encrypted client hello in HelloRetryRequest but not in ServerHello")
+		}
+		hs.echContext.echRejected = true
+		return nil
+	}
+
+	hs.hello = hs.echContext.innerHello
+	hs.transcript = hs.echContext.innerTranscript
+	c.serverName = hs.hello.serverName
+	c.echAccepted = true
+
+	return nil
+}
+
 // checkServerHelloOrHRR does validity checks that apply to both ServerHello and
 // HelloRetryRequest messages. It sets hs.suite.
 func (hs *clientHandshakeStateTLS13) checkServerHelloOrHRR() error {
@@ -163,6 +222,9 @@ func (hs *clientHandshakeStateTLS13) checkServerHelloOrHRR() error {
 // sendDummyChangeCipherSpec sends a ChangeCipherSpec record for compatibility
 // with middleboxes that didn't implement TLS correctly. See RFC 8446, Appendix D.4.
 func (hs *clientHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
+	if hs.c.quic != nil {
+		return nil
+	}
 	if hs.sentDummyCCS {
 		return nil
 	}
@@ -176,6 +238,7 @@ func (hs *clientHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
 // resends hs.hello, and reads the new ServerHello into hs.serverHello.
 func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 	c := hs.c
+	c.didHRR = true
 
 	// The first ClientHello gets double-hashed into the transcript upon a
 	// HelloRetryRequest. (The idea is that the server might offload transcript
@@ -186,6 +249,45 @@ func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 	hs.transcript.Write(chHash)
 	hs.transcript.Write(hs.serverHello.marshal())
 
+	// If the server accepted the ClientHelloInner, it is the hello that gets
+	// modified and sent again, encrypted in a new ClientHelloOuter.
+	hello := hs.hello
+	isInnerHello := false
+	if hs.echContext != nil {
+		chHash = hs.echContext.innerTranscript.Sum(nil)
+		hs.echContext.innerTranscript.Reset()
+		hs.echContext.innerTranscript.Write([]byte{typeMessageHash, 0, 0, uint8(len(chHash))})
+		hs.echContext.innerTranscript.Write(chHash)
+
+		if hs.serverHello.encryptedClientHello != nil {
+			if len(hs.serverHello.encryptedClientHello) != 8 {
+				c.sendAlert(alertDecodeError)
+				return errors.New("tls: malformed encrypted_client_hello extension")
+			}
+
+			confTranscript := cloneHash(hs.echContext.innerTranscript, hs.suite.hash)
+			if confTranscript == nil {
+				return c.sendAlert(alertInternalError)
+			}
+			// The signal is computed with the extension value set to zeros.
+			hrr := append([]byte(nil), hs.serverHello.marshal()...)
+			hrr = bytes.Replace(hrr, hs.serverHello.encryptedClientHello, make([]byte, 8), 1)
+			confTranscript.Write(hrr)
+			acceptConfirmation := hs.suite.echAcceptConfirmation(hs.echContext.innerHello.random,
+				echHRRAcceptConfirmationLabel, confTranscript)
+			if subtle.ConstantTimeCompare(acceptConfirmation, hs.serverHello.encryptedClientHello) == 1 {
+				hello = hs.echContext.innerHello
+				isInnerHello = true
+				c.echAccepted = true
+			}
+		}
+
+		hs.echContext.innerTranscript.Write(hs.serverHello.marshal())
+	} else if hs.serverHello.encryptedClientHello != nil {
+		c.sendAlert(alertUnsupportedExtension)
+		return errors.New("tls: server sent an unexpected encrypted_client_hello extension")
+	}
+
 	// The only HelloRetryRequest extensions we support are key_share and
 	// cookie, and clients must abort the handshake if the HRR would not result
 	// in any change in the ClientHello.
@@ -195,7 +297,7 @@ func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 	}
 
 	if hs.serverHello.cookie != nil {
-		hs.hello.cookie = hs.serverHello.cookie
+		hello.cookie = hs.serverHello.cookie
 	}
 
 	if hs.serverHello.serverShare.group != 0 {
@@ -208,7 +310,7 @@ func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 	// share for it this time.
 	if curveID := hs.serverHello.selectedGroup; curveID != 0 {
 		curveOK := false
-		for _, id := range hs.hello.supportedCurves {
+		for _, id := range hello.supportedCurves {
 			if id == curveID {
 				curveOK = true
 				break
@@ -218,45 +320,68 @@ func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 			c.sendAlert(alertIllegalParameter)
 			return errors.New("tls: server selected unsupported group")
 		}
-		if hs.ecdheParams.CurveID() == curveID {
-			c.sendAlert(alertIllegalParameter)
-			return errors.New("tls: server sent an unnecessary HelloRetryRequest key_share")
+		for _, ks := range hello.keyShares {
+			if ks.group == curveID {
+				c.sendAlert(alertIllegalParameter)
+				return errors.New("tls: server sent an unnecessary HelloRetryRequest key_share")
+			}
 		}
-		if _, ok := curveForCurveID(curveID); curveID != X25519 && !ok {
+		if _, ok := curveForCurveID(curveID); !ok && curveID != X25519MLKEM768 {
 			c.sendAlert(alertInternalError)
 			return errors.New("tls: CurvePreferences includes unsupported curve")
 		}
-		params, err := generateECDHEParameters(c.config.rand(), curveID)
+		keyShareKeys, data, err := generateKeyShare(c.config.rand(), curveID)
 		if err != nil {
 			c.sendAlert(alertInternalError)
 			return err
 		}
-		hs.ecdheParams = params
-		hs.hello.keyShares = []keyShare{{group: curveID, data: params.PublicKey()}}
+		hs.keyShareKeys = keyShareKeys
+		hello.keyShares = []keyShare{{group: curveID, data: data}}
+	}
+
+	// A HelloRetryRequest rejects early data, and the second ClientHello
+	// must not offer it again. See RFC 8446, Section 4.2.10.
+	if hello.earlyData {
+		hello.earlyData = false
+		hs.hello.earlyData = false
+		c.quicRejectedEarlyData()
 	}
 
-	hs.hello.raw = nil
-	if len(hs.hello.pskIdentities) > 0 {
+	hello.raw = nil
+	if len(hello.pskIdentities) > 0 {
 		pskSuite := cipherSuiteTLS13ByID(hs.session.cipherSuite)
 		if pskSuite == nil {
 			return c.sendAlert(alertInternalError)
 		}
 		if pskSuite.hash == hs.suite.hash {
 			// Update binders and obfuscated_ticket_age.
-			ticketAge := uint32(c.config.time().Sub(hs.session.receivedAt) / time.Millisecond)
-			hs.hello.pskIdentities[0].obfuscatedTicketAge = ticketAge + hs.session.ageAdd
+			ticketAge := uint32(c.config.time().Sub(time.Unix(int64(hs.session.createdAt), 0)) / time.Millisecond)
+			hello.pskIdentities[0].obfuscatedTicketAge = ticketAge + hs.session.ageAdd
 
 			transcript := hs.suite.hash.New()
 			transcript.Write([]byte{typeMessageHash, 0, 0, uint8(len(chHash))})
 			transcript.Write(chHash)
 			transcript.Write(hs.serverHello.marshal())
-			transcript.Write(hs.hello.marshalWithoutBinders())
+			transcript.Write(hello.marshalWithoutBinders())
 			pskBinders := [][]byte{hs.suite.finishedHash(hs.binderKey, transcript)}
-			hs.hello.updateBinders(pskBinders)
+			hello.updateBinders(pskBinders)
 		} else {
 			// Server selected a cipher suite incompatible with the PSK.
-			hs.hello.pskIdentities = nil
-			hs.hello.pskBinders = nil
+			hello.pskIdentities = nil
+			hello.pskBinders = nil
+		}
+	}
+
+	if isInnerHello {
+		// The extensions that may have changed are compressed in the outer
+		// hello, so they must be updated there too for the server to
+		// reconstruct the inner hello.
+		hs.hello.cookie = hello.cookie
+		hs.hello.keyShares = hello.keyShares
+		hs.echContext.innerTranscript.Write(hello.marshal())
+		if err := computeAndUpdateOuterECHExtension(hs.hello, hello, hs.echContext, false); err != nil {
+			c.sendAlert(alertInternalError)
+			return err
 		}
 	}
 
@@ -306,10 +431,18 @@ func (hs *clientHandshakeStateTLS13) processServerHello() error {
 		c.sendAlert(alertIllegalParameter)
 		return errors.New("tls: server did not send a key share")
 	}
-	if hs.serverHello.serverShare.group != hs.ecdheParams.CurveID() {
+	sentShare := false
+	for _, ks := range hs.hello.keyShares {
+		if ks.group == hs.serverHello.serverShare.group {
+			sentShare = true
+			break
+		}
+	}
+	if !sentShare {
 		c.sendAlert(alertIllegalParameter)
 		return errors.New("tls: server selected unsupported group")
 	}
+	c.curveID = hs.serverHello.serverShare.group
 
 	if !hs.serverHello.selectedIdentityPresent {
 		return nil
@@ -334,7 +467,7 @@ func (hs *clientHandshakeStateTLS13) processServerHello() error {
 
 	hs.usingPSK = true
 	c.didResume = true
-	c.peerCertificates = hs.session.serverCertificates
+	c.peerCertificates = hs.session.peerCertificates
 	c.verifiedChains = hs.session.verifiedChains
 	c.ocspResponse = hs.session.ocspResponse
 	c.scts = hs.session.scts
@@ -344,11 +477,39 @@ func (hs *clientHandshakeStateTLS13) processServerHello() error {
 func (hs *clientHandshakeStateTLS13) establishHandshakeKeys() error {
 	c := hs.c
 
-	sharedKey := hs.ecdheParams.SharedKey(hs.serverHello.serverShare.data)
-	if sharedKey == nil {
+	// For X25519MLKEM768, the server key share is the ML-KEM ciphertext
+	// followed by the X25519 public key, according to
+	// draft-kwiatkowski-tls-ecdhe-mlkem-02, Section 4.1.3.
+	ecdhePeerData := hs.serverHello.serverShare.data
+	if hs.serverHello.serverShare.group == X25519MLKEM768 {
+		if len(ecdhePeerData) != mlkem768.CiphertextSize+x25519PublicKeySize {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: invalid server X25519MLKEM768 key share")
+		}
+		ecdhePeerData = ecdhePeerData[mlkem768.CiphertextSize:]
+	}
+	peerKey, err := hs.keyShareKeys.ecdhe.Curve().NewPublicKey(ecdhePeerData)
+	if err != nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid server key share")
+	}
+	sharedKey, err := hs.keyShareKeys.ecdhe.ECDH(peerKey)
+	if err != nil {
 		c.sendAlert(alertIllegalParameter)
 		return errors.New("tls: invalid server key share")
 	}
+	if hs.serverHello.serverShare.group == X25519MLKEM768 {
+		if hs.keyShareKeys.mlkem == nil {
+			return c.sendAlert(alertInternalError)
+		}
+		ciphertext := hs.serverHello.serverShare.data[:mlkem768.CiphertextSize]
+		mlkemShared, err := mlkem768.Decapsulate(hs.keyShareKeys.mlkem, ciphertext)
+		if err != nil {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: invalid server X25519MLKEM768 key share")
+		}
+		sharedKey = append(mlkemShared, sharedKey...)
+	}
 
 	earlySecret := hs.earlySecret
 	if !hs.usingPSK {
@@ -359,12 +520,20 @@ func (hs *clientHandshakeStateTLS13) establishHandshakeKeys() error {
 
 	clientSecret := hs.suite.deriveSecret(handshakeSecret,
 		clientHandshakeTrafficLabel, hs.transcript)
-	c.out.setTrafficSecret(hs.suite, clientSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, clientSecret)
 	serverSecret := hs.suite.deriveSecret(handshakeSecret,
 		serverHandshakeTrafficLabel, hs.transcript)
-	c.in.setTrafficSecret(hs.suite, serverSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelHandshake, hs.suite.id, clientSecret)
+		c.quicSetReadSecret(QUICEncryptionLevelHandshake, hs.suite.id, serverSecret)
+	}
 
-	err := c.config.writeKeyLog(keyLogLabelClientHandshake, hs.hello.random, clientSecret)
+	err = c.config.writeKeyLog(keyLogLabelClientHandshake, hs.hello.random, clientSecret)
 	if err != nil {
 		c.sendAlert(alertInternalError)
 		return err
@@ -396,12 +565,55 @@ func (hs *clientHandshakeStateTLS13) readServerParameters() error {
 	}
 	hs.transcript.Write(encryptedExtensions.marshal())
 
-	if err := checkALPN(hs.hello.alpnProtocols, encryptedExtensions.alpnProtocol); err != nil {
-		c.sendAlert(alertUnsupportedExtension)
+	if err := checkALPN(hs.hello.alpnProtocols, encryptedExtensions.alpnProtocol, c.quic != nil); err != nil {
+		if c.quic != nil {
+			// RFC 9001, Section 8.1
+			c.sendAlert(alertNoApplicationProtocol)
+		} else {
+			c.sendAlert(alertUnsupportedExtension)
+		}
 		return err
 	}
 	c.clientProtocol = encryptedExtensions.alpnProtocol
 
+	if encryptedExtensions.earlyData {
+		if !hs.hello.earlyData || !hs.usingPSK {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: server sent an unexpected early_data extension")
+		}
+		if hs.session.cipherSuite != c.cipherSuite {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server accepted 0-RTT with the wrong cipher suite")
+		}
+		if hs.session.alpnProtocol != c.clientProtocol {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server accepted 0-RTT with the wrong ALPN protocol")
+		}
+	} else if hs.hello.earlyData {
+		c.quicRejectedEarlyData()
+	}
+
+	if hs.echContext != nil && hs.echContext.echRejected {
+		hs.echContext.retryConfigs = encryptedExtensions.echRetryConfigs
+	} else if encryptedExtensions.echRetryConfigs != nil {
+		c.sendAlert(alertUnsupportedExtension)
+		return errors.New("tls: server sent unexpected encrypted client hello retry configs")
+	}
+
+	if c.quic != nil {
+		if encryptedExtensions.quicTransportParameters == nil {
+			// RFC 9001 Section 8.2.
+			c.sendAlert(alertMissingExtension)
+			return errors.New("tls: server did not send a quic_transport_parameters extension")
+		}
+		c.quicSetTransportParameters(encryptedExtensions.quicTransportParameters)
+	} else {
+		if encryptedExtensions.quicTransportParameters != nil {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: server sent an unexpected quic_transport_parameters extension")
+		}
+	}
+
 	return nil
 }
 
@@ -522,7 +734,7 @@ func (hs *clientHandshakeStateTLS13) readServerFinished() error {
 		clientApplicationTrafficLabel, hs.transcript)
 	serverSecret := hs.suite.deriveSecret(hs.masterSecret,
 		serverApplicationTrafficLabel, hs.transcript)
-	c.in.setTrafficSecret(hs.suite, serverSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, serverSecret)
 
 	err = c.config.writeKeyLog(keyLogLabelClientTraffic, hs.hello.random, hs.trafficSecret)
 	if err != nil {
@@ -547,6 +759,15 @@ func (hs *clientHandshakeStateTLS13) sendClientCertificate() error {
 		return nil
 	}
 
+	// Never send a client certificate to a server that rejected ECH, as it
+	// was not authenticated as the intended server.
+	if hs.echContext != nil && hs.echContext.echRejected {
+		certMsg := new(certificateMsgTLS13)
+		hs.transcript.Write(certMsg.marshal())
+		_, err := c.writeRecord(recordTypeHandshake, certMsg.marshal())
+		return err
+	}
+
 	cert, err := c.getClientCertificate(&CertificateRequestInfo{
 		AcceptableCAs:    hs.certReq.certificateAuthorities,
 		SignatureSchemes: hs.certReq.supportedSignatureAlgorithms,
@@ -621,13 +842,20 @@ func (hs *clientHandshakeStateTLS13) sendClientFinished() error {
 		return err
 	}
 
-	c.out.setTrafficSecret(hs.suite, hs.trafficSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, hs.trafficSecret)
 
 	if !c.config.SessionTicketsDisabled && c.config.ClientSessionCache != nil {
 		c.resumptionSecret = hs.suite.deriveSecret(hs.masterSecret,
 			resumptionLabel, hs.transcript)
 	}
 
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelApplication, hs.suite.id, hs.trafficSecret)
+	}
+
 	return nil
 }
 
@@ -637,6 +865,12 @@ func (c *Conn) handleNewSessionTicket(msg *newSessionTicketMsgTLS13) error {
 		return errors.New("tls: received new session ticket from a client")
 	}
 
+	if c.quic != nil && msg.maxEarlyData != 0 && msg.maxEarlyData != 0xffffffff {
+		// RFC 9001, Section 4.6.1
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent a session ticket with an invalid max_early_data_size for QUIC")
+	}
+
 	if c.config.SessionTicketsDisabled || c.config.ClientSessionCache == nil {
 		return nil
 	}
@@ -660,23 +894,17 @@ func (c *Conn) handleNewSessionTicket(msg *newSessionTicketMsgTLS13) error {
 	// to do the least amount of work on NewSessionTicket messages before we
 	// know if the ticket will be used. Forward secrecy of resumed connections
 	// is guaranteed by the requirement for pskModeDHE.
-	session := &ClientSessionState{
-		sessionTicket:      msg.label,
-		vers:               c.vers,
-		cipherSuite:        c.cipherSuite,
-		masterSecret:       c.resumptionSecret,
-		serverCertificates: c.peerCertificates,
-		verifiedChains:     c.verifiedChains,
-		receivedAt:         c.config.time(),
-		nonce:              msg.nonce,
-		useBy:              c.config.time().Add(lifetime),
-		ageAdd:             msg.ageAdd,
-		ocspResponse:       c.ocspResponse,
-		scts:               c.scts,
-	}
-
-	cacheKey := clientSessionCacheKey(c.conn.RemoteAddr(), c.config)
-	c.config.ClientSessionCache.Put(cacheKey, session)
+	session := c.sessionState()
+	session.secret = c.resumptionSecret
+	session.useBy = uint64(c.config.time().Add(lifetime).Unix())
+	session.ageAdd = msg.ageAdd
+	session.nonce = msg.nonce
+	session.EarlyData = c.quic != nil && msg.maxEarlyData == 0xffffffff
+	cs := &ClientSessionState{ticket: msg.label, session: session}
+
+	if cacheKey := c.clientSessionCacheKey(); cacheKey != "" {
+		c.config.ClientSessionCache.Put(cacheKey, cs)
+	}
 
 	return nil
 }
@@ -92,6 +92,8 @@ type clientHelloMsg struct {
 	pskModes                         []uint8
 	pskIdentities                    []pskIdentity
 	pskBinders                       [][]byte
+	quicTransportParameters          []byte
+	encryptedClientHello             []byte
 }
 
 func (m *clientHelloMsg) marshal() []byte {
@@ -99,13 +101,26 @@ func (m *clientHelloMsg) marshal() []byte {
 		return m.raw
 	}
 
+	m.raw = m.marshalMsg(false)
+	return m.raw
+}
+
+// marshalMsg marshals m. If echInner is true, it returns the
+// EncodedClientHelloInner form of m instead, as defined in RFC 9849,
+// Section 5.1, which omits the legacy session ID and the TLS 1.2-only
+// extensions, and replaces the extensions that are also present in the outer
+// ClientHello with an ech_outer_extensions extension. The result in that case
+// is not cached in m.raw.
+func (m *clientHelloMsg) marshalMsg(echInner bool) []byte {
 	var b cryptobyte.Builder
 	b.AddUint8(typeClientHello)
 	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
 		b.AddUint16(m.vers)
 		addBytesWithLength(b, m.random, 32)
 		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
-			b.AddBytes(m.sessionId)
+			if !echInner {
+				b.AddBytes(m.sessionId)
+			}
 		})
 		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
 			for _, suite := range m.cipherSuites {
@@ -133,27 +148,41 @@ func (m *clientHelloMsg) marshal() []byte {
 					})
 				})
 			}
+			// The extensions from status_request to psk_key_exchange_modes are
+			// compressed in the EncodedClientHelloInner. They must be
+			// contiguous once the TLS 1.2-only extensions are left out, so
+			// that the ClientHelloInner reconstructed by the server matches
+			// the one in the client transcript.
+			var echOuterExts []uint16
 			if m.ocspStapling {
 				// RFC 4366, Section 3.6
-				b.AddUint16(extensionStatusRequest)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-					b.AddUint8(1)  // status_type = ocsp
-					b.AddUint16(0) // empty responder_id_list
-					b.AddUint16(0) // empty request_extensions
-				})
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionStatusRequest)
+				} else {
+					b.AddUint16(extensionStatusRequest)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(1)  // status_type = ocsp
+						b.AddUint16(0) // empty responder_id_list
+						b.AddUint16(0) // empty request_extensions
+					})
+				}
 			}
 			if len(m.supportedCurves) > 0 {
 				// RFC 4492, sections 5.1.1 and RFC 8446, Section 4.2.7
-				b.AddUint16(extensionSupportedCurves)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionSupportedCurves)
+				} else {
+					b.AddUint16(extensionSupportedCurves)
 					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-						for _, curve := range m.supportedCurves {
-							b.AddUint16(uint16(curve))
-						}
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							for _, curve := range m.supportedCurves {
+								b.AddUint16(uint16(curve))
+							}
+						})
 					})
-				})
+				}
 			}
-			if len(m.supportedPoints) > 0 {
+			if len(m.supportedPoints) > 0 && !echInner {
 				// RFC 4492, Section 5.1.2
 				b.AddUint16(extensionSupportedPoints)
 				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
@@ -162,7 +191,7 @@ func (m *clientHelloMsg) marshal() []byte {
 					})
 				})
 			}
-			if m.ticketSupported {
+			if m.ticketSupported && !echInner {
 				// RFC 5077, Section 3.2
 				b.AddUint16(extensionSessionTicket)
 				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
@@ -171,27 +200,35 @@ func (m *clientHelloMsg) marshal() []byte {
 			}
 			if len(m.supportedSignatureAlgorithms) > 0 {
 				// RFC 5246, Section 7.4.1.4.1
-				b.AddUint16(extensionSignatureAlgorithms)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionSignatureAlgorithms)
+				} else {
+					b.AddUint16(extensionSignatureAlgorithms)
 					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-						for _, sigAlgo := range m.supportedSignatureAlgorithms {
-							b.AddUint16(uint16(sigAlgo))
-						}
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							for _, sigAlgo := range m.supportedSignatureAlgorithms {
+								b.AddUint16(uint16(sigAlgo))
+							}
+						})
 					})
-				})
+				}
 			}
 			if len(m.supportedSignatureAlgorithmsCert) > 0 {
 				// RFC 8446, Section 4.2.3
-				b.AddUint16(extensionSignatureAlgorithmsCert)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionSignatureAlgorithmsCert)
+				} else {
+					b.AddUint16(extensionSignatureAlgorithmsCert)
 					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-						for _, sigAlgo := range m.supportedSignatureAlgorithmsCert {
-							b.AddUint16(uint16(sigAlgo))
-						}
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							for _, sigAlgo := range m.supportedSignatureAlgorithmsCert {
+								b.AddUint16(uint16(sigAlgo))
+							}
+						})
 					})
-				})
+				}
 			}
-			if m.secureRenegotiationSupported {
+			if m.secureRenegotiationSupported && !echInner {
 				// RFC 5746, Section 3.2
 				b.AddUint16(extensionRenegotiationInfo)
 				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
@@ -202,70 +239,127 @@ func (m *clientHelloMsg) marshal() []byte {
 			}
 			if len(m.alpnProtocols) > 0 {
 				// RFC 7301, Section 3.1
-				b.AddUint16(extensionALPN)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionALPN)
+				} else {
+					b.AddUint16(extensionALPN)
 					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-						for _, proto := range m.alpnProtocols {
-							b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
-								b.AddBytes([]byte(proto))
-							})
-						}
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							for _, proto := range m.alpnProtocols {
+								b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+									b.AddBytes([]byte(proto))
+								})
+							}
+						})
 					})
-				})
+				}
 			}
 			if m.scts {
 				// RFC 6962, Section 3.3.1
-				b.AddUint16(extensionSCT)
-				b.AddUint16(0) // empty extension_data
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionSCT)
+				} else {
+					b.AddUint16(extensionSCT)
+					b.AddUint16(0) // empty extension_data
+				}
 			}
 			if len(m.supportedVersions) > 0 {
 				// RFC 8446, Section 4.2.1
-				b.AddUint16(extensionSupportedVersions)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
-						for _, vers := range m.supportedVersions {
-							b.AddUint16(vers)
-						}
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionSupportedVersions)
+				} else {
+					b.AddUint16(extensionSupportedVersions)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+							for _, vers := range m.supportedVersions {
+								b.AddUint16(vers)
+							}
+						})
 					})
-				})
+				}
 			}
 			if len(m.cookie) > 0 {
 				// RFC 8446, Section 4.2.2
-				b.AddUint16(extensionCookie)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionCookie)
+				} else {
+					b.AddUint16(extensionCookie)
 					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-						b.AddBytes(m.cookie)
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddBytes(m.cookie)
+						})
 					})
-				})
+				}
 			}
 			if len(m.keyShares) > 0 {
 				// RFC 8446, Section 4.2.8
-				b.AddUint16(extensionKeyShare)
-				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionKeyShare)
+				} else {
+					b.AddUint16(extensionKeyShare)
 					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-						for _, ks := range m.keyShares {
-							b.AddUint16(uint16(ks.group))
-							b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-								b.AddBytes(ks.data)
-							})
-						}
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							for _, ks := range m.keyShares {
+								b.AddUint16(uint16(ks.group))
+								b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+									b.AddBytes(ks.data)
+								})
+							}
+						})
 					})
-				})
+				}
 			}
 			if m.earlyData {
 				// RFC 8446, Section 4.2.10
-				b.AddUint16(extensionEarlyData)
-				b.AddUint16(0) // empty extension_data
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionEarlyData)
+				} else {
+					b.AddUint16(extensionEarlyData)
+					b.AddUint16(0) // empty extension_data
+				}
+			}
+			if m.quicTransportParameters != nil { // marshal zero-length parameters when present
+				// RFC 9001, Section 8.2
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionQUICTransportParameters)
+				} else {
+					b.AddUint16(extensionQUICTransportParameters)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddBytes(m.quicTransportParameters)
+					})
+				}
 			}
 			if len(m.pskModes) > 0 {
 				// RFC 8446, Section 4.2.9
-				b.AddUint16(extensionPSKModes)
+				if echInner {
+					echOuterExts = append(echOuterExts, extensionPSKModes)
+				} else {
+					b.AddUint16(extensionPSKModes)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddBytes(m.pskModes)
+						})
+					})
+				}
+			}
+			if len(echOuterExts) > 0 {
+				// RFC 9849, Section 5.1
+				b.AddUint16(extensionECHOuterExtensions)
 				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
 					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
-						b.AddBytes(m.pskModes)
+						for _, e := range echOuterExts {
+							b.AddUint16(e)
+						}
 					})
 				})
 			}
+			if len(m.encryptedClientHello) > 0 {
+				// RFC 9849, Section 5
+				b.AddUint16(extensionEncryptedClientHello)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes(m.encryptedClientHello)
+				})
+			}
 			if len(m.pskIdentities) > 0 { // pre_shared_key must be the last extension
 				// RFC 8446, Section 4.2.11
 				b.AddUint16(extensionPreSharedKey)
@@ -296,8 +390,7 @@ func (m *clientHelloMsg) marshal() []byte {
 		}
 	})
 
-	m.raw = b.BytesOrPanic()
-	return m.raw
+	return b.BytesOrPanic()
 }
 
 // marshalWithoutBinders returns the ClientHello through the
@@ -546,6 +639,17 @@ func (m *clientHelloMsg) unmarshal(data []byte) bool {
 			if !readUint8LengthPrefixed(&extData, &m.pskModes) {
 				return false
 			}
+		case extensionQUICTransportParameters:
+			// RFC 9001, Section 8.2
+			m.quicTransportParameters = make([]byte, len(extData))
+			if !extData.CopyBytes(m.quicTransportParameters) {
+				return false
+			}
+		case extensionEncryptedClientHello:
+			// RFC 9849, Section 5
+			if !extData.ReadBytes(&m.encryptedClientHello, len(extData)) {
+				return false
+			}
 		case extensionPreSharedKey:
 			// RFC 8446, Section 4.2.11
 			if !extensions.Empty() {
@@ -589,6 +693,41 @@ func (m *clientHelloMsg) unmarshal(data []byte) bool {
 	return true
 }
 
+// clone returns a deep copy of m, without the cached marshaled
+// representation.
+func (m *clientHelloMsg) clone() *clientHelloMsg {
+	c := *m
+	c.raw = nil
+	c.random = cloneBytes(m.random)
+	c.sessionId = cloneBytes(m.sessionId)
+	c.cipherSuites = append([]uint16(nil), m.cipherSuites...)
+	c.compressionMethods = cloneBytes(m.compressionMethods)
+	c.supportedCurves = append([]CurveID(nil), m.supportedCurves...)
+	c.supportedPoints = cloneBytes(m.supportedPoints)
+	c.sessionTicket = cloneBytes(m.sessionTicket)
+	c.supportedSignatureAlgorithms = append([]SignatureScheme(nil), m.supportedSignatureAlgorithms...)
+	c.supportedSignatureAlgorithmsCert = append([]SignatureScheme(nil), m.supportedSignatureAlgorithmsCert...)
+	c.secureRenegotiation = cloneBytes(m.secureRenegotiation)
+	c.alpnProtocols = append([]string(nil), m.alpnProtocols...)
+	c.supportedVersions = append([]uint16(nil), m.supportedVersions...)
+	c.cookie = cloneBytes(m.cookie)
+	c.keyShares = append([]keyShare(nil), m.keyShares...)
+	c.pskModes = cloneBytes(m.pskModes)
+	c.pskIdentities = append([]pskIdentity(nil), m.pskIdentities...)
+	c.pskBinders = append([][]byte(nil), m.pskBinders...)
+	c.quicTransportParameters = cloneBytes(m.quicTransportParameters)
+	c.encryptedClientHello = cloneBytes(m.encryptedClientHello)
+	return &c
+}
+
+// cloneBytes returns a copy of b, preserving whether it is nil.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
 type serverHelloMsg struct {
 	raw                          []byte
 	vers                         uint16
@@ -611,6 +750,10 @@ type serverHelloMsg struct {
 	// HelloRetryRequest extensions
 	cookie        []byte
 	selectedGroup CurveID
+
+	// encryptedClientHello is the ECH acceptance confirmation, which is only
+	// sent in a HelloRetryRequest. See RFC 9849, Section 7.2.1.
+	encryptedClientHello []byte
 }
 
 func (m *serverHelloMsg) marshal() []byte {
@@ -708,6 +851,12 @@ func (m *serverHelloMsg) marshal() []byte {
 					b.AddUint16(uint16(m.selectedGroup))
 				})
 			}
+			if len(m.encryptedClientHello) > 0 {
+				b.AddUint16(extensionEncryptedClientHello)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes(m.encryptedClientHello)
+				})
+			}
 			if len(m.supportedPoints) > 0 {
 				b.AddUint16(extensionSupportedPoints)
 				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
@@ -820,6 +969,10 @@ func (m *serverHelloMsg) unmarshal(data []byte) bool {
 			if !extData.ReadUint16(&m.selectedIdentity) {
 				return false
 			}
+		case extensionEncryptedClientHello:
+			if !extData.ReadBytes(&m.encryptedClientHello, len(extData)) {
+				return false
+			}
 		case extensionSupportedPoints:
 			// RFC 4492, Section 5.1.2
 			if !readUint8LengthPrefixed(&extData, &m.supportedPoints) ||
@@ -840,8 +993,11 @@ func (m *serverHelloMsg) unmarshal(data []byte) bool {
 }
 
 type encryptedExtensionsMsg struct {
-	raw          []byte
-	alpnProtocol string
+	raw                     []byte
+	alpnProtocol            string
+	quicTransportParameters []byte
+	echRetryConfigs         []byte
+	earlyData               bool
 }
 
 func (m *encryptedExtensionsMsg) marshal() []byte {
@@ -863,6 +1019,25 @@ func (m *encryptedExtensionsMsg) marshal() []byte {
 					})
 				})
 			}
+			if m.quicTransportParameters != nil { // marshal zero-length parameters when present
+				// RFC 9001, Section 8.2
+				b.AddUint16(extensionQUICTransportParameters)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes(m.quicTransportParameters)
+				})
+			}
+			if len(m.echRetryConfigs) > 0 {
+				// RFC 9849, Section 5
+				b.AddUint16(extensionEncryptedClientHello)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes(m.echRetryConfigs)
+				})
+			}
+			if m.earlyData {
+				// RFC 8446, Section 4.2.10
+				b.AddUint16(extensionEarlyData)
+				b.AddUint16(0) // empty extension_data
+			}
 		})
 	})
 
@@ -900,6 +1075,18 @@ func (m *encryptedExtensionsMsg) unmarshal(data []byte) bool {
 				return false
 			}
 			m.alpnProtocol = string(proto)
+		case extensionQUICTransportParameters:
+			m.quicTransportParameters = make([]byte, len(extData))
+			if !extData.CopyBytes(m.quicTransportParameters) {
+				return false
+			}
+		case extensionEncryptedClientHello:
+			if !extData.ReadBytes(&m.echRetryConfigs, len(extData)) {
+				return false
+			}
+		case extensionEarlyData:
+			// RFC 8446, Section 4.2.10
+			m.earlyData = true
 		default:
 			// Ignore unknown extensions.
 			continue
@@ -9,6 +9,8 @@ import (
 	"context"
 	"crypto"
 	"crypto/hmac"
+	"crypto/hpke"
+	"crypto/internal/mlkem768"
 	"crypto/rsa"
 	"errors"
 	"hash"
@@ -29,6 +31,7 @@ type serverHandshakeStateTLS13 struct {
 	hello           *serverHelloMsg
 	sentDummyCCS    bool
 	usingPSK        bool
+	earlyData       bool
 	suite           *cipherSuiteTLS13
 	cert            *Certificate
 	sigAlg          SignatureScheme
@@ -39,6 +42,19 @@ type serverHandshakeStateTLS13 struct {
 	trafficSecret   []byte // client_application_traffic_secret_0
 	transcript      hash.Hash
 	clientFinished  []byte
+	echContext      *echServerContext
+}
+
+// echServerContext holds the server state of an Encrypted Client Hello
+// handshake, needed to decrypt the second ClientHello after a
+// HelloRetryRequest and to signal acceptance.
+type echServerContext struct {
+	hpkeContext *hpke.Recipient
+	configID    uint8
+	ciphersuite echCipher
+	// inner is set if the ClientHello was itself a ClientHelloInner, sent by
+	// a client-facing server that decrypted it.
+	inner bool
 }
 
 func (hs *serverHandshakeStateTLS13) handshake() error {
@@ -135,13 +151,16 @@ func (hs *serverHandshakeStateTLS13) processClientHello() error {
 		return errors.New("tls: initial handshake had non-empty renegotiation extension")
 	}
 
-	if hs.clientHello.earlyData {
+	if hs.clientHello.earlyData && c.quic == nil {
 		// See RFC 8446, Section 4.2.10 for the complicated behavior required
 		// here. The scenario is that a different server at our address offered
 		// to accept early data in the past, which we can't handle. For now, all
 		// 0-RTT enabled session tickets need to expire before a Go server can
 		// replace a server or join a pool. That's the same requirement that
 		// applies to mixing or replacing with any TLS 1.2 server.
+		//
+		// QUIC servers can instead accept or ignore 0-RTT in checkForResumption,
+		// since rejected early data is discarded by the transport.
 		c.sendAlert(alertUnsupportedExtension)
 		return errors.New("tls: client sent unexpected early data")
 	}
@@ -149,6 +168,25 @@ func (hs *serverHandshakeStateTLS13) processClientHello() error {
 	hs.hello.sessionId = hs.clientHello.sessionId
 	hs.hello.compressionMethod = compressionNone
 
+	if c.quic != nil {
+		if len(hs.clientHello.sessionId) != 0 {
+			// RFC 9001, Section 8.4
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: client sent a non-empty legacy_session_id in a QUIC ClientHello")
+		}
+		if hs.clientHello.quicTransportParameters == nil {
+			// RFC 9001, Section 8.2
+			c.sendAlert(alertMissingExtension)
+			return errors.New("tls: client did not send a quic_transport_parameters extension")
+		}
+		c.quicSetTransportParameters(hs.clientHello.quicTransportParameters)
+	} else {
+		if hs.clientHello.quicTransportParameters != nil {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: client sent an unexpected quic_transport_parameters extension")
+		}
+	}
+
 	preferenceList := defaultCipherSuitesTLS13
 	if !hasAESGCMHardwareSupport || !aesgcmPreferred(hs.clientHello.cipherSuites) {
 		preferenceList = defaultCipherSuitesTLS13NoAES
@@ -172,7 +210,7 @@ func (hs *serverHandshakeStateTLS13) processClientHello() error {
 	var selectedGroup CurveID
 	var clientKeyShare *keyShare
 GroupSelection:
-	for _, preferredGroup := range c.config.curvePreferences() {
+	for _, preferredGroup := range c.config.curvePreferences(c.vers) {
 		for _, ks := range hs.clientHello.keyShares {
 			if ks.group == preferredGroup {
 				selectedGroup = ks.group
@@ -200,22 +238,50 @@ GroupSelection:
 		}
 		clientKeyShare = &hs.clientHello.keyShares[0]
 	}
-
-	if _, ok := curveForCurveID(selectedGroup); selectedGroup != X25519 && !ok {
+	c.curveID = selectedGroup
+
+	// For X25519MLKEM768, the client key share is the ML-KEM encapsulation
+	// key followed by the X25519 public key, and the server key share is the
+	// ML-KEM ciphertext followed by the X25519 public key. The shared secret
+	// is the ML-KEM shared secret followed by the X25519 shared secret. See
+	// draft-kwiatkowski-tls-ecdhe-mlkem-02, Section 4.1.
+	ecdhGroup := selectedGroup
+	ecdhData := clientKeyShare.data
+	if selectedGroup == X25519MLKEM768 {
+		ecdhGroup = X25519
+		if len(ecdhData) != mlkem768.EncapsulationKeySize+x25519PublicKeySize {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: invalid X25519MLKEM768 client key share")
+		}
+		ecdhData = ecdhData[mlkem768.EncapsulationKeySize:]
+	}
+	if _, ok := curveForCurveID(ecdhGroup); !ok {
 		c.sendAlert(alertInternalError)
 		return errors.New("tls: CurvePreferences includes unsupported curve")
 	}
-	params, err := generateECDHEParameters(c.config.rand(), selectedGroup)
+	key, err := generateECDHEKey(c.config.rand(), ecdhGroup)
 	if err != nil {
 		c.sendAlert(alertInternalError)
 		return err
 	}
-	hs.hello.serverShare = keyShare{group: selectedGroup, data: params.PublicKey()}
-	hs.sharedKey = params.SharedKey(clientKeyShare.data)
+	hs.hello.serverShare = keyShare{group: selectedGroup, data: key.PublicKey().Bytes()}
+	peerKey, err := key.Curve().NewPublicKey(ecdhData)
+	if err == nil {
+		hs.sharedKey, _ = key.ECDH(peerKey)
+	}
 	if hs.sharedKey == nil {
 		c.sendAlert(alertIllegalParameter)
 		return errors.New("tls: invalid client key share")
 	}
+	if selectedGroup == X25519MLKEM768 {
+		ciphertext, mlkemSharedSecret, err := mlkem768.Encapsulate(clientKeyShare.data[:mlkem768.EncapsulationKeySize])
+		if err != nil {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: invalid X25519MLKEM768 client key share")
+		}
+		hs.sharedKey = append(mlkemSharedSecret, hs.sharedKey...)
+		hs.hello.serverShare.data = append(ciphertext, hs.hello.serverShare.data...)
+	}
 
 	c.serverName = hs.clientHello.serverName
 	return nil
@@ -252,12 +318,11 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 			break
 		}
 
-		plaintext, _ := c.decryptTicket(identity.label)
-		if plaintext == nil {
-			continue
+		sessionState, _, err := c.unwrapSession(identity.label)
+		if err != nil {
+			return err
 		}
-		sessionState := new(sessionStateTLS13)
-		if ok := sessionState.unmarshal(plaintext); !ok {
+		if sessionState == nil || sessionState.version != VersionTLS13 {
 			continue
 		}
 
@@ -268,7 +333,9 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 
 		// We don't check the obfuscated ticket age because it's affected by
 		// clock skew and it's only a freshness signal useful for shrinking the
-		// window for replay attacks, which don't affect us as we don't do 0-RTT.
+		// window for replay attacks. 0-RTT is only accepted over QUIC, where
+		// protecting against replays is up to the application (RFC 9001,
+		// Section 9.2).
 
 		pskSuite := cipherSuiteTLS13ByID(sessionState.cipherSuite)
 		if pskSuite == nil || pskSuite.hash != hs.suite.hash {
@@ -278,7 +345,7 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 		// PSK connections don't re-establish client certificates, but carry
 		// them over in the session ticket. Ensure the presence of client certs
 		// in the ticket is consistent with the configured requirements.
-		sessionHasClientCerts := len(sessionState.certificate.Certificate) != 0
+		sessionHasClientCerts := len(sessionState.peerCertificates) != 0
 		needClientCerts := requiresClientCert(c.config.ClientAuth)
 		if needClientCerts && !sessionHasClientCerts {
 			continue
@@ -287,7 +354,7 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 			continue
 		}
 
-		psk := hs.suite.expandLabel(sessionState.resumptionSecret, "resumption",
+		psk := hs.suite.expandLabel(sessionState.secret, "resumption",
 			nil, hs.suite.hash.Size())
 		hs.earlySecret = hs.suite.extract(psk, nil)
 		binderKey := hs.suite.deriveSecret(hs.earlySecret, resumptionBinderLabel, nil)
@@ -305,13 +372,36 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 		}
 
 		c.didResume = true
-		if err := c.processCertsFromClient(sessionState.certificate); err != nil {
+		var certsFromClient [][]byte
+		for _, cert := range sessionState.peerCertificates {
+			certsFromClient = append(certsFromClient, cert.Raw)
+		}
+		if err := c.processCertsFromClient(Certificate{
+			Certificate: certsFromClient,
+		}); err != nil {
 			return err
 		}
 
 		hs.hello.selectedIdentityPresent = true
 		hs.hello.selectedIdentity = uint16(i)
 		hs.usingPSK = true
+
+		// Early data can only be accepted for the first PSK identity, and if
+		// the ticket was issued for it with the same cipher suite and ALPN
+		// protocol. See RFC 8446, Section 4.2.10 and RFC 9001, Section 4.6.1.
+		// ALPN is only negotiated in sendServerParameters, which reports any
+		// failure, so here a mismatch just means rejecting early data.
+		if hs.clientHello.earlyData && i == 0 && sessionState.EarlyData &&
+			sessionState.cipherSuite == hs.suite.id {
+			proto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols, c.quic != nil)
+			hs.earlyData = err == nil && proto == sessionState.alpnProtocol
+		}
+		if hs.earlyData {
+			transcript := hs.suite.hash.New()
+			transcript.Write(hs.clientHello.marshal())
+			earlyTrafficSecret := hs.suite.deriveSecret(hs.earlySecret, clientEarlyTrafficLabel, transcript)
+			c.quicSetReadSecret(QUICEncryptionLevelEarly, hs.suite.id, earlyTrafficSecret)
+		}
 		return nil
 	}
 
@@ -383,6 +473,9 @@ func (hs *serverHandshakeStateTLS13) pickCertificate() error {
 // sendDummyChangeCipherSpec sends a ChangeCipherSpec record for compatibility
 // with middleboxes that didn't implement TLS correctly. See RFC 8446, Appendix D.4.
 func (hs *serverHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
+	if hs.c.quic != nil {
+		return nil
+	}
 	if hs.sentDummyCCS {
 		return nil
 	}
@@ -394,6 +487,7 @@ func (hs *serverHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
 
 func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID) error {
 	c := hs.c
+	c.didHRR = true
 
 	// The first ClientHello gets double-hashed into the transcript upon a
 	// HelloRetryRequest. See RFC 8446, Section 4.4.1.
@@ -413,6 +507,18 @@ func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID)
 		selectedGroup:     selectedGroup,
 	}
 
+	if hs.echContext != nil {
+		helloRetryRequest.encryptedClientHello = make([]byte, 8)
+		confTranscript := cloneHash(hs.transcript, hs.suite.hash)
+		if confTranscript == nil {
+			return c.sendAlert(alertInternalError)
+		}
+		confTranscript.Write(helloRetryRequest.marshal())
+		helloRetryRequest.encryptedClientHello = hs.suite.echAcceptConfirmation(hs.clientHello.random,
+			echHRRAcceptConfirmationLabel, confTranscript)
+		helloRetryRequest.raw = nil
+	}
+
 	hs.transcript.Write(helloRetryRequest.marshal())
 	if _, err := c.writeRecord(recordTypeHandshake, helloRetryRequest.marshal()); err != nil {
 		return err
@@ -433,6 +539,45 @@ func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID)
 		return unexpectedMessageError(clientHello, msg)
 	}
 
+	if hs.echContext != nil {
+		if len(clientHello.encryptedClientHello) == 0 {
+			c.sendAlert(alertMissingExtension)
+			return errors.New("tls: second ClientHello missing encrypted_client_hello extension")
+		}
+
+		echType, echCiphersuite, configID, encap, payload, err := parseECHExt(clientHello.encryptedClientHello)
+		if err != nil {
+			c.sendAlert(alertDecodeError)
+			return errors.New("tls: client sent invalid encrypted_client_hello extension")
+		}
+
+		if echType == outerECHExt && hs.echContext.inner || echType == innerECHExt && !hs.echContext.inner {
+			c.sendAlert(alertDecodeError)
+			return errors.New("tls: unexpected switch in encrypted_client_hello extension type")
+		}
+
+		if echType == outerECHExt {
+			if echCiphersuite != hs.echContext.ciphersuite || configID != hs.echContext.configID || len(encap) != 0 {
+				c.sendAlert(alertIllegalParameter)
+				return errors.New("tls: second ClientHello encrypted_client_hello extension does not match")
+			}
+
+			encodedInner, err := decryptECHPayload(hs.echContext.hpkeContext, clientHello.raw, payload)
+			if err != nil {
+				c.sendAlert(alertDecryptError)
+				return errors.New("tls: failed to decrypt second ClientHello encrypted_client_hello extension payload")
+			}
+
+			echInner, err := decodeInnerClientHello(clientHello, encodedInner)
+			if err != nil {
+				c.sendAlert(alertIllegalParameter)
+				return errors.New("tls: client sent invalid encrypted_client_hello extension")
+			}
+
+			clientHello = echInner
+		}
+	}
+
 	if len(clientHello.keyShares) != 1 || clientHello.keyShares[0].group != selectedGroup {
 		c.sendAlert(alertIllegalParameter)
 		return errors.New("tls: client sent invalid key share in second ClientHello")
@@ -514,6 +659,23 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 	c := hs.c
 
 	hs.transcript.Write(hs.clientHello.marshal())
+
+	// Signal the acceptance of the ClientHelloInner in the last eight bytes
+	// of the random, computed with those bytes set to zero. See RFC 9849,
+	// Section 7.2.
+	if hs.echContext != nil {
+		copy(hs.hello.random[24:], make([]byte, 8))
+		hs.hello.raw = nil
+		confTranscript := cloneHash(hs.transcript, hs.suite.hash)
+		if confTranscript == nil {
+			return c.sendAlert(alertInternalError)
+		}
+		confTranscript.Write(hs.hello.marshal())
+		copy(hs.hello.random[24:], hs.suite.echAcceptConfirmation(hs.clientHello.random,
+			echAcceptConfirmationLabel, confTranscript))
+		hs.hello.raw = nil
+	}
+
 	hs.transcript.Write(hs.hello.marshal())
 	if _, err := c.writeRecord(recordTypeHandshake, hs.hello.marshal()); err != nil {
 		return err
@@ -532,10 +694,18 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 
 	clientSecret := hs.suite.deriveSecret(hs.handshakeSecret,
 		clientHandshakeTrafficLabel, hs.transcript)
-	c.in.setTrafficSecret(hs.suite, clientSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, clientSecret)
 	serverSecret := hs.suite.deriveSecret(hs.handshakeSecret,
 		serverHandshakeTrafficLabel, hs.transcript)
-	c.out.setTrafficSecret(hs.suite, serverSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelHandshake, hs.suite.id, serverSecret)
+		c.quicSetReadSecret(QUICEncryptionLevelHandshake, hs.suite.id, clientSecret)
+	}
 
 	err := c.config.writeKeyLog(keyLogLabelClientHandshake, hs.clientHello.random, clientSecret)
 	if err != nil {
@@ -549,8 +719,9 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 	}
 
 	encryptedExtensions := new(encryptedExtensionsMsg)
+	encryptedExtensions.earlyData = hs.earlyData
 
-	selectedProto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols)
+	selectedProto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols, c.quic != nil)
 	if err != nil {
 		c.sendAlert(alertNoApplicationProtocol)
 		return err
@@ -558,6 +729,23 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 	encryptedExtensions.alpnProtocol = selectedProto
 	c.clientProtocol = selectedProto
 
+	if c.quic != nil {
+		p, err := c.quicGetTransportParameters()
+		if err != nil {
+			return err
+		}
+		encryptedExtensions.quicTransportParameters = p
+	}
+
+	// Send the retry configs if the client offered ECH but it was rejected.
+	if hs.echContext == nil && len(hs.clientHello.encryptedClientHello) > 0 && len(c.config.EncryptedClientHelloKeys) > 0 {
+		encryptedExtensions.echRetryConfigs, err = buildRetryConfigList(c.config.EncryptedClientHelloKeys)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+	}
+
 	hs.transcript.Write(encryptedExtensions.marshal())
 	if _, err := c.writeRecord(recordTypeHandshake, encryptedExtensions.marshal()); err != nil {
 		return err
@@ -661,7 +849,14 @@ func (hs *serverHandshakeStateTLS13) sendServerFinished() error {
 		clientApplicationTrafficLabel, hs.transcript)
 	serverSecret := hs.suite.deriveSecret(hs.masterSecret,
 		serverApplicationTrafficLabel, hs.transcript)
-	c.out.setTrafficSecret(hs.suite, serverSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelApplication, hs.suite.id, serverSecret)
+	}
 
 	err := c.config.writeKeyLog(keyLogLabelClientTraffic, hs.clientHello.random, hs.trafficSecret)
 	if err != nil {
@@ -693,6 +888,11 @@ func (hs *serverHandshakeStateTLS13) shouldSendSessionTickets() bool {
 		return false
 	}
 
+	// QUIC servers send tickets explicitly with QUICConn.SendSessionTicket.
+	if hs.c.quic != nil {
+		return false
+	}
+
 	// Don't send tickets the client wouldn't use. See RFC 8446, Section 4.2.9.
 	for _, pskMode := range hs.clientHello.pskModes {
 		if pskMode == pskModeDHE {
@@ -711,35 +911,43 @@ func (hs *serverHandshakeStateTLS13) sendSessionTickets() error {
 	}
 	hs.transcript.Write(finishedMsg.marshal())
 
-	if !hs.shouldSendSessionTickets() {
+	if c.config.SessionTicketsDisabled {
 		return nil
 	}
 
-	resumptionSecret := hs.suite.deriveSecret(hs.masterSecret,
+	c.resumptionSecret = hs.suite.deriveSecret(hs.masterSecret,
 		resumptionLabel, hs.transcript)
 
-	m := new(newSessionTicketMsgTLS13)
-
-	var certsFromClient [][]byte
-	for _, cert := range c.peerCertificates {
-		certsFromClient = append(certsFromClient, cert.Raw)
+	if !hs.shouldSendSessionTickets() {
+		return nil
 	}
-	state := sessionStateTLS13{
-		cipherSuite:      hs.suite.id,
-		createdAt:        uint64(c.config.time().Unix()),
-		resumptionSecret: resumptionSecret,
-		certificate: Certificate{
-			Certificate:                 certsFromClient,
-			OCSPStaple:                  c.ocspResponse,
-			SignedCertificateTimestamps: c.scts,
-		},
+	return c.sendSessionTicket(false)
+}
+
+// sendSessionTicket sends a NewSessionTicket message derived from
+// c.resumptionSecret. If earlyData is true, the ticket can be used by a QUIC
+// client to send 0-RTT data, unless Config.WrapSession clears
+// SessionState.EarlyData.
+func (c *Conn) sendSessionTicket(earlyData bool) error {
+	if c.resumptionSecret == nil {
+		return errors.New("tls: internal error: missing resumption secret")
 	}
+
+	m := new(newSessionTicketMsgTLS13)
+
+	state := c.sessionState()
+	state.secret = c.resumptionSecret
+	state.EarlyData = earlyData
 	var err error
-	m.label, err = c.encryptTicket(state.marshal())
+	m.label, err = c.wrapSession(state)
 	if err != nil {
 		return err
 	}
 	m.lifetime = uint32(maxSessionTicketLifetime / time.Second)
+	if c.quic != nil && state.EarlyData {
+		// RFC 9001, Section 4.6.1
+		m.maxEarlyData = 0xffffffff
+	}
 
 	if _, err := c.writeRecord(recordTypeHandshake, m.marshal()); err != nil {
 		return err
@@ -852,7 +1060,7 @@ func (hs *serverHandshakeStateTLS13) readClientFinished() error {
 		return errors.New("tls: invalid client finished hash")
 	}
 
-	c.in.setTrafficSecret(hs.suite, hs.trafficSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, hs.trafficSecret)
 
 	return nil
 }
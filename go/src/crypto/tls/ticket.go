@@ -11,113 +11,407 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/subtle"
+	"crypto/x509"
 	"errors"
 	"io"
 
 	"golang.org/x/crypto/cryptobyte"
 )
 
-// sessionState contains the information that is serialized into a session
-// ticket in order to later resume a connection.
-type sessionState struct {
-	vers         uint16
-	cipherSuite  uint16
-	createdAt    uint64
-	masterSecret []byte // opaque master_secret<1..2^16-1>;
-	// struct { opaque certificate<1..2^24-1> } Certificate;
-	certificates [][]byte // Certificate certificate_list<0..2^24-1>;
-
-	// usedOldKey is true if the ticket from which this session came from
-	// was encrypted with an older key and thus should be refreshed.
-	usedOldKey bool
+// A SessionState is a resumable session.
+type SessionState struct {
+	// Encoded as a SessionState (in the language of RFC 8446, Section 3).
+	//
+	//	struct {
+	//	    uint16 version;
+	//	    select (SessionState.version) {
+	//	        case VersionTLS13:
+	//	            uint8 revision = 0;
+	//	            uint16 cipher_suite;
+	//	            uint64 created_at;
+	//	            opaque secret<1..2^8-1>;
+	//	            CertificateEntry certificate_list<0..2^24-1>;
+	//	        default:
+	//	            uint16 cipher_suite;
+	//	            uint64 created_at;
+	//	            opaque secret<1..2^16-1>;
+	//	            opaque certificate_list<0..2^24-1>; /* of opaque cert<1..2^24-1> */
+	//	    };
+	//	    SessionExtensions extensions; /* optional */
+	//	} SessionState;
+	//
+	//	enum { server(1), client(2) } SessionStateType;
+	//
+	//	struct {
+	//	    SessionStateType type;
+	//	    uint8 early_data = { 0, 1 };
+	//	    opaque alpn<0..2^8-1>;
+	//	    opaque extra<0..2^24-1>; /* of opaque extra_entry<0..2^24-1> */
+	//	    select (SessionExtensions.type) {
+	//	        case server: Empty;
+	//	        case client:
+	//	            opaque ocsp_response<0..2^24-1>;
+	//	            opaque scts<0..2^24-1>; /* of opaque sct<1..2^16-1> */
+	//	            opaque verified_chains<0..2^24-1>; /* of certificate_list */
+	//	            select (SessionState.version) {
+	//	                case VersionTLS13:
+	//	                    uint64 use_by;
+	//	                    uint32 age_add;
+	//	                    opaque nonce<0..2^8-1>;
+	//	                default: Empty;
+	//	            };
+	//	    };
+	//	} SessionExtensions;
+	//
+	// The extensions are omitted for server sessions without Extra or
+	// EarlyData, which are then encoded like the tickets issued by earlier
+	// versions of this package. Client sessions store the OCSP response and
+	// SCTs in the extensions, not in the certificate list.
+
+	// Extra is ignored by crypto/tls, but is encoded by SessionState.Bytes
+	// and parsed by ParseSessionState.
+	//
+	// This allows Config.UnwrapSession/Config.WrapSession and
+	// ClientSessionCache implementations to store and retrieve additional
+	// data alongside this session.
+	//
+	// To allow different layers in a protocol stack to share this field,
+	// applications must only append to it, not replace it, and must use
+	// entries that can be recognized even if out of order (for example, by
+	// starting with an id and version prefix).
+	Extra [][]byte
+
+	// EarlyData indicates whether the ticket can be used for 0-RTT in a QUIC
+	// connection. The application may set this to false if it is true to
+	// decline to offer or accept 0-RTT even if supported.
+	EarlyData bool
+
+	version     uint16
+	isClient    bool
+	cipherSuite uint16
+	// createdAt is the generation time of the secret on the server (which for
+	// TLS 1.0–1.2 might be earlier than the current session) and the time at
+	// which the ticket was received on the client.
+	createdAt        uint64 // seconds since UNIX epoch
+	secret           []byte // master secret for TLS 1.2, or the resumption_master_secret for TLS 1.3
+	peerCertificates []*x509.Certificate
+	ocspResponse     []byte
+	scts             [][]byte
+	alpnProtocol     string // not encoded if the extensions are omitted
+
+	// Client-side fields.
+	verifiedChains [][]*x509.Certificate
+
+	// Client-side TLS 1.3-only fields.
+	useBy  uint64 // seconds since UNIX epoch
+	ageAdd uint32
+	nonce  []byte
 }
 
-func (m *sessionState) marshal() []byte {
+const (
+	sessionStateTypeServer = 1
+	sessionStateTypeClient = 2
+)
+
+// Bytes encodes the session, including any private fields, so that it can be
+// parsed by ParseSessionState. The encoding contains secret values critical
+// to the security of future and possibly past sessions.
+//
+// The specific encoding should be considered opaque and may change
+// incompatibly between Go versions.
+func (s *SessionState) Bytes() ([]byte, error) {
 	var b cryptobyte.Builder
-	b.AddUint16(m.vers)
-	b.AddUint16(m.cipherSuite)
-	addUint64(&b, m.createdAt)
-	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-		b.AddBytes(m.masterSecret)
+	b.AddUint16(s.version)
+	if s.version == VersionTLS13 {
+		b.AddUint8(0) // revision
+		b.AddUint16(s.cipherSuite)
+		addUint64(&b, s.createdAt)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(s.secret)
+		})
+		certificate := Certificate{}
+		for _, cert := range s.peerCertificates {
+			certificate.Certificate = append(certificate.Certificate, cert.Raw)
+		}
+		if !s.isClient {
+			certificate.OCSPStaple = s.ocspResponse
+			certificate.SignedCertificateTimestamps = s.scts
+		}
+		marshalCertificate(&b, certificate)
+	} else {
+		b.AddUint16(s.cipherSuite)
+		addUint64(&b, s.createdAt)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(s.secret)
+		})
+		marshalCertificateList(&b, s.peerCertificates)
+	}
+
+	if !s.isClient && !s.EarlyData && len(s.Extra) == 0 {
+		return b.Bytes()
+	}
+
+	if s.isClient {
+		b.AddUint8(sessionStateTypeClient)
+	} else {
+		b.AddUint8(sessionStateTypeServer)
+	}
+	if s.EarlyData {
+		b.AddUint8(1)
+	} else {
+		b.AddUint8(0)
+	}
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte(s.alpnProtocol))
 	})
 	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-		for _, cert := range m.certificates {
+		for _, extra := range s.Extra {
 			b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-				b.AddBytes(cert)
+				b.AddBytes(extra)
 			})
 		}
 	})
-	return b.BytesOrPanic()
-}
+	if !s.isClient {
+		return b.Bytes()
+	}
 
-func (m *sessionState) unmarshal(data []byte) bool {
-	*m = sessionState{usedOldKey: m.usedOldKey}
-	s := cryptobyte.String(data)
-	if ok := s.ReadUint16(&m.vers) &&
-		s.ReadUint16(&m.cipherSuite) &&
-		readUint64(&s, &m.createdAt) &&
-		readUint16LengthPrefixed(&s, &m.masterSecret) &&
-		len(m.masterSecret) != 0; !ok {
-		return false
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(s.ocspResponse)
+	})
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, sct := range s.scts {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(sct)
+			})
+		}
+	})
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, chain := range s.verifiedChains {
+			marshalCertificateList(b, chain)
+		}
+	})
+	if s.version == VersionTLS13 {
+		addUint64(&b, s.useBy)
+		b.AddUint32(s.ageAdd)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(s.nonce)
+		})
 	}
+	return b.Bytes()
+}
+
+func marshalCertificateList(b *cryptobyte.Builder, certs []*x509.Certificate) {
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, cert := range certs {
+			b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(cert.Raw)
+			})
+		}
+	})
+}
+
+func unmarshalCertificateList(s *cryptobyte.String) ([]*x509.Certificate, bool) {
 	var certList cryptobyte.String
 	if !s.ReadUint24LengthPrefixed(&certList) {
-		return false
+		return nil, false
 	}
+	var certs []*x509.Certificate
 	for !certList.Empty() {
 		var cert []byte
 		if !readUint24LengthPrefixed(&certList, &cert) {
-			return false
+			return nil, false
+		}
+		c, err := x509.ParseCertificate(cert)
+		if err != nil {
+			return nil, false
 		}
-		m.certificates = append(m.certificates, cert)
+		certs = append(certs, c)
 	}
-	return s.Empty()
+	return certs, true
 }
 
-// sessionStateTLS13 is the content of a TLS 1.3 session ticket. Its first
-// version (revision = 0) doesn't carry any of the information needed for 0-RTT
-// validation and the nonce is always empty.
-type sessionStateTLS13 struct {
-	// uint8 version  = 0x0304;
-	// uint8 revision = 0;
-	cipherSuite      uint16
-	createdAt        uint64
-	resumptionSecret []byte      // opaque resumption_master_secret<1..2^8-1>;
-	certificate      Certificate // CertificateEntry certificate_list<0..2^24-1>;
+// ParseSessionState parses a SessionState encoded by SessionState.Bytes.
+func ParseSessionState(data []byte) (*SessionState, error) {
+	ss := &SessionState{}
+	s := cryptobyte.String(data)
+	if !s.ReadUint16(&ss.version) ||
+		ss.version < VersionTLS10 || ss.version > VersionTLS13 {
+		return nil, errors.New("tls: invalid session encoding")
+	}
+	if ss.version == VersionTLS13 {
+		var revision uint8
+		var certificate Certificate
+		if !s.ReadUint8(&revision) || revision != 0 ||
+			!s.ReadUint16(&ss.cipherSuite) ||
+			!readUint64(&s, &ss.createdAt) ||
+			!readUint8LengthPrefixed(&s, &ss.secret) ||
+			len(ss.secret) == 0 ||
+			!unmarshalCertificate(&s, &certificate) {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		for _, cert := range certificate.Certificate {
+			c, err := x509.ParseCertificate(cert)
+			if err != nil {
+				return nil, errors.New("tls: invalid session encoding")
+			}
+			ss.peerCertificates = append(ss.peerCertificates, c)
+		}
+		ss.ocspResponse = certificate.OCSPStaple
+		ss.scts = certificate.SignedCertificateTimestamps
+	} else {
+		var ok bool
+		if !s.ReadUint16(&ss.cipherSuite) ||
+			!readUint64(&s, &ss.createdAt) ||
+			!readUint16LengthPrefixed(&s, &ss.secret) ||
+			len(ss.secret) == 0 {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		if ss.peerCertificates, ok = unmarshalCertificateList(&s); !ok {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+	}
+
+	if s.Empty() {
+		return ss, nil
+	}
+
+	var typ, earlyData uint8
+	var alpn []byte
+	var extraList cryptobyte.String
+	if !s.ReadUint8(&typ) ||
+		(typ != sessionStateTypeServer && typ != sessionStateTypeClient) ||
+		!s.ReadUint8(&earlyData) || earlyData > 1 ||
+		!readUint8LengthPrefixed(&s, &alpn) ||
+		!s.ReadUint24LengthPrefixed(&extraList) {
+		return nil, errors.New("tls: invalid session encoding")
+	}
+	ss.isClient = typ == sessionStateTypeClient
+	ss.EarlyData = earlyData == 1
+	ss.alpnProtocol = string(alpn)
+	for !extraList.Empty() {
+		var extra []byte
+		if !readUint24LengthPrefixed(&extraList, &extra) {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		ss.Extra = append(ss.Extra, extra)
+	}
+	if !ss.isClient {
+		if !s.Empty() {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		return ss, nil
+	}
+
+	var sctList, chainList cryptobyte.String
+	if len(ss.ocspResponse) != 0 || len(ss.scts) != 0 ||
+		!readUint24LengthPrefixed(&s, &ss.ocspResponse) ||
+		!s.ReadUint24LengthPrefixed(&sctList) ||
+		!s.ReadUint24LengthPrefixed(&chainList) {
+		return nil, errors.New("tls: invalid session encoding")
+	}
+	for !sctList.Empty() {
+		var sct []byte
+		if !readUint16LengthPrefixed(&sctList, &sct) || len(sct) == 0 {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		ss.scts = append(ss.scts, sct)
+	}
+	for !chainList.Empty() {
+		chain, ok := unmarshalCertificateList(&chainList)
+		if !ok {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		ss.verifiedChains = append(ss.verifiedChains, chain)
+	}
+	if ss.version == VersionTLS13 {
+		if !readUint64(&s, &ss.useBy) ||
+			!s.ReadUint32(&ss.ageAdd) ||
+			!readUint8LengthPrefixed(&s, &ss.nonce) {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+	}
+	if !s.Empty() {
+		return nil, errors.New("tls: invalid session encoding")
+	}
+	return ss, nil
 }
 
-func (m *sessionStateTLS13) marshal() []byte {
-	var b cryptobyte.Builder
-	b.AddUint16(VersionTLS13)
-	b.AddUint8(0) // revision
-	b.AddUint16(m.cipherSuite)
-	addUint64(&b, m.createdAt)
-	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
-		b.AddBytes(m.resumptionSecret)
-	})
-	marshalCertificate(&b, m.certificate)
-	return b.BytesOrPanic()
+// sessionState returns a partially filled-out SessionState with information
+// from the current connection.
+func (c *Conn) sessionState() *SessionState {
+	return &SessionState{
+		version:          c.vers,
+		cipherSuite:      c.cipherSuite,
+		createdAt:        uint64(c.config.time().Unix()),
+		alpnProtocol:     c.clientProtocol,
+		peerCertificates: c.peerCertificates,
+		ocspResponse:     c.ocspResponse,
+		scts:             c.scts,
+		isClient:         c.isClient,
+		verifiedChains:   c.verifiedChains,
+	}
 }
 
-func (m *sessionStateTLS13) unmarshal(data []byte) bool {
-	*m = sessionStateTLS13{}
-	s := cryptobyte.String(data)
-	var version uint16
-	var revision uint8
-	return s.ReadUint16(&version) &&
-		version == VersionTLS13 &&
-		s.ReadUint8(&revision) &&
-		revision == 0 &&
-		s.ReadUint16(&m.cipherSuite) &&
-		readUint64(&s, &m.createdAt) &&
-		readUint8LengthPrefixed(&s, &m.resumptionSecret) &&
-		len(m.resumptionSecret) != 0 &&
-		unmarshalCertificate(&s, &m.certificate) &&
-		s.Empty()
+// wrapSession produces a ticket for state, with Config.WrapSession if set, or
+// by encrypting it with the connection's session ticket keys.
+func (c *Conn) wrapSession(state *SessionState) ([]byte, error) {
+	if c.config.WrapSession != nil {
+		ticket, err := c.config.WrapSession(c.connectionStateLocked(), state)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return nil, err
+		}
+		return ticket, nil
+	}
+	stateBytes, err := state.Bytes()
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return nil, err
+	}
+	return c.config.encryptTicket(stateBytes, c.ticketKeys)
+}
+
+// unwrapSession recovers the server session state from a ticket, with
+// Config.UnwrapSession if set, or by decrypting it with the connection's
+// session ticket keys. It returns a nil state if the ticket can't be used.
+// usedOldKey reports whether the ticket was encrypted with an older key, and
+// should be replaced with a fresh one.
+func (c *Conn) unwrapSession(identity []byte) (state *SessionState, usedOldKey bool, err error) {
+	if c.config.UnwrapSession != nil {
+		state, err = c.config.UnwrapSession(identity, c.connectionStateLocked())
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return nil, false, err
+		}
+	} else {
+		var plaintext []byte
+		plaintext, usedOldKey = c.config.decryptTicket(identity, c.ticketKeys)
+		if plaintext == nil {
+			return nil, false, nil
+		}
+		if state, err = ParseSessionState(plaintext); err != nil {
+			return nil, false, nil
+		}
+	}
+	if state == nil || state.isClient {
+		return nil, false, nil
+	}
+	return state, usedOldKey, nil
 }
 
-func (c *Conn) encryptTicket(state []byte) ([]byte, error) {
-	if len(c.ticketKeys) == 0 {
+// EncryptTicket encrypts a ticket with the Config's configured (or default)
+// session ticket keys. It can be used as a Config.WrapSession implementation.
+func (c *Config) EncryptTicket(cs ConnectionState, ss *SessionState) ([]byte, error) {
+	ticketKeys := c.ticketKeys(nil)
+	stateBytes, err := ss.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return c.encryptTicket(stateBytes, ticketKeys)
+}
+
+func (c *Config) encryptTicket(state []byte, ticketKeys []ticketKey) ([]byte, error) {
+	if len(ticketKeys) == 0 {
 		return nil, errors.New("tls: internal error: session ticket keys unavailable")
 	}
 
@@ -126,10 +420,10 @@ func (c *Conn) encryptTicket(state []byte) ([]byte, error) {
 	iv := encrypted[ticketKeyNameLen : ticketKeyNameLen+aes.BlockSize]
 	macBytes := encrypted[len(encrypted)-sha256.Size:]
 
-	if _, err := io.ReadFull(c.config.rand(), iv); err != nil {
+	if _, err := io.ReadFull(c.rand(), iv); err != nil {
 		return nil, err
 	}
-	key := c.ticketKeys[0]
+	key := ticketKeys[0]
 	copy(keyName, key.keyName[:])
 	block, err := aes.NewCipher(key.aesKey[:])
 	if err != nil {
@@ -144,7 +438,24 @@ func (c *Conn) encryptTicket(state []byte) ([]byte, error) {
 	return encrypted, nil
 }
 
-func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey bool) {
+// DecryptTicket decrypts a ticket encrypted by Config.EncryptTicket. It can be
+// used as a Config.UnwrapSession implementation.
+//
+// If the ticket can't be decrypted or parsed, DecryptTicket returns (nil, nil).
+func (c *Config) DecryptTicket(identity []byte, cs ConnectionState) (*SessionState, error) {
+	ticketKeys := c.ticketKeys(nil)
+	stateBytes, _ := c.decryptTicket(identity, ticketKeys)
+	if stateBytes == nil {
+		return nil, nil
+	}
+	s, err := ParseSessionState(stateBytes)
+	if err != nil {
+		return nil, nil
+	}
+	return s, nil
+}
+
+func (c *Config) decryptTicket(encrypted []byte, ticketKeys []ticketKey) (plaintext []byte, usedOldKey bool) {
 	if len(encrypted) < ticketKeyNameLen+aes.BlockSize+sha256.Size {
 		return nil, false
 	}
@@ -155,7 +466,7 @@ func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey boo
 	ciphertext := encrypted[ticketKeyNameLen+aes.BlockSize : len(encrypted)-sha256.Size]
 
 	keyIndex := -1
-	for i, candidateKey := range c.ticketKeys {
+	for i, candidateKey := range ticketKeys {
 		if bytes.Equal(keyName, candidateKey.keyName[:]) {
 			keyIndex = i
 			break
@@ -164,7 +475,7 @@ func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey boo
 	if keyIndex == -1 {
 		return nil, false
 	}
-	key := &c.ticketKeys[keyIndex]
+	key := &ticketKeys[keyIndex]
 
 	mac := hmac.New(sha256.New, key.hmacKey[:])
 	mac.Write(encrypted[:len(encrypted)-sha256.Size])
@@ -183,3 +494,24 @@ func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey boo
 
 	return plaintext, keyIndex > 0
 }
+
+// ResumptionState returns the session ticket sent by the server (also known as
+// the session's identity) and the state necessary to resume this session.
+//
+// It can be called by ClientSessionCache.Put to serialize (with
+// SessionState.Bytes) and store the session.
+func (cs *ClientSessionState) ResumptionState() (ticket []byte, state *SessionState, err error) {
+	return cs.ticket, cs.session, nil
+}
+
+// NewResumptionState returns a state value that can be returned by
+// ClientSessionCache.Get to resume a previous session.
+//
+// state needs to be returned by ParseSessionState, and the ticket and session
+// state must have been returned by ClientSessionState.ResumptionState.
+func NewResumptionState(ticket []byte, state *SessionState) (*ClientSessionState, error) {
+	if state == nil || !state.isClient {
+		return nil, errors.New("tls: NewResumptionState requires a client session state")
+	}
+	return &ClientSessionState{ticket: ticket, session: state}, nil
+}
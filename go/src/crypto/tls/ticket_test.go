@@ -0,0 +1,299 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+var _ = &Config{WrapSession: (&Config{}).EncryptTicket}
+var _ = &Config{UnwrapSession: (&Config{}).DecryptTicket}
+
+func (*SessionState) Generate(rand *rand.Rand, size int) reflect.Value {
+	s := &SessionState{}
+	versions := []uint16{VersionTLS10, VersionTLS11, VersionTLS12, VersionTLS13}
+	s.version = versions[rand.Intn(len(versions))]
+	s.isClient = rand.Intn(2) == 1
+	s.cipherSuite = uint16(rand.Intn(10000))
+	s.createdAt = uint64(rand.Int63())
+	s.secret = randomBytes(rand.Intn(100)+1, rand)
+
+	certs := [][]byte{testRSACertificate, testRSACertificateIssuer, testECDSACertificate, testEd25519Certificate}
+	for i := 0; i < rand.Intn(3); i++ {
+		cert, err := x509.ParseCertificate(certs[rand.Intn(len(certs))])
+		if err != nil {
+			panic(err)
+		}
+		s.peerCertificates = append(s.peerCertificates, cert)
+	}
+	if rand.Intn(10) > 5 && len(s.peerCertificates) > 0 {
+		s.ocspResponse = randomBytes(rand.Intn(100)+1, rand)
+	}
+	if rand.Intn(10) > 5 && len(s.peerCertificates) > 0 {
+		for i := 0; i < rand.Intn(2)+1; i++ {
+			s.scts = append(s.scts, randomBytes(rand.Intn(500)+1, rand))
+		}
+	}
+	if s.version != VersionTLS13 && !s.isClient {
+		// Server TLS 1.0–1.2 sessions don't store stapled responses.
+		s.ocspResponse, s.scts = nil, nil
+	}
+	for i := 0; i < rand.Intn(3); i++ {
+		s.Extra = append(s.Extra, randomBytes(rand.Intn(100), rand))
+	}
+	if rand.Intn(10) > 5 {
+		s.EarlyData = true
+	}
+	if s.isClient || s.EarlyData || len(s.Extra) > 0 {
+		// The ALPN protocol is only encoded alongside the extensions.
+		if rand.Intn(10) > 5 {
+			s.alpnProtocol = randomString(rand.Intn(32)+1, rand)
+		}
+	}
+	if s.isClient {
+		for i := 0; i < rand.Intn(3); i++ {
+			s.verifiedChains = append(s.verifiedChains, s.peerCertificates)
+		}
+		if s.version == VersionTLS13 {
+			s.useBy = uint64(rand.Int63())
+			s.ageAdd = rand.Uint32()
+			s.nonce = randomBytes(rand.Intn(32), rand)
+		}
+	}
+	return reflect.ValueOf(s)
+}
+
+func TestSessionStateRoundTrip(t *testing.T) {
+	f := func(s *SessionState) bool {
+		b, err := s.Bytes()
+		if err != nil {
+			t.Errorf("Bytes failed: %v", err)
+			return false
+		}
+		s2, err := ParseSessionState(b)
+		if err != nil {
+			t.Errorf("ParseSessionState failed for %x: %v", b, err)
+			return false
+		}
+		if !sessionStatesEqual(s, s2) {
+			t.Errorf("round trip mismatch:\n got: %#v\nwant: %#v", s2, s)
+			return false
+		}
+		// Truncations must be rejected, except where the optional
+		// extensions start, but must never decode to the same session.
+		for i := 0; i < len(b); i++ {
+			if s3, err := ParseSessionState(b[:i]); err == nil && sessionStatesEqual(s, s3) {
+				t.Errorf("ParseSessionState accepted truncated encoding %x", b[:i])
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 100}); err != nil {
+		t.Error(err)
+	}
+}
+
+// sessionStatesEqual compares two sessions, treating nil and empty slices as
+// equivalent, since the encoding doesn't distinguish them.
+func sessionStatesEqual(a, b *SessionState) bool {
+	if a.version != b.version || a.isClient != b.isClient ||
+		a.cipherSuite != b.cipherSuite || a.createdAt != b.createdAt ||
+		!bytes.Equal(a.secret, b.secret) || a.EarlyData != b.EarlyData ||
+		a.alpnProtocol != b.alpnProtocol || !bytes.Equal(a.ocspResponse, b.ocspResponse) ||
+		a.useBy != b.useBy || a.ageAdd != b.ageAdd || !bytes.Equal(a.nonce, b.nonce) {
+		return false
+	}
+	if !byteSlicesEqual(a.Extra, b.Extra) || !byteSlicesEqual(a.scts, b.scts) {
+		return false
+	}
+	if !certificatesEqual(a.peerCertificates, b.peerCertificates) {
+		return false
+	}
+	if len(a.verifiedChains) != len(b.verifiedChains) {
+		return false
+	}
+	for i := range a.verifiedChains {
+		if !certificatesEqual(a.verifiedChains[i], b.verifiedChains[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func byteSlicesEqual(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func certificatesEqual(a, b []*x509.Certificate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSessionStateLegacyEncoding(t *testing.T) {
+	// Server sessions without extras must keep the encoding used by earlier
+	// versions, so that tickets remain valid across upgrades.
+	s := &SessionState{
+		version:     VersionTLS12,
+		cipherSuite: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		createdAt:   0x0102030405060708,
+		secret:      []byte{0xaa, 0xbb},
+	}
+	b, err := s.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x03, 0x03, // version
+		0xc0, 0x2f, // cipher_suite
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, // created_at
+		0x00, 0x02, 0xaa, 0xbb, // secret
+		0x00, 0x00, 0x00, // certificate_list
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("Bytes() = %x, want %x", b, want)
+	}
+
+	if _, err := ParseSessionState(append(want, 0x00)); err == nil {
+		t.Errorf("ParseSessionState accepted trailing garbage")
+	}
+}
+
+func TestWrapSessionExtra(t *testing.T) {
+	t.Run("TLSv12", func(t *testing.T) { testWrapSessionExtra(t, VersionTLS12) })
+	t.Run("TLSv13", func(t *testing.T) { testWrapSessionExtra(t, VersionTLS13) })
+}
+
+// extraSessionCache wraps a ClientSessionCache, appending an entry to Extra
+// on Put and checking for it on Get.
+type extraSessionCache struct {
+	ClientSessionCache
+	t   *testing.T
+	got [][]byte
+}
+
+func (c *extraSessionCache) Put(sessionKey string, cs *ClientSessionState) {
+	if cs != nil {
+		ticket, state, err := cs.ResumptionState()
+		if err != nil {
+			c.t.Errorf("ResumptionState: %v", err)
+			return
+		}
+		b, err := state.Bytes()
+		if err != nil {
+			c.t.Errorf("Bytes: %v", err)
+			return
+		}
+		state, err = ParseSessionState(b)
+		if err != nil {
+			c.t.Errorf("ParseSessionState: %v", err)
+			return
+		}
+		state.Extra = append(state.Extra, []byte("client extra"))
+		cs, err = NewResumptionState(ticket, state)
+		if err != nil {
+			c.t.Errorf("NewResumptionState: %v", err)
+			return
+		}
+	}
+	c.ClientSessionCache.Put(sessionKey, cs)
+}
+
+func (c *extraSessionCache) Get(sessionKey string) (*ClientSessionState, bool) {
+	cs, ok := c.ClientSessionCache.Get(sessionKey)
+	if ok {
+		_, state, err := cs.ResumptionState()
+		if err != nil {
+			c.t.Errorf("ResumptionState: %v", err)
+		} else {
+			c.got = state.Extra
+		}
+	}
+	return cs, ok
+}
+
+func testWrapSessionExtra(t *testing.T, version uint16) {
+	serverConfig := testConfig.Clone()
+	serverConfig.MaxVersion = version
+	var serverExtra [][]byte
+	serverConfig.WrapSession = func(cs ConnectionState, ss *SessionState) ([]byte, error) {
+		ss.Extra = append(ss.Extra, []byte("server extra"))
+		return serverConfig.EncryptTicket(cs, ss)
+	}
+	serverConfig.UnwrapSession = func(identity []byte, cs ConnectionState) (*SessionState, error) {
+		ss, err := serverConfig.DecryptTicket(identity, cs)
+		if ss != nil {
+			serverExtra = ss.Extra
+		}
+		return ss, err
+	}
+
+	cache := &extraSessionCache{ClientSessionCache: NewLRUClientSessionCache(1), t: t}
+	clientConfig := testConfig.Clone()
+	clientConfig.MaxVersion = version
+	clientConfig.ClientSessionCache = cache
+
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("first handshake: %v", err)
+	}
+	_, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("second handshake: %v", err)
+	}
+	if !cs.DidResume {
+		t.Fatalf("second handshake did not resume")
+	}
+	if want := [][]byte{[]byte("server extra")}; !reflect.DeepEqual(serverExtra, want) {
+		t.Errorf("server Extra = %q, want %q", serverExtra, want)
+	}
+	if want := [][]byte{[]byte("client extra")}; !reflect.DeepEqual(cache.got, want) {
+		t.Errorf("client Extra = %q, want %q", cache.got, want)
+	}
+}
+
+func TestUnwrapSessionError(t *testing.T) {
+	t.Run("TLSv12", func(t *testing.T) { testUnwrapSessionError(t, VersionTLS12) })
+	t.Run("TLSv13", func(t *testing.T) { testUnwrapSessionError(t, VersionTLS13) })
+}
+
+func testUnwrapSessionError(t *testing.T, version uint16) {
+	serverConfig := testConfig.Clone()
+	serverConfig.MaxVersion = version
+	clientConfig := testConfig.Clone()
+	clientConfig.MaxVersion = version
+	clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("first handshake: %v", err)
+	}
+	errUnwrap := errors.New("unwrap failed")
+	serverConfig.UnwrapSession = func([]byte, ConnectionState) (*SessionState, error) {
+		return nil, errUnwrap
+	}
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); !errors.Is(err, errUnwrap) {
+		t.Errorf("second handshake: got error %v, want %v", err, errUnwrap)
+	}
+}
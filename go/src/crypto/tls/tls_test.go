@@ -734,7 +734,7 @@ func TestWarningAlertFlood(t *testing.T) {
 }
 
 func TestCloneFuncFields(t *testing.T) {
-	const expectedCount = 6
+	const expectedCount = 9
 	called := 0
 
 	c1 := Config{
@@ -762,6 +762,18 @@ func TestCloneFuncFields(t *testing.T) {
 			called |= 1 << 5
 			return nil
 		},
+		EncryptedClientHelloRejectionVerify: func(ConnectionState) error {
+			called |= 1 << 6
+			return nil
+		},
+		UnwrapSession: func(identity []byte, cs ConnectionState) (*SessionState, error) {
+			called |= 1 << 7
+			return nil, nil
+		},
+		WrapSession: func(cs ConnectionState, ss *SessionState) ([]byte, error) {
+			called |= 1 << 8
+			return nil, nil
+		},
 	}
 
 	c2 := c1.Clone()
@@ -772,6 +784,9 @@ func TestCloneFuncFields(t *testing.T) {
 	c2.GetConfigForClient(nil)
 	c2.VerifyPeerCertificate(nil, nil)
 	c2.VerifyConnection(ConnectionState{})
+	c2.EncryptedClientHelloRejectionVerify(ConnectionState{})
+	c2.UnwrapSession(nil, ConnectionState{})
+	c2.WrapSession(ConnectionState{}, nil)
 
 	if called != (1<<expectedCount)-1 {
 		t.Fatalf("expected %d calls but saw calls %b", expectedCount, called)
@@ -790,7 +805,7 @@ func TestCloneNonFuncFields(t *testing.T) {
 		switch fn := typ.Field(i).Name; fn {
 		case "Rand":
 			f.Set(reflect.ValueOf(io.Reader(os.Stdin)))
-		case "Time", "GetCertificate", "GetConfigForClient", "VerifyPeerCertificate", "VerifyConnection", "GetClientCertificate":
+		case "Time", "GetCertificate", "GetConfigForClient", "VerifyPeerCertificate", "VerifyConnection", "GetClientCertificate", "EncryptedClientHelloRejectionVerify", "UnwrapSession", "WrapSession":
 			// DeepEqual can't compare functions. If you add a
 			// function field to this list, you must also change
 			// TestCloneFuncFields to ensure that the func field is
@@ -825,6 +840,12 @@ func TestCloneNonFuncFields(t *testing.T) {
 			f.Set(reflect.ValueOf([]CurveID{CurveP256}))
 		case "Renegotiation":
 			f.Set(reflect.ValueOf(RenegotiateOnceAsClient))
+		case "EncryptedClientHelloConfigList":
+			f.Set(reflect.ValueOf([]byte{'x'}))
+		case "EncryptedClientHelloKeys":
+			f.Set(reflect.ValueOf([]EncryptedClientHelloKey{
+				{Config: []byte{1}, PrivateKey: []byte{1}},
+			}))
 		case "mutex", "autoSessionTicketKeys", "sessionTicketKeys":
 			continue // these are unexported fields that are handled separately
 		default:
@@ -1609,3 +1630,210 @@ func TestPKCS1OnlyCert(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestHandshakeMLKEM(t *testing.T) {
+	defaultWithMLKEM := []CurveID{X25519MLKEM768, X25519, CurveP256, CurveP384, CurveP521}
+	var tests = []struct {
+		name         string
+		clientConfig func(*Config)
+		serverConfig func(*Config)
+		expectSelect CurveID
+		expectHRR    bool
+		expectErr    bool
+	}{
+		{
+			name:         "Default",
+			expectSelect: X25519,
+		},
+		{
+			name: "MLKEM",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			expectSelect: X25519MLKEM768,
+		},
+		{
+			name: "ServerWithoutMLKEM",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			expectSelect: X25519,
+		},
+		{
+			name: "ClientWithoutMLKEM",
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			expectSelect: X25519,
+		},
+		{
+			name: "ClientPrefersX25519",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519, X25519MLKEM768}
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			expectSelect: X25519,
+		},
+		{
+			name: "ClientMLKEMOnly",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519MLKEM768}
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			expectSelect: X25519MLKEM768,
+		},
+		{
+			name: "ClientMLKEMOnlyServerWithoutMLKEM",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519MLKEM768}
+			},
+			expectErr: true,
+		},
+		{
+			name: "HelloRetryRequestToMLKEM",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{CurveP256, X25519MLKEM768}
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519MLKEM768}
+			},
+			expectSelect: X25519MLKEM768,
+			expectHRR:    true,
+		},
+		{
+			name: "HelloRetryRequestFromMLKEM",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519MLKEM768, CurveP256}
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{CurveP256}
+			},
+			expectSelect: CurveP256,
+			expectHRR:    true,
+		},
+		{
+			name: "TLSv12",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+				config.MaxVersion = VersionTLS12
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = defaultWithMLKEM
+			},
+			expectSelect: X25519,
+		},
+		{
+			name: "TLSv12MLKEMOnly",
+			clientConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519MLKEM768}
+				config.MaxVersion = VersionTLS12
+			},
+			serverConfig: func(config *Config) {
+				config.CurvePreferences = []CurveID{X25519MLKEM768}
+				config.CipherSuites = []uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+			},
+			expectErr: true,
+		},
+	}
+
+	baseConfig := testConfig.Clone()
+	baseConfig.CurvePreferences = nil
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConfig := baseConfig.Clone()
+			if test.clientConfig != nil {
+				test.clientConfig(clientConfig)
+			}
+			serverConfig := baseConfig.Clone()
+			if test.serverConfig != nil {
+				test.serverConfig(serverConfig)
+			}
+			serverConfig.GetConfigForClient = func(hello *ClientHelloInfo) (*Config, error) {
+				expectVersion := uint16(VersionTLS13)
+				if clientConfig.MaxVersion == VersionTLS12 {
+					expectVersion = VersionTLS12
+				}
+				if hello.SupportedVersions[0] != expectVersion {
+					t.Errorf("unexpected client version %x", hello.SupportedVersions[0])
+				}
+				if expectVersion == VersionTLS12 {
+					for _, id := range hello.SupportedCurves {
+						if id == X25519MLKEM768 {
+							t.Errorf("TLS 1.2 client advertised X25519MLKEM768")
+						}
+					}
+				}
+				return nil, nil
+			}
+
+			ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+			if err != nil {
+				if !test.expectErr {
+					t.Fatalf("handshake failed: %v", err)
+				}
+				return
+			}
+			if test.expectErr {
+				t.Fatal("expected handshake to fail")
+			}
+			if cs.Version == VersionTLS12 {
+				if clientConfig.MaxVersion != VersionTLS12 {
+					t.Errorf("unexpected TLS 1.2 connection")
+				}
+				if cs.testingOnlyCurveID != 0 || ss.testingOnlyCurveID != 0 {
+					t.Errorf("unexpected TLS 1.3 key exchange group recorded for TLS 1.2")
+				}
+				return
+			}
+			if ss.testingOnlyCurveID != test.expectSelect {
+				t.Errorf("server selected %v, expected %v", ss.testingOnlyCurveID, test.expectSelect)
+			}
+			if cs.testingOnlyCurveID != test.expectSelect {
+				t.Errorf("client selected %v, expected %v", cs.testingOnlyCurveID, test.expectSelect)
+			}
+			if ss.testingOnlyDidHRR != test.expectHRR || cs.testingOnlyDidHRR != test.expectHRR {
+				t.Errorf("HelloRetryRequest: server %v, client %v, expected %v",
+					ss.testingOnlyDidHRR, cs.testingOnlyDidHRR, test.expectHRR)
+			}
+		})
+	}
+}
+
+func TestMLKEMKeyShares(t *testing.T) {
+	config := testConfig.Clone()
+	config.CurvePreferences = []CurveID{X25519MLKEM768, X25519}
+	hello, keyShareKeys, _, err := Client(nil, config).makeClientHello()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hello.keyShares) != 2 {
+		t.Fatalf("got %d key shares, expected 2", len(hello.keyShares))
+	}
+	if g := hello.keyShares[0].group; g != X25519MLKEM768 {
+		t.Errorf("first key share is for %v, expected X25519MLKEM768", g)
+	}
+	if l := len(hello.keyShares[0].data); l != 1184+32 {
+		t.Errorf("X25519MLKEM768 key share is %d bytes, expected %d", l, 1184+32)
+	}
+	if g := hello.keyShares[1].group; g != X25519 {
+		t.Errorf("second key share is for %v, expected X25519", g)
+	}
+	// The X25519 key is reused between the hybrid and the fallback key shares.
+	x25519Share := hello.keyShares[1].data
+	if !bytes.Equal(hello.keyShares[0].data[1184:], x25519Share) {
+		t.Errorf("X25519 key not reused between key shares")
+	}
+	if !bytes.Equal(keyShareKeys.ecdhe.PublicKey().Bytes(), x25519Share) {
+		t.Errorf("X25519 key share doesn't match private key")
+	}
+	if keyShareKeys.curveID != X25519MLKEM768 || keyShareKeys.mlkem == nil {
+		t.Errorf("missing ML-KEM private key")
+	}
+}
@@ -40,6 +40,10 @@ type lazyCert struct {
 	// fewer allocations.
 	rawSubject []byte
 
+	// rawSum224 is the SHA-224 hash of the Certificate.Raw value, the
+	// CertPool.haveSum key.
+	rawSum224 sum224
+
 	// getCert returns the certificate.
 	//
 	// It is not meant to do network operations or anything else
@@ -98,20 +102,24 @@ func (s *CertPool) copy() *CertPool {
 // certificate file and SSL certificate files directory, respectively. The
 // latter can be a colon-separated list.
 //
+// If no system roots are found, and fallback roots were set with
+// SetFallbackRoots, a copy of the fallback roots is returned instead. On
+// Windows, only the fallback roots are available.
+//
 // Any mutations to the returned pool are not written to disk and do not affect
 // any other pool returned by SystemCertPool.
 //
 // New changes in the system cert pool might not be reflected in subsequent calls.
 func SystemCertPool() (*CertPool, error) {
+	if sysRoots := systemRootsPool(); sysRoots != nil {
+		return sysRoots.copy(), nil
+	}
+
 	if runtime.GOOS == "windows" {
 		// Issue 16736, 18609:
 		return nil, errors.New("crypto/x509: system root pool is not available on Windows")
 	}
 
-	if sysRoots := systemRootsPool(); sysRoots != nil {
-		return sysRoots.copy(), nil
-	}
-
 	return loadSystemRoots()
 }
 
@@ -192,6 +200,7 @@ func (s *CertPool) addCertFunc(rawSum224 sum224, rawSubject string, getCert func
 	s.haveSum[rawSum224] = true
 	s.lazyCerts = append(s.lazyCerts, lazyCert{
 		rawSubject: []byte(rawSubject),
+		rawSum224:  rawSum224,
 		getCert:    getCert,
 	})
 	s.byName[rawSubject] = append(s.byName[rawSubject], len(s.lazyCerts)-1)
@@ -237,6 +246,115 @@ func (s *CertPool) AppendCertsFromPEM(pemCerts []byte) (ok bool) {
 	return ok
 }
 
+// AppendLazyCertsFromPEM is like AppendCertsFromPEM, but it defers parsing
+// each certificate until it's first needed, for example when it's considered
+// as the issuer of a certificate being verified. This makes loading large sets
+// of roots, such as a system or embedded bundle, much cheaper.
+//
+// Only the subject of each certificate is decoded up front, so
+// AppendLazyCertsFromPEM might add malformed certificates to s. They are
+// skipped when s is used as VerifyOptions.Roots, and omitted by Certificates.
+// Verify fails if VerifyOptions.Intermediates contains one.
+func (s *CertPool) AppendLazyCertsFromPEM(pemCerts []byte) (ok bool) {
+	for len(pemCerts) > 0 {
+		var block *pem.Block
+		block, pemCerts = pem.Decode(pemCerts)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+
+		certBytes := block.Bytes
+		rawSubject, valid := parseRawSubject(certBytes)
+		if !valid {
+			continue
+		}
+		var lazyCert struct {
+			sync.Once
+			v   *Certificate
+			err error
+		}
+		s.addCertFunc(sha256.Sum224(certBytes), string(rawSubject), func() (*Certificate, error) {
+			lazyCert.Do(func() {
+				lazyCert.v, lazyCert.err = ParseCertificate(certBytes)
+				certBytes = nil
+			})
+			return lazyCert.v, lazyCert.err
+		})
+		ok = true
+	}
+
+	return ok
+}
+
+// Certificates returns the certificates in the pool, in the order they were
+// added. Certificates added with AppendLazyCertsFromPEM are parsed if they
+// weren't already, and omitted if they fail to parse.
+func (s *CertPool) Certificates() []*Certificate {
+	res := make([]*Certificate, 0, s.len())
+	for i := 0; i < s.len(); i++ {
+		if cert, err := s.cert(i); err == nil {
+			res = append(res, cert)
+		}
+	}
+	return res
+}
+
+// RemoveCert removes cert from the pool, and reports whether it was present.
+func (s *CertPool) RemoveCert(cert *Certificate) bool {
+	if cert == nil || !s.contains(cert) {
+		return false
+	}
+	sum := sha256.Sum224(cert.Raw)
+	for i, lc := range s.lazyCerts {
+		if lc.rawSum224 != sum {
+			continue
+		}
+		delete(s.haveSum, sum)
+		s.lazyCerts = append(s.lazyCerts[:i:i], s.lazyCerts[i+1:]...)
+
+		// Drop the certificate from the subject index, and shift the
+		// indexes of the ones that followed it.
+		for name, indexes := range s.byName {
+			kept := indexes[:0]
+			for _, j := range indexes {
+				switch {
+				case j < i:
+					kept = append(kept, j)
+				case j > i:
+					kept = append(kept, j-1)
+				}
+			}
+			if len(kept) == 0 {
+				delete(s.byName, name)
+			} else {
+				s.byName[name] = kept
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Equal reports whether s and other contain the same certificates, regardless
+// of the order they were added in.
+func (s *CertPool) Equal(other *CertPool) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	if len(s.haveSum) != len(other.haveSum) {
+		return false
+	}
+	for h := range s.haveSum {
+		if !other.haveSum[h] {
+			return false
+		}
+	}
+	return true
+}
+
 // Subjects returns a list of the DER-encoded subjects of
 // all of the certificates in the pool.
 func (s *CertPool) Subjects() [][]byte {
@@ -0,0 +1,185 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+)
+
+func mustCertificateFromPEM(t *testing.T, pemBytes string) *Certificate {
+	t.Helper()
+	cert, err := certificateFromPEM(pemBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertPoolEqual(t *testing.T) {
+	a := mustCertificateFromPEM(t, geoTrustRoot)
+	b := mustCertificateFromPEM(t, giag2Intermediate)
+	c := mustCertificateFromPEM(t, startComRoot)
+
+	pool := func(certs ...*Certificate) *CertPool {
+		p := NewCertPool()
+		for _, cert := range certs {
+			p.AddCert(cert)
+		}
+		return p
+	}
+	lazyPool := NewCertPool()
+	lazyPool.AppendLazyCertsFromPEM([]byte(giag2Intermediate + "\n" + geoTrustRoot))
+
+	tests := []struct {
+		name  string
+		a, b  *CertPool
+		equal bool
+	}{
+		{"nil pools", nil, nil, true},
+		{"nil and empty", nil, NewCertPool(), false},
+		{"empty pools", NewCertPool(), NewCertPool(), true},
+		{"same certificates", pool(a, b), pool(a, b), true},
+		{"different order", pool(a, b), pool(b, a), true},
+		{"duplicates", pool(a, b, a), pool(a, b), true},
+		{"subset", pool(a, b), pool(a, b, c), false},
+		{"different certificates", pool(a, b), pool(a, c), false},
+		{"lazy pool", pool(a, b), lazyPool, true},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Equal(tt.b); got != tt.equal {
+			t.Errorf("%s: a.Equal(b) = %v, want %v", tt.name, got, tt.equal)
+		}
+		if got := tt.b.Equal(tt.a); got != tt.equal {
+			t.Errorf("%s: b.Equal(a) = %v, want %v", tt.name, got, tt.equal)
+		}
+	}
+}
+
+func TestCertPoolRemoveCert(t *testing.T) {
+	root := mustCertificateFromPEM(t, geoTrustRoot)
+	inter := mustCertificateFromPEM(t, giag2Intermediate)
+	leaf := mustCertificateFromPEM(t, googleLeaf)
+	other := mustCertificateFromPEM(t, startComRoot)
+
+	p := NewCertPool()
+	p.AddCert(root)
+	p.AddCert(inter)
+	p.AddCert(other)
+	copied := p.copy()
+
+	if !p.RemoveCert(inter) {
+		t.Fatal("RemoveCert returned false for a certificate in the pool")
+	}
+	if p.RemoveCert(inter) {
+		t.Error("RemoveCert returned true for a removed certificate")
+	}
+	if p.RemoveCert(leaf) {
+		t.Error("RemoveCert returned true for a certificate not in the pool")
+	}
+	if p.contains(inter) {
+		t.Error("pool still contains the removed certificate")
+	}
+	if parents := p.findPotentialParents(leaf); len(parents) != 0 {
+		t.Errorf("removed certificate is still a potential parent")
+	}
+	if parents := p.findPotentialParents(inter); len(parents) != 1 || !parents[0].Equal(root) {
+		t.Errorf("findPotentialParents(inter) = %v, want root", parents)
+	}
+	if parents := p.findPotentialParents(other); len(parents) != 1 || !parents[0].Equal(other) {
+		t.Errorf("findPotentialParents(other) = %v, want other", parents)
+	}
+	certs := p.Certificates()
+	if len(certs) != 2 || !certs[0].Equal(root) || !certs[1].Equal(other) {
+		t.Errorf("Certificates() returned %d certificates, want root and other", len(certs))
+	}
+	if len(p.Subjects()) != 2 {
+		t.Errorf("Subjects() returned %d subjects, want 2", len(p.Subjects()))
+	}
+
+	// Copies are not affected.
+	if !copied.contains(inter) || len(copied.Certificates()) != 3 {
+		t.Error("RemoveCert modified a copy of the pool")
+	}
+
+	// The certificate can be added back.
+	p.AddCert(inter)
+	if parents := p.findPotentialParents(leaf); len(parents) != 1 || !parents[0].Equal(inter) {
+		t.Errorf("findPotentialParents(leaf) = %v, want inter", parents)
+	}
+	if !p.Equal(copied) {
+		t.Error("pool is not equal to its copy after adding back the certificate")
+	}
+}
+
+func TestAppendLazyCertsFromPEM(t *testing.T) {
+	// Build a certificate that decodes up to its subject, but fails to
+	// parse because its outer and inner signature algorithms don't match.
+	block, _ := pem.Decode([]byte(startComRoot))
+	var cert struct {
+		TBSCertificate     asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(block.Bytes, &cert); err != nil {
+		t.Fatal(err)
+	}
+	cert.SignatureAlgorithm.Algorithm = oidSignatureSHA256WithRSA
+	malformed, err := asn1.Marshal(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCertificate(malformed); err == nil {
+		t.Fatal("malformed certificate parsed successfully")
+	}
+	malformedPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: malformed}))
+
+	p := NewCertPool()
+	if !p.AppendLazyCertsFromPEM([]byte(geoTrustRoot + "\n" + malformedPEM + giag2Intermediate + "\n" + geoTrustRoot)) {
+		t.Fatal("AppendLazyCertsFromPEM failed")
+	}
+	if p.AppendLazyCertsFromPEM([]byte("-----BEGIN CERTIFICATE-----\nMAA=\n-----END CERTIFICATE-----\n")) {
+		t.Error("AppendLazyCertsFromPEM accepted an empty certificate")
+	}
+
+	eager := NewCertPool()
+	eager.AppendCertsFromPEM([]byte(geoTrustRoot + "\n" + giag2Intermediate))
+
+	if len(p.Subjects()) != 3 {
+		t.Errorf("got %d subjects, want 3", len(p.Subjects()))
+	}
+	certs := p.Certificates()
+	if len(certs) != 2 {
+		t.Fatalf("got %d certificates, want 2", len(certs))
+	}
+	for i, want := range eager.Certificates() {
+		if !certs[i].Equal(want) {
+			t.Errorf("certificate %d doesn't match", i)
+		}
+	}
+	for i, lc := range p.lazyCerts {
+		cert, err := lc.getCert()
+		if err != nil {
+			continue
+		}
+		if string(cert.RawSubject) != string(lc.rawSubject) {
+			t.Errorf("certificate %d: subject was decoded as %x, want %x", i, lc.rawSubject, cert.RawSubject)
+		}
+	}
+
+	leaf := mustCertificateFromPEM(t, googleLeaf)
+	opts := VerifyOptions{
+		Roots:         p,
+		Intermediates: NewCertPool(),
+		DNSName:       "www.google.com",
+		CurrentTime:   leaf.NotBefore,
+	}
+	opts.Intermediates.AddCert(mustCertificateFromPEM(t, giag2Intermediate))
+	if _, err := leaf.Verify(opts); err != nil {
+		t.Errorf("Verify with a lazy root pool failed: %v", err)
+	}
+}
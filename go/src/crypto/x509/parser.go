@@ -6,6 +6,7 @@ package x509
 import (
 	"bytes"
 	"crypto/dsa"
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
@@ -14,6 +15,7 @@ import (
 	"encoding/asn1"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"net"
 	"net/url"
@@ -157,53 +159,53 @@ func parseAI(der cryptobyte.String) (pkix.AlgorithmIdentifier, error) {
 	return ai, nil
 }
 
-func parseValidity(der cryptobyte.String) (time.Time, time.Time, error) {
-	extract := func() (time.Time, error) {
-		var t time.Time
-		switch {
-		case der.PeekASN1Tag(cryptobyte_asn1.UTCTime):
-			// TODO(rolandshoemaker): once #45411 is fixed, the following code
-			// should be replaced with a call to der.ReadASN1UTCTime.
-			var utc cryptobyte.String
-			if !der.ReadASN1(&utc, cryptobyte_asn1.UTCTime) {
-				return t, errors.New("x509: malformed UTCTime")
-			}
-			s := string(utc)
+func parseTime(der *cryptobyte.String) (time.Time, error) {
+	var t time.Time
+	switch {
+	case der.PeekASN1Tag(cryptobyte_asn1.UTCTime):
+		// TODO(rolandshoemaker): once #45411 is fixed, the following code
+		// should be replaced with a call to der.ReadASN1UTCTime.
+		var utc cryptobyte.String
+		if !der.ReadASN1(&utc, cryptobyte_asn1.UTCTime) {
+			return t, errors.New("x509: malformed UTCTime")
+		}
+		s := string(utc)
 
-			formatStr := "0601021504Z0700"
-			var err error
+		formatStr := "0601021504Z0700"
+		var err error
+		t, err = time.Parse(formatStr, s)
+		if err != nil {
+			formatStr = "060102150405Z0700"
 			t, err = time.Parse(formatStr, s)
-			if err != nil {
-				formatStr = "060102150405Z0700"
-				t, err = time.Parse(formatStr, s)
-			}
-			if err != nil {
-				return t, err
-			}
+		}
+		if err != nil {
+			return t, err
+		}
 
-			if serialized := t.Format(formatStr); serialized != s {
-				return t, errors.New("x509: malformed UTCTime")
-			}
+		if serialized := t.Format(formatStr); serialized != s {
+			return t, errors.New("x509: malformed UTCTime")
+		}
 
-			if t.Year() >= 2050 {
-				// UTCTime only encodes times prior to 2050. See https://tools.ietf.org/html/rfc5280#section-4.1.2.5.1
-				t = t.AddDate(-100, 0, 0)
-			}
-		case der.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime):
-			if !der.ReadASN1GeneralizedTime(&t) {
-				return t, errors.New("x509: malformed GeneralizedTime")
-			}
-		default:
-			return t, errors.New("x509: unsupported time format")
+		if t.Year() >= 2050 {
+			// UTCTime only encodes times prior to 2050. See https://tools.ietf.org/html/rfc5280#section-4.1.2.5.1
+			t = t.AddDate(-100, 0, 0)
+		}
+	case der.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime):
+		if !der.ReadASN1GeneralizedTime(&t) {
+			return t, errors.New("x509: malformed GeneralizedTime")
 		}
-		return t, nil
+	default:
+		return t, errors.New("x509: unsupported time format")
 	}
+	return t, nil
+}
 
-	notBefore, err := extract()
+func parseValidity(der cryptobyte.String) (time.Time, time.Time, error) {
+	notBefore, err := parseTime(&der)
 	if err != nil {
 		return time.Time{}, time.Time{}, err
 	}
-	notAfter, err := extract()
+	notAfter, err := parseTime(&der)
 	if err != nil {
 		return time.Time{}, time.Time{}, err
 	}
@@ -318,10 +320,34 @@ func parsePublicKey(algo PublicKeyAlgorithm, keyData *publicKeyInfo) (interface{
 		}
 		return pub, nil
 	default:
+		// X25519 is not a PublicKeyAlgorithm, as it can't be used for
+		// signatures, but X25519 keys can still appear in certificates.
+		if keyData.Algorithm.Algorithm.Equal(oidPublicKeyX25519) {
+			// RFC 8410, Section 3
+			// > For all of the OIDs, the parameters MUST be absent.
+			if len(keyData.Algorithm.Parameters.FullBytes) != 0 {
+				return nil, errors.New("x509: X25519 key encoded with illegal parameters")
+			}
+			return ecdh.X25519().NewPublicKey(der)
+		}
 		return nil, nil
 	}
 }
 
+func parseAuthorityKeyIdExtension(der cryptobyte.String) ([]byte, error) {
+	var akid cryptobyte.String
+	if !der.ReadASN1(&akid, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: invalid authority key identifier")
+	}
+	if akid.PeekASN1Tag(cryptobyte_asn1.Tag(0).ContextSpecific()) {
+		if !akid.ReadASN1(&akid, cryptobyte_asn1.Tag(0).ContextSpecific()) {
+			return nil, errors.New("x509: invalid authority key identifier")
+		}
+		return akid, nil
+	}
+	return nil, nil
+}
+
 func parseKeyUsageExtension(der cryptobyte.String) (KeyUsage, error) {
 	var usageBits asn1.BitString
 	if !der.ReadASN1BitString(&usageBits) {
@@ -461,6 +487,77 @@ func parseCertificatePoliciesExtension(der cryptobyte.String) ([]asn1.ObjectIden
 	return oids, nil
 }
 
+func parsePolicyMappingsExtension(der cryptobyte.String) ([]PolicyMapping, error) {
+	var mappings []PolicyMapping
+	if !der.ReadASN1(&der, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: invalid policy mappings")
+	}
+	for !der.Empty() {
+		var mappingDER cryptobyte.String
+		var mapping PolicyMapping
+		if !der.ReadASN1(&mappingDER, cryptobyte_asn1.SEQUENCE) ||
+			!mappingDER.ReadASN1ObjectIdentifier(&mapping.IssuerDomainPolicy) ||
+			!mappingDER.ReadASN1ObjectIdentifier(&mapping.SubjectDomainPolicy) ||
+			!mappingDER.Empty() {
+			return nil, errors.New("x509: invalid policy mappings")
+		}
+		mappings = append(mappings, mapping)
+	}
+	if len(mappings) == 0 {
+		return nil, errors.New("x509: invalid policy mappings")
+	}
+	return mappings, nil
+}
+
+// parseSkipCerts reads an optional SkipCerts value with the given implicit
+// tag, as used by the policy constraints and inhibit anyPolicy extensions.
+func parseSkipCerts(der *cryptobyte.String, tag cryptobyte_asn1.Tag) (value int, present bool, ok bool) {
+	if !der.PeekASN1Tag(tag) {
+		return 0, false, true
+	}
+	var v int64
+	if !der.ReadASN1Int64WithTag(&v, tag) || v < 0 || v > math.MaxInt32 {
+		return 0, false, false
+	}
+	return int(v), true, true
+}
+
+func parsePolicyConstraintsExtension(out *Certificate, der cryptobyte.String) error {
+	if !der.ReadASN1(&der, cryptobyte_asn1.SEQUENCE) {
+		return errors.New("x509: invalid policy constraints")
+	}
+	requireExplicitPolicy, hasRequireExplicitPolicy, ok := parseSkipCerts(&der, cryptobyte_asn1.Tag(0).ContextSpecific())
+	if !ok {
+		return errors.New("x509: invalid policy constraints")
+	}
+	inhibitPolicyMapping, hasInhibitPolicyMapping, ok := parseSkipCerts(&der, cryptobyte_asn1.Tag(1).ContextSpecific())
+	if !ok {
+		return errors.New("x509: invalid policy constraints")
+	}
+	// RFC 5280, 4.2.1.11: Conforming CAs MUST NOT issue certificates where
+	// policyConstraints is an empty sequence.
+	if !der.Empty() || (!hasRequireExplicitPolicy && !hasInhibitPolicyMapping) {
+		return errors.New("x509: invalid policy constraints")
+	}
+	if hasRequireExplicitPolicy {
+		out.RequireExplicitPolicy = requireExplicitPolicy
+		out.RequireExplicitPolicyZero = requireExplicitPolicy == 0
+	}
+	if hasInhibitPolicyMapping {
+		out.InhibitPolicyMapping = inhibitPolicyMapping
+		out.InhibitPolicyMappingZero = inhibitPolicyMapping == 0
+	}
+	return nil
+}
+
+func parseInhibitAnyPolicyExtension(der cryptobyte.String) (int, error) {
+	value, present, ok := parseSkipCerts(&der, cryptobyte_asn1.INTEGER)
+	if !ok || !present || !der.Empty() {
+		return 0, errors.New("x509: invalid inhibit anyPolicy")
+	}
+	return value, nil
+}
+
 // isValidIPMask reports whether mask consists of zero or more 1 bits, followed by zero bits.
 func isValidIPMask(mask []byte) bool {
 	seenZero := false
@@ -729,16 +826,9 @@ func processExtensions(out *Certificate) error {
 
 			case 35:
 				// RFC 5280, 4.2.1.1
-				val := cryptobyte.String(e.Value)
-				var akid cryptobyte.String
-				if !val.ReadASN1(&akid, cryptobyte_asn1.SEQUENCE) {
-					return errors.New("x509: invalid authority key identifier")
-				}
-				if akid.PeekASN1Tag(cryptobyte_asn1.Tag(0).ContextSpecific()) {
-					if !akid.ReadASN1(&akid, cryptobyte_asn1.Tag(0).ContextSpecific()) {
-						return errors.New("x509: invalid authority key identifier")
-					}
-					out.AuthorityKeyId = akid
+				out.AuthorityKeyId, err = parseAuthorityKeyIdExtension(e.Value)
+				if err != nil {
+					return err
 				}
 			case 37:
 				out.ExtKeyUsage, out.UnknownExtKeyUsage, err = parseExtKeyUsageExtension(e.Value)
@@ -758,6 +848,21 @@ func processExtensions(out *Certificate) error {
 				if err != nil {
 					return err
 				}
+			case 33:
+				out.PolicyMappings, err = parsePolicyMappingsExtension(e.Value)
+				if err != nil {
+					return err
+				}
+			case 36:
+				if err := parsePolicyConstraintsExtension(out, e.Value); err != nil {
+					return err
+				}
+			case 54:
+				out.InhibitAnyPolicy, err = parseInhibitAnyPolicyExtension(e.Value)
+				if err != nil {
+					return err
+				}
+				out.InhibitAnyPolicyZero = out.InhibitAnyPolicy == 0
 			default:
 				// Unknown extensions are recorded if critical.
 				unhandled = true
@@ -803,6 +908,25 @@ func processExtensions(out *Certificate) error {
 	return nil
 }
 
+// parseRawSubject returns the subject of the DER-encoded certificate der,
+// without parsing the rest of the certificate. It's used to index certificates
+// which are only parsed when needed.
+func parseRawSubject(der []byte) ([]byte, bool) {
+	input := cryptobyte.String(der)
+	var cert, tbs, subject cryptobyte.String
+	if !input.ReadASN1(&cert, cryptobyte_asn1.SEQUENCE) || !input.Empty() ||
+		!cert.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) ||
+		!tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		!tbs.SkipASN1(cryptobyte_asn1.INTEGER) || // serialNumber
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) || // signature
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) || // issuer
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) || // validity
+		!tbs.ReadASN1Element(&subject, cryptobyte_asn1.SEQUENCE) {
+		return nil, false
+	}
+	return subject, true
+}
+
 func parseCertificate(der []byte) (*Certificate, error) {
 	cert := &Certificate{}
 
@@ -1004,3 +1128,197 @@ func ParseCertificates(der []byte) ([]*Certificate, error) {
 	}
 	return certs, nil
 }
+
+// ParseRevocationList parses a X509 v2 Certificate Revocation List from the
+// given ASN.1 DER data.
+func ParseRevocationList(der []byte) (*RevocationList, error) {
+	rl := &RevocationList{}
+
+	input := cryptobyte.String(der)
+	// we read the SEQUENCE including length and tag bytes so that
+	// we can populate RevocationList.Raw, before unwrapping the
+	// SEQUENCE so it can be operated on
+	if !input.ReadASN1Element(&input, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed crl")
+	}
+	rl.Raw = input
+	if !input.ReadASN1(&input, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed crl")
+	}
+	if len(der) != len(rl.Raw) {
+		return nil, errors.New("x509: trailing data")
+	}
+
+	var tbs cryptobyte.String
+	// do the same trick again as above to extract the raw
+	// bytes for RevocationList.RawTBSRevocationList
+	if !input.ReadASN1Element(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed tbs crl")
+	}
+	rl.RawTBSRevocationList = tbs
+	if !tbs.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed tbs crl")
+	}
+
+	var version int
+	if !tbs.PeekASN1Tag(cryptobyte_asn1.INTEGER) {
+		return nil, errors.New("x509: unsupported crl version")
+	}
+	if !tbs.ReadASN1Integer(&version) {
+		return nil, errors.New("x509: malformed crl")
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("x509: unsupported crl version: %d", version)
+	}
+
+	var sigAISeq cryptobyte.String
+	if !tbs.ReadASN1(&sigAISeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed signature algorithm identifier")
+	}
+	// Before parsing the inner algorithm identifier, extract
+	// the outer algorithm identifier and make sure that they
+	// match.
+	var outerSigAISeq cryptobyte.String
+	if !input.ReadASN1(&outerSigAISeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed algorithm identifier")
+	}
+	if !bytes.Equal(outerSigAISeq, sigAISeq) {
+		return nil, errors.New("x509: inner and outer signature algorithm identifiers don't match")
+	}
+	sigAI, err := parseAI(sigAISeq)
+	if err != nil {
+		return nil, err
+	}
+	rl.SignatureAlgorithm = getSignatureAlgorithmFromAI(sigAI)
+
+	var signature asn1.BitString
+	if !input.ReadASN1BitString(&signature) {
+		return nil, errors.New("x509: malformed signature")
+	}
+	rl.Signature = signature.RightAlign()
+
+	var issuerSeq cryptobyte.String
+	if !tbs.ReadASN1Element(&issuerSeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed issuer")
+	}
+	rl.RawIssuer = issuerSeq
+	issuerRDNs, err := parseName(issuerSeq)
+	if err != nil {
+		return nil, err
+	}
+	rl.Issuer.FillFromRDNSequence(issuerRDNs)
+
+	rl.ThisUpdate, err = parseTime(&tbs)
+	if err != nil {
+		return nil, err
+	}
+	if tbs.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime) || tbs.PeekASN1Tag(cryptobyte_asn1.UTCTime) {
+		rl.NextUpdate, err = parseTime(&tbs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tbs.PeekASN1Tag(cryptobyte_asn1.SEQUENCE) {
+		var revokedSeq cryptobyte.String
+		if !tbs.ReadASN1(&revokedSeq, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: malformed crl")
+		}
+		for !revokedSeq.Empty() {
+			rce := RevocationListEntry{}
+
+			var certSeq cryptobyte.String
+			if !revokedSeq.ReadASN1Element(&certSeq, cryptobyte_asn1.SEQUENCE) {
+				return nil, errors.New("x509: malformed crl")
+			}
+			rce.Raw = certSeq
+			if !certSeq.ReadASN1(&certSeq, cryptobyte_asn1.SEQUENCE) {
+				return nil, errors.New("x509: malformed crl")
+			}
+
+			rce.SerialNumber = new(big.Int)
+			if !certSeq.ReadASN1Integer(rce.SerialNumber) {
+				return nil, errors.New("x509: malformed serial number")
+			}
+			rce.RevocationTime, err = parseTime(&certSeq)
+			if err != nil {
+				return nil, err
+			}
+			var extensions cryptobyte.String
+			var present bool
+			if !certSeq.ReadOptionalASN1(&extensions, &present, cryptobyte_asn1.SEQUENCE) {
+				return nil, errors.New("x509: malformed extensions")
+			}
+			if present {
+				for !extensions.Empty() {
+					var extension cryptobyte.String
+					if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) {
+						return nil, errors.New("x509: malformed extension")
+					}
+					ext, err := parseExtension(extension)
+					if err != nil {
+						return nil, err
+					}
+					if ext.Id.Equal(oidExtensionReasonCode) {
+						val := cryptobyte.String(ext.Value)
+						if !val.ReadASN1Enum(&rce.ReasonCode) {
+							return nil, fmt.Errorf("x509: malformed reasonCode extension")
+						}
+					}
+					rce.Extensions = append(rce.Extensions, ext)
+				}
+			}
+
+			rl.RevokedCertificateEntries = append(rl.RevokedCertificateEntries, rce)
+			rcDeprecated := pkix.RevokedCertificate{
+				SerialNumber:   rce.SerialNumber,
+				RevocationTime: rce.RevocationTime,
+				Extensions:     rce.Extensions,
+			}
+			rl.RevokedCertificates = append(rl.RevokedCertificates, rcDeprecated)
+		}
+	}
+
+	var extensions cryptobyte.String
+	var present bool
+	if !tbs.ReadOptionalASN1(&extensions, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, errors.New("x509: malformed extensions")
+	}
+	if present {
+		if !extensions.ReadASN1(&extensions, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: malformed extensions")
+		}
+		for !extensions.Empty() {
+			var extension cryptobyte.String
+			if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) {
+				return nil, errors.New("x509: malformed extension")
+			}
+			ext, err := parseExtension(extension)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case ext.Id.Equal(oidExtensionAuthorityKeyId):
+				rl.AuthorityKeyId, err = parseAuthorityKeyIdExtension(ext.Value)
+				if err != nil {
+					return nil, err
+				}
+			case ext.Id.Equal(oidExtensionCRLNumber):
+				value := cryptobyte.String(ext.Value)
+				rl.Number = new(big.Int)
+				if !value.ReadASN1Integer(rl.Number) {
+					return nil, errors.New("x509: malformed crl number")
+				}
+			case ext.Id.Equal(oidExtensionDeltaCRLIndicator):
+				value := cryptobyte.String(ext.Value)
+				rl.BaseCRLNumber = new(big.Int)
+				if !value.ReadASN1Integer(rl.BaseCRLNumber) {
+					return nil, errors.New("x509: malformed delta crl indicator")
+				}
+			}
+			rl.Extensions = append(rl.Extensions, ext)
+		}
+	}
+
+	return rl, nil
+}
@@ -10,22 +10,94 @@ package x509
 // and run "go generate". See https://golang.org/issue/38843.
 //go:generate go run root_ios_gen.go -version 55188.120.1.0.1
 
-import "sync"
+import (
+	"os"
+	"strings"
+	"sync"
+)
 
 var (
 	once           sync.Once
+	systemRootsMu  sync.RWMutex
 	systemRoots    *CertPool
 	systemRootsErr error
+
+	// systemRootsLoaded is set once initSystemRoots has run.
+	systemRootsLoaded bool
+	// fallbackRoots is the pool set by SetFallbackRoots, if any.
+	fallbackRoots *CertPool
 )
 
+// forceFallbackRoots makes the fallback roots replace the system roots even
+// when system roots are available, for testing a root bundle.
+var forceFallbackRoots = strings.Contains(os.Getenv("GODEBUG"), "x509usefallbackroots=1")
+
 func systemRootsPool() *CertPool {
 	once.Do(initSystemRoots)
+	systemRootsMu.RLock()
+	defer systemRootsMu.RUnlock()
 	return systemRoots
 }
 
+// systemRootsError returns the error encountered loading the system roots,
+// if there are no system roots.
+func systemRootsError() error {
+	once.Do(initSystemRoots)
+	systemRootsMu.RLock()
+	defer systemRootsMu.RUnlock()
+	return systemRootsErr
+}
+
 func initSystemRoots() {
+	systemRootsMu.Lock()
+	defer systemRootsMu.Unlock()
 	systemRoots, systemRootsErr = loadSystemRoots()
 	if systemRootsErr != nil {
 		systemRoots = nil
 	}
+	systemRootsLoaded = true
+	useFallbackRoots()
+}
+
+// useFallbackRoots replaces the system roots with the fallback roots, if there
+// are any, and no system roots were found. systemRootsMu must be held.
+func useFallbackRoots() {
+	if fallbackRoots == nil {
+		return
+	}
+	if systemRoots != nil && systemRoots.len() > 0 && !forceFallbackRoots {
+		return
+	}
+	systemRoots, systemRootsErr = fallbackRoots, nil
+}
+
+// SetFallbackRoots sets the roots to use when no custom roots are specified
+// and no system roots are found, for example in a minimal container image
+// without a CA bundle. It is meant to be called from the init function of a
+// package providing a root bundle, which can use
+// CertPool.AppendLazyCertsFromPEM so that programs only pay for parsing the
+// roots they use.
+//
+// The fallback roots are used by Verify when VerifyOptions.Roots is nil, and
+// returned by SystemCertPool. Platforms that use a platform verifier, such as
+// Windows, keep using it unless VerifyOptions.DisablePlatformVerifier is set.
+// Setting GODEBUG=x509usefallbackroots=1 makes the fallback roots replace the
+// system roots even when system roots are available.
+//
+// The system roots are still loaded lazily: SetFallbackRoots doesn't cause
+// them to be loaded. SetFallbackRoots panics if roots is nil, or if it is
+// called more than once.
+func SetFallbackRoots(roots *CertPool) {
+	if roots == nil {
+		panic("crypto/x509: SetFallbackRoots called with nil roots")
+	}
+	systemRootsMu.Lock()
+	defer systemRootsMu.Unlock()
+	if fallbackRoots != nil {
+		panic("crypto/x509: SetFallbackRoots called more than once")
+	}
+	fallbackRoots = roots
+	if systemRootsLoaded {
+		useFallbackRoots()
+	}
 }
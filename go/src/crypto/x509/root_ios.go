@@ -12,7 +12,7 @@ func (c *Certificate) systemVerify(opts *VerifyOptions) (chains [][]*Certificate
 
 func loadSystemRoots() (*CertPool, error) {
 	p := NewCertPool()
-	p.AppendCertsFromPEM([]byte(systemRootsPEM))
+	p.AppendLazyCertsFromPEM([]byte(systemRootsPEM))
 	return p, nil
 }
 
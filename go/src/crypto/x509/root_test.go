@@ -0,0 +1,68 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"testing"
+)
+
+func TestSetFallbackRoots(t *testing.T) {
+	// Make sure the system roots are loaded, then swap in test state.
+	systemRootsPool()
+	systemRootsMu.Lock()
+	oldRoots, oldErr, oldFallback := systemRoots, systemRootsErr, fallbackRoots
+	systemRootsMu.Unlock()
+	defer func() {
+		systemRootsMu.Lock()
+		systemRoots, systemRootsErr, fallbackRoots = oldRoots, oldErr, oldFallback
+		systemRootsMu.Unlock()
+	}()
+
+	fallback := NewCertPool()
+	fallback.AddCert(mustCertificateFromPEM(t, geoTrustRoot))
+	system := NewCertPool()
+	system.AddCert(mustCertificateFromPEM(t, startComRoot))
+
+	expectPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s didn't panic", name)
+			}
+		}()
+		f()
+	}
+	expectPanic("SetFallbackRoots(nil)", func() { SetFallbackRoots(nil) })
+
+	for _, tt := range []struct {
+		name         string
+		systemRoots  *CertPool
+		wantFallback bool
+	}{
+		{"no system roots", nil, true},
+		{"empty system roots", NewCertPool(), true},
+		{"system roots", system, false},
+	} {
+		systemRootsMu.Lock()
+		systemRoots, systemRootsErr, fallbackRoots = tt.systemRoots, nil, nil
+		systemRootsMu.Unlock()
+
+		SetFallbackRoots(fallback)
+		want := tt.systemRoots
+		if tt.wantFallback {
+			want = fallback
+		}
+		if got := systemRootsPool(); got != want {
+			t.Errorf("%s: system roots pool is not the expected one", tt.name)
+		}
+		pool, err := SystemCertPool()
+		if err != nil {
+			t.Errorf("%s: SystemCertPool failed: %v", tt.name, err)
+		} else if !pool.Equal(want) {
+			t.Errorf("%s: SystemCertPool returned unexpected roots", tt.name)
+		}
+		expectPanic("second SetFallbackRoots", func() { SetFallbackRoots(fallback) })
+	}
+}
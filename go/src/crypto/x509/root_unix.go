@@ -42,7 +42,7 @@ func loadSystemRoots() (*CertPool, error) {
 	for _, file := range files {
 		data, err := os.ReadFile(file)
 		if err == nil {
-			roots.AppendCertsFromPEM(data)
+			roots.AppendLazyCertsFromPEM(data)
 			break
 		}
 		if firstErr == nil && !os.IsNotExist(err) {
@@ -70,7 +70,7 @@ func loadSystemRoots() (*CertPool, error) {
 		for _, fi := range fis {
 			data, err := os.ReadFile(directory + "/" + fi.Name())
 			if err == nil {
-				roots.AppendCertsFromPEM(data)
+				roots.AppendLazyCertsFromPEM(data)
 			}
 		}
 	}
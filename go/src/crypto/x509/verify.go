@@ -6,13 +6,17 @@ package x509
 
 import (
 	"bytes"
+	"encoding/asn1"
 	"errors"
 	"fmt"
+	"math/big"
 	"net"
 	"net/url"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 )
@@ -54,6 +58,14 @@ const (
 	// CANotAuthorizedForExtKeyUsage results when an intermediate or root
 	// certificate does not permit a requested extended key usage.
 	CANotAuthorizedForExtKeyUsage
+	// Revoked results when a certificate has been revoked by its issuer,
+	// according to the revocation information consulted by
+	// VerifyOptions.CheckRevocation.
+	Revoked
+	// InvalidPolicy results when a chain is not valid for any certificate
+	// policy, and one is required by VerifyOptions.CertificatePolicies or by
+	// the policy constraints of a certificate in the chain.
+	InvalidPolicy
 )
 
 // CertificateInvalidError results when an odd error occurs. Users of this
@@ -84,6 +96,10 @@ func (e CertificateInvalidError) Error() string {
 		return "x509: issuer has name constraints but leaf doesn't have a SAN extension"
 	case UnconstrainedName:
 		return "x509: issuer has name constraints but leaf contains unknown or unconstrained name: " + e.Detail
+	case Revoked:
+		return "x509: certificate has been revoked: " + e.Detail
+	case InvalidPolicy:
+		return "x509: no valid certificate policy for certificate chain"
 	}
 	return "x509: unknown error"
 }
@@ -199,6 +215,37 @@ type VerifyOptions struct {
 	// certificates from consuming excessive amounts of CPU time when
 	// validating. It does not apply to the platform verifier.
 	MaxConstraintComparisions int
+
+	// CheckRevocation, if not nil, is called for every certificate in each
+	// candidate chain, except the root, along with the certificate that
+	// issued it. If it returns an error, that chain is discarded. If every
+	// chain is discarded, Verify returns the first error returned by
+	// CheckRevocation.
+	//
+	// CRLChecker and the crypto/x509/ocsp package provide implementations
+	// backed by CRLs and OCSP responses. Implementations should return a
+	// CertificateInvalidError with Reason Revoked for revoked certificates.
+	//
+	// CheckRevocation is not called by the platform verifier, which
+	// performs its own revocation checking, if any.
+	CheckRevocation func(cert, issuer *Certificate) error
+
+	// CertificatePolicies is the set of acceptable certificate policies,
+	// the user-initial-policy-set of RFC 5280, Section 6.1.1. If not empty,
+	// a chain is only accepted if it is valid for at least one of them, as
+	// if initial-explicit-policy were set. To require a valid policy without
+	// restricting which, use the anyPolicy OID, 2.5.29.32.0.
+	//
+	// If empty, a chain is only rejected for its policies if a certificate
+	// in it requires an explicit policy with its policy constraints.
+	CertificatePolicies []asn1.ObjectIdentifier
+
+	// DisablePlatformVerifier causes Verify to use the Go verifier even
+	// when Roots is nil on platforms that would otherwise use the
+	// platform verifier, such as Windows. The system roots are used if
+	// they are available, otherwise Verify returns a SystemRootsError.
+	// This makes the results consistent across platforms.
+	DisablePlatformVerifier bool
 }
 
 const (
@@ -704,8 +751,9 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 // element of the chain is c and the last element is from opts.Roots.
 //
 // If opts.Roots is nil, the platform verifier might be used, and
-// verification details might differ from what is described below. If system
-// roots are unavailable the returned error will be of type SystemRootsError.
+// verification details might differ from what is described below, unless
+// opts.DisablePlatformVerifier is set. If system roots are unavailable the
+// returned error will be of type SystemRootsError.
 //
 // Name constraints in the intermediates will be applied to all names claimed
 // in the chain, not just opts.DNSName. Thus it is invalid for a leaf to claim
@@ -724,7 +772,11 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 // list. (While this is not specified, it is common practice in order to limit
 // the types of certificates a CA can issue.)
 //
-// WARNING: this function doesn't do any revocation checking.
+// Certificate policies, policy mappings and policy constraints are processed
+// as described in RFC 5280, Section 6.1, with opts.CertificatePolicies as the
+// user-initial-policy-set. Policy qualifiers are ignored.
+//
+// Revocation is only checked if opts.CheckRevocation is set.
 func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err error) {
 	// Platform-specific verification needs the ASN.1 contents so
 	// this makes the behavior consistent across platforms.
@@ -742,37 +794,89 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 	}
 
 	// Use Windows's own verification and chain building.
-	if opts.Roots == nil && runtime.GOOS == "windows" {
+	if opts.Roots == nil && runtime.GOOS == "windows" && !opts.DisablePlatformVerifier {
 		return c.systemVerify(&opts)
 	}
 
+	candidates, err := c.verifyCandidates(&opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if candidate.Err == nil {
+			chains = append(chains, candidate.Chain)
+		}
+	}
+	return chains, nil
+}
+
+// CandidateChain is a chain built by VerifyCandidates.
+type CandidateChain struct {
+	// Chain starts with the verified certificate and ends with a
+	// certificate from VerifyOptions.Roots.
+	Chain []*Certificate
+
+	// Err is nil if the chain is valid. Otherwise, it is the reason the
+	// chain was rejected, such as a CertificateInvalidError with Reason
+	// IncompatibleUsage, InvalidPolicy or Revoked, or an error returned by
+	// VerifyOptions.CheckRevocation.
+	Err error
+}
+
+// VerifyCandidates is like Verify, but it returns every chain built from c to
+// a certificate in opts.Roots, including the ones rejected for their key
+// usages, certificate policies or revocation status, together with the reason
+// they were rejected. The chains Verify would return are the ones with a nil
+// Err.
+//
+// VerifyCandidates always uses the Go verifier, as if
+// opts.DisablePlatformVerifier were set.
+//
+// An error is only returned if no chain could be built, for example because c
+// has expired, doesn't match opts.DNSName or doesn't chain up to opts.Roots.
+func (c *Certificate) VerifyCandidates(opts VerifyOptions) ([]CandidateChain, error) {
+	candidates, err := c.verifyCandidates(&opts)
+	if candidates == nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// verifyCandidates builds the candidate chains for c using the Go verifier,
+// and checks each of them. If no chain could be built, it returns a nil slice
+// and an error. If chains were built but none of them is valid, it returns
+// them along with the error Verify should return.
+func (c *Certificate) verifyCandidates(opts *VerifyOptions) ([]CandidateChain, error) {
 	if opts.Roots == nil {
 		opts.Roots = systemRootsPool()
 		if opts.Roots == nil {
-			return nil, SystemRootsError{systemRootsErr}
+			return nil, SystemRootsError{systemRootsError()}
 		}
 	}
 
-	err = c.isValid(leafCertificate, nil, &opts)
-	if err != nil {
-		return
+	if err := c.isValid(leafCertificate, nil, opts); err != nil {
+		return nil, err
 	}
 
 	if len(opts.DNSName) > 0 {
-		err = c.VerifyHostname(opts.DNSName)
-		if err != nil {
-			return
+		if err := c.VerifyHostname(opts.DNSName); err != nil {
+			return nil, err
 		}
 	}
 
-	var candidateChains [][]*Certificate
+	var chains [][]*Certificate
 	if opts.Roots.contains(c) {
-		candidateChains = append(candidateChains, []*Certificate{c})
+		chains = append(chains, []*Certificate{c})
 	} else {
-		if candidateChains, err = c.buildChains(nil, []*Certificate{c}, nil, &opts); err != nil {
+		var err error
+		if chains, err = c.buildChains(nil, []*Certificate{c}, nil, opts); err != nil {
 			return nil, err
 		}
 	}
+	candidates := make([]CandidateChain, len(chains))
+	for i, chain := range chains {
+		candidates[i].Chain = chain
+	}
 
 	keyUsages := opts.KeyUsages
 	if len(keyUsages) == 0 {
@@ -780,23 +884,193 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 	}
 
 	// If any key usage is acceptable then we're done.
+	anyKeyUsage := false
 	for _, usage := range keyUsages {
 		if usage == ExtKeyUsageAny {
-			return candidateChains, nil
+			anyKeyUsage = true
+			break
 		}
 	}
 
-	for _, candidate := range candidateChains {
-		if checkChainForKeyUsage(candidate, keyUsages) {
-			chains = append(chains, candidate)
+	// Each check only applies to the chains that passed the previous ones,
+	// so if every chain is rejected, the error is from the chains that got
+	// the furthest.
+	if !anyKeyUsage {
+		if err := filterCandidates(candidates, func(chain []*Certificate) error {
+			if !checkChainForKeyUsage(chain, keyUsages) {
+				return CertificateInvalidError{c, IncompatibleUsage, ""}
+			}
+			return nil
+		}); err != nil {
+			return candidates, err
 		}
 	}
 
-	if len(chains) == 0 {
-		return nil, CertificateInvalidError{c, IncompatibleUsage, ""}
+	if err := filterCandidates(candidates, func(chain []*Certificate) error {
+		if !policiesValid(chain, opts) {
+			return CertificateInvalidError{c, InvalidPolicy, ""}
+		}
+		return nil
+	}); err != nil {
+		return candidates, err
 	}
 
-	return chains, nil
+	if opts.CheckRevocation != nil {
+		if err := filterCandidates(candidates, chainRevocationChecker(opts.CheckRevocation)); err != nil {
+			return candidates, err
+		}
+	}
+
+	return candidates, nil
+}
+
+// filterCandidates calls check for each candidate that wasn't rejected yet,
+// and rejects it if check returns an error. If no candidate is left, it
+// returns the first error returned by check.
+func filterCandidates(candidates []CandidateChain, check func(chain []*Certificate) error) error {
+	var firstErr error
+	passed := false
+	for i := range candidates {
+		if candidates[i].Err != nil {
+			continue
+		}
+		if err := check(candidates[i].Chain); err != nil {
+			candidates[i].Err = err
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			passed = true
+		}
+	}
+	if passed {
+		return nil
+	}
+	return firstErr
+}
+
+// chainRevocationChecker returns a function that calls check for every
+// certificate in a chain, except the root, along with its issuer. Many chains
+// share their leaf and intermediates, so it remembers the result for each
+// pair.
+func chainRevocationChecker(check func(cert, issuer *Certificate) error) func(chain []*Certificate) error {
+	type pair struct{ cert, issuer *Certificate }
+	results := make(map[pair]error)
+	return func(chain []*Certificate) error {
+		for i := 0; i < len(chain)-1; i++ {
+			p := pair{chain[i], chain[i+1]}
+			err, ok := results[p]
+			if !ok {
+				err = check(p.cert, p.issuer)
+				results[p] = err
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// CRLChecker returns a function, suitable for VerifyOptions.CheckRevocation,
+// that rejects certificates revoked according to lists, which must have been
+// returned by ParseRevocationList.
+//
+// A CRL is only consulted for a certificate if its issuer matches the
+// certificate's issuer and it is validly signed by the issuing certificate.
+// For each issuer, the complete CRL with the highest Number is used, together
+// with any newer delta CRLs that apply to it. Entries in delta CRLs with
+// reason ReasonRemoveFromCRL release certificates that were on hold.
+//
+// CRLChecker doesn't check ThisUpdate, NextUpdate or the scope of the CRLs;
+// callers are responsible for providing current and relevant CRLs.
+// Certificates for which no CRL is available are accepted.
+func CRLChecker(lists ...*RevocationList) func(cert, issuer *Certificate) error {
+	type signedBy struct {
+		rl     *RevocationList
+		issuer *Certificate
+	}
+	var mu sync.Mutex
+	validSignatures := make(map[signedBy]bool)
+	isSignedBy := func(rl *RevocationList, issuer *Certificate) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		k := signedBy{rl, issuer}
+		valid, ok := validSignatures[k]
+		if !ok {
+			valid = rl.CheckSignatureFrom(issuer) == nil
+			validSignatures[k] = valid
+		}
+		return valid
+	}
+
+	return func(cert, issuer *Certificate) error {
+		var base *RevocationList
+		var deltas []*RevocationList
+		for _, rl := range lists {
+			if !bytes.Equal(rl.RawIssuer, cert.RawIssuer) || !isSignedBy(rl, issuer) {
+				continue
+			}
+			if rl.BaseCRLNumber != nil {
+				deltas = append(deltas, rl)
+			} else if base == nil || crlNumberLess(base.Number, rl.Number) {
+				base = rl
+			}
+		}
+		if base == nil {
+			return nil
+		}
+
+		revokedBy := base
+		entry := findRevocationListEntry(base, cert.SerialNumber)
+		if base.Number != nil {
+			sort.Slice(deltas, func(i, j int) bool {
+				return crlNumberLess(deltas[i].Number, deltas[j].Number)
+			})
+			for _, delta := range deltas {
+				// A delta CRL applies to complete CRLs at least as new as
+				// its base, and is superseded by complete CRLs as new as it.
+				if delta.BaseCRLNumber.Cmp(base.Number) > 0 || !crlNumberLess(base.Number, delta.Number) {
+					continue
+				}
+				e := findRevocationListEntry(delta, cert.SerialNumber)
+				switch {
+				case e == nil:
+				case e.ReasonCode == ReasonRemoveFromCRL:
+					entry = nil
+				default:
+					entry, revokedBy = e, delta
+				}
+			}
+		}
+		if entry == nil || entry.ReasonCode == ReasonRemoveFromCRL {
+			return nil
+		}
+
+		detail := fmt.Sprintf("serial number %x revoked at %v with reason %d", cert.SerialNumber, entry.RevocationTime, entry.ReasonCode)
+		if revokedBy.Number != nil {
+			detail += fmt.Sprintf(" by CRL number %v", revokedBy.Number)
+		}
+		return CertificateInvalidError{cert, Revoked, detail}
+	}
+}
+
+// crlNumberLess reports whether a is lower than b, where a nil number is
+// lower than any other.
+func crlNumberLess(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	return a.Cmp(b) < 0
+}
+
+func findRevocationListEntry(rl *RevocationList, serial *big.Int) *RevocationListEntry {
+	for i := range rl.RevokedCertificateEntries {
+		if rl.RevokedCertificateEntries[i].SerialNumber.Cmp(serial) == 0 {
+			return &rl.RevokedCertificateEntries[i]
+		}
+	}
+	return nil
 }
 
 func appendToFreshChain(chain []*Certificate, cert *Certificate) []*Certificate {
@@ -1106,3 +1380,316 @@ NextCert:
 
 	return true
 }
+
+var oidAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+// policyGraphNode is a node of a policyGraph, with the valid_policy and
+// expected_policy_set of the corresponding valid_policy_tree nodes.
+type policyGraphNode struct {
+	validPolicy       asn1.ObjectIdentifier
+	expectedPolicySet []asn1.ObjectIdentifier
+	parents           map[*policyGraphNode]bool
+	children          map[*policyGraphNode]bool
+}
+
+func (n *policyGraphNode) expects(policy asn1.ObjectIdentifier) bool {
+	for _, p := range n.expectedPolicySet {
+		if p.Equal(policy) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyGraph is the valid_policy_tree of RFC 5280, Section 6.1.2, with the
+// nodes that have the same depth and valid_policy merged into one. It has the
+// same meaning as the tree, but doesn't grow exponentially with the number of
+// certificates in the chain. See RFC 9618.
+type policyGraph struct {
+	// levels holds the nodes at each depth, indexed by valid_policy.
+	levels []map[string]*policyGraphNode
+}
+
+func newPolicyGraph() *policyGraph {
+	root := &policyGraphNode{
+		validPolicy:       oidAnyPolicy,
+		expectedPolicySet: []asn1.ObjectIdentifier{oidAnyPolicy},
+		parents:           make(map[*policyGraphNode]bool),
+		children:          make(map[*policyGraphNode]bool),
+	}
+	return &policyGraph{levels: []map[string]*policyGraphNode{{oidAnyPolicy.String(): root}}}
+}
+
+func (pg *policyGraph) depth() int {
+	return len(pg.levels) - 1
+}
+
+func (pg *policyGraph) leaves() map[string]*policyGraphNode {
+	return pg.levels[pg.depth()]
+}
+
+func (pg *policyGraph) incrDepth() {
+	pg.levels = append(pg.levels, make(map[string]*policyGraphNode))
+}
+
+// addLeaf returns the node for policy at the current depth, creating it with
+// the given expected_policy_set if needed, and makes it a child of parents.
+func (pg *policyGraph) addLeaf(policy asn1.ObjectIdentifier, expected []asn1.ObjectIdentifier, parents ...*policyGraphNode) *policyGraphNode {
+	leaves := pg.leaves()
+	n, ok := leaves[policy.String()]
+	if !ok {
+		n = &policyGraphNode{
+			validPolicy:       policy,
+			expectedPolicySet: expected,
+			parents:           make(map[*policyGraphNode]bool),
+			children:          make(map[*policyGraphNode]bool),
+		}
+		leaves[policy.String()] = n
+	}
+	for _, parent := range parents {
+		n.parents[parent] = true
+		parent.children[n] = true
+	}
+	return n
+}
+
+func (pg *policyGraph) removeNode(depth int, n *policyGraphNode) {
+	for parent := range n.parents {
+		delete(parent.children, n)
+	}
+	for child := range n.children {
+		delete(child.parents, n)
+	}
+	delete(pg.levels[depth], n.validPolicy.String())
+}
+
+// prune removes the nodes above the current depth that have no children, and
+// reports whether any node is left.
+func (pg *policyGraph) prune() bool {
+	for d := pg.depth() - 1; d >= 0; d-- {
+		for _, n := range pg.levels[d] {
+			if len(n.children) == 0 {
+				pg.removeNode(d, n)
+			}
+		}
+	}
+	return len(pg.levels[0]) > 0
+}
+
+// restrictToPolicies implements RFC 5280, Section 6.1.5, step (g): it removes
+// the paths of the graph that are not valid for any of policies, and reports
+// whether any node is left.
+func (pg *policyGraph) restrictToPolicies(policies []asn1.ObjectIdentifier) bool {
+	acceptable := make(map[string]bool)
+	for _, p := range policies {
+		acceptable[p.String()] = true
+	}
+	anyPolicy := oidAnyPolicy.String()
+
+	// A path leaves the chain of anyPolicy nodes at the node where its
+	// policy is first asserted, and that policy is what the user-initial-
+	// policy-set applies to. Policies mapped further down are equivalent.
+	for d := 1; d <= pg.depth(); d++ {
+		parent := pg.levels[d-1][anyPolicy]
+		if parent == nil {
+			break
+		}
+		for child := range parent.children {
+			if !child.validPolicy.Equal(oidAnyPolicy) && !acceptable[child.validPolicy.String()] {
+				delete(parent.children, child)
+				delete(child.parents, parent)
+			}
+		}
+	}
+
+	// An anyPolicy leaf stands for every acceptable policy.
+	if leaf := pg.leaves()[anyPolicy]; leaf != nil {
+		var parents []*policyGraphNode
+		for parent := range leaf.parents {
+			parents = append(parents, parent)
+		}
+		pg.removeNode(pg.depth(), leaf)
+		for _, p := range policies {
+			pg.addLeaf(p, []asn1.ObjectIdentifier{p}, parents...)
+		}
+	}
+
+	// Remove the nodes that are no longer reachable from the root, then the
+	// ones that no longer lead to a leaf.
+	for d := 1; d <= pg.depth(); d++ {
+		for _, n := range pg.levels[d] {
+			if len(n.parents) == 0 {
+				pg.removeNode(d, n)
+			}
+		}
+	}
+	return pg.prune()
+}
+
+// policiesValid reports whether chain is valid according to the certificate
+// policy processing of RFC 5280, Section 6.1, with opts.CertificatePolicies as
+// the user-initial-policy-set. The trust anchor, the last certificate in the
+// chain, is not processed.
+func policiesValid(chain []*Certificate, opts *VerifyOptions) bool {
+	n := len(chain) - 1
+	if n == 0 {
+		return true
+	}
+
+	// The counters start at n+1, so that they only matter if a constraint
+	// sets them lower.
+	explicitPolicy := n + 1
+	policyMapping := n + 1
+	inhibitAnyPolicy := n + 1
+	if len(opts.CertificatePolicies) > 0 {
+		explicitPolicy = 0
+	}
+	pg := newPolicyGraph()
+
+	// Process the certificates from the one issued by the trust anchor down
+	// to the leaf.
+	for i := n - 1; i >= 0; i-- {
+		cert := chain[i]
+		isLeaf := i == 0
+		selfIssued := bytes.Equal(cert.RawSubject, cert.RawIssuer)
+
+		// 6.1.3 (d) and (e): Process the certificate policies.
+		if pg != nil && len(cert.PolicyIdentifiers) > 0 {
+			pg.incrDepth()
+			parents := pg.levels[pg.depth()-1]
+			hasAnyPolicy := false
+			for _, policy := range cert.PolicyIdentifiers {
+				if policy.Equal(oidAnyPolicy) {
+					hasAnyPolicy = true
+					continue
+				}
+				matched := false
+				for _, parent := range parents {
+					if parent.expects(policy) {
+						pg.addLeaf(policy, []asn1.ObjectIdentifier{policy}, parent)
+						matched = true
+					}
+				}
+				if !matched {
+					if parent := parents[oidAnyPolicy.String()]; parent != nil {
+						pg.addLeaf(policy, []asn1.ObjectIdentifier{policy}, parent)
+					}
+				}
+			}
+			if hasAnyPolicy && (inhibitAnyPolicy > 0 || (!isLeaf && selfIssued)) {
+				asserted := make(map[string]bool)
+				for policy := range pg.leaves() {
+					asserted[policy] = true
+				}
+				for _, parent := range parents {
+					for _, policy := range parent.expectedPolicySet {
+						if !asserted[policy.String()] {
+							pg.addLeaf(policy, []asn1.ObjectIdentifier{policy}, parent)
+						}
+					}
+				}
+			}
+			if !pg.prune() {
+				pg = nil
+			}
+		} else {
+			pg = nil
+		}
+
+		// 6.1.3 (f)
+		if explicitPolicy == 0 && pg == nil {
+			return false
+		}
+
+		if isLeaf {
+			break
+		}
+
+		// 6.1.4 (a) and (b): Process the policy mappings.
+		if len(cert.PolicyMappings) > 0 {
+			var issuerPolicies []asn1.ObjectIdentifier
+			mappings := make(map[string][]asn1.ObjectIdentifier)
+			for _, m := range cert.PolicyMappings {
+				if m.IssuerDomainPolicy.Equal(oidAnyPolicy) || m.SubjectDomainPolicy.Equal(oidAnyPolicy) {
+					return false
+				}
+				k := m.IssuerDomainPolicy.String()
+				if _, ok := mappings[k]; !ok {
+					issuerPolicies = append(issuerPolicies, m.IssuerDomainPolicy)
+				}
+				mappings[k] = append(mappings[k], m.SubjectDomainPolicy)
+			}
+			if pg != nil {
+				leaves := pg.leaves()
+				anyPolicyLeaf := leaves[oidAnyPolicy.String()]
+				for _, policy := range issuerPolicies {
+					k := policy.String()
+					node := leaves[k]
+					if policyMapping == 0 {
+						if node != nil {
+							pg.removeNode(pg.depth(), node)
+						}
+						continue
+					}
+					if node != nil {
+						node.expectedPolicySet = mappings[k]
+					} else if anyPolicyLeaf != nil {
+						var parents []*policyGraphNode
+						for parent := range anyPolicyLeaf.parents {
+							parents = append(parents, parent)
+						}
+						pg.addLeaf(policy, mappings[k], parents...)
+					}
+				}
+				if policyMapping == 0 && !pg.prune() {
+					pg = nil
+				}
+			}
+		}
+
+		// 6.1.4 (h), (i) and (j): Update the counters.
+		if !selfIssued {
+			if explicitPolicy > 0 {
+				explicitPolicy--
+			}
+			if policyMapping > 0 {
+				policyMapping--
+			}
+			if inhibitAnyPolicy > 0 {
+				inhibitAnyPolicy--
+			}
+		}
+		if v, ok := skipCerts(cert.RequireExplicitPolicy, cert.RequireExplicitPolicyZero); ok && v < explicitPolicy {
+			explicitPolicy = v
+		}
+		if v, ok := skipCerts(cert.InhibitPolicyMapping, cert.InhibitPolicyMappingZero); ok && v < policyMapping {
+			policyMapping = v
+		}
+		if v, ok := skipCerts(cert.InhibitAnyPolicy, cert.InhibitAnyPolicyZero); ok && v < inhibitAnyPolicy {
+			inhibitAnyPolicy = v
+		}
+	}
+
+	// 6.1.5 (a) and (b)
+	if explicitPolicy > 0 {
+		explicitPolicy--
+	}
+	if v, ok := skipCerts(chain[0].RequireExplicitPolicy, chain[0].RequireExplicitPolicyZero); ok && v == 0 {
+		explicitPolicy = 0
+	}
+
+	// 6.1.5 (g)
+	if pg != nil && len(opts.CertificatePolicies) > 0 {
+		anyAcceptable := false
+		for _, p := range opts.CertificatePolicies {
+			if p.Equal(oidAnyPolicy) {
+				anyAcceptable = true
+			}
+		}
+		if !anyAcceptable && !pg.restrictToPolicies(opts.CertificatePolicies) {
+			pg = nil
+		}
+	}
+
+	return explicitPolicy > 0 || pg != nil
+}
@@ -10,6 +10,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -1968,3 +1969,631 @@ func TestSystemRootsErrorUnwrap(t *testing.T) {
 		t.Error("errors.Is failed, wanted success")
 	}
 }
+
+func TestCRLChecker(t *testing.T) {
+	newCA := func(cn string) (*Certificate, crypto.Signer) {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, priv
+	}
+	root, rootKey := newCA("CRL Root")
+	// impostor has the same name as root, but a different key.
+	impostor, impostorKey := newCA("CRL Root")
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER, err := CreateCertificate(rand.Reader, &Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     KeyUsageDigitalSignature,
+		ExtKeyUsage:  []ExtKeyUsage{ExtKeyUsageServerAuth},
+	}, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// crl creates a CRL numbered number, listing the leaf with reason if
+	// reason is not negative. If base is not zero, it's a delta CRL.
+	crl := func(issuer *Certificate, priv crypto.Signer, number, base int64, reason int) *RevocationList {
+		template := &RevocationList{
+			Number:     big.NewInt(number),
+			ThisUpdate: time.Now().Add(-time.Hour),
+			NextUpdate: time.Now().Add(time.Hour),
+		}
+		if base != 0 {
+			template.BaseCRLNumber = big.NewInt(base)
+		}
+		if reason >= 0 {
+			template.RevokedCertificateEntries = []RevocationListEntry{{
+				SerialNumber:   leaf.SerialNumber,
+				RevocationTime: time.Now().Add(-time.Minute),
+				ReasonCode:     reason,
+			}}
+		}
+		der, err := CreateRevocationList(rand.Reader, template, issuer, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rl, err := ParseRevocationList(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rl
+	}
+	const notListed = -1
+
+	tests := []struct {
+		name    string
+		lists   []*RevocationList
+		revoked bool
+	}{
+		{"no CRLs", nil, false},
+		{"not listed", []*RevocationList{crl(root, rootKey, 1, 0, notListed)}, false},
+		{"listed", []*RevocationList{crl(root, rootKey, 1, 0, ReasonKeyCompromise)}, true},
+		{"listed without reason", []*RevocationList{crl(root, rootKey, 1, 0, ReasonUnspecified)}, true},
+		{"listed by impostor", []*RevocationList{crl(impostor, impostorKey, 1, 0, ReasonKeyCompromise)}, false},
+		{"superseded by newer CRL", []*RevocationList{
+			crl(root, rootKey, 2, 0, notListed),
+			crl(root, rootKey, 1, 0, ReasonCertificateHold),
+		}, false},
+		{"listed in delta", []*RevocationList{
+			crl(root, rootKey, 1, 0, notListed),
+			crl(root, rootKey, 2, 1, ReasonCertificateHold),
+		}, true},
+		{"released by delta", []*RevocationList{
+			crl(root, rootKey, 3, 2, ReasonRemoveFromCRL),
+			crl(root, rootKey, 2, 0, ReasonCertificateHold),
+		}, false},
+		{"released and held again", []*RevocationList{
+			crl(root, rootKey, 1, 0, ReasonCertificateHold),
+			crl(root, rootKey, 3, 1, ReasonCertificateHold),
+			crl(root, rootKey, 2, 1, ReasonRemoveFromCRL),
+		}, true},
+		{"delta for newer base", []*RevocationList{
+			crl(root, rootKey, 1, 0, notListed),
+			crl(root, rootKey, 3, 2, ReasonKeyCompromise),
+		}, false},
+		{"delta older than base", []*RevocationList{
+			crl(root, rootKey, 3, 0, notListed),
+			crl(root, rootKey, 2, 1, ReasonKeyCompromise),
+		}, false},
+		{"delta without base", []*RevocationList{crl(root, rootKey, 2, 1, ReasonKeyCompromise)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CRLChecker(tt.lists...)(leaf, root)
+			var invalid CertificateInvalidError
+			isRevoked := errors.As(err, &invalid) && invalid.Reason == Revoked
+			if isRevoked != tt.revoked || (err != nil && !isRevoked) {
+				t.Errorf("got error %v, want revoked: %v", err, tt.revoked)
+			}
+		})
+	}
+
+	roots := NewCertPool()
+	roots.AddCert(root)
+	opts := VerifyOptions{
+		DNSName:         "example.com",
+		Roots:           roots,
+		CheckRevocation: CRLChecker(crl(root, rootKey, 1, 0, ReasonKeyCompromise)),
+	}
+	_, err = leaf.Verify(opts)
+	if invalid, ok := err.(CertificateInvalidError); !ok || invalid.Reason != Revoked || invalid.Cert != leaf {
+		t.Errorf("Verify of a revoked certificate returned %v, want a Revoked error", err)
+	}
+	opts.CheckRevocation = CRLChecker(crl(root, rootKey, 2, 0, notListed))
+	if _, err := leaf.Verify(opts); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestCheckRevocationChains(t *testing.T) {
+	// With two roots, the revocation hook can discard one chain and keep the
+	// other.
+	root1, root1Key, err := generateCert("Root 1", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root2, root2Key, err := generateCert("Root 2", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter, interKey, err := generateCert("Intermediate", true, root1, root1Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cross-sign the intermediate's key by root2.
+	crossDER, err := CreateCertificate(rand.Reader, &Certificate{
+		SerialNumber:          big.NewInt(99),
+		Subject:               inter.Subject,
+		NotBefore:             inter.NotBefore,
+		NotAfter:              inter.NotAfter,
+		KeyUsage:              inter.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root2, inter.PublicKey, root2Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := ParseCertificate(crossDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("leaf", false, inter, interKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := NewCertPool()
+	roots.AddCert(root1)
+	roots.AddCert(root2)
+	intermediates := NewCertPool()
+	intermediates.AddCert(inter)
+	intermediates.AddCert(cross)
+
+	var calls int
+	errRevoked := errors.New("revoked")
+	opts := VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CheckRevocation: func(cert, issuer *Certificate) error {
+			calls++
+			if cert.Equal(inter) && issuer.Equal(root1) {
+				return errRevoked
+			}
+			return nil
+		},
+	}
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(chains) != 1 || !chains[0][2].Equal(root2) {
+		t.Errorf("got %d chains, want only the one through Root 2", len(chains))
+	}
+	// Each chain has two distinct (certificate, issuer) pairs.
+	if calls != 4 {
+		t.Errorf("CheckRevocation called %d times, want 4", calls)
+	}
+
+	opts.CheckRevocation = func(cert, issuer *Certificate) error {
+		if cert.Equal(leaf) {
+			return errRevoked
+		}
+		return nil
+	}
+	if _, err := leaf.Verify(opts); err != errRevoked {
+		t.Errorf("got error %v, want %v", err, errRevoked)
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	p1 := asn1.ObjectIdentifier{1, 2, 3, 1}
+	p2 := asn1.ObjectIdentifier{1, 2, 3, 2}
+	p3 := asn1.ObjectIdentifier{1, 2, 3, 3}
+	any := asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+	policies := func(oids ...asn1.ObjectIdentifier) func(*Certificate) {
+		return func(c *Certificate) { c.PolicyIdentifiers = oids }
+	}
+	mapping := func(issuer, subject asn1.ObjectIdentifier) func(*Certificate) {
+		return func(c *Certificate) {
+			c.PolicyMappings = append(c.PolicyMappings, PolicyMapping{issuer, subject})
+		}
+	}
+	requireExplicitPolicy := func(n int) func(*Certificate) {
+		return func(c *Certificate) { c.RequireExplicitPolicy, c.RequireExplicitPolicyZero = n, n == 0 }
+	}
+	inhibitPolicyMapping := func(n int) func(*Certificate) {
+		return func(c *Certificate) { c.InhibitPolicyMapping, c.InhibitPolicyMappingZero = n, n == 0 }
+	}
+	inhibitAnyPolicy := func(n int) func(*Certificate) {
+		return func(c *Certificate) { c.InhibitAnyPolicy, c.InhibitAnyPolicyZero = n, n == 0 }
+	}
+	// selfIssued gives a certificate the same subject as its issuer.
+	var issuer *Certificate
+	selfIssued := func(c *Certificate) { c.Subject = issuer.Subject }
+	cert := func(fs ...func(*Certificate)) []func(*Certificate) { return fs }
+
+	tests := []struct {
+		name string
+		// chain lists the certificates issued by the root, from the
+		// intermediates down to the leaf.
+		chain [][]func(*Certificate)
+		// userPolicies is VerifyOptions.CertificatePolicies.
+		userPolicies []asn1.ObjectIdentifier
+		valid        bool
+	}{
+		{
+			name:  "no policies",
+			chain: [][]func(*Certificate){cert(), cert()},
+			valid: true,
+		},
+		{
+			name:         "no policies, user policy",
+			chain:        [][]func(*Certificate){cert(), cert()},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+		},
+		{
+			name:         "no policies, any user policy",
+			chain:        [][]func(*Certificate){cert(), cert()},
+			userPolicies: []asn1.ObjectIdentifier{any},
+		},
+		{
+			name:         "matching policy",
+			chain:        [][]func(*Certificate){cert(policies(p1)), cert(policies(p1))},
+			userPolicies: []asn1.ObjectIdentifier{p2, p1},
+			valid:        true,
+		},
+		{
+			name:  "mismatched policies, no user policy",
+			chain: [][]func(*Certificate){cert(policies(p1)), cert(policies(p2))},
+			valid: true,
+		},
+		{
+			name:         "mismatched policies, any user policy",
+			chain:        [][]func(*Certificate){cert(policies(p1)), cert(policies(p2))},
+			userPolicies: []asn1.ObjectIdentifier{any},
+		},
+		{
+			name:         "intermediate anyPolicy",
+			chain:        [][]func(*Certificate){cert(policies(any)), cert(policies(p1))},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+			valid:        true,
+		},
+		{
+			name:         "intermediate anyPolicy, other user policy",
+			chain:        [][]func(*Certificate){cert(policies(any)), cert(policies(p1))},
+			userPolicies: []asn1.ObjectIdentifier{p2},
+		},
+		{
+			name:         "leaf anyPolicy",
+			chain:        [][]func(*Certificate){cert(policies(p1, p2)), cert(policies(any))},
+			userPolicies: []asn1.ObjectIdentifier{p2},
+			valid:        true,
+		},
+		{
+			name:         "anyPolicy everywhere",
+			chain:        [][]func(*Certificate){cert(policies(any)), cert(policies(any))},
+			userPolicies: []asn1.ObjectIdentifier{p3},
+			valid:        true,
+		},
+		{
+			name:  "require explicit policy, none",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(0)), cert()},
+		},
+		{
+			name:  "require explicit policy, matching",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(0), policies(p1)), cert(policies(p1))},
+			valid: true,
+		},
+		{
+			name:  "require explicit policy, mismatched",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(0), policies(p1)), cert(policies(p2))},
+		},
+		{
+			name:  "require explicit policy after the leaf",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(2)), cert()},
+			valid: true,
+		},
+		{
+			name:  "require explicit policy at the leaf",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(1)), cert()},
+		},
+		{
+			name:  "leaf requires explicit policy",
+			chain: [][]func(*Certificate){cert(policies(p1)), cert(policies(p2), requireExplicitPolicy(0))},
+		},
+		{
+			name:  "require explicit policy after two intermediates",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(2)), cert(), cert()},
+		},
+		{
+			name:  "self-issued intermediate doesn't count",
+			chain: [][]func(*Certificate){cert(requireExplicitPolicy(2)), cert(selfIssued), cert()},
+			valid: true,
+		},
+		{
+			name:         "mapped policy",
+			chain:        [][]func(*Certificate){cert(policies(p1), mapping(p1, p2)), cert(policies(p2))},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+			valid:        true,
+		},
+		{
+			name:         "user policy in the subject domain",
+			chain:        [][]func(*Certificate){cert(policies(p1), mapping(p1, p2)), cert(policies(p2))},
+			userPolicies: []asn1.ObjectIdentifier{p2},
+		},
+		{
+			name:         "unmapped policy",
+			chain:        [][]func(*Certificate){cert(policies(p1), mapping(p1, p2)), cert(policies(p1))},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+		},
+		{
+			name:         "mapped from anyPolicy",
+			chain:        [][]func(*Certificate){cert(policies(any), mapping(p1, p2)), cert(policies(p2))},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+			valid:        true,
+		},
+		{
+			name:         "one to many mapping",
+			chain:        [][]func(*Certificate){cert(policies(p1), mapping(p1, p2), mapping(p1, p3)), cert(policies(p3))},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+			valid:        true,
+		},
+		{
+			name:  "mapping to anyPolicy",
+			chain: [][]func(*Certificate){cert(policies(p1), mapping(p1, any)), cert(policies(p1))},
+		},
+		{
+			name:  "mapping from anyPolicy",
+			chain: [][]func(*Certificate){cert(policies(p1), mapping(any, p1)), cert(policies(p1))},
+		},
+		{
+			name: "policy mapping allowed",
+			chain: [][]func(*Certificate){
+				cert(policies(any), inhibitPolicyMapping(1)),
+				cert(policies(p1), mapping(p1, p2)),
+				cert(policies(p2)),
+			},
+			userPolicies: []asn1.ObjectIdentifier{any},
+			valid:        true,
+		},
+		{
+			name: "policy mapping inhibited",
+			chain: [][]func(*Certificate){
+				cert(policies(any), inhibitPolicyMapping(0)),
+				cert(policies(p1), mapping(p1, p2)),
+				cert(policies(p2)),
+			},
+			userPolicies: []asn1.ObjectIdentifier{any},
+		},
+		{
+			name: "policy mapping inhibited, unmapped policy",
+			chain: [][]func(*Certificate){
+				cert(policies(any), inhibitPolicyMapping(0)),
+				cert(policies(p1, p2), mapping(p1, p2)),
+				cert(policies(p2)),
+			},
+			userPolicies: []asn1.ObjectIdentifier{p2},
+			valid:        true,
+		},
+		{
+			name: "anyPolicy allowed",
+			chain: [][]func(*Certificate){
+				cert(policies(any), inhibitAnyPolicy(1)),
+				cert(policies(any)),
+				cert(policies(p1)),
+			},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+			valid:        true,
+		},
+		{
+			name: "anyPolicy inhibited",
+			chain: [][]func(*Certificate){
+				cert(policies(any), inhibitAnyPolicy(0)),
+				cert(policies(any)),
+				cert(policies(p1)),
+			},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+		},
+		{
+			name: "anyPolicy inhibited, explicit policy",
+			chain: [][]func(*Certificate){
+				cert(policies(any), inhibitAnyPolicy(0)),
+				cert(policies(p1)),
+				cert(policies(p1)),
+			},
+			userPolicies: []asn1.ObjectIdentifier{p1},
+			valid:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, rootKey := generatePolicyTestCert(t, "Root", nil, nil, requireExplicitPolicy(0), policies(p3))
+			roots := NewCertPool()
+			roots.AddCert(root)
+			intermediates := NewCertPool()
+			var issuerKey crypto.Signer
+			issuer, issuerKey = root, rootKey
+			for i, fs := range tt.chain {
+				name := fmt.Sprintf("Certificate %d", i)
+				cert, key := generatePolicyTestCert(t, name, issuer, issuerKey, fs...)
+				if i < len(tt.chain)-1 {
+					intermediates.AddCert(cert)
+				}
+				issuer, issuerKey = cert, key
+			}
+			leaf := issuer
+
+			opts := VerifyOptions{
+				Roots:               roots,
+				Intermediates:       intermediates,
+				CertificatePolicies: tt.userPolicies,
+			}
+			chains, err := leaf.Verify(opts)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				if len(chains) != 1 || len(chains[0]) != len(tt.chain)+1 {
+					t.Fatalf("unexpected chains: %v", chains)
+				}
+				return
+			}
+			if e, ok := err.(CertificateInvalidError); !ok || e.Reason != InvalidPolicy {
+				t.Fatalf("got error %v, want InvalidPolicy", err)
+			}
+			candidates, err := leaf.VerifyCandidates(opts)
+			if err != nil {
+				t.Fatalf("VerifyCandidates failed: %v", err)
+			}
+			if len(candidates) != 1 {
+				t.Fatalf("got %d candidates, want 1", len(candidates))
+			}
+			if e, ok := candidates[0].Err.(CertificateInvalidError); !ok || e.Reason != InvalidPolicy {
+				t.Fatalf("got candidate error %v, want InvalidPolicy", candidates[0].Err)
+			}
+		})
+	}
+}
+
+// generatePolicyTestCert creates a CA certificate, or a self-signed root if
+// issuer is nil, after applying the given changes to its template.
+func generatePolicyTestCert(t *testing.T, cn string, issuer *Certificate, issuerKey crypto.Signer, fs ...func(*Certificate)) (*Certificate, crypto.Signer) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              KeyUsageCertSign | KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, f := range fs {
+		f(template)
+	}
+	if issuer == nil {
+		issuer, issuerKey = template, priv
+	}
+	der, err := CreateCertificate(rand.Reader, template, issuer, priv.Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, priv
+}
+
+func TestVerifyCandidates(t *testing.T) {
+	root1, root1Key, err := generateCert("Root 1", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root2, root2Key, err := generateCert("Root 2", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter, interKey, err := generateCert("Intermediate", true, root1, root1Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cross-sign the intermediate's key by root2, but only for client
+	// authentication.
+	crossDER, err := CreateCertificate(rand.Reader, &Certificate{
+		SerialNumber:          big.NewInt(99),
+		Subject:               inter.Subject,
+		NotBefore:             inter.NotBefore,
+		NotAfter:              inter.NotAfter,
+		KeyUsage:              inter.KeyUsage,
+		ExtKeyUsage:           []ExtKeyUsage{ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root2, inter.PublicKey, root2Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := ParseCertificate(crossDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("leaf", false, inter, interKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := NewCertPool()
+	roots.AddCert(root1)
+	roots.AddCert(root2)
+	intermediates := NewCertPool()
+	intermediates.AddCert(inter)
+	intermediates.AddCert(cross)
+	opts := VerifyOptions{Roots: roots, Intermediates: intermediates}
+
+	candidates, err := leaf.VerifyCandidates(opts)
+	if err != nil {
+		t.Fatalf("VerifyCandidates failed: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2", len(candidates))
+	}
+	for _, candidate := range candidates {
+		switch root := candidate.Chain[len(candidate.Chain)-1]; {
+		case root.Equal(root1):
+			if candidate.Err != nil {
+				t.Errorf("chain through Root 1 rejected: %v", candidate.Err)
+			}
+		case root.Equal(root2):
+			if e, ok := candidate.Err.(CertificateInvalidError); !ok || e.Reason != IncompatibleUsage {
+				t.Errorf("chain through Root 2: got error %v, want IncompatibleUsage", candidate.Err)
+			}
+		default:
+			t.Errorf("unexpected root %v", root.Subject)
+		}
+	}
+
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(chains) != 1 || !chains[0][2].Equal(root1) {
+		t.Errorf("got %d chains, want only the one through Root 1", len(chains))
+	}
+
+	// If no chain could be built, VerifyCandidates fails like Verify.
+	opts.Roots = NewCertPool()
+	if _, err := leaf.VerifyCandidates(opts); !errors.As(err, new(UnknownAuthorityError)) {
+		t.Errorf("got error %v, want UnknownAuthorityError", err)
+	}
+}
+
+func TestDisablePlatformVerifier(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("only Windows uses the platform verifier when Roots is nil")
+	}
+	leaf, _, err := generateCert("leaf", false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Go verifier has no system roots on Windows.
+	_, err = leaf.Verify(VerifyOptions{DisablePlatformVerifier: true})
+	if _, ok := err.(SystemRootsError); !ok {
+		t.Errorf("got error %v, want SystemRootsError", err)
+	}
+}
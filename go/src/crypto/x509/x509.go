@@ -8,6 +8,7 @@ package x509
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
@@ -47,8 +48,9 @@ type pkixPublicKey struct {
 // The encoded public key is a SubjectPublicKeyInfo structure
 // (see RFC 5280, Section 4.1).
 //
-// It returns a *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey, or
-// ed25519.PublicKey. More types might be supported in the future.
+// It returns a *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey,
+// ed25519.PublicKey (not a pointer), or *ecdh.PublicKey (for X25519).
+// More types might be supported in the future.
 //
 // This kind of key is commonly encoded in PEM blocks of type "PUBLIC KEY".
 func ParsePKIXPublicKey(derBytes []byte) (pub interface{}, err error) {
@@ -62,7 +64,7 @@ func ParsePKIXPublicKey(derBytes []byte) (pub interface{}, err error) {
 		return nil, errors.New("x509: trailing data after ASN.1 of public-key")
 	}
 	algo := getPublicKeyAlgorithmFromOID(pki.Algorithm.Algorithm)
-	if algo == UnknownPublicKeyAlgorithm {
+	if algo == UnknownPublicKeyAlgorithm && !pki.Algorithm.Algorithm.Equal(oidPublicKeyX25519) {
 		return nil, errors.New("x509: unknown public key algorithm")
 	}
 	return parsePublicKey(algo, &pki)
@@ -98,6 +100,23 @@ func marshalPublicKey(pub interface{}) (publicKeyBytes []byte, publicKeyAlgorith
 	case ed25519.PublicKey:
 		publicKeyBytes = pub
 		publicKeyAlgorithm.Algorithm = oidPublicKeyEd25519
+	case *ecdh.PublicKey:
+		publicKeyBytes = pub.Bytes()
+		if pub.Curve() == ecdh.X25519() {
+			publicKeyAlgorithm.Algorithm = oidPublicKeyX25519
+		} else {
+			oid, ok := oidFromECDHCurve(pub.Curve())
+			if !ok {
+				return nil, pkix.AlgorithmIdentifier{}, errors.New("x509: unsupported elliptic curve")
+			}
+			publicKeyAlgorithm.Algorithm = oidPublicKeyECDSA
+			var paramBytes []byte
+			paramBytes, err = asn1.Marshal(oid)
+			if err != nil {
+				return
+			}
+			publicKeyAlgorithm.Parameters.FullBytes = paramBytes
+		}
 	default:
 		return nil, pkix.AlgorithmIdentifier{}, fmt.Errorf("x509: unsupported public key type: %T", pub)
 	}
@@ -109,8 +128,9 @@ func marshalPublicKey(pub interface{}) (publicKeyBytes []byte, publicKeyAlgorith
 // The encoded public key is a SubjectPublicKeyInfo structure
 // (see RFC 5280, Section 4.1).
 //
-// The following key types are currently supported: *rsa.PublicKey, *ecdsa.PublicKey
-// and ed25519.PublicKey. Unsupported key types result in an error.
+// The following key types are currently supported: *rsa.PublicKey,
+// *ecdsa.PublicKey, ed25519.PublicKey (not a pointer), and *ecdh.PublicKey.
+// Unsupported key types result in an error.
 //
 // This kind of key is commonly encoded in PEM blocks of type "PUBLIC KEY".
 func MarshalPKIXPublicKey(pub interface{}) ([]byte, error) {
@@ -445,10 +465,16 @@ func getSignatureAlgorithmFromAI(ai pkix.AlgorithmIdentifier) SignatureAlgorithm
 //
 // id-ecPublicKey OBJECT IDENTIFIER ::= {
 //       iso(1) member-body(2) us(840) ansi-X9-62(10045) keyType(2) 1 }
+//
+// RFC 8410, Section 3
+//
+// id-X25519    OBJECT IDENTIFIER ::= { 1 3 101 110 }
+// id-Ed25519   OBJECT IDENTIFIER ::= { 1 3 101 112 }
 var (
 	oidPublicKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
 	oidPublicKeyDSA     = asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}
 	oidPublicKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyX25519  = asn1.ObjectIdentifier{1, 3, 101, 110}
 	oidPublicKeyEd25519 = oidSignatureEd25519
 )
 
@@ -518,6 +544,19 @@ func oidFromNamedCurve(curve elliptic.Curve) (asn1.ObjectIdentifier, bool) {
 	return nil, false
 }
 
+func oidFromECDHCurve(curve ecdh.Curve) (asn1.ObjectIdentifier, bool) {
+	switch curve {
+	case ecdh.P256():
+		return oidNamedCurveP256, true
+	case ecdh.P384():
+		return oidNamedCurveP384, true
+	case ecdh.P521():
+		return oidNamedCurveP521, true
+	}
+
+	return nil, false
+}
+
 // KeyUsage represents the set of actions that are valid for a given key. It's
 // a bitmap of the KeyUsage* constants.
 type KeyUsage int
@@ -723,6 +762,42 @@ type Certificate struct {
 	CRLDistributionPoints []string
 
 	PolicyIdentifiers []asn1.ObjectIdentifier
+
+	// PolicyMappings contains the policy mappings of a CA certificate, as
+	// defined in RFC 5280, Section 4.2.1.5.
+	PolicyMappings []PolicyMapping
+
+	// RequireExplicitPolicy and RequireExplicitPolicyZero indicate the
+	// presence and value of the requireExplicitPolicy field of the policy
+	// constraints extension: the number of additional certificates that may
+	// appear in the chain before an explicit policy is required.
+	//
+	// As with MaxPathLen, a zero RequireExplicitPolicy with
+	// RequireExplicitPolicyZero false, or a negative RequireExplicitPolicy,
+	// means that the field is not set.
+	RequireExplicitPolicy     int
+	RequireExplicitPolicyZero bool
+
+	// InhibitPolicyMapping and InhibitPolicyMappingZero indicate the presence
+	// and value of the inhibitPolicyMapping field of the policy constraints
+	// extension: the number of additional certificates that may appear in
+	// the chain before policy mapping is no longer permitted.
+	InhibitPolicyMapping     int
+	InhibitPolicyMappingZero bool
+
+	// InhibitAnyPolicy and InhibitAnyPolicyZero indicate the presence and
+	// value of the inhibit anyPolicy extension: the number of additional
+	// non-self-issued certificates that may appear in the chain before the
+	// anyPolicy OID no longer matches every other policy.
+	InhibitAnyPolicy     int
+	InhibitAnyPolicyZero bool
+}
+
+// PolicyMapping declares that the issuing CA considers IssuerDomainPolicy
+// equivalent to SubjectDomainPolicy in the certificates issued by the subject.
+type PolicyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
 }
 
 // ErrUnsupportedAlgorithm results from attempting to perform an operation that
@@ -947,10 +1022,15 @@ var (
 	oidExtensionBasicConstraints      = []int{2, 5, 29, 19}
 	oidExtensionSubjectAltName        = []int{2, 5, 29, 17}
 	oidExtensionCertificatePolicies   = []int{2, 5, 29, 32}
+	oidExtensionPolicyMappings        = []int{2, 5, 29, 33}
+	oidExtensionPolicyConstraints     = []int{2, 5, 29, 36}
+	oidExtensionInhibitAnyPolicy      = []int{2, 5, 29, 54}
 	oidExtensionNameConstraints       = []int{2, 5, 29, 30}
 	oidExtensionCRLDistributionPoints = []int{2, 5, 29, 31}
 	oidExtensionAuthorityInfoAccess   = []int{1, 3, 6, 1, 5, 5, 7, 1, 1}
 	oidExtensionCRLNumber             = []int{2, 5, 29, 20}
+	oidExtensionReasonCode            = []int{2, 5, 29, 21}
+	oidExtensionDeltaCRLIndicator     = []int{2, 5, 29, 27}
 )
 
 var (
@@ -1015,7 +1095,7 @@ func isIA5String(s string) error {
 }
 
 func buildCertExtensions(template *Certificate, subjectIsEmpty bool, authorityKeyId []byte, subjectKeyId []byte) (ret []pkix.Extension, err error) {
-	ret = make([]pkix.Extension, 10 /* maximum number of elements. */)
+	ret = make([]pkix.Extension, 13 /* maximum number of elements. */)
 	n := 0
 
 	if template.KeyUsage != 0 &&
@@ -1108,6 +1188,50 @@ func buildCertExtensions(template *Certificate, subjectIsEmpty bool, authorityKe
 		n++
 	}
 
+	if len(template.PolicyMappings) > 0 &&
+		!oidInExtensions(oidExtensionPolicyMappings, template.ExtraExtensions) {
+		ret[n], err = marshalPolicyMappings(template.PolicyMappings)
+		if err != nil {
+			return nil, err
+		}
+		n++
+	}
+
+	requireExplicitPolicy, hasRequireExplicitPolicy := skipCerts(template.RequireExplicitPolicy, template.RequireExplicitPolicyZero)
+	inhibitPolicyMapping, hasInhibitPolicyMapping := skipCerts(template.InhibitPolicyMapping, template.InhibitPolicyMappingZero)
+	if (hasRequireExplicitPolicy || hasInhibitPolicyMapping) &&
+		!oidInExtensions(oidExtensionPolicyConstraints, template.ExtraExtensions) {
+		ret[n].Id = oidExtensionPolicyConstraints
+		// RFC 5280, 4.2.1.11: Conforming CAs MUST mark this extension as critical.
+		ret[n].Critical = true
+		var b cryptobyte.Builder
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			if hasRequireExplicitPolicy {
+				b.AddASN1Int64WithTag(int64(requireExplicitPolicy), cryptobyte_asn1.Tag(0).ContextSpecific())
+			}
+			if hasInhibitPolicyMapping {
+				b.AddASN1Int64WithTag(int64(inhibitPolicyMapping), cryptobyte_asn1.Tag(1).ContextSpecific())
+			}
+		})
+		ret[n].Value, err = b.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		n++
+	}
+
+	if inhibitAnyPolicy, ok := skipCerts(template.InhibitAnyPolicy, template.InhibitAnyPolicyZero); ok &&
+		!oidInExtensions(oidExtensionInhibitAnyPolicy, template.ExtraExtensions) {
+		ret[n].Id = oidExtensionInhibitAnyPolicy
+		// RFC 5280, 4.2.1.14: Conforming CAs MUST mark this extension as critical.
+		ret[n].Critical = true
+		ret[n].Value, err = asn1.Marshal(inhibitAnyPolicy)
+		if err != nil {
+			return nil, err
+		}
+		n++
+	}
+
 	if (len(template.PermittedDNSDomains) > 0 || len(template.ExcludedDNSDomains) > 0 ||
 		len(template.PermittedIPRanges) > 0 || len(template.ExcludedIPRanges) > 0 ||
 		len(template.PermittedEmailAddresses) > 0 || len(template.ExcludedEmailAddresses) > 0 ||
@@ -1295,6 +1419,23 @@ func marshalBasicConstraints(isCA bool, maxPathLen int, maxPathLenZero bool) (pk
 	return ext, nil
 }
 
+// skipCerts returns the value of a SkipCerts field of a template, following
+// the same convention as MaxPathLen and MaxPathLenZero.
+func skipCerts(value int, zero bool) (int, bool) {
+	if value < 0 || (value == 0 && !zero) {
+		return 0, false
+	}
+	return value, true
+}
+
+func marshalPolicyMappings(mappings []PolicyMapping) (pkix.Extension, error) {
+	// RFC 5280, 4.2.1.5: Conforming CAs SHOULD mark this extension as critical.
+	ext := pkix.Extension{Id: oidExtensionPolicyMappings, Critical: true}
+	var err error
+	ext.Value, err = asn1.Marshal(mappings)
+	return ext, err
+}
+
 func marshalCertificatePolicies(policyIdentifiers []asn1.ObjectIdentifier) (pkix.Extension, error) {
 	ext := pkix.Extension{Id: oidExtensionCertificatePolicies}
 	policies := make([]policyInformation, len(policyIdentifiers))
@@ -1428,6 +1569,10 @@ var emptyASN1Subject = []byte{0x30, 0}
 //  - ExtKeyUsage
 //  - ExtraExtensions
 //  - IPAddresses
+//  - InhibitAnyPolicy
+//  - InhibitAnyPolicyZero
+//  - InhibitPolicyMapping
+//  - InhibitPolicyMappingZero
 //  - IsCA
 //  - IssuingCertificateURL
 //  - KeyUsage
@@ -1442,6 +1587,9 @@ var emptyASN1Subject = []byte{0x30, 0}
 //  - PermittedIPRanges
 //  - PermittedURIDomains
 //  - PolicyIdentifiers
+//  - PolicyMappings
+//  - RequireExplicitPolicy
+//  - RequireExplicitPolicyZero
 //  - SerialNumber
 //  - SignatureAlgorithm
 //  - Subject
@@ -2064,23 +2212,110 @@ func (c *CertificateRequest) CheckSignature() error {
 	return checkSignature(c.SignatureAlgorithm, c.RawTBSCertificateRequest, c.Signature, c.PublicKey)
 }
 
-// RevocationList contains the fields used to create an X.509 v2 Certificate
-// Revocation list with CreateRevocationList.
+// CRL entry reason codes, as defined in RFC 5280, Section 5.3.1.
+const (
+	ReasonUnspecified          = 0
+	ReasonKeyCompromise        = 1
+	ReasonCACompromise         = 2
+	ReasonAffiliationChanged   = 3
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+	ReasonCertificateHold      = 6
+	ReasonRemoveFromCRL        = 8
+	ReasonPrivilegeWithdrawn   = 9
+	ReasonAACompromise         = 10
+)
+
+// RevocationListEntry represents an entry in the revokedCertificates
+// sequence of a CRL.
+type RevocationListEntry struct {
+	// Raw contains the raw bytes of the revokedCertificates entry. It is set
+	// when parsing a CRL; it is ignored when generating a CRL.
+	Raw []byte
+
+	// SerialNumber represents the serial number of a revoked certificate. It
+	// is both used when creating a CRL and populated when parsing a CRL. It
+	// must not be nil.
+	SerialNumber *big.Int
+	// RevocationTime represents the time at which the certificate was
+	// revoked. It is both used when creating a CRL and populated when parsing
+	// a CRL. It must not be the zero time.
+	RevocationTime time.Time
+	// ReasonCode represents the reason for revocation, using the Reason
+	// constants. When creating a CRL, the zero value will result in the
+	// reasonCode extension being omitted. When parsing a CRL, the zero value
+	// may represent either the reasonCode extension being absent (which
+	// implies the default revocation reason of ReasonUnspecified), or the
+	// extension explicitly containing ReasonUnspecified.
+	ReasonCode int
+
+	// Extensions contains raw X.509 extensions. When parsing CRL entries,
+	// this can be used to extract non-critical extensions that are not
+	// parsed by this package. When marshaling CRL entries, the Extensions
+	// field is ignored, see ExtraExtensions.
+	Extensions []pkix.Extension
+	// ExtraExtensions contains extensions to be copied, raw, into any
+	// marshaled CRL entries. Values override any extensions that would
+	// otherwise be produced based on the other fields. The ExtraExtensions
+	// field is not populated when parsing CRL entries, see Extensions.
+	ExtraExtensions []pkix.Extension
+}
+
+// RevocationList represents a Certificate Revocation List (CRL) as specified
+// by RFC 5280. It is used to create CRLs with CreateRevocationList, and is
+// returned by ParseRevocationList.
 type RevocationList struct {
+	// Raw contains the complete ASN.1 DER content of the CRL (tbsCertList,
+	// signatureAlgorithm, and signatureValue.)
+	Raw []byte
+	// RawTBSRevocationList contains just the tbsCertList portion of the ASN.1
+	// DER.
+	RawTBSRevocationList []byte
+	// RawIssuer contains the DER encoded Issuer.
+	RawIssuer []byte
+
+	// Issuer contains the DN of the issuing certificate.
+	Issuer pkix.Name
+	// AuthorityKeyId is used to identify the public key associated with the
+	// issuing certificate. It is populated from the authorityKeyIdentifier
+	// extension when parsing a CRL. It is ignored when creating a CRL; the
+	// extension is populated from the issuing certificate itself.
+	AuthorityKeyId []byte
+
+	Signature []byte
 	// SignatureAlgorithm is used to determine the signature algorithm to be
 	// used when signing the CRL. If 0 the default algorithm for the signing
 	// key will be used.
 	SignatureAlgorithm SignatureAlgorithm
 
+	// RevokedCertificateEntries represents the revokedCertificates sequence
+	// in the CRL. It is used when creating a CRL and also populated when
+	// parsing a CRL. When creating a CRL, it may be empty or nil, in which
+	// case the revokedCertificates ASN.1 sequence will be omitted from the
+	// CRL entirely.
+	RevokedCertificateEntries []RevocationListEntry
+
 	// RevokedCertificates is used to populate the revokedCertificates
-	// sequence in the CRL, it may be empty. RevokedCertificates may be nil,
-	// in which case an empty CRL will be created.
+	// sequence in the CRL if RevokedCertificateEntries is empty. It may be
+	// empty or nil, in which case an empty CRL will be created. It is also
+	// populated when parsing a CRL.
+	//
+	// Deprecated: Use RevokedCertificateEntries instead.
 	RevokedCertificates []pkix.RevokedCertificate
 
 	// Number is used to populate the X.509 v2 cRLNumber extension in the CRL,
 	// which should be a monotonically increasing sequence number for a given
-	// CRL scope and CRL issuer.
+	// CRL scope and CRL issuer. This field is also populated from the
+	// cRLNumber extension when parsing a CRL.
 	Number *big.Int
+
+	// BaseCRLNumber, if not nil, makes the CRL a delta CRL, as described in
+	// RFC 5280, Section 5.2.4. It is the Number of the complete CRL that the
+	// delta CRL updates, and populates the critical deltaCRLIndicator
+	// extension. This field is also populated from that extension when
+	// parsing a CRL.
+	BaseCRLNumber *big.Int
+
 	// ThisUpdate is used to populate the thisUpdate field in the CRL, which
 	// indicates the issuance date of the CRL.
 	ThisUpdate time.Time
@@ -2088,11 +2323,39 @@ type RevocationList struct {
 	// indicates the date by which the next CRL will be issued. NextUpdate
 	// must be greater than ThisUpdate.
 	NextUpdate time.Time
+
+	// Extensions contains raw X.509 extensions. When creating a CRL,
+	// the Extensions field is ignored, see ExtraExtensions.
+	Extensions []pkix.Extension
+
 	// ExtraExtensions contains any additional extensions to add directly to
 	// the CRL.
 	ExtraExtensions []pkix.Extension
 }
 
+// These structures reflect the ASN.1 structure of X.509 CRLs better than the
+// existing crypto/x509/pkix variants do. These mirror the existing
+// certificate structs in this file.
+//
+// Notably, we include issuer as an asn1.RawValue, mirroring the behavior of
+// tbsCertificate and allowing raw (unparsed) subjects to be passed cleanly.
+type certificateList struct {
+	TBSCertList        tbsCertificateList
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateList struct {
+	Raw                 asn1.RawContent
+	Version             int `asn1:"optional,default:0"`
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time                 `asn1:"optional"`
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
 // CreateRevocationList creates a new X.509 v2 Certificate Revocation List,
 // according to RFC 5280, based on template.
 //
@@ -2105,6 +2368,9 @@ type RevocationList struct {
 // The issuer distinguished name CRL field and authority key identifier
 // extension are populated using the issuer certificate. issuer must have
 // SubjectKeyId set.
+//
+// If template.BaseCRLNumber is not nil, the result is a delta CRL, which only
+// lists the changes since the complete CRL with that number.
 func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Certificate, priv crypto.Signer) ([]byte, error) {
 	if template == nil {
 		return nil, errors.New("x509: template can not be nil")
@@ -2130,26 +2396,88 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 		return nil, err
 	}
 
-	// Force revocation times to UTC per RFC 5280.
-	revokedCertsUTC := make([]pkix.RevokedCertificate, len(template.RevokedCertificates))
-	for i, rc := range template.RevokedCertificates {
-		rc.RevocationTime = rc.RevocationTime.UTC()
-		revokedCertsUTC[i] = rc
+	var revokedCerts []pkix.RevokedCertificate
+	// Only process the deprecated RevokedCertificates field if it is populated
+	// and the new RevokedCertificateEntries field is not populated.
+	if len(template.RevokedCertificates) > 0 && len(template.RevokedCertificateEntries) == 0 {
+		// Force revocation times to UTC per RFC 5280.
+		revokedCerts = make([]pkix.RevokedCertificate, len(template.RevokedCertificates))
+		for i, rc := range template.RevokedCertificates {
+			rc.RevocationTime = rc.RevocationTime.UTC()
+			revokedCerts[i] = rc
+		}
+	} else {
+		// Convert the ReasonCode field to a proper extension, and force
+		// revocation times to UTC per RFC 5280.
+		revokedCerts = make([]pkix.RevokedCertificate, len(template.RevokedCertificateEntries))
+		for i, rce := range template.RevokedCertificateEntries {
+			if rce.SerialNumber == nil {
+				return nil, errors.New("x509: template contains entry with nil SerialNumber field")
+			}
+			if rce.RevocationTime.IsZero() {
+				return nil, errors.New("x509: template contains entry with zero RevocationTime field")
+			}
+
+			rc := pkix.RevokedCertificate{
+				SerialNumber:   rce.SerialNumber,
+				RevocationTime: rce.RevocationTime.UTC(),
+			}
+
+			// Copy over any extra extensions, except for a Reason Code
+			// extension, because we'll synthesize that ourselves to ensure it
+			// is correct.
+			exts := make([]pkix.Extension, 0, len(rce.ExtraExtensions))
+			for _, ext := range rce.ExtraExtensions {
+				if ext.Id.Equal(oidExtensionReasonCode) {
+					return nil, errors.New("x509: template contains entry with ReasonCode ExtraExtension; use ReasonCode field instead")
+				}
+				exts = append(exts, ext)
+			}
+
+			// Only add a reasonCode extension if the reason is non-zero, as
+			// per RFC 5280 Section 5.3.1.
+			if rce.ReasonCode != 0 {
+				reasonBytes, err := asn1.Marshal(asn1.Enumerated(rce.ReasonCode))
+				if err != nil {
+					return nil, err
+				}
+
+				exts = append(exts, pkix.Extension{
+					Id:    oidExtensionReasonCode,
+					Value: reasonBytes,
+				})
+			}
+
+			if len(exts) > 0 {
+				rc.Extensions = exts
+			}
+			revokedCerts[i] = rc
+		}
 	}
 
 	aki, err := asn1.Marshal(authKeyId{Id: issuer.SubjectKeyId})
 	if err != nil {
 		return nil, err
 	}
+
+	if numBytes := template.Number.Bytes(); len(numBytes) > 20 || (len(numBytes) == 20 && numBytes[0]&0x80 != 0) {
+		return nil, errors.New("x509: CRL number exceeds 20 octets")
+	}
 	crlNum, err := asn1.Marshal(template.Number)
 	if err != nil {
 		return nil, err
 	}
 
-	tbsCertList := pkix.TBSCertificateList{
+	// Correctly use the issuer's subject sequence if one is specified.
+	issuerSubject, err := subjectBytes(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	tbsCertList := tbsCertificateList{
 		Version:    1, // v2
 		Signature:  signatureAlgorithm,
-		Issuer:     issuer.Subject.ToRDNSequence(),
+		Issuer:     asn1.RawValue{FullBytes: issuerSubject},
 		ThisUpdate: template.ThisUpdate.UTC(),
 		NextUpdate: template.NextUpdate.UTC(),
 		Extensions: []pkix.Extension{
@@ -2163,8 +2491,20 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 			},
 		},
 	}
-	if len(revokedCertsUTC) > 0 {
-		tbsCertList.RevokedCertificates = revokedCertsUTC
+	if len(revokedCerts) > 0 {
+		tbsCertList.RevokedCertificates = revokedCerts
+	}
+
+	if template.BaseCRLNumber != nil {
+		baseNum, err := asn1.Marshal(template.BaseCRLNumber)
+		if err != nil {
+			return nil, err
+		}
+		tbsCertList.Extensions = append(tbsCertList.Extensions, pkix.Extension{
+			Id:       oidExtensionDeltaCRLIndicator,
+			Critical: true,
+			Value:    baseNum,
+		})
 	}
 
 	if len(template.ExtraExtensions) > 0 {
@@ -2195,9 +2535,28 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 		return nil, err
 	}
 
-	return asn1.Marshal(pkix.CertificateList{
+	return asn1.Marshal(certificateList{
 		TBSCertList:        tbsCertList,
 		SignatureAlgorithm: signatureAlgorithm,
 		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
 	})
 }
+
+// CheckSignatureFrom verifies that the signature on rl is a valid signature
+// from issuer.
+func (rl *RevocationList) CheckSignatureFrom(parent *Certificate) error {
+	if parent.Version == 3 && !parent.BasicConstraintsValid ||
+		parent.BasicConstraintsValid && !parent.IsCA {
+		return ConstraintViolationError{}
+	}
+
+	if parent.KeyUsage != 0 && parent.KeyUsage&KeyUsageCRLSign == 0 {
+		return ConstraintViolationError{}
+	}
+
+	if parent.PublicKeyAlgorithm == UnknownPublicKeyAlgorithm {
+		return ErrUnsupportedAlgorithm
+	}
+
+	return parent.CheckSignature(rl.SignatureAlgorithm, rl.RawTBSRevocationList, rl.Signature)
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/dsa"
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
@@ -101,6 +102,13 @@ func TestParsePKIXPublicKey(t *testing.T) {
 			t.Errorf("Value returned from ParsePKIXPublicKey was not an Ed25519 public key")
 		}
 	})
+	t.Run("X25519", func(t *testing.T) {
+		pub := testParsePKIXPublicKey(t, pemX25519Key)
+		k, ok := pub.(*ecdh.PublicKey)
+		if !ok || k.Curve() != ecdh.X25519() {
+			t.Errorf("Value returned from ParsePKIXPublicKey was not an X25519 public key")
+		}
+	})
 }
 
 var pemPublicKey = `-----BEGIN PUBLIC KEY-----
@@ -139,6 +147,14 @@ MCowBQYDK2VwAyEAGb9ECWmEzf6FQbrBZ9w7lshQhqowtrbLDFw4rXAxZuE=
 -----END PUBLIC KEY-----
 `
 
+// pemX25519Key is pemEd25519Key with the key bytes reinterpreted as an
+// X25519 public key (RFC 8410, Section 3).
+var pemX25519Key = `
+-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VuAyEAGb9ECWmEzf6FQbrBZ9w7lshQhqowtrbLDFw4rXAxZuE=
+-----END PUBLIC KEY-----
+`
+
 func TestPKIXMismatchPublicKeyFormat(t *testing.T) {
 
 	const pkcs1PublicKey = "308201080282010100817cfed98bcaa2e2a57087451c7674e0c675686dc33ff1268b0c2a6ee0202dec710858ee1c31bdf5e7783582e8ca800be45f3275c6576adc35d98e26e95bb88ca5beb186f853b8745d88bc9102c5f38753bcda519fb05948d5c77ac429255ff8aaf27d9f45d1586e95e2e9ba8a7cb771b8a09dd8c8fed3f933fd9b439bc9f30c475953418ef25f71a2b6496f53d94d39ce850aa0cc75d445b5f5b4f4ee4db78ab197a9a8d8a852f44529a007ac0ac23d895928d60ba538b16b0b087a7f903ed29770e215019b77eaecc360f35f7ab11b6d735978795b2c4a74e5bdea4dc6594cd67ed752a108e666729a753ab36d6c4f606f8760f507e1765be8cd744007e629020103"
@@ -2661,6 +2677,163 @@ func TestCreateRevocationList(t *testing.T) {
 	}
 }
 
+func TestParseRevocationList(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CRL issuer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3},
+	}
+	issuerDER, err := CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revokedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	extraEntryExt := pkix.Extension{Id: []int{2, 5, 29, 24}, Value: []byte{0x18, 0x0f, '2', '0', '2', '1', '0', '5', '3', '1', '0', '0', '0', '0', '0', '0', 'Z'}}
+	template := &RevocationList{
+		RevokedCertificateEntries: []RevocationListEntry{
+			{
+				SerialNumber:   big.NewInt(2),
+				RevocationTime: revokedAt,
+			},
+			{
+				SerialNumber:    big.NewInt(3),
+				RevocationTime:  revokedAt,
+				ReasonCode:      ReasonKeyCompromise,
+				ExtraExtensions: []pkix.Extension{extraEntryExt},
+			},
+		},
+		Number:        big.NewInt(7),
+		BaseCRLNumber: big.NewInt(5),
+		ThisUpdate:    time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC),
+		NextUpdate:    time.Date(2021, 6, 9, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := CreateRevocationList(rand.Reader, template, issuer, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rl, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatalf("ParseRevocationList: %v", err)
+	}
+	if err := rl.CheckSignatureFrom(issuer); err != nil {
+		t.Errorf("CheckSignatureFrom: %v", err)
+	}
+	if !bytes.Equal(rl.Raw, der) {
+		t.Errorf("Raw doesn't match the input")
+	}
+	if !bytes.Equal(rl.RawIssuer, issuer.RawSubject) {
+		t.Errorf("RawIssuer = %x, want %x", rl.RawIssuer, issuer.RawSubject)
+	}
+	if rl.Issuer.CommonName != "CRL issuer" {
+		t.Errorf("Issuer = %v, want CRL issuer", rl.Issuer)
+	}
+	if !bytes.Equal(rl.AuthorityKeyId, issuer.SubjectKeyId) {
+		t.Errorf("AuthorityKeyId = %x, want %x", rl.AuthorityKeyId, issuer.SubjectKeyId)
+	}
+	if rl.SignatureAlgorithm != ECDSAWithSHA256 {
+		t.Errorf("SignatureAlgorithm = %v, want %v", rl.SignatureAlgorithm, ECDSAWithSHA256)
+	}
+	if rl.Number.Cmp(template.Number) != 0 || rl.BaseCRLNumber.Cmp(template.BaseCRLNumber) != 0 {
+		t.Errorf("Number, BaseCRLNumber = %v, %v, want %v, %v", rl.Number, rl.BaseCRLNumber, template.Number, template.BaseCRLNumber)
+	}
+	if !rl.ThisUpdate.Equal(template.ThisUpdate) || !rl.NextUpdate.Equal(template.NextUpdate) {
+		t.Errorf("ThisUpdate, NextUpdate = %v, %v, want %v, %v", rl.ThisUpdate, rl.NextUpdate, template.ThisUpdate, template.NextUpdate)
+	}
+	if len(rl.Extensions) != 3 {
+		t.Errorf("got %d extensions, want 3", len(rl.Extensions))
+	}
+	if len(rl.RevokedCertificateEntries) != 2 || len(rl.RevokedCertificates) != 2 {
+		t.Fatalf("got %d entries and %d deprecated entries, want 2", len(rl.RevokedCertificateEntries), len(rl.RevokedCertificates))
+	}
+	for i, want := range template.RevokedCertificateEntries {
+		got := rl.RevokedCertificateEntries[i]
+		if got.SerialNumber.Cmp(want.SerialNumber) != 0 || !got.RevocationTime.Equal(want.RevocationTime) || got.ReasonCode != want.ReasonCode {
+			t.Errorf("entry %d = %v, %v, %d, want %v, %v, %d", i, got.SerialNumber, got.RevocationTime, got.ReasonCode, want.SerialNumber, want.RevocationTime, want.ReasonCode)
+		}
+		if len(got.Raw) == 0 {
+			t.Errorf("entry %d has empty Raw", i)
+		}
+		if rl.RevokedCertificates[i].SerialNumber.Cmp(want.SerialNumber) != 0 {
+			t.Errorf("deprecated entry %d has serial number %v, want %v", i, rl.RevokedCertificates[i].SerialNumber, want.SerialNumber)
+		}
+	}
+	if exts := rl.RevokedCertificateEntries[0].Extensions; len(exts) != 0 {
+		t.Errorf("entry without reason code has extensions %v", exts)
+	}
+	if exts := rl.RevokedCertificateEntries[1].Extensions; len(exts) != 2 || !reflect.DeepEqual(exts[0], extraEntryExt) || !exts[1].Id.Equal(oidExtensionReasonCode) {
+		t.Errorf("unexpected entry extensions %v", exts)
+	}
+
+	// The deprecated parser must still accept the result.
+	if _, err := ParseDERCRL(der); err != nil {
+		t.Errorf("ParseDERCRL: %v", err)
+	}
+
+	rl.Signature[0] ^= 0xff
+	if err := rl.CheckSignatureFrom(issuer); err == nil {
+		t.Errorf("CheckSignatureFrom accepted a corrupted signature")
+	}
+
+	for i := 0; i < len(der); i++ {
+		if _, err := ParseRevocationList(der[:i]); err == nil {
+			t.Fatalf("ParseRevocationList accepted truncated input of length %d", i)
+		}
+	}
+	if _, err := ParseRevocationList(append(der[:len(der):len(der)], 0)); err == nil {
+		t.Errorf("ParseRevocationList accepted trailing data")
+	}
+}
+
+func TestCreateRevocationListEntryErrors(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &Certificate{
+		KeyUsage:     KeyUsageCRLSign,
+		Subject:      pkix.Name{CommonName: "testing"},
+		SubjectKeyId: []byte{1, 2, 3},
+	}
+	tests := []struct {
+		entry RevocationListEntry
+		err   string
+	}{
+		{RevocationListEntry{RevocationTime: time.Now()}, "x509: template contains entry with nil SerialNumber field"},
+		{RevocationListEntry{SerialNumber: big.NewInt(1)}, "x509: template contains entry with zero RevocationTime field"},
+		{RevocationListEntry{
+			SerialNumber:    big.NewInt(1),
+			RevocationTime:  time.Now(),
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionReasonCode, Value: []byte{0x0a, 0x01, 0x01}}},
+		}, "x509: template contains entry with ReasonCode ExtraExtension; use ReasonCode field instead"},
+	}
+	for _, tt := range tests {
+		_, err := CreateRevocationList(rand.Reader, &RevocationList{
+			RevokedCertificateEntries: []RevocationListEntry{tt.entry},
+			Number:                    big.NewInt(1),
+			ThisUpdate:                time.Now(),
+			NextUpdate:                time.Now().Add(time.Hour),
+		}, issuer, priv)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("got error %v, want %q", err, tt.err)
+		}
+	}
+}
+
 func TestRSAPSAParameters(t *testing.T) {
 	generateParams := func(hashFunc crypto.Hash) []byte {
 		var hashOID asn1.ObjectIdentifier
@@ -3311,3 +3484,96 @@ func TestLargeOID(t *testing.T) {
 		t.Fatalf("ParseCertificate to failed to parse certificate with large OID: %s", err)
 	}
 }
+
+func TestPolicyConstraintsExtensions(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA"},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{{1, 2, 3}},
+		PolicyMappings: []PolicyMapping{
+			{IssuerDomainPolicy: asn1.ObjectIdentifier{1, 2, 3}, SubjectDomainPolicy: asn1.ObjectIdentifier{1, 2, 4}},
+			{IssuerDomainPolicy: asn1.ObjectIdentifier{1, 2, 3}, SubjectDomainPolicy: asn1.ObjectIdentifier{1, 2, 5}},
+		},
+		RequireExplicitPolicyZero: true,
+		InhibitPolicyMapping:      3,
+		InhibitAnyPolicyZero:      true,
+	}
+	der, err := CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cert.PolicyMappings, template.PolicyMappings) {
+		t.Errorf("PolicyMappings = %v, want %v", cert.PolicyMappings, template.PolicyMappings)
+	}
+	if cert.RequireExplicitPolicy != 0 || !cert.RequireExplicitPolicyZero {
+		t.Errorf("RequireExplicitPolicy = %d, RequireExplicitPolicyZero = %v, want 0, true", cert.RequireExplicitPolicy, cert.RequireExplicitPolicyZero)
+	}
+	if cert.InhibitPolicyMapping != 3 || cert.InhibitPolicyMappingZero {
+		t.Errorf("InhibitPolicyMapping = %d, InhibitPolicyMappingZero = %v, want 3, false", cert.InhibitPolicyMapping, cert.InhibitPolicyMappingZero)
+	}
+	if cert.InhibitAnyPolicy != 0 || !cert.InhibitAnyPolicyZero {
+		t.Errorf("InhibitAnyPolicy = %d, InhibitAnyPolicyZero = %v, want 0, true", cert.InhibitAnyPolicy, cert.InhibitAnyPolicyZero)
+	}
+	for _, e := range cert.Extensions {
+		switch {
+		case e.Id.Equal(oidExtensionPolicyMappings), e.Id.Equal(oidExtensionPolicyConstraints), e.Id.Equal(oidExtensionInhibitAnyPolicy):
+			if !e.Critical {
+				t.Errorf("extension %v is not critical", e.Id)
+			}
+		}
+	}
+	if len(cert.UnhandledCriticalExtensions) != 0 {
+		t.Errorf("unhandled critical extensions: %v", cert.UnhandledCriticalExtensions)
+	}
+
+	// Unset fields don't produce extensions.
+	template.PolicyMappings = nil
+	template.RequireExplicitPolicyZero = false
+	template.InhibitPolicyMapping = -1
+	template.InhibitAnyPolicyZero = false
+	der, err = CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range cert.Extensions {
+		switch {
+		case e.Id.Equal(oidExtensionPolicyMappings), e.Id.Equal(oidExtensionPolicyConstraints), e.Id.Equal(oidExtensionInhibitAnyPolicy):
+			t.Errorf("unexpected extension %v", e.Id)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		ext  pkix.Extension
+	}{
+		{"empty policy mappings", pkix.Extension{Id: oidExtensionPolicyMappings, Value: []byte{0x30, 0x00}}},
+		{"empty policy constraints", pkix.Extension{Id: oidExtensionPolicyConstraints, Value: []byte{0x30, 0x00}}},
+		{"negative policy constraint", pkix.Extension{Id: oidExtensionPolicyConstraints, Value: []byte{0x30, 0x03, 0x80, 0x01, 0xff}}},
+		{"inhibit anyPolicy trailing data", pkix.Extension{Id: oidExtensionInhibitAnyPolicy, Value: []byte{0x02, 0x01, 0x01, 0x00}}},
+	} {
+		template.ExtraExtensions = []pkix.Extension{tt.ext}
+		der, err := CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseCertificate(der); err == nil {
+			t.Errorf("%s: ParseCertificate succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func FuzzRoundtrip(f *testing.F) {
+	f.Add([]byte("a,b,c\n1,2,3\n"))
+	f.Add([]byte("\"quoted\",\"with \"\"quotes\"\"\"\n# comment\n;semi;colon\n"))
+	f.Add([]byte("  leading,\tspace\r\nlazy \"quote\n"))
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		buf := new(bytes.Buffer)
+
+		t.Logf("input = %q", in)
+		for _, tt := range []Reader{
+			{Comma: ','},
+			{Comma: ';'},
+			{Comma: '\t'},
+			{Comma: ',', LazyQuotes: true},
+			{Comma: ',', TrimLeadingSpace: true},
+			{Comma: ',', Comment: '#'},
+			{Comma: ',', Comment: ';'},
+		} {
+			t.Run(fmt.Sprintf("%+v", tt), func(t *testing.T) {
+				r := NewReader(bytes.NewReader(in))
+				r.Comma = tt.Comma
+				r.Comment = tt.Comment
+				r.LazyQuotes = tt.LazyQuotes
+				r.TrimLeadingSpace = tt.TrimLeadingSpace
+
+				records, err := r.ReadAll()
+				if err != nil {
+					return
+				}
+				t.Logf("first records = %#v", records)
+
+				buf.Reset()
+				w := NewWriter(buf)
+				w.Comma = tt.Comma
+				err = w.WriteAll(records)
+				if err != nil {
+					t.Logf("writer  = %#v\n", w)
+					t.Logf("records = %v\n", records)
+					t.Fatal(err)
+				}
+				if tt.Comment != 0 {
+					// Writer doesn't comment out fields that begin with the
+					// comment character, so the roundtrip may legitimately
+					// drop records.
+					return
+				}
+				t.Logf("second input = %q", buf.Bytes())
+
+				r = NewReader(buf)
+				r.Comma = tt.Comma
+				r.Comment = tt.Comment
+				r.LazyQuotes = tt.LazyQuotes
+				r.TrimLeadingSpace = tt.TrimLeadingSpace
+				result, err := r.ReadAll()
+				if err != nil {
+					t.Logf("reader  = %#v\n", r)
+					t.Logf("records = %v\n", records)
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(records, result) {
+					t.Fatalf("records = %#v\nresult  = %#v", records, result)
+				}
+			})
+		}
+	})
+}
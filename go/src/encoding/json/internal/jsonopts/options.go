@@ -0,0 +1,162 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jsonopts implements the options shared by
+// encoding/json/jsontext and encoding/json/v2.
+//
+// Options are sealed so that the set of options can grow without
+// breaking users of either package.
+package jsonopts
+
+// Sealed is the argument type of Options.JSONOptions. Because it is
+// declared in an internal package, no other package can implement Options.
+type Sealed struct{}
+
+// Options configures the behavior of encoding and decoding.
+type Options interface {
+	JSONOptions(Sealed)
+}
+
+// Flags is a set of boolean options.
+type Flags uint64
+
+const (
+	// jsontext options.
+
+	AllowDuplicateNames Flags = 1 << iota
+	AllowInvalidUTF8
+	EscapeForHTML
+	Multiline
+
+	// encoding/json/v2 options.
+
+	Deterministic
+	FormatNilMapAsNull
+	FormatNilSliceAsNull
+	MatchCaseInsensitiveNames
+	OmitZeroStructFields
+	RejectUnknownMembers
+	StringifyNumbers
+
+	// Internal options, never set by users.
+
+	// OmitTopLevelNewline suppresses the newline that the
+	// jsontext.Encoder writes after each top-level value.
+	OmitTopLevelNewline
+
+	// Flags for the non-boolean options, used only in Struct.Present.
+
+	indentFlag
+	indentPrefixFlag
+	marshalersFlag
+	unmarshalersFlag
+)
+
+// Struct is the resolved form of a list of options.
+// The zero value is the default configuration.
+type Struct struct {
+	Flags   Flags // values of the boolean options
+	Present Flags // options that were explicitly set
+
+	Indent       string
+	IndentPrefix string
+
+	// Marshalers and Unmarshalers hold the *json.Marshalers and
+	// *json.Unmarshalers values. They are stored as interface{}
+	// so that this package need not depend on encoding/json/v2.
+	Marshalers   interface{}
+	Unmarshalers interface{}
+
+	// Format and FormatDepth hold the format of a struct field
+	// while its value is marshaled or unmarshaled. The format only
+	// applies to the value at depth FormatDepth, not to nested values.
+	// They are never set by options.
+	Format      string
+	FormatDepth int
+}
+
+func (*Struct) JSONOptions(Sealed) {}
+
+// Get reports whether all of the boolean options in f are set.
+func (s *Struct) Get(f Flags) bool {
+	return s.Flags&f == f
+}
+
+// Set sets or clears the boolean options in f.
+func (s *Struct) Set(f Flags, v bool) {
+	if v {
+		s.Flags |= f
+	} else {
+		s.Flags &^= f
+	}
+	s.Present |= f
+}
+
+// Join applies srcs to s in order; later options take precedence.
+func (s *Struct) Join(srcs ...Options) {
+	for _, src := range srcs {
+		switch src := src.(type) {
+		case nil:
+		case Bool:
+			s.Set(src.Flag, src.Value)
+		case Indent:
+			s.Indent = string(src)
+			s.Present |= indentFlag
+			s.Set(Multiline, true)
+		case IndentPrefix:
+			s.IndentPrefix = string(src)
+			s.Present |= indentPrefixFlag
+			s.Set(Multiline, true)
+		case Marshalers:
+			s.Marshalers = src.V
+			s.Present |= marshalersFlag
+		case Unmarshalers:
+			s.Unmarshalers = src.V
+			s.Present |= unmarshalersFlag
+		case *Struct:
+			s.Flags = s.Flags&^src.Present | src.Flags&src.Present
+			s.Present |= src.Present
+			if src.Present&indentFlag != 0 {
+				s.Indent = src.Indent
+			}
+			if src.Present&indentPrefixFlag != 0 {
+				s.IndentPrefix = src.IndentPrefix
+			}
+			if src.Present&marshalersFlag != 0 {
+				s.Marshalers = src.Marshalers
+			}
+			if src.Present&unmarshalersFlag != 0 {
+				s.Unmarshalers = src.Unmarshalers
+			}
+		}
+	}
+}
+
+// Bool is a boolean option.
+type Bool struct {
+	Flag  Flags
+	Value bool
+}
+
+func (Bool) JSONOptions(Sealed) {}
+
+// Indent is the per-level indentation option.
+type Indent string
+
+func (Indent) JSONOptions(Sealed) {}
+
+// IndentPrefix is the per-line prefix option.
+type IndentPrefix string
+
+func (IndentPrefix) JSONOptions(Sealed) {}
+
+// Marshalers holds a *json.Marshalers.
+type Marshalers struct{ V interface{} }
+
+func (Marshalers) JSONOptions(Sealed) {}
+
+// Unmarshalers holds a *json.Unmarshalers.
+type Unmarshalers struct{ V interface{} }
+
+func (Unmarshalers) JSONOptions(Sealed) {}
@@ -0,0 +1,467 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"encoding/json/internal/jsonopts"
+	"io"
+)
+
+// Decoder is a streaming decoder for raw JSON tokens and values.
+// It is used to read a stream of top-level JSON values,
+// each separated by optional whitespace characters.
+//
+// ReadToken and ReadValue calls may be interleaved.
+// For example, the following JSON value:
+//
+//	{"name":"value","array":[null,false,true,3.14159],"object":{"k":"v"}}
+//
+// can be parsed with the following calls (ignoring errors for brevity):
+//
+//	d.ReadToken() // {
+//	d.ReadToken() // "name"
+//	d.ReadToken() // "value"
+//	d.ReadValue() // "array"
+//	d.ReadToken() // [
+//	d.ReadToken() // null
+//	d.ReadToken() // false
+//	d.ReadValue() // true
+//	d.ReadToken() // 3.14159
+//	d.ReadToken() // ]
+//	d.ReadValue() // "object"
+//	d.ReadValue() // {"k":"v"}
+//	d.ReadToken() // }
+//
+// The above is one of many possible sequence of calls and
+// may not represent the most sensible method to call for any given token/value.
+// For example, it is probably more common to call ReadToken to obtain a
+// string token for object names.
+//
+// Tokens and values returned by the Decoder refer to its internal buffer
+// and are only valid until the next call to a Decoder method
+// other than PeekKind, InputOffset, or the Stack methods.
+type Decoder struct {
+	rd  io.Reader
+	buf []byte
+
+	// prevStart and prevEnd are the positions in buf of the
+	// previously read token or value.
+	prevStart, prevEnd int
+	// pinned is a position in buf that must not be shifted out of buf
+	// while ReadValue is in progress, or -1.
+	pinned int
+	// baseOffset is the absolute offset in the input of buf[0].
+	baseOffset int64
+
+	eof bool  // rd has reported io.EOF
+	err error // sticky read error from rd
+
+	tokens stateMachine
+	names  objectNamespaceStack
+	opts   jsonopts.Struct
+}
+
+// minRead is the minimum number of bytes requested from the reader.
+const minRead = 512
+
+// NewDecoder constructs a new streaming decoder reading from r.
+func NewDecoder(r io.Reader, opts ...Options) *Decoder {
+	d := new(Decoder)
+	d.Reset(r, opts...)
+	return d
+}
+
+// Reset resets a decoder such that it is reading afresh from r and
+// configured with the provided options. Reset must not be called on
+// a Decoder passed to the UnmarshalerFrom.UnmarshalJSONFrom method
+// of encoding/json/v2 or the UnmarshalFromFunc function.
+func (d *Decoder) Reset(r io.Reader, opts ...Options) {
+	b := d.buf[:0]
+	if d.rd == nil {
+		b = nil // buf may be owned by the caller of reset
+	}
+	d.reset(b, r, opts...)
+}
+
+func (d *Decoder) reset(b []byte, r io.Reader, opts ...Options) {
+	*d = Decoder{
+		rd:     r,
+		buf:    b,
+		pinned: -1,
+		eof:    r == nil,
+		tokens: d.tokens,
+		names:  d.names,
+	}
+	if cap(d.buf) > 1<<16 && r != nil {
+		d.buf = nil // avoid pinning large buffers
+	}
+	d.tokens.reset()
+	d.names.reset()
+	d.opts.Join(opts...)
+}
+
+// Options returns the options used to construct the decoder and
+// may additionally contain options from encoding/json/v2.
+//
+// The result is a read-only snapshot of the options;
+// modifying it has no effect on the Decoder.
+func (d *Decoder) Options() Options {
+	opts := d.opts
+	return &opts
+}
+
+// fetch reads more data into buf. It reports io.EOF if the input is
+// exhausted, or the error reported by the underlying reader.
+// Positions in buf before the previous token or pinned value
+// are discarded, so callers must track positions relative to prevEnd.
+func (d *Decoder) fetch() error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.eof {
+		return io.EOF
+	}
+
+	// Discard data that is no longer needed.
+	keep := d.prevStart
+	if d.pinned >= 0 && d.pinned < keep {
+		keep = d.pinned
+	}
+	if keep > 0 && cap(d.buf)-len(d.buf) < minRead {
+		n := copy(d.buf, d.buf[keep:])
+		d.buf = d.buf[:n]
+		d.baseOffset += int64(keep)
+		d.prevStart -= keep
+		d.prevEnd -= keep
+		if d.pinned >= 0 {
+			d.pinned -= keep
+		}
+	}
+
+	// Grow the buffer if necessary.
+	if cap(d.buf)-len(d.buf) < minRead {
+		b := make([]byte, len(d.buf), 2*cap(d.buf)+minRead)
+		copy(b, d.buf)
+		d.buf = b
+	}
+
+	for i := 0; ; i++ {
+		n, err := d.rd.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+n]
+		switch {
+		case err == io.EOF:
+			d.eof = true
+		case err != nil:
+			d.err = err
+		}
+		switch {
+		case n > 0:
+			return nil
+		case err != nil:
+			return err
+		case i >= 100:
+			d.err = io.ErrNoProgress
+			return d.err
+		}
+	}
+}
+
+// consumeWith calls consume on the input starting at prevEnd+n,
+// fetching more input as long as it reports io.ErrUnexpectedEOF.
+func (d *Decoder) consumeWith(n int, consume func(b []byte) (int, error)) (int, error) {
+	for {
+		m, err := consume(d.buf[d.prevEnd+n:])
+		if err != io.ErrUnexpectedEOF || d.eof {
+			return m, err
+		}
+		if err := d.fetch(); err != nil && err != io.EOF {
+			return m, err
+		}
+	}
+}
+
+// skipWhitespace skips whitespace starting at prevEnd+n,
+// fetching more input as needed. It reports io.EOF if the input ends.
+func (d *Decoder) skipWhitespace(n int) (int, error) {
+	for {
+		n += consumeWhitespace(d.buf[d.prevEnd+n:])
+		if d.prevEnd+n < len(d.buf) {
+			return n, nil
+		}
+		if err := d.fetch(); err != nil {
+			return n, err
+		}
+	}
+}
+
+// nextToken skips whitespace and any implicit colon or comma delimiter,
+// returning the position of the next token relative to prevEnd.
+// Running out of input is only expected between top-level values,
+// which is reported as io.EOF; all other errors are wrapped.
+func (d *Decoder) nextToken() (n int, err error) {
+	n, err = d.skipWhitespace(0)
+	if err != nil {
+		if err == io.EOF && d.tokens.depth() == 1 {
+			return n, io.EOF
+		}
+		return n, d.wrapError(n, err)
+	}
+	c := d.buf[d.prevEnd+n]
+	delim := d.tokens.needDelim(kindFromByte(c))
+	if delim == 0 {
+		return n, nil
+	}
+	if c != delim {
+		var where string
+		switch {
+		case delim == ':':
+			where = "after object name (expecting ':')"
+		case d.tokens.last().isObject():
+			where = "after object value (expecting ',' or '}')"
+		default:
+			where = "after array element (expecting ',' or ']')"
+		}
+		return n, d.wrapError(n, newInvalidCharacterError(d.buf[d.prevEnd+n:], where))
+	}
+
+	// Past the delimiter, any error is located in the next value.
+	n, err = d.skipWhitespace(n + 1)
+	if err != nil {
+		return n, d.wrapValueError(n, err)
+	}
+	if delim == ',' {
+		switch c := d.buf[d.prevEnd+n]; {
+		case c == '}' || c == ']':
+			if d.tokens.last().isObject() {
+				return n, d.wrapValueError(n, newInvalidCharacterError(d.buf[d.prevEnd+n:], "at start of string (expecting '\"')"))
+			}
+			return n, d.wrapValueError(n, newInvalidCharacterError(d.buf[d.prevEnd+n:], "at start of value"))
+		}
+	}
+	return n, nil
+}
+
+// wrapError wraps a syntactic error that occurred at prevEnd+n,
+// which is located in the most recently read value.
+// I/O errors from the underlying reader are returned as is.
+func (d *Decoder) wrapError(n int, err error) error {
+	if err == d.err && err != nil {
+		return err
+	}
+	return wrapSyntacticError(d.tokens.stackPointer(&d.names), d.baseOffset+int64(d.prevEnd+n), err)
+}
+
+// wrapValueError is like wrapError, but for an error at or within
+// the next value, which has yet to be recorded in the state machine.
+func (d *Decoder) wrapValueError(n int, err error) error {
+	if err == d.err && err != nil {
+		return err
+	}
+	return wrapSyntacticError(d.tokens.nextPointer(&d.names), d.baseOffset+int64(d.prevEnd+n), err)
+}
+
+// PeekKind retrieves the next token kind, but does not advance the read offset.
+// It returns 0 if there are no more tokens or if the input is invalid;
+// the reason is reported by the next call to ReadToken or ReadValue.
+func (d *Decoder) PeekKind() Kind {
+	n, err := d.nextToken()
+	if err != nil {
+		return invalidKind
+	}
+	return kindFromByte(d.buf[d.prevEnd+n])
+}
+
+// SkipValue is semantically equivalent to calling ReadValue and discarding
+// the result.
+func (d *Decoder) SkipValue() error {
+	_, err := d.ReadValue()
+	return err
+}
+
+// ReadToken reads the next Token, advancing the read offset.
+// The returned token is only valid until the next Peek, Read, or Skip call.
+// It returns io.EOF if there are no more tokens.
+func (d *Decoder) ReadToken() (Token, error) {
+	n, err := d.nextToken()
+	if err != nil {
+		return Token{}, err
+	}
+	pos := d.prevEnd + n
+	switch c := d.buf[pos]; c {
+	case 'n', 'f', 't':
+		lit := Kind(c).String()
+		m, err := d.consumeWith(n, func(b []byte) (int, error) { return consumeLiteral(b, lit) })
+		if err != nil {
+			return Token{}, d.wrapValueError(n+m, err)
+		}
+		if err := d.tokens.appendLiteral(); err != nil {
+			return Token{}, d.wrapValueError(n, err)
+		}
+		d.advance(n, m)
+		return Token{kind: Kind(c)}, nil
+
+	case '"':
+		allowInvalidUTF8 := d.opts.Get(jsonopts.AllowInvalidUTF8)
+		m, err := d.consumeWith(n, func(b []byte) (int, error) { return consumeString(b, allowInvalidUTF8) })
+		if err != nil {
+			return Token{}, d.wrapValueError(n+m, err)
+		}
+		if d.tokens.last().needObjectName() {
+			pos = d.prevEnd + n
+			name := d.buf[pos : pos+m]
+			if !d.names.last().insertQuoted(name, !d.opts.Get(jsonopts.AllowDuplicateNames)) {
+				return Token{}, newDuplicateNameError(d.tokens, &d.names, d.baseOffset+int64(pos), name)
+			}
+		}
+		d.tokens.appendString()
+		d.advance(n, m)
+		return Token{raw: d, kind: '"', num: uint64(d.baseOffset + int64(d.prevStart))}, nil
+
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		m, err := d.consumeWith(n, func(b []byte) (int, error) { return consumeNumber(b, d.eof) })
+		if err != nil {
+			return Token{}, d.wrapValueError(n+m, err)
+		}
+		if err := d.tokens.appendNumber(); err != nil {
+			return Token{}, d.wrapValueError(n, err)
+		}
+		d.advance(n, m)
+		return Token{raw: d, kind: '0', num: uint64(d.baseOffset + int64(d.prevStart))}, nil
+
+	case '{':
+		if err := d.tokens.pushObject(); err != nil {
+			return Token{}, d.wrapValueError(n, err)
+		}
+		d.names.push()
+		d.advance(n, 1)
+		return ObjectStart, nil
+
+	case '}':
+		if err := d.tokens.popObject(); err != nil {
+			return Token{}, d.wrapError(n, err)
+		}
+		d.names.pop()
+		d.advance(n, 1)
+		return ObjectEnd, nil
+
+	case '[':
+		if err := d.tokens.pushArray(); err != nil {
+			return Token{}, d.wrapValueError(n, err)
+		}
+		d.advance(n, 1)
+		return ArrayStart, nil
+
+	case ']':
+		if err := d.tokens.popArray(); err != nil {
+			return Token{}, d.wrapError(n, err)
+		}
+		d.advance(n, 1)
+		return ArrayEnd, nil
+
+	default:
+		return Token{}, d.wrapValueError(n, newInvalidCharacterError(d.buf[pos:], "at start of value"))
+	}
+}
+
+// advance records the token of length m at prevEnd+n as the previous token.
+func (d *Decoder) advance(n, m int) {
+	d.prevStart = d.prevEnd + n
+	d.prevEnd = d.prevStart + m
+}
+
+// ReadValue returns the next raw JSON value, advancing the read offset.
+// The value is stripped of any leading or trailing whitespace and
+// contains the exact bytes of the input, which may contain invalid UTF-8
+// if AllowInvalidUTF8 is specified.
+//
+// The returned value is only valid until the next Peek, Read, or Skip call
+// and may not be mutated while the Decoder remains in use.
+// If the decoder is currently at the end token for an object or array,
+// then it reports a SyntacticError and the internal state remains unchanged.
+// It returns io.EOF if there are no more values.
+func (d *Decoder) ReadValue() (Value, error) {
+	n, err := d.nextToken()
+	if err != nil {
+		return nil, err
+	}
+	if c := d.buf[d.prevEnd+n]; c == '}' || c == ']' {
+		return nil, d.wrapError(n, newInvalidCharacterError(d.buf[d.prevEnd+n:], "at start of value"))
+	}
+
+	// Read the value one token at a time, restoring the state on error
+	// so that the Decoder is left as it was before the call.
+	// The input is pinned from the start of the previous token onward
+	// so that the positions can be restored.
+	depth := len(d.tokens)
+	last := *d.tokens.last()
+	numNames := len(d.names)
+	prevLen := d.prevEnd - d.prevStart
+	valueOffset := d.prevEnd + n - d.prevStart
+	d.pinned = d.prevStart
+	for {
+		if _, err := d.ReadToken(); err != nil {
+			d.tokens = d.tokens[:depth]
+			*d.tokens.last() = last
+			d.names = d.names[:numNames]
+			d.prevStart, d.prevEnd = d.pinned, d.pinned+prevLen
+			d.pinned = -1
+			return nil, err
+		}
+		if len(d.tokens) == depth {
+			break
+		}
+	}
+	d.prevStart = d.pinned + valueOffset
+	d.pinned = -1
+	return Value(d.buf[d.prevStart:d.prevEnd]), nil
+}
+
+// InputOffset returns the current input byte offset. It gives the location
+// of the next byte immediately after the most recently returned token or value.
+// The number of bytes actually read from the underlying io.Reader may be more
+// than this offset due to internal buffering effects.
+func (d *Decoder) InputOffset() int64 {
+	return d.baseOffset + int64(d.prevEnd)
+}
+
+// UnreadBuffer returns the data remaining in the unread buffer,
+// which may contain zero or more bytes.
+// The returned buffer must not be mutated while Decoder continues to be used.
+// The buffer contents are valid until the next Peek, Read, or Skip call.
+func (d *Decoder) UnreadBuffer() []byte {
+	return d.buf[d.prevEnd:]
+}
+
+// StackDepth returns the depth of the state machine for read JSON data.
+// Each level on the stack represents a nested JSON object or array.
+// It is incremented whenever an ObjectStart or ArrayStart token is encountered
+// and decremented whenever an ObjectEnd or ArrayEnd token is encountered.
+// The depth is zero-indexed, where zero represents the top-level JSON value.
+func (d *Decoder) StackDepth() int {
+	// NOTE: Keep in sync with Encoder.StackDepth.
+	return d.tokens.depth() - 1
+}
+
+// StackIndex returns information about the specified stack level.
+// It must be a number between 0 and StackDepth, inclusive.
+// For each level, it reports the kind:
+//
+//   - 0 for a level of zero,
+//   - '{' for a level representing a JSON object, and
+//   - '[' for a level representing a JSON array.
+//
+// It also reports the length of that JSON object or array.
+// Each name and value in a JSON object is counted separately,
+// so the effective number of members would be half the length.
+// A complete JSON object must have an even length.
+func (d *Decoder) StackIndex(i int) (Kind, int64) {
+	// NOTE: Keep in sync with Encoder.StackIndex.
+	return d.tokens.index(i)
+}
+
+// StackPointer returns a JSON Pointer (RFC 6901) to the most recently read value.
+func (d *Decoder) StackPointer() Pointer {
+	return d.tokens.stackPointer(&d.names)
+}
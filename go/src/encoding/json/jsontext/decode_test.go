@@ -0,0 +1,307 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// tokenString formats a token for comparison in tests.
+func tokenString(t Token) string {
+	switch t.Kind() {
+	case '"':
+		return "S:" + t.String()
+	case '0':
+		return "N:" + t.String()
+	default:
+		return t.String()
+	}
+}
+
+var decodeTests = []struct {
+	in   string
+	want []string
+}{
+	{in: ``, want: nil},
+	{in: ` null `, want: []string{"null"}},
+	{in: `true false`, want: []string{"true", "false"}},
+	{in: `"hello"`, want: []string{"S:hello"}},
+	{in: `"\u0041\n\ud83d\ude00\/"`, want: []string{"S:A\n\U0001F600/"}},
+	{in: `-1.5e+10`, want: []string{"N:-1.5e+10"}},
+	{in: `0 1 2`, want: []string{"N:0", "N:1", "N:2"}},
+	{in: `{}{}`, want: []string{"{", "}", "{", "}"}},
+	{in: `[]`, want: []string{"[", "]"}},
+	{
+		in:   "{\"a\" : [ 1 , null ] ,\n\t\"b\":{\"c\":\"d\"}}",
+		want: []string{"{", "S:a", "[", "N:1", "null", "]", "S:b", "{", "S:c", "S:d", "}", "}"},
+	},
+}
+
+func readAll(d *Decoder) ([]string, error) {
+	var got []string
+	for {
+		tok, err := d.ReadToken()
+		if err == io.EOF {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		got = append(got, tokenString(tok))
+	}
+}
+
+func TestDecoderReadToken(t *testing.T) {
+	for _, tt := range decodeTests {
+		for _, oneByte := range []bool{false, true} {
+			var r io.Reader = strings.NewReader(tt.in)
+			if oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			got, err := readAll(NewDecoder(r))
+			if err != nil {
+				t.Errorf("ReadToken(%q) error: %v", tt.in, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadToken(%q) (oneByte=%v):\ngot  %q\nwant %q", tt.in, oneByte, got, tt.want)
+			}
+		}
+	}
+}
+
+var decodeErrorTests = []struct {
+	in      string
+	opts    []Options
+	wantErr error
+	offset  int64
+	pointer Pointer
+}{
+	{in: `nul`, wantErr: io.ErrUnexpectedEOF, offset: 3},
+	{in: `nulx`, wantErr: errors.New(`invalid character 'x' within literal null (expecting 'l')`), offset: 3},
+	{in: `truex`, wantErr: errors.New(`invalid character 'x' after literal true`), offset: 4},
+	{in: `01`, wantErr: errors.New(`invalid character '1' after number`), offset: 1},
+	{in: `1.`, wantErr: io.ErrUnexpectedEOF, offset: 2},
+	{in: `-x`, wantErr: errors.New(`invalid character 'x' within number (expecting digit)`), offset: 1},
+	{in: `"abc`, wantErr: io.ErrUnexpectedEOF, offset: 4},
+	{in: "\"a\tb\"", wantErr: errors.New(`invalid character '\t' within string (expecting non-control character)`), offset: 2},
+	{in: `"\x"`, wantErr: errors.New("invalid escape sequence `\\x` within string"), offset: 1},
+	{in: `"\ud800"`, wantErr: errInvalidUTF8, offset: 1},
+	{in: "\"\xff\"", wantErr: errInvalidUTF8, offset: 1},
+	{in: `[1 2]`, wantErr: errors.New(`invalid character '2' after array element (expecting ',' or ']')`), offset: 3, pointer: "/0"},
+	{in: `[1,]`, wantErr: errors.New(`invalid character ']' at start of value`), offset: 3, pointer: "/1"},
+	{in: `[1, 2, tru]`, wantErr: errors.New(`invalid character ']' within literal true (expecting 'e')`), offset: 10, pointer: "/2"},
+	{in: `[tru]`, wantErr: errors.New(`invalid character ']' within literal true (expecting 'e')`), offset: 4, pointer: "/0"},
+	{in: `[[1],[2],x]`, wantErr: errors.New(`invalid character 'x' at start of value`), offset: 9, pointer: "/2"},
+	{in: `[1,`, wantErr: io.ErrUnexpectedEOF, offset: 3, pointer: "/1"},
+	{in: `{"a":1,}`, wantErr: errors.New(`invalid character '}' at start of string (expecting '"')`), offset: 7},
+	{in: `{"a":tru}`, wantErr: errors.New(`invalid character '}' within literal true (expecting 'e')`), offset: 8, pointer: "/a"},
+	{in: `{"a":[1,]}`, wantErr: errors.New(`invalid character ']' at start of value`), offset: 8, pointer: "/a/1"},
+	{in: `{"a" 1}`, wantErr: errors.New(`invalid character '1' after object name (expecting ':')`), offset: 5, pointer: "/a"},
+	{in: `{1:2}`, wantErr: ErrNonStringName, offset: 1},
+	{in: `{"a"}`, wantErr: errors.New(`invalid character '}' after object name (expecting ':')`), offset: 4, pointer: "/a"},
+	{in: `[}`, wantErr: errMismatchDelim, offset: 1},
+	{in: `]`, wantErr: errMismatchDelim, offset: 0},
+	{in: `{"a":[`, wantErr: io.ErrUnexpectedEOF, offset: 6, pointer: "/a"},
+	{in: `{"a":1,"b":{"c":2,"c":3}}`, wantErr: ErrDuplicateName, offset: 18, pointer: "/b/c"},
+	{in: `{"a/b":{"~":0,"~":1}}`, wantErr: ErrDuplicateName, offset: 14, pointer: "/a~1b/~0"},
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, tt := range decodeErrorTests {
+		_, err := readAll(NewDecoder(strings.NewReader(tt.in), tt.opts...))
+		var serr *SyntacticError
+		if !errors.As(err, &serr) {
+			t.Errorf("ReadToken(%q) error = %v, want SyntacticError", tt.in, err)
+			continue
+		}
+		if serr.Err.Error() != tt.wantErr.Error() {
+			t.Errorf("ReadToken(%q) error = %v, want %v", tt.in, serr.Err, tt.wantErr)
+		}
+		if serr.ByteOffset != tt.offset {
+			t.Errorf("ReadToken(%q) offset = %d, want %d", tt.in, serr.ByteOffset, tt.offset)
+		}
+		if serr.JSONPointer != tt.pointer {
+			t.Errorf("ReadToken(%q) pointer = %q, want %q", tt.in, serr.JSONPointer, tt.pointer)
+		}
+	}
+}
+
+func TestDecoderOptions(t *testing.T) {
+	in := `{"a":1,"a":"\ud800` + "\xff" + `"}`
+	if _, err := readAll(NewDecoder(strings.NewReader(in))); err == nil {
+		t.Fatalf("ReadToken succeeded unexpectedly")
+	}
+	got, err := readAll(NewDecoder(strings.NewReader(in), AllowDuplicateNames(true), AllowInvalidUTF8(true)))
+	if err != nil {
+		t.Fatalf("ReadToken error: %v", err)
+	}
+	want := []string{"{", "S:a", "N:1", "S:a", "S:\uFFFD\uFFFD", "}"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadToken:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestDecoderReadValue(t *testing.T) {
+	in := ` {"name":"value","array":[null,false,true,3.14159],"object":{"k":"v"}} `
+	for _, r := range []io.Reader{strings.NewReader(in), iotest.OneByteReader(strings.NewReader(in))} {
+		d := NewDecoder(r)
+		var got []string
+		read := func(value bool) {
+			if value {
+				v, err := d.ReadValue()
+				if err != nil {
+					t.Fatalf("ReadValue error: %v", err)
+				}
+				got = append(got, "V:"+string(v))
+			} else {
+				tok, err := d.ReadToken()
+				if err != nil {
+					t.Fatalf("ReadToken error: %v", err)
+				}
+				got = append(got, tokenString(tok))
+			}
+		}
+		for _, value := range []bool{false, false, false, true, false, false, false, true, false, false, true, true, false} {
+			read(value)
+		}
+		want := []string{
+			"{", "S:name", "S:value", `V:"array"`, "[", "null", "false", "V:true",
+			"N:3.14159", "]", `V:"object"`, `V:{"k":"v"}`, "}",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got  %q\nwant %q", got, want)
+		}
+		if _, err := d.ReadValue(); err != io.EOF {
+			t.Errorf("ReadValue error = %v, want io.EOF", err)
+		}
+		if off := d.InputOffset(); off != int64(len(in)-1) {
+			t.Errorf("InputOffset = %d, want %d", off, len(in)-1)
+		}
+	}
+}
+
+func TestDecoderReadValueError(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`[{"a":[1,2,x]}]`))
+	if _, err := d.ReadToken(); err != nil {
+		t.Fatalf("ReadToken error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := d.ReadValue()
+		var serr *SyntacticError
+		if !errors.As(err, &serr) {
+			t.Fatalf("ReadValue error = %v, want SyntacticError", err)
+		}
+		if serr.ByteOffset != 11 || serr.JSONPointer != "/0/a/2" {
+			t.Errorf("ReadValue error = %v, want offset 11 within /0/a/2", err)
+		}
+		// The state must be unchanged so that the error is reproducible.
+		if d.StackDepth() != 1 || d.InputOffset() != 1 {
+			t.Errorf("after error: StackDepth = %d, InputOffset = %d, want 1, 1", d.StackDepth(), d.InputOffset())
+		}
+	}
+	if _, err := NewDecoder(strings.NewReader(`[]`)).ReadValue(); err != nil {
+		t.Errorf("ReadValue error: %v", err)
+	}
+}
+
+func TestDecoderStack(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`{"a":[0,{"b~/":null}]}`))
+	for i := 0; i < 7; i++ {
+		if _, err := d.ReadToken(); err != nil {
+			t.Fatalf("ReadToken error: %v", err)
+		}
+	}
+	if got, want := d.StackPointer(), Pointer("/a/1/b~0~1"); got != want {
+		t.Errorf("StackPointer = %q, want %q", got, want)
+	}
+	if got := d.StackDepth(); got != 3 {
+		t.Errorf("StackDepth = %d, want 3", got)
+	}
+	if k, n := d.StackIndex(2); k != '[' || n != 2 {
+		t.Errorf("StackIndex(2) = (%v, %d), want ([, 2)", k, n)
+	}
+	if k, n := d.StackIndex(3); k != '{' || n != 2 {
+		t.Errorf("StackIndex(3) = (%v, %d), want ({, 2)", k, n)
+	}
+	if k := d.PeekKind(); k != '}' {
+		t.Errorf("PeekKind = %v, want }", k)
+	}
+}
+
+func TestTokenInvalidated(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`["a","b"]`))
+	d.ReadToken()
+	tok, _ := d.ReadToken()
+	clone := tok.Clone()
+	d.ReadToken()
+	if clone.String() != "a" {
+		t.Errorf("Clone().String() = %q, want %q", clone.String(), "a")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("String on invalidated Token did not panic")
+		}
+	}()
+	_ = tok.String()
+}
+
+func TestTokenNumbers(t *testing.T) {
+	tests := []struct {
+		in    string
+		float float64
+		int   int64
+		uint  uint64
+	}{
+		{"0", 0, 0, 0},
+		{"-1.9", -1.9, -1, 0},
+		{"1e3", 1000, 1000, 1000},
+		{"18446744073709551615", 18446744073709551615, 9223372036854775807, 18446744073709551615},
+		{"-99999999999999999999", -99999999999999999999, -9223372036854775808, 0},
+		{"1e400", 1.7976931348623157e308, 9223372036854775807, 18446744073709551615},
+	}
+	for _, tt := range tests {
+		d := NewDecoder(bytes.NewReader([]byte(tt.in)))
+		tok, err := d.ReadToken()
+		if err != nil {
+			t.Fatalf("ReadToken(%q) error: %v", tt.in, err)
+		}
+		if got := tok.Float(); got != tt.float {
+			t.Errorf("Token(%s).Float() = %v, want %v", tt.in, got, tt.float)
+		}
+		if got := tok.Int(); got != tt.int {
+			t.Errorf("Token(%s).Int() = %v, want %v", tt.in, got, tt.int)
+		}
+		if got := tok.Uint(); got != tt.uint {
+			t.Errorf("Token(%s).Uint() = %v, want %v", tt.in, got, tt.uint)
+		}
+	}
+}
+
+func BenchmarkDecoderReadToken(b *testing.B) {
+	in := []byte(`{"name":"value","array":[null,false,true,3.14159],"object":{"k":"v"}}`)
+	r := bytes.NewReader(in)
+	d := NewDecoder(r)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(in)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(in)
+		d.Reset(r)
+		for {
+			if _, err := d.ReadToken(); err != nil {
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jsontext implements syntactic processing of JSON
+// as specified in RFC 4627, RFC 7159, RFC 7493, RFC 8259, and RFC 8785.
+// JSON is a simple data interchange format that can represent
+// primitive data types such as booleans, strings, and numbers,
+// in addition to structured data types such as objects and arrays.
+//
+// This package provides the Encoder and Decoder types, which write
+// and read a stream of JSON one Token or Value at a time. Unlike
+// encoding/json.Decoder.Token, the Decoder does not allocate for
+// each token: a Token read from a Decoder refers directly to the
+// Decoder's internal buffer and remains valid only until the next
+// call to a Decoder read method.
+//
+// The Decoder reports malformed input as a *SyntacticError, which
+// records the byte offset and the JSON Pointer (RFC 6901) of the
+// location of the error within the input.
+//
+// For marshaling and unmarshaling Go values, see encoding/json/v2,
+// which is built on top of this package.
+//
+// Terminology
+//
+// A JSON value is either a literal (null, false, true), a string,
+// a number, an object, or an array. A Token is a lexical unit of JSON:
+// a literal, string, or number, or one of the four delimiters
+// '{', '}', '[', ']'. Objects and arrays are composed of a start
+// delimiter, a sequence of values (names and values alternate in an
+// object), and an end delimiter.
+//
+// By default the Encoder and Decoder enforce the constraints of
+// RFC 7493: object member names must be unique and strings must be
+// valid UTF-8. AllowDuplicateNames and AllowInvalidUTF8 relax them.
+package jsontext
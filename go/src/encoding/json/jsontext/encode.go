@@ -0,0 +1,418 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"encoding/json/internal/jsonopts"
+	"io"
+)
+
+// Encoder is a streaming encoder from raw JSON tokens and values.
+// It is used to write a stream of top-level JSON values,
+// each terminated with a newline character.
+//
+// WriteToken and WriteValue calls may be interleaved.
+// For example, the following JSON value:
+//
+//	{"name":"value","array":[null,false,true,3.14159],"object":{"k":"v"}}
+//
+// can be composed with the following calls (ignoring errors for brevity):
+//
+//	e.WriteToken(ObjectStart)        // {
+//	e.WriteToken(String("name"))     // "name"
+//	e.WriteToken(String("value"))    // "value"
+//	e.WriteValue(Value(`"array"`))   // "array"
+//	e.WriteToken(ArrayStart)         // [
+//	e.WriteToken(Null)               // null
+//	e.WriteToken(False)              // false
+//	e.WriteValue(Value("true"))      // true
+//	e.WriteToken(Float(3.14159))     // 3.14159
+//	e.WriteToken(ArrayEnd)           // ]
+//	e.WriteValue(Value(`"object"`))  // "object"
+//	e.WriteValue(Value(`{"k":"v"}`)) // {"k":"v"}
+//	e.WriteToken(ObjectEnd)          // }
+//
+// The above is one of many possible sequence of calls and
+// may not represent the most sensible method to call for any given token/value.
+// For example, it is probably more common to call WriteToken with a string
+// for object names.
+//
+// Output is buffered and written to the underlying io.Writer
+// once each top-level value is complete, or earlier if the
+// buffered output grows large.
+type Encoder struct {
+	wr         io.Writer
+	buf        []byte
+	baseOffset int64 // absolute offset in the output of buf[0]
+	err        error // sticky write error from wr
+
+	tokens stateMachine
+	names  objectNamespaceStack
+	opts   jsonopts.Struct
+	indent string // per-level indentation if Multiline
+
+	// dec is used by WriteValue to parse the value being written.
+	dec Decoder
+}
+
+// flushThreshold is the size of buffered output
+// that is flushed even within a top-level value.
+const flushThreshold = 4 << 10
+
+// NewEncoder constructs a new streaming encoder writing to w
+// configured with the provided options.
+func NewEncoder(w io.Writer, opts ...Options) *Encoder {
+	e := new(Encoder)
+	e.Reset(w, opts...)
+	return e
+}
+
+// Reset resets an encoder such that it is writing afresh to w and
+// configured with the provided options. Reset must not be called on
+// an Encoder passed to the MarshalerTo.MarshalJSONTo method
+// of encoding/json/v2 or the MarshalToFunc function.
+func (e *Encoder) Reset(w io.Writer, opts ...Options) {
+	e.reset(e.buf[:0], w, opts...)
+}
+
+func (e *Encoder) reset(b []byte, w io.Writer, opts ...Options) {
+	if cap(b) > 1<<16 {
+		b = nil // avoid pinning large buffers
+	}
+	e.wr = w
+	e.buf = b
+	e.baseOffset = 0
+	e.err = nil
+	e.tokens.reset()
+	e.names.reset()
+	e.opts = jsonopts.Struct{}
+	e.opts.Join(opts...)
+	e.indent = ""
+	if e.opts.Get(jsonopts.Multiline) {
+		e.indent = e.opts.Indent
+		if e.indent == "" {
+			e.indent = "\t"
+		}
+	}
+}
+
+// Options returns the options used to construct the encoder and
+// may additionally contain options from encoding/json/v2.
+//
+// The result is a read-only snapshot of the options;
+// modifying it has no effect on the Encoder.
+func (e *Encoder) Options() Options {
+	opts := e.opts
+	return &opts
+}
+
+// flush writes the buffered output to the underlying io.Writer.
+func (e *Encoder) flush() error {
+	if e.wr == nil || len(e.buf) == 0 {
+		return nil
+	}
+	n, err := e.wr.Write(e.buf)
+	e.baseOffset += int64(n)
+	if err == nil && n < len(e.buf) {
+		err = io.ErrShortWrite
+	}
+	e.buf = e.buf[:copy(e.buf, e.buf[n:])]
+	if err != nil {
+		e.err = err
+	}
+	return err
+}
+
+// maybeFlush flushes the output once a top-level value is complete
+// or if the buffered output has grown large.
+func (e *Encoder) maybeFlush() error {
+	if e.tokens.depth() == 1 || len(e.buf) > flushThreshold {
+		return e.flush()
+	}
+	return nil
+}
+
+// wrapError wraps a syntactic error at the current output offset,
+// which is located in the most recently written value.
+func (e *Encoder) wrapError(err error) error {
+	return wrapSyntacticError(e.tokens.stackPointer(&e.names), e.OutputOffset(), err)
+}
+
+// wrapValueError is like wrapError, but for an error in the next value,
+// which has yet to be recorded in the state machine.
+func (e *Encoder) wrapValueError(err error) error {
+	return wrapSyntacticError(e.tokens.nextPointer(&e.names), e.OutputOffset(), err)
+}
+
+// appendIndent appends a newline followed by the indent prefix
+// and n copies of the indentation.
+func (e *Encoder) appendIndent(b []byte, n int) []byte {
+	b = append(b, '\n')
+	b = append(b, e.opts.IndentPrefix...)
+	for i := 0; i < n; i++ {
+		b = append(b, e.indent...)
+	}
+	return b
+}
+
+// appendSeparator appends the implicit colon or comma delimiter
+// and any whitespace that precedes a token of kind next.
+func (e *Encoder) appendSeparator(b []byte, next Kind) []byte {
+	if e.tokens.depth() == 1 {
+		// Without a trailing newline, adjacent top-level values
+		// must still be separated (e.g., 1 and 2 rather than 12).
+		if e.opts.Get(jsonopts.OmitTopLevelNewline) && e.tokens.last().length() > 0 {
+			b = append(b, ' ')
+		}
+		return b
+	}
+	multiline := e.opts.Get(jsonopts.Multiline)
+	switch last := e.tokens.last(); {
+	case last.needObjectValue():
+		b = append(b, ':')
+		if multiline {
+			b = append(b, ' ')
+		}
+	case next == '}' || next == ']':
+		if multiline && last.length() > 0 {
+			b = e.appendIndent(b, e.tokens.depth()-2)
+		}
+	default:
+		if last.length() > 0 {
+			b = append(b, ',')
+		}
+		if multiline {
+			b = e.appendIndent(b, e.tokens.depth()-1)
+		}
+	}
+	return b
+}
+
+// WriteToken writes the next token and advances the internal write offset.
+//
+// The provided token kind must be consistent with the JSON grammar.
+// For example, it is an error to provide a number when the encoder
+// is expecting an object name (which is always a string), or
+// to provide an end object delimiter when the encoder is finishing an array.
+// If the provided token is invalid, then it reports a SyntacticError and
+// the internal state remains unchanged.
+func (e *Encoder) WriteToken(t Token) error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.writeToken(t); err != nil {
+		return err
+	}
+	return e.maybeFlush()
+}
+
+func (e *Encoder) writeToken(t Token) error {
+	k := t.Kind()
+	b := e.appendSeparator(e.buf, k)
+	var err error
+	switch k {
+	case 'n', 'f', 't':
+		if err := e.tokens.appendLiteral(); err != nil {
+			return e.wrapValueError(err)
+		}
+		b = append(b, k.String()...)
+
+	case '"':
+		start := len(b)
+		allowInvalidUTF8 := e.opts.Get(jsonopts.AllowInvalidUTF8)
+		if t.raw != nil && !allowInvalidUTF8 && !e.opts.Get(jsonopts.EscapeForHTML) {
+			// The string was read by a Decoder, so it can be copied
+			// verbatim once it is known to satisfy this Encoder.
+			raw := t.bytes()
+			if _, err := consumeString(raw, false); err != nil {
+				return e.wrapValueError(err)
+			}
+			b = append(b, raw...)
+		} else if b, err = appendQuote(b, t.String(), allowInvalidUTF8, e.opts.Get(jsonopts.EscapeForHTML)); err != nil {
+			return e.wrapValueError(err)
+		}
+		if e.tokens.last().needObjectName() {
+			if !e.names.last().insertQuoted(b[start:], !e.opts.Get(jsonopts.AllowDuplicateNames)) {
+				return newDuplicateNameError(e.tokens, &e.names, e.OutputOffset(), b[start:])
+			}
+		}
+		e.tokens.appendString()
+
+	case '0':
+		if b, err = t.appendNumber(b); err != nil {
+			return e.wrapValueError(err)
+		}
+		if err := e.tokens.appendNumber(); err != nil {
+			return e.wrapValueError(err)
+		}
+
+	case '{':
+		if err := e.tokens.pushObject(); err != nil {
+			return e.wrapValueError(err)
+		}
+		e.names.push()
+		b = append(b, '{')
+
+	case '}':
+		if err := e.tokens.popObject(); err != nil {
+			return e.wrapError(err)
+		}
+		e.names.pop()
+		b = append(b, '}')
+
+	case '[':
+		if err := e.tokens.pushArray(); err != nil {
+			return e.wrapValueError(err)
+		}
+		b = append(b, '[')
+
+	case ']':
+		if err := e.tokens.popArray(); err != nil {
+			return e.wrapError(err)
+		}
+		b = append(b, ']')
+
+	default:
+		return e.wrapError(errInvalidToken)
+	}
+
+	if e.tokens.depth() == 1 && !e.opts.Get(jsonopts.OmitTopLevelNewline) {
+		b = append(b, '\n')
+	}
+	e.buf = b
+	return nil
+}
+
+// WriteValue writes the next raw value and advances the internal write offset.
+// The Encoder does not simply copy the provided value verbatim, but
+// parses it to ensure that it is syntactically valid and reformats it
+// according to how the Encoder is configured to format whitespace and strings.
+//
+// The provided value kind must be consistent with the JSON grammar
+// (see examples on Encoder.WriteToken). If the provided value is invalid,
+// then it reports a SyntacticError and the internal state remains unchanged.
+func (e *Encoder) WriteValue(v Value) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	// Save the state so that it can be restored on error.
+	depth := e.tokens.depth()
+	last := *e.tokens.last()
+	numNames := len(e.names)
+	numBuf := len(e.buf)
+
+	if err := e.writeValue(v); err != nil {
+		e.tokens = e.tokens[:depth]
+		if last.needObjectName() && e.tokens.last().length() > last.length() {
+			e.names.last().removeLast() // value was written as an object name
+		}
+		*e.tokens.last() = last
+		e.names = e.names[:numNames]
+		e.buf = e.buf[:numBuf]
+		if verr, ok := err.(*valueError); ok {
+			// Locate the error relative to the restored state,
+			// where v is the next value to be written.
+			ptr := e.tokens.nextPointer(&e.names) + verr.ptr
+			err = &SyntacticError{ByteOffset: verr.offset, JSONPointer: ptr, Err: verr.err}
+		}
+		return err
+	}
+	return e.maybeFlush()
+}
+
+func (e *Encoder) writeValue(v Value) error {
+	d := &e.dec
+	d.reset(v, nil,
+		jsonopts.Bool{Flag: jsonopts.AllowDuplicateNames, Value: true},
+		jsonopts.Bool{Flag: jsonopts.AllowInvalidUTF8, Value: e.opts.Get(jsonopts.AllowInvalidUTF8)})
+	defer d.reset(nil, nil) // avoid retaining v
+
+	for {
+		t, err := d.ReadToken()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return e.rebaseError(err)
+		}
+		if err := e.writeToken(t); err != nil {
+			return err
+		}
+		if d.tokens.depth() == 1 {
+			break
+		}
+	}
+
+	// The value must not be followed by anything other than whitespace.
+	if _, err := d.ReadToken(); err != io.EOF {
+		if err == nil {
+			err = errTrailingData
+		}
+		return e.rebaseError(err)
+	}
+	return nil
+}
+
+// valueError is an error that occurred while parsing the value given to
+// WriteValue. It is located relative to that value until WriteValue
+// has restored the state of the Encoder.
+type valueError struct {
+	offset int64   // output offset at which the error occurred
+	ptr    Pointer // location of the error within the value
+	err    error
+}
+
+func (e *valueError) Error() string { return e.err.Error() }
+
+// rebaseError reports an error that occurred while parsing the value
+// given to WriteValue relative to the output of the Encoder.
+func (e *Encoder) rebaseError(err error) error {
+	verr := &valueError{offset: e.OutputOffset(), err: err}
+	if serr, ok := err.(*SyntacticError); ok {
+		verr.ptr, verr.err = serr.JSONPointer, serr.Err
+	}
+	return verr
+}
+
+// OutputOffset returns the current output byte offset. It gives the location
+// of the next byte immediately after the most recently written token or value.
+// The number of bytes actually written to the underlying io.Writer may be less
+// than this offset due to internal buffering effects.
+func (e *Encoder) OutputOffset() int64 {
+	return e.baseOffset + int64(len(e.buf))
+}
+
+// StackDepth returns the depth of the state machine for written JSON data.
+// Each level on the stack represents a nested JSON object or array.
+// It is incremented whenever an ObjectStart or ArrayStart token is encountered
+// and decremented whenever an ObjectEnd or ArrayEnd token is encountered.
+// The depth is zero-indexed, where zero represents the top-level JSON value.
+func (e *Encoder) StackDepth() int {
+	// NOTE: Keep in sync with Decoder.StackDepth.
+	return e.tokens.depth() - 1
+}
+
+// StackIndex returns information about the specified stack level.
+// It must be a number between 0 and StackDepth, inclusive.
+// For each level, it reports the kind:
+//
+//   - 0 for a level of zero,
+//   - '{' for a level representing a JSON object, and
+//   - '[' for a level representing a JSON array.
+//
+// It also reports the length of that JSON object or array.
+// Each name and value in a JSON object is counted separately,
+// so the effective number of members would be half the length.
+// A complete JSON object must have an even length.
+func (e *Encoder) StackIndex(i int) (Kind, int64) {
+	// NOTE: Keep in sync with Decoder.StackIndex.
+	return e.tokens.index(i)
+}
+
+// StackPointer returns a JSON Pointer (RFC 6901) to the most recently written value.
+func (e *Encoder) StackPointer() Pointer {
+	return e.tokens.stackPointer(&e.names)
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+var encodeTests = []struct {
+	name   string
+	opts   []Options
+	tokens []interface{} // Token or Value
+	want   string
+}{{
+	name:   "Literals",
+	tokens: []interface{}{Null, True, False},
+	want:   "null\ntrue\nfalse\n",
+}, {
+	name:   "Numbers",
+	tokens: []interface{}{ArrayStart, Int(-1), Uint(math.MaxUint64), Float(0.1), Float(1e21), Float(1e-7), ArrayEnd},
+	want:   "[-1,18446744073709551615,0.1,1e+21,1e-7]\n",
+}, {
+	name:   "Strings",
+	tokens: []interface{}{String("<a\tb\"\\\u2028>&")},
+	want:   "\"<a\\tb\\\"\\\\\u2028>&\"\n",
+}, {
+	name:   "EscapeForHTML",
+	opts:   []Options{EscapeForHTML(true)},
+	tokens: []interface{}{String("<a\u2028>&")},
+	want:   `"\u003ca\u2028\u003e\u0026"` + "\n",
+}, {
+	name:   "Object",
+	tokens: []interface{}{ObjectStart, String("a"), ArrayStart, Null, ArrayEnd, String("b"), ObjectStart, ObjectEnd, ObjectEnd},
+	want:   `{"a":[null],"b":{}}` + "\n",
+}, {
+	name:   "Multiline",
+	opts:   []Options{Multiline(true)},
+	tokens: []interface{}{ObjectStart, String("a"), ArrayStart, Int(1), Int(2), ArrayEnd, String("b"), ObjectStart, ObjectEnd, ObjectEnd},
+	want:   "{\n\t\"a\": [\n\t\t1,\n\t\t2\n\t],\n\t\"b\": {}\n}\n",
+}, {
+	name:   "WithIndent",
+	opts:   []Options{WithIndentPrefix(" "), WithIndent("  ")},
+	tokens: []interface{}{ArrayStart, Value(` { "k" : "v" } `), ArrayEnd},
+	want:   "[\n   {\n     \"k\": \"v\"\n   }\n ]\n",
+}, {
+	name:   "WriteValue",
+	tokens: []interface{}{ObjectStart, Value(` "a" `), Value("[ 1, {\"b\" :\n true} ]"), ObjectEnd},
+	want:   `{"a":[1,{"b":true}]}` + "\n",
+}}
+
+func writeAll(e *Encoder, tokens []interface{}) error {
+	for _, tv := range tokens {
+		var err error
+		switch tv := tv.(type) {
+		case Token:
+			err = e.WriteToken(tv)
+		case Value:
+			err = e.WriteValue(tv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestEncoder(t *testing.T) {
+	for _, tt := range encodeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf, tt.opts...)
+			if err := writeAll(e, tt.tokens); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output mismatch:\ngot  %q\nwant %q", got, tt.want)
+			}
+			if off := e.OutputOffset(); off != int64(len(tt.want)) {
+				t.Errorf("OutputOffset = %d, want %d", off, len(tt.want))
+			}
+		})
+	}
+}
+
+var encodeErrorTests = []struct {
+	name    string
+	opts    []Options
+	tokens  []interface{}
+	wantErr error
+	pointer Pointer
+}{{
+	name:    "NonStringName",
+	tokens:  []interface{}{ObjectStart, Int(1)},
+	wantErr: ErrNonStringName,
+}, {
+	name:    "MismatchDelim",
+	tokens:  []interface{}{ArrayStart, ObjectEnd},
+	wantErr: errMismatchDelim,
+}, {
+	name:    "MissingValue",
+	tokens:  []interface{}{ObjectStart, String("a"), ObjectEnd},
+	wantErr: errMissingValue,
+	pointer: "/a",
+}, {
+	name:    "DuplicateName",
+	tokens:  []interface{}{ObjectStart, String("a"), Null, String("a")},
+	wantErr: ErrDuplicateName,
+	pointer: "/a",
+}, {
+	name:    "DuplicateNameValue",
+	tokens:  []interface{}{ArrayStart, Null, Value(`{"a":1,"a":2}`)},
+	wantErr: ErrDuplicateName,
+	pointer: "/1/a",
+}, {
+	name:    "NaN",
+	tokens:  []interface{}{Float(math.NaN())},
+	wantErr: errInvalidNumber,
+}, {
+	name:    "InvalidUTF8",
+	tokens:  []interface{}{String("\xff")},
+	wantErr: errInvalidUTF8,
+}, {
+	name:    "InvalidValue",
+	tokens:  []interface{}{ArrayStart, Value(`[1,]`)},
+	wantErr: errors.New(`invalid character ']' at start of value`),
+	pointer: "/0/1",
+}, {
+	name:    "InvalidValueInObject",
+	tokens:  []interface{}{ObjectStart, String("a"), Null, String("b"), Value(`{"c":tru}`)},
+	wantErr: errors.New(`invalid character '}' within literal true (expecting 'e')`),
+	pointer: "/b/c",
+}, {
+	name:    "InvalidLiteral",
+	tokens:  []interface{}{ArrayStart, Null, Value(`[1,2,fals]`)},
+	wantErr: errors.New(`invalid character ']' within literal false (expecting 'e')`),
+	pointer: "/1/2",
+}, {
+	name:    "TrailingData",
+	tokens:  []interface{}{Value(`1 2`)},
+	wantErr: errTrailingData,
+}, {
+	name:    "EmptyValue",
+	tokens:  []interface{}{Value(` `)},
+	wantErr: errors.New("unexpected EOF"),
+}}
+
+func TestEncoderErrors(t *testing.T) {
+	for _, tt := range encodeErrorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf, tt.opts...)
+			err := writeAll(e, tt.tokens)
+			var serr *SyntacticError
+			if !errors.As(err, &serr) {
+				t.Fatalf("write error = %v, want SyntacticError", err)
+			}
+			if serr.Err.Error() != tt.wantErr.Error() {
+				t.Errorf("write error = %v, want %v", serr.Err, tt.wantErr)
+			}
+			if serr.JSONPointer != tt.pointer {
+				t.Errorf("write error pointer = %q, want %q", serr.JSONPointer, tt.pointer)
+			}
+		})
+	}
+}
+
+func TestEncoderWriteValueRestoresState(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := writeAll(e, []interface{}{ObjectStart, String("a"), Int(1)}); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	if err := e.WriteValue(Value(`"b" x`)); err == nil {
+		t.Fatalf("WriteValue succeeded unexpectedly")
+	}
+	if err := writeAll(e, []interface{}{String("b"), Value(`[true]`), ObjectEnd}); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	if got, want := buf.String(), `{"a":1,"b":[true]}`+"\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestEncoderDecoderRoundTrip(t *testing.T) {
+	in := `{"a":[null,true,-1.5e3,"é😀"],"b":{"c":"d"}}`
+	d := NewDecoder(bytes.NewReader([]byte(in)))
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for {
+		tok, err := d.ReadToken()
+		if err != nil {
+			break
+		}
+		if err := e.WriteToken(tok); err != nil {
+			t.Fatalf("WriteToken error: %v", err)
+		}
+	}
+	if got := buf.String(); got != in+"\n" {
+		t.Errorf("output = %q, want %q", got, in+"\n")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+const errorPrefix = "jsontext: "
+
+// SyntacticError is a description of a syntactic error that occurred when
+// encoding or decoding JSON according to the grammar.
+//
+// The contents of this error as produced by this package may change over time.
+type SyntacticError struct {
+	// ByteOffset indicates that an error occurred after this byte offset.
+	ByteOffset int64
+	// JSONPointer indicates that an error occurred within this JSON value
+	// as indicated using the JSON Pointer notation (see RFC 6901).
+	JSONPointer Pointer
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *SyntacticError) Error() string {
+	pointer := e.JSONPointer
+	offset := e.ByteOffset
+	b := []byte(errorPrefix)
+	if e.Err != nil {
+		b = append(b, e.Err.Error()...)
+		if e.Err == ErrDuplicateName {
+			b = strconv.AppendQuote(append(b, ' '), pointer.LastToken())
+			pointer = pointer.Parent()
+			offset = 0 // not useful to print offset for duplicate names
+		}
+	} else {
+		b = append(b, "syntactic error"...)
+	}
+	if pointer != "" {
+		b = strconv.AppendQuote(append(b, " within "...), string(pointer))
+	}
+	if offset > 0 {
+		b = strconv.AppendInt(append(b, " after offset "...), offset, 10)
+	}
+	return string(b)
+}
+
+func (e *SyntacticError) Unwrap() error {
+	return e.Err
+}
+
+// ErrDuplicateName indicates that a JSON token could not be
+// encoded or decoded because it results in a duplicate JSON object name.
+// This error is directly wrapped within a SyntacticError when produced.
+//
+// The name of a duplicate JSON object member can be extracted as:
+//
+//	err := ...
+//	var serr *jsontext.SyntacticError
+//	if errors.As(err, &serr) && serr.Err == jsontext.ErrDuplicateName {
+//		ptr := serr.JSONPointer // JSON pointer to duplicate name
+//		name := ptr.LastToken() // duplicate name itself
+//		...
+//	}
+//
+// This error is only returned if AllowDuplicateNames is false.
+var ErrDuplicateName = errors.New("duplicate object member name")
+
+// ErrNonStringName indicates that a JSON token could not be
+// encoded or decoded because it is not a string,
+// as required for JSON object names according to RFC 8259, section 4.
+// This error is directly wrapped within a SyntacticError when produced.
+var ErrNonStringName = errors.New("object member name must be a string")
+
+var (
+	errMissingValue  = errors.New("missing value after object name")
+	errMismatchDelim = errors.New("mismatching structural token for object or array")
+	errMaxDepth      = errors.New("exceeded max depth")
+
+	errInvalidNamespace = errors.New("object namespace is in an invalid state")
+	errInvalidUTF8      = errors.New("invalid UTF-8 within string")
+	errInvalidToken     = errors.New("invalid jsontext.Token")
+	errInvalidNumber    = errors.New("invalid number")
+	errTrailingData     = errors.New("invalid data after top-level value")
+)
+
+// newInvalidCharacterError returns an error for the character
+// at the start of prefix, described by where.
+func newInvalidCharacterError(prefix []byte, where string) error {
+	what := quoteRune(prefix)
+	return errors.New("invalid character " + what + " " + where)
+}
+
+// newInvalidEscapeSequenceError returns an error for an invalid
+// escape sequence at the start of what.
+func newInvalidEscapeSequenceError(what []byte) error {
+	label := "escape sequence"
+	if len(what) > 6 {
+		label = "surrogate pair"
+	}
+	needEscape := false
+	for _, c := range what {
+		if c < ' ' || c >= utf8.RuneSelf {
+			needEscape = true
+			break
+		}
+	}
+	if needEscape {
+		return errors.New("invalid " + label + " " + strconv.Quote(string(what)) + " within string")
+	}
+	return errors.New("invalid " + label + " `" + string(what) + "` within string")
+}
+
+// quoteRune quotes the first rune in b, which may be invalid UTF-8.
+func quoteRune(b []byte) string {
+	r, n := utf8.DecodeRune(b)
+	if r == utf8.RuneError && n == 1 {
+		return `'\x` + strconv.FormatUint(uint64(b[0]), 16) + `'`
+	}
+	return strconv.QuoteRune(r)
+}
+
+// wrapSyntacticError wraps err, which occurred at byte offset pos
+// within the JSON value at ptr, in a *SyntacticError.
+// io.EOF is reported as io.ErrUnexpectedEOF.
+func wrapSyntacticError(ptr Pointer, pos int64, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &SyntacticError{ByteOffset: pos, JSONPointer: ptr, Err: err}
+}
+
+// newDuplicateNameError returns an error for the quoted object name at
+// byte offset pos, which duplicates an earlier name in the current object.
+func newDuplicateNameError(m stateMachine, names *objectNamespaceStack, pos int64, quoted []byte) error {
+	ptr := m.stackPointer(names)
+	if m.last().length() > 0 {
+		ptr = ptr.Parent() // strip the name of the previous member
+	}
+	ptr = ptr.AppendToken(string(appendUnquote(nil, quoted)))
+	return &SyntacticError{ByteOffset: pos, JSONPointer: ptr, Err: ErrDuplicateName}
+}
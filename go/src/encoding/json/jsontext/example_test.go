@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext_test
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// This example demonstrates the use of the Encoder and Decoder to
+// parse and modify JSON without unmarshaling it into a Go value.
+// It renames every object member named "Golang" to "Go".
+func Example_streamingRename() {
+	const input = `{"Golang": "is a language", "list": [{"Golang": 2009}]}`
+
+	in := strings.NewReader(input)
+	dec := jsontext.NewDecoder(in)
+	out := new(bytes.Buffer)
+	enc := jsontext.NewEncoder(out, jsontext.Multiline(true))
+	for {
+		tok, err := dec.ReadToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Fatal(err)
+		}
+		// An object name is a string read where the decoder's current
+		// object has an even number of elements (i.e., names and values).
+		if kind, n := dec.StackIndex(dec.StackDepth()); tok.Kind() == '"' && kind == '{' && n%2 == 1 && tok.String() == "Golang" {
+			tok = jsontext.String("Go")
+		}
+		if err := enc.WriteToken(tok); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Print(out.String())
+
+	// Output:
+	// {
+	// 	"Go": "is a language",
+	// 	"list": [
+	// 		{
+	// 			"Go": 2009
+	// 		}
+	// 	]
+	// }
+}
+
+// Malformed input is reported as a *SyntacticError that records
+// where in the input the error occurred.
+func ExampleSyntacticError() {
+	dec := jsontext.NewDecoder(strings.NewReader(`{"name": "gopher", "name": "again"}`))
+	err := dec.SkipValue()
+
+	var serr *jsontext.SyntacticError
+	if errors.As(err, &serr) && serr.Err == jsontext.ErrDuplicateName {
+		fmt.Println("duplicate name:", serr.JSONPointer.LastToken())
+	}
+	fmt.Println(err)
+
+	// Output:
+	// duplicate name: name
+	// jsontext: duplicate object member name "name"
+}
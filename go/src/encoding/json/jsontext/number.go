@@ -0,0 +1,120 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"io"
+	"math"
+	"strconv"
+)
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// consumeNumber consumes the JSON number at the start of b
+// per RFC 7159, section 6. If the number runs to the end of b,
+// more input may extend it, so io.ErrUnexpectedEOF is reported
+// unless atEOF is set.
+func consumeNumber(b []byte, atEOF bool) (n int, err error) {
+	// Optional minus sign.
+	if n < len(b) && b[n] == '-' {
+		n++
+	}
+
+	// Integer part.
+	switch {
+	case n == len(b):
+		return n, io.ErrUnexpectedEOF
+	case b[n] == '0':
+		n++
+	case '1' <= b[n] && b[n] <= '9':
+		n++
+		for n < len(b) && isDigit(b[n]) {
+			n++
+		}
+	default:
+		return n, newInvalidCharacterError(b[n:], "within number (expecting digit)")
+	}
+
+	// Optional fraction.
+	if n < len(b) && b[n] == '.' {
+		n++
+		switch {
+		case n == len(b):
+			return n, io.ErrUnexpectedEOF
+		case !isDigit(b[n]):
+			return n, newInvalidCharacterError(b[n:], "within number (expecting digit)")
+		}
+		for n < len(b) && isDigit(b[n]) {
+			n++
+		}
+	}
+
+	// Optional exponent.
+	if n < len(b) && (b[n] == 'e' || b[n] == 'E') {
+		n++
+		if n < len(b) && (b[n] == '-' || b[n] == '+') {
+			n++
+		}
+		switch {
+		case n == len(b):
+			return n, io.ErrUnexpectedEOF
+		case !isDigit(b[n]):
+			return n, newInvalidCharacterError(b[n:], "within number (expecting digit)")
+		}
+		for n < len(b) && isDigit(b[n]) {
+			n++
+		}
+	}
+
+	switch {
+	case n == len(b) && !atEOF:
+		return n, io.ErrUnexpectedEOF
+	case n < len(b) && isIdentChar(b[n]):
+		return n, newInvalidCharacterError(b[n:], "after number")
+	}
+	return n, nil
+}
+
+// appendFloat appends src as a JSON number, formatted as if by the
+// ES6 number to string conversion, which matches most other JSON
+// generators. NaN and infinity cannot be represented in JSON.
+func appendFloat(dst []byte, src float64, bits int) ([]byte, error) {
+	if math.IsNaN(src) || math.IsInf(src, 0) {
+		return dst, errInvalidNumber
+	}
+	// Like fmt %g, but the exponent cutoffs are different
+	// and exponents themselves are not padded to two digits.
+	abs := math.Abs(src)
+	fmt := byte('f')
+	// Note: Must use float32 comparisons for underlying float32 value to get precise cutoffs right.
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			fmt = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, src, fmt, -1, bits)
+	if fmt == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
+
+// parseFloat parses a valid JSON number as a floating-point value.
+// Values out of range are clamped to ±math.MaxFloat64 (or MaxFloat32).
+func parseFloat(b []byte, bits int) float64 {
+	f, err := strconv.ParseFloat(string(b), bits)
+	if err != nil && math.IsInf(f, 0) {
+		if bits == 32 {
+			return math.Copysign(math.MaxFloat32, f)
+		}
+		return math.Copysign(math.MaxFloat64, f)
+	}
+	return f
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"encoding/json/internal/jsonopts"
+	"strings"
+)
+
+// Options configures NewEncoder, Encoder.Reset, NewDecoder, and
+// Decoder.Reset with specific features. Each function takes in a
+// variadic list of options, where later options take precedence.
+//
+// Options are also accepted by the functions in encoding/json/v2;
+// options that do not apply to a particular operation are ignored.
+type Options = jsonopts.Options
+
+// AllowDuplicateNames specifies that JSON objects may contain
+// duplicate member names. Disabling the duplicate name check may
+// provide performance benefits, but breaks compliance with RFC 7493.
+// The input or output will still be compliant with RFC 8259.
+//
+// This affects either encoding or decoding.
+func AllowDuplicateNames(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.AllowDuplicateNames, Value: v}
+}
+
+// AllowInvalidUTF8 specifies that JSON strings may contain invalid
+// UTF-8, which will be mangled as the Unicode replacement character,
+// U+FFFD. This causes the Encoder or Decoder to break compliance
+// with RFC 7493 section 2.1, and RFC 8259 section 8.1.
+//
+// This affects either encoding or decoding.
+func AllowInvalidUTF8(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.AllowInvalidUTF8, Value: v}
+}
+
+// EscapeForHTML specifies that '<', '>', and '&' characters within
+// JSON strings should be escaped as a hexadecimal Unicode codepoint
+// (e.g., \u003c) so that the output is safe to embed within HTML.
+//
+// This only affects encoding and is ignored when decoding.
+func EscapeForHTML(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.EscapeForHTML, Value: v}
+}
+
+// Multiline specifies that the JSON output should expand to multiple
+// lines, where every JSON object member or JSON array element appears
+// on a new, indented line according to the nesting depth.
+// The indentation is a tab per level unless WithIndent is used.
+//
+// This only affects encoding and is ignored when decoding.
+func Multiline(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.Multiline, Value: v}
+}
+
+// WithIndent specifies that the encoder should emit multiline output
+// where each element in a JSON object or array begins on a new,
+// indented line beginning with the indent prefix (see WithIndentPrefix)
+// followed by one or more copies of indent according to the nesting
+// depth. The indent must only be composed of space or tab characters.
+//
+// This only affects encoding and is ignored when decoding.
+func WithIndent(indent string) Options {
+	if s := strings.Trim(indent, " \t"); len(s) > 0 {
+		panic("jsontext: invalid character " + quoteRune([]byte(s)) + " in indent")
+	}
+	return jsonopts.Indent(indent)
+}
+
+// WithIndentPrefix specifies that the encoder should emit multiline
+// output where each element in a JSON object or array begins on a new,
+// indented line beginning with the indent prefix followed by one or
+// more copies of indent (see WithIndent) according to the nesting
+// depth. The prefix must only be composed of space or tab characters.
+//
+// This only affects encoding and is ignored when decoding.
+func WithIndentPrefix(prefix string) Options {
+	if s := strings.Trim(prefix, " \t"); len(s) > 0 {
+		panic("jsontext: invalid character " + quoteRune([]byte(s)) + " in indent prefix")
+	}
+	return jsonopts.IndentPrefix(prefix)
+}
@@ -0,0 +1,274 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const hex = "0123456789abcdef"
+
+// consumeWhitespace consumes leading JSON whitespace per RFC 7159, section 2.
+func consumeWhitespace(b []byte) (n int) {
+	for len(b) > n && (b[n] == ' ' || b[n] == '\t' || b[n] == '\r' || b[n] == '\n') {
+		n++
+	}
+	return n
+}
+
+// consumeLiteral consumes the JSON literal lit (null, false, or true)
+// at the start of b. It reports io.ErrUnexpectedEOF if b is a strict
+// prefix of lit, in which case more input is needed.
+func consumeLiteral(b []byte, lit string) (n int, err error) {
+	for i := 0; i < len(b) && i < len(lit); i++ {
+		if b[i] != lit[i] {
+			return i, newInvalidCharacterError(b[i:], "within literal "+lit+" (expecting "+quoteRune([]byte{lit[i]})+")")
+		}
+	}
+	if len(b) < len(lit) {
+		return len(b), io.ErrUnexpectedEOF
+	}
+	if len(b) > len(lit) && isIdentChar(b[len(lit)]) {
+		return len(lit), newInvalidCharacterError(b[len(lit):], "after literal "+lit)
+	}
+	return len(lit), nil
+}
+
+// isIdentChar reports whether c may not directly follow a literal or number,
+// since it would otherwise be ambiguous where the token ends.
+func isIdentChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '_' || c == '.' || c == '+' || c == '-'
+}
+
+// consumeString consumes the JSON string at the start of b,
+// which must begin with a double quote.
+// It validates escape sequences and, unless allowInvalidUTF8 is set,
+// that the string is valid UTF-8 without unpaired surrogates.
+// It reports io.ErrUnexpectedEOF if the string is truncated.
+func consumeString(b []byte, allowInvalidUTF8 bool) (n int, err error) {
+	if len(b) == 0 || b[0] != '"' {
+		return 0, newInvalidCharacterError(b, "at start of string (expecting '\"')")
+	}
+	n++
+	for n < len(b) {
+		switch c := b[n]; {
+		case c == '"':
+			return n + 1, nil
+		case c < ' ':
+			return n, newInvalidCharacterError(b[n:], "within string (expecting non-control character)")
+		case c == '\\':
+			if n+1 >= len(b) {
+				return n, io.ErrUnexpectedEOF
+			}
+			switch b[n+1] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				n += 2
+				continue
+			case 'u':
+			default:
+				return n, newInvalidEscapeSequenceError(b[n : n+2])
+			}
+			r, ok, m := parseHexEscape(b[n:])
+			if m < 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			if !ok {
+				return n, newInvalidEscapeSequenceError(b[n : n+m])
+			}
+			if utf16.IsSurrogate(r) {
+				if r >= 0xdc00 {
+					// An unpaired low surrogate.
+					if !allowInvalidUTF8 {
+						return n, errInvalidUTF8
+					}
+					n += 6
+					continue
+				}
+				// A high surrogate must be followed by a low surrogate.
+				r2, ok2, m2 := parseHexEscape(b[n+6:])
+				if m2 < 0 {
+					return n, io.ErrUnexpectedEOF
+				}
+				if ok2 && utf16.DecodeRune(r, r2) != utf8.RuneError {
+					n += 12
+					continue
+				}
+				if !allowInvalidUTF8 {
+					return n, errInvalidUTF8
+				}
+			}
+			n += 6
+		case c < utf8.RuneSelf:
+			n++
+		default:
+			r, rn := utf8.DecodeRune(b[n:])
+			if r == utf8.RuneError && rn == 1 {
+				if !utf8.FullRune(b[n:]) {
+					return n, io.ErrUnexpectedEOF
+				}
+				if !allowInvalidUTF8 {
+					return n, errInvalidUTF8
+				}
+			}
+			n += rn
+		}
+	}
+	return n, io.ErrUnexpectedEOF
+}
+
+// parseHexEscape parses a \uXXXX escape sequence at the start of b.
+// It reports the number of bytes examined, or -1 if b is a truncated
+// (but so far valid) escape sequence.
+func parseHexEscape(b []byte) (r rune, ok bool, n int) {
+	if len(b) < 2 {
+		if len(b) == 0 || b[0] == '\\' {
+			return 0, false, -1
+		}
+		return 0, false, 1
+	}
+	if b[0] != '\\' || b[1] != 'u' {
+		return 0, false, 2
+	}
+	for i := 2; i < 6; i++ {
+		if i >= len(b) {
+			return 0, false, -1
+		}
+		c := b[i]
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false, i + 1
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true, 6
+}
+
+// appendUnquote appends the unescaped form of the quoted JSON string src,
+// which must have already been validated by consumeString.
+// Invalid UTF-8 and unpaired surrogates are replaced with utf8.RuneError.
+func appendUnquote(dst, src []byte) []byte {
+	src = src[1 : len(src)-1] // strip quotes
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == '\\':
+			switch src[i+1] {
+			case 'b':
+				dst = append(dst, '\b')
+			case 'f':
+				dst = append(dst, '\f')
+			case 'n':
+				dst = append(dst, '\n')
+			case 'r':
+				dst = append(dst, '\r')
+			case 't':
+				dst = append(dst, '\t')
+			case 'u':
+				r, _, _ := parseHexEscape(src[i:])
+				i += 6
+				if utf16.IsSurrogate(r) {
+					r2, ok, _ := parseHexEscape(src[i:])
+					if r = utf16.DecodeRune(r, r2); ok && r != utf8.RuneError {
+						i += 6
+					}
+				}
+				dst = appendRune(dst, r)
+				continue
+			default: // '"', '\\', or '/'
+				dst = append(dst, src[i+1])
+			}
+			i += 2
+		case c < utf8.RuneSelf:
+			// Copy a run of ASCII characters that need no processing.
+			j := i + 1
+			for j < len(src) && src[j] != '\\' && src[j] < utf8.RuneSelf {
+				j++
+			}
+			dst = append(dst, src[i:j]...)
+			i = j
+		default:
+			r, n := utf8.DecodeRune(src[i:])
+			if r == utf8.RuneError && n == 1 {
+				dst = append(dst, "\uFFFD"...)
+			} else {
+				dst = append(dst, src[i:i+n]...)
+			}
+			i += n
+		}
+	}
+	return dst
+}
+
+func appendRune(dst []byte, r rune) []byte {
+	var arr [utf8.UTFMax]byte
+	return append(dst, arr[:utf8.EncodeRune(arr[:], r)]...)
+}
+
+// appendQuote appends src to dst as a quoted JSON string.
+// Invalid UTF-8 is an error unless allowInvalidUTF8 is set,
+// in which case it is replaced with utf8.RuneError.
+// If escapeHTML is set, '<', '>', and '&' are escaped as well.
+func appendQuote(dst []byte, src string, allowInvalidUTF8, escapeHTML bool) ([]byte, error) {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(src); {
+		if c := src[i]; c < utf8.RuneSelf {
+			if c >= ' ' && c != '"' && c != '\\' && (!escapeHTML || (c != '<' && c != '>' && c != '&')) {
+				i++
+				continue
+			}
+			dst = append(dst, src[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			if !allowInvalidUTF8 {
+				return dst, errInvalidUTF8
+			}
+			dst = append(dst, src[start:i]...)
+			dst = append(dst, "\uFFFD"...)
+			i += n
+			start = i
+		case escapeHTML && (r == '\u2028' || r == '\u2029'):
+			// U+2028 and U+2029 are line terminators in JavaScript.
+			dst = append(dst, src[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += n
+			start = i
+		default:
+			i += n
+		}
+	}
+	dst = append(dst, src[start:]...)
+	dst = append(dst, '"')
+	return dst, nil
+}
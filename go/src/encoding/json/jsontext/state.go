@@ -0,0 +1,479 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNestingDepth is the maximum depth of nested objects and arrays.
+// Bounding the depth keeps the stack of the recursive value parser
+// and of callers that mirror the nesting bounded as well.
+const maxNestingDepth = 10000
+
+// Pointer is a JSON Pointer (RFC 6901) that references a particular
+// JSON value relative to the root of the top-level JSON value.
+//
+// A Pointer is a slash-separated list of tokens, where each token is
+// either a JSON object name or an index to a JSON array element
+// encoded as a base-10 integer value. Within a token, '~' and '/'
+// are escaped as "~0" and "~1".
+// The empty pointer refers to the top-level value itself.
+type Pointer string
+
+// IsValid reports whether p is a valid JSON Pointer according to RFC 6901.
+func (p Pointer) IsValid() bool {
+	if !utf8.ValidString(string(p)) {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '~' && (i+1 == len(p) || (p[i+1] != '0' && p[i+1] != '1')) {
+			return false // invalid escape
+		}
+	}
+	return len(p) == 0 || p[0] == '/'
+}
+
+// Contains reports whether the JSON value that p points to
+// is equal to or contains the JSON value that pc points to.
+func (p Pointer) Contains(pc Pointer) bool {
+	// Invariant: len(p) <= len(pc) if p.Contains(pc)
+	suffix, ok := cutPrefix(string(pc), string(p))
+	return ok && (suffix == "" || suffix[0] == '/')
+}
+
+// Parent strips off the last token and returns the remaining pointer.
+// The parent of an empty p is an empty string.
+func (p Pointer) Parent() Pointer {
+	return p[:max(strings.LastIndexByte(string(p), '/'), 0)]
+}
+
+// LastToken returns the last token in the pointer.
+// The last token of an empty p is an empty string.
+func (p Pointer) LastToken() string {
+	last := p[max(strings.LastIndexByte(string(p), '/'), 0):]
+	return unescapePointerToken(strings.TrimPrefix(string(last), "/"))
+}
+
+// AppendToken appends a token to the end of p and returns the full pointer.
+func (p Pointer) AppendToken(tok string) Pointer {
+	return Pointer(appendEscapePointerName([]byte(p+"/"), tok))
+}
+
+// Tokens returns the list of unescaped tokens in the pointer.
+func (p Pointer) Tokens() []string {
+	if p == "" {
+		return nil
+	}
+	toks := strings.Split(string(p[1:]), "/")
+	for i, tok := range toks {
+		toks[i] = unescapePointerToken(tok)
+	}
+	return toks
+}
+
+func unescapePointerToken(token string) string {
+	if strings.Contains(token, "~") {
+		// Per RFC 6901, section 4, unescape '~1' first, then '~0'.
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+	}
+	return token
+}
+
+func appendEscapePointerName(b []byte, name string) []byte {
+	for i := 0; i < len(name); i++ {
+		// Per RFC 6901, section 3, escape '~' and '/' characters.
+		switch c := name[i]; c {
+		case '~':
+			b = append(b, "~0"...)
+		case '/':
+			b = append(b, "~1"...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func cutPrefix(s, prefix string) (after string, found bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// stateMachine is a push-down automaton that validates whether
+// a sequence of tokens is valid or not according to the JSON grammar.
+// It is useful for both encoding and decoding.
+//
+// It is a stack where each entry represents a nested JSON object or array.
+// The stack has a minimum depth of 1 where the first level is a
+// virtual JSON array to handle a stream of top-level JSON values.
+// The top-level virtual JSON array is special in that it doesn't require
+// commas between each JSON value.
+//
+// For performance, most methods are carefully written to be inlinable.
+// The zero value is not a valid state machine; call reset first.
+type stateMachine []stateEntry
+
+// stateEntry encodes several artifacts within a single unsigned integer:
+//   - whether this represents a JSON object or array and
+//   - how many elements are in this JSON object or array.
+type stateEntry uint64
+
+const (
+	// The type mask (1 bit) records whether this is a JSON object or array.
+	stateTypeMask   stateEntry = 0x8000_0000_0000_0000
+	stateTypeObject stateEntry = 0x8000_0000_0000_0000
+	stateTypeArray  stateEntry = 0x0000_0000_0000_0000
+
+	// The count mask (63 bits) records the number of elements.
+	stateCountMask stateEntry = 0x7fff_ffff_ffff_ffff
+)
+
+// length reports the number of elements in the JSON object or array.
+// Each name and value in an object entry is treated as a separate element.
+func (e stateEntry) length() int64 { return int64(e & stateCountMask) }
+
+// isObject reports whether this is a JSON object.
+func (e stateEntry) isObject() bool { return e&stateTypeMask == stateTypeObject }
+
+// isArray reports whether this is a JSON array.
+func (e stateEntry) isArray() bool { return e&stateTypeMask == stateTypeArray }
+
+// needObjectName reports whether the next token must be a JSON string,
+// which is necessary for JSON object names.
+func (e stateEntry) needObjectName() bool { return e.isObject() && e.length()%2 == 0 }
+
+// needObjectValue reports whether the next token must be a JSON value.
+func (e stateEntry) needObjectValue() bool { return e.isObject() && e.length()%2 == 1 }
+
+// increment increments the number of elements for the current object or array.
+func (e *stateEntry) increment() { (*e)++ }
+
+// reset resets the state machine.
+// The machine always starts with a minimum depth of 1.
+func (m *stateMachine) reset() {
+	*m = append((*m)[:0], stateTypeArray)
+}
+
+// depth is the current nested depth of JSON objects and arrays.
+// It is one-indexed (i.e., top-level values have a depth of 1).
+func (m stateMachine) depth() int {
+	return len(m)
+}
+
+// index returns information about the specified stack level.
+// It must be a number between 0 and depth-1, inclusive.
+func (m stateMachine) index(i int) (Kind, int64) {
+	switch e := m[i]; {
+	case i == 0:
+		return 0, e.length()
+	case e.isObject():
+		return '{', e.length()
+	default:
+		return '[', e.length()
+	}
+}
+
+// last returns a pointer to the last entry.
+func (m stateMachine) last() *stateEntry {
+	return &m[len(m)-1]
+}
+
+// appendLiteral appends a JSON literal or number as the next token in the sequence.
+// If an error is returned, the state is not mutated.
+func (m stateMachine) appendLiteral() error {
+	switch e := m.last(); {
+	case e.needObjectName():
+		return ErrNonStringName
+	default:
+		e.increment()
+		return nil
+	}
+}
+
+// appendString appends a JSON string as the next token in the sequence.
+func (m stateMachine) appendString() {
+	m.last().increment()
+}
+
+// appendNumber appends a JSON number as the next token in the sequence.
+// If an error is returned, the state is not mutated.
+func (m stateMachine) appendNumber() error {
+	return m.appendLiteral()
+}
+
+// pushObject appends a JSON start object token as next in the sequence.
+// If an error is returned, the state is not mutated.
+func (m *stateMachine) pushObject() error {
+	switch e := m.last(); {
+	case e.needObjectName():
+		return ErrNonStringName
+	case len(*m) > maxNestingDepth:
+		return errMaxDepth
+	default:
+		e.increment()
+		*m = append(*m, stateTypeObject)
+		return nil
+	}
+}
+
+// popObject appends a JSON end object token as next in the sequence.
+// If an error is returned, the state is not mutated.
+func (m *stateMachine) popObject() error {
+	switch e := m.last(); {
+	case !e.isObject() || len(*m) == 1:
+		return errMismatchDelim
+	case e.needObjectValue():
+		return errMissingValue
+	default:
+		*m = (*m)[:len(*m)-1]
+		return nil
+	}
+}
+
+// pushArray appends a JSON start array token as next in the sequence.
+// If an error is returned, the state is not mutated.
+func (m *stateMachine) pushArray() error {
+	switch e := m.last(); {
+	case e.needObjectName():
+		return ErrNonStringName
+	case len(*m) > maxNestingDepth:
+		return errMaxDepth
+	default:
+		e.increment()
+		*m = append(*m, stateTypeArray)
+		return nil
+	}
+}
+
+// popArray appends a JSON end array token as next in the sequence.
+// If an error is returned, the state is not mutated.
+func (m *stateMachine) popArray() error {
+	switch e := m.last(); {
+	case !e.isArray() || len(*m) == 1: // forbid popping top-level virtual JSON array
+		return errMismatchDelim
+	default:
+		*m = (*m)[:len(*m)-1]
+		return nil
+	}
+}
+
+// needDelim reports whether a colon or comma token should be implicitly
+// emitted before the next token of the specified kind.
+// A JSON object name is followed by a colon,
+// and any other element is followed by a comma,
+// except before an end delimiter.
+// Top-level values are not delimited.
+func (m stateMachine) needDelim(next Kind) (delim byte) {
+	switch e := m.last(); {
+	case len(m) == 1:
+		return 0
+	case e.needObjectValue():
+		return ':'
+	case e.length() > 0 && next != '}' && next != ']':
+		return ','
+	}
+	return 0
+}
+
+// stackPointer returns a JSON Pointer to the most recently started
+// JSON value, using names for the names of JSON object members.
+func (m stateMachine) stackPointer(names *objectNamespaceStack) Pointer {
+	return m.appendPointer(nil, names, false)
+}
+
+// nextPointer returns a JSON Pointer to the next JSON value to be parsed,
+// which is where a syntactic error at or within that value is located.
+// If the next token is an object name, it points to the enclosing object.
+func (m stateMachine) nextPointer(names *objectNamespaceStack) Pointer {
+	return m.appendPointer(nil, names, true)
+}
+
+func (m stateMachine) appendPointer(b []byte, names *objectNamespaceStack, next bool) Pointer {
+	objIdx := 0
+	for i, e := range m[1:] {
+		if next && i == len(m)-2 {
+			if e.isArray() {
+				b = strconv.AppendInt(append(b, '/'), e.length(), 10)
+				break
+			}
+			if e.needObjectName() {
+				break
+			}
+		} else if e.length() == 0 {
+			break
+		}
+		b = append(b, '/')
+		if e.isArray() {
+			b = strconv.AppendInt(b, e.length()-1, 10)
+			continue
+		}
+		if objIdx < len(*names) {
+			b = appendEscapePointerName(b, string((*names)[objIdx].lastName()))
+		}
+		objIdx++
+	}
+	return Pointer(b)
+}
+
+// objectNamespaceStack is a stack of object namespaces.
+// This data structure assists in detecting duplicate names
+// and in reporting the location of errors.
+type objectNamespaceStack []objectNamespace
+
+// reset resets the object namespace stack.
+func (s *objectNamespaceStack) reset() {
+	*s = (*s)[:0]
+}
+
+// push starts a new namespace for a nested JSON object.
+func (s *objectNamespaceStack) push() {
+	if cap(*s) > len(*s) {
+		*s = (*s)[:len(*s)+1]
+		s.last().reset()
+	} else {
+		*s = append(*s, objectNamespace{})
+	}
+}
+
+// last returns a pointer to the last JSON object namespace.
+func (s objectNamespaceStack) last() *objectNamespace {
+	return &s[len(s)-1]
+}
+
+// pop terminates the namespace for a nested JSON object.
+func (s *objectNamespaceStack) pop() {
+	*s = (*s)[:len(*s)-1]
+}
+
+// objectNamespace is the namespace for a JSON object.
+// In contrast to objectNamespaceStack, this needs to handle
+// large numbers of names, so it uses a map for large objects.
+type objectNamespace struct {
+	// endOffsets is a list of offsets to the end of each name in allNames.
+	// The length of offsets is the number of names in the namespace.
+	endOffsets []uint
+	// allNames is a back-to-back concatenation of every name in the namespace.
+	allNames []byte
+	// mapNames is a Go map containing every name in the namespace.
+	// Only valid if non-nil.
+	mapNames map[string]struct{}
+}
+
+// reset resets the namespace to be empty.
+func (ns *objectNamespace) reset() {
+	ns.endOffsets = ns.endOffsets[:0]
+	ns.allNames = ns.allNames[:0]
+	ns.mapNames = nil
+	if cap(ns.endOffsets) > 1<<6 {
+		ns.endOffsets = nil // avoid pinning large buffers
+	}
+	if cap(ns.allNames) > 1<<10 {
+		ns.allNames = nil // avoid pinning large buffers
+	}
+}
+
+// length reports the number of names in the namespace.
+func (ns *objectNamespace) length() int {
+	return len(ns.endOffsets)
+}
+
+// getUnquotedName gets the i-th unquoted name in the namespace.
+func (ns *objectNamespace) getUnquotedName(i int) []byte {
+	if i == 0 {
+		return ns.allNames[:ns.endOffsets[0]]
+	}
+	return ns.allNames[ns.endOffsets[i-1]:ns.endOffsets[i]]
+}
+
+// lastName returns the most recently inserted name,
+// or nil if the namespace is empty.
+func (ns *objectNamespace) lastName() []byte {
+	if ns.length() == 0 {
+		return nil
+	}
+	return ns.getUnquotedName(ns.length() - 1)
+}
+
+// insertQuoted inserts a quoted name, which must already be a valid
+// JSON string, and reports whether it was inserted; a name is not
+// inserted if it is a duplicate and checkDup is set.
+// If checkDup is false, only the most recent name is retained,
+// since it is only needed to construct JSON pointers.
+func (ns *objectNamespace) insertQuoted(name []byte, checkDup bool) bool {
+	start := len(ns.allNames)
+	ns.allNames = appendUnquote(ns.allNames, name)
+	return ns.insert(start, checkDup)
+}
+
+// insertUnquoted is like insertQuoted, but for an unquoted name.
+func (ns *objectNamespace) insertUnquoted(name string, checkDup bool) bool {
+	start := len(ns.allNames)
+	ns.allNames = append(ns.allNames, name...)
+	return ns.insert(start, checkDup)
+}
+
+// removeLast removes the most recently inserted name.
+func (ns *objectNamespace) removeLast() {
+	if ns.mapNames != nil {
+		delete(ns.mapNames, string(ns.lastName()))
+	}
+	if n := ns.length(); n > 1 {
+		ns.allNames = ns.allNames[:ns.endOffsets[n-2]]
+	} else {
+		ns.allNames = ns.allNames[:0]
+	}
+	ns.endOffsets = ns.endOffsets[:ns.length()-1]
+}
+
+func (ns *objectNamespace) insert(start int, checkDup bool) bool {
+	name := ns.allNames[start:]
+	if !checkDup {
+		n := copy(ns.allNames, name)
+		ns.allNames = ns.allNames[:n]
+		ns.endOffsets = append(ns.endOffsets[:0], uint(n))
+		return true
+	}
+
+	// Check whether the name is a duplicate.
+	if ns.mapNames != nil {
+		if _, ok := ns.mapNames[string(name)]; ok {
+			ns.allNames = ns.allNames[:start]
+			return false
+		}
+	} else {
+		for i := range ns.endOffsets {
+			if string(ns.getUnquotedName(i)) == string(name) {
+				ns.allNames = ns.allNames[:start]
+				return false
+			}
+		}
+	}
+
+	ns.endOffsets = append(ns.endOffsets, uint(len(ns.allNames)))
+	switch {
+	case ns.mapNames != nil:
+		ns.mapNames[string(name)] = struct{}{}
+	case len(ns.endOffsets) > 1<<6:
+		// Switch to a map once a linear search becomes too slow.
+		ns.mapNames = make(map[string]struct{}, len(ns.endOffsets))
+		for i := range ns.endOffsets {
+			ns.mapNames[string(ns.getUnquotedName(i))] = struct{}{}
+		}
+	}
+	return true
+}
@@ -0,0 +1,336 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"math"
+	"strconv"
+)
+
+// Kind represents each possible JSON token kind with a single byte,
+// which is conveniently the first byte of that kind's grammar
+// with the restriction that numbers always be represented with '0':
+//
+//   - 'n': null
+//   - 'f': false
+//   - 't': true
+//   - '"': string
+//   - '0': number
+//   - '{': object start
+//   - '}': object end
+//   - '[': array start
+//   - ']': array end
+//
+// An invalid kind is usually represented using 0,
+// but may be non-zero due to invalid JSON data.
+type Kind byte
+
+const invalidKind Kind = 0
+
+// String prints the kind in a humanly readable fashion.
+func (k Kind) String() string {
+	switch k {
+	case 'n':
+		return "null"
+	case 'f':
+		return "false"
+	case 't':
+		return "true"
+	case '"':
+		return "string"
+	case '0':
+		return "number"
+	case '{':
+		return "{"
+	case '}':
+		return "}"
+	case '[':
+		return "["
+	case ']':
+		return "]"
+	default:
+		return "<invalid jsontext.Kind: " + quoteRune([]byte{byte(k)}) + ">"
+	}
+}
+
+// kindFromByte returns the kind of the token starting with c.
+func kindFromByte(c byte) Kind {
+	switch c {
+	case 'n', 'f', 't', '"', '{', '}', '[', ']':
+		return Kind(c)
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return '0'
+	default:
+		return invalidKind
+	}
+}
+
+// Token represents a lexical JSON token, which may be one of the following:
+//   - a JSON literal (i.e., null, true, or false)
+//   - a JSON string (e.g., "hello, world!")
+//   - a JSON number (e.g., 123.456)
+//   - a start or end delimiter for a JSON object (i.e., { or } )
+//   - a start or end delimiter for a JSON array (i.e., [ or ] )
+//
+// A Token cannot represent entire array or object values, while a Value can.
+// There is no Token to represent commas and colons since
+// these structural tokens can be inferred from the surrounding context.
+//
+// A Token returned by Decoder.ReadToken refers to the Decoder's internal
+// buffer and is only valid until the next Decoder call.
+// Use Clone to retain a copy. Using a Token after it has been
+// invalidated panics.
+type Token struct {
+	// raw is non-nil for string and number tokens read by a Decoder,
+	// whose contents are still in the Decoder's buffer.
+	raw *Decoder
+
+	kind Kind
+
+	// numKind describes how a number is stored in num or str:
+	// 'f' for float64 bits, 'i' for int64, 'u' for uint64,
+	// and 'r' for the exact JSON text stored in str.
+	numKind byte
+
+	str string // the string value for an unread string token
+	num uint64 // raw: the absolute offset of the token; otherwise see numKind
+}
+
+var (
+	Null  Token = Token{kind: 'n'}
+	False Token = Token{kind: 'f'}
+	True  Token = Token{kind: 't'}
+
+	ObjectStart Token = Token{kind: '{'}
+	ObjectEnd   Token = Token{kind: '}'}
+	ArrayStart  Token = Token{kind: '['}
+	ArrayEnd    Token = Token{kind: ']'}
+)
+
+// Bool constructs a Token representing a JSON boolean.
+func Bool(b bool) Token {
+	if b {
+		return True
+	}
+	return False
+}
+
+// String constructs a Token representing a JSON string.
+// The provided string should contain valid UTF-8, otherwise invalid characters
+// may be mangled as the Unicode replacement character.
+func String(s string) Token {
+	return Token{kind: '"', str: s}
+}
+
+// Float constructs a Token representing a JSON number.
+// The values NaN, +Inf, and -Inf cannot be represented as JSON numbers
+// and result in an error when encoded.
+func Float(n float64) Token {
+	return Token{kind: '0', numKind: 'f', num: math.Float64bits(n)}
+}
+
+// Int constructs a Token representing a JSON number from an int64.
+func Int(n int64) Token {
+	return Token{kind: '0', numKind: 'i', num: uint64(n)}
+}
+
+// Uint constructs a Token representing a JSON number from a uint64.
+func Uint(n uint64) Token {
+	return Token{kind: '0', numKind: 'u', num: n}
+}
+
+// Kind returns the token kind.
+func (t Token) Kind() Kind {
+	return t.kind
+}
+
+// bytes returns the raw JSON text of a Token read by a Decoder.
+// It panics if the Token has been invalidated by a later Decoder call.
+func (t Token) bytes() []byte {
+	d := t.raw
+	if d.baseOffset+int64(d.prevStart) != int64(t.num) {
+		panic("invalid jsontext.Token; it has been voided by a subsequent jsontext.Decoder call")
+	}
+	return d.buf[d.prevStart:d.prevEnd]
+}
+
+// Clone makes a copy of the Token such that its value remains valid
+// even after a subsequent Decoder call.
+func (t Token) Clone() Token {
+	if t.raw == nil {
+		return t
+	}
+	switch t.kind {
+	case '"':
+		return String(t.String())
+	default:
+		return Token{kind: '0', numKind: 'r', str: string(t.bytes())}
+	}
+}
+
+// Bool returns the value for a JSON boolean.
+// It panics if the token kind is not a JSON boolean.
+func (t Token) Bool() bool {
+	switch t.kind {
+	case 't':
+		return true
+	case 'f':
+		return false
+	default:
+		panic("invalid JSON token kind: " + t.kind.String())
+	}
+}
+
+// String returns the unescaped string value for a JSON string.
+// For other JSON kinds, this returns the raw JSON representation.
+func (t Token) String() string {
+	if t.raw != nil {
+		b := t.bytes()
+		if t.kind == '"' {
+			return string(appendUnquote(nil, b))
+		}
+		return string(b)
+	}
+	switch t.kind {
+	case '"':
+		return t.str
+	case '0':
+		b, _ := t.appendNumber(nil)
+		return string(b)
+	case 'n', 'f', 't':
+		return t.kind.String()
+	case '{', '}', '[', ']':
+		return string(t.kind)
+	default:
+		return "<invalid jsontext.Token>"
+	}
+}
+
+// appendNumber appends the JSON representation of a number token.
+func (t Token) appendNumber(b []byte) ([]byte, error) {
+	if t.raw != nil {
+		return append(b, t.bytes()...), nil
+	}
+	switch t.numKind {
+	case 'f':
+		return appendFloat(b, math.Float64frombits(t.num), 64)
+	case 'i':
+		return strconv.AppendInt(b, int64(t.num), 10), nil
+	case 'u':
+		return strconv.AppendUint(b, t.num, 10), nil
+	default: // 'r'
+		return append(b, t.str...), nil
+	}
+}
+
+// rawNumber returns the JSON text of a raw or cloned number,
+// or nil if the number is stored as a Go value.
+func (t Token) rawNumber() []byte {
+	switch {
+	case t.raw != nil:
+		return t.bytes()
+	case t.numKind == 'r':
+		return []byte(t.str)
+	}
+	return nil
+}
+
+// Float returns the floating-point value for a JSON number.
+// Values out of range are clamped to ±math.MaxFloat64.
+// It panics if the token kind is not a JSON number.
+func (t Token) Float() float64 {
+	if t.kind != '0' {
+		panic("invalid JSON token kind: " + t.kind.String())
+	}
+	if b := t.rawNumber(); b != nil {
+		return parseFloat(b, 64)
+	}
+	switch t.numKind {
+	case 'f':
+		return math.Float64frombits(t.num)
+	case 'i':
+		return float64(int64(t.num))
+	default: // 'u'
+		return float64(t.num)
+	}
+}
+
+// Int returns the signed integer value for a JSON number.
+// The fractional component of any number is ignored (truncation toward zero).
+// Any number beyond the representation of an int64 will be saturated
+// to the closest representable value.
+// It panics if the token kind is not a JSON number.
+func (t Token) Int() int64 {
+	if t.kind != '0' {
+		panic("invalid JSON token kind: " + t.kind.String())
+	}
+	if b := t.rawNumber(); b != nil {
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+		return floatToInt(parseFloat(b, 64))
+	}
+	switch t.numKind {
+	case 'f':
+		return floatToInt(math.Float64frombits(t.num))
+	case 'i':
+		return int64(t.num)
+	default: // 'u'
+		if t.num > math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return int64(t.num)
+	}
+}
+
+// Uint returns the unsigned integer value for a JSON number.
+// The fractional component of any number is ignored (truncation toward zero).
+// Any number beyond the representation of an uint64 will be saturated
+// to the closest representable value.
+// It panics if the token kind is not a JSON number.
+func (t Token) Uint() uint64 {
+	if t.kind != '0' {
+		panic("invalid JSON token kind: " + t.kind.String())
+	}
+	if b := t.rawNumber(); b != nil {
+		if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return n
+		}
+		return floatToUint(parseFloat(b, 64))
+	}
+	switch t.numKind {
+	case 'f':
+		return floatToUint(math.Float64frombits(t.num))
+	case 'i':
+		if int64(t.num) < 0 {
+			return 0
+		}
+		return t.num
+	default: // 'u'
+		return t.num
+	}
+}
+
+func floatToInt(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f <= math.MinInt64:
+		return math.MinInt64
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return int64(f)
+}
+
+func floatToUint(f float64) uint64 {
+	switch {
+	case math.IsNaN(f) || f <= 0:
+		return 0
+	case f >= math.MaxUint64:
+		return math.MaxUint64
+	}
+	return uint64(f)
+}
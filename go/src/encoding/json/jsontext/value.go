@@ -0,0 +1,131 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import (
+	"encoding/json/internal/jsonopts"
+	"errors"
+	"io"
+)
+
+// Value represents a single raw JSON value, which may be one of the following:
+//   - a JSON literal (i.e., null, true, or false)
+//   - a JSON string (e.g., "hello, world!")
+//   - a JSON number (e.g., 123.456)
+//   - an entire JSON object (e.g., {"fizz":"buzz"} )
+//   - an entire JSON array (e.g., [1,2,3] )
+//
+// Value can represent entire array or object values, while Token cannot.
+// Value may contain leading and/or trailing whitespace.
+type Value []byte
+
+// Clone returns a copy of v.
+func (v Value) Clone() Value {
+	if v == nil {
+		return nil
+	}
+	return append(Value{}, v...)
+}
+
+// String returns the string formatting of v.
+func (v Value) String() string {
+	if v == nil {
+		return "null"
+	}
+	return string(v)
+}
+
+// IsValid reports whether the raw JSON value is syntactically valid
+// according to the specified options.
+//
+// By default (if no options are specified), it validates according to RFC 7493.
+// It verifies whether the input is properly encoded as UTF-8,
+// that escape sequences within strings decode to valid Unicode codepoints, and
+// that all names in each object are unique.
+// It does not verify whether numbers are representable within the limits
+// of any common numeric type (e.g., float64, int64, or uint64).
+func (v Value) IsValid(opts ...Options) bool {
+	var d Decoder
+	d.reset(v, nil, opts...)
+	if _, err := d.ReadValue(); err != nil {
+		return false
+	}
+	_, err := d.ReadToken()
+	return err == io.EOF
+}
+
+// Compact removes all whitespace from the raw JSON value.
+//
+// It does not reformat JSON strings to use any other representation.
+// It is guaranteed to succeed if the value is valid.
+// If the value is already compacted, then the buffer is not mutated.
+func (v *Value) Compact() error {
+	return v.reformat(false, "", "")
+}
+
+// Indent reformats the whitespace in the raw JSON value so that each element
+// in a JSON object or array begins on a new, indented line beginning with
+// prefix followed by one or more copies of indent according to the nesting.
+// The value does not begin with the prefix nor any indention,
+// to make it easier to embed inside other formatted JSON data.
+//
+// It does not reformat JSON strings to use any other representation.
+// It is guaranteed to succeed if the value is valid.
+// If the value is already indented properly, then the buffer is not mutated.
+//
+// The prefix and indent strings must be composed of only spaces and/or tabs.
+func (v *Value) Indent(prefix, indent string) error {
+	return v.reformat(true, prefix, indent)
+}
+
+func (v *Value) reformat(multiline bool, prefix, indent string) error {
+	var e Encoder
+	opts := []Options{
+		jsonopts.Bool{Flag: jsonopts.AllowDuplicateNames, Value: true},
+		jsonopts.Bool{Flag: jsonopts.OmitTopLevelNewline, Value: true},
+	}
+	if multiline {
+		opts = append(opts, WithIndentPrefix(prefix), WithIndent(indent))
+	}
+	e.reset(nil, nil, opts...)
+	if err := e.WriteValue(*v); err != nil {
+		return err
+	}
+	if string(e.buf) != string(*v) {
+		*v = append((*v)[:0], e.buf...)
+	}
+	return nil
+}
+
+// Kind returns the starting token kind.
+// For a valid value, this will never include '}' or ']'.
+func (v Value) Kind() Kind {
+	if v := v[consumeWhitespace(v):]; len(v) > 0 {
+		return kindFromByte(v[0])
+	}
+	return invalidKind
+}
+
+// MarshalJSON returns v as the JSON encoding of v.
+// It returns the stored value as the raw JSON output without any validation.
+// If v is nil, then this returns a JSON null.
+func (v Value) MarshalJSON() ([]byte, error) {
+	// NOTE: This matches the behavior of v1 RawMessage.MarshalJSON.
+	if v == nil {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+// UnmarshalJSON sets v as the JSON encoding of b.
+// It stores a copy of the provided raw JSON input without any validation.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	// NOTE: This matches the behavior of v1 RawMessage.UnmarshalJSON.
+	if v == nil {
+		return errors.New("jsontext.Value: UnmarshalJSON on nil pointer")
+	}
+	*v = append((*v)[:0], b...)
+	return nil
+}
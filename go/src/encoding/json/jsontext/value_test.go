@@ -0,0 +1,96 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsontext
+
+import "testing"
+
+func TestValueMethods(t *testing.T) {
+	tests := []struct {
+		in        string
+		opts      []Options
+		valid     bool
+		kind      Kind
+		compacted string
+		indented  string
+	}{
+		{in: ``, valid: false, kind: invalidKind},
+		{in: ` null `, valid: true, kind: 'n', compacted: `null`, indented: `null`},
+		{in: `"A"`, valid: true, kind: '"', compacted: `"A"`, indented: `"A"`},
+		{in: ` [ 1 , 2 ] `, valid: true, kind: '[', compacted: `[1,2]`, indented: "[\n \t1,\n \t2\n ]"},
+		{in: `{"a":{}}`, valid: true, kind: '{', compacted: `{"a":{}}`, indented: "{\n \t\"a\": {}\n }"},
+		{in: `{"a":1,"a":2}`, valid: false, kind: '{', compacted: `{"a":1,"a":2}`, indented: "{\n \t\"a\": 1,\n \t\"a\": 2\n }"},
+		{in: `{"a":1,"a":2}`, opts: []Options{AllowDuplicateNames(true)}, valid: true, kind: '{', compacted: `{"a":1,"a":2}`, indented: "{\n \t\"a\": 1,\n \t\"a\": 2\n }"},
+		{in: `1 2`, valid: false, kind: '0'},
+		{in: `[1,]`, valid: false, kind: '['},
+	}
+	for _, tt := range tests {
+		v := Value(tt.in)
+		if got := v.IsValid(tt.opts...); got != tt.valid {
+			t.Errorf("Value(%q).IsValid() = %v, want %v", tt.in, got, tt.valid)
+		}
+		if got := v.Kind(); got != tt.kind {
+			t.Errorf("Value(%q).Kind() = %v, want %v", tt.in, got, tt.kind)
+		}
+		v = Value(tt.in)
+		err := v.Compact()
+		switch {
+		case tt.compacted == "" && err == nil:
+			t.Errorf("Value(%q).Compact() succeeded unexpectedly", tt.in)
+		case tt.compacted != "" && err != nil:
+			t.Errorf("Value(%q).Compact() error: %v", tt.in, err)
+		case tt.compacted != "" && string(v) != tt.compacted:
+			t.Errorf("Value(%q).Compact() = %q, want %q", tt.in, v, tt.compacted)
+		}
+		v = Value(tt.in)
+		err = v.Indent(" ", "\t")
+		switch {
+		case tt.indented == "" && err == nil:
+			t.Errorf("Value(%q).Indent() succeeded unexpectedly", tt.in)
+		case tt.indented != "" && err != nil:
+			t.Errorf("Value(%q).Indent() error: %v", tt.in, err)
+		case tt.indented != "" && string(v) != tt.indented:
+			t.Errorf("Value(%q).Indent() = %q, want %q", tt.in, v, tt.indented)
+		}
+	}
+}
+
+func TestPointer(t *testing.T) {
+	tests := []struct {
+		p         Pointer
+		valid     bool
+		parent    Pointer
+		lastToken string
+		tokens    []string
+	}{
+		{p: "", valid: true, parent: "", lastToken: "", tokens: nil},
+		{p: "/", valid: true, parent: "", lastToken: "", tokens: []string{""}},
+		{p: "/a/0/b~1c~0", valid: true, parent: "/a/0", lastToken: "b/c~", tokens: []string{"a", "0", "b/c~"}},
+		{p: "a", valid: false, parent: "", lastToken: "a", tokens: []string{""}},
+		{p: "/~2", valid: false, parent: "", lastToken: "~2", tokens: []string{"~2"}},
+	}
+	for _, tt := range tests {
+		if got := tt.p.IsValid(); got != tt.valid {
+			t.Errorf("Pointer(%q).IsValid() = %v, want %v", tt.p, got, tt.valid)
+		}
+		if !tt.valid {
+			continue
+		}
+		if got := tt.p.Parent(); got != tt.parent {
+			t.Errorf("Pointer(%q).Parent() = %q, want %q", tt.p, got, tt.parent)
+		}
+		if got := tt.p.LastToken(); got != tt.lastToken {
+			t.Errorf("Pointer(%q).LastToken() = %q, want %q", tt.p, got, tt.lastToken)
+		}
+		if got := tt.p.Tokens(); len(got) != len(tt.tokens) || (len(got) > 0 && got[len(got)-1] != tt.tokens[len(tt.tokens)-1]) {
+			t.Errorf("Pointer(%q).Tokens() = %q, want %q", tt.p, got, tt.tokens)
+		}
+		if tt.p != "" && tt.p.Parent().AppendToken(tt.p.LastToken()) != tt.p {
+			t.Errorf("Pointer(%q): AppendToken(LastToken()) does not round-trip", tt.p)
+		}
+		if !tt.p.Parent().Contains(tt.p) {
+			t.Errorf("Pointer(%q).Parent().Contains(%q) = false", tt.p, tt.p)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json/internal/jsonopts"
+	"encoding/json/jsontext"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+)
+
+var omitTopLevelNewline = jsonopts.Bool{Flag: jsonopts.OmitTopLevelNewline, Value: true}
+
+// Marshal serializes a Go value as a []byte according to the provided
+// marshal and encode options (while ignoring unmarshal or decode options).
+// It does not terminate the output with a newline.
+// See the package documentation for how Go values are encoded.
+//
+// Marshaling a value that contains cycles through pointers,
+// maps, slices, or interfaces reports an error once the
+// maximum nesting depth of JSON is exceeded.
+func Marshal(in interface{}, opts ...Options) (out []byte, err error) {
+	var buf bytes.Buffer
+	if err := MarshalWrite(&buf, in, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalWrite serializes a Go value into an io.Writer according to the provided
+// marshal and encode options (while ignoring unmarshal or decode options).
+// It does not terminate the output with a newline.
+// See Marshal for details about the conversion of a Go value into JSON.
+func MarshalWrite(out io.Writer, in interface{}, opts ...Options) error {
+	enc := jsontext.NewEncoder(out, append(opts[:len(opts):len(opts)], omitTopLevelNewline)...)
+	return marshalEncode(enc, in, enc.Options().(*jsonopts.Struct))
+}
+
+// MarshalEncode serializes a Go value into an Encoder according to the provided
+// marshal options (while ignoring unmarshal, encode, or decode options).
+// Any marshal-relevant options already specified on the Encoder
+// take lower precedence than the set of options provided by the caller.
+// Unlike Marshal and MarshalWrite, encode options are ignored because
+// they must have already been specified on the provided Encoder.
+// See Marshal for details about the conversion of a Go value into JSON.
+func MarshalEncode(out *jsontext.Encoder, in interface{}, opts ...Options) error {
+	mo := out.Options().(*jsonopts.Struct)
+	mo.Join(opts...)
+	return marshalEncode(out, in, mo)
+}
+
+func marshalEncode(enc *jsontext.Encoder, in interface{}, mo *jsonopts.Struct) error {
+	v := reflect.ValueOf(in)
+	if !v.IsValid() {
+		return enc.WriteToken(jsontext.Null)
+	}
+	// Copy the value so that it is addressable and methods
+	// declared on the pointer receiver are consistently called.
+	va := reflect.New(v.Type()).Elem()
+	va.Set(v)
+	return marshalValue(enc, va, mo)
+}
+
+// Unmarshal decodes a []byte input into a Go value according to the provided
+// unmarshal and decode options (while ignoring marshal or encode options).
+// The input must be a single JSON value with optional whitespace interspersed.
+// The output must be a non-nil pointer.
+// See the package documentation for how JSON is decoded into Go values.
+func Unmarshal(in []byte, out interface{}, opts ...Options) error {
+	return UnmarshalRead(bytes.NewReader(in), out, opts...)
+}
+
+// UnmarshalRead deserializes a Go value from an io.Reader according to the
+// provided unmarshal and decode options (while ignoring marshal or encode options).
+// The input must be a single JSON value with optional whitespace interspersed.
+// It consumes the entirety of io.Reader until io.EOF is encountered,
+// without reporting an error for EOF. The output must be a non-nil pointer.
+// See Unmarshal for details about the conversion of JSON into a Go value.
+func UnmarshalRead(in io.Reader, out interface{}, opts ...Options) error {
+	dec := jsontext.NewDecoder(in, opts...)
+	if err := unmarshalDecode(dec, out, dec.Options().(*jsonopts.Struct)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	offset := dec.InputOffset()
+	if _, err := dec.ReadToken(); err != io.EOF {
+		if err == nil {
+			err = &jsontext.SyntacticError{ByteOffset: offset, Err: errTrailingData}
+		}
+		return err
+	}
+	return nil
+}
+
+var errTrailingData = errors.New("invalid data after top-level value")
+
+// UnmarshalDecode deserializes a Go value from a Decoder according to the
+// provided unmarshal options (while ignoring marshal, encode, or decode options).
+// Any unmarshal options already specified on the Decoder
+// take lower precedence than the set of options provided by the caller.
+// Unlike Unmarshal and UnmarshalRead, decode options are ignored because
+// they must have already been specified on the provided Decoder.
+//
+// The input may be a stream of one or more JSON values,
+// where this only unmarshals the next JSON value in the stream.
+// It reports io.EOF if the stream has no more values.
+// The output must be a non-nil pointer.
+// See Unmarshal for details about the conversion of JSON into a Go value.
+func UnmarshalDecode(in *jsontext.Decoder, out interface{}, opts ...Options) error {
+	uo := in.Options().(*jsonopts.Struct)
+	uo.Join(opts...)
+	return unmarshalDecode(in, out, uo)
+}
+
+func unmarshalDecode(dec *jsontext.Decoder, out interface{}, uo *jsonopts.Struct) error {
+	v := reflect.ValueOf(out)
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() {
+		var t reflect.Type
+		if v.IsValid() {
+			t = v.Type()
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+		}
+		return &SemanticError{action: "unmarshal", GoType: t, Err: errNilReference}
+	}
+	if dec.PeekKind() == 0 {
+		// Report io.EOF or the syntactic error.
+		_, err := dec.ReadToken()
+		return err
+	}
+	return unmarshalValue(dec, v.Elem(), uo)
+}
+
+// arshaler holds the functions to marshal and unmarshal values of a
+// particular type. The reflect.Value passed to them must be addressable.
+type arshaler struct {
+	marshal   func(*jsontext.Encoder, reflect.Value, *jsonopts.Struct) error
+	unmarshal func(*jsontext.Decoder, reflect.Value, *jsonopts.Struct) error
+}
+
+var lookupArshalerCache sync.Map // map[reflect.Type]*arshaler
+
+// lookupArshaler returns the arshaler for t, which takes into account
+// the methods implemented by t, but not the options of any call.
+func lookupArshaler(t reflect.Type) *arshaler {
+	if v, ok := lookupArshalerCache.Load(t); ok {
+		return v.(*arshaler)
+	}
+	fncs := makeDefaultArshaler(t)
+	fncs = makeMethodArshaler(fncs, t)
+	fncs = makeTimeArshaler(fncs, t)
+	v, _ := lookupArshalerCache.LoadOrStore(t, fncs)
+	return v.(*arshaler)
+}
+
+// marshalValue marshals the addressable value va, giving precedence
+// to any marshal functions provided by WithMarshalers.
+func marshalValue(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+	if m, _ := mo.Marshalers.(*Marshalers); m != nil {
+		if handled, err := m.marshal(enc, va, mo); handled {
+			return err
+		}
+	}
+	return lookupArshaler(va.Type()).marshal(enc, va, mo)
+}
+
+// unmarshalValue unmarshals into the addressable value va, giving precedence
+// to any unmarshal functions provided by WithUnmarshalers.
+func unmarshalValue(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+	if u, _ := uo.Unmarshalers.(*Unmarshalers); u != nil {
+		if handled, err := u.unmarshal(dec, va, uo); handled {
+			return err
+		}
+	}
+	return lookupArshaler(va.Type()).unmarshal(dec, va, uo)
+}
+
+// newAddressable returns an addressable copy of v.
+func newAddressable(v reflect.Value) reflect.Value {
+	va := reflect.New(v.Type()).Elem()
+	va.Set(v)
+	return va
+}
+
+// skipMismatch skips the next JSON value of kind k, which cannot be
+// unmarshaled into a Go value of type t, and reports why.
+func skipMismatch(dec *jsontext.Decoder, k jsontext.Kind, t reflect.Type) error {
+	if err := dec.SkipValue(); err != nil {
+		return err
+	}
+	return newUnmarshalError(dec, k, t, nil)
+}
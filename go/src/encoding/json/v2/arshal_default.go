@@ -0,0 +1,846 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"encoding"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json/internal/jsonopts"
+	"encoding/json/jsontext"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var (
+	errInvalidFormat     = errors.New("invalid format flag")
+	errNonEmptyInterface = errors.New("cannot derive concrete type for non-empty interface")
+)
+
+// makeDefaultArshaler returns the arshaler for t
+// based only on its kind, ignoring any methods.
+func makeDefaultArshaler(t reflect.Type) *arshaler {
+	switch t.Kind() {
+	case reflect.Bool:
+		return makeBoolArshaler(t)
+	case reflect.String:
+		return makeStringArshaler(t)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return makeIntArshaler(t)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return makeUintArshaler(t)
+	case reflect.Float32, reflect.Float64:
+		return makeFloatArshaler(t)
+	case reflect.Map:
+		return makeMapArshaler(t)
+	case reflect.Struct:
+		return makeStructArshaler(t)
+	case reflect.Slice:
+		fncs := makeSliceArshaler(t)
+		if isByteType(t.Elem()) {
+			return makeBytesArshaler(t, fncs)
+		}
+		return fncs
+	case reflect.Array:
+		fncs := makeArrayArshaler(t)
+		if isByteType(t.Elem()) {
+			return makeBytesArshaler(t, fncs)
+		}
+		return fncs
+	case reflect.Ptr:
+		return makePointerArshaler(t)
+	case reflect.Interface:
+		return makeInterfaceArshaler(t)
+	default:
+		return makeInvalidArshaler(t)
+	}
+}
+
+// fieldFormat returns the format that applies to a value at the given depth,
+// as specified by the "format" option of the enclosing struct field.
+func fieldFormat(o *jsonopts.Struct, depth int) string {
+	if o.Format != "" && o.FormatDepth == depth {
+		return o.Format
+	}
+	return ""
+}
+
+// peekKind is like Decoder.PeekKind, but reports the decoder error
+// if there is no next value.
+func peekKind(dec *jsontext.Decoder) (jsontext.Kind, error) {
+	if k := dec.PeekKind(); k != 0 {
+		return k, nil
+	}
+	_, err := dec.ReadToken()
+	return 0, err
+}
+
+// unmarshalNull consumes a JSON null and sets va to its zero value.
+func unmarshalNull(dec *jsontext.Decoder, va reflect.Value) error {
+	if _, err := dec.ReadToken(); err != nil {
+		return err
+	}
+	va.Set(reflect.Zero(va.Type()))
+	return nil
+}
+
+func makeBoolArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		return enc.WriteToken(jsontext.Bool(va.Bool()))
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case 't', 'f':
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return err
+			}
+			va.SetBool(tok.Bool())
+			return nil
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+func makeStringArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		return enc.WriteToken(jsontext.String(va.String()))
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '"':
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return err
+			}
+			va.SetString(tok.String())
+			return nil
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+// readNumber reads the next JSON number, or a JSON string containing
+// a JSON number if StringifyNumbers is set, and returns its kind and text.
+// It returns a nil slice and no error if the next value is a JSON null,
+// which it does not consume.
+func readNumber(dec *jsontext.Decoder, uo *jsonopts.Struct, t reflect.Type) (k jsontext.Kind, b []byte, err error) {
+	k, err = peekKind(dec)
+	switch k {
+	case 0:
+		return 0, nil, err
+	case 'n':
+		return k, nil, nil
+	case '0':
+		val, err := dec.ReadValue()
+		return k, val, err
+	case '"':
+		if uo.Get(jsonopts.StringifyNumbers) {
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return k, nil, err
+			}
+			b := []byte(tok.String())
+			if !isValidNumber(b) {
+				return k, nil, newUnmarshalError(dec, k, t, strconv.ErrSyntax)
+			}
+			return k, b, nil
+		}
+	}
+	return k, nil, skipMismatch(dec, k, t)
+}
+
+func makeIntArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	bits := t.Bits()
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if mo.Get(jsonopts.StringifyNumbers) {
+			return enc.WriteToken(jsontext.String(strconv.FormatInt(va.Int(), 10)))
+		}
+		return enc.WriteToken(jsontext.Int(va.Int()))
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, b, err := readNumber(dec, uo, t)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return unmarshalNull(dec, va)
+		}
+		neg := len(b) > 0 && b[0] == '-'
+		if neg {
+			b = b[1:]
+		}
+		n, ok := parseDecUint(b)
+		if !ok {
+			return newUnmarshalError(dec, k, t, nil)
+		}
+		maxInt := uint64(1) << uint(bits-1)
+		if neg && n > maxInt || !neg && n > maxInt-1 {
+			return newUnmarshalError(dec, k, t, errOutOfRange)
+		}
+		if neg {
+			va.SetInt(-int64(n))
+		} else {
+			va.SetInt(int64(n))
+		}
+		return nil
+	}
+	return &fncs
+}
+
+func makeUintArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	bits := t.Bits()
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if mo.Get(jsonopts.StringifyNumbers) {
+			return enc.WriteToken(jsontext.String(strconv.FormatUint(va.Uint(), 10)))
+		}
+		return enc.WriteToken(jsontext.Uint(va.Uint()))
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, b, err := readNumber(dec, uo, t)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return unmarshalNull(dec, va)
+		}
+		n, ok := parseDecUint(b)
+		if !ok {
+			return newUnmarshalError(dec, k, t, nil)
+		}
+		if bits < 64 && n >= uint64(1)<<uint(bits) {
+			return newUnmarshalError(dec, k, t, errOutOfRange)
+		}
+		va.SetUint(n)
+		return nil
+	}
+	return &fncs
+}
+
+// parseDecUint parses b as a decimal unsigned integer in JSON syntax.
+// It reports false if b is not an integer or if it overflows a uint64.
+func parseDecUint(b []byte) (uint64, bool) {
+	if len(b) == 0 || len(b) > 1 && b[0] == '0' {
+		return 0, false
+	}
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		d := uint64(c - '0')
+		if n > (math.MaxUint64-d)/10 {
+			return 0, false
+		}
+		n = 10*n + d
+	}
+	return n, true
+}
+
+// isValidNumber reports whether b is a JSON number.
+func isValidNumber(b []byte) bool {
+	if len(b) > 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	digits := func() int {
+		n := 0
+		for n < len(b) && '0' <= b[n] && b[n] <= '9' {
+			n++
+		}
+		b = b[n:]
+		return n
+	}
+	switch {
+	case len(b) == 0:
+		return false
+	case b[0] == '0':
+		b = b[1:]
+	case digits() == 0:
+		return false
+	}
+	if len(b) > 0 && b[0] == '.' {
+		b = b[1:]
+		if digits() == 0 {
+			return false
+		}
+	}
+	if len(b) > 0 && (b[0] == 'e' || b[0] == 'E') {
+		b = b[1:]
+		if len(b) > 0 && (b[0] == '+' || b[0] == '-') {
+			b = b[1:]
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return len(b) == 0
+}
+
+func makeFloatArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	bits := t.Bits()
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		f := va.Float()
+		format := fieldFormat(mo, enc.StackDepth())
+		if format != "" && format != "nonfinite" {
+			return newMarshalError(enc, t, errInvalidFormat)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			if format != "nonfinite" {
+				return newMarshalError(enc, t, errNonFinite)
+			}
+			switch {
+			case math.IsNaN(f):
+				return enc.WriteToken(jsontext.String("NaN"))
+			case f > 0:
+				return enc.WriteToken(jsontext.String("Infinity"))
+			default:
+				return enc.WriteToken(jsontext.String("-Infinity"))
+			}
+		}
+		if bits == 64 && !mo.Get(jsonopts.StringifyNumbers) {
+			return enc.WriteToken(jsontext.Float(f))
+		}
+		b := appendFloat(nil, f, bits)
+		if mo.Get(jsonopts.StringifyNumbers) {
+			return enc.WriteToken(jsontext.String(string(b)))
+		}
+		return enc.WriteValue(b)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		format := fieldFormat(uo, dec.StackDepth())
+		if format != "" && format != "nonfinite" {
+			if err := dec.SkipValue(); err != nil {
+				return err
+			}
+			return newUnmarshalError(dec, 0, t, errInvalidFormat)
+		}
+		if format == "nonfinite" && dec.PeekKind() == '"' && !uo.Get(jsonopts.StringifyNumbers) {
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return err
+			}
+			switch tok.String() {
+			case "NaN":
+				va.SetFloat(math.NaN())
+			case "Infinity":
+				va.SetFloat(math.Inf(+1))
+			case "-Infinity":
+				va.SetFloat(math.Inf(-1))
+			default:
+				return newUnmarshalError(dec, '"', t, errNonFinite)
+			}
+			return nil
+		}
+		_, b, err := readNumber(dec, uo, t)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return unmarshalNull(dec, va)
+		}
+		f, err := strconv.ParseFloat(string(b), bits)
+		if err != nil && math.IsInf(f, 0) {
+			// Clamp out of range values, as Token.Float does.
+			f = math.Copysign(math.MaxFloat64, f)
+			if bits == 32 {
+				f = math.Copysign(math.MaxFloat32, f)
+			}
+		}
+		va.SetFloat(f)
+		return nil
+	}
+	return &fncs
+}
+
+// appendFloat appends f as a JSON number, formatted as if by the
+// ES6 number to string conversion. f must be finite.
+func appendFloat(b []byte, f float64, bits int) []byte {
+	abs := math.Abs(f)
+	fmt := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			fmt = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, fmt, -1, bits)
+	if fmt == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+func makeMapArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	kt := t.Key()
+	keyMarshalNeedAddr := false
+	keyTextMarshaler := kt.Kind() != reflect.String
+	if keyTextMarshaler {
+		keyTextMarshaler, keyMarshalNeedAddr = implements(kt, textMarshalerType)
+	}
+	keyTextUnmarshaler := kt.Kind() != reflect.String && reflect.PtrTo(kt).Implements(textUnmarshalerType)
+	switch kt.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !keyTextMarshaler || !keyTextUnmarshaler {
+			return makeInvalidArshaler(t)
+		}
+	}
+
+	// keyName returns the JSON object name for the map key k.
+	keyName := func(k reflect.Value) (string, error) {
+		switch {
+		case kt.Kind() == reflect.String:
+			return k.String(), nil
+		case keyTextMarshaler:
+			if keyMarshalNeedAddr {
+				k = newAddressable(k).Addr()
+			}
+			b, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+			return string(b), err
+		case k.Kind() >= reflect.Int && k.Kind() <= reflect.Int64:
+			return strconv.FormatInt(k.Int(), 10), nil
+		default:
+			return strconv.FormatUint(k.Uint(), 10), nil
+		}
+	}
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if va.IsNil() && mo.Get(jsonopts.FormatNilMapAsNull) {
+			return enc.WriteToken(jsontext.Null)
+		}
+		if err := enc.WriteToken(jsontext.ObjectStart); err != nil {
+			return err
+		}
+		if va.Len() > 0 {
+			val := reflect.New(t.Elem()).Elem()
+			if mo.Get(jsonopts.Deterministic) {
+				type member struct {
+					name string
+					key  reflect.Value
+				}
+				members := make([]member, 0, va.Len())
+				for iter := va.MapRange(); iter.Next(); {
+					name, err := keyName(iter.Key())
+					if err != nil {
+						return newMarshalError(enc, kt, err)
+					}
+					members = append(members, member{name, iter.Key()})
+				}
+				sort.Slice(members, func(i, j int) bool { return members[i].name < members[j].name })
+				for _, m := range members {
+					if err := enc.WriteToken(jsontext.String(m.name)); err != nil {
+						return err
+					}
+					val.Set(va.MapIndex(m.key))
+					if err := marshalValue(enc, val, mo); err != nil {
+						return err
+					}
+				}
+			} else {
+				for iter := va.MapRange(); iter.Next(); {
+					name, err := keyName(iter.Key())
+					if err != nil {
+						return newMarshalError(enc, kt, err)
+					}
+					if err := enc.WriteToken(jsontext.String(name)); err != nil {
+						return err
+					}
+					val.Set(iter.Value())
+					if err := marshalValue(enc, val, mo); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return enc.WriteToken(jsontext.ObjectEnd)
+	}
+
+	// keyValue returns the map key for the JSON object name.
+	keyValue := func(name string) (reflect.Value, error) {
+		switch {
+		case kt.Kind() == reflect.String:
+			return reflect.ValueOf(name).Convert(kt), nil
+		case keyTextUnmarshaler:
+			k := reflect.New(kt)
+			err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name))
+			return k.Elem(), err
+		case kt.Kind() >= reflect.Int && kt.Kind() <= reflect.Int64:
+			n, err := strconv.ParseInt(name, 10, kt.Bits())
+			return reflect.ValueOf(n).Convert(kt), err
+		default:
+			n, err := strconv.ParseUint(name, 10, kt.Bits())
+			return reflect.ValueOf(n).Convert(kt), err
+		}
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '{':
+			if _, err := dec.ReadToken(); err != nil {
+				return err
+			}
+			if va.IsNil() {
+				va.Set(reflect.MakeMap(t))
+			}
+			for dec.PeekKind() != '}' {
+				tok, err := dec.ReadToken()
+				if err != nil {
+					return err
+				}
+				key, err := keyValue(tok.String())
+				if err != nil {
+					if err2 := dec.SkipValue(); err2 != nil {
+						return err2
+					}
+					return newUnmarshalError(dec, '"', kt, err)
+				}
+				val := reflect.New(t.Elem()).Elem()
+				if v := va.MapIndex(key); v.IsValid() {
+					val.Set(v)
+				}
+				if err := unmarshalValue(dec, val, uo); err != nil {
+					return err
+				}
+				va.SetMapIndex(key, val)
+			}
+			_, err := dec.ReadToken()
+			return err
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+// isByteType reports whether t is a byte type that is marshaled as part
+// of a binary string, which is the case if it has no marshal methods.
+func isByteType(t reflect.Type) bool {
+	if t.Kind() != reflect.Uint8 {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	for _, it := range []reflect.Type{marshalerToType, marshalerType, textMarshalerType, unmarshalerFromType, unmarshalerType, textUnmarshalerType} {
+		if pt.Implements(it) {
+			return false
+		}
+	}
+	return true
+}
+
+// byteEncoding returns the encode and decode functions for the
+// binary format of a byte slice or array.
+func byteEncoding(format string) (encode func([]byte) string, decode func(string) ([]byte, error), ok bool) {
+	switch format {
+	case "", "base64":
+		return base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString, true
+	case "base64url":
+		return base64.URLEncoding.EncodeToString, base64.URLEncoding.DecodeString, true
+	case "base32":
+		return base32.StdEncoding.EncodeToString, base32.StdEncoding.DecodeString, true
+	case "base32hex":
+		return base32.HexEncoding.EncodeToString, base32.HexEncoding.DecodeString, true
+	case "base16", "hex":
+		return hex.EncodeToString, hex.DecodeString, true
+	}
+	return nil, nil, false
+}
+
+// makeBytesArshaler returns the arshaler for a byte slice or array type t,
+// which uses the arshaler in fncs for the "array" format.
+func makeBytesArshaler(t reflect.Type, fncs *arshaler) *arshaler {
+	marshalArray, unmarshalArray := fncs.marshal, fncs.unmarshal
+	isArray := t.Kind() == reflect.Array
+	bytesOf := func(va reflect.Value) []byte {
+		if isArray {
+			return va.Slice(0, va.Len()).Bytes()
+		}
+		return va.Bytes()
+	}
+	var f arshaler
+	f.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		format := fieldFormat(mo, enc.StackDepth())
+		if format == "array" {
+			return marshalArray(enc, va, mo)
+		}
+		encode, _, ok := byteEncoding(format)
+		if !ok {
+			return newMarshalError(enc, t, errInvalidFormat)
+		}
+		if !isArray && va.IsNil() && mo.Get(jsonopts.FormatNilSliceAsNull) {
+			return enc.WriteToken(jsontext.Null)
+		}
+		return enc.WriteToken(jsontext.String(encode(bytesOf(va))))
+	}
+	f.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		format := fieldFormat(uo, dec.StackDepth())
+		if format == "array" {
+			return unmarshalArray(dec, va, uo)
+		}
+		_, decode, ok := byteEncoding(format)
+		if !ok {
+			if err := dec.SkipValue(); err != nil {
+				return err
+			}
+			return newUnmarshalError(dec, 0, t, errInvalidFormat)
+		}
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '"':
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return err
+			}
+			b, err := decode(tok.String())
+			if err != nil {
+				return newUnmarshalError(dec, k, t, err)
+			}
+			if isArray {
+				if len(b) != va.Len() {
+					return newUnmarshalError(dec, k, t, errArrayLength)
+				}
+				copy(bytesOf(va), b)
+			} else {
+				va.SetBytes(b)
+			}
+			return nil
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &f
+}
+
+func makeSliceArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if va.IsNil() && mo.Get(jsonopts.FormatNilSliceAsNull) {
+			return enc.WriteToken(jsontext.Null)
+		}
+		if err := enc.WriteToken(jsontext.ArrayStart); err != nil {
+			return err
+		}
+		for i := 0; i < va.Len(); i++ {
+			if err := marshalValue(enc, va.Index(i), mo); err != nil {
+				return err
+			}
+		}
+		return enc.WriteToken(jsontext.ArrayEnd)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '[':
+			if _, err := dec.ReadToken(); err != nil {
+				return err
+			}
+			// Reuse the backing array, but reset any elements
+			// beyond the current length to their zero value.
+			oldLen, n := va.Len(), 0
+			for dec.PeekKind() != ']' {
+				if n < va.Cap() {
+					va.SetLen(n + 1)
+				} else {
+					va.Set(reflect.Append(va, reflect.Zero(t.Elem())))
+				}
+				elem := va.Index(n)
+				if n >= oldLen {
+					elem.Set(reflect.Zero(t.Elem()))
+				}
+				if err := unmarshalValue(dec, elem, uo); err != nil {
+					return err
+				}
+				n++
+			}
+			if va.IsNil() {
+				va.Set(reflect.MakeSlice(t, 0, 0))
+			} else {
+				va.SetLen(n)
+			}
+			_, err := dec.ReadToken()
+			return err
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+func makeArrayArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if err := enc.WriteToken(jsontext.ArrayStart); err != nil {
+			return err
+		}
+		for i := 0; i < va.Len(); i++ {
+			if err := marshalValue(enc, va.Index(i), mo); err != nil {
+				return err
+			}
+		}
+		return enc.WriteToken(jsontext.ArrayEnd)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '[':
+			if _, err := dec.ReadToken(); err != nil {
+				return err
+			}
+			n := 0
+			for ; dec.PeekKind() != ']'; n++ {
+				if n >= va.Len() {
+					if err := dec.SkipValue(); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := unmarshalValue(dec, va.Index(n), uo); err != nil {
+					return err
+				}
+			}
+			if _, err := dec.ReadToken(); err != nil {
+				return err
+			}
+			if n != va.Len() {
+				return newUnmarshalError(dec, '[', t, errArrayLength)
+			}
+			return nil
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+func makePointerArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if va.IsNil() {
+			return enc.WriteToken(jsontext.Null)
+		}
+		return marshalValue(enc, va.Elem(), mo)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		if dec.PeekKind() == 'n' {
+			return unmarshalNull(dec, va)
+		}
+		if va.IsNil() {
+			va.Set(reflect.New(t.Elem()))
+		}
+		return unmarshalValue(dec, va.Elem(), uo)
+	}
+	return &fncs
+}
+
+var (
+	mapStringInterfaceType = reflect.TypeOf(map[string]interface{}(nil))
+	sliceInterfaceType     = reflect.TypeOf([]interface{}(nil))
+	float64Type            = reflect.TypeOf(float64(0))
+	stringType             = reflect.TypeOf("")
+	boolType               = reflect.TypeOf(false)
+)
+
+func makeInterfaceArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		if va.IsNil() {
+			return enc.WriteToken(jsontext.Null)
+		}
+		return marshalValue(enc, newAddressable(va.Elem()), mo)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		if k == 0 {
+			return err
+		}
+		if k == 'n' {
+			return unmarshalNull(dec, va)
+		}
+		// Decode into the value pointed to by a non-nil pointer,
+		// such that the caller may choose the concrete type.
+		if !va.IsNil() && va.Elem().Kind() == reflect.Ptr && !va.Elem().IsNil() {
+			return unmarshalValue(dec, va.Elem().Elem(), uo)
+		}
+		if t.NumMethod() > 0 {
+			if err := dec.SkipValue(); err != nil {
+				return err
+			}
+			return newUnmarshalError(dec, k, t, errNonEmptyInterface)
+		}
+		var vt reflect.Type
+		switch k {
+		case '{':
+			vt = mapStringInterfaceType
+		case '[':
+			vt = sliceInterfaceType
+		case '0':
+			vt = float64Type
+		case '"':
+			vt = stringType
+		default:
+			vt = boolType
+		}
+		v := reflect.New(vt).Elem()
+		if err := unmarshalValue(dec, v, uo); err != nil {
+			return err
+		}
+		va.Set(v)
+		return nil
+	}
+	return &fncs
+}
+
+func makeInvalidArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		return newMarshalError(enc, t, errUnsupportedType)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k := dec.PeekKind()
+		if err := dec.SkipValue(); err != nil {
+			return err
+		}
+		return newUnmarshalError(dec, k, t, errUnsupportedType)
+	}
+	return &fncs
+}
@@ -0,0 +1,371 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"encoding/json/internal/jsonopts"
+	"encoding/json/jsontext"
+	"errors"
+	"reflect"
+)
+
+// SkipFunc may be returned by MarshalToFunc and UnmarshalFromFunc functions.
+//
+// Any function that returns SkipFunc must not cause observable side effects
+// on the provided Encoder or Decoder. For example, it is permissible to call
+// Decoder.PeekKind, but not permissible to call Decoder.ReadToken or
+// Encoder.WriteToken since such methods mutate the state.
+var SkipFunc = errors.New("json: skip function")
+
+var (
+	errSkipMutation     = errors.New("must not read or write any tokens when skipping")
+	errNonSingularValue = errors.New("must read or write exactly one value")
+)
+
+// Marshalers is a list of functions that may override the marshal behavior
+// of specific types. Populate WithMarshalers to use it with
+// Marshal, MarshalWrite, or MarshalEncode.
+// A nil *Marshalers is equivalent to an empty list.
+// There are no exported fields or methods on Marshalers.
+type Marshalers struct {
+	fncs []typedMarshaler
+}
+
+type typedMarshaler struct {
+	typ     reflect.Type
+	fnc     func(*jsontext.Encoder, reflect.Value, *jsonopts.Struct) error
+	maySkip bool
+}
+
+// Unmarshalers is a list of functions that may override the unmarshal behavior
+// of specific types. Populate WithUnmarshalers to use it with
+// Unmarshal, UnmarshalRead, or UnmarshalDecode.
+// A nil *Unmarshalers is equivalent to an empty list.
+// There are no exported fields or methods on Unmarshalers.
+type Unmarshalers struct {
+	fncs []typedUnmarshaler
+}
+
+type typedUnmarshaler struct {
+	typ     reflect.Type
+	fnc     func(*jsontext.Decoder, reflect.Value, *jsonopts.Struct) error
+	maySkip bool
+}
+
+// JoinMarshalers constructs a flattened list of marshal functions.
+// If multiple functions in the list are applicable for a value of a given type,
+// then those earlier in the list take precedence over those that come later.
+// If a function returns SkipFunc, then the next applicable function is called,
+// otherwise the default marshaling behavior is used.
+//
+// For example:
+//
+//	m1 := JoinMarshalers(f1, f2)
+//	m2 := JoinMarshalers(f0, m1, f3)     // equivalent to m3
+//	m3 := JoinMarshalers(f0, f1, f2, f3) // equivalent to m2
+func JoinMarshalers(ms ...*Marshalers) *Marshalers {
+	var fncs []typedMarshaler
+	for _, m := range ms {
+		if m != nil {
+			fncs = append(fncs, m.fncs...)
+		}
+	}
+	return &Marshalers{fncs: fncs}
+}
+
+// JoinUnmarshalers constructs a flattened list of unmarshal functions.
+// If multiple functions in the list are applicable for a value of a given type,
+// then those earlier in the list take precedence over those that come later.
+// If a function returns SkipFunc, then the next applicable function is called,
+// otherwise the default unmarshaling behavior is used.
+func JoinUnmarshalers(us ...*Unmarshalers) *Unmarshalers {
+	var fncs []typedUnmarshaler
+	for _, u := range us {
+		if u != nil {
+			fncs = append(fncs, u.fncs...)
+		}
+	}
+	return &Unmarshalers{fncs: fncs}
+}
+
+// MarshalFunc constructs a type-specific marshaler that
+// specifies how to marshal values of type T.
+// The argument must be a function of the form:
+//
+//	func(T) ([]byte, error)
+//
+// T can be any type except a named pointer.
+// The function is always provided with a non-nil pointer value
+// if T is an interface or pointer type.
+//
+// The function must marshal exactly one JSON value.
+// The value of T must not be retained outside the function call.
+// It may not return SkipFunc.
+func MarshalFunc(fn interface{}) *Marshalers {
+	fv, t := checkFunc("MarshalFunc", fn, 1, 2, bytesType, errorType)
+	typFnc := typedMarshaler{
+		typ: t,
+		fnc: func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+			out := fv.Call([]reflect.Value{va})
+			if err, _ := out[1].Interface().(error); err != nil {
+				if err == SkipFunc {
+					err = errors.New("marshal function of type func(T) ([]byte, error) cannot be skipped")
+				}
+				return newMarshalError(enc, t, err)
+			}
+			if err := enc.WriteValue(out[0].Bytes()); err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); ok {
+					err = newMarshalError(enc, t, err)
+				}
+				return err
+			}
+			return nil
+		},
+	}
+	return &Marshalers{fncs: []typedMarshaler{typFnc}}
+}
+
+// MarshalToFunc constructs a type-specific marshaler that
+// specifies how to marshal values of type T.
+// The argument must be a function of the form:
+//
+//	func(*jsontext.Encoder, T) error
+//
+// T can be any type except a named pointer.
+// The function is always provided with a non-nil pointer value
+// if T is an interface or pointer type.
+//
+// The function must marshal exactly one JSON value by calling
+// Encoder.WriteToken or Encoder.WriteValue on the provided Encoder.
+// It may return SkipFunc such that marshaling can move on to the next
+// marshal function. However, no mutable method calls may be called on
+// the Encoder if SkipFunc is returned.
+// The pointer to Encoder and the value of T must not be retained
+// outside the function call.
+func MarshalToFunc(fn interface{}) *Marshalers {
+	fv, t := checkFunc("MarshalToFunc", fn, 2, 1, errorType)
+	if fv.Type().In(0) != encoderType {
+		panic("json: MarshalToFunc: first argument must be of type *jsontext.Encoder")
+	}
+	typFnc := typedMarshaler{
+		typ: t,
+		fnc: func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+			depth, length := stackState(enc.StackDepth(), enc.StackIndex)
+			out := fv.Call([]reflect.Value{reflect.ValueOf(enc), va})
+			err, _ := out[0].Interface().(error)
+			depth2, length2 := stackState(enc.StackDepth(), enc.StackIndex)
+			if err == SkipFunc {
+				if depth2 != depth || length2 != length {
+					return newMarshalError(enc, t, errSkipMutation)
+				}
+				return SkipFunc
+			}
+			if err == nil && (depth2 != depth || length2 != length+1) {
+				err = errNonSingularValue
+			}
+			if err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); !ok {
+					if _, ok := err.(*SemanticError); !ok {
+						err = newMarshalError(enc, t, err)
+					}
+				}
+			}
+			return err
+		},
+		maySkip: true,
+	}
+	return &Marshalers{fncs: []typedMarshaler{typFnc}}
+}
+
+// UnmarshalFunc constructs a type-specific unmarshaler that
+// specifies how to unmarshal values of type T.
+// The argument must be a function of the form:
+//
+//	func([]byte, T) error
+//
+// T must be an unnamed pointer or an interface type.
+// The function is always provided with a non-nil pointer value.
+//
+// The function must unmarshal exactly one JSON value.
+// The input []byte must not be mutated.
+// The input []byte and value T must not be retained outside the function call.
+// It may not return SkipFunc.
+func UnmarshalFunc(fn interface{}) *Unmarshalers {
+	fv, t := checkFunc("UnmarshalFunc", fn, 2, 1, errorType)
+	if fv.Type().In(0) != bytesType {
+		panic("json: UnmarshalFunc: first argument must be of type []byte")
+	}
+	checkUnmarshalType("UnmarshalFunc", t)
+	typFnc := typedUnmarshaler{
+		typ: t,
+		fnc: func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+			val, err := dec.ReadValue()
+			if err != nil {
+				return err
+			}
+			out := fv.Call([]reflect.Value{reflect.ValueOf([]byte(val)), va})
+			if err, _ := out[0].Interface().(error); err != nil {
+				if err == SkipFunc {
+					err = errors.New("unmarshal function of type func([]byte, T) error cannot be skipped")
+				}
+				return newUnmarshalError(dec, val.Kind(), t, err)
+			}
+			return nil
+		},
+	}
+	return &Unmarshalers{fncs: []typedUnmarshaler{typFnc}}
+}
+
+// UnmarshalFromFunc constructs a type-specific unmarshaler that
+// specifies how to unmarshal values of type T.
+// The argument must be a function of the form:
+//
+//	func(*jsontext.Decoder, T) error
+//
+// T must be an unnamed pointer or an interface type.
+// The function is always provided with a non-nil pointer value.
+//
+// The function must unmarshal exactly one JSON value by calling
+// Decoder.ReadToken or Decoder.ReadValue on the provided Decoder.
+// It may return SkipFunc such that unmarshaling can move on to the next
+// unmarshal function. However, no mutable method calls may be called on
+// the Decoder if SkipFunc is returned.
+// The pointer to Decoder and the value of T must not be retained
+// outside the function call.
+func UnmarshalFromFunc(fn interface{}) *Unmarshalers {
+	fv, t := checkFunc("UnmarshalFromFunc", fn, 2, 1, errorType)
+	if fv.Type().In(0) != decoderType {
+		panic("json: UnmarshalFromFunc: first argument must be of type *jsontext.Decoder")
+	}
+	checkUnmarshalType("UnmarshalFromFunc", t)
+	typFnc := typedUnmarshaler{
+		typ: t,
+		fnc: func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+			depth, length := stackState(dec.StackDepth(), dec.StackIndex)
+			out := fv.Call([]reflect.Value{reflect.ValueOf(dec), va})
+			err, _ := out[0].Interface().(error)
+			depth2, length2 := stackState(dec.StackDepth(), dec.StackIndex)
+			if err == SkipFunc {
+				if depth2 != depth || length2 != length {
+					return newUnmarshalError(dec, 0, t, errSkipMutation)
+				}
+				return SkipFunc
+			}
+			if err == nil && (depth2 != depth || length2 != length+1) {
+				err = errNonSingularValue
+			}
+			if err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); !ok {
+					if _, ok := err.(*SemanticError); !ok {
+						err = newUnmarshalError(dec, 0, t, err)
+					}
+				}
+			}
+			return err
+		},
+		maySkip: true,
+	}
+	return &Unmarshalers{fncs: []typedUnmarshaler{typFnc}}
+}
+
+var (
+	bytesType   = reflect.TypeOf([]byte(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	encoderType = reflect.TypeOf((*jsontext.Encoder)(nil))
+	decoderType = reflect.TypeOf((*jsontext.Decoder)(nil))
+)
+
+// checkFunc checks that fn is a function with numIn arguments whose results
+// are of the types in out, and returns the function value along with the
+// type of its last argument.
+func checkFunc(name string, fn interface{}, numIn, numOut int, out ...reflect.Type) (reflect.Value, reflect.Type) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if fv.Kind() != reflect.Func || fv.IsNil() || ft.NumIn() != numIn || ft.NumOut() != numOut || ft.IsVariadic() {
+		panic("json: " + name + ": invalid function of type " + ft.String())
+	}
+	for i, t := range out {
+		if ft.Out(i) != t {
+			panic("json: " + name + ": invalid function of type " + ft.String())
+		}
+	}
+	t := ft.In(numIn - 1)
+	if t.Kind() == reflect.Ptr && t.Name() != "" {
+		panic("json: " + name + ": argument type " + t.String() + " must not be a named pointer")
+	}
+	return fv, t
+}
+
+func checkUnmarshalType(name string, t reflect.Type) {
+	if (t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface) || t.Name() != "" && t.Kind() == reflect.Ptr {
+		panic("json: " + name + ": argument type " + t.String() + " must be an unnamed pointer or interface")
+	}
+}
+
+// stackState returns the current depth and the number of values
+// (or object names and values) at the current depth.
+func stackState(depth int, index func(int) (jsontext.Kind, int64)) (int, int64) {
+	_, length := index(depth)
+	return depth, length
+}
+
+// marshal calls the first applicable marshal function for va.
+// It reports whether va was handled by any function.
+func (m *Marshalers) marshal(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) (bool, error) {
+	for _, f := range m.fncs {
+		v, ok := matchFuncType(va, f.typ)
+		if !ok {
+			continue
+		}
+		err := f.fnc(enc, v, mo)
+		if f.maySkip && err == SkipFunc {
+			continue
+		}
+		return true, err
+	}
+	return false, nil
+}
+
+// unmarshal calls the first applicable unmarshal function for va.
+// It reports whether va was handled by any function.
+func (u *Unmarshalers) unmarshal(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) (bool, error) {
+	for _, f := range u.fncs {
+		v, ok := matchFuncType(va, f.typ)
+		if !ok {
+			continue
+		}
+		err := f.fnc(dec, v, uo)
+		if f.maySkip && err == SkipFunc {
+			continue
+		}
+		return true, err
+	}
+	return false, nil
+}
+
+// matchFuncType reports whether a function whose argument is of type t
+// applies to the addressable value va, and returns the argument to pass.
+// Pointer and interface arguments are passed the address of va,
+// such that unmarshal functions can modify the value.
+func matchFuncType(va reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	switch {
+	case va.Type() == t:
+		if (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) && va.IsNil() {
+			return reflect.Value{}, false
+		}
+		return va, true
+	case t.Kind() == reflect.Ptr && va.Type() == t.Elem():
+		return va.Addr(), true
+	case t.Kind() != reflect.Interface || va.Kind() == reflect.Interface:
+		return reflect.Value{}, false
+	case va.Kind() == reflect.Ptr:
+		if !va.IsNil() && va.Type().Implements(t) {
+			return va, true
+		}
+	case reflect.PtrTo(va.Type()).Implements(t):
+		return va.Addr(), true
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"encoding"
+	"encoding/json/internal/jsonopts"
+	"encoding/json/jsontext"
+	"errors"
+	"reflect"
+)
+
+// MarshalerTo is implemented by types that can marshal themselves.
+// It is recommended that types implement MarshalerTo instead of Marshaler
+// since this is both more performant and flexible.
+// If a type implements both Marshaler and MarshalerTo,
+// then MarshalerTo takes precedence.
+//
+// The implementation must write only one JSON value to the Encoder and
+// must not retain the pointer to Encoder.
+type MarshalerTo interface {
+	MarshalJSONTo(*jsontext.Encoder) error
+}
+
+// Marshaler is implemented by types that can marshal themselves.
+// It is recommended that types implement MarshalerTo unless the implementation
+// is trying to avoid a hard dependency on the "jsontext" package.
+type Marshaler interface {
+	MarshalJSON() ([]byte, error)
+}
+
+// UnmarshalerFrom is implemented by types that can unmarshal themselves.
+// It is recommended that types implement UnmarshalerFrom instead of Unmarshaler
+// since this is both more performant and flexible.
+// If a type implements both Unmarshaler and UnmarshalerFrom,
+// then UnmarshalerFrom takes precedence.
+//
+// The implementation must read only one JSON value from the Decoder.
+// It is recommended that UnmarshalJSONFrom implement merge semantics when
+// unmarshaling into a pre-populated value.
+//
+// Implementations must not retain the pointer to Decoder.
+type UnmarshalerFrom interface {
+	UnmarshalJSONFrom(*jsontext.Decoder) error
+}
+
+// Unmarshaler is implemented by types that can unmarshal themselves.
+// It is recommended that types implement UnmarshalerFrom unless the implementation
+// is trying to avoid a hard dependency on the "jsontext" package.
+//
+// The input can be assumed to be a valid encoding of a JSON value.
+// UnmarshalJSON must copy the JSON data if it is retained after returning.
+type Unmarshaler interface {
+	UnmarshalJSON([]byte) error
+}
+
+var (
+	marshalerToType     = reflect.TypeOf((*MarshalerTo)(nil)).Elem()
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	unmarshalerFromType = reflect.TypeOf((*UnmarshalerFrom)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// implements reports whether t or *t implements ifaceType,
+// and whether the method requires the address of the value.
+func implements(t, ifaceType reflect.Type) (ok, needAddr bool) {
+	switch {
+	case t.Implements(ifaceType):
+		return true, false
+	case reflect.PtrTo(t).Implements(ifaceType):
+		return true, true
+	}
+	return false, false
+}
+
+// methodReceiver returns the receiver to call a method on.
+func methodReceiver(va reflect.Value, needAddr bool) reflect.Value {
+	if needAddr {
+		return va.Addr()
+	}
+	return va
+}
+
+// makeMethodArshaler overrides fncs with the marshal and unmarshal methods
+// implemented by t, if any.
+func makeMethodArshaler(fncs *arshaler, t reflect.Type) *arshaler {
+	// Pointers and interfaces are handled by dereferencing,
+	// so that the methods of the underlying value are called
+	// only when it is non-nil.
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		return fncs
+	}
+	f := *fncs
+
+	if ok, needAddr := implements(t, marshalerToType); ok {
+		f.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+			depth, length := stackState(enc.StackDepth(), enc.StackIndex)
+			m := methodReceiver(va, needAddr).Interface().(MarshalerTo)
+			err := m.MarshalJSONTo(enc)
+			depth2, length2 := stackState(enc.StackDepth(), enc.StackIndex)
+			if err == nil && (depth2 != depth || length2 != length+1) {
+				err = errNonSingularValue
+			}
+			if err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); !ok {
+					if _, ok := err.(*SemanticError); !ok {
+						err = newMarshalError(enc, t, err)
+					}
+				}
+			}
+			return err
+		}
+	} else if ok, needAddr := implements(t, marshalerType); ok {
+		f.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+			m := methodReceiver(va, needAddr).Interface().(Marshaler)
+			val, err := m.MarshalJSON()
+			if err != nil {
+				return newMarshalError(enc, t, err)
+			}
+			if err := enc.WriteValue(val); err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); ok {
+					err = newMarshalError(enc, t, err)
+				}
+				return err
+			}
+			return nil
+		}
+	} else if ok, needAddr := implements(t, textMarshalerType); ok {
+		f.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+			m := methodReceiver(va, needAddr).Interface().(encoding.TextMarshaler)
+			s, err := m.MarshalText()
+			if err != nil {
+				return newMarshalError(enc, t, err)
+			}
+			if err := enc.WriteToken(jsontext.String(string(s))); err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); ok {
+					err = newMarshalError(enc, t, err)
+				}
+				return err
+			}
+			return nil
+		}
+	}
+
+	// Unmarshal methods always require a pointer receiver
+	// to have any effect.
+	if reflect.PtrTo(t).Implements(unmarshalerFromType) {
+		f.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+			depth, length := stackState(dec.StackDepth(), dec.StackIndex)
+			u := va.Addr().Interface().(UnmarshalerFrom)
+			err := u.UnmarshalJSONFrom(dec)
+			depth2, length2 := stackState(dec.StackDepth(), dec.StackIndex)
+			if err == nil && (depth2 != depth || length2 != length+1) {
+				err = errNonSingularValue
+			}
+			if err != nil {
+				if _, ok := err.(*jsontext.SyntacticError); !ok {
+					if _, ok := err.(*SemanticError); !ok {
+						err = newUnmarshalError(dec, 0, t, err)
+					}
+				}
+			}
+			return err
+		}
+	} else if reflect.PtrTo(t).Implements(unmarshalerType) {
+		f.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+			val, err := dec.ReadValue()
+			if err != nil {
+				return err
+			}
+			u := va.Addr().Interface().(Unmarshaler)
+			if err := u.UnmarshalJSON(val); err != nil {
+				return newUnmarshalError(dec, val.Kind(), t, err)
+			}
+			return nil
+		}
+	} else if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		f.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+			switch k := dec.PeekKind(); k {
+			case 'n':
+				if _, err := dec.ReadToken(); err != nil {
+					return err
+				}
+				va.Set(reflect.Zero(t))
+				return nil
+			case '"':
+				tok, err := dec.ReadToken()
+				if err != nil {
+					return err
+				}
+				u := va.Addr().Interface().(encoding.TextUnmarshaler)
+				if err := u.UnmarshalText([]byte(tok.String())); err != nil {
+					return newUnmarshalError(dec, k, t, err)
+				}
+				return nil
+			case 0:
+				_, err := dec.ReadToken()
+				return err
+			default:
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				return newUnmarshalError(dec, k, t, errTextUnmarshal)
+			}
+		}
+	}
+	return &f
+}
+
+var errTextUnmarshal = errors.New("encoding.TextUnmarshaler requires a JSON string")
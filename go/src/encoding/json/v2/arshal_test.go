@@ -0,0 +1,476 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	structAll struct {
+		Bool   bool
+		String string
+		Int    int
+		Uint   uint8
+		Float  float32
+		Map    map[string]int
+		Slice  []string
+		Array  [2]int
+		Ptr    *structAll
+		Iface  interface{}
+	}
+	structTags struct {
+		Renamed    int    `json:"renamed"`
+		Quoted     int    `json:"'a,b'"`
+		Ignored    int    `json:"-"`
+		OmitZero   int    `json:",omitzero"`
+		OmitEmpty  []int  `json:",omitempty"`
+		Stringify  int    `json:",string"`
+		Strict     string `json:",case:strict"`
+		Loose      string `json:"loose_name,case:ignore"`
+		unexported int
+	}
+	structInlined struct {
+		A int
+		structEmbedded
+		Named   structEmbedded   `json:"named"`
+		Inlined *structEmbedded2 `json:",inline"`
+	}
+	structEmbedded struct {
+		B int
+	}
+	structEmbedded2 struct {
+		C int
+	}
+	structUnknownMap struct {
+		A       int
+		Unknown map[string]interface{} `json:",unknown"`
+	}
+	structUnknownRaw struct {
+		A       int
+		Unknown jsontext.Value `json:",unknown"`
+	}
+	structFormats struct {
+		Base64    []byte        `json:",format:base64"`
+		Hex       [2]byte       `json:",format:hex"`
+		Array     []byte        `json:",format:array"`
+		Float     float64       `json:",format:nonfinite"`
+		Time      time.Time     `json:",format:RFC1123"`
+		Unix      time.Time     `json:",format:unixmilli"`
+		Layout    time.Time     `json:",format:'2006-01-02'"`
+		Duration  time.Duration `json:",format:sec"`
+		DefaultTD time.Duration
+	}
+	structIsZero struct {
+		Time     time.Time    `json:",omitzero"`
+		Positive positiveInt  `json:",omitzero"`
+		PtrZero  *positiveInt `json:",omitzero"`
+		Value    int
+	}
+	structBadTag struct {
+		A int `json:",unknownoption"`
+	}
+
+	positiveInt int
+	textType    string
+	hexInt      int
+	methodValue int
+	methodPtr   int
+)
+
+// IsZero reports all non-positive values as zero.
+func (n positiveInt) IsZero() bool { return n <= 0 }
+
+func (t textType) MarshalText() ([]byte, error) { return []byte(strings.ToUpper(string(t))), nil }
+func (t *textType) UnmarshalText(b []byte) error {
+	*t = textType(strings.ToLower(string(b)))
+	return nil
+}
+
+func (n hexInt) MarshalText() ([]byte, error) {
+	if n < 0 {
+		return []byte("negative"), nil
+	}
+	return []byte("0x" + strconv.FormatInt(int64(n), 16)), nil
+}
+func (n *hexInt) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseInt(string(b), 0, 64)
+	*n = hexInt(v)
+	return err
+}
+
+func (m methodValue) MarshalJSONTo(enc *jsontext.Encoder) error {
+	return enc.WriteToken(jsontext.String("value"))
+}
+
+func (m *methodPtr) MarshalJSON() ([]byte, error) { return []byte(`"ptr"`), nil }
+func (m *methodPtr) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	tok, err := dec.ReadToken()
+	if err != nil {
+		return err
+	}
+	*m = methodPtr(len(tok.String()))
+	return nil
+}
+
+func TestMarshal(t *testing.T) {
+	ts := time.Date(2021, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	tests := []struct {
+		name string
+		opts []Options
+		in   interface{}
+		want string
+	}{
+		{name: "Nil", in: nil, want: `null`},
+		{name: "Bool", in: true, want: `true`},
+		{name: "String", in: "hello\n", want: `"hello\n"`},
+		{name: "Int", in: int8(-128), want: `-128`},
+		{name: "Uint", in: uint64(math.MaxUint64), want: `18446744073709551615`},
+		{name: "Float32", in: float32(3.14), want: `3.14`},
+		{name: "Float64", in: 1e21, want: `1e+21`},
+		{name: "StringifyNumbers", opts: []Options{StringifyNumbers(true)}, in: []interface{}{1, 1.5, uint(2)}, want: `["1","1.5","2"]`},
+		{name: "NilSlice", in: []int(nil), want: `[]`},
+		{name: "NilSliceAsNull", opts: []Options{FormatNilSliceAsNull(true)}, in: []int(nil), want: `null`},
+		{name: "NilMap", in: map[string]int(nil), want: `{}`},
+		{name: "NilMapAsNull", opts: []Options{FormatNilMapAsNull(true)}, in: map[string]int(nil), want: `null`},
+		{name: "MapDeterministic", opts: []Options{Deterministic(true)}, in: map[string]int{"c": 3, "a": 1, "b": 2}, want: `{"a":1,"b":2,"c":3}`},
+		{name: "MapIntKeys", opts: []Options{Deterministic(true)}, in: map[int]bool{-1: true, 2: false}, want: `{"-1":true,"2":false}`},
+		{name: "MapStringKeys", in: map[textType]int{"k": 1}, want: `{"k":1}`},
+		{name: "MapTextKeys", opts: []Options{Deterministic(true)}, in: map[hexInt]int{10: 1, 255: 2}, want: `{"0xa":1,"0xff":2}`},
+		{name: "Bytes", in: []byte("hello"), want: `"aGVsbG8="`},
+		{name: "ByteArray", in: [3]byte{1, 2, 3}, want: `"AQID"`},
+		{name: "Pointer", in: new(int), want: `0`},
+		{name: "Struct", opts: []Options{Deterministic(true)}, in: structAll{
+			Bool: true, String: "s", Int: -1, Uint: 1, Float: 0.5,
+			Map: map[string]int{"k": 1}, Slice: []string{"x"}, Array: [2]int{1, 2},
+			Ptr: &structAll{}, Iface: "i",
+		}, want: `{"Bool":true,"String":"s","Int":-1,"Uint":1,"Float":0.5,"Map":{"k":1},"Slice":["x"],"Array":[1,2],"Ptr":{"Bool":false,"String":"","Int":0,"Uint":0,"Float":0,"Map":{},"Slice":[],"Array":[0,0],"Ptr":null,"Iface":null},"Iface":"i"}`},
+		{name: "StructTags", in: structTags{Renamed: 1, Quoted: 2, Ignored: 3, Stringify: 4}, want: `{"renamed":1,"a,b":2,"Stringify":"4","Strict":"","loose_name":""}`},
+		{name: "OmitZeroStructFields", opts: []Options{OmitZeroStructFields(true)}, in: structTags{Renamed: 1}, want: `{"renamed":1}`},
+		{name: "StructIsZero", in: structIsZero{Positive: -1}, want: `{"Value":0}`},
+		{name: "StructInlined", in: structInlined{A: 1, structEmbedded: structEmbedded{B: 2}, Named: structEmbedded{B: 3}, Inlined: &structEmbedded2{C: 4}}, want: `{"A":1,"B":2,"named":{"B":3},"C":4}`},
+		{name: "StructInlinedNilPointer", in: structInlined{}, want: `{"A":0,"B":0,"named":{"B":0}}`},
+		{name: "StructUnknownMap", opts: []Options{Deterministic(true)}, in: structUnknownMap{A: 1, Unknown: map[string]interface{}{"y": 2.0, "x": "1"}}, want: `{"A":1,"x":"1","y":2}`},
+		{name: "StructUnknownRaw", in: structUnknownRaw{A: 1, Unknown: jsontext.Value(` { "x" : [ 1 ] } `)}, want: `{"A":1,"x":[1]}`},
+		{name: "StructFormats", in: structFormats{
+			Base64: []byte{0xff}, Hex: [2]byte{0xab, 0xcd}, Array: []byte{1, 2},
+			Float: math.Inf(-1), Time: ts, Unix: ts, Layout: ts,
+			Duration: 1500 * time.Millisecond, DefaultTD: time.Minute,
+		}, want: `{"Base64":"/w==","Hex":"abcd","Array":[1,2],"Float":"-Infinity","Time":"Thu, 06 May 2021 07:08:09 UTC","Unix":1620284889123,"Layout":"2021-05-06","Duration":1.5,"DefaultTD":"1m0s"}`},
+		{name: "Time", in: ts, want: `"2021-05-06T07:08:09.123Z"`},
+		{name: "MethodText", in: textType("abc"), want: `"ABC"`},
+		{name: "MethodValue", in: []methodValue{1, 2}, want: `["value","value"]`},
+		{name: "MethodPointer", in: struct{ M methodPtr }{}, want: `{"M":"ptr"}`},
+		{name: "RawValue", in: jsontext.Value(`{"a" : 1}`), want: `{"a":1}`},
+		{name: "Indent", opts: []Options{jsontext.WithIndent("  ")}, in: []int{1}, want: "[\n  1\n]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.in, tt.opts...)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal:\ngot  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Options
+		in   interface{}
+		want string
+	}{
+		{name: "Chan", in: make(chan int), want: `json: cannot marshal from Go chan int: unsupported type`},
+		{name: "NaN", in: []float64{math.NaN()}, want: `json: cannot marshal from Go float64 within "/0": unsupported non-finite value`},
+		{name: "BadTag", in: structBadTag{}, want: "json: cannot marshal from Go json.structBadTag: Go struct field A has unknown `unknownoption` tag option"},
+		{name: "InvalidUTF8", in: "\xff", want: `jsontext: invalid UTF-8 within string`},
+		{name: "DuplicateName", in: map[hexInt]int{-1: 1, -2: 2}, want: `jsontext: duplicate object member name "negative"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.in, tt.opts...)
+			if err == nil {
+				t.Fatalf("Marshal succeeded unexpectedly")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Marshal error:\ngot  %v\nwant %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	ts := time.Date(2021, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	tests := []struct {
+		name  string
+		opts  []Options
+		in    string
+		inVal interface{} // pointer to the initial value
+		want  interface{}
+	}{
+		{name: "Bool", in: `true`, inVal: new(bool), want: true},
+		{name: "String", in: `"Ab"`, inVal: new(string), want: "Ab"},
+		{name: "Int", in: `-9223372036854775808`, inVal: new(int64), want: int64(math.MinInt64)},
+		{name: "Uint", in: `255`, inVal: new(uint8), want: uint8(255)},
+		{name: "Float", in: `1.5e3`, inVal: new(float32), want: float32(1500)},
+		{name: "StringifyNumbers", opts: []Options{StringifyNumbers(true)}, in: `["1", 2]`, inVal: new([]int), want: []int{1, 2}},
+		{name: "Null", in: `null`, inVal: func() *int { v := 5; return &v }(), want: 0},
+		{name: "Interface", in: `{"a":[1,"b",true,null]}`, inVal: new(interface{}), want: map[string]interface{}{"a": []interface{}{1.0, "b", true, nil}}},
+		{name: "InterfacePointer", in: `5`, inVal: func() *interface{} { var v interface{} = new(int); return &v }(), want: func() interface{} { v := 5; return &v }()},
+		{name: "MapMerge", in: `{"b":2}`, inVal: &map[string]int{"a": 1}, want: map[string]int{"a": 1, "b": 2}},
+		{name: "MapIntKeys", in: `{"-1":true}`, inVal: new(map[int8]bool), want: map[int8]bool{-1: true}},
+		{name: "MapStringKeys", in: `{"K":1}`, inVal: new(map[textType]int), want: map[textType]int{"K": 1}},
+		{name: "MapTextKeys", in: `{"0xff":1}`, inVal: new(map[hexInt]int), want: map[hexInt]int{255: 1}},
+		{name: "EmptySlice", in: `[]`, inVal: new([]int), want: []int{}},
+		{name: "SliceReuse", in: `[3]`, inVal: &[]int{1, 2}, want: []int{3}},
+		{name: "Bytes", in: `"aGVsbG8="`, inVal: new([]byte), want: []byte("hello")},
+		{name: "ByteArray", in: `"AQID"`, inVal: new([3]byte), want: [3]byte{1, 2, 3}},
+		{name: "Pointer", in: `{"Ptr":{"Int":1}}`, inVal: new(structAll), want: structAll{Ptr: &structAll{Int: 1}}},
+		{name: "StructTags", in: `{"renamed":1,"a,b":2,"Ignored":3,"Stringify":"4","STRICT":"x","LOOSENAME":"y"}`, inVal: new(structTags), want: structTags{Renamed: 1, Quoted: 2, Stringify: 4, Loose: "y"}},
+		{name: "MatchCaseInsensitiveNames", opts: []Options{MatchCaseInsensitiveNames(true)}, in: `{"RENAMED":1,"strict":"x","Strict":"y"}`, inVal: new(structTags), want: structTags{Renamed: 1, Strict: "y"}},
+		{name: "StructInlined", in: `{"A":1,"B":2,"named":{"B":3},"C":4}`, inVal: new(structInlined), want: structInlined{A: 1, structEmbedded: structEmbedded{B: 2}, Named: structEmbedded{B: 3}, Inlined: &structEmbedded2{C: 4}}},
+		{name: "StructUnknownMap", in: `{"A":1,"x":"1","y":2}`, inVal: new(structUnknownMap), want: structUnknownMap{A: 1, Unknown: map[string]interface{}{"x": "1", "y": 2.0}}},
+		{name: "StructUnknownRaw", in: `{"x":1,"A":1,"y":[2]}`, inVal: new(structUnknownRaw), want: structUnknownRaw{A: 1, Unknown: jsontext.Value(`{"x":1,"y":[2]}`)}},
+		{name: "StructFormats", in: `{"Base64":"/w==","Hex":"abcd","Array":[1,2],"Float":"NaN","Time":"Thu, 06 May 2021 07:08:09 UTC","Unix":1620284889123,"Layout":"2021-05-06","Duration":-1.5,"DefaultTD":"1m"}`, inVal: new(structFormats), want: structFormats{
+			Base64: []byte{0xff}, Hex: [2]byte{0xab, 0xcd}, Array: []byte{1, 2},
+			Float: math.NaN(), Time: ts.Truncate(time.Second), Unix: ts, Layout: time.Date(2021, 5, 6, 0, 0, 0, 0, time.UTC),
+			Duration: -1500 * time.Millisecond, DefaultTD: time.Minute,
+		}},
+		{name: "MethodText", in: `"ABC"`, inVal: new(textType), want: textType("abc")},
+		{name: "MethodPointer", in: `"abc"`, inVal: new(methodPtr), want: methodPtr(3)},
+		{name: "RawValue", in: ` {"a" : 1} `, inVal: new(jsontext.Value), want: jsontext.Value(`{"a" : 1}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Unmarshal([]byte(tt.in), tt.inVal, tt.opts...); err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			got := reflect.ValueOf(tt.inVal).Elem().Interface()
+			if _, ok := got.(structFormats); ok {
+				// Times and NaN cannot be compared with reflect.DeepEqual,
+				// so compare their JSON representations instead.
+				gotJSON, _ := Marshal(got)
+				wantJSON, _ := Marshal(tt.want)
+				got, tt.want = string(gotJSON), string(wantJSON)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal:\ngot  %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Options
+		in    string
+		inVal interface{}
+		want  string
+	}{
+		{name: "NilPointer", in: `1`, inVal: (*int)(nil), want: `json: cannot unmarshal into Go int: value must be passed as a non-nil pointer reference`},
+		{name: "Mismatch", in: `{"Int":"x"}`, inVal: new(structAll), want: `json: cannot unmarshal JSON string into Go int within "/Int"`},
+		{name: "Overflow", in: `[1,128]`, inVal: new([]int8), want: `json: cannot unmarshal JSON number into Go int8 within "/1": value out of range`},
+		{name: "Fraction", in: `1.5`, inVal: new(int), want: `json: cannot unmarshal JSON number into Go int`},
+		{name: "ArrayLength", in: `[1,2,3]`, inVal: new([2]int), want: `json: cannot unmarshal JSON array into Go [2]int: mismatching array length`},
+		{name: "RejectUnknownMembers", opts: []Options{RejectUnknownMembers(true)}, in: `{"A":1,"x":2}`, inVal: new(structUnknownMap), want: `json: cannot unmarshal into Go json.structUnknownMap: unknown object member name "x"`},
+		{name: "DuplicateName", in: `{"A":1,"A":2}`, inVal: new(structAll), want: `jsontext: duplicate object member name "A"`},
+		{name: "TrailingData", in: `1 2`, inVal: new(int), want: `jsontext: invalid data after top-level value`},
+		{name: "Truncated", in: `[1,`, inVal: new([]int), want: `jsontext: unexpected EOF`},
+		{name: "NonEmptyInterface", in: `1`, inVal: new(error), want: `json: cannot unmarshal JSON number into Go error: cannot derive concrete type for non-empty interface`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal([]byte(tt.in), tt.inVal, tt.opts...)
+			if err == nil {
+				t.Fatalf("Unmarshal succeeded unexpectedly")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Unmarshal error:\ngot  %v\nwant %v", err, tt.want)
+			}
+		})
+	}
+
+	var serr *SemanticError
+	err := Unmarshal([]byte(`{"a":{"b":true}}`), new(map[string]map[string]string))
+	if !errors.As(err, &serr) || serr.JSONPointer != "/a/b" || serr.JSONKind != 't' || serr.GoType != reflect.TypeOf("") {
+		t.Errorf("Unmarshal error = %#v, want SemanticError at /a/b", err)
+	}
+	err = Unmarshal([]byte(`{"x":1}`), new(structAll), RejectUnknownMembers(true))
+	if !errors.Is(err, ErrUnknownName) {
+		t.Errorf("Unmarshal error = %v, want ErrUnknownName", err)
+	}
+}
+
+func TestMarshalers(t *testing.T) {
+	// Marshal integers in hexadecimal, but skip negative numbers.
+	m := JoinMarshalers(
+		MarshalToFunc(func(enc *jsontext.Encoder, n int) error {
+			if n < 0 {
+				return SkipFunc
+			}
+			return enc.WriteToken(jsontext.String("0x" + strings.ToUpper(string("0123456789abcdef"[n%16]))))
+		}),
+		MarshalFunc(func(n int) ([]byte, error) {
+			return []byte(`"negative"`), nil
+		}),
+		MarshalFunc(func(b bool) ([]byte, error) {
+			return []byte(`"bad" "value"`), nil
+		}),
+	)
+	got, err := Marshal([]interface{}{1, -1, 10}, WithMarshalers(m))
+	if want := `["0x1","negative","0xA"]`; err != nil || string(got) != want {
+		t.Errorf("Marshal = %s, %v; want %s", got, err, want)
+	}
+	if _, err := Marshal(true, WithMarshalers(m)); err == nil {
+		t.Errorf("Marshal of invalid marshaler output succeeded unexpectedly")
+	}
+
+	u := JoinUnmarshalers(
+		UnmarshalFromFunc(func(dec *jsontext.Decoder, s *string) error {
+			if dec.PeekKind() != '0' {
+				return SkipFunc
+			}
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return err
+			}
+			*s = "number " + tok.String()
+			return nil
+		}),
+		UnmarshalFunc(func(b []byte, s *string) error {
+			*s = "raw " + string(b)
+			return nil
+		}),
+	)
+	var ss []string
+	if err := Unmarshal([]byte(`[1,"a",true]`), &ss, WithUnmarshalers(u)); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if want := []string{"number 1", `raw "a"`, "raw true"}; !reflect.DeepEqual(ss, want) {
+		t.Errorf("Unmarshal = %q, want %q", ss, want)
+	}
+
+	bad := UnmarshalFromFunc(func(dec *jsontext.Decoder, s *string) error {
+		dec.ReadToken()
+		return SkipFunc
+	})
+	if err := Unmarshal([]byte(`"x"`), new(string), WithUnmarshalers(bad)); err == nil || !strings.Contains(err.Error(), errSkipMutation.Error()) {
+		t.Errorf("Unmarshal error = %v, want %v", err, errSkipMutation)
+	}
+}
+
+func TestMarshalFuncPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"MarshalFunc", func() { MarshalFunc(func(int) error { return nil }) }},
+		{"MarshalToFunc", func() { MarshalToFunc(func(int, int) error { return nil }) }},
+		{"UnmarshalFunc", func() { UnmarshalFunc(func([]byte, int) error { return nil }) }},
+		{"UnmarshalFromFunc", func() { UnmarshalFromFunc(func(*jsontext.Encoder, *int) error { return nil }) }},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", tt.name)
+				}
+			}()
+			tt.fn()
+		}()
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	var buf bytes.Buffer
+	enc := jsontext.NewEncoder(&buf)
+	for _, v := range []interface{}{1, "a", map[string]int{}} {
+		if err := MarshalEncode(enc, v); err != nil {
+			t.Fatalf("MarshalEncode error: %v", err)
+		}
+	}
+	if want := "1\n\"a\"\n{}\n"; buf.String() != want {
+		t.Errorf("MarshalEncode output = %q, want %q", buf.String(), want)
+	}
+
+	dec := jsontext.NewDecoder(&buf)
+	var got []interface{}
+	for {
+		var v interface{}
+		if err := UnmarshalDecode(dec, &v); err != nil {
+			if err.Error() != "EOF" {
+				t.Fatalf("UnmarshalDecode error: %v", err)
+			}
+			break
+		}
+		got = append(got, v)
+	}
+	if want := []interface{}{1.0, "a", map[string]interface{}{}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalDecode = %v, want %v", got, want)
+	}
+}
+
+func TestParseFieldOptions(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    fieldOptions
+		wantErr bool
+	}{
+		{tag: ``, want: fieldOptions{name: "F"}},
+		{tag: `json:"name,omitzero,omitempty"`, want: fieldOptions{name: "name", hasName: true, omitzero: true, omitempty: true}},
+		{tag: `json:"'\\'quoted,\\''"`, want: fieldOptions{name: "'quoted,'", hasName: true}},
+		{tag: `json:",format:'2006-01-02, Monday',case:ignore"`, want: fieldOptions{name: "F", format: "2006-01-02, Monday", casing: caseIgnore}},
+		{tag: `json:",omitzero,omitzero"`, wantErr: true},
+		{tag: `json:",case:upper"`, wantErr: true},
+		{tag: `json:",format"`, wantErr: true},
+		{tag: `json:"'unterminated"`, wantErr: true},
+		{tag: `json:",inline,unknown"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		sf := reflect.StructField{Name: "F", Type: reflect.TypeOf(0), Tag: reflect.StructTag(tt.tag)}
+		got, _, err := parseFieldOptions(sf)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFieldOptions(%s) error = %v, wantErr %v", tt.tag, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseFieldOptions(%s) = %+v, want %+v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkMarshalStruct(b *testing.B) {
+	v := structAll{Bool: true, String: "s", Int: 1, Map: map[string]int{"k": 1}, Slice: []string{"a", "b"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStruct(b *testing.B) {
+	in := []byte(`{"Bool":true,"String":"s","Int":1,"Map":{"k":1},"Slice":["a","b"]}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v structAll
+		if err := Unmarshal(in, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
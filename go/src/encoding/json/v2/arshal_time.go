@@ -0,0 +1,286 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"encoding/json/internal/jsonopts"
+	"encoding/json/jsontext"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeTimeType     = reflect.TypeOf(time.Time{})
+	timeDurationType = reflect.TypeOf(time.Duration(0))
+)
+
+// timeLayouts maps the names of the layout constants
+// in the time package to their values.
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+}
+
+// unixUnits maps the numeric formats of time.Time and time.Duration
+// to the number of nanoseconds in each unit.
+var unixUnits = map[string]uint64{
+	"unix": 1e9, "unixmilli": 1e6, "unixmicro": 1e3, "unixnano": 1,
+	"sec": 1e9, "milli": 1e6, "micro": 1e3, "nano": 1,
+}
+
+// makeTimeArshaler overrides fncs for the time.Time and time.Duration types,
+// which support the "format" struct field option.
+func makeTimeArshaler(fncs *arshaler, t reflect.Type) *arshaler {
+	switch t {
+	case timeDurationType:
+		return makeDurationArshaler(t)
+	case timeTimeType:
+		return makeTimeTimeArshaler(t)
+	}
+	return fncs
+}
+
+func makeDurationArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		d := time.Duration(va.Int())
+		format := fieldFormat(mo, enc.StackDepth())
+		if format == "" || format == "units" {
+			return enc.WriteToken(jsontext.String(d.String()))
+		}
+		unit, ok := unixUnits[format]
+		if !ok || format[0] == 'u' {
+			return newMarshalError(enc, t, errInvalidFormat)
+		}
+		neg, abs := d < 0, uint64(d)
+		if neg {
+			abs = -abs
+		}
+		b := appendDecimal(nil, neg, abs/unit, abs%unit, unit)
+		if mo.Get(jsonopts.StringifyNumbers) {
+			return enc.WriteToken(jsontext.String(string(b)))
+		}
+		return enc.WriteValue(b)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		format := fieldFormat(uo, dec.StackDepth())
+		if format == "" || format == "units" {
+			k, err := peekKind(dec)
+			switch k {
+			case 0:
+				return err
+			case 'n':
+				return unmarshalNull(dec, va)
+			case '"':
+				tok, err := dec.ReadToken()
+				if err != nil {
+					return err
+				}
+				d, err := time.ParseDuration(tok.String())
+				if err != nil {
+					return newUnmarshalError(dec, k, t, err)
+				}
+				va.SetInt(int64(d))
+				return nil
+			}
+			return skipMismatch(dec, k, t)
+		}
+		unit, ok := unixUnits[format]
+		if !ok || format[0] == 'u' {
+			if err := dec.SkipValue(); err != nil {
+				return err
+			}
+			return newUnmarshalError(dec, 0, t, errInvalidFormat)
+		}
+		k, b, err := readNumber(dec, uo, t)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return unmarshalNull(dec, va)
+		}
+		neg, whole, frac, ok := parseDecimal(b, unit)
+		if !ok || whole > math.MaxInt64/unit {
+			return newUnmarshalError(dec, k, t, errOutOfRange)
+		}
+		abs := whole*unit + frac
+		if !neg && abs > math.MaxInt64 || neg && abs > -math.MinInt64 {
+			return newUnmarshalError(dec, k, t, errOutOfRange)
+		}
+		if neg {
+			va.SetInt(-int64(abs))
+		} else {
+			va.SetInt(int64(abs))
+		}
+		return nil
+	}
+	return &fncs
+}
+
+func makeTimeTimeArshaler(t reflect.Type) *arshaler {
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		tt := va.Interface().(time.Time)
+		format := fieldFormat(mo, enc.StackDepth())
+		if unit, ok := unixUnits[format]; ok && format[0] == 'u' {
+			// Express the time as a signed number of units since the epoch.
+			sec, nsec := tt.Unix(), uint64(tt.Nanosecond())
+			neg := sec < 0
+			if neg && nsec > 0 {
+				sec, nsec = sec+1, 1e9-nsec
+			}
+			abs := uint64(sec)
+			if neg {
+				abs = -abs
+			}
+			perSec := 1e9 / unit
+			b := appendDecimal(nil, neg, abs*perSec+nsec/unit, nsec%unit, unit)
+			if mo.Get(jsonopts.StringifyNumbers) {
+				return enc.WriteToken(jsontext.String(string(b)))
+			}
+			return enc.WriteValue(b)
+		}
+		layout, err := timeLayout(format)
+		if err != nil {
+			return newMarshalError(enc, t, err)
+		}
+		return enc.WriteToken(jsontext.String(tt.Format(layout)))
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		format := fieldFormat(uo, dec.StackDepth())
+		if unit, ok := unixUnits[format]; ok && format[0] == 'u' {
+			k, b, err := readNumber(dec, uo, t)
+			if err != nil {
+				return err
+			}
+			if b == nil {
+				return unmarshalNull(dec, va)
+			}
+			neg, whole, frac, ok := parseDecimal(b, unit)
+			perSec := 1e9 / unit
+			if !ok || whole/perSec > math.MaxInt64 {
+				return newUnmarshalError(dec, k, t, errOutOfRange)
+			}
+			sec, nsec := int64(whole/perSec), int64(whole%perSec*unit+frac)
+			if neg {
+				sec, nsec = -sec, -nsec
+			}
+			va.Set(reflect.ValueOf(time.Unix(sec, nsec).UTC()))
+			return nil
+		}
+		layout, err := timeLayout(format)
+		if err != nil {
+			if err := dec.SkipValue(); err != nil {
+				return err
+			}
+			return newUnmarshalError(dec, 0, t, err)
+		}
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '"':
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return err
+			}
+			tt, err := time.Parse(layout, tok.String())
+			if err != nil {
+				return newUnmarshalError(dec, k, t, err)
+			}
+			va.Set(reflect.ValueOf(tt))
+			return nil
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+// timeLayout returns the time layout for a format, which may be
+// empty for the default, the name of a time package constant,
+// or a literal layout.
+func timeLayout(format string) (string, error) {
+	switch {
+	case format == "":
+		return time.RFC3339Nano, nil
+	case timeLayouts[format] != "":
+		return timeLayouts[format], nil
+	case unixUnits[format] != 0:
+		return "", errInvalidFormat
+	}
+	// Reject formats without any layout elements, which are likely
+	// to be misspelled names rather than literal layouts.
+	t := time.Date(1, 2, 3, 4, 5, 6, 7, time.UTC)
+	if t.Format(format) == format {
+		return "", errInvalidFormat
+	}
+	return format, nil
+}
+
+// appendDecimal appends the decimal number whole.frac, where frac
+// is a fraction of unit, a power of ten. Trailing zeros are omitted.
+func appendDecimal(b []byte, neg bool, whole, frac, unit uint64) []byte {
+	if neg {
+		b = append(b, '-')
+	}
+	b = strconv.AppendUint(b, whole, 10)
+	if frac > 0 {
+		b = append(b, '.')
+		for unit /= 10; unit > 0 && frac > 0; unit /= 10 {
+			b = append(b, byte('0'+frac/unit))
+			frac %= unit
+		}
+	}
+	return b
+}
+
+// parseDecimal parses a JSON number as whole.frac, where frac is
+// a fraction of unit, a power of ten. Digits beyond the precision of unit
+// are truncated. It reports false for exponents or out of range values.
+func parseDecimal(b []byte, unit uint64) (neg bool, whole, frac uint64, ok bool) {
+	if len(b) > 0 && b[0] == '-' {
+		neg, b = true, b[1:]
+	}
+	i := 0
+	for i < len(b) && b[i] != '.' {
+		i++
+	}
+	whole, ok = parseDecUint(b[:i])
+	if !ok {
+		return false, 0, 0, false
+	}
+	if i < len(b) {
+		digits := b[i+1:]
+		if len(digits) == 0 {
+			return false, 0, 0, false
+		}
+		for _, c := range digits {
+			if c < '0' || c > '9' {
+				return false, 0, 0, false
+			}
+			if unit /= 10; unit > 0 {
+				frac += uint64(c-'0') * unit
+			}
+		}
+	}
+	return neg, whole, frac, true
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package json implements semantic processing of JSON as specified in RFC 8259.
+// JSON is a simple data interchange format that can represent
+// primitive data types such as booleans, strings, and numbers,
+// in addition to structured data types such as objects and arrays.
+//
+// It is built on top of encoding/json/jsontext, which handles the syntax,
+// and is configured with options rather than with methods on the
+// Go types being serialized. The Marshal and Unmarshal functions
+// and their streaming variants each take a variadic list of options,
+// which may also include the options of the jsontext package.
+//
+// Marshaling
+//
+// Marshal encodes Go values as JSON according to the following rules,
+// applied in order:
+//
+//   - If the value's type has a marshal function registered with
+//     WithMarshalers, that function is used.
+//   - If the type implements MarshalerTo, Marshaler, or
+//     encoding.TextMarshaler, that method is used, in that order.
+//   - Otherwise, the value is encoded according to its kind:
+//     booleans, strings, and numbers as their JSON counterparts;
+//     maps as objects; structs as objects of their fields;
+//     slices and arrays as arrays, except that []byte and [N]byte
+//     are encoded as base64 strings; pointers and interfaces as the
+//     value they refer to, or null if nil.
+//
+// A nil slice or map is encoded as an empty array or object unless
+// FormatNilSliceAsNull or FormatNilMapAsNull is specified.
+//
+// Unmarshaling
+//
+// Unmarshal decodes JSON into Go values following the same rules.
+// A JSON null resets the Go value to its zero value.
+// Object member names are matched to struct fields case-sensitively
+// unless MatchCaseInsensitiveNames or the "case:ignore" field option
+// is specified, and unknown members are ignored unless
+// RejectUnknownMembers is specified or the struct has a field
+// with the "unknown" option to capture them.
+// By default, JSON objects with duplicate member names and strings with
+// invalid UTF-8 are rejected (see jsontext.AllowDuplicateNames and
+// jsontext.AllowInvalidUTF8).
+//
+// Struct tags
+//
+// The encoding of each exported struct field can be customized with the
+// "json" key in the field's tag. The tag gives the JSON name of the field,
+// optionally followed by a comma-separated list of options.
+// The name may be single-quoted to contain commas or quotes.
+// A name of "-" omits the field entirely. The options are:
+//
+//   - omitzero: omit the field when marshaling if the value is zero,
+//     as reported by an IsZero() bool method or by reflect.Value.IsZero.
+//   - omitempty: omit the field when marshaling if the value is a nil
+//     pointer or interface, or an empty string, slice, map, or array.
+//   - string: encode numbers within the field value as JSON strings
+//     (see StringifyNumbers).
+//   - case:ignore or case:strict: whether the field name is matched
+//     case-insensitively when unmarshaling, overriding
+//     MatchCaseInsensitiveNames for the field.
+//   - inline: inline the members of a struct (or pointer to struct)
+//     field into the parent object. Embedded structs without a
+//     JSON name are inlined implicitly.
+//   - unknown: like inline, but for a field of type jsontext.Value or
+//     map[string]T, which holds the members of the object that do
+//     not match any other field.
+//   - format: a format for the field value, such as
+//     format:base64 for []byte or format:RFC1123 for time.Time.
+//     The value may be single-quoted.
+//
+// Unrecognized options are reported as errors.
+//
+// The supported formats are base64, base64url, base32, base32hex, base16,
+// hex, and array for []byte and [N]byte; nonfinite for floating-point
+// values (allowing "NaN", "Infinity", and "-Infinity");
+// the time package layout constant names (e.g., RFC3339),
+// a literal layout, unix, unixmilli, unixmicro, and unixnano for time.Time;
+// and sec, milli, micro, nano, and units for time.Duration.
+package json
@@ -0,0 +1,169 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"encoding/json/jsontext"
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+const errorPrefix = "json: "
+
+// ErrUnknownName indicates that a JSON object member could not be
+// unmarshaled because the name is not known to the target Go struct.
+// This error is directly wrapped within a SemanticError when produced.
+//
+// The name of an unknown JSON object member can be extracted as:
+//
+//	err := ...
+//	var serr *json.SemanticError
+//	if errors.As(err, &serr) && serr.Err == json.ErrUnknownName {
+//		ptr := serr.JSONPointer // JSON pointer to unknown name
+//		name := ptr.LastToken() // unknown name itself
+//		...
+//	}
+//
+// This error is only returned if RejectUnknownMembers is true.
+var ErrUnknownName = errors.New("unknown object member name")
+
+// SemanticError describes an error determining the meaning
+// of JSON data as Go data or vice-versa.
+//
+// The contents of this error as produced by this package may change over time.
+type SemanticError struct {
+	action string // either "marshal" or "unmarshal"
+
+	// ByteOffset indicates that an error occurred after this byte offset.
+	ByteOffset int64
+	// JSONPointer indicates that an error occurred within this JSON value
+	// as indicated using the JSON Pointer notation (see RFC 6901).
+	JSONPointer jsontext.Pointer
+
+	// JSONKind is the JSON kind that could not be handled.
+	JSONKind jsontext.Kind // may be zero if unknown
+	// GoType is the Go type that could not be handled.
+	GoType reflect.Type // may be nil if unknown
+
+	// Err is the underlying error.
+	Err error // may be nil
+}
+
+func (e *SemanticError) Error() string {
+	b := []byte(errorPrefix + "cannot")
+	switch e.action {
+	case "marshal":
+		b = append(b, " marshal"...)
+		if e.GoType != nil {
+			b = append(b, " from Go "...)
+			b = append(b, e.GoType.String()...)
+		}
+		if e.JSONKind != 0 {
+			b = append(b, " into JSON "...)
+			b = append(b, kindName(e.JSONKind)...)
+		}
+	case "unmarshal":
+		b = append(b, " unmarshal"...)
+		if e.JSONKind != 0 {
+			b = append(b, " JSON "...)
+			b = append(b, kindName(e.JSONKind)...)
+		}
+		if e.GoType != nil {
+			b = append(b, " into Go "...)
+			b = append(b, e.GoType.String()...)
+		}
+	default:
+		b = append(b, " handle"...)
+		if e.GoType != nil {
+			b = append(b, " Go "...)
+			b = append(b, e.GoType.String()...)
+		}
+	}
+	if e.Err == ErrUnknownName {
+		b = append(b, ": "...)
+		b = append(b, e.Err.Error()...)
+		b = strconv.AppendQuote(append(b, ' '), e.JSONPointer.LastToken())
+		if parent := e.JSONPointer.Parent(); parent != "" {
+			b = strconv.AppendQuote(append(b, " within "...), string(parent))
+		}
+		return string(b)
+	}
+	if e.JSONPointer != "" {
+		b = strconv.AppendQuote(append(b, " within "...), string(e.JSONPointer))
+	}
+	if e.Err != nil {
+		b = append(b, ": "...)
+		b = append(b, e.Err.Error()...)
+	}
+	return string(b)
+}
+
+func (e *SemanticError) Unwrap() error {
+	return e.Err
+}
+
+// kindName returns a description of the JSON kind k.
+func kindName(k jsontext.Kind) string {
+	switch k {
+	case 'n':
+		return "null"
+	case 'f', 't':
+		return "boolean"
+	case '"':
+		return "string"
+	case '0':
+		return "number"
+	case '{', '}':
+		return "object"
+	case '[', ']':
+		return "array"
+	default:
+		return "<invalid kind " + strconv.Quote(string(k)) + ">"
+	}
+}
+
+// newMarshalError returns a SemanticError for a failure to marshal
+// a value of type t at the current position of enc.
+func newMarshalError(enc *jsontext.Encoder, t reflect.Type, err error) error {
+	// The stack pointer refers to the last value written,
+	// while the error is for the next value. These only differ
+	// within a JSON array, since object names are already written.
+	ptr := enc.StackPointer()
+	if k, n := enc.StackIndex(enc.StackDepth()); k == '[' {
+		if n > 0 {
+			ptr = ptr.Parent()
+		}
+		ptr = ptr.AppendToken(strconv.FormatInt(n, 10))
+	}
+	return &SemanticError{
+		action:      "marshal",
+		ByteOffset:  enc.OutputOffset(),
+		JSONPointer: ptr,
+		GoType:      t,
+		Err:         err,
+	}
+}
+
+// newUnmarshalError returns a SemanticError for a failure to unmarshal
+// a JSON value of kind k into type t at the current position of dec.
+func newUnmarshalError(dec *jsontext.Decoder, k jsontext.Kind, t reflect.Type, err error) error {
+	return &SemanticError{
+		action:      "unmarshal",
+		ByteOffset:  dec.InputOffset(),
+		JSONPointer: dec.StackPointer(),
+		JSONKind:    k,
+		GoType:      t,
+		Err:         err,
+	}
+}
+
+var (
+	errUnsupportedType = errors.New("unsupported type")
+	errNilReference    = errors.New("value must be passed as a non-nil pointer reference")
+	errArrayLength     = errors.New("mismatching array length")
+	errNonFinite       = errors.New("unsupported non-finite value")
+	errOutOfRange      = errors.New("value out of range")
+)
@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Unknown members of a JSON object can be preserved by a field
+// with the "unknown" option, or rejected with RejectUnknownMembers.
+func Example_unknownMembers() {
+	type Config struct {
+		Name    string
+		Unknown jsontext.Value `json:",unknown"`
+	}
+	input := []byte(`{"Name":"app","Debug":true,"Port":8080}`)
+
+	var c Config
+	if err := json.Unmarshal(input, &c); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(c.Unknown))
+
+	// Unknown members are written back when marshaling.
+	b, err := json.Marshal(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+
+	err = json.Unmarshal(input, new(Config), json.RejectUnknownMembers(true))
+	var serr *json.SemanticError
+	if errors.As(err, &serr) && serr.Err == json.ErrUnknownName {
+		fmt.Println("unknown member:", serr.JSONPointer.LastToken())
+	}
+
+	// Output:
+	// {"Debug":true,"Port":8080}
+	// {"Name":"app","Debug":true,"Port":8080}
+	// unknown member: Debug
+}
+
+// The representation of specific types can be changed with options,
+// without declaring methods on those types.
+func Example_customMarshalers() {
+	// Marshal booleans as "yes" or "no", and unmarshal
+	// integers from either JSON numbers or quoted numbers.
+	marshalers := json.MarshalFunc(func(b bool) ([]byte, error) {
+		if b {
+			return []byte(`"yes"`), nil
+		}
+		return []byte(`"no"`), nil
+	})
+	unmarshalers := json.UnmarshalFromFunc(func(dec *jsontext.Decoder, n *int) error {
+		if dec.PeekKind() != '"' {
+			return json.SkipFunc
+		}
+		tok, err := dec.ReadToken()
+		if err != nil {
+			return err
+		}
+		*n, err = strconv.Atoi(tok.String())
+		return err
+	})
+
+	b, err := json.Marshal(map[string]bool{"enabled": true}, json.WithMarshalers(marshalers))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+
+	var ns []int
+	if err := json.Unmarshal([]byte(`[1, "2", 3]`), &ns, json.WithUnmarshalers(unmarshalers)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(ns)
+
+	// Output:
+	// {"enabled":"yes"}
+	// [1 2 3]
+}
+
+// The "format" option controls the representation
+// of times, durations, and binary data.
+func Example_formats() {
+	type Event struct {
+		Time    time.Time     `json:",format:unix"`
+		Date    time.Time     `json:",format:'2006-01-02'"`
+		Timeout time.Duration `json:",format:milli"`
+		Payload []byte        `json:",format:hex"`
+	}
+	t := time.Date(2021, 8, 1, 12, 0, 0, 500000000, time.UTC)
+	b, err := json.Marshal(Event{t, t, 1500 * time.Microsecond, []byte("hi")})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+
+	// Output:
+	// {"Time":1627819200.5,"Date":"2021-08-01","Timeout":1.5,"Payload":"6869"}
+}
@@ -0,0 +1,716 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json/internal/jsonopts"
+	"encoding/json/jsontext"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var jsontextValueType = reflect.TypeOf(jsontext.Value(nil))
+
+const (
+	caseDefault = iota
+	caseIgnore
+	caseStrict
+)
+
+// structField is a Go struct field, possibly promoted
+// from an inlined struct, that is a member of a JSON object.
+type structField struct {
+	name      string // JSON object name
+	nameFold  string // folded name, see foldName
+	index     []int  // index sequence for reflect.Value.FieldByIndex
+	typ       reflect.Type
+	tag       bool // whether the name came from the tag
+	omitzero  bool
+	omitempty bool
+	string    bool
+	casing    int
+	format    string
+}
+
+// structFields is the set of fields of a Go struct type.
+type structFields struct {
+	flattened       []structField // in the order of the Go struct
+	byActualName    map[string]*structField
+	byFoldedName    map[string][]*structField
+	inlinedFallback *structField // the "unknown" field, if any
+}
+
+// lookup returns the field for the JSON object name,
+// or nil if there is no such field.
+func (fs *structFields) lookup(name string, uo *jsonopts.Struct) *structField {
+	if f := fs.byActualName[name]; f != nil {
+		return f
+	}
+	for _, f := range fs.byFoldedName[foldName(name)] {
+		switch f.casing {
+		case caseIgnore:
+			return f
+		case caseDefault:
+			if uo.Get(jsonopts.MatchCaseInsensitiveNames) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// foldName returns a folded form of name for case-insensitive matching,
+// which is lower case with all '-' and '_' characters removed.
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// fieldOptions is the parsed form of a "json" struct tag.
+type fieldOptions struct {
+	name      string
+	hasName   bool
+	omitzero  bool
+	omitempty bool
+	string    bool
+	inline    bool
+	unknown   bool
+	casing    int
+	format    string
+}
+
+// parseFieldOptions parses the "json" tag of sf.
+// It reports ignored if the field is not serialized.
+func parseFieldOptions(sf reflect.StructField) (out fieldOptions, ignored bool, err error) {
+	tag, hasTag := sf.Tag.Lookup("json")
+	if tag == "-" {
+		return out, true, nil
+	}
+	if !sf.Anonymous && sf.PkgPath != "" {
+		// Ignore unexported fields, unless they are explicitly
+		// tagged, which is almost certainly a mistake.
+		if hasTag {
+			return out, true, errors.New("unexported Go struct field " + sf.Name + " cannot have non-ignored `json:" + quoteTag(tag) + "` tag")
+		}
+		return out, true, nil
+	}
+
+	out.name = sf.Name
+	if len(tag) > 0 && tag[0] != ',' {
+		name, rest, err := consumeTagValue(tag)
+		if err != nil {
+			return out, false, errors.New("Go struct field " + sf.Name + " has malformed `json` tag: " + err.Error())
+		}
+		if !utf8.ValidString(name) {
+			return out, false, errors.New("Go struct field " + sf.Name + " has JSON object name with invalid UTF-8")
+		}
+		out.name, out.hasName, tag = name, true, rest
+	}
+
+	seen := make(map[string]bool)
+	for len(tag) > 0 {
+		if tag[0] != ',' {
+			return out, false, errors.New("Go struct field " + sf.Name + " has malformed `json` tag: invalid character " + quoteTag(tag[:1]))
+		}
+		tag = tag[1:]
+		n := strings.IndexAny(tag, ",:")
+		if n < 0 {
+			n = len(tag)
+		}
+		opt := tag[:n]
+		tag = tag[n:]
+		if seen[opt] {
+			return out, false, errors.New("Go struct field " + sf.Name + " has duplicate appearance of `" + opt + "` tag option")
+		}
+		seen[opt] = true
+		switch opt {
+		case "omitzero":
+			out.omitzero = true
+		case "omitempty":
+			out.omitempty = true
+		case "string":
+			out.string = true
+		case "inline":
+			out.inline = true
+		case "unknown":
+			out.unknown = true
+		case "case", "format":
+			if len(tag) == 0 || tag[0] != ':' {
+				return out, false, errors.New("Go struct field " + sf.Name + " is missing value for `" + opt + "` tag option")
+			}
+			val, rest, err := consumeTagValue(tag[1:])
+			if err != nil {
+				return out, false, errors.New("Go struct field " + sf.Name + " has malformed value for `" + opt + "` tag option: " + err.Error())
+			}
+			tag = rest
+			if opt == "format" {
+				out.format = val
+				break
+			}
+			switch val {
+			case "ignore":
+				out.casing = caseIgnore
+			case "strict":
+				out.casing = caseStrict
+			default:
+				return out, false, errors.New("Go struct field " + sf.Name + " has unknown `case:" + val + "` tag value")
+			}
+		default:
+			return out, false, errors.New("Go struct field " + sf.Name + " has unknown `" + opt + "` tag option")
+		}
+	}
+	if out.inline && out.unknown {
+		return out, false, errors.New("Go struct field " + sf.Name + " cannot have both `inline` and `unknown` tag options")
+	}
+	return out, false, nil
+}
+
+// consumeTagValue consumes a name or option value from the start of tag,
+// which is either single-quoted or ends at the next comma.
+// Within single quotes, a backslash escapes the next character.
+func consumeTagValue(tag string) (val, rest string, err error) {
+	if len(tag) == 0 || tag[0] != '\'' {
+		n := strings.IndexByte(tag, ',')
+		if n < 0 {
+			n = len(tag)
+		}
+		if strings.ContainsAny(tag[:n], "'\\") {
+			return "", "", errors.New("unquoted value " + quoteTag(tag[:n]) + " contains a quote or backslash")
+		}
+		return tag[:n], tag[n:], nil
+	}
+	var b []byte
+	for i := 1; i < len(tag); i++ {
+		switch c := tag[i]; c {
+		case '\'':
+			return string(b), tag[i+1:], nil
+		case '\\':
+			if i++; i == len(tag) {
+				break
+			}
+			b = append(b, tag[i])
+		default:
+			b = append(b, c)
+		}
+	}
+	return "", "", errors.New("unterminated single-quoted value")
+}
+
+// quoteTag quotes s as it would appear in a struct tag.
+func quoteTag(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
+}
+
+// makeStructFields computes the fields of struct type t,
+// following the same dominance rules as Go for embedded fields,
+// except that the JSON name of a field rather than the Go name is used.
+func makeStructFields(t reflect.Type) (structFields, error) {
+	type queueEntry struct {
+		typ   reflect.Type
+		index []int
+	}
+	var (
+		current  []queueEntry
+		next     = []queueEntry{{typ: t}}
+		visited  = map[reflect.Type]bool{}
+		fields   []structField
+		count    = map[reflect.Type]int{}
+		fallback []structField
+	)
+	// This mirrors the breadth-first search of encoding/json:
+	// fields at shallower depths dominate those at deeper depths.
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		nextCount := map[reflect.Type]int{}
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+			visited[f.typ] = true
+			for i := 0; i < f.typ.NumField(); i++ {
+				sf := f.typ.Field(i)
+				opts, ignored, err := parseFieldOptions(sf)
+				if err != nil {
+					return structFields{}, err
+				}
+				if ignored {
+					continue
+				}
+				index := make([]int, len(f.index)+1)
+				copy(index, f.index)
+				index[len(f.index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if opts.unknown || opts.inline && ft.Kind() != reflect.Struct {
+					if ft != sf.Type && ft.Kind() != reflect.Struct {
+						return structFields{}, errors.New("inlined Go struct field " + sf.Name + " of type " + sf.Type.String() + " must not be a pointer")
+					}
+					if ft != jsontextValueType && (ft.Kind() != reflect.Map || ft.Key().Kind() != reflect.String) {
+						return structFields{}, errors.New("inlined Go struct field " + sf.Name + " of type " + sf.Type.String() + " must be a Go struct, Go map of string key, or jsontext.Value")
+					}
+					fallback = append(fallback, structField{name: sf.Name, index: index, typ: ft})
+					continue
+				}
+				if sf.Anonymous && !opts.hasName && ft.Kind() == reflect.Struct || opts.inline {
+					if sf.Anonymous && sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+					// Record the inlined struct to be explored at the next depth,
+					// unless it is the same type visited multiple times,
+					// in which case it is annihilated.
+					nextCount[ft]++
+					if nextCount[ft] == 1 {
+						next = append(next, queueEntry{typ: ft, index: index})
+					}
+					continue
+				}
+				if sf.PkgPath != "" {
+					// Embedded non-struct unexported fields are ignored.
+					continue
+				}
+				if opts.format != "" && !supportsFormat(ft) {
+					return structFields{}, errors.New("Go struct field " + sf.Name + " of type " + sf.Type.String() + " does not support `format` tag option")
+				}
+				fields = append(fields, structField{
+					name:      opts.name,
+					nameFold:  foldName(opts.name),
+					index:     index,
+					typ:       sf.Type,
+					tag:       opts.hasName,
+					omitzero:  opts.omitzero,
+					omitempty: opts.omitempty,
+					string:    opts.string,
+					casing:    opts.casing,
+					format:    opts.format,
+				})
+				if count[f.typ] > 1 {
+					// If there were multiple instances, add a second,
+					// so that the annihilation code will see a duplicate.
+					fields = append(fields, fields[len(fields)-1])
+				}
+			}
+		}
+		count = nextCount
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		x := fields
+		if x[i].name != x[j].name {
+			return x[i].name < x[j].name
+		}
+		if len(x[i].index) != len(x[j].index) {
+			return len(x[i].index) < len(x[j].index)
+		}
+		if x[i].tag != x[j].tag {
+			return x[i].tag
+		}
+		return indexLess(x[i].index, x[j].index)
+	})
+
+	// Delete all fields that are hidden by the Go rules for embedded fields,
+	// except that fields with JSON tags are promoted.
+	out := fields[:0]
+	for advance, i := 0, 0; i < len(fields); i += advance {
+		fi := fields[i]
+		for advance = 1; i+advance < len(fields); advance++ {
+			if fields[i+advance].name != fi.name {
+				break
+			}
+		}
+		if advance == 1 {
+			out = append(out, fi)
+			continue
+		}
+		if dominant, ok := dominantField(fields[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+	fields = out
+	sort.Slice(fields, func(i, j int) bool { return indexLess(fields[i].index, fields[j].index) })
+
+	fs := structFields{
+		flattened:    fields,
+		byActualName: make(map[string]*structField, len(fields)),
+		byFoldedName: make(map[string][]*structField, len(fields)),
+	}
+	for i := range fs.flattened {
+		f := &fs.flattened[i]
+		fs.byActualName[f.name] = f
+		fs.byFoldedName[f.nameFold] = append(fs.byFoldedName[f.nameFold], f)
+	}
+
+	if len(fallback) > 0 {
+		// As with other fields, the shallowest fallback dominates,
+		// but multiple fallbacks at the same depth are an error.
+		sort.Slice(fallback, func(i, j int) bool { return len(fallback[i].index) < len(fallback[j].index) })
+		if len(fallback) > 1 && len(fallback[0].index) == len(fallback[1].index) {
+			return structFields{}, errors.New("Go struct type " + t.String() + " has multiple `unknown` fields")
+		}
+		fs.inlinedFallback = &fallback[0]
+	}
+	return fs, nil
+}
+
+// indexLess reports whether the index sequence x sorts before y.
+func indexLess(x, y []int) bool {
+	for i, xi := range x {
+		if i >= len(y) {
+			return false
+		}
+		if xi != y[i] {
+			return xi < y[i]
+		}
+	}
+	return len(x) < len(y)
+}
+
+// dominantField looks through the fields, all of which are known to
+// have the same name, to find the single field that dominates the
+// others using Go's embedding rules, modified by the presence of
+// JSON tags. If there are multiple top-level fields, the boolean
+// will be false: This condition is an error in Go and we skip all
+// the fields.
+func dominantField(fields []structField) (structField, bool) {
+	// The fields are sorted in increasing index-length order, then by presence of tag.
+	// That means that the first field is the dominant one. We need only check
+	// for error cases: two fields at top level, either both tagged or neither tagged.
+	if len(fields) > 1 && len(fields[0].index) == len(fields[1].index) && fields[0].tag == fields[1].tag {
+		return structField{}, false
+	}
+	return fields[0], true
+}
+
+// supportsFormat reports whether values of type t
+// may have the "format" struct field option.
+func supportsFormat(t reflect.Type) bool {
+	switch {
+	case t == timeTimeType || t == timeDurationType:
+		return true
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return true
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && isByteType(t.Elem()):
+		return true
+	}
+	return false
+}
+
+// fieldByIndex returns the field of va at the index sequence,
+// dereferencing any pointers to inlined structs. If a pointer is nil,
+// it is allocated if alloc is set, otherwise the invalid Value is returned.
+func fieldByIndex(va reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && va.Kind() == reflect.Ptr {
+			if va.IsNil() {
+				if !alloc || !va.CanSet() {
+					return reflect.Value{}
+				}
+				va.Set(reflect.New(va.Type().Elem()))
+			}
+			va = va.Elem()
+		}
+		va = va.Field(x)
+	}
+	return va
+}
+
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// isZero reports whether the addressable value va is zero,
+// as reported by an IsZero method if there is one.
+func isZero(va reflect.Value) bool {
+	switch ok, needAddr := implements(va.Type(), isZeroerType); {
+	case !ok:
+		return va.IsZero()
+	case va.Kind() == reflect.Ptr && va.IsNil():
+		return true
+	case va.Kind() == reflect.Interface && va.IsNil():
+		return true
+	default:
+		return methodReceiver(va, needAddr).Interface().(isZeroer).IsZero()
+	}
+}
+
+// isEmpty reports whether va is an empty JSON value:
+// a nil pointer or interface, or an empty string, slice, map, or array.
+func isEmpty(va reflect.Value) bool {
+	switch va.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return va.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return va.IsNil()
+	}
+	return false
+}
+
+func makeStructArshaler(t reflect.Type) *arshaler {
+	var (
+		once    sync.Once
+		fields  structFields
+		errInit error
+	)
+	// The fields are computed lazily since a struct type
+	// may recursively refer to itself.
+	init := func() {
+		fields, errInit = makeStructFields(t)
+	}
+	var fncs arshaler
+	fncs.marshal = func(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct) error {
+		once.Do(init)
+		if errInit != nil {
+			return newMarshalError(enc, t, errInit)
+		}
+		if err := enc.WriteToken(jsontext.ObjectStart); err != nil {
+			return err
+		}
+		for i := range fields.flattened {
+			f := &fields.flattened[i]
+			v := fieldByIndex(va, f.index, false)
+			if !v.IsValid() {
+				continue // inlined through a nil pointer
+			}
+			if (f.omitzero || mo.Get(jsonopts.OmitZeroStructFields)) && isZero(v) {
+				continue
+			}
+			if f.omitempty && isEmpty(v) {
+				continue
+			}
+			if err := enc.WriteToken(jsontext.String(f.name)); err != nil {
+				return err
+			}
+			if err := marshalField(enc, v, mo, f); err != nil {
+				return err
+			}
+		}
+		if fields.inlinedFallback != nil {
+			if err := marshalInlinedFallback(enc, va, mo, fields.inlinedFallback); err != nil {
+				return err
+			}
+		}
+		return enc.WriteToken(jsontext.ObjectEnd)
+	}
+	fncs.unmarshal = func(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct) error {
+		k, err := peekKind(dec)
+		switch k {
+		case 0:
+			return err
+		case 'n':
+			return unmarshalNull(dec, va)
+		case '{':
+			once.Do(init)
+			if errInit != nil {
+				if err := dec.SkipValue(); err != nil {
+					return err
+				}
+				return newUnmarshalError(dec, k, t, errInit)
+			}
+			if _, err := dec.ReadToken(); err != nil {
+				return err
+			}
+			for dec.PeekKind() != '}' {
+				tok, err := dec.ReadToken()
+				if err != nil {
+					return err
+				}
+				name := tok.String()
+				f := fields.lookup(name, uo)
+				if f == nil {
+					if uo.Get(jsonopts.RejectUnknownMembers) {
+						return newUnmarshalError(dec, 0, t, ErrUnknownName)
+					}
+					if fields.inlinedFallback != nil {
+						if err := unmarshalInlinedFallback(dec, va, uo, fields.inlinedFallback, name); err != nil {
+							return err
+						}
+						continue
+					}
+					if err := dec.SkipValue(); err != nil {
+						return err
+					}
+					continue
+				}
+				v := fieldByIndex(va, f.index, true)
+				if !v.IsValid() {
+					if err := dec.SkipValue(); err != nil {
+						return err
+					}
+					return newUnmarshalError(dec, 0, t, errors.New("cannot set embedded pointer to unexported struct type"))
+				}
+				if err := unmarshalField(dec, v, uo, f); err != nil {
+					return err
+				}
+			}
+			_, err := dec.ReadToken()
+			return err
+		}
+		return skipMismatch(dec, k, t)
+	}
+	return &fncs
+}
+
+// marshalField marshals a struct field value, applying the
+// "string" and "format" field options to the value.
+func marshalField(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct, f *structField) error {
+	if !f.string && f.format == "" {
+		return marshalValue(enc, va, mo)
+	}
+	saved := *mo
+	if f.string {
+		mo.Flags |= jsonopts.StringifyNumbers
+	}
+	if f.format != "" {
+		mo.Format, mo.FormatDepth = f.format, enc.StackDepth()
+	}
+	err := marshalValue(enc, va, mo)
+	*mo = saved
+	return err
+}
+
+// unmarshalField unmarshals a struct field value, applying the
+// "string" and "format" field options to the value.
+func unmarshalField(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct, f *structField) error {
+	if !f.string && f.format == "" {
+		return unmarshalValue(dec, va, uo)
+	}
+	saved := *uo
+	if f.string {
+		uo.Flags |= jsonopts.StringifyNumbers
+	}
+	if f.format != "" {
+		uo.Format, uo.FormatDepth = f.format, dec.StackDepth()
+	}
+	err := unmarshalValue(dec, va, uo)
+	*uo = saved
+	return err
+}
+
+// marshalInlinedFallback marshals the members held by the "unknown" field
+// of a struct as members of the enclosing JSON object.
+func marshalInlinedFallback(enc *jsontext.Encoder, va reflect.Value, mo *jsonopts.Struct, f *structField) error {
+	v := fieldByIndex(va, f.index, false)
+	if !v.IsValid() {
+		return nil
+	}
+	if f.typ == jsontextValueType {
+		b := v.Interface().(jsontext.Value)
+		if len(bytes.TrimSpace(b)) == 0 || b.Kind() == 'n' {
+			return nil
+		}
+		dec := jsontext.NewDecoder(bytes.NewReader(b))
+		tok, err := dec.ReadToken()
+		if err != nil || tok.Kind() != '{' {
+			return newMarshalError(enc, f.typ, errors.New("inlined raw value must be a JSON object"))
+		}
+		for dec.PeekKind() != '}' {
+			name, err := dec.ReadToken()
+			if err != nil {
+				return newMarshalError(enc, f.typ, err)
+			}
+			if err := enc.WriteToken(name); err != nil {
+				return err
+			}
+			val, err := dec.ReadValue()
+			if err != nil {
+				return newMarshalError(enc, f.typ, err)
+			}
+			if err := enc.WriteValue(val); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.ReadToken(); err != nil {
+			return newMarshalError(enc, f.typ, err)
+		}
+		return nil
+	}
+
+	if v.Len() == 0 {
+		return nil
+	}
+	names := make([]string, 0, v.Len())
+	for iter := v.MapRange(); iter.Next(); {
+		names = append(names, iter.Key().String())
+	}
+	if mo.Get(jsonopts.Deterministic) {
+		sort.Strings(names)
+	}
+	val := reflect.New(f.typ.Elem()).Elem()
+	for _, name := range names {
+		if err := enc.WriteToken(jsontext.String(name)); err != nil {
+			return err
+		}
+		val.Set(v.MapIndex(reflect.ValueOf(name).Convert(f.typ.Key())))
+		if err := marshalValue(enc, val, mo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalInlinedFallback unmarshals the value of an unknown member
+// into the "unknown" field of a struct.
+func unmarshalInlinedFallback(dec *jsontext.Decoder, va reflect.Value, uo *jsonopts.Struct, f *structField, name string) error {
+	v := fieldByIndex(va, f.index, true)
+	if !v.IsValid() {
+		if err := dec.SkipValue(); err != nil {
+			return err
+		}
+		return newUnmarshalError(dec, 0, f.typ, errors.New("cannot set embedded pointer to unexported struct type"))
+	}
+	if f.typ == jsontextValueType {
+		val, err := dec.ReadValue()
+		if err != nil {
+			return err
+		}
+		raw := v.Addr().Interface().(*jsontext.Value)
+		b := bytes.TrimRight(*raw, " \t\r\n")
+		if len(b) == 0 || raw.Kind() == 'n' {
+			b = append(b[:0], '{')
+		} else {
+			b = bytes.TrimRight(b[:len(b)-1], " \t\r\n") // trim '}'
+			if b[len(b)-1] != '{' {
+				b = append(b, ',')
+			}
+		}
+		qname, err := Marshal(name)
+		if err != nil {
+			return err
+		}
+		b = append(b, qname...)
+		b = append(b, ':')
+		b = append(b, val...)
+		*raw = append(b, '}')
+		return nil
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(f.typ))
+	}
+	key := reflect.ValueOf(name).Convert(f.typ.Key())
+	val := reflect.New(f.typ.Elem()).Elem()
+	if old := v.MapIndex(key); old.IsValid() {
+		val.Set(old)
+	}
+	if err := unmarshalValue(dec, val, uo); err != nil {
+		return err
+	}
+	v.SetMapIndex(key, val)
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import "encoding/json/internal/jsonopts"
+
+// Options configures Marshal, MarshalWrite, MarshalEncode,
+// Unmarshal, UnmarshalRead, and UnmarshalDecode with specific features.
+// Each function takes in a variadic list of options, where properties
+// set in later options override the value of previously set properties.
+//
+// Options from encoding/json/jsontext may also be provided to configure
+// the underlying Encoder or Decoder. Options that do not apply to a
+// particular operation are ignored.
+type Options = jsonopts.Options
+
+// JoinOptions coalesces the provided list of options into a single Options.
+// Properties set in later options override the value of previously set properties.
+func JoinOptions(srcs ...Options) Options {
+	var dst jsonopts.Struct
+	dst.Join(srcs...)
+	return &dst
+}
+
+// Deterministic specifies that the same input value will be serialized
+// as the exact same output bytes. In particular, the members of a
+// Go map are marshaled in sorted order of their names.
+//
+// This only affects marshaling and is ignored when unmarshaling.
+func Deterministic(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.Deterministic, Value: v}
+}
+
+// FormatNilMapAsNull specifies that a nil Go map should marshal as a
+// JSON null instead of the default representation as an empty JSON object.
+//
+// This only affects marshaling and is ignored when unmarshaling.
+func FormatNilMapAsNull(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.FormatNilMapAsNull, Value: v}
+}
+
+// FormatNilSliceAsNull specifies that a nil Go slice should marshal as a
+// JSON null instead of the default representation as an empty JSON array
+// (or an empty JSON string in the case of ~[]byte).
+//
+// This only affects marshaling and is ignored when unmarshaling.
+func FormatNilSliceAsNull(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.FormatNilSliceAsNull, Value: v}
+}
+
+// MatchCaseInsensitiveNames specifies that JSON object members are matched
+// against Go struct fields using a case-insensitive match of the name,
+// which also ignores any '-' and '_' characters.
+// Go struct fields explicitly marked with "case:strict" are always
+// matched case-sensitively, and those marked with "case:ignore" are
+// always matched case-insensitively.
+//
+// This only affects unmarshaling and is ignored when marshaling.
+func MatchCaseInsensitiveNames(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.MatchCaseInsensitiveNames, Value: v}
+}
+
+// OmitZeroStructFields specifies that a Go struct field should be omitted
+// when marshaling if the field value is zero, as if every field
+// were marked with the "omitzero" option.
+//
+// This only affects marshaling and is ignored when unmarshaling.
+func OmitZeroStructFields(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.OmitZeroStructFields, Value: v}
+}
+
+// RejectUnknownMembers specifies that unknown members should be rejected
+// when unmarshaling a JSON object, regardless of whether there is a field
+// to store unknown members. The error wraps ErrUnknownName.
+//
+// This only affects unmarshaling and is ignored when marshaling.
+func RejectUnknownMembers(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.RejectUnknownMembers, Value: v}
+}
+
+// StringifyNumbers specifies that numeric Go types should be marshaled
+// as a JSON string containing the equivalent JSON number value.
+// When unmarshaling, numeric Go types are parsed from a JSON string
+// containing the JSON number without any surrounding whitespace.
+//
+// This affects either marshaling or unmarshaling.
+func StringifyNumbers(v bool) Options {
+	return jsonopts.Bool{Flag: jsonopts.StringifyNumbers, Value: v}
+}
+
+// WithMarshalers specifies a list of type-specific marshalers to use,
+// which can be used to override the default marshal behavior for values
+// of particular types.
+//
+// This only affects marshaling and is ignored when unmarshaling.
+func WithMarshalers(v *Marshalers) Options {
+	return jsonopts.Marshalers{V: v}
+}
+
+// WithUnmarshalers specifies a list of type-specific unmarshalers to use,
+// which can be used to override the default unmarshal behavior for values
+// of particular types.
+//
+// This only affects unmarshaling and is ignored when marshaling.
+func WithUnmarshalers(v *Unmarshalers) Options {
+	return jsonopts.Unmarshalers{V: v}
+}
@@ -11,6 +11,9 @@ import (
 // Unwrap returns the result of calling the Unwrap method on err, if err's
 // type contains an Unwrap method returning error.
 // Otherwise, Unwrap returns nil.
+//
+// Unwrap only calls a method of the form "Unwrap() error".
+// In particular Unwrap does not unwrap errors returned by Join.
 // 如果 err 实现了Unwrap，则返回Unwrap方法
 // 否则返回Nil
 func Unwrap(err error) error {
@@ -23,10 +26,11 @@ func Unwrap(err error) error {
 	return u.Unwrap()
 }
 
-// Is reports whether any error in err's chain matches target.
+// Is reports whether any error in err's tree matches target.
 //
-// The chain consists of err itself followed by the sequence of errors obtained by
-// repeatedly calling Unwrap.
+// The tree consists of err itself, followed by the errors obtained by repeatedly
+// calling Unwrap. When err wraps multiple errors, Is examines err followed by a
+// depth-first traversal of its children.
 //
 // An error is considered to match a target if it is equal to that target or if
 // it implements a method Is(error) bool such that Is(target) returns true.
@@ -47,9 +51,13 @@ func Is(err, target error) bool {
 	}
 
 	isComparable := reflectlite.TypeOf(target).Comparable()
+	return is(err, target, isComparable)
+}
+
+func is(err, target error, targetComparable bool) bool {
 	for {
 		// 反射判断如果可比较，且相等, 则直接返回true
-		if isComparable && err == target {
+		if targetComparable && err == target {
 			return true
 		}
 		// 否则， 查看是不是有 Is(error） bool 方法
@@ -63,17 +71,32 @@ func Is(err, target error) bool {
 		// 否则再次查看 err 有没有自己实现Unwrap ,  如果没法 返回false
 		// 注意这里是循环， 如果有Unwrap方法， 则err !=nil
 		// 那么这里就有一个for循环， 继续重复比较
-		if err = Unwrap(err); err == nil {
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+			if err == nil {
+				return false
+			}
+		case interface{ Unwrap() []error }:
+			// 多个错误时按深度优先依次检查每个子错误
+			for _, err := range x.Unwrap() {
+				if is(err, target, targetComparable) {
+					return true
+				}
+			}
+			return false
+		default:
 			return false
 		}
 	}
 }
 
-// As finds the first error in err's chain that matches target, and if so, sets
-// target to that error value and returns true. Otherwise, it returns false.
+// As finds the first error in err's tree that matches target, and if one is found,
+// sets target to that error value and returns true. Otherwise, it returns false.
 //
-// The chain consists of err itself followed by the sequence of errors obtained by
-// repeatedly calling Unwrap.
+// The tree consists of err itself, followed by the errors obtained by repeatedly
+// calling Unwrap. When err wraps multiple errors, As examines err followed by a
+// depth-first traversal of its children.
 //
 // An error matches target if the error's concrete value is assignable to the value
 // pointed to by target, or if the error has a method As(interface{}) bool such that
@@ -101,21 +124,45 @@ func As(err error, target interface{}) bool {
 	if targetType.Kind() != reflectlite.Interface && !targetType.Implements(errorType) {
 		panic("errors: *target must be interface or implement error")
 	}
-	for err != nil {
+	return as(err, target, val, targetType)
+}
+
+func as(err error, target interface{}, targetVal reflectlite.Value, targetType reflectlite.Type) bool {
+	if err == nil {
+		return false
+	}
+	for {
 		// 反射赋值方式
 		// 需要注意的是 需要提前判断targetType 符合err的赋值条件
 		if reflectlite.TypeOf(err).AssignableTo(targetType) {
 			// target.Elem().Set(reflectlite.Value)
-			val.Elem().Set(reflectlite.ValueOf(err))
+			targetVal.Elem().Set(reflectlite.ValueOf(err))
 			return true
 		}
 		// 如果err 实现了As 方法， 则递归调用err.As()方法
 		if x, ok := err.(interface{ As(interface{}) bool }); ok && x.As(target) {
 			return true
 		}
-		err = Unwrap(err) // 递归调用Unwrap
-	} // 如果err == nil 直接返回false
-	return false
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			err = x.Unwrap() // 递归调用Unwrap
+			if err == nil {
+				return false
+			}
+		case interface{ Unwrap() []error }:
+			for _, err := range x.Unwrap() {
+				if err == nil {
+					continue
+				}
+				if as(err, target, targetVal, targetType) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
+		}
+	}
 }
 
 var errorType = reflectlite.TypeOf((*error)(nil)).Elem()
@@ -71,8 +71,8 @@ var depsRules = `
 	# No dependencies allowed for any of these packages.
 	NONE
 	< container/list, container/ring,
-	  internal/cfg, internal/cpu, internal/goexperiment,
-	  internal/goversion, internal/nettrace,
+	  internal/cfg, internal/coverage/rtcov, internal/cpu,
+	  internal/goexperiment, internal/goversion, internal/nettrace,
 	  unicode/utf8, unicode/utf16, unicode,
 	  unsafe;
 
@@ -232,6 +232,16 @@ var depsRules = `
 	< encoding/ascii85, encoding/csv, encoding/gob, encoding/hex,
 	  encoding/json, encoding/pem, encoding/xml, mime;
 
+	# the jsontext syntax layer does not use reflect or fmt.
+	STR
+	< encoding/json/internal/jsonopts
+	< encoding/json/jsontext;
+
+	reflect !< encoding/json/jsontext;
+
+	FMT, encoding/base32, encoding/base64, encoding/hex, encoding/json/jsontext
+	< encoding/json/v2;
+
 	# hashes
 	io
 	< hash
@@ -344,6 +354,12 @@ var depsRules = `
 	sync
 	< internal/singleflight;
 
+	RUNTIME
+	< internal/intern;
+
+	internal/bytealg, internal/intern, internal/itoa, math, math/bits, strconv
+	< net/netip;
+
 	os
 	< golang.org/x/net/dns/dnsmessage,
 	  golang.org/x/net/lif,
@@ -361,6 +377,7 @@ var depsRules = `
 	internal/poll,
 	internal/singleflight,
 	internal/race,
+	net/netip,
 	os
 	< net;
 
@@ -376,9 +393,16 @@ var depsRules = `
 
 	# logging - most packages should not import; http and up is allowed
 	FMT
+	< log/internal
 	< log;
 
-	log !< crypto/tls, database/sql, go/importer, testing;
+	log, log/slog !< crypto/tls, database/sql, go/importer, testing;
+
+	FMT
+	< log/slog/internal/buffer;
+
+	FMT, encoding, encoding/json, log, log/internal, log/slog/internal/buffer
+	< log/slog;
 
 	FMT, log, net
 	< log/syslog;
@@ -393,11 +417,12 @@ var depsRules = `
 	< crypto/subtle
 	< crypto/internal/subtle
 	< crypto/elliptic/internal/fiat
-	< crypto/ed25519/internal/edwards25519/field
-	< crypto/ed25519/internal/edwards25519
+	< crypto/internal/edwards25519/field
+	< crypto/internal/edwards25519
 	< crypto/cipher
 	< crypto/aes, crypto/des, crypto/hmac, crypto/md5, crypto/rc4,
-	  crypto/sha1, crypto/sha256, crypto/sha512
+	  crypto/sha1, crypto/sha256, crypto/sha512, crypto/sha3
+	< crypto/hkdf, crypto/pbkdf2
 	< CRYPTO;
 
 	CGO, fmt, net !< CRYPTO;
@@ -410,8 +435,8 @@ var depsRules = `
 	< encoding/asn1
 	< golang.org/x/crypto/cryptobyte/asn1
 	< golang.org/x/crypto/cryptobyte
-	< golang.org/x/crypto/curve25519
 	< crypto/dsa, crypto/elliptic, crypto/rsa
+	< crypto/ecdh
 	< crypto/ecdsa
 	< CRYPTO-MATH;
 
@@ -423,7 +448,8 @@ var depsRules = `
 	< golang.org/x/crypto/chacha20
 	< golang.org/x/crypto/poly1305
 	< golang.org/x/crypto/chacha20poly1305
-	< golang.org/x/crypto/hkdf
+	< crypto/internal/mlkem768
+	< crypto/hpke
 	< crypto/x509/internal/macos
 	< crypto/x509/pkix
 	< crypto/x509
@@ -437,11 +463,15 @@ var depsRules = `
 	crypto/tls
 	< net/smtp;
 
+	crypto/x509
+	< crypto/x509/ocsp;
+
 	# HTTP, King of Dependencies.
 
 	FMT
 	< golang.org/x/net/http2/hpack
-	< net/http/internal, net/http/internal/ascii, net/http/internal/testcert;
+	< net/http/internal, net/http/internal/ascii, net/http/internal/testcert
+	< net/http/internal/http3;
 
 	FMT, NET, container/list, encoding/binary, log
 	< golang.org/x/text/transform
@@ -454,12 +484,17 @@ var depsRules = `
 	NET, crypto/tls
 	< net/http/httptrace;
 
+	crypto/tls
+	< net/http/internal/quic;
+
 	compress/gzip,
 	golang.org/x/net/http/httpguts,
 	golang.org/x/net/http/httpproxy,
 	golang.org/x/net/http2/hpack,
 	net/http/internal,
 	net/http/internal/ascii,
+	net/http/internal/http3,
+	net/http/internal/quic,
 	net/http/internal/testcert,
 	net/http/httptrace,
 	mime/multipart,
@@ -491,6 +526,11 @@ var depsRules = `
 	html, internal/profile, net/http, runtime/pprof, runtime/trace
 	< net/http/pprof;
 
+	# Coverage
+	FMT, crypto/md5, encoding/binary, encoding/hex, internal/coverage/rtcov
+	< internal/coverage
+	< runtime/coverage;
+
 	# RPC
 	encoding/gob, encoding/json, go/token, html/template, net/http
 	< net/rpc
@@ -511,7 +551,11 @@ var depsRules = `
 	FMT, flag, runtime/debug, runtime/trace, internal/sysinfo, math/rand
 	< testing;
 
-	internal/testlog, runtime/pprof, regexp
+	FMT, crypto/sha256, encoding/binary, encoding/json, go/ast, go/parser,
+	go/token, math/rand
+	< internal/fuzz;
+
+	internal/fuzz, internal/testlog, runtime/pprof, regexp
 	< testing/internal/testdeps;
 
 	OS, flag, testing, internal/cfg
@@ -527,7 +571,8 @@ var depsRules = `
 	< golang.org/x/net/nettest;
 
 	FMT, container/heap, math/rand
-	< internal/trace;
+	< internal/trace
+	< runtime/trace/parse;
 `
 
 // listStdPkgs returns the same list of packages as "go list std".
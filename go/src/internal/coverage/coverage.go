@@ -0,0 +1,145 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package coverage defines the files written by programs built with
+// 'go build -cover', and read by 'go tool covdata'.
+//
+// A program writes two kinds of files into its coverage directory.
+// A meta-data file describes the instrumented source files and their
+// basic blocks; it depends only on the program, so all runs of the
+// same program share one. A counter data file holds the block
+// counters of a single run, and refers to its meta-data file by hash.
+//
+// The files are named
+//
+//	covmeta.<hash>
+//	covcounters.<hash>.<pid>.<nanotime>
+//
+// where hash is the hexadecimal hash of the meta-data, pid is the
+// process ID of the run and nanotime the time at which it wrote the
+// counters, so that runs never overwrite each other's data.
+package coverage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// File name prefixes of meta-data and counter data files.
+const (
+	MetaFilePrefix     = "covmeta"
+	CountersFilePrefix = "covcounters"
+)
+
+// A Block is a basic block of a source file.
+type Block struct {
+	StartLine, StartCol uint32
+	EndLine, EndCol     uint32
+	NumStmt             uint16 // number of statements in the block
+}
+
+// A MetaFile describes the blocks of an instrumented source file.
+type MetaFile struct {
+	Name   string // file name, as it appears in coverage profiles
+	Blocks []Block
+}
+
+// Meta is the coverage meta-data of a program.
+type Meta struct {
+	Mode  string // set, count or atomic
+	Files []MetaFile
+}
+
+// Counters is the counter data of a single run of a program.
+type Counters struct {
+	// MetaHash is the hash of the program's meta-data.
+	MetaHash Hash
+
+	// Counts holds, for each file of the meta-data, the counter of
+	// each of its blocks.
+	Counts [][]uint32
+}
+
+// A Hash identifies coverage meta-data.
+type Hash [md5.Size]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Hash returns the hash of m, which names its meta-data file.
+func (m *Meta) Hash() Hash {
+	h := md5.New()
+	if err := WriteMeta(h, m); err != nil {
+		panic(err) // hash writes never fail
+	}
+	var sum Hash
+	h.Sum(sum[:0])
+	return sum
+}
+
+// Check reports an error if c does not have a counter for each block
+// of m.
+func (c *Counters) Check(m *Meta) error {
+	if len(c.Counts) != len(m.Files) {
+		return fmt.Errorf("coverage: counter data has %d files, meta-data has %d", len(c.Counts), len(m.Files))
+	}
+	for i, f := range m.Files {
+		if len(c.Counts[i]) != len(f.Blocks) {
+			return fmt.Errorf("coverage: counter data has %d blocks for %s, meta-data has %d", len(c.Counts[i]), f.Name, len(f.Blocks))
+		}
+	}
+	return nil
+}
+
+// MetaFileName returns the name of the meta-data file with hash h.
+func MetaFileName(h Hash) string {
+	return MetaFilePrefix + "." + h.String()
+}
+
+// CountersFileName returns the name of the counter data file written
+// at nanotime by the process pid, for the meta-data with hash h.
+func CountersFileName(h Hash, pid int, nanotime int64) string {
+	return fmt.Sprintf("%s.%s.%d.%d", CountersFilePrefix, h, pid, nanotime)
+}
+
+// ParseMetaFileName parses the name of a meta-data file.
+// It reports whether name is such a file.
+func ParseMetaFileName(name string) (h Hash, ok bool) {
+	f := strings.Split(name, ".")
+	if len(f) != 2 || f[0] != MetaFilePrefix {
+		return h, false
+	}
+	return parseHash(f[1])
+}
+
+// ParseCountersFileName parses the name of a counter data file, and
+// returns the hash of its meta-data. It reports whether name is such
+// a file.
+func ParseCountersFileName(name string) (h Hash, ok bool) {
+	f := strings.Split(name, ".")
+	if len(f) != 4 || f[0] != CountersFilePrefix {
+		return h, false
+	}
+	if _, err := strconv.ParseUint(f[2], 10, 64); err != nil {
+		return h, false
+	}
+	if _, err := strconv.ParseUint(f[3], 10, 64); err != nil {
+		return h, false
+	}
+	return parseHash(f[1])
+}
+
+func parseHash(s string) (h Hash, ok bool) {
+	if len(s) != 2*len(h) {
+		return h, false
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, false
+	}
+	return h, true
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coverage
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var testMeta = &Meta{
+	Mode: "count",
+	Files: []MetaFile{
+		{
+			Name: "example.com/p/a.go",
+			Blocks: []Block{
+				{StartLine: 3, StartCol: 14, EndLine: 5, EndCol: 2, NumStmt: 1},
+				{StartLine: 7, StartCol: 20, EndLine: 9, EndCol: 3, NumStmt: 65535},
+			},
+		},
+		{Name: "example.com/p/empty.go"},
+		{
+			Name:   "example.com/p/b.go",
+			Blocks: []Block{{StartLine: 1 << 20, StartCol: 1, EndLine: 1<<20 + 1, EndCol: 1 << 15, NumStmt: 2}},
+		},
+	},
+}
+
+func TestMetaRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMeta(&buf, testMeta); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadMeta(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files without blocks read back with nil Blocks.
+	if !reflect.DeepEqual(m, testMeta) {
+		t.Errorf("ReadMeta = %+v, want %+v", m, testMeta)
+	}
+	if m.Hash() != testMeta.Hash() {
+		t.Errorf("hash changed after round trip")
+	}
+
+	m.Mode = "set"
+	if m.Hash() == testMeta.Hash() {
+		t.Errorf("hash did not change with mode")
+	}
+}
+
+func TestCountersRoundTrip(t *testing.T) {
+	want := &Counters{
+		MetaHash: testMeta.Hash(),
+		Counts:   [][]uint32{{0, 1<<32 - 1}, nil, {42}},
+	}
+	if err := want.Check(testMeta); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteCounters(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadCounters(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("ReadCounters = %+v, want %+v", c, want)
+	}
+
+	c.Counts[2] = append(c.Counts[2], 1)
+	if err := c.Check(testMeta); err == nil {
+		t.Errorf("Check succeeded with an extra counter")
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	var meta, counters bytes.Buffer
+	WriteMeta(&meta, testMeta)
+	WriteCounters(&counters, &Counters{Counts: [][]uint32{{1, 2}, nil, {3}}})
+
+	if _, err := ReadMeta(bytes.NewReader(counters.Bytes())); err == nil {
+		t.Errorf("ReadMeta of counter data succeeded")
+	}
+	if _, err := ReadCounters(bytes.NewReader(meta.Bytes())); err == nil {
+		t.Errorf("ReadCounters of meta-data succeeded")
+	}
+	for n := 0; n < meta.Len(); n++ {
+		if _, err := ReadMeta(bytes.NewReader(meta.Bytes()[:n])); err == nil {
+			t.Errorf("ReadMeta of %d of %d bytes succeeded", n, meta.Len())
+		}
+	}
+	for n := 0; n < counters.Len(); n++ {
+		if _, err := ReadCounters(bytes.NewReader(counters.Bytes()[:n])); err == nil {
+			t.Errorf("ReadCounters of %d of %d bytes succeeded", n, counters.Len())
+		}
+	}
+	if _, err := ReadMeta(bytes.NewReader(append(meta.Bytes(), 0))); err == nil {
+		t.Errorf("ReadMeta with trailing data succeeded")
+	}
+}
+
+func TestFileNames(t *testing.T) {
+	h := testMeta.Hash()
+	name := MetaFileName(h)
+	if got, ok := ParseMetaFileName(name); !ok || got != h {
+		t.Errorf("ParseMetaFileName(%q) = %v, %v, want %v, true", name, got, ok, h)
+	}
+	if _, ok := ParseCountersFileName(name); ok {
+		t.Errorf("ParseCountersFileName(%q) succeeded", name)
+	}
+	name = CountersFileName(h, 1234, 1638316800000000000)
+	if got, ok := ParseCountersFileName(name); !ok || got != h {
+		t.Errorf("ParseCountersFileName(%q) = %v, %v, want %v, true", name, got, ok, h)
+	}
+	if _, ok := ParseMetaFileName(name); ok {
+		t.Errorf("ParseMetaFileName(%q) succeeded", name)
+	}
+	for _, bad := range []string{
+		"covmeta",
+		"covmeta.0123",
+		"covmeta." + h.String() + ".1",
+		"covcounters." + h.String() + ".x.1",
+		"covcounters." + h.String() + ".1",
+		"other." + h.String(),
+	} {
+		if _, ok := ParseMetaFileName(bad); ok {
+			t.Errorf("ParseMetaFileName(%q) succeeded", bad)
+		}
+		if _, ok := ParseCountersFileName(bad); ok {
+			t.Errorf("ParseCountersFileName(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coverage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Both kinds of files start with a magic string and a version number,
+// and continue with a sequence of uvarints and strings. A string is
+// its length as a uvarint, followed by its bytes.
+//
+// A meta-data file continues with the coverage mode, the number of
+// files and, for each file, its name, its number of blocks and, for
+// each block, its start line and column, end line and column, and
+// number of statements.
+//
+// A counter data file continues with the meta-data hash, the number
+// of files and, for each file, its number of blocks and the counter
+// of each block.
+const (
+	metaMagic     = "\x00gocovmeta"
+	countersMagic = "\x00gocovcounters"
+	version       = 1
+)
+
+var errCorrupt = errors.New("coverage: corrupt data")
+
+// WriteMeta writes the meta-data m to w.
+func WriteMeta(w io.Writer, m *Meta) error {
+	e := newEncoder(w, metaMagic)
+	e.string(m.Mode)
+	e.uvarint(uint64(len(m.Files)))
+	for _, f := range m.Files {
+		e.string(f.Name)
+		e.uvarint(uint64(len(f.Blocks)))
+		for _, b := range f.Blocks {
+			e.uvarint(uint64(b.StartLine))
+			e.uvarint(uint64(b.StartCol))
+			e.uvarint(uint64(b.EndLine))
+			e.uvarint(uint64(b.EndCol))
+			e.uvarint(uint64(b.NumStmt))
+		}
+	}
+	return e.w.Flush()
+}
+
+// ReadMeta reads meta-data from r.
+func ReadMeta(r io.Reader) (*Meta, error) {
+	d := newDecoder(r)
+	if !d.magic(metaMagic) {
+		return nil, errors.New("coverage: not a meta-data file")
+	}
+	m := &Meta{Mode: d.string()}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		f := MetaFile{Name: d.string()}
+		for nb := d.uvarint(); nb > 0 && d.err == nil; nb-- {
+			f.Blocks = append(f.Blocks, Block{
+				StartLine: d.uint32(),
+				StartCol:  d.uint32(),
+				EndLine:   d.uint32(),
+				EndCol:    d.uint32(),
+				NumStmt:   uint16(d.limit(math.MaxUint16)),
+			})
+		}
+		m.Files = append(m.Files, f)
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteCounters writes the counter data c to w.
+func WriteCounters(w io.Writer, c *Counters) error {
+	e := newEncoder(w, countersMagic)
+	e.w.Write(c.MetaHash[:])
+	e.uvarint(uint64(len(c.Counts)))
+	for _, counts := range c.Counts {
+		e.uvarint(uint64(len(counts)))
+		for _, n := range counts {
+			e.uvarint(uint64(n))
+		}
+	}
+	return e.w.Flush()
+}
+
+// ReadCounters reads counter data from r.
+func ReadCounters(r io.Reader) (*Counters, error) {
+	d := newDecoder(r)
+	if !d.magic(countersMagic) {
+		return nil, errors.New("coverage: not a counter data file")
+	}
+	c := new(Counters)
+	if _, err := io.ReadFull(d.r, c.MetaHash[:]); err != nil {
+		d.fail(err)
+	}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		var counts []uint32
+		for nb := d.uvarint(); nb > 0 && d.err == nil; nb-- {
+			counts = append(counts, d.uint32())
+		}
+		c.Counts = append(c.Counts, counts)
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func newEncoder(w io.Writer, magic string) *encoder {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.w.WriteString(magic)
+	e.uvarint(version)
+	return e
+}
+
+func (e *encoder) uvarint(x uint64) {
+	n := binary.PutUvarint(e.buf[:], x)
+	e.w.Write(e.buf[:n])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+// A decoder reads the encoding written by an encoder. After the first
+// error, it records the error and returns zero values.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{r: bufio.NewReader(r)}
+}
+
+func (d *decoder) fail(err error) {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// magic reads the magic string and version number, and reports
+// whether they are as expected.
+func (d *decoder) magic(magic string) bool {
+	buf := make([]byte, len(magic))
+	if _, err := io.ReadFull(d.r, buf); err != nil || string(buf) != magic {
+		return false
+	}
+	return d.uvarint() == version && d.err == nil
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+		return 0
+	}
+	return x
+}
+
+// limit reads a uvarint, which must not exceed max.
+func (d *decoder) limit(max uint64) uint64 {
+	x := d.uvarint()
+	if x > max {
+		d.fail(errCorrupt)
+		return 0
+	}
+	return x
+}
+
+func (d *decoder) uint32() uint32 {
+	return uint32(d.limit(math.MaxUint32))
+}
+
+func (d *decoder) string() string {
+	// Strings are file names and modes, so they are short;
+	// the limit guards against allocating for corrupt lengths.
+	n := d.limit(1 << 16)
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.fail(err)
+		return ""
+	}
+	return string(buf)
+}
+
+// end returns the error encountered, if any, or an error if any data
+// follows what has been read.
+func (d *decoder) end() error {
+	if d.err != nil {
+		return d.err
+	}
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return errCorrupt
+	}
+	return nil
+}
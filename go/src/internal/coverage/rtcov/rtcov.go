@@ -0,0 +1,40 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rtcov holds the coverage counters of a program built with
+// 'go build -cover'. Each source file instrumented by cmd/cover is
+// registered here by an init function that the go command adds to its
+// package, and package runtime/coverage writes the counters out.
+//
+// The package has no dependencies, so that any other package can be
+// instrumented.
+package rtcov
+
+// A File holds the coverage variables of one instrumented source file,
+// as laid down by cmd/cover.
+type File struct {
+	Name    string   // file name, as it appears in coverage profiles
+	Mode    string   // coverage mode: set, count or atomic
+	Counts  []uint32 // execution counter for each block
+	Pos     []uint32 // start line, end line, end col<<16|start col for each block
+	NumStmt []uint16 // number of statements in each block
+}
+
+// Files holds the registered files, in registration order.
+var Files []*File
+
+// RegisterFile records the coverage variables of an instrumented file.
+// It is called during package initialization.
+func RegisterFile(name, mode string, counts, pos []uint32, numStmt []uint16) {
+	if 3*len(counts) != len(pos) || len(counts) != len(numStmt) {
+		panic("coverage: mismatched sizes")
+	}
+	Files = append(Files, &File{
+		Name:    name,
+		Mode:    mode,
+		Counts:  counts,
+		Pos:     pos,
+		NumStmt: numStmt,
+	})
+}
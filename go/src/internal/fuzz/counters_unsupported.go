@@ -0,0 +1,18 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Nothing about the instrumentation is OS specific, but only amd64 and
+// arm64 are supported in the runtime. See src/runtime/libfuzzer*.
+// If you update this constraint, also update fuzzInstrumented in
+// cmd/go/internal/test.
+
+//go:build !((darwin || linux || windows || freebsd) && (amd64 || arm64))
+// +build !darwin,!linux,!windows,!freebsd !amd64,!arm64
+
+package fuzz
+
+// coverage returns nil on unsupported platforms. cmd/go refuses to run
+// 'go test -fuzz' on them (see fuzzInstrumented), so this exists only so
+// that the package builds.
+func coverage() []byte { return nil }
@@ -0,0 +1,219 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestUnmarshalMarshal(t *testing.T) {
+	var tests = []struct {
+		in string
+		ok bool
+	}{
+		{
+			in: "int(1234)",
+			ok: false, // missing version
+		},
+		{
+			in: `go test fuzz v1
+string("a"bcad")`,
+			ok: false, // malformed
+		},
+		{
+			in: `go test fuzz v1
+int()`,
+			ok: false, // empty value
+		},
+		{
+			in: `go test fuzz v1
+uint(-32)`,
+			ok: false, // invalid negative uint
+		},
+		{
+			in: `go test fuzz v1
+int8(1234456)`,
+			ok: false, // int8 too large
+		},
+		{
+			in: `go test fuzz v1
+int(20*5)`,
+			ok: false, // expression in int value
+		},
+		{
+			in: `go test fuzz v1
+int(--5)`,
+			ok: false, // expression in int value
+		},
+		{
+			in: `go test fuzz v1
+bool(0)`,
+			ok: false, // malformed bool
+		},
+		{
+			in: `go test fuzz v1
+byte('aa)`,
+			ok: false, // malformed byte
+		},
+		{
+			in: `go test fuzz v1
+byte('☃')`,
+			ok: false, // byte out of range
+		},
+		{
+			in: `go test fuzz v1
+string("has final newline")
+`,
+			ok: true, // has final newline
+		},
+		{
+			in: `go test fuzz v1
+string("extra")
+[]byte("spacing")
+    `,
+			ok: true, // extra spaces in the final newline
+		},
+		{
+			in: `go test fuzz v1
+float64(0)
+float32(0)`,
+			ok: true, // will be an integer literal since there is no decimal
+		},
+		{
+			in: `go test fuzz v1
+int(-23)
+int8(-2)
+int64(2342425)
+uint(1)
+uint16(234)
+uint32(352342)
+uint64(123)
+rune('œ')
+byte('K')
+byte('ÿ')
+[]byte("hello¿")
+[]byte("a")
+bool(true)
+string("hello\\xbd\\xb2=\\xbc ⌘")
+float64(-12.5)
+float32(2.5)`,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+float32(-0)
+float64(-0)
+float32(+Inf)
+float32(-Inf)
+float32(NaN)
+float64(+Inf)
+float64(-Inf)
+float64(NaN)
+math.Float64frombits(0x7ff8000000000002)
+math.Float32frombits(0x7fc00001)`,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+int32(-1)
+int32(2147483647)
+int32(-2147483648)
+uint8(0)
+uint8(255)`,
+			ok: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			vals, err := unmarshalCorpusFile([]byte(test.in))
+			if test.ok && err != nil {
+				t.Fatalf("unmarshal unexpected error: %v", err)
+			} else if !test.ok && err == nil {
+				t.Fatalf("unmarshal unexpected success")
+			}
+			if !test.ok {
+				return // skip the rest of the test
+			}
+			newB := marshalCorpusFile(vals...)
+			if newB[len(newB)-1] != '\n' {
+				t.Error("didn't write final newline to corpus file")
+			}
+			if len(bytes.Split(bytes.TrimSpace(newB), []byte("\n"))) != len(vals)+1 {
+				t.Errorf("marshaled file has the wrong number of lines:\n%s", newB)
+			}
+			vals2, err := unmarshalCorpusFile(newB)
+			if err != nil {
+				t.Fatalf("unmarshal of marshaled file failed: %v\n%s", err, newB)
+			}
+			newB2 := marshalCorpusFile(vals2...)
+			if string(newB) != string(newB2) {
+				t.Errorf("values changed after second round trip:\n%s\nwant:\n%s", newB2, newB)
+			}
+		})
+	}
+}
+
+// TestFloatRoundTrip checks that the special float values, including NaNs
+// with unusual bit patterns, survive a round trip through the corpus
+// encoding unchanged.
+func TestFloatRoundTrip(t *testing.T) {
+	f64 := []float64{
+		0,
+		math.Copysign(0, -1),
+		1.5,
+		-1e300,
+		math.Inf(1),
+		math.Inf(-1),
+		math.NaN(),
+		math.Float64frombits(0x7ff8000000000002),
+		math.Float64frombits(0xfff0000000000001),
+	}
+	for _, f := range f64 {
+		b := marshalCorpusFile(f)
+		vals, err := unmarshalCorpusFile(b)
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if got := vals[0].(float64); math.Float64bits(got) != math.Float64bits(f) {
+			t.Errorf("%s: got %#x, want %#x", b, math.Float64bits(got), math.Float64bits(f))
+		}
+	}
+
+	f32 := []float32{
+		0,
+		-2.5,
+		float32(math.Inf(1)),
+		float32(math.NaN()),
+		math.Float32frombits(0x7fc00001),
+	}
+	for _, f := range f32 {
+		b := marshalCorpusFile(f)
+		vals, err := unmarshalCorpusFile(b)
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if got := vals[0].(float32); math.Float32bits(got) != math.Float32bits(f) {
+			t.Errorf("%s: got %#x, want %#x", b, math.Float32bits(got), math.Float32bits(f))
+		}
+	}
+}
+
+// TestRuneRoundTrip checks that int32 values that have no rune literal
+// representation are preserved.
+func TestRuneRoundTrip(t *testing.T) {
+	for _, r := range []rune{'a', '⌘', -1, 0xD800, math.MaxInt32, math.MinInt32} {
+		b := marshalCorpusFile(r)
+		vals, err := unmarshalCorpusFile(b)
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if got := vals[0].(rune); got != r {
+			t.Errorf("%s: got %s, want %s", b, strconv.QuoteRune(got), strconv.QuoteRune(r))
+		}
+	}
+}
@@ -0,0 +1,571 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fuzz provides common fuzzing functionality for tests built with
+// "go test" and for programs that use fuzzing functionality in the testing
+// package.
+package fuzz
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CorpusEntry represents an individual input for fuzzing.
+//
+// We must use an equivalent type in the testing and testing/internal/testdeps
+// packages, but testing can't import this package directly, and we don't want
+// to export this type from testing. Instead, we use the same struct type and
+// use a type alias (not a defined type) for convenience.
+type CorpusEntry = struct {
+	Parent string
+
+	// Path is the path of the corpus file, if the entry was loaded from disk.
+	// For other entries, including seed values provided by f.Add, Path is the
+	// name of the test, e.g. seed#0 or its hash.
+	Path string
+
+	// Data is the raw input data. Data should only be populated for entries
+	// read from or written to disk.
+	Data []byte
+
+	// Values is the unmarshaled values from a corpus file.
+	Values []interface{}
+
+	Generation int
+
+	// IsSeed indicates whether this entry is part of the seed corpus.
+	IsSeed bool
+}
+
+// CoordinateFuzzingOpts is a set of arguments for CoordinateFuzzing.
+// The zero value is valid for each field unless specified otherwise.
+type CoordinateFuzzingOpts struct {
+	// Log is a writer for logging progress messages and warnings.
+	// If nil, io.Discard will be used instead.
+	Log io.Writer
+
+	// Timeout is the amount of wall clock time to spend fuzzing after the corpus
+	// has loaded. If zero, there will be no time limit.
+	Timeout time.Duration
+
+	// Limit is the number of random values to generate and test. If zero,
+	// there will be no limit on the number of generated values.
+	Limit int64
+
+	// MinimizeTimeout is the amount of wall clock time to spend minimizing
+	// after discovering a crasher. If zero, there will be no time limit. If
+	// MinimizeTimeout and MinimizeLimit are both zero, then minimization will
+	// be disabled.
+	MinimizeTimeout time.Duration
+
+	// MinimizeLimit is the maximum number of calls to the fuzz function to be
+	// made while minimizing after finding a crash. If zero, there will be no
+	// limit. Calls to the fuzz function made when minimizing also count toward
+	// Limit. If MinimizeTimeout and MinimizeLimit are both zero, then
+	// minimization will be disabled.
+	MinimizeLimit int64
+
+	// Seed is a list of seed values added by the fuzz target with testing.F.Add
+	// and in testdata.
+	Seed []CorpusEntry
+
+	// Types is the list of types which make up a corpus entry.
+	// Types must be set and must match values in Seed.
+	Types []reflect.Type
+
+	// CorpusDir is a directory where files containing values that crash the
+	// code being tested may be written. CorpusDir must be set.
+	CorpusDir string
+
+	// CacheDir is a directory containing additional "interesting" values.
+	// The fuzzer may derive new values from these, and may write new values here.
+	CacheDir string
+}
+
+// CoordinateFuzzing creates random inputs derived from the seed corpus and
+// the cached corpus, and tests them one at a time in a worker process, which
+// passes each of them to the function given to RunFuzzWorker. The worker
+// process is a copy of the test binary, run with the same arguments plus
+// -test.fuzzworker.
+//
+// An input that expands coverage is added to the corpus and written to
+// opts.CacheDir. An input that fails is minimized, written to
+// opts.CorpusDir, and reported with an error whose CrashPath method returns
+// the file name. Besides failures reported by the fuzz function, this
+// includes inputs that make the worker process exit, for example by calling
+// os.Exit or panicking in another goroutine, and inputs that make it hang.
+//
+// If the context is cancelled or the fuzzing limits are reached,
+// CoordinateFuzzing stops and returns nil.
+func CoordinateFuzzing(ctx context.Context, opts CoordinateFuzzingOpts) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+	if opts.CorpusDir == "" {
+		return errors.New("fuzz: CorpusDir must be set")
+	}
+	if len(opts.Types) == 0 {
+		return errors.New("fuzz: Types must be set")
+	}
+
+	c, err := newCoordinator(opts)
+	if err != nil {
+		return err
+	}
+
+	defer c.logStats()
+	defer c.w.stop()
+
+	if err := c.runBaseline(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	// The time limit only applies to generating new inputs; a crasher found
+	// just before it expires is still minimized.
+	fuzzCtx := ctx
+	if opts.Timeout > 0 {
+		var cancel func()
+		fuzzCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	logTicker := time.NewTicker(3 * time.Second)
+	defer logTicker.Stop()
+
+	for i := 0; ; i++ {
+		select {
+		case <-fuzzCtx.Done():
+			return nil
+		case <-logTicker.C:
+			c.logStats()
+		default:
+		}
+		if opts.Limit > 0 && c.count >= opts.Limit {
+			return nil
+		}
+
+		parent := c.corpus[i%len(c.corpus)]
+		vals := make([]interface{}, len(parent.Values))
+		copy(vals, parent.Values)
+		c.m.mutate(vals, maxInputSize)
+
+		e := CorpusEntry{
+			Parent:     parent.Path,
+			Values:     vals,
+			Generation: parent.Generation + 1,
+		}
+		resp, err := c.run(fuzzCtx, e)
+		if err != nil {
+			if fuzzCtx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if resp.Err != "" {
+			return c.reportCrash(ctx, e, errors.New(resp.Err))
+		}
+		if err := c.addIfInteresting(e, resp.Coverage); err != nil {
+			return err
+		}
+	}
+}
+
+// crashError wraps a crasher written to the seed corpus. It saves the name
+// of the file where the input causing the crasher was saved. The testing
+// framework uses this to report a command to re-run that specific input.
+type crashError struct {
+	path string
+	err  error
+}
+
+func (e *crashError) Error() string {
+	return e.err.Error()
+}
+
+func (e *crashError) Unwrap() error {
+	return e.err
+}
+
+func (e *crashError) CrashPath() string {
+	return e.path
+}
+
+// maxInputSize is the maximum size of an encoded corpus entry that the
+// mutator will produce.
+const maxInputSize = 100 << 20
+
+// coordinator holds the state of a single call to CoordinateFuzzing.
+type coordinator struct {
+	opts CoordinateFuzzingOpts
+	m    *mutator
+
+	// w runs inputs in a worker process.
+	w *worker
+
+	// startTime is the time we started the fuzzing run.
+	startTime time.Time
+
+	// corpus is the set of interesting values, including the seed corpus,
+	// which the mutator derives new values from.
+	corpus []CorpusEntry
+
+	// corpusHashes contains the hashes of the encoded values in corpus, so
+	// the same value is never added twice.
+	corpusHashes map[[sha256.Size]byte]bool
+
+	// coverageMask aggregates coverage that was found for all inputs in the
+	// corpus. Each byte represents a single basic execution block. Each set
+	// bit within the byte indicates that an input has triggered that block
+	// 2^n times, where n is the position of the bit in the byte.
+	coverageMask []byte
+
+	// count is the number of values tested by the worker.
+	count int64
+
+	// interestingCount is the number of unique interesting values which have
+	// been found this execution.
+	interestingCount int
+}
+
+func newCoordinator(opts CoordinateFuzzingOpts) (*coordinator, error) {
+	c := &coordinator{
+		opts:         opts,
+		m:            newMutator(time.Now().UnixNano()),
+		w:            &worker{},
+		startTime:    time.Now(),
+		corpusHashes: make(map[[sha256.Size]byte]bool),
+		coverageMask: make([]byte, len(coverageSnapshot)),
+	}
+
+	for _, e := range opts.Seed {
+		if err := CheckCorpus(e.Values, opts.Types); err != nil {
+			return nil, err
+		}
+		c.addCorpusEntry(e)
+	}
+	if opts.CacheDir != "" {
+		cached, err := ReadCorpus(opts.CacheDir, opts.Types)
+		if err != nil {
+			if _, ok := err.(*MalformedCorpusError); !ok {
+				return nil, err
+			}
+			// Malformed cache files are not the user's fault; skip them.
+			fmt.Fprintf(opts.Log, "fuzz: ignoring malformed files in the cache:\n%v\n", err)
+		}
+		for _, e := range cached {
+			c.addCorpusEntry(e)
+		}
+	}
+	if len(c.corpus) == 0 {
+		// Fuzzing needs something to start from: use the zero value of
+		// each argument.
+		vals := make([]interface{}, len(opts.Types))
+		for i, t := range opts.Types {
+			vals[i] = zeroValue(t)
+		}
+		c.addCorpusEntry(CorpusEntry{Path: "zero", Values: vals})
+	}
+	return c, nil
+}
+
+// addCorpusEntry adds e to the corpus unless an entry with the same values
+// is already present. It reports whether e was added.
+func (c *coordinator) addCorpusEntry(e CorpusEntry) bool {
+	data := e.Data
+	if data == nil {
+		data = marshalCorpusFile(e.Values...)
+	}
+	if len(data) > maxInputSize {
+		fmt.Fprintf(c.opts.Log, "fuzz: corpus entry %s is too large to mutate (%d bytes), skipping\n", e.Path, len(data))
+		return false
+	}
+	h := sha256.Sum256(data)
+	if c.corpusHashes[h] {
+		return false
+	}
+	c.corpusHashes[h] = true
+	c.corpus = append(c.corpus, e)
+	return true
+}
+
+// runBaseline runs every entry in the initial corpus once to record the
+// coverage it already provides. Failing seed entries are reported as errors;
+// they are not minimized or written to the corpus, since they are already
+// there.
+func (c *coordinator) runBaseline(ctx context.Context) error {
+	for _, e := range c.corpus {
+		resp, err := c.run(ctx, e)
+		if err != nil {
+			return err
+		}
+		if resp.Err != "" {
+			name := filepath.Base(c.opts.CorpusDir) + "/" + filepath.Base(e.Path)
+			return fmt.Errorf("failure while testing seed corpus entry: %s\n%s", name, resp.Err)
+		}
+		if resp.Coverage != nil {
+			c.updateCoverage(resp.Coverage)
+		}
+	}
+	fmt.Fprintf(c.opts.Log, "fuzz: elapsed: %s, gathering baseline coverage: %d/%d completed, now fuzzing\n",
+		c.elapsed(), len(c.corpus), len(c.corpus))
+	return nil
+}
+
+// run tests e in the worker process. The response's Err field describes
+// the failure e caused, if any. run returns a non-nil error only if fuzzing
+// can't continue.
+func (c *coordinator) run(ctx context.Context, e CorpusEntry) (runResponse, error) {
+	c.count++
+	data := e.Data
+	if data == nil {
+		data = marshalCorpusFile(e.Values...)
+	}
+	return c.w.run(ctx, data, c.coverageMask)
+}
+
+// addIfInteresting adds e to the corpus if the worker reported that it
+// reached coverage, cov, that no previous input reached.
+func (c *coordinator) addIfInteresting(e CorpusEntry, cov []byte) error {
+	if cov == nil {
+		return nil
+	}
+	// The worker process already counts this coverage as seen, so the
+	// coordinator must too, even if e turns out to be a duplicate.
+	c.updateCoverage(cov)
+	e.Data = marshalCorpusFile(e.Values...)
+	if c.opts.CacheDir != "" {
+		path, err := writeToCorpus(e.Data, c.opts.CacheDir)
+		if err != nil {
+			return err
+		}
+		e.Path = path
+	} else {
+		e.Path = corpusEntryName(e.Data)
+	}
+	if c.addCorpusEntry(e) {
+		c.interestingCount++
+	}
+	return nil
+}
+
+// reportCrash minimizes the failing input e if allowed, writes it to the
+// corpus directory, and returns the error that describes the crash.
+func (c *coordinator) reportCrash(ctx context.Context, e CorpusEntry, err error) error {
+	vals := e.Values
+	if c.opts.MinimizeTimeout > 0 || c.opts.MinimizeLimit > 0 {
+		vals, err = c.minimize(ctx, vals, err)
+	}
+	path, werr := writeToCorpus(marshalCorpusFile(vals...), c.opts.CorpusDir)
+	if werr != nil {
+		return fmt.Errorf("%v\nfuzz: failed to write failing input: %v", err, werr)
+	}
+	return &crashError{path: path, err: err}
+}
+
+// minimize tries to find a smaller version of vals that still fails in the
+// worker. It returns the smallest failing values found along with the error
+// they caused.
+func (c *coordinator) minimize(ctx context.Context, vals []interface{}, err error) ([]interface{}, error) {
+	fmt.Fprintf(c.opts.Log, "fuzz: elapsed: %s, minimizing\n", c.elapsed())
+
+	var deadline time.Time
+	if c.opts.MinimizeTimeout > 0 {
+		deadline = time.Now().Add(c.opts.MinimizeTimeout)
+	}
+	var count int64
+	var runErr error
+	shouldStop := func() bool {
+		return ctx.Err() != nil || runErr != nil ||
+			(!deadline.IsZero() && time.Now().After(deadline)) ||
+			(c.opts.MinimizeLimit > 0 && count >= c.opts.MinimizeLimit)
+	}
+
+	// minimizeInput modifies its argument, so start from a copy. Each value
+	// it keeps is one for which stillFails last reported true, so lastErr
+	// always describes the final values.
+	minVals := make([]interface{}, len(vals))
+	copy(minVals, vals)
+	lastErr := err
+	stillFails := func(candidate []interface{}) bool {
+		count++
+		resp, err := c.run(ctx, CorpusEntry{Values: candidate})
+		if err != nil {
+			runErr = err
+			return false
+		}
+		if resp.Err != "" {
+			lastErr = errors.New(resp.Err)
+			return true
+		}
+		return false
+	}
+	minimizeInput(minVals, stillFails, shouldStop)
+	return minVals, lastErr
+}
+
+func (c *coordinator) updateCoverage(newCoverage []byte) {
+	for i := range newCoverage {
+		c.coverageMask[i] |= newCoverage[i]
+	}
+}
+
+func (c *coordinator) elapsed() time.Duration {
+	return time.Since(c.startTime).Round(time.Second)
+}
+
+func (c *coordinator) logStats() {
+	elapsed := c.elapsed()
+	rate := float64(c.count) / time.Since(c.startTime).Seconds()
+	if coverageEnabled {
+		fmt.Fprintf(c.opts.Log, "fuzz: elapsed: %s, execs: %d (%.0f/sec), new interesting: %d (total: %d)\n",
+			elapsed, c.count, rate, c.interestingCount, len(c.corpus))
+	} else {
+		fmt.Fprintf(c.opts.Log, "fuzz: elapsed: %s, execs: %d (%.0f/sec)\n", elapsed, c.count, rate)
+	}
+}
+
+// ReadCorpus reads the corpus from the provided dir. The returned corpus
+// entries are guaranteed to match the given types. Any malformed files will
+// be saved in a MalformedCorpusError and returned, along with the most recent
+// error.
+func ReadCorpus(dir string, types []reflect.Type) ([]CorpusEntry, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil // No corpus to read
+	} else if err != nil {
+		return nil, fmt.Errorf("reading seed corpus from testdata: %v", err)
+	}
+	var corpus []CorpusEntry
+	var errs []error
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		filename := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read corpus file: %v", err)
+		}
+		var vals []interface{}
+		vals, err = readCorpusData(data, types)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %v", filename, err))
+			continue
+		}
+		corpus = append(corpus, CorpusEntry{Path: filename, Data: data, Values: vals})
+	}
+	if len(errs) > 0 {
+		return corpus, &MalformedCorpusError{errs: errs}
+	}
+	return corpus, nil
+}
+
+func readCorpusData(data []byte, types []reflect.Type) ([]interface{}, error) {
+	vals, err := unmarshalCorpusFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %v", err)
+	}
+	if err = CheckCorpus(vals, types); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// CheckCorpus verifies that the types in vals match the expected types
+// provided.
+func CheckCorpus(vals []interface{}, types []reflect.Type) error {
+	if len(vals) != len(types) {
+		return fmt.Errorf("wrong number of values in corpus entry: %d, want %d", len(vals), len(types))
+	}
+	valsT := make([]reflect.Type, len(vals))
+	for valsI, v := range vals {
+		valsT[valsI] = reflect.TypeOf(v)
+	}
+	for i := range types {
+		if valsT[i] != types[i] {
+			return fmt.Errorf("mismatched types in corpus entry: %v, want %v", valsT, types)
+		}
+	}
+	return nil
+}
+
+// MalformedCorpusError is an error found while reading the corpus from the
+// filesystem. All of the errors are stored in the errs list. The testing
+// framework uses this to report malformed files in testdata.
+type MalformedCorpusError struct {
+	errs []error
+}
+
+func (e *MalformedCorpusError) Error() string {
+	var msgs []string
+	for _, s := range e.errs {
+		msgs = append(msgs, s.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// writeToCorpus writes the given bytes to a new file in dir, named after
+// their hash. If the directory does not exist, it will create one. If the
+// file already exists, it is overwritten with the same contents.
+func writeToCorpus(data []byte, dir string) (path string, err error) {
+	path = filepath.Join(dir, corpusEntryName(data))
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		os.Remove(path) // remove partially written file
+		return "", err
+	}
+	return path, nil
+}
+
+// corpusEntryName returns the file name used for a corpus entry with the
+// given encoded contents.
+func corpusEntryName(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+var zeroVals []interface{} = []interface{}{
+	[]byte(""),
+	string(""),
+	false,
+	byte(0),
+	rune(0),
+	float32(0),
+	float64(0),
+	int(0),
+	int8(0),
+	int16(0),
+	int32(0),
+	int64(0),
+	uint(0),
+	uint8(0),
+	uint16(0),
+	uint32(0),
+	uint64(0),
+}
+
+func zeroValue(t reflect.Type) interface{} {
+	for _, v := range zeroVals {
+		if reflect.TypeOf(v) == t {
+			return v
+		}
+	}
+	panic(fmt.Sprintf("unsupported type: %v", t))
+}
@@ -0,0 +1,278 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"internal/testenv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var bytesType = []reflect.Type{reflect.TypeOf([]byte(nil))}
+
+// hasZ reports whether b is at least 4 bytes long and contains a 'Z'.
+func hasZ(b []byte) bool {
+	return len(b) >= 4 && bytes.IndexByte(b, 'Z') >= 0
+}
+
+// workerFns are the fuzz functions that worker processes started by the
+// tests in this file run. The test selects one by setting
+// GO_FUZZ_TEST_WORKER to its name.
+var workerFns = map[string]func(CorpusEntry) error{
+	"pass": func(CorpusEntry) error { return nil },
+	"failZ": func(e CorpusEntry) error {
+		if hasZ(e.Values[0].([]byte)) {
+			return errors.New("found Z")
+		}
+		return nil
+	},
+	"exitZ": func(e CorpusEntry) error {
+		if hasZ(e.Values[0].([]byte)) {
+			os.Exit(3)
+		}
+		return nil
+	},
+	"goroutinePanicZ": func(e CorpusEntry) error {
+		if hasZ(e.Values[0].([]byte)) {
+			go func() { panic("found Z") }()
+			select {}
+		}
+		return nil
+	},
+	"hangZ": func(e CorpusEntry) error {
+		if hasZ(e.Values[0].([]byte)) {
+			time.Sleep(time.Hour)
+		}
+		return nil
+	},
+	"failBad": func(e CorpusEntry) error {
+		if string(e.Values[0].([]byte)) == "bad" {
+			return errors.New("bad input")
+		}
+		return nil
+	},
+	"checkStringInt": func(e CorpusEntry) error {
+		return CheckCorpus(e.Values, stringIntTypes)
+	},
+}
+
+var stringIntTypes = []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(int(0))}
+
+func TestMain(m *testing.M) {
+	// CoordinateFuzzing starts worker processes by running this test binary
+	// again with -test.fuzzworker.
+	if name := os.Getenv("GO_FUZZ_TEST_WORKER"); name != "" && os.Args[len(os.Args)-1] == "-test.fuzzworker" {
+		if err := RunFuzzWorker(workerFns[name]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// coordinateFuzzing calls CoordinateFuzzing with worker processes that run
+// workerFns[name].
+func coordinateFuzzing(t *testing.T, ctx context.Context, opts CoordinateFuzzingOpts, name string) error {
+	t.Helper()
+	testenv.MustHaveExec(t)
+	t.Setenv("GO_FUZZ_TEST_WORKER", name)
+	return CoordinateFuzzing(ctx, opts)
+}
+
+func TestCoordinateFuzzingCrash(t *testing.T) {
+	for _, tc := range []struct {
+		worker  string
+		wantErr string
+	}{
+		{"failZ", "found Z"},
+		{"exitZ", "fuzzing process terminated unexpectedly: exit status 3"},
+		{"goroutinePanicZ", "fuzzing process terminated unexpectedly: exit status 2\npanic: found Z"},
+		{"hangZ", "fuzzing process hung"},
+	} {
+		t.Run(tc.worker, func(t *testing.T) {
+			if tc.worker == "hangZ" {
+				defer func(d time.Duration) { workerHangTimeout = d }(workerHangTimeout)
+				workerHangTimeout = 200 * time.Millisecond
+			}
+
+			dir := t.TempDir()
+			corpusDir := filepath.Join(dir, "testdata", "fuzz", "FuzzCrash")
+			cacheDir := filepath.Join(dir, "cache", "FuzzCrash")
+			opts := CoordinateFuzzingOpts{
+				Limit:         1e7,
+				MinimizeLimit: 1000,
+				Seed:          []CorpusEntry{{Path: "seed#0", Values: []interface{}{[]byte("XYYYYYYYYYYYZYYYYYYY")[:12]}}},
+				Types:         bytesType,
+				CorpusDir:     corpusDir,
+				CacheDir:      cacheDir,
+			}
+			err := coordinateFuzzing(t, context.Background(), opts, tc.worker)
+			if err == nil {
+				t.Fatal("CoordinateFuzzing did not report the crash")
+			}
+			crashErr, ok := err.(*crashError)
+			if !ok {
+				t.Fatalf("got error %T %v; want *crashError", err, err)
+			}
+			if !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("got error %q, want prefix %q", err, tc.wantErr)
+			}
+			if dir := filepath.Dir(crashErr.CrashPath()); dir != corpusDir {
+				t.Errorf("crasher written to %s, want %s", dir, corpusDir)
+			}
+
+			// The crasher must be readable and minimized.
+			corpus, err := ReadCorpus(corpusDir, bytesType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(corpus) != 1 {
+				t.Fatalf("got %d corpus entries, want 1", len(corpus))
+			}
+			if b := corpus[0].Values[0].([]byte); len(b) != 4 || !hasZ(b) {
+				t.Errorf("crasher %q was not minimized to a 4-byte failing input", b)
+			}
+		})
+	}
+}
+
+func TestCoordinateFuzzingSeedFailure(t *testing.T) {
+	dir := t.TempDir()
+	opts := CoordinateFuzzingOpts{
+		Limit:     100,
+		Seed:      []CorpusEntry{{Path: "seed#0", Values: []interface{}{[]byte("bad")}}},
+		Types:     bytesType,
+		CorpusDir: filepath.Join(dir, "FuzzSeed"),
+	}
+	err := coordinateFuzzing(t, context.Background(), opts, "failBad")
+	if err == nil || !strings.Contains(err.Error(), "FuzzSeed/seed#0") {
+		t.Fatalf("got error %v; want failure for seed corpus entry FuzzSeed/seed#0", err)
+	}
+	if _, ok := err.(*crashError); ok {
+		t.Errorf("seed failure reported as a new crasher")
+	}
+	if _, err := os.Stat(opts.CorpusDir); !os.IsNotExist(err) {
+		t.Errorf("failing seed entry was written to the corpus")
+	}
+}
+
+func TestCoordinateFuzzingLimit(t *testing.T) {
+	var log bytes.Buffer
+	opts := CoordinateFuzzingOpts{
+		Log:       &log,
+		Limit:     50,
+		Types:     stringIntTypes,
+		CorpusDir: t.TempDir(),
+	}
+	if err := coordinateFuzzing(t, context.Background(), opts, "checkStringInt"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "execs: 50 ") {
+		t.Errorf("log does not report 50 executions:\n%s", log.String())
+	}
+}
+
+func TestCoordinateFuzzingCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	opts := CoordinateFuzzingOpts{
+		Types:     bytesType,
+		CorpusDir: t.TempDir(),
+	}
+	if err := coordinateFuzzing(t, ctx, opts, "pass"); err != nil {
+		t.Fatalf("got error %v after cancelation, want nil", err)
+	}
+}
+
+func TestReadCorpus(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("good", "go test fuzz v1\n[]byte(\"abc\")\n")
+	write("wrongtype", "go test fuzz v1\nstring(\"abc\")\n")
+	write("garbage", "not a corpus file")
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	corpus, err := ReadCorpus(dir, bytesType)
+	if _, ok := err.(*MalformedCorpusError); !ok {
+		t.Fatalf("got error %v, want *MalformedCorpusError", err)
+	}
+	for _, name := range []string{"wrongtype", "garbage"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention malformed file %s:\n%v", name, err)
+		}
+	}
+	if len(corpus) != 1 || filepath.Base(corpus[0].Path) != "good" {
+		t.Fatalf("got corpus %v, want only the good entry", corpus)
+	}
+	if got := string(corpus[0].Values[0].([]byte)); got != "abc" {
+		t.Errorf("got value %q, want %q", got, "abc")
+	}
+
+	corpus, err = ReadCorpus(filepath.Join(dir, "missing"), bytesType)
+	if err != nil || len(corpus) != 0 {
+		t.Errorf("reading a missing directory: got %v, %v; want empty corpus and no error", corpus, err)
+	}
+}
+
+func TestWriteToCorpus(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	data := marshalCorpusFile([]byte("hello"))
+	path, err := writeToCorpus(data, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path2, err := writeToCorpus(data, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != path2 {
+		t.Errorf("same data written to %s and %s", path, path2)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got file contents %q, want %q", got, data)
+	}
+}
+
+func TestCoverageHelpers(t *testing.T) {
+	base := []byte{0x01, 0x00, 0x06}
+	snap := []byte{0x03, 0x00, 0x02}
+	if diff := diffCoverage(base, snap); !bytes.Equal(diff, []byte{0x02, 0x00, 0x00}) {
+		t.Errorf("diffCoverage = %x", diff)
+	}
+	if diffCoverage(snap, snap) != nil {
+		t.Errorf("diffCoverage of identical coverage is not nil")
+	}
+	if n := countNewCoverageBits(base, snap); n != 1 {
+		t.Errorf("countNewCoverageBits = %d, want 1", n)
+	}
+	if isCoverageSubset(base, snap) {
+		t.Errorf("isCoverageSubset(%x, %x) = true", base, snap)
+	}
+	if !hasCoverageBit(base, snap) {
+		t.Errorf("hasCoverageBit(%x, %x) = false", base, snap)
+	}
+	if n := countBits(base); n != 3 {
+		t.Errorf("countBits = %d, want 3", n)
+	}
+}
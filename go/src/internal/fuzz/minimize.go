@@ -0,0 +1,128 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"reflect"
+)
+
+// isMinimizable reports whether a value of type t can be minimized.
+// Only byte slices and strings are minimized; numbers and booleans are
+// already as small as they can be.
+func isMinimizable(t reflect.Type) bool {
+	return t == reflect.TypeOf("") || t == reflect.TypeOf([]byte(nil))
+}
+
+// minimizeBytes tries to make v smaller while try(candidate) still reports
+// true, and returns the smallest value found. try must not retain its
+// argument. shouldStop is consulted before every attempt so that
+// minimization can be bounded in time or number of executions.
+func minimizeBytes(v []byte, try func([]byte) bool, shouldStop func() bool) []byte {
+	tmp := make([]byte, len(v))
+
+	// First, try to cut the tail.
+	for n := 1024; n != 0; n /= 2 {
+		for len(v) > n {
+			if shouldStop() {
+				return v
+			}
+			candidate := v[:len(v)-n]
+			if !try(candidate) {
+				break
+			}
+			// Set v to the new value to continue iterating.
+			v = candidate
+		}
+	}
+
+	// Then, try to remove each individual byte.
+	for i := 0; i < len(v)-1; i++ {
+		if shouldStop() {
+			return v
+		}
+		candidate := tmp[:len(v)-1]
+		copy(candidate[:i], v[:i])
+		copy(candidate[i:], v[i+1:])
+		if !try(candidate) {
+			continue
+		}
+		// Update v to delete the value at index i.
+		copy(v[i:], v[i+1:])
+		v = v[:len(candidate)]
+		// v[i] is now different, so decrement i to redo this iteration
+		// of the loop with the new value.
+		i--
+	}
+
+	// Then, try to remove each possible subset of bytes.
+	for i := 0; i < len(v)-1; i++ {
+		copy(tmp, v[:i])
+		for j := len(v); j > i+1; j-- {
+			if shouldStop() {
+				return v
+			}
+			candidate := tmp[:len(v)-j+i]
+			copy(candidate[i:], v[j:])
+			if !try(candidate) {
+				continue
+			}
+			// Update v and reset the loop with the new length.
+			copy(v[i:], v[j:])
+			v = v[:len(candidate)]
+			j = len(v)
+		}
+	}
+
+	// Then, try to make it more simplified and human-readable by trying to replace each
+	// byte with a printable character.
+	printableChars := []byte("012789ABCXYZabcxyz !\"#$%&'()*+,.")
+	for i, b := range v {
+		if shouldStop() {
+			return v
+		}
+
+		for _, pc := range printableChars {
+			v[i] = pc
+			if try(v) {
+				// Successful. Move on to the next byte in v.
+				break
+			}
+			// Unsuccessful. Revert v[i] back to original value.
+			v[i] = b
+		}
+	}
+	return v
+}
+
+// minimizeInput minimizes each minimizable value in vals in turn, keeping
+// every change for which stillFails reports true. vals is updated in place.
+func minimizeInput(vals []interface{}, stillFails func([]interface{}) bool, shouldStop func() bool) {
+	for valI := range vals {
+		switch v := vals[valI].(type) {
+		case []byte:
+			try := func(candidate []byte) bool {
+				vals[valI] = append([]byte(nil), candidate...)
+				if stillFails(vals) {
+					return true
+				}
+				vals[valI] = v
+				return false
+			}
+			smaller := minimizeBytes(append([]byte(nil), v...), try, shouldStop)
+			vals[valI] = append([]byte(nil), smaller...)
+		case string:
+			try := func(candidate []byte) bool {
+				vals[valI] = string(candidate)
+				if stillFails(vals) {
+					return true
+				}
+				vals[valI] = v
+				return false
+			}
+			smaller := minimizeBytes([]byte(v), try, shouldStop)
+			vals[valI] = string(smaller)
+		}
+	}
+}
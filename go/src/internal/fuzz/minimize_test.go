@@ -0,0 +1,102 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMinimizeInput(t *testing.T) {
+	type testcase struct {
+		name     string
+		fn       func([]interface{}) bool
+		input    []interface{}
+		expected []interface{}
+	}
+	cases := []testcase{
+		{
+			name: "ones_byte",
+			fn: func(vals []interface{}) bool {
+				b := vals[0].([]byte)
+				ones := 0
+				for _, v := range b {
+					if v == 1 {
+						ones++
+					}
+				}
+				return ones == 3
+			},
+			input:    []interface{}{[]byte{0, 1, 1, 0, 1, 0, 0, 1, 1, 0, 1}},
+			expected: []interface{}{[]byte{1, 1, 1}},
+		},
+		{
+			name: "single_bytes",
+			fn: func(vals []interface{}) bool {
+				b := vals[0].([]byte)
+				return len(b) >= 2
+			},
+			input:    []interface{}{[]byte{1, 2, 3, 4, 5}},
+			expected: []interface{}{[]byte("00")},
+		},
+		{
+			name: "set_of_bytes",
+			fn: func(vals []interface{}) bool {
+				b := vals[0].([]byte)
+				return bytes.Index(b, []byte{0, 1, 2}) >= 0 && bytes.Index(b, []byte{4, 5}) >= 0
+			},
+			input:    []interface{}{[]byte{0, 1, 2, 3, 4, 5}},
+			expected: []interface{}{[]byte{0, 1, 2, 4, 5}},
+		},
+		{
+			name: "ones_string",
+			fn: func(vals []interface{}) bool {
+				return strings.Count(vals[0].(string), "1") == 3
+			},
+			input:    []interface{}{"001010001000000000000000000"},
+			expected: []interface{}{"111"},
+		},
+		{
+			name: "non_minimizable",
+			fn: func(vals []interface{}) bool {
+				return vals[0].(int) == 1234 && len(vals[1].(string)) > 0
+			},
+			input:    []interface{}{1234, "abcdef"},
+			expected: []interface{}{1234, "0"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			vals := make([]interface{}, len(tc.input))
+			copy(vals, tc.input)
+			minimizeInput(vals, tc.fn, func() bool { return false })
+			if !reflect.DeepEqual(vals, tc.expected) {
+				t.Errorf("unexpected results: got %v, want %v", vals, tc.expected)
+			}
+		})
+	}
+}
+
+// TestMinimizeStop checks that minimization stops as soon as shouldStop
+// reports true, leaving the input unchanged.
+func TestMinimizeStop(t *testing.T) {
+	input := []byte("0123456789")
+	calls := 0
+	try := func([]byte) bool {
+		calls++
+		return true
+	}
+	got := minimizeBytes(append([]byte(nil), input...), try, func() bool { return true })
+	if !bytes.Equal(got, input) {
+		t.Errorf("got %q, want %q", got, input)
+	}
+	if calls != 0 {
+		t.Errorf("try was called %d times, want 0", calls)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func BenchmarkMutatorBytes(b *testing.B) {
+	for _, size := range []int{
+		1,
+		10,
+		100,
+		1000,
+		10000,
+		100000,
+	} {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := make([]byte, size)
+			b.ResetTimer()
+			m := newMutator(1)
+
+			for i := 0; i < b.N; i++ {
+				// resize buffer to the correct shape
+				buf = buf[0:size]
+				vals := []interface{}{buf}
+				m.mutate(vals, maxInputSize)
+			}
+		})
+	}
+}
+
+// TestMutatorKeepsTypes checks that mutating values never changes their
+// types, and never modifies the byte slices it was given.
+func TestMutatorKeepsTypes(t *testing.T) {
+	m := newMutator(1)
+	orig := []byte("abcdef")
+	vals := []interface{}{
+		[]byte(nil), orig, "", "hello", false, byte(0), rune(0), float32(0),
+		float64(0), int(0), int8(0), int16(0), int64(0), uint(0), uint16(0),
+		uint32(0), uint64(0),
+	}
+	for i := 0; i < 10000; i++ {
+		mutated := make([]interface{}, len(vals))
+		copy(mutated, vals)
+		m.mutate(mutated, maxInputSize)
+		for j := range vals {
+			if got, want := fmt.Sprintf("%T", mutated[j]), fmt.Sprintf("%T", vals[j]); got != want {
+				t.Fatalf("value %d changed type: got %s, want %s", j, got, want)
+			}
+		}
+	}
+	if !bytes.Equal(orig, []byte("abcdef")) {
+		t.Errorf("mutate modified its input: %q", orig)
+	}
+}
+
+func TestMutatorDeterministic(t *testing.T) {
+	run := func() []interface{} {
+		m := newMutator(42)
+		vals := []interface{}{[]byte("fuzz"), "string", int64(7)}
+		for i := 0; i < 100; i++ {
+			m.mutate(vals, maxInputSize)
+		}
+		return vals
+	}
+	a, b := fmt.Sprint(run()), fmt.Sprint(run())
+	if a != b {
+		t.Errorf("mutator with the same seed produced different results:\n%s\n%s", a, b)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package fuzz
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setWorkerComm configures cmd to pass the pipes in comm to the worker
+// process as file descriptors 3 and 4.
+func setWorkerComm(cmd *exec.Cmd, comm workerComm) error {
+	cmd.ExtraFiles = []*os.File{comm.fuzzIn, comm.fuzzOut}
+	return nil
+}
+
+// getWorkerComm returns the pipes passed to this worker process by
+// setWorkerComm.
+func getWorkerComm() (workerComm, error) {
+	return workerComm{
+		fuzzIn:  os.NewFile(3, "fuzz_in"),
+		fuzzOut: os.NewFile(4, "fuzz_out"),
+	}, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// workerHandlesEnv is the environment variable that tells a worker process
+// which handles to use to communicate with the coordinator.
+const workerHandlesEnv = "GO_TEST_FUZZ_WORKER_HANDLES"
+
+// setWorkerComm configures cmd to pass the pipes in comm to the worker
+// process. Windows has no equivalent of ExtraFiles, so the worker process
+// inherits the handles and learns their values from workerHandlesEnv.
+func setWorkerComm(cmd *exec.Cmd, comm workerComm) error {
+	fuzzIn := syscall.Handle(comm.fuzzIn.Fd())
+	fuzzOut := syscall.Handle(comm.fuzzOut.Fd())
+	for _, h := range []syscall.Handle{fuzzIn, fuzzOut} {
+		if err := syscall.SetHandleInformation(h, syscall.HANDLE_FLAG_INHERIT, 1); err != nil {
+			return err
+		}
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%x,%x", workerHandlesEnv, fuzzIn, fuzzOut))
+	cmd.SysProcAttr = &syscall.SysProcAttr{AdditionalInheritedHandles: []syscall.Handle{fuzzIn, fuzzOut}}
+	return nil
+}
+
+// getWorkerComm returns the pipes passed to this worker process by
+// setWorkerComm.
+func getWorkerComm() (workerComm, error) {
+	v := os.Getenv(workerHandlesEnv)
+	if v == "" {
+		return workerComm{}, fmt.Errorf("%s not set", workerHandlesEnv)
+	}
+	var fuzzIn, fuzzOut uintptr
+	if _, err := fmt.Sscanf(v, "%x,%x", &fuzzIn, &fuzzOut); err != nil {
+		return workerComm{}, fmt.Errorf("parsing %s=%s: %v", workerHandlesEnv, v, err)
+	}
+	return workerComm{
+		fuzzIn:  os.NewFile(fuzzIn, "fuzz_in"),
+		fuzzOut: os.NewFile(fuzzOut, "fuzz_out"),
+	}, nil
+}
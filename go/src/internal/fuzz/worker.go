@@ -0,0 +1,320 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// workerHangTimeout is how long the coordinator waits for the worker to
+// finish with an input before deciding that the input makes it hang.
+var workerHangTimeout = 10 * time.Second
+
+// worker manages a worker process on behalf of the coordinator.
+//
+// The worker process is a copy of the test binary, started with the same
+// arguments plus -test.fuzzworker. It calls the fuzz function on each input
+// the coordinator sends it and reports the result. Running inputs in a
+// separate process lets the coordinator catch failures that would otherwise
+// take it down too: a panic in another goroutine, a call to os.Exit, or a
+// hang. When that happens, the coordinator stops the worker process and
+// reports the input as failing; the next input starts a new one.
+//
+// The coordinator sends runArgs to the worker process over one pipe and
+// reads runResponses from another, both encoded as JSON. setWorkerComm and
+// getWorkerComm pass the pipes from one process to the other.
+type worker struct {
+	cmd    *exec.Cmd        // running worker process, or nil if none
+	fuzzIn *os.File         // coordinator's end of the pipe for runArgs
+	enc    *json.Encoder    // encodes runArgs to fuzzIn
+	resps  chan runResponse // runResponses read from the worker process
+	out    lockedBuffer     // worker process's stdout and stderr
+}
+
+// workerComm holds the worker process's ends of the pipes it uses to
+// communicate with the coordinator.
+type workerComm struct {
+	fuzzIn  *os.File // worker reads runArgs from fuzzIn
+	fuzzOut *os.File // worker writes runResponses to fuzzOut
+}
+
+// runArgs asks the worker to call the fuzz function on one input.
+type runArgs struct {
+	// Data is the input, encoded as a corpus file.
+	Data []byte
+
+	// CoverageMask, if non-nil, is the coverage the coordinator has already
+	// seen. The coordinator sends it with the first input it gives a worker
+	// process; the worker process keeps it up to date from then on.
+	CoverageMask []byte
+}
+
+// runResponse is the result of calling the fuzz function on one input.
+type runResponse struct {
+	// Err is the failure the fuzz function reported, or "" if it passed.
+	Err string
+
+	// Coverage is the coverage snapshot for the input if the input reached
+	// coverage that wasn't in the worker's coverage mask, or nil otherwise.
+	Coverage []byte
+
+	// InternalErr reports a problem in the worker itself, such as an input
+	// it could not decode.
+	InternalErr string
+}
+
+// run sends an input to the worker process, starting one if needed, and
+// waits for the result. mask is the coordinator's coverage mask, which is
+// sent to a new worker process along with its first input.
+//
+// If the worker process exits or doesn't respond within workerHangTimeout,
+// run stops it and reports the input as failing, with the process's output
+// in the error. run returns a non-nil error only if ctx is done or the
+// worker can't be started.
+func (w *worker) run(ctx context.Context, data, mask []byte) (runResponse, error) {
+	args := runArgs{Data: data}
+	if w.cmd == nil {
+		if err := w.start(ctx); err != nil {
+			return runResponse{}, err
+		}
+		args.CoverageMask = mask
+	}
+
+	w.out.Reset()
+	// If the worker process has exited, Encode fails, and so does reading
+	// the response, which reports the exit below.
+	w.enc.Encode(args)
+
+	timer := time.NewTimer(workerHangTimeout)
+	defer timer.Stop()
+	select {
+	case resp, ok := <-w.resps:
+		if !ok {
+			err := w.wait()
+			if ctx.Err() != nil {
+				return runResponse{}, ctx.Err()
+			}
+			if err == nil {
+				err = errors.New("exit status 0")
+			}
+			return runResponse{Err: w.crashMessage("fuzzing process terminated unexpectedly: %v", err)}, nil
+		}
+		if resp.InternalErr != "" {
+			w.stop()
+			return runResponse{}, fmt.Errorf("fuzzing process: %s", resp.InternalErr)
+		}
+		return resp, nil
+
+	case <-timer.C:
+		w.kill()
+		return runResponse{Err: w.crashMessage("fuzzing process hung: no result after %v", workerHangTimeout)}, nil
+
+	case <-ctx.Done():
+		w.kill()
+		return runResponse{}, ctx.Err()
+	}
+}
+
+// start starts a worker process and waits until it is ready for inputs.
+func (w *worker) start(ctx context.Context) error {
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := append(os.Args[1:len(os.Args):len(os.Args)], "-test.fuzzworker")
+	cmd := exec.Command(bin, args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = &w.out
+	cmd.Stderr = &w.out
+
+	fuzzInR, fuzzInW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	fuzzOutR, fuzzOutW, err := os.Pipe()
+	if err != nil {
+		fuzzInR.Close()
+		fuzzInW.Close()
+		return err
+	}
+	err = setWorkerComm(cmd, workerComm{fuzzIn: fuzzInR, fuzzOut: fuzzOutW})
+	if err == nil {
+		err = cmd.Start()
+	}
+	// The worker process has its own copies of these now.
+	fuzzInR.Close()
+	fuzzOutW.Close()
+	if err != nil {
+		fuzzInW.Close()
+		fuzzOutR.Close()
+		return fmt.Errorf("starting fuzzing process: %v", err)
+	}
+
+	// The channel has room for one response so that this goroutine can
+	// exit even if the coordinator gave up waiting for it.
+	resps := make(chan runResponse, 1)
+	go func() {
+		defer close(resps)
+		defer fuzzOutR.Close()
+		dec := json.NewDecoder(fuzzOutR)
+		for {
+			var resp runResponse
+			if err := dec.Decode(&resp); err != nil {
+				return
+			}
+			resps <- resp
+		}
+	}()
+
+	w.cmd = cmd
+	w.fuzzIn = fuzzInW
+	w.enc = json.NewEncoder(fuzzInW)
+	w.resps = resps
+
+	// The worker process sends an empty response once it is ready, so that
+	// the time it takes to start doesn't count toward workerHangTimeout.
+	w.out.Reset()
+	select {
+	case _, ok := <-resps:
+		if !ok {
+			err := w.wait()
+			if err == nil {
+				err = errors.New("exit status 0")
+			}
+			return errors.New(w.crashMessage("fuzzing process exited before it was ready: %v", err))
+		}
+		return nil
+	case <-ctx.Done():
+		w.kill()
+		return ctx.Err()
+	}
+}
+
+// wait waits for the worker process to exit and returns its exit status.
+func (w *worker) wait() error {
+	err := w.cmd.Wait()
+	w.fuzzIn.Close()
+	w.cmd = nil
+	return err
+}
+
+// kill stops the worker process immediately.
+func (w *worker) kill() {
+	w.cmd.Process.Kill()
+	w.wait()
+}
+
+// stop tells the worker process to exit, and waits for it to do so. If it
+// takes longer than workerHangTimeout, stop kills it.
+func (w *worker) stop() {
+	if w.cmd == nil {
+		return
+	}
+	// Closing fuzzIn tells the worker process there are no more inputs.
+	w.fuzzIn.Close()
+	p := w.cmd.Process
+	t := time.AfterFunc(workerHangTimeout, func() { p.Kill() })
+	defer t.Stop()
+	w.wait()
+}
+
+// crashMessage returns the message for an input that made the worker
+// process exit or hang, followed by what the process printed while it was
+// running the input.
+func (w *worker) crashMessage(format string, args ...interface{}) string {
+	msg := fmt.Sprintf(format, args...)
+	if out := bytes.TrimSpace(w.out.Bytes()); len(out) > 0 {
+		msg += "\n" + string(out)
+	}
+	return msg
+}
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// Bytes returns a copy of the buffer's contents.
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+// RunFuzzWorker is called in a worker process to communicate with the
+// coordinator process in order to fuzz random inputs. It calls fn on each
+// input the coordinator sends and reports the results, and returns when
+// the coordinator has no more inputs.
+//
+// fn is a wrapper on the fuzz function. It may return an error to indicate
+// a given input failed. As in CoordinateFuzzing, it must reset and
+// snapshot the coverage counters around the call to the fuzz target.
+func RunFuzzWorker(fn func(CorpusEntry) error) error {
+	comm, err := getWorkerComm()
+	if err != nil {
+		return err
+	}
+	defer comm.fuzzIn.Close()
+	defer comm.fuzzOut.Close()
+
+	dec := json.NewDecoder(comm.fuzzIn)
+	enc := json.NewEncoder(comm.fuzzOut)
+	// Tell the coordinator we're ready.
+	if err := enc.Encode(runResponse{}); err != nil {
+		return err
+	}
+	mask := make([]byte, len(coverageSnapshot))
+	for {
+		var args runArgs
+		if err := dec.Decode(&args); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if args.CoverageMask != nil {
+			if len(args.CoverageMask) != len(mask) {
+				return fmt.Errorf("coverage mask has %d bytes, want %d", len(args.CoverageMask), len(mask))
+			}
+			mask = args.CoverageMask
+		}
+
+		var resp runResponse
+		if vals, err := unmarshalCorpusFile(args.Data); err != nil {
+			resp.InternalErr = err.Error()
+		} else if err := fn(CorpusEntry{Values: vals}); err != nil {
+			resp.Err = err.Error()
+		} else if coverageEnabled && countNewCoverageBits(mask, coverageSnapshot) > 0 {
+			resp.Coverage = append([]byte(nil), coverageSnapshot...)
+			for i := range mask {
+				mask[i] |= coverageSnapshot[i]
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
@@ -100,31 +100,29 @@ func Parse(r io.Reader, bin string) (ParseResult, error) {
 // parse parses, post-processes and verifies the trace. It returns the
 // trace version and the list of events.
 func parse(r io.Reader, bin string) (int, ParseResult, error) {
-	ver, rawEvents, strings, err := readTrace(r)
+	tr, err := NewReader(r, bin)
 	if err != nil {
 		return 0, ParseResult{}, err
 	}
-	events, stacks, err := parseEvents(ver, rawEvents, strings)
-	if err != nil {
-		return 0, ParseResult{}, err
-	}
-	events = removeFutile(events)
-	err = postProcessTrace(ver, events)
-	if err != nil {
-		return 0, ParseResult{}, err
-	}
-	// Attach stack traces.
-	for _, ev := range events {
-		if ev.StkID != 0 {
-			ev.Stk = stacks[ev.StkID]
+	var res ParseResult
+	for {
+		part, err := tr.Next()
+		if err == io.EOF {
+			break
 		}
-	}
-	if ver < 1007 && bin != "" {
-		if err := symbolize(events, bin); err != nil {
+		if err != nil {
 			return 0, ParseResult{}, err
 		}
+		if res.Stacks == nil {
+			res = part
+			continue
+		}
+		res.Events = append(res.Events, part.Events...)
+		for id, stk := range part.Stacks {
+			res.Stacks[id] = stk
+		}
 	}
-	return ver, ParseResult{Events: events, Stacks: stacks}, nil
+	return tr.Version(), res, nil
 }
 
 // rawEvent is a helper type used during parsing.
@@ -135,29 +133,46 @@ type rawEvent struct {
 	sargs []string
 }
 
-// readTrace does wire-format parsing and verification.
+// rawReader does wire-format parsing and verification.
 // It does not care about specific event types and argument meaning.
-func readTrace(r io.Reader) (ver int, events []rawEvent, strings map[uint64]string, err error) {
-	// Read and validate trace header.
+type rawReader struct {
+	r   io.Reader
+	off int // offset in the input
+	ver int // trace version, set by readHeader
+}
+
+// readHeader reads and validates the trace header.
+func (rr *rawReader) readHeader() error {
 	var buf [16]byte
-	off, err := io.ReadFull(r, buf[:])
+	off, err := io.ReadFull(rr.r, buf[:])
 	if err != nil {
-		err = fmt.Errorf("failed to read header: read %v, err %v", off, err)
-		return
+		return fmt.Errorf("failed to read header: read %v, err %v", off, err)
 	}
-	ver, err = parseHeader(buf[:])
+	rr.off = off
+	ver, err := parseHeader(buf[:])
 	if err != nil {
-		return
+		return err
 	}
 	switch ver {
-	case 1005, 1007, 1008, 1009, 1010, 1011:
+	case 1005, 1007, 1008, 1009, 1010, 1011, 1018:
 		// Note: When adding a new version, add canned traces
 		// from the old version to the test suite using mkcanned.bash.
 		break
 	default:
-		err = fmt.Errorf("unsupported trace file version %v.%v (update Go toolchain) %v", ver/1000, ver%1000, ver)
-		return
+		return fmt.Errorf("unsupported trace file version %v.%v (update Go toolchain) %v", ver/1000, ver%1000, ver)
 	}
+	rr.ver = ver
+	return nil
+}
+
+// read reads the events of the trace. Traces produced by Go 1.18 and
+// later are divided into partitions, each ending with an EvPartition
+// event; for those, read reads the events of one partition, that event
+// included, and returns io.EOF if there are no more partitions.
+func (rr *rawReader) read() (events []rawEvent, strings map[uint64]string, err error) {
+	r, ver, off := rr.r, rr.ver, rr.off
+	defer func() { rr.off = off }()
+	var buf [1]byte
 
 	// Read events.
 	strings = make(map[uint64]string)
@@ -167,6 +182,12 @@ func readTrace(r io.Reader) (ver int, events []rawEvent, strings map[uint64]stri
 		var n int
 		n, err = r.Read(buf[:1])
 		if err == io.EOF {
+			if ver >= 1018 {
+				if len(events) != 0 {
+					err = fmt.Errorf("trace ends in the middle of a partition at offset 0x%x", off0)
+				}
+				return
+			}
 			err = nil
 			break
 		}
@@ -266,6 +287,9 @@ func readTrace(r io.Reader) (ver int, events []rawEvent, strings map[uint64]stri
 			ev.sargs = append(ev.sargs, s)
 		}
 		events = append(events, ev)
+		if ev.typ == EvPartition {
+			break
+		}
 	}
 	return
 }
@@ -315,6 +339,7 @@ func parseHeader(buf []byte) (int, error) {
 // It does analyze and verify per-event-type arguments.
 func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (events []*Event, stacks map[uint64][]*Frame, err error) {
 	var ticksPerSec, lastSeq, lastTs int64
+	var partition []uint64
 	var lastG uint64
 	var lastP int
 	timerGoids := make(map[uint64]bool)
@@ -353,6 +378,8 @@ func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (even
 				err = ErrTimeOrder
 				return
 			}
+		case EvPartition:
+			partition = raw.args
 		case EvTimerGoroutine:
 			timerGoids[raw.args[0]] = true
 		case EvStack:
@@ -456,10 +483,14 @@ func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (even
 		err = fmt.Errorf("trace is empty")
 		return
 	}
-	if ticksPerSec == 0 {
+	if ver < 1018 && ticksPerSec == 0 {
 		err = fmt.Errorf("no EvFrequency event")
 		return
 	}
+	if ver >= 1018 && partition == nil {
+		err = fmt.Errorf("no EvPartition event")
+		return
+	}
 	if BreakTimestampsForTesting {
 		var batchArr [][]*Event
 		for _, batch := range batches {
@@ -479,12 +510,26 @@ func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (even
 		return
 	}
 
-	// Translate cpu ticks to real time.
-	minTs := events[0].Ts
-	// Use floating point to avoid integer overflows.
-	freq := 1e9 / float64(ticksPerSec)
+	// Translate cpu ticks to real time. Timestamps of traces with
+	// partitions are translated to the nanotime clock, using the clock
+	// readings at the start and end of the partition; older traces start
+	// at 0.
+	var ticks0, time0 int64
+	var freq float64 // Use floating point to avoid integer overflows.
+	if ver < 1018 {
+		ticks0 = events[0].Ts
+		freq = 1e9 / float64(ticksPerSec)
+	} else {
+		ticks0, time0 = int64(partition[1]), int64(partition[2])
+		ticks1, time1 := int64(partition[3]), int64(partition[4])
+		if ticks1 <= ticks0 || time1 <= time0 {
+			err = ErrTimeOrder
+			return
+		}
+		freq = float64(time1-time0) / float64(ticks1-ticks0)
+	}
 	for _, ev := range events {
-		ev.Ts = int64(float64(ev.Ts-minTs) * freq)
+		ev.Ts = time0 + int64(float64(ev.Ts-ticks0)*freq)
 		// Move timers and syscalls to separate fake Ps.
 		if timerGoids[ev.G] && ev.Type == EvGoUnblock {
 			ev.P = TimerP
@@ -976,7 +1021,7 @@ func argNum(raw rawEvent, ver int) int {
 		narg++
 	}
 	switch raw.typ {
-	case EvBatch, EvFrequency, EvTimerGoroutine:
+	case EvBatch, EvFrequency, EvTimerGoroutine, EvPartition:
 		if ver < 1007 {
 			narg++ // there was an unused arg before 1.7
 		}
@@ -1011,7 +1056,7 @@ var BreakTimestampsForTesting bool
 const (
 	EvNone              = 0  // unused
 	EvBatch             = 1  // start of per-P batch of events [pid, timestamp]
-	EvFrequency         = 2  // contains tracer timer frequency [frequency (ticks per second)]
+	EvFrequency         = 2  // not currently used; previously contained tracer timer frequency [frequency (ticks per second)]
 	EvStack             = 3  // stack [stack id, number of PCs, array of {PC, func string ID, file string ID, line}]
 	EvGomaxprocs        = 4  // current value of GOMAXPROCS [timestamp, GOMAXPROCS, stack id]
 	EvProcStart         = 5  // start of P [timestamp, thread id]
@@ -1058,7 +1103,8 @@ const (
 	EvUserTaskEnd       = 46 // end of task [timestamp, internal task id, stack]
 	EvUserRegion        = 47 // trace.WithRegion [timestamp, internal task id, mode(0:start, 1:end), stack, name string]
 	EvUserLog           = 48 // trace.Log [timestamp, internal id, key string id, stack, value string]
-	EvCount             = 49
+	EvPartition         = 49 // end of partition [partition seq, start ticks, start nanotime, end ticks, end nanotime]
+	EvCount             = 50
 )
 
 var EventDescriptions = [EvCount]struct {
@@ -1117,4 +1163,5 @@ var EventDescriptions = [EvCount]struct {
 	EvUserTaskEnd:       {"UserTaskEnd", 1011, true, []string{"taskid"}, nil},
 	EvUserRegion:        {"UserRegion", 1011, true, []string{"taskid", "mode", "typeid"}, []string{"name"}},
 	EvUserLog:           {"UserLog", 1011, true, []string{"id", "keyid"}, []string{"category", "message"}},
+	EvPartition:         {"Partition", 1018, false, []string{"seq", "ticksstart", "timestart", "ticksend", "timeend"}, nil},
 }
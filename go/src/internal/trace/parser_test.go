@@ -6,6 +6,7 @@ package trace
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -108,3 +109,131 @@ func TestTimestampOverflow(t *testing.T) {
 		t.Fatalf("failed to parse: %v", err)
 	}
 }
+
+// writePartitions writes a trace with two partitions to w. Goroutine 1
+// blocks in the first partition and is unblocked in the second one by
+// goroutine 2, which is runnable when the first partition ends.
+// The first partition has sequence number seq0.
+func writePartitions(w *Writer, seq0 uint64) {
+	w.Emit(EvBatch, 0, 0)
+	w.Emit(EvGoCreate, 1, 1, 1, 0)
+	w.Emit(EvGoCreate, 1, 2, 1, 0)
+	w.Emit(EvProcStart, 1, 0)
+	w.Emit(EvGoStart, 1, 1, 1)
+	w.Emit(EvGoBlock, 1, 0)
+	w.Emit(EvGoStart, 1, 2, 1)
+	w.Emit(EvGoSched, 1, 0)
+	w.Emit(EvProcStop, 1)
+	w.Emit(EvStack, 1, 1, 0x100, 0, 0, 10)
+	w.Emit(EvPartition, seq0, 0, 1000, 10, 1010)
+
+	// The second partition starts with the state of both goroutines.
+	w.Emit(EvBatch, 0, 11)
+	w.Emit(EvGoCreate, 1, 1, 1, 0)
+	w.Emit(EvGoWaiting, 1, 1)
+	w.Emit(EvGoCreate, 1, 2, 1, 0)
+	w.Emit(EvProcStart, 1, 0)
+	w.Emit(EvGoStart, 1, 2, 1)
+	w.Emit(EvGoUnblock, 1, 1, 2, 0)
+	w.Emit(EvGoEnd, 1)
+	w.Emit(EvGoStart, 1, 1, 3)
+	w.Emit(EvGoEnd, 1)
+	w.Emit(EvProcStop, 1)
+	w.Emit(EvStack, 1, 1, 0x200, 0, 0, 20)
+	w.Emit(EvPartition, seq0+1, 11, 1011, 22, 1022)
+}
+
+func TestParsePartitions(t *testing.T) {
+	w := NewWriterVersion(1018)
+	writePartitions(w, 0)
+	res, err := Parse(w, "")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	var types []string
+	for _, ev := range res.Events {
+		types = append(types, EventDescriptions[ev.Type].Name)
+	}
+	want := "GoCreate GoCreate ProcStart GoStart GoBlock GoStart GoSched ProcStop " +
+		"ProcStart GoStart GoUnblock GoEnd GoStart GoEnd ProcStop"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("got events %s, want %s", got, want)
+	}
+	evs := res.Events
+	if evs[0].Ts != 0 || evs[len(evs)-1].Ts != 20 {
+		t.Errorf("got timestamps %d-%d, want 0-20", evs[0].Ts, evs[len(evs)-1].Ts)
+	}
+	// Links cross partitions.
+	if block, unblock := evs[4], evs[10]; block.Link != unblock {
+		t.Errorf("GoBlock is linked to %v, want %v", block.Link, unblock)
+	}
+	if sched, start := evs[6], evs[9]; sched.Link != start {
+		t.Errorf("GoSched is linked to %v, want %v", sched.Link, start)
+	}
+	// Stack IDs are unique across partitions.
+	if len(res.Stacks) != 2 {
+		t.Errorf("got %d stacks, want 2", len(res.Stacks))
+	}
+	for _, tc := range []struct {
+		i  int
+		pc uint64
+	}{{3, 0x100}, {9, 0x200}} {
+		ev := evs[tc.i]
+		if len(ev.Stk) != 1 || ev.Stk[0].PC != tc.pc {
+			t.Errorf("%v has stack %v, want PC %#x", ev, ev.Stk, tc.pc)
+		}
+	}
+}
+
+func TestReaderPartitions(t *testing.T) {
+	w := NewWriterVersion(1018)
+	writePartitions(w, 5)
+	r, err := NewReader(w, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver := r.Version(); ver != 1018 {
+		t.Errorf("got version %d, want 1018", ver)
+	}
+	for _, n := range []int{8, 7} {
+		res, err := r.Next()
+		if err != nil {
+			t.Fatalf("failed to parse partition: %v", err)
+		}
+		if len(res.Events) != n {
+			t.Errorf("got %d events, want %d", len(res.Events), n)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v after the last partition, want io.EOF", err)
+	}
+}
+
+func TestBrokenPartitions(t *testing.T) {
+	tests := map[string]func() []byte{
+		"truncated": func() []byte {
+			w := NewWriterVersion(1018)
+			writePartitions(w, 0)
+			data := w.Bytes()
+			return data[:len(data)-8]
+		},
+		"missing": func() []byte {
+			w := NewWriterVersion(1018)
+			writePartitions(w, 0)
+			writePartitions(w, 3)
+			return w.Bytes()
+		},
+		"no partition": func() []byte {
+			w := NewWriterVersion(1018)
+			w.Emit(EvBatch, 0, 0)
+			w.Emit(EvFrequency, 1e9)
+			w.Emit(EvGoCreate, 1, 1, 0, 0)
+			return w.Bytes()
+		},
+	}
+	for name, data := range tests {
+		if _, err := Parse(bytes.NewReader(data()), ""); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reader parses a trace incrementally. Traces produced by Go 1.18 and
+// later are divided into partitions, which Next parses one at a time;
+// older traces are parsed in one piece.
+type Reader struct {
+	raw  rawReader
+	bin  string
+	n    int  // number of pieces returned by Next
+	done bool // the whole trace has been returned
+
+	// State carried from one partition to the next.
+	seq    uint64            // sequence number of the last partition
+	minTs  int64             // timestamp of the first event of the trace
+	stkOff uint64            // offset of the stack IDs of the next partition
+	live   map[uint64]bool   // goroutines alive at the end of the last partition
+	last   map[uint64]*Event // last event of a goroutine that is to be linked
+}
+
+// NewReader reads the header of the trace in r, and returns a Reader
+// for the rest of it. bin is the binary that produced the trace, as
+// for Parse.
+func NewReader(r io.Reader, bin string) (*Reader, error) {
+	tr := &Reader{
+		raw:  rawReader{r: r},
+		bin:  bin,
+		live: make(map[uint64]bool),
+		last: make(map[uint64]*Event),
+	}
+	if err := tr.raw.readHeader(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// Version returns the version of the trace format, such as 1018 for a
+// trace produced by Go 1.18.
+func (r *Reader) Version() int {
+	return r.raw.ver
+}
+
+// Next parses, post-processes and verifies the next partition of the
+// trace, and returns io.EOF if there are no more partitions.
+//
+// The partitions Next returns are consistent with each other: stack IDs
+// are unique across the trace, timestamps are relative to the first
+// event of the first partition, and the events that only restate the
+// state of goroutines known from the previous partition are removed.
+// The Link of the last event of such a goroutine in the previous
+// partition is set when Next parses the event it links to.
+func (r *Reader) Next() (ParseResult, error) {
+	if r.done {
+		return ParseResult{}, io.EOF
+	}
+	ver := r.raw.ver
+	rawEvents, strings, err := r.raw.read()
+	if err == io.EOF && r.n == 0 {
+		err = fmt.Errorf("trace is empty")
+	}
+	if err != nil {
+		r.done = true
+		return ParseResult{}, err
+	}
+	if ver < 1018 {
+		r.done = true
+	}
+	events, stacks, err := parseEvents(ver, rawEvents, strings)
+	if err != nil {
+		r.done = true
+		return ParseResult{}, err
+	}
+	if ver >= 1018 {
+		seq := rawEvents[len(rawEvents)-1].args[0]
+		if r.n == 0 {
+			r.minTs = events[0].Ts
+		} else if seq != r.seq+1 {
+			r.done = true
+			return ParseResult{}, fmt.Errorf("partition %d follows partition %d", seq, r.seq)
+		}
+		r.seq = seq
+		for _, ev := range events {
+			ev.Ts -= r.minTs
+		}
+		stacks = r.renumberStacks(events, stacks)
+	}
+	events = removeFutile(events)
+	err = postProcessTrace(ver, events)
+	if err != nil {
+		r.done = true
+		return ParseResult{}, err
+	}
+	if ver >= 1018 {
+		events = r.join(events)
+	}
+	// Attach stack traces.
+	for _, ev := range events {
+		if ev.StkID != 0 {
+			ev.Stk = stacks[ev.StkID]
+		}
+	}
+	if ver < 1007 && r.bin != "" {
+		if err := symbolize(events, r.bin); err != nil {
+			r.done = true
+			return ParseResult{}, err
+		}
+	}
+	r.n++
+	return ParseResult{Events: events, Stacks: stacks}, nil
+}
+
+// Unlinked returns the events of the goroutines alive at the end of
+// the last partition returned by Next that a later partition may set
+// the Link of: the last event of each goroutine that is not running.
+func (r *Reader) Unlinked() []*Event {
+	var events []*Event
+	for _, ev := range r.last {
+		events = append(events, ev)
+	}
+	return events
+}
+
+// renumberStacks makes the stack IDs of a partition, which start at 1
+// in every partition, unique across the trace.
+func (r *Reader) renumberStacks(events []*Event, stacks map[uint64][]*Frame) map[uint64][]*Frame {
+	off := r.stkOff
+	renumber := func(id uint64) uint64 {
+		if id == 0 {
+			return 0
+		}
+		if id+off > r.stkOff {
+			r.stkOff = id + off
+		}
+		return id + off
+	}
+	for _, ev := range events {
+		ev.StkID = renumber(ev.StkID)
+		if ev.Type == EvGoCreate {
+			ev.Args[1] = renumber(ev.Args[1])
+		}
+	}
+	res := make(map[uint64][]*Frame, len(stacks))
+	for id, stk := range stacks {
+		res[renumber(id)] = stk
+	}
+	return res
+}
+
+// join removes the events that restate the state of goroutines known
+// from the previous partition, which every partition starts with, and
+// links the last events of these goroutines in the previous partition
+// to the events that follow them in this one.
+func (r *Reader) join(events []*Event) []*Event {
+	known := r.live
+	live := make(map[uint64]bool, len(known))
+	inSyscall := make(map[uint64]bool)
+	link := func(g uint64, ev *Event) {
+		if last := r.last[g]; last != nil && last.Link == nil {
+			last.Link = ev
+		}
+	}
+	newEvents := events[:0] // overwrite the original slice
+	for _, ev := range events {
+		switch ev.Type {
+		case EvGoCreate:
+			g := ev.Args[0]
+			live[g] = true
+			if known[g] {
+				// The goroutine was runnable, unless EvGoWaiting or
+				// EvGoInSyscall follows; then the Link is nil.
+				if ev.Link != nil {
+					link(g, ev.Link)
+				}
+				continue
+			}
+		case EvGoWaiting:
+			if known[ev.G] {
+				if ev.Link != nil {
+					link(ev.G, ev.Link)
+				}
+				continue
+			}
+		case EvGoInSyscall:
+			if known[ev.G] {
+				// postProcessTrace does not link EvGoInSyscall;
+				// the EvGoSysCall before it links to the syscall exit.
+				inSyscall[ev.G] = true
+				continue
+			}
+		case EvGoSysExit:
+			if inSyscall[ev.G] {
+				link(ev.G, ev)
+				delete(inSyscall, ev.G)
+			}
+		case EvGoEnd, EvGoStop:
+			delete(live, ev.G)
+		}
+		newEvents = append(newEvents, ev)
+
+		// Track the events that postProcessTrace links to the next
+		// event of the goroutine, as the previous one for the next
+		// partition.
+		switch ev.Type {
+		case EvGoCreate, EvGoUnblock:
+			r.last[ev.Args[0]] = ev
+		case EvGoWaiting, EvGoInSyscall, EvGoSched, EvGoPreempt,
+			EvGoSysCall, EvGoSysExit, EvGoSleep, EvGoBlock, EvGoBlockSend,
+			EvGoBlockRecv, EvGoBlockSelect, EvGoBlockSync, EvGoBlockCond,
+			EvGoBlockNet, EvGoBlockGC:
+			r.last[ev.G] = ev
+		case EvGoStart, EvGoStartLabel, EvGoEnd, EvGoStop:
+			delete(r.last, ev.G)
+		}
+	}
+	for g := range r.last {
+		if !live[g] {
+			delete(r.last, g)
+		}
+	}
+	r.live = live
+	return newEvents
+}
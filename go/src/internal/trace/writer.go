@@ -4,7 +4,10 @@
 
 package trace
 
-import "bytes"
+import (
+	"bytes"
+	"fmt"
+)
 
 // Writer is a test trace writer.
 type Writer struct {
@@ -12,8 +15,15 @@ type Writer struct {
 }
 
 func NewWriter() *Writer {
+	return NewWriterVersion(1009)
+}
+
+// NewWriterVersion returns a writer for a trace of version ver,
+// such as 1018 for Go 1.18.
+func NewWriterVersion(ver int) *Writer {
 	w := new(Writer)
-	w.Write([]byte("go 1.9 trace\x00\x00\x00\x00"))
+	header := []byte(fmt.Sprintf("go %d.%d trace", ver/1000, ver%1000))
+	w.Write(append(header, make([]byte, 16-len(header))...))
 	return w
 }
 
@@ -0,0 +1,28 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buffer
+
+import "testing"
+
+func Test(t *testing.T) {
+	b := New()
+	defer b.Free()
+	b.WriteString("hello")
+	b.WriteByte(',')
+	b.Write([]byte(" world"))
+
+	got := b.String()
+	want := "hello, world"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if b.Len() != len(want) {
+		t.Errorf("Len() = %d, want %d", b.Len(), len(want))
+	}
+	b.Reset()
+	if b.Len() != 0 {
+		t.Errorf("Len() after Reset = %d, want 0", b.Len())
+	}
+}
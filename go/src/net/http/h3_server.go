@@ -0,0 +1,1000 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 server implementation.
+//
+// See RFC 9114.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/internal/http3"
+	"net/http/internal/quic"
+	"net/textproto"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// http3AltSvcMaxAge is the max-age, in seconds, of the Alt-Svc
+// header field advertising HTTP/3.
+const http3AltSvcMaxAge = 86400
+
+// ListenAndServeQUIC listens on the UDP network address srv.Addr and
+// then calls ServeQUIC to handle HTTP/3 requests on incoming QUIC
+// connections.
+//
+// Certificates are loaded as with ListenAndServeTLS.
+// To serve HTTP/3 alongside HTTP/1 and HTTP/2, call both
+// ListenAndServeTLS and ListenAndServeQUIC on the same Server.
+//
+// If srv.Addr is blank, ":https" is used.
+//
+// ListenAndServeQUIC always returns a non-nil error. After Shutdown or
+// Close, the returned error is ErrServerClosed.
+func (srv *Server) ListenAndServeQUIC(certFile, keyFile string) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeQUIC(pc, certFile, keyFile)
+}
+
+// ServeQUIC accepts incoming QUIC connections on the packet connection pc
+// and serves HTTP/3 requests on them, calling srv.Handler to reply to them.
+//
+// Files containing a certificate and matching private key for the
+// server must be provided if neither the Server's TLSConfig.Certificates
+// nor TLSConfig.GetCertificate are populated, as with ServeTLS.
+// The TLS configuration's NextProtos is replaced by "h3", and its
+// MinVersion is raised to TLS 1.3 as QUIC requires.
+//
+// While ServeQUIC is running, responses the Server sends over TLS
+// connections advertise HTTP/3 on pc's port with an Alt-Svc header field,
+// unless the handler has already set one.
+//
+// The Server's BaseContext and ConnContext hooks are not called for
+// QUIC connections.
+//
+// Requests in 0-RTT data are rejected unless the Server's Allow0RTT
+// field is set.
+//
+// ServeQUIC always returns a non-nil error and closes pc.
+// After Shutdown or Close, the returned error is ErrServerClosed.
+func (srv *Server) ServeQUIC(pc net.PacketConn, certFile, keyFile string) error {
+	config := cloneTLSConfig(srv.TLSConfig)
+	config.NextProtos = []string{http3.NextProtoH3}
+
+	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
+	if !configHasCert || certFile != "" || keyFile != "" {
+		var err error
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			pc.Close()
+			return err
+		}
+	}
+
+	qconfig := &quic.Config{
+		TLSConfig: config,
+		Allow0RTT: srv.Allow0RTT,
+	}
+	if d := srv.idleTimeout(); d > 0 {
+		qconfig.MaxIdleTimeout = d
+	}
+	l := &http3Listener{
+		srv:    srv,
+		ep:     quic.NewEndpoint(pc, qconfig),
+		altSvc: http3AltSvcValue(pc.LocalAddr()),
+		conns:  make(map[*http3ServerConn]struct{}),
+	}
+	if !srv.trackQUICListener(l, true) {
+		l.close()
+		return ErrServerClosed
+	}
+	defer srv.trackQUICListener(l, false)
+
+	ctx := context.WithValue(context.Background(), ServerContextKey, srv)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, pc.LocalAddr())
+	for {
+		qc, err := l.ep.Accept(ctx)
+		if err != nil {
+			select {
+			case <-srv.getDoneChan():
+				return ErrServerClosed
+			default:
+			}
+			return err
+		}
+		c := l.newConn(ctx, qc)
+		if c == nil {
+			continue
+		}
+		go c.serve()
+	}
+}
+
+// http3AltSvcValue returns the Alt-Svc field value advertising
+// HTTP/3 on the port of addr.
+func http3AltSvcValue(addr net.Addr) string {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`%s=":%s"; ma=%d`, http3.NextProtoH3, port, http3AltSvcMaxAge)
+}
+
+// trackQUICListener adds or removes an HTTP/3 listener to the set of
+// tracked listeners, and updates the Alt-Svc value advertised on
+// TLS responses.
+//
+// It reports whether the server is still up (not Shutdown or Closed).
+func (s *Server) trackQUICListener(l *http3Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quicListeners == nil {
+		s.quicListeners = make(map[*http3Listener]struct{})
+	}
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.quicListeners[l] = struct{}{}
+	} else {
+		delete(s.quicListeners, l)
+	}
+	altSvc := ""
+	for l := range s.quicListeners {
+		altSvc = l.altSvc
+		break
+	}
+	s.http3AltSvc.Store(altSvc)
+	return true
+}
+
+// setAltSvc advertises HTTP/3 on a response to a request received
+// over TLS, if the server is serving HTTP/3 and the handler
+// has not set an Alt-Svc header field itself.
+func (s *Server) setAltSvc(rw ResponseWriter, req *Request) {
+	if req.TLS == nil || req.ProtoMajor >= 3 {
+		return
+	}
+	v, _ := s.http3AltSvc.Load().(string)
+	if v == "" {
+		return
+	}
+	h := rw.Header()
+	if _, ok := h["Alt-Svc"]; !ok {
+		h["Alt-Svc"] = []string{v}
+	}
+}
+
+// An http3Listener serves HTTP/3 on a QUIC endpoint.
+type http3Listener struct {
+	srv    *Server
+	ep     *quic.Endpoint
+	altSvc string // Alt-Svc field value advertising this listener
+
+	mu       sync.Mutex
+	conns    map[*http3ServerConn]struct{}
+	shutdown bool // no new connections are accepted
+	closing  bool // the endpoint is being closed
+}
+
+// newConn starts tracking a new connection.
+// It returns nil if the listener is shutting down.
+func (l *http3Listener) newConn(ctx context.Context, qc *quic.Conn) *http3ServerConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shutdown {
+		qc.Abort(&quic.ApplicationError{Code: uint64(http3.ErrNoError)})
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := &http3ServerConn{
+		l:      l,
+		qc:     qc,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	l.conns[c] = struct{}{}
+	return c
+}
+
+// close immediately closes the listener and all its connections.
+func (l *http3Listener) close() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.ep.Close(ctx)
+}
+
+// startShutdown stops accepting new connections and sends a GOAWAY
+// on every existing connection.
+func (l *http3Listener) startShutdown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shutdown = true
+	for c := range l.conns {
+		c.goAway()
+	}
+}
+
+// closeIdleConns closes all connections with no active requests and
+// reports whether the listener is quiescent. Once the listener is shut
+// down and quiescent, its endpoint is closed.
+func (l *http3Listener) closeIdleConns() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	quiescent := true
+	for c := range l.conns {
+		if !c.closeIfIdle() {
+			quiescent = false
+		}
+	}
+	if quiescent && l.shutdown && !l.closing {
+		l.closing = true
+		// Closing the endpoint waits for the connections to finish
+		// closing, so do it without holding any locks.
+		go l.ep.Close(context.Background())
+	}
+	return quiescent
+}
+
+func (l *http3Listener) connDone(c *http3ServerConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, c)
+}
+
+// An http3ServerConn is a server-side HTTP/3 connection.
+type http3ServerConn struct {
+	l      *http3Listener
+	qc     *quic.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	control  *http3.Writer // our control stream
+	active   int           // number of requests being handled
+	nextID   int64         // lowest request stream ID not yet accepted
+	goneAway bool          // GOAWAY sent; no new requests are accepted
+	closed   bool
+	peerCtrl bool // peer's control stream has been opened
+}
+
+func (c *http3ServerConn) serve() {
+	defer func() {
+		c.cancel()
+		c.l.connDone(c)
+	}()
+
+	s, err := c.qc.NewSendOnlyStream(c.ctx)
+	if err != nil {
+		c.qc.Abort(nil)
+		return
+	}
+	w := http3.NewWriter(s)
+	w.WriteStreamType(http3.StreamTypeControl)
+	w.WriteSettings(http3.Settings{
+		http3.SettingMaxFieldSectionSize: uint64(c.l.srv.maxHeaderBytes()),
+	})
+	c.mu.Lock()
+	c.control = w
+	if c.goneAway {
+		// Shutdown started before the control stream was open.
+		w.WriteGoaway(uint64(c.nextID))
+	}
+	c.mu.Unlock()
+
+	for {
+		s, err := c.qc.AcceptStream(c.ctx)
+		if err != nil {
+			return
+		}
+		if s.IsReadOnly() {
+			go c.handleUniStream(s)
+			continue
+		}
+		if !c.startRequest(s) {
+			// "The server MAY [...] reset requests it received after the
+			// GOAWAY was sent with H3_REQUEST_REJECTED."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-5.2-8
+			s.Reset(uint64(http3.ErrRequestRejected))
+			s.CloseRead()
+			continue
+		}
+		go c.serveRequest(s)
+	}
+}
+
+// abort closes the connection with an HTTP/3 error code.
+func (c *http3ServerConn) abort(err error) {
+	code := http3.ErrGeneralProtocolError
+	if e, ok := err.(http3.Error); ok {
+		code = e
+	}
+	c.qc.Abort(&quic.ApplicationError{Code: uint64(code)})
+}
+
+// startRequest records the start of a request on stream s.
+// It reports false if the request must be rejected.
+func (c *http3ServerConn) startRequest(s *quic.Stream) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.goneAway && s.ID() >= c.nextID {
+		return false
+	}
+	c.active++
+	if id := s.ID() + 4; id > c.nextID {
+		// Client-initiated bidirectional stream IDs are multiples of 4.
+		c.nextID = id
+	}
+	return true
+}
+
+func (c *http3ServerConn) requestDone() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+}
+
+// goAway sends a GOAWAY frame, after which no new requests are accepted.
+func (c *http3ServerConn) goAway() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.goneAway {
+		return
+	}
+	c.goneAway = true
+	if c.control != nil {
+		c.control.WriteGoaway(uint64(c.nextID))
+	}
+}
+
+// closeIfIdle closes the connection if it has no active requests,
+// and reports whether it did so.
+func (c *http3ServerConn) closeIfIdle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active > 0 {
+		return false
+	}
+	if !c.closed {
+		c.closed = true
+		c.qc.Abort(&quic.ApplicationError{Code: uint64(http3.ErrNoError)})
+	}
+	return true
+}
+
+// handleUniStream handles a unidirectional stream opened by the client.
+func (c *http3ServerConn) handleUniStream(s *quic.Stream) {
+	r := http3.NewReader(s)
+	typ, err := r.ReadStreamType()
+	if err != nil {
+		s.CloseRead()
+		return
+	}
+	switch typ {
+	case http3.StreamTypeControl:
+		c.mu.Lock()
+		dup := c.peerCtrl
+		c.peerCtrl = true
+		c.mu.Unlock()
+		if dup {
+			// "Only one control stream per peer is permitted; receipt of a
+			// second stream claiming to be a control stream MUST be treated
+			// as a connection error of type H3_STREAM_CREATION_ERROR."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-6.2.1-2
+			c.abort(http3.ErrStreamCreationError)
+			return
+		}
+		_, err := readHTTP3Control(r, func(t http3.FrameType, payload []byte) error {
+			switch t {
+			case http3.FrameGoaway, http3.FrameMaxPushID, http3.FrameCancelPush:
+				// We never push, so we ignore push IDs,
+				// and a client GOAWAY only limits pushes.
+				return nil
+			}
+			return http3.ErrFrameUnexpected
+		})
+		if err != nil {
+			c.abort(err)
+		}
+	case http3.StreamTypePush:
+		// "Only servers can push; if a server receives a client-initiated
+		// push stream, this MUST be treated as a connection error of type
+		// H3_STREAM_CREATION_ERROR."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-6.2.2-3
+		c.abort(http3.ErrStreamCreationError)
+	case http3.StreamTypeQPACKEncoder, http3.StreamTypeQPACKDecoder:
+		// We advertise a dynamic table capacity of zero, so there is
+		// nothing of interest on these streams.
+		io.Copy(io.Discard, s)
+	default:
+		// "Recipients of unknown stream types MUST either abort reading
+		// of the stream or discard incoming data without further processing."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-6.2-7
+		s.CloseRead()
+	}
+}
+
+// readHTTP3Control reads the peer's control stream. It returns the
+// peer's settings once they are read, and calls handle for each
+// subsequent frame. It returns when the stream or connection ends,
+// or an error occurs.
+func readHTTP3Control(r *http3.Reader, handle func(http3.FrameType, []byte) error) (http3.Settings, error) {
+	// Control frames are small; the largest we read is SETTINGS.
+	const maxControlFrameSize = 16 << 10
+	t, payload, err := r.ReadFrame(maxControlFrameSize)
+	if err != nil {
+		return nil, http3ControlStreamError(err)
+	}
+	if t != http3.FrameSettings {
+		// "If the first frame of the control stream is any other frame
+		// type, this MUST be treated as a connection error of type
+		// H3_MISSING_SETTINGS."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-6.2.1-2
+		return nil, http3.ErrMissingSettings
+	}
+	settings, err := http3.ParseSettings(payload)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, payload, err := r.ReadFrame(maxControlFrameSize)
+		if err != nil {
+			return settings, http3ControlStreamError(err)
+		}
+		switch t {
+		case http3.FrameSettings, http3.FrameData, http3.FrameHeaders, http3.FramePushPromise:
+			return settings, http3.ErrFrameUnexpected
+		}
+		if err := handle(t, payload); err != nil {
+			return settings, err
+		}
+	}
+}
+
+// http3ControlStreamError converts an error reading a control stream
+// into the error with which to close the connection, or nil if the
+// connection is already closed.
+func http3ControlStreamError(err error) error {
+	if err == io.EOF {
+		// "If either control stream is closed at any point, this MUST be
+		// treated as a connection error of type H3_CLOSED_CRITICAL_STREAM."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-6.2.1-2
+		return http3.ErrClosedCriticalStream
+	}
+	if _, ok := err.(http3.Error); ok {
+		return err
+	}
+	return nil
+}
+
+// serveRequest reads a request from s and handles it.
+func (c *http3ServerConn) serveRequest(s *quic.Stream) {
+	defer c.requestDone()
+	srv := c.l.srv
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	r := http3.NewReader(s)
+	r.MaxFieldSectionSize = int64(srv.maxHeaderBytes())
+	fields, err := r.ReadHeaders()
+	switch err {
+	case nil:
+	case http3.ErrExcessiveLoad:
+		w := http3.NewWriter(s)
+		w.WriteHeaders([]http3.HeaderField{{Name: ":status", Value: "431"}})
+		s.CloseWrite()
+		s.CloseRead()
+		return
+	default:
+		if _, ok := err.(http3.Error); ok {
+			c.abort(err)
+		} else {
+			s.Reset(uint64(http3.ErrRequestIncomplete))
+		}
+		return
+	}
+
+	req, err := c.newRequest(ctx, fields, r)
+	if err != nil {
+		// "Malformed requests or responses that are detected MUST be
+		// treated as a stream error of type H3_MESSAGE_ERROR."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.1.2-3
+		s.Reset(uint64(http3.ErrMessageError))
+		s.CloseRead()
+		return
+	}
+	if !req.TLS.HandshakeComplete && !http3SafeMethod(req.Method) {
+		// The request arrived in 0-RTT data, which an attacker
+		// may replay. Only handle safe requests before the
+		// handshake completes; delay the rest until it has.
+		// https://www.rfc-editor.org/rfc/rfc8470#section-3
+		if err := c.qc.WaitHandshake(ctx); err != nil {
+			s.Reset(uint64(http3.ErrRequestRejected))
+			s.CloseRead()
+			return
+		}
+		tlsState := c.qc.ConnectionState()
+		req.TLS = &tlsState
+	}
+	rw := &http3ResponseWriter{
+		s:             s,
+		w:             http3.NewWriter(s),
+		req:           req,
+		handlerHeader: make(Header),
+		contentLength: -1,
+	}
+	rw.bw = bufio.NewWriterSize(http3ChunkWriter{rw}, bufferBeforeChunkingSize)
+
+	defer func() {
+		if e := recover(); e != nil {
+			if e != ErrAbortHandler {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				srv.logf("http: panic serving %v: %v\n%s", req.RemoteAddr, e, buf)
+			}
+			s.Reset(uint64(http3.ErrInternalError))
+			s.CloseRead()
+		}
+	}()
+	serverHandler{srv}.ServeHTTP(rw, req)
+	rw.finish()
+}
+
+// newRequest constructs a Request from a request's header section.
+func (c *http3ServerConn) newRequest(ctx context.Context, fields []http3.HeaderField, r *http3.Reader) (*Request, error) {
+	var (
+		method, scheme, authority, path string
+		sawRegular                      bool
+		header                          = make(Header)
+	)
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			// "All pseudo-header fields MUST appear in the header section
+			// before regular header fields."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-4.3-3
+			if sawRegular {
+				return nil, errors.New("pseudo-header after regular header")
+			}
+			var p *string
+			switch f.Name {
+			case ":method":
+				p = &method
+			case ":scheme":
+				p = &scheme
+			case ":authority":
+				p = &authority
+			case ":path":
+				p = &path
+			default:
+				return nil, fmt.Errorf("invalid pseudo-header %q", f.Name)
+			}
+			if *p != "" {
+				return nil, fmt.Errorf("duplicate pseudo-header %q", f.Name)
+			}
+			*p = f.Value
+			continue
+		}
+		sawRegular = true
+		if !validHTTP3FieldName(f.Name) || !httpguts.ValidHeaderFieldValue(f.Value) {
+			return nil, fmt.Errorf("invalid header field %q", f.Name)
+		}
+		if isHTTP3ConnectionSpecificField(f.Name) {
+			// "An HTTP/3 implementation MUST NOT generate [...]
+			// connection-specific fields."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-4.2-4
+			return nil, fmt.Errorf("connection-specific header %q", f.Name)
+		}
+		if f.Name == "te" && f.Value != "trailers" {
+			return nil, errors.New(`invalid "te" header`)
+		}
+		header.Add(textproto.CanonicalMIMEHeaderKey(f.Name), f.Value)
+	}
+	if cookies := header["Cookie"]; len(cookies) > 1 {
+		// "If there are multiple field lines after decompression, these
+		// MUST be concatenated into a single byte string using the
+		// two-byte delimiter of "; " (ASCII 0x3b, 0x20)"
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.2.1-2
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	if method == "" || !validMethod(method) {
+		return nil, errors.New("missing or invalid :method")
+	}
+	if authority == "" {
+		authority = header.Get("Host")
+	}
+
+	var u *url.URL
+	requestURI := path
+	if method == "CONNECT" {
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.4
+		if scheme != "" || path != "" || authority == "" {
+			return nil, errors.New("invalid CONNECT request")
+		}
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		if scheme == "" || path == "" {
+			return nil, errors.New("missing :scheme or :path")
+		}
+		var err error
+		u, err = url.ParseRequestURI(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tlsState := c.qc.ConnectionState()
+	req := &Request{
+		ctx:           ctx,
+		Method:        method,
+		URL:           u,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		Header:        header,
+		ContentLength: -1,
+		Host:          authority,
+		RemoteAddr:    c.qc.RemoteAddr().String(),
+		RequestURI:    requestURI,
+		TLS:           &tlsState,
+	}
+	if v := header.Get("Content-Length"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid content-length")
+		}
+		req.ContentLength = n
+	}
+	for _, v := range header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			key = CanonicalHeaderKey(textproto.TrimString(key))
+			switch key {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				// Bogus. (copy of http1 rules)
+				return nil, errors.New("invalid trailer key")
+			}
+			if req.Trailer == nil {
+				req.Trailer = make(Header)
+			}
+			req.Trailer[key] = nil
+		}
+	}
+	delete(header, "Trailer")
+	req.Body = &http3Body{r: r, trailer: &req.Trailer, contentLength: req.ContentLength}
+	return req, nil
+}
+
+// isHTTP3ConnectionSpecificField reports whether the lowercase field name
+// is a connection-specific field, which HTTP/3 does not permit.
+func isHTTP3ConnectionSpecificField(name string) bool {
+	switch name {
+	case "connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade":
+		return true
+	}
+	return false
+}
+
+// http3SafeMethod reports whether method is safe, and so may be
+// handled before the handshake of a connection using 0-RTT completes.
+// https://www.rfc-editor.org/rfc/rfc9110#section-9.2.1
+func http3SafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// validHTTP3FieldName reports whether name is a valid HTTP/3
+// field name: a token containing no uppercase characters.
+// https://www.rfc-editor.org/rfc/rfc9114#section-4.2-2
+func validHTTP3FieldName(name string) bool {
+	if !httpguts.ValidHeaderFieldName(name) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; 'A' <= c && c <= 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// http3Body is the body of an HTTP/3 request or response,
+// read from the DATA frames of a message.
+type http3Body struct {
+	r             *http3.Reader
+	trailer       *Header // filled in from the trailer section at EOF
+	contentLength int64   // declared content length, or -1
+	n             int64   // bytes read
+	err           error   // sticky error
+
+	// onDone, if non-nil, is called once when the body has been read
+	// to EOF, has failed, or is closed. Its argument is io.EOF if the
+	// whole body was read.
+	onDone   func(error)
+	doneOnce sync.Once
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var errHTTP3ContentLength = errors.New("http: HTTP/3 message content length does not match Content-Length")
+
+func (b *http3Body) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return 0, ErrBodyReadAfterClose
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.r.ReadData(p)
+	b.n += int64(n)
+	if b.contentLength >= 0 && b.n > b.contentLength {
+		err = errHTTP3ContentLength
+	}
+	if err == io.EOF {
+		if b.contentLength >= 0 && b.n != b.contentLength {
+			err = errHTTP3ContentLength
+		} else {
+			b.setTrailer()
+		}
+	}
+	if err != nil {
+		b.err = err
+		b.done(err)
+	}
+	return n, err
+}
+
+// setTrailer merges the message's trailer section into *b.trailer.
+func (b *http3Body) setTrailer() {
+	for _, f := range b.r.Trailer() {
+		key := CanonicalHeaderKey(f.Name)
+		if !httpguts.ValidTrailerHeader(key) {
+			continue
+		}
+		if *b.trailer == nil {
+			*b.trailer = make(Header)
+		}
+		(*b.trailer)[key] = append((*b.trailer)[key], f.Value)
+	}
+}
+
+func (b *http3Body) done(err error) {
+	if b.onDone != nil {
+		b.doneOnce.Do(func() { b.onDone(err) })
+	}
+}
+
+func (b *http3Body) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.done(ErrBodyReadAfterClose)
+	return nil
+}
+
+// http3ResponseWriter is the ResponseWriter for HTTP/3 requests.
+type http3ResponseWriter struct {
+	s   *quic.Stream
+	w   *http3.Writer
+	req *Request
+	bw  *bufio.Writer // buffers output in chunks to http3ChunkWriter
+
+	handlerHeader Header
+	wroteHeader   bool  // WriteHeader called
+	sentHeader    bool  // HEADERS frame sent
+	handlerDone   bool  // handler has returned
+	status        int   // status code passed to WriteHeader
+	contentLength int64 // explicitly-declared Content-Length; or -1
+	written       int64 // body bytes written by the handler
+	trailers      []string
+	err           error // sticky write error
+}
+
+var _ Flusher = (*http3ResponseWriter)(nil)
+
+func (rw *http3ResponseWriter) Header() Header {
+	return rw.handlerHeader
+}
+
+func (rw *http3ResponseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		logf(rw.req, "http: superfluous response.WriteHeader call")
+		return
+	}
+	checkWriteHeaderCode(code)
+	rw.wroteHeader = true
+	rw.status = code
+	if cl := rw.handlerHeader.Get("Content-Length"); cl != "" {
+		v, err := strconv.ParseInt(cl, 10, 64)
+		if err == nil && v >= 0 {
+			rw.contentLength = v
+		} else {
+			logf(rw.req, "http: invalid Content-Length of %q", cl)
+			rw.handlerHeader.Del("Content-Length")
+		}
+	}
+}
+
+func (rw *http3ResponseWriter) Write(p []byte) (int, error) {
+	return rw.write(len(p), p, "")
+}
+
+func (rw *http3ResponseWriter) WriteString(s string) (int, error) {
+	return rw.write(len(s), nil, s)
+}
+
+// write writes either dataB or dataS, as in the HTTP/1 response writer.
+func (rw *http3ResponseWriter) write(lenData int, dataB []byte, dataS string) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if !bodyAllowedForStatus(rw.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	rw.written += int64(lenData)
+	if rw.contentLength != -1 && rw.written > rw.contentLength {
+		return 0, ErrContentLength
+	}
+	if rw.req.Method == "HEAD" {
+		// Pretend the data was written, as for HTTP/1.
+		return lenData, nil
+	}
+	if dataB != nil {
+		return rw.bw.Write(dataB)
+	}
+	return rw.bw.WriteString(dataS)
+}
+
+func (rw *http3ResponseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	rw.bw.Flush()
+	if !rw.sentHeader {
+		rw.writeHeaders(nil)
+	}
+}
+
+// finish completes the response after the handler returns.
+func (rw *http3ResponseWriter) finish() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	rw.handlerDone = true
+	rw.bw.Flush()
+	if !rw.sentHeader {
+		rw.writeHeaders(nil)
+	}
+	if rw.err == nil {
+		if trailer := rw.trailerFields(); len(trailer) > 0 {
+			rw.err = rw.w.WriteHeaders(trailer)
+		}
+	}
+	if rw.err != nil {
+		rw.s.Reset(uint64(http3.ErrInternalError))
+	} else {
+		rw.s.CloseWrite()
+	}
+	// "[A] server can send a complete response prior to the client
+	// sending an entire request if the response does not depend on any
+	// portion of the request that has not been sent and received. When
+	// the server does not need to receive the remainder of the request,
+	// it MAY abort reading the request stream [...]"
+	// https://www.rfc-editor.org/rfc/rfc9114#section-4.1-15
+	rw.s.CloseRead()
+}
+
+// http3ChunkWriter writes the output of the response's bufio.Writer,
+// sending the header section before the first chunk.
+type http3ChunkWriter struct{ rw *http3ResponseWriter }
+
+func (cw http3ChunkWriter) Write(p []byte) (int, error) {
+	rw := cw.rw
+	if !rw.sentHeader {
+		rw.writeHeaders(p)
+	}
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	n, err := rw.w.WriteData(p)
+	if err != nil {
+		rw.err = err
+	}
+	return n, err
+}
+
+// writeHeaders sends the response header section.
+// p is the first chunk of the response body.
+func (rw *http3ResponseWriter) writeHeaders(p []byte) {
+	rw.sentHeader = true
+	h := rw.handlerHeader
+	if _, ok := h["Date"]; !ok {
+		h.Set("Date", time.Now().UTC().Format(TimeFormat))
+	}
+	bodyAllowed := bodyAllowedForStatus(rw.status)
+	if _, ok := h["Content-Type"]; !ok && bodyAllowed && len(p) > 0 {
+		h.Set("Content-Type", DetectContentType(p))
+	}
+	for _, v := range h["Trailer"] {
+		foreachHeaderElement(v, func(key string) {
+			rw.trailers = append(rw.trailers, CanonicalHeaderKey(key))
+		})
+	}
+	if rw.handlerDone && rw.contentLength == -1 && bodyAllowed &&
+		len(rw.trailers) == 0 && rw.req.Method != "HEAD" {
+		// The handler has finished and p is the entire body.
+		h.Set("Content-Length", strconv.Itoa(len(p)))
+	}
+
+	fields := []http3.HeaderField{{Name: ":status", Value: strconv.Itoa(rw.status)}}
+	for k, vv := range h {
+		if strings.HasPrefix(k, TrailerPrefix) {
+			continue
+		}
+		lk := strings.ToLower(k)
+		if isHTTP3ConnectionSpecificField(lk) {
+			continue
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				continue
+			}
+			fields = append(fields, http3.HeaderField{Name: lk, Value: v})
+		}
+	}
+	rw.err = rw.w.WriteHeaders(fields)
+}
+
+// trailerFields returns the trailer section to send after the body.
+func (rw *http3ResponseWriter) trailerFields() []http3.HeaderField {
+	var fields []http3.HeaderField
+	add := func(k string, vv []string) {
+		lk := strings.ToLower(k)
+		for _, v := range vv {
+			if httpguts.ValidTrailerHeader(k) && httpguts.ValidHeaderFieldValue(v) {
+				fields = append(fields, http3.HeaderField{Name: lk, Value: v})
+			}
+		}
+	}
+	for _, k := range rw.trailers {
+		add(k, rw.handlerHeader[k])
+	}
+	for k, vv := range rw.handlerHeader {
+		if strings.HasPrefix(k, TrailerPrefix) {
+			add(strings.TrimPrefix(k, TrailerPrefix), vv)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,268 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tests for HTTP/3 over QUIC on loopback UDP.
+
+package http_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	. "net/http"
+	"net/http/internal/testcert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type h3Test struct {
+	t        *testing.T
+	srv      *Server
+	url      string // https URL of the TCP listener
+	tr       *Transport
+	c        *Client
+	quicErrc chan error // result of ServeQUIC
+	tlsErrc  chan error // result of ServeTLS
+}
+
+// newH3Test starts a server serving HTTP/1.1 over TLS and HTTP/3 over
+// QUIC, both on loopback, and a client with HTTP/3 enabled.
+// Each of opts is applied to the Server before it starts serving.
+func newH3Test(t *testing.T, h Handler, opts ...func(*Server)) *h3Test {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		ln.Close()
+		t.Fatal(err)
+	}
+	st := &h3Test{
+		t: t,
+		srv: &Server{
+			Handler:      h,
+			TLSConfig:    &tls.Config{Certificates: []tls.Certificate{cert}},
+			TLSNextProto: map[string]func(*Server, *tls.Conn, Handler){}, // HTTP/1.1 only
+		},
+		url:      "https://" + ln.Addr().String(),
+		quicErrc: make(chan error, 1),
+		tlsErrc:  make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(st.srv)
+	}
+	go func() { st.quicErrc <- st.srv.ServeQUIC(pc, "", "") }()
+	go func() { st.tlsErrc <- st.srv.ServeTLS(ln, "", "") }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	st.tr = &Transport{
+		EnableHTTP3:     true,
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}
+	st.c = &Client{Transport: st.tr}
+	return st
+}
+
+func (st *h3Test) close() {
+	st.tr.CloseIdleConnections()
+	st.srv.Close()
+	for _, errc := range []chan error{st.quicErrc, st.tlsErrc} {
+		if err := <-errc; err != ErrServerClosed {
+			st.t.Errorf("Serve = %v, want ErrServerClosed", err)
+		}
+	}
+}
+
+// get sends a GET request and returns the response protocol and body.
+func (st *h3Test) get(path string) (proto, body string) {
+	st.t.Helper()
+	res, err := st.c.Get(st.url + path)
+	if err != nil {
+		st.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		st.t.Fatal(err)
+	}
+	return res.Proto, string(b)
+}
+
+func TestHTTP3AltSvcUpgrade(t *testing.T) {
+	defer afterTest(t)
+	st := newH3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	defer st.close()
+
+	res, err := st.c.Get(st.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.ProtoMajor != 1 {
+		t.Fatalf("first response Proto = %q, want HTTP/1.1", res.Proto)
+	}
+	if got := res.Header.Get("Alt-Svc"); !strings.HasPrefix(got, `h3=":`) {
+		t.Fatalf("Alt-Svc = %q, want an h3 alternative", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		proto, body := st.get("/")
+		if proto != "HTTP/3.0" || body != "HTTP/3.0" {
+			t.Fatalf("request %v: client proto %q, server proto %q; want HTTP/3.0", i, proto, body)
+		}
+	}
+}
+
+func TestHTTP3RequestBodyAndTrailers(t *testing.T) {
+	defer afterTest(t)
+	st := newH3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Trailer", "Server-Trailer")
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		w.Write(b)
+		w.Header().Set("Server-Trailer", "got "+r.Trailer.Get("Client-Trailer"))
+	}))
+	defer st.close()
+	st.get("/") // learn Alt-Svc
+
+	body := strings.Repeat("hello, world\n", 10000)
+	req, _ := NewRequest("POST", st.url, nil)
+	req.Trailer = Header{"Client-Trailer": nil}
+	req.Body = &trailerSettingBody{Reader: strings.NewReader(body), req: req}
+	res, err := st.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Proto != "HTTP/3.0" {
+		t.Fatalf("Proto = %q, want HTTP/3.0", res.Proto)
+	}
+	got, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("echoed body of %v bytes, want %v", len(got), len(body))
+	}
+	if got, want := res.Trailer.Get("Server-Trailer"), "got ok"; got != want {
+		t.Errorf("response trailer = %q, want %q", got, want)
+	}
+}
+
+// trailerSettingBody sets a request trailer when the body is read to EOF.
+type trailerSettingBody struct {
+	io.Reader
+	req *Request
+}
+
+func (b *trailerSettingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		b.req.Trailer.Set("Client-Trailer", "ok")
+	}
+	return n, err
+}
+
+func (b *trailerSettingBody) Close() error { return nil }
+
+func TestHTTP3FallbackToTCP(t *testing.T) {
+	defer afterTest(t)
+	// Find a UDP port nothing is listening on.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, deadPort, _ := net.SplitHostPort(pc.LocalAddr().String())
+	pc.Close()
+
+	st := newH3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Alt-Svc", `h3=":`+deadPort+`"`)
+		io.WriteString(w, r.Proto)
+	}))
+	defer st.close()
+	st.tr.TLSHandshakeTimeout = 100 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		if proto, body := st.get("/"); proto != "HTTP/1.1" || body != "HTTP/1.1" {
+			t.Fatalf("request %v: client proto %q, server proto %q; want HTTP/1.1", i, proto, body)
+		}
+	}
+}
+
+func TestHTTP3ServerShutdown(t *testing.T) {
+	defer afterTest(t)
+	st := newH3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	st.get("/")
+	if proto, _ := st.get("/"); proto != "HTTP/3.0" {
+		t.Fatalf("Proto = %q, want HTTP/3.0", proto)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := st.srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	st.close()
+}
+
+func TestHTTP3EarlyData(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Allow0RTT=%v", allow), func(t *testing.T) {
+			testHTTP3EarlyData(t, allow)
+		})
+	}
+}
+
+func testHTTP3EarlyData(t *testing.T, allow0RTT bool) {
+	defer afterTest(t)
+	type tlsState struct{ early, resumed bool }
+	states := make(chan tlsState, 10)
+	st := newH3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor == 3 {
+			states <- tlsState{!r.TLS.HandshakeComplete, r.TLS.DidResume}
+		}
+		io.WriteString(w, r.Proto)
+	}), func(srv *Server) {
+		srv.Allow0RTT = allow0RTT
+	})
+	defer st.close()
+	st.tr.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	st.get("/") // learn about HTTP/3 over TCP
+	for i := 0; i < 2; i++ {
+		// Each request after the first resumes the session of the
+		// previous connection, sending the request in 0-RTT data if
+		// the server permits it.
+		if proto, _ := st.get("/"); proto != "HTTP/3.0" {
+			t.Fatalf("request %v: Proto = %q, want HTTP/3.0", i, proto)
+		}
+		s := <-states
+		if s.early && !allow0RTT {
+			t.Errorf("request %v: handled in 0-RTT data, want early data rejected by default", i)
+		}
+		if i > 0 && !s.resumed {
+			t.Errorf("request %v: connection did not resume the session", i)
+		}
+		st.tr.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,840 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 client implementation.
+//
+// See RFC 9114 and, for the Alt-Svc header field, RFC 7838.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/internal/ascii"
+	"net/http/internal/http3"
+	"net/http/internal/quic"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// http3BrokenDuration is how long HTTP/3 is not attempted for
+	// an origin after a QUIC connection to it could not be established.
+	http3BrokenDuration = 5 * time.Minute
+
+	// http3DefaultDialTimeout bounds the QUIC handshake when the
+	// Transport has no TLSHandshakeTimeout, so that an unreachable
+	// UDP port does not delay the fallback to TCP indefinitely.
+	http3DefaultDialTimeout = 10 * time.Second
+)
+
+// errHTTP3Unavailable is returned by http3Transport.roundTrip when the
+// request should be sent over TCP instead. The request body has not
+// been read.
+var errHTTP3Unavailable = errors.New("http: HTTP/3 unavailable")
+
+// http3Transport is the HTTP/3 part of a Transport.
+// Its zero value is ready to use.
+type http3Transport struct {
+	mu     sync.Mutex
+	ep     *quic.Endpoint                    // lazily created; shared by all connections
+	conns  map[http3ConnKey]*http3ClientConn // connections accepting new requests
+	all    map[*http3ClientConn]struct{}     // connections not yet closed, including dials
+	altSvc map[string]*http3AltSvc           // keyed by origin host:port
+}
+
+// An http3AltSvc is an HTTP/3 alternative service for an origin.
+type http3AltSvc struct {
+	addr    string    // host:port of the alternative
+	expires time.Time // end of the advertisement's freshness lifetime
+	broken  time.Time // if non-zero, HTTP/3 is not attempted until then
+}
+
+// An http3ConnKey identifies a pooled HTTP/3 connection.
+type http3ConnKey struct {
+	addr       string // host:port dialed
+	serverName string // origin host, authenticated by the handshake
+}
+
+// useHTTP3 reports whether req may be sent using HTTP/3.
+func (t *Transport) useHTTP3(req *Request) bool {
+	if !t.EnableHTTP3 || req.URL.Scheme != "https" {
+		return false
+	}
+	if t.Proxy != nil {
+		// HTTP/3 cannot be tunneled through an HTTP proxy.
+		if u, err := t.Proxy(req); err != nil || u != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// roundTrip sends req using HTTP/3, if the origin has advertised it.
+// It returns errHTTP3Unavailable, without reading the request body,
+// if the request should be sent over TCP instead.
+func (h *http3Transport) roundTrip(t *Transport, req *Request) (*Response, error) {
+	origin := canonicalAddr(req.URL)
+	alt := h.lookupAltSvc(origin)
+	if alt == "" {
+		return nil, errHTTP3Unavailable
+	}
+	key := http3ConnKey{addr: alt, serverName: req.URL.Hostname()}
+	for attempt := 0; ; attempt++ {
+		cc, err := h.getConn(t, req.Context(), key)
+		if err != nil {
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			h.markBroken(origin)
+			return nil, errHTTP3Unavailable
+		}
+		resp, err := cc.roundTrip(t, req)
+		if err == errHTTP3ConnUnusable {
+			// The connection went away before the request was sent.
+			// Try once more on a new connection.
+			if attempt == 0 {
+				continue
+			}
+			return nil, errHTTP3Unavailable
+		}
+		return resp, err
+	}
+}
+
+// lookupAltSvc returns the address of the HTTP/3 alternative service
+// for origin, or "" if there is none or it is broken.
+func (h *http3Transport) lookupAltSvc(origin string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a := h.altSvc[origin]
+	if a == nil {
+		return ""
+	}
+	now := time.Now()
+	if now.After(a.expires) {
+		delete(h.altSvc, origin)
+		return ""
+	}
+	if now.Before(a.broken) {
+		return ""
+	}
+	return a.addr
+}
+
+// markBroken stops HTTP/3 from being attempted for origin for a while.
+func (h *http3Transport) markBroken(origin string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if a := h.altSvc[origin]; a != nil {
+		a.broken = time.Now().Add(http3BrokenDuration)
+	}
+}
+
+// handleAltSvc records the HTTP/3 alternative service advertised by
+// the Alt-Svc field values in a response from origin.
+//
+// "When an Alt-Svc response header field is received from an origin,
+// its value invalidates and replaces all cached alternative services
+// for that origin."
+// https://www.rfc-editor.org/rfc/rfc7838#section-3-7
+func (h *http3Transport) handleAltSvc(origin string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	addr, maxAge, ok := parseHTTP3AltSvc(origin, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !ok {
+		delete(h.altSvc, origin)
+		return
+	}
+	if h.altSvc == nil {
+		h.altSvc = make(map[string]*http3AltSvc)
+	}
+	a := h.altSvc[origin]
+	if a == nil || a.addr != addr {
+		a = &http3AltSvc{addr: addr}
+		h.altSvc[origin] = a
+	}
+	a.expires = time.Now().Add(maxAge)
+}
+
+// parseHTTP3AltSvc parses Alt-Svc field values and returns the first
+// HTTP/3 alternative they advertise for origin, along with its
+// freshness lifetime.
+func parseHTTP3AltSvc(origin string, values []string) (addr string, maxAge time.Duration, ok bool) {
+	originHost, _, err := net.SplitHostPort(origin)
+	if err != nil {
+		return "", 0, false
+	}
+	for _, v := range values {
+		for _, alt := range strings.Split(v, ",") {
+			params := strings.Split(alt, ";")
+			proto, authority, found := cutString(textproto.TrimString(params[0]), "=")
+			if !found || proto != http3.NextProtoH3 {
+				// This includes the special value "clear".
+				continue
+			}
+			authority, err := strconv.Unquote(authority)
+			if err != nil {
+				continue
+			}
+			host, port, err := net.SplitHostPort(authority)
+			if err != nil || port == "" {
+				continue
+			}
+			if host == "" {
+				host = originHost
+			}
+			// "The default value is 86400 seconds (24 hours)."
+			// https://www.rfc-editor.org/rfc/rfc7838#section-3.1-2
+			maxAge := 24 * time.Hour
+			for _, p := range params[1:] {
+				k, v, _ := cutString(textproto.TrimString(p), "=")
+				if k == "ma" {
+					if n, err := strconv.ParseUint(v, 10, 32); err == nil {
+						maxAge = time.Duration(n) * time.Second
+					}
+				}
+			}
+			return net.JoinHostPort(host, port), maxAge, true
+		}
+	}
+	return "", 0, false
+}
+
+// cutString slices s around the first instance of sep.
+func cutString(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// getConn returns a connection for key, dialing one if necessary.
+// Concurrent callers share a single dial.
+func (h *http3Transport) getConn(t *Transport, ctx context.Context, key http3ConnKey) (*http3ClientConn, error) {
+	h.mu.Lock()
+	cc := h.conns[key]
+	if cc == nil {
+		if h.ep == nil {
+			ep, err := quic.Listen("udp", ":0", nil)
+			if err != nil {
+				h.mu.Unlock()
+				return nil, err
+			}
+			h.ep = ep
+		}
+		cc = &http3ClientConn{
+			h:     h,
+			key:   key,
+			ready: make(chan struct{}),
+		}
+		if h.conns == nil {
+			h.conns = make(map[http3ConnKey]*http3ClientConn)
+			h.all = make(map[*http3ClientConn]struct{})
+		}
+		h.conns[key] = cc
+		h.all[cc] = struct{}{}
+		go cc.dial(t, h.ep)
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-cc.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if cc.dialErr != nil {
+		return nil, cc.dialErr
+	}
+	return cc, nil
+}
+
+// removeConn removes cc from the pool, if it is still there,
+// so that no new requests are sent on it.
+func (h *http3Transport) removeConn(cc *http3ClientConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeConnLocked(cc)
+}
+
+func (h *http3Transport) removeConnLocked(cc *http3ClientConn) {
+	if h.conns[cc.key] == cc {
+		delete(h.conns, cc.key)
+	}
+}
+
+// connClosed forgets cc, which has closed or failed to dial.
+func (h *http3Transport) connClosed(cc *http3ClientConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeConnLocked(cc)
+	delete(h.all, cc)
+}
+
+// closeIdleConnections closes all connections with no active requests.
+// Once every connection is closed, the QUIC endpoint is closed too.
+func (h *http3Transport) closeIdleConnections() {
+	h.mu.Lock()
+	allIdle := true
+	for cc := range h.all {
+		select {
+		case <-cc.ready:
+		default:
+			allIdle = false // dial in progress
+			continue
+		}
+		if cc.closeIfIdle() {
+			h.removeConnLocked(cc)
+		} else {
+			allIdle = false
+		}
+	}
+	var ep *quic.Endpoint
+	if allIdle {
+		ep = h.ep
+		h.ep = nil
+	}
+	h.mu.Unlock()
+
+	if ep != nil {
+		// Give the peers a moment to acknowledge the close.
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+		ep.Close(ctx)
+	}
+}
+
+// An http3ClientConn is a client-side HTTP/3 connection.
+type http3ClientConn struct {
+	h     *http3Transport
+	key   http3ConnKey
+	ready chan struct{} // closed when the dial completes
+
+	// Set before ready is closed.
+	qc      *quic.Conn
+	dialErr error
+
+	mu       sync.Mutex
+	active   int  // number of requests in flight
+	goneAway bool // GOAWAY received or connection closed; no new requests
+	peerCtrl bool // peer's control stream has been opened
+}
+
+var errHTTP3ConnUnusable = errors.New("http: HTTP/3 connection is no longer usable")
+
+// dial establishes the QUIC connection and opens our control stream.
+func (cc *http3ClientConn) dial(t *Transport, ep *quic.Endpoint) {
+	defer close(cc.ready)
+	config := cloneTLSConfig(t.TLSClientConfig)
+	config.NextProtos = []string{http3.NextProtoH3}
+	if config.ServerName == "" {
+		config.ServerName = cc.key.serverName
+	}
+	qconfig := &quic.Config{
+		TLSConfig: config,
+		Allow0RTT: true,
+	}
+	if d := t.IdleConnTimeout; d > 0 {
+		qconfig.MaxIdleTimeout = d
+	}
+
+	timeout := t.TLSHandshakeTimeout
+	if timeout <= 0 {
+		timeout = http3DefaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	qc, err := ep.Dial(ctx, "udp", cc.key.addr, qconfig)
+	if err != nil {
+		cc.dialErr = err
+		cc.h.connClosed(cc)
+		return
+	}
+	s, err := qc.NewSendOnlyStream(ctx)
+	if err != nil {
+		qc.Abort(nil)
+		cc.dialErr = err
+		cc.h.connClosed(cc)
+		return
+	}
+	w := http3.NewWriter(s)
+	w.WriteStreamType(http3.StreamTypeControl)
+	w.WriteSettings(http3.Settings{
+		http3.SettingMaxFieldSectionSize: uint64(t.maxHTTP3HeaderResponseSize()),
+	})
+	cc.qc = qc
+	go cc.acceptStreams()
+}
+
+func (t *Transport) maxHTTP3HeaderResponseSize() int64 {
+	if v := t.MaxResponseHeaderBytes; v != 0 {
+		return v
+	}
+	return 10 << 20 // same as HTTP/1 and HTTP/2
+}
+
+// acceptStreams handles streams opened by the server until the
+// connection closes.
+func (cc *http3ClientConn) acceptStreams() {
+	defer func() {
+		cc.setGoneAway()
+		cc.h.connClosed(cc)
+	}()
+	for {
+		s, err := cc.qc.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		if !s.IsReadOnly() {
+			// "Clients MUST treat receipt of a server-initiated
+			// bidirectional stream as a connection error of type
+			// H3_STREAM_CREATION_ERROR."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-6.1-3
+			cc.abort(http3.ErrStreamCreationError)
+			return
+		}
+		go cc.handleUniStream(s)
+	}
+}
+
+// handleUniStream handles a unidirectional stream opened by the server.
+func (cc *http3ClientConn) handleUniStream(s *quic.Stream) {
+	r := http3.NewReader(s)
+	typ, err := r.ReadStreamType()
+	if err != nil {
+		s.CloseRead()
+		return
+	}
+	switch typ {
+	case http3.StreamTypeControl:
+		cc.mu.Lock()
+		dup := cc.peerCtrl
+		cc.peerCtrl = true
+		cc.mu.Unlock()
+		if dup {
+			cc.abort(http3.ErrStreamCreationError)
+			return
+		}
+		_, err := readHTTP3Control(r, func(t http3.FrameType, payload []byte) error {
+			switch t {
+			case http3.FrameGoaway:
+				if _, err := http3.ParseGoaway(payload); err != nil {
+					return err
+				}
+				// Requests in flight may complete; new requests
+				// use a new connection.
+				cc.setGoneAway()
+				cc.h.removeConn(cc)
+				return nil
+			case http3.FrameCancelPush:
+				// We never allow pushes.
+				return nil
+			}
+			return http3.ErrFrameUnexpected
+		})
+		if err != nil {
+			cc.abort(err)
+		}
+	case http3.StreamTypePush:
+		// "A client MUST treat receipt of a push stream as a connection
+		// error of type H3_ID_ERROR when no MAX_PUSH_ID frame has been
+		// sent or when the stream references a push ID that is greater
+		// than the maximum push ID."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.6-3
+		cc.abort(http3.ErrIDError)
+	case http3.StreamTypeQPACKEncoder, http3.StreamTypeQPACKDecoder:
+		io.Copy(io.Discard, s)
+	default:
+		s.CloseRead()
+	}
+}
+
+// abort closes the connection with an HTTP/3 error code.
+func (cc *http3ClientConn) abort(err error) {
+	code := http3.ErrGeneralProtocolError
+	if e, ok := err.(http3.Error); ok {
+		code = e
+	}
+	cc.qc.Abort(&quic.ApplicationError{Code: uint64(code)})
+}
+
+func (cc *http3ClientConn) setGoneAway() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.goneAway = true
+	if cc.active == 0 {
+		cc.qc.Abort(&quic.ApplicationError{Code: uint64(http3.ErrNoError)})
+	}
+}
+
+// startRequest reserves the connection for a new request.
+// It reports false if the connection may not be used.
+func (cc *http3ClientConn) startRequest() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.goneAway {
+		return false
+	}
+	cc.active++
+	return true
+}
+
+func (cc *http3ClientConn) requestDone() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.active--
+	if cc.goneAway && cc.active == 0 {
+		cc.qc.Abort(&quic.ApplicationError{Code: uint64(http3.ErrNoError)})
+	}
+}
+
+// closeIfIdle closes the connection if it has no requests in flight,
+// and reports whether it did so.
+func (cc *http3ClientConn) closeIfIdle() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.active > 0 {
+		return false
+	}
+	cc.goneAway = true
+	cc.qc.Abort(&quic.ApplicationError{Code: uint64(http3.ErrNoError)})
+	return true
+}
+
+// roundTrip sends req on a new stream of the connection and returns
+// the response. It returns errHTTP3ConnUnusable, without reading the
+// request body, if the connection can no longer be used.
+func (cc *http3ClientConn) roundTrip(t *Transport, req *Request) (resp *Response, err error) {
+	ctx := req.Context()
+	requestedGzip := !t.DisableCompression &&
+		req.Header.Get("Accept-Encoding") == "" &&
+		req.Header.Get("Range") == "" &&
+		req.Method != "HEAD"
+	fields, err := http3RequestFields(req, requestedGzip)
+	if err != nil {
+		req.closeBody()
+		return nil, err
+	}
+
+	if !cc.startRequest() {
+		cc.h.removeConn(cc)
+		return nil, errHTTP3ConnUnusable
+	}
+	if !req.isReplayable() {
+		// A resumed connection may send requests in 0-RTT data
+		// before its handshake completes, but 0-RTT data can be
+		// replayed by an attacker. Only send requests there which
+		// we would be willing to retry.
+		// https://www.rfc-editor.org/rfc/rfc9114#section-10.9
+		if err := cc.qc.WaitHandshake(ctx); err != nil {
+			cc.requestDone()
+			if ctx.Err() != nil {
+				req.closeBody()
+				return nil, ctx.Err()
+			}
+			cc.setGoneAway()
+			cc.h.removeConn(cc)
+			return nil, errHTTP3ConnUnusable
+		}
+	}
+	s, err := cc.qc.NewStream(ctx)
+	if err != nil {
+		cc.requestDone()
+		if ctx.Err() != nil {
+			req.closeBody()
+			return nil, ctx.Err()
+		}
+		cc.setGoneAway()
+		cc.h.removeConn(cc)
+		return nil, errHTTP3ConnUnusable
+	}
+	s.SetReadContext(ctx)
+	s.SetWriteContext(ctx)
+	defer func() {
+		if err != nil {
+			s.Reset(uint64(http3.ErrRequestCancelled))
+			s.CloseRead()
+			cc.requestDone()
+		}
+	}()
+
+	w := http3.NewWriter(s)
+	if err := w.WriteHeaders(fields); err != nil {
+		req.closeBody()
+		return nil, http3ClientError(ctx, err)
+	}
+	if req.Body != nil && req.Body != NoBody {
+		go http3WriteRequestBody(s, w, req)
+	} else {
+		s.CloseWrite()
+	}
+
+	r := http3.NewReader(s)
+	r.MaxFieldSectionSize = t.maxHTTP3HeaderResponseSize()
+	var code int
+	for {
+		fields, err := r.ReadHeaders()
+		if err != nil {
+			return nil, http3ClientError(ctx, err)
+		}
+		resp, code, err = http3NewResponse(fields)
+		if err != nil {
+			return nil, err
+		}
+		// Skip interim responses. 101 is not allowed in HTTP/3.
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.5-1
+		if code >= 200 {
+			break
+		}
+		if code == 101 {
+			return nil, errors.New("http: HTTP/3 server sent 101 Switching Protocols")
+		}
+	}
+
+	tlsState := cc.qc.ConnectionState()
+	resp.TLS = &tlsState
+	resp.Request = req
+	body := &http3Body{
+		r:             r,
+		trailer:       &resp.Trailer,
+		contentLength: resp.ContentLength,
+		onDone: func(err error) {
+			if err != io.EOF {
+				s.Reset(uint64(http3.ErrRequestCancelled))
+			}
+			s.CloseRead()
+			cc.requestDone()
+		},
+	}
+	resp.Body = body
+	if requestedGzip && ascii.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		resp.Body = &gzipReader{body: &bodyEOFSignal{body: body}}
+	}
+	return resp, nil
+}
+
+// http3ClientError returns the error to report for a failure reading
+// or writing a request stream.
+func http3ClientError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if code, ok := err.(quic.StreamErrorCode); ok {
+		return fmt.Errorf("http: HTTP/3 stream reset by server: %v", http3.Error(code))
+	}
+	return err
+}
+
+// http3WriteRequestBody sends the request body and trailers,
+// then closes the stream for writing. It closes the request body.
+func http3WriteRequestBody(s *quic.Stream, w *http3.Writer, req *Request) {
+	defer req.closeBody()
+	buf := make([]byte, 32<<10)
+	var (
+		n   int64
+		err error
+	)
+	for err == nil {
+		var nr int
+		nr, err = req.Body.Read(buf)
+		if nr > 0 {
+			n += int64(nr)
+			if _, werr := w.WriteData(buf[:nr]); werr != nil {
+				err = werr
+			}
+		}
+	}
+	if err == io.EOF {
+		err = nil
+		if req.ContentLength > 0 && n != req.ContentLength {
+			err = errHTTP3ContentLength
+		}
+	}
+	if err == nil && len(req.Trailer) > 0 {
+		var fields []http3.HeaderField
+		for k, vv := range req.Trailer {
+			for _, v := range vv {
+				fields = append(fields, http3.HeaderField{Name: strings.ToLower(k), Value: v})
+			}
+		}
+		err = w.WriteHeaders(fields)
+	}
+	if err != nil {
+		s.Reset(uint64(http3.ErrRequestCancelled))
+		return
+	}
+	s.CloseWrite()
+}
+
+// http3RequestFields returns the header section of req.
+func http3RequestFields(req *Request, addGzip bool) ([]http3.HeaderField, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err := httpguts.PunycodeHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+	if !httpguts.ValidHostHeader(host) {
+		return nil, errors.New("http: invalid Host header")
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	fields := []http3.HeaderField{{Name: ":method", Value: method}}
+	if method == "CONNECT" {
+		fields = append(fields, http3.HeaderField{Name: ":authority", Value: host})
+	} else {
+		path := req.URL.RequestURI()
+		if path == "" || path[0] != '/' && path != "*" {
+			return nil, fmt.Errorf("http: invalid request :path %q", path)
+		}
+		fields = append(fields,
+			http3.HeaderField{Name: ":scheme", Value: req.URL.Scheme},
+			http3.HeaderField{Name: ":authority", Value: host},
+			http3.HeaderField{Name: ":path", Value: path},
+		)
+	}
+
+	if len(req.Trailer) > 0 {
+		keys := make([]string, 0, len(req.Trailer))
+		for k := range req.Trailer {
+			k = CanonicalHeaderKey(k)
+			switch k {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				return nil, fmt.Errorf("http: invalid Trailer key %q", k)
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields = append(fields, http3.HeaderField{Name: "trailer", Value: strings.Join(keys, ",")})
+	}
+
+	didUA := false
+	for k, vv := range req.Header {
+		lk := strings.ToLower(k)
+		switch {
+		case lk == "host", lk == "content-length", lk == "trailer":
+			// Sent above or below.
+			continue
+		case isHTTP3ConnectionSpecificField(lk):
+			continue
+		case lk == "user-agent":
+			// An empty User-Agent suppresses the default,
+			// as for HTTP/1 and HTTP/2.
+			didUA = true
+			if len(vv) < 1 || vv[0] == "" {
+				continue
+			}
+			vv = vv[:1]
+		}
+		for _, v := range vv {
+			if lk == "te" && v != "trailers" {
+				continue
+			}
+			fields = append(fields, http3.HeaderField{Name: lk, Value: v})
+		}
+	}
+	if !didUA {
+		fields = append(fields, http3.HeaderField{Name: "user-agent", Value: "Go-http-client/3.0"})
+	}
+	if cl := req.outgoingLength(); http3SendContentLength(method, cl) {
+		fields = append(fields, http3.HeaderField{Name: "content-length", Value: strconv.FormatInt(cl, 10)})
+	}
+	if addGzip {
+		fields = append(fields, http3.HeaderField{Name: "accept-encoding", Value: "gzip"})
+	}
+	return fields, nil
+}
+
+// http3SendContentLength reports whether a request with the given
+// method and outgoing length declares a content-length.
+// The rules are the same as for HTTP/2.
+func http3SendContentLength(method string, contentLength int64) bool {
+	if contentLength > 0 {
+		return true
+	}
+	if contentLength < 0 {
+		return false
+	}
+	// For zero bodies, whether we send a content-length depends on the method.
+	switch method {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
+
+// http3NewResponse constructs a Response from a response's
+// header section. It returns the response status code.
+func http3NewResponse(fields []http3.HeaderField) (*Response, int, error) {
+	var (
+		status string
+		header = make(Header)
+	)
+	for i, f := range fields {
+		if f.Name == ":status" {
+			if i != 0 || status != "" {
+				return nil, 0, errors.New("http: malformed HTTP/3 response :status")
+			}
+			status = f.Value
+			continue
+		}
+		if strings.HasPrefix(f.Name, ":") {
+			return nil, 0, fmt.Errorf("http: invalid HTTP/3 response pseudo-header %q", f.Name)
+		}
+		if !validHTTP3FieldName(f.Name) || !httpguts.ValidHeaderFieldValue(f.Value) {
+			return nil, 0, fmt.Errorf("http: invalid HTTP/3 response header %q", f.Name)
+		}
+		header.Add(textproto.CanonicalMIMEHeaderKey(f.Name), f.Value)
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || len(status) != 3 || code < 100 {
+		return nil, 0, fmt.Errorf("http: malformed HTTP/3 response status %q", status)
+	}
+	resp := &Response{
+		Status:        status + " " + StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		Header:        header,
+		ContentLength: -1,
+	}
+	if v := header.Get("Content-Length"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, 0, errors.New("http: invalid HTTP/3 response Content-Length")
+		}
+		resp.ContentLength = n
+	}
+	for _, v := range header["Trailer"] {
+		foreachHeaderElement(v, func(key string) {
+			if resp.Trailer == nil {
+				resp.Trailer = make(Header)
+			}
+			resp.Trailer[CanonicalHeaderKey(key)] = nil
+		})
+	}
+	delete(header, "Trailer")
+	return resp, code, nil
+}
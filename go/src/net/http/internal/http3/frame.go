@@ -0,0 +1,305 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bufio"
+	"io"
+)
+
+// A Reader reads HTTP/3 frames from a stream.
+//
+// Frames of unknown type are skipped, as required by RFC 9114, Section 9.
+type Reader struct {
+	r *bufio.Reader
+
+	// MaxFieldSectionSize limits the size of HEADERS frames read by
+	// ReadHeaders and ReadData. If zero, there is no limit beyond
+	// that imposed by the frame length encoding.
+	MaxFieldSectionSize int64
+
+	dataRemaining int64         // unread bytes of the current DATA frame
+	trailer       []HeaderField // trailer section, after ReadData returns io.EOF
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadStreamType reads the type of a unidirectional stream.
+func (r *Reader) ReadStreamType() (StreamType, error) {
+	v, err := ReadVarint(r.r)
+	return StreamType(v), err
+}
+
+// readFrameHeader reads the type and length of the next frame,
+// skipping frames of unknown type.
+// It returns io.EOF if the stream ends at a frame boundary.
+func (r *Reader) readFrameHeader() (FrameType, int64, error) {
+	for {
+		t, err := ReadVarint(r.r)
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = ErrFrameError
+			}
+			return 0, 0, err
+		}
+		size, err := ReadVarint(r.r)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrFrameError
+			}
+			return 0, 0, err
+		}
+		ft := FrameType(t)
+		if ft.isReserved() {
+			return 0, 0, ErrFrameUnexpected
+		}
+		switch ft {
+		case FrameData, FrameHeaders, FrameCancelPush, FrameSettings,
+			FramePushPromise, FrameGoaway, FrameMaxPushID:
+			return ft, int64(size), nil
+		}
+		// "Implementations MUST discard frames [...] that have unknown
+		// or unsupported types."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-9-4
+		if err := r.discard(int64(size)); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+func (r *Reader) discard(n int64) error {
+	for n > 0 {
+		chunk := n
+		if chunk > 1<<20 {
+			chunk = 1 << 20
+		}
+		m, err := r.r.Discard(int(chunk))
+		n -= int64(m)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrFrameError
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) readPayload(size int64) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrFrameError
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// ReadFrame reads the next frame and returns its type and payload.
+// A frame with a payload larger than maxSize causes ReadFrame
+// to return ErrExcessiveLoad.
+//
+// ReadFrame returns io.EOF if the stream ends at a frame boundary.
+func (r *Reader) ReadFrame(maxSize int64) (FrameType, []byte, error) {
+	t, size, err := r.readFrameHeader()
+	if err != nil {
+		return 0, nil, err
+	}
+	if size > maxSize {
+		return 0, nil, ErrExcessiveLoad
+	}
+	b, err := r.readPayload(size)
+	return t, b, err
+}
+
+// ReadHeaders reads a HEADERS frame and decodes its field section.
+// It returns io.EOF if the stream ends before any frame is read.
+func (r *Reader) ReadHeaders() ([]HeaderField, error) {
+	t, size, err := r.readFrameHeader()
+	if err != nil {
+		return nil, err
+	}
+	if t != FrameHeaders {
+		// "Receipt of an invalid sequence of frames MUST be treated as
+		// a connection error of type H3_FRAME_UNEXPECTED."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.1-7
+		return nil, ErrFrameUnexpected
+	}
+	return r.readFieldSection(size)
+}
+
+func (r *Reader) readFieldSection(size int64) ([]HeaderField, error) {
+	if r.MaxFieldSectionSize > 0 && size > r.MaxFieldSectionSize {
+		return nil, ErrExcessiveLoad
+	}
+	b, err := r.readPayload(size)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFieldSection(b, r.MaxFieldSectionSize)
+}
+
+// ReadData reads message content from the DATA frames of a message.
+//
+// ReadData returns io.EOF at the end of the message. If the message
+// ended with a trailer section, it is available from Trailer.
+func (r *Reader) ReadData(p []byte) (int, error) {
+	for r.dataRemaining == 0 {
+		if r.trailer != nil {
+			// "Receipt of [...] any frame after the trailers MUST be
+			// treated as a connection error of type H3_FRAME_UNEXPECTED."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-4.1-7
+			if _, _, err := r.readFrameHeader(); err != io.EOF {
+				if err == nil {
+					err = ErrFrameUnexpected
+				}
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		t, size, err := r.readFrameHeader()
+		if err != nil {
+			return 0, err
+		}
+		switch t {
+		case FrameData:
+			r.dataRemaining = size
+		case FrameHeaders:
+			trailer, err := r.readFieldSection(size)
+			if err != nil {
+				return 0, err
+			}
+			if trailer == nil {
+				trailer = []HeaderField{}
+			}
+			r.trailer = trailer
+		default:
+			return 0, ErrFrameUnexpected
+		}
+	}
+	if int64(len(p)) > r.dataRemaining {
+		p = p[:r.dataRemaining]
+	}
+	n, err := r.r.Read(p)
+	r.dataRemaining -= int64(n)
+	if err == io.EOF {
+		// The stream ended within a DATA frame.
+		err = ErrFrameError
+	}
+	return n, err
+}
+
+// Trailer returns the trailer section of a message,
+// or nil if the message has no trailer section.
+// It is valid only after ReadData has returned io.EOF.
+func (r *Reader) Trailer() []HeaderField {
+	return r.trailer
+}
+
+// A Writer writes HTTP/3 frames to a stream.
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteStreamType writes the type of a unidirectional stream.
+func (w *Writer) WriteStreamType(t StreamType) error {
+	w.buf = AppendVarint(w.buf[:0], uint64(t))
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+// WriteFrame writes a frame with the given type and payload.
+func (w *Writer) WriteFrame(t FrameType, payload []byte) error {
+	w.buf = AppendVarint(w.buf[:0], uint64(t))
+	w.buf = AppendVarint(w.buf, uint64(len(payload)))
+	w.buf = append(w.buf, payload...)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+// WriteHeaders writes a HEADERS frame containing the encoded field section.
+func (w *Writer) WriteHeaders(fields []HeaderField) error {
+	return w.WriteFrame(FrameHeaders, AppendFieldSection(nil, fields))
+}
+
+// WriteData writes p as the payload of a DATA frame.
+func (w *Writer) WriteData(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.buf = AppendVarint(w.buf[:0], uint64(FrameData))
+	w.buf = AppendVarint(w.buf, uint64(len(p)))
+	if _, err := w.w.Write(w.buf); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// WriteSettings writes a SETTINGS frame.
+func (w *Writer) WriteSettings(s Settings) error {
+	var b []byte
+	for id, v := range s {
+		b = AppendVarint(b, id)
+		b = AppendVarint(b, v)
+	}
+	return w.WriteFrame(FrameSettings, b)
+}
+
+// WriteGoaway writes a GOAWAY frame with the given stream or push ID.
+func (w *Writer) WriteGoaway(id uint64) error {
+	return w.WriteFrame(FrameGoaway, AppendVarint(nil, id))
+}
+
+// ParseSettings parses the payload of a SETTINGS frame.
+func ParseSettings(b []byte) (Settings, error) {
+	s := Settings{}
+	for len(b) > 0 {
+		id, n := consumeVarint(b)
+		if n < 0 {
+			return nil, ErrFrameError
+		}
+		b = b[n:]
+		v, n := consumeVarint(b)
+		if n < 0 {
+			return nil, ErrFrameError
+		}
+		b = b[n:]
+		if id >= 0x02 && id <= 0x05 {
+			// "Setting identifiers that were defined in [HTTP/2] where there
+			// is no corresponding HTTP/3 setting have also been reserved.
+			// [...] Their receipt MUST be treated as a connection error of
+			// type H3_SETTINGS_ERROR."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-7.2.4.1-5
+			return nil, ErrSettingsError
+		}
+		if _, ok := s[id]; ok {
+			// "The same setting identifier MUST NOT occur more than once
+			// in the SETTINGS frame."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-7.2.4-3
+			return nil, ErrSettingsError
+		}
+		s[id] = v
+	}
+	return s, nil
+}
+
+// ParseGoaway parses the payload of a GOAWAY frame, returning its ID.
+func ParseGoaway(b []byte) (uint64, error) {
+	id, n := consumeVarint(b)
+	if n < 0 || n != len(b) {
+		return 0, ErrFrameError
+	}
+	return id, nil
+}
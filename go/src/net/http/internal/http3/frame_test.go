@@ -0,0 +1,213 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1073741823, 1073741824, maxVarint} {
+		b := AppendVarint(nil, v)
+		got, err := ReadVarint(bytes.NewReader(b))
+		if err != nil || got != v {
+			t.Errorf("ReadVarint(AppendVarint(%v)) = %v, %v", v, got, err)
+		}
+		got, n := consumeVarint(b)
+		if n != len(b) || got != v {
+			t.Errorf("consumeVarint(AppendVarint(%v)) = %v, %v", v, got, n)
+		}
+	}
+	if _, err := ReadVarint(bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("ReadVarint(empty) = %v, want io.EOF", err)
+	}
+	if _, err := ReadVarint(bytes.NewReader([]byte{0x80, 0})); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadVarint(truncated) = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	headers := []HeaderField{{":status", "200"}, {"content-type", "text/plain"}}
+	trailer := []HeaderField{{"x-checksum", "abc"}}
+	if err := w.WriteHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+	// An unknown frame type is skipped by the reader.
+	if err := w.WriteFrame(0x21, []byte("grease")); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteData([]byte("hello, "))
+	w.WriteData(nil)
+	w.WriteData([]byte("world"))
+	if err := w.WriteHeaders(trailer); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(&buf)
+	got, err := r.ReadHeaders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, headers) {
+		t.Errorf("ReadHeaders = %v, want %v", got, headers)
+	}
+	body, err := io.ReadAll(readerFunc(r.ReadData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello, world" {
+		t.Errorf("body = %q, want %q", body, "hello, world")
+	}
+	if got := r.Trailer(); !reflect.DeepEqual(got, trailer) {
+		t.Errorf("Trailer = %v, want %v", got, trailer)
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestReaderErrors(t *testing.T) {
+	headers := func() *bytes.Buffer {
+		var buf bytes.Buffer
+		NewWriter(&buf).WriteHeaders([]HeaderField{{":status", "200"}})
+		return &buf
+	}
+	for _, test := range []struct {
+		desc  string
+		build func() *bytes.Buffer
+		want  error
+	}{{
+		desc: "data before headers",
+		build: func() *bytes.Buffer {
+			var buf bytes.Buffer
+			NewWriter(&buf).WriteData([]byte("x"))
+			return &buf
+		},
+		want: ErrFrameUnexpected,
+	}, {
+		desc: "reserved HTTP/2 frame type",
+		build: func() *bytes.Buffer {
+			var buf bytes.Buffer
+			NewWriter(&buf).WriteFrame(0x06, nil)
+			return &buf
+		},
+		want: ErrFrameUnexpected,
+	}, {
+		desc: "truncated frame header",
+		build: func() *bytes.Buffer {
+			return bytes.NewBuffer([]byte{byte(FrameHeaders)})
+		},
+		want: ErrFrameError,
+	}, {
+		desc: "truncated payload",
+		build: func() *bytes.Buffer {
+			b := headers().Bytes()
+			return bytes.NewBuffer(b[:len(b)-1])
+		},
+		want: ErrFrameError,
+	}} {
+		r := NewReader(test.build())
+		if _, err := r.ReadHeaders(); err != test.want {
+			t.Errorf("%v: ReadHeaders = %v, want %v", test.desc, err, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		desc     string
+		frame    func(w *Writer)
+		truncate int
+		want     error
+	}{{
+		desc:  "settings on request stream",
+		frame: func(w *Writer) { w.WriteSettings(Settings{}) },
+		want:  ErrFrameUnexpected,
+	}, {
+		desc:  "frame after trailers",
+		frame: func(w *Writer) { w.WriteHeaders(nil); w.WriteData([]byte("x")) },
+		want:  ErrFrameUnexpected,
+	}, {
+		desc:     "truncated data",
+		frame:    func(w *Writer) { w.WriteData([]byte("hello")) },
+		truncate: 1,
+		want:     ErrFrameError,
+	}} {
+		buf := headers()
+		test.frame(NewWriter(buf))
+		buf.Truncate(buf.Len() - test.truncate)
+		r := NewReader(buf)
+		if _, err := r.ReadHeaders(); err != nil {
+			t.Fatalf("%v: ReadHeaders: %v", test.desc, err)
+		}
+		if _, err := io.ReadAll(readerFunc(r.ReadData)); err != test.want {
+			t.Errorf("%v: ReadData = %v, want %v", test.desc, err, test.want)
+		}
+	}
+}
+
+func TestReaderMaxFieldSectionSize(t *testing.T) {
+	var buf bytes.Buffer
+	NewWriter(&buf).WriteHeaders([]HeaderField{{"x-long", string(make([]byte, 1000))}})
+	r := NewReader(&buf)
+	r.MaxFieldSectionSize = 100
+	if _, err := r.ReadHeaders(); err != ErrExcessiveLoad {
+		t.Errorf("ReadHeaders = %v, want %v", err, ErrExcessiveLoad)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	want := Settings{SettingMaxFieldSectionSize: 1 << 20, 0x21: 7}
+	if err := w.WriteSettings(want); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(&buf)
+	typ, payload, err := r.ReadFrame(1024)
+	if err != nil || typ != FrameSettings {
+		t.Fatalf("ReadFrame = %v, %v; want SETTINGS frame", typ, err)
+	}
+	got, err := ParseSettings(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSettings = %v, want %v", got, want)
+	}
+
+	for _, test := range []struct {
+		desc string
+		b    []byte
+		want error
+	}{
+		{"duplicate", []byte{0x06, 0x01, 0x06, 0x02}, ErrSettingsError},
+		{"HTTP/2 setting", []byte{0x03, 0x01}, ErrSettingsError},
+		{"truncated", []byte{0x06}, ErrFrameError},
+	} {
+		if _, err := ParseSettings(test.b); err != test.want {
+			t.Errorf("%v: ParseSettings(%x) = %v, want %v", test.desc, test.b, err, test.want)
+		}
+	}
+}
+
+func TestGoaway(t *testing.T) {
+	var buf bytes.Buffer
+	NewWriter(&buf).WriteGoaway(400)
+	typ, payload, err := NewReader(&buf).ReadFrame(8)
+	if err != nil || typ != FrameGoaway {
+		t.Fatalf("ReadFrame = %v, %v; want GOAWAY frame", typ, err)
+	}
+	if id, err := ParseGoaway(payload); id != 400 || err != nil {
+		t.Errorf("ParseGoaway = %v, %v; want 400, nil", id, err)
+	}
+	if _, err := ParseGoaway(append(payload, 0)); err != ErrFrameError {
+		t.Errorf("ParseGoaway(extra data) = %v, want %v", err, ErrFrameError)
+	}
+}
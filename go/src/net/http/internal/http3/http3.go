@@ -0,0 +1,193 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package http3 implements the HTTP/3 framing layer and QPACK field
+// compression used by net/http's HTTP/3 client and server.
+//
+// HTTP/3 is defined in RFC 9114; QPACK is defined in RFC 9204.
+//
+// This package does not use the QPACK dynamic table. Endpoints advertise
+// a dynamic table capacity of zero, so field sections are encoded using
+// only the static table and literal field lines.
+package http3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NextProtoH3 is the ALPN protocol identifier for HTTP/3.
+const NextProtoH3 = "h3"
+
+// An Error is an HTTP/3 error code.
+// https://www.rfc-editor.org/rfc/rfc9114#section-8.1
+type Error uint64
+
+const (
+	ErrNoError              = Error(0x100)
+	ErrGeneralProtocolError = Error(0x101)
+	ErrInternalError        = Error(0x102)
+	ErrStreamCreationError  = Error(0x103)
+	ErrClosedCriticalStream = Error(0x104)
+	ErrFrameUnexpected      = Error(0x105)
+	ErrFrameError           = Error(0x106)
+	ErrExcessiveLoad        = Error(0x107)
+	ErrIDError              = Error(0x108)
+	ErrSettingsError        = Error(0x109)
+	ErrMissingSettings      = Error(0x10a)
+	ErrRequestRejected      = Error(0x10b)
+	ErrRequestCancelled     = Error(0x10c)
+	ErrRequestIncomplete    = Error(0x10d)
+	ErrMessageError         = Error(0x10e)
+	ErrConnectError         = Error(0x10f)
+	ErrVersionFallback      = Error(0x110)
+
+	// https://www.rfc-editor.org/rfc/rfc9204#section-6
+	ErrQPACKDecompressionFailed = Error(0x200)
+)
+
+var errorNames = map[Error]string{
+	ErrNoError:                  "H3_NO_ERROR",
+	ErrGeneralProtocolError:     "H3_GENERAL_PROTOCOL_ERROR",
+	ErrInternalError:            "H3_INTERNAL_ERROR",
+	ErrStreamCreationError:      "H3_STREAM_CREATION_ERROR",
+	ErrClosedCriticalStream:     "H3_CLOSED_CRITICAL_STREAM",
+	ErrFrameUnexpected:          "H3_FRAME_UNEXPECTED",
+	ErrFrameError:               "H3_FRAME_ERROR",
+	ErrExcessiveLoad:            "H3_EXCESSIVE_LOAD",
+	ErrIDError:                  "H3_ID_ERROR",
+	ErrSettingsError:            "H3_SETTINGS_ERROR",
+	ErrMissingSettings:          "H3_MISSING_SETTINGS",
+	ErrRequestRejected:          "H3_REQUEST_REJECTED",
+	ErrRequestCancelled:         "H3_REQUEST_CANCELLED",
+	ErrRequestIncomplete:        "H3_REQUEST_INCOMPLETE",
+	ErrMessageError:             "H3_MESSAGE_ERROR",
+	ErrConnectError:             "H3_CONNECT_ERROR",
+	ErrVersionFallback:          "H3_VERSION_FALLBACK",
+	ErrQPACKDecompressionFailed: "QPACK_DECOMPRESSION_FAILED",
+}
+
+func (e Error) String() string {
+	if s, ok := errorNames[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("H3_ERROR_0x%x", uint64(e))
+}
+
+func (e Error) Error() string {
+	return "http3: " + e.String()
+}
+
+// A StreamType is the type of a unidirectional stream.
+// https://www.rfc-editor.org/rfc/rfc9114#section-6.2
+type StreamType uint64
+
+const (
+	StreamTypeControl      = StreamType(0x00)
+	StreamTypePush         = StreamType(0x01)
+	StreamTypeQPACKEncoder = StreamType(0x02)
+	StreamTypeQPACKDecoder = StreamType(0x03)
+)
+
+// A FrameType is an HTTP/3 frame type.
+// https://www.rfc-editor.org/rfc/rfc9114#section-7.2
+type FrameType uint64
+
+const (
+	FrameData        = FrameType(0x00)
+	FrameHeaders     = FrameType(0x01)
+	FrameCancelPush  = FrameType(0x03)
+	FrameSettings    = FrameType(0x04)
+	FramePushPromise = FrameType(0x05)
+	FrameGoaway      = FrameType(0x07)
+	FrameMaxPushID   = FrameType(0x0d)
+)
+
+// isReserved reports whether t is a frame type reserved in HTTP/3
+// because it was used by HTTP/2. Receipt of a reserved frame type is
+// a connection error of type H3_FRAME_UNEXPECTED.
+// https://www.rfc-editor.org/rfc/rfc9114#section-7.2.8
+func (t FrameType) isReserved() bool {
+	switch t {
+	case 0x02, 0x06, 0x08, 0x09:
+		return true
+	}
+	return false
+}
+
+// Setting identifiers.
+// https://www.rfc-editor.org/rfc/rfc9114#section-7.2.4.1
+// https://www.rfc-editor.org/rfc/rfc9204#section-5
+const (
+	SettingQPACKMaxTableCapacity = 0x01
+	SettingMaxFieldSectionSize   = 0x06
+	SettingQPACKBlockedStreams   = 0x07
+)
+
+// Settings is the content of a SETTINGS frame, mapping identifiers to values.
+type Settings map[uint64]uint64
+
+// maxVarint is the largest value representable as a QUIC variable-length integer.
+const maxVarint = (1 << 62) - 1
+
+var errVarintOverflow = errors.New("http3: value too large for varint")
+
+// ReadVarint reads a QUIC variable-length integer.
+// https://www.rfc-editor.org/rfc/rfc9000#section-16
+//
+// It returns io.EOF if no bytes were read and io.ErrUnexpectedEOF
+// if the integer is truncated.
+func ReadVarint(r io.ByteReader) (uint64, error) {
+	b0, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1 << (b0 >> 6)
+	v := uint64(b0 & 0x3f)
+	for i := 1; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// AppendVarint appends a QUIC variable-length integer to b.
+// It panics if v is larger than 2^62-1.
+func AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 63:
+		return append(b, byte(v))
+	case v <= 16383:
+		return append(b, (1<<6)|byte(v>>8), byte(v))
+	case v <= 1073741823:
+		return append(b, (2<<6)|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case v <= maxVarint:
+		return append(b, (3<<6)|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	panic(errVarintOverflow)
+}
+
+// consumeVarint parses a variable-length integer from b,
+// returning the value and its length, or a negative length on error.
+func consumeVarint(b []byte) (uint64, int) {
+	if len(b) < 1 {
+		return 0, -1
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
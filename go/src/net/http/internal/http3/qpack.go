@@ -0,0 +1,237 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"golang.org/x/net/http2/hpack"
+)
+
+// A HeaderField is a name-value pair in a field section.
+// Names are lowercase.
+type HeaderField struct {
+	Name, Value string
+}
+
+// Size returns the size of the field as defined by RFC 9114, Section 4.2.2:
+// the length of the name and value plus an overhead of 32 bytes.
+func (f HeaderField) Size() int64 {
+	return int64(len(f.Name)) + int64(len(f.Value)) + 32
+}
+
+var (
+	staticByField map[HeaderField]int // index of an exact match
+	staticByName  map[string]int      // index of the first entry with a name
+)
+
+func init() {
+	staticByField = make(map[HeaderField]int, len(staticTable))
+	staticByName = make(map[string]int)
+	for i, f := range staticTable {
+		if _, ok := staticByField[f]; !ok {
+			staticByField[f] = i
+		}
+		if _, ok := staticByName[f.Name]; !ok {
+			staticByName[f.Name] = i
+		}
+	}
+}
+
+// AppendFieldSection appends the QPACK encoding of a field section to b.
+//
+// The encoding uses only the static table: it never references
+// the dynamic table, so it may be decoded without any encoder or
+// decoder stream state.
+func AppendFieldSection(b []byte, fields []HeaderField) []byte {
+	// Encoded Field Section Prefix: Required Insert Count and Delta Base,
+	// both zero.
+	// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.1
+	b = append(b, 0, 0)
+	for _, f := range fields {
+		if i, ok := staticByField[f]; ok {
+			// Indexed Field Line, static table.
+			// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.2
+			b = appendPrefixedInt(b, 0xc0, 6, uint64(i))
+			continue
+		}
+		if i, ok := staticByName[f.Name]; ok {
+			// Literal Field Line with Name Reference, static table.
+			// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.4
+			b = appendPrefixedInt(b, 0x50, 4, uint64(i))
+			b = appendString(b, 0x00, 7, f.Value)
+			continue
+		}
+		// Literal Field Line with Literal Name.
+		// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.6
+		b = appendString(b, 0x20, 3, f.Name)
+		b = appendString(b, 0x00, 7, f.Value)
+	}
+	return b
+}
+
+// appendPrefixedInt appends an integer with an n-bit prefix,
+// with the high bits of the first byte set to first.
+// https://www.rfc-editor.org/rfc/rfc7541#section-5.1
+func appendPrefixedInt(b []byte, first byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, first|byte(v))
+	}
+	b = append(b, first|byte(max))
+	v -= max
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendString appends a string literal with an n-bit length prefix.
+// The bit preceding the prefix is the Huffman flag, which is set
+// when the Huffman encoding is shorter.
+// https://www.rfc-editor.org/rfc/rfc9204#section-4.1.2
+func appendString(b []byte, first byte, n uint, s string) []byte {
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendPrefixedInt(b, first|1<<n, n, l)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendPrefixedInt(b, first, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// consumePrefixedInt parses an integer with an n-bit prefix.
+// It returns the value and the number of bytes consumed,
+// or a negative length on error.
+func consumePrefixedInt(b []byte, n uint) (uint64, int) {
+	if len(b) == 0 {
+		return 0, -1
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	if v < max {
+		return v, 1
+	}
+	var shift uint
+	for i := 1; i < len(b); i++ {
+		if shift > 56 {
+			// Overflow.
+			return 0, -1
+		}
+		v += uint64(b[i]&0x7f) << shift
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+		shift += 7
+	}
+	return 0, -1
+}
+
+// consumeString parses a string literal with an n-bit length prefix.
+func consumeString(b []byte, n uint) (string, int, error) {
+	huffman := b[0]&(1<<n) != 0
+	l, m := consumePrefixedInt(b, n)
+	if m < 0 || uint64(len(b)-m) < l {
+		return "", 0, ErrQPACKDecompressionFailed
+	}
+	v := b[m:][:l]
+	if !huffman {
+		return string(v), m + int(l), nil
+	}
+	s, err := hpack.HuffmanDecodeToString(v)
+	if err != nil {
+		return "", 0, ErrQPACKDecompressionFailed
+	}
+	return s, m + int(l), nil
+}
+
+// DecodeFieldSection decodes a QPACK-encoded field section.
+//
+// References to the dynamic table are an error, since we always
+// advertise a dynamic table capacity of zero.
+// If maxSize is greater than zero, it limits the total size
+// of the decoded fields as computed by HeaderField.Size.
+func DecodeFieldSection(b []byte, maxSize int64) ([]HeaderField, error) {
+	ric, n := consumePrefixedInt(b, 8)
+	if n < 0 {
+		return nil, ErrQPACKDecompressionFailed
+	}
+	b = b[n:]
+	if ric != 0 {
+		// "When the decoder receives an encoded field section with a
+		// Required Insert Count greater than the maximum number of
+		// entries in the dynamic table, it MUST treat this as a
+		// connection error of type QPACK_DECOMPRESSION_FAILED."
+		// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.1.1-5
+		return nil, ErrQPACKDecompressionFailed
+	}
+	if _, n = consumePrefixedInt(b, 7); n < 0 {
+		return nil, ErrQPACKDecompressionFailed
+	}
+	b = b[n:]
+
+	var (
+		fields []HeaderField
+		size   int64
+	)
+	for len(b) > 0 {
+		var f HeaderField
+		switch {
+		case b[0]&0x80 != 0:
+			// Indexed Field Line.
+			if b[0]&0x40 == 0 {
+				return nil, ErrQPACKDecompressionFailed // dynamic table
+			}
+			i, n := consumePrefixedInt(b, 6)
+			if n < 0 || i >= uint64(len(staticTable)) {
+				return nil, ErrQPACKDecompressionFailed
+			}
+			f = staticTable[i]
+			b = b[n:]
+		case b[0]&0x40 != 0:
+			// Literal Field Line with Name Reference.
+			if b[0]&0x10 == 0 {
+				return nil, ErrQPACKDecompressionFailed // dynamic table
+			}
+			i, n := consumePrefixedInt(b, 4)
+			if n < 0 || i >= uint64(len(staticTable)) || n >= len(b) {
+				return nil, ErrQPACKDecompressionFailed
+			}
+			f.Name = staticTable[i].Name
+			b = b[n:]
+			v, n, err := consumeString(b, 7)
+			if err != nil {
+				return nil, err
+			}
+			f.Value = v
+			b = b[n:]
+		case b[0]&0x20 != 0:
+			// Literal Field Line with Literal Name.
+			name, n, err := consumeString(b, 3)
+			if err != nil {
+				return nil, err
+			}
+			if n >= len(b) {
+				return nil, ErrQPACKDecompressionFailed
+			}
+			b = b[n:]
+			v, n, err := consumeString(b, 7)
+			if err != nil {
+				return nil, err
+			}
+			f = HeaderField{Name: name, Value: v}
+			b = b[n:]
+		default:
+			// Indexed Field Line with Post-Base Index, or
+			// Literal Field Line with Post-Base Name Reference.
+			// Both refer to the dynamic table.
+			return nil, ErrQPACKDecompressionFailed
+		}
+		size += f.Size()
+		if maxSize > 0 && size > maxSize {
+			return nil, ErrExcessiveLoad
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
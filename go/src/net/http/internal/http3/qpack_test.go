@@ -0,0 +1,136 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStaticTable(t *testing.T) {
+	if got, want := len(staticTable), 99; got != want {
+		t.Fatalf("len(staticTable) = %v, want %v", got, want)
+	}
+	// Spot check entries at each end of the table.
+	for _, test := range []struct {
+		i int
+		f HeaderField
+	}{
+		{0, HeaderField{":authority", ""}},
+		{17, HeaderField{":method", "GET"}},
+		{25, HeaderField{":status", "200"}},
+		{63, HeaderField{":status", "100"}},
+		{98, HeaderField{"x-frame-options", "sameorigin"}},
+	} {
+		if got := staticTable[test.i]; got != test.f {
+			t.Errorf("staticTable[%v] = %v, want %v", test.i, got, test.f)
+		}
+	}
+}
+
+func TestPrefixedInt(t *testing.T) {
+	// Examples from RFC 7541, Appendix C.1.
+	for _, test := range []struct {
+		n   uint
+		v   uint64
+		enc []byte
+	}{
+		{5, 10, []byte{0x0a}},
+		{5, 1337, []byte{0x1f, 0x9a, 0x0a}},
+		{8, 42, []byte{0x2a}},
+	} {
+		got := appendPrefixedInt(nil, 0, test.n, test.v)
+		if !bytes.Equal(got, test.enc) {
+			t.Errorf("appendPrefixedInt(%v, %v) = %x, want %x", test.n, test.v, got, test.enc)
+		}
+		v, m := consumePrefixedInt(test.enc, test.n)
+		if v != test.v || m != len(test.enc) {
+			t.Errorf("consumePrefixedInt(%x, %v) = %v, %v; want %v, %v", test.enc, test.n, v, m, test.v, len(test.enc))
+		}
+	}
+	if _, m := consumePrefixedInt([]byte{0x1f, 0x9a}, 5); m >= 0 {
+		t.Errorf("consumePrefixedInt(truncated) = %v, want error", m)
+	}
+	overflow := append([]byte{0xff}, bytes.Repeat([]byte{0xff}, 10)...)
+	if _, m := consumePrefixedInt(append(overflow, 0x01), 8); m >= 0 {
+		t.Errorf("consumePrefixedInt(overflow) = %v, want error", m)
+	}
+}
+
+func TestDecodeFieldSectionRFC9204(t *testing.T) {
+	// Literal Field Line with Name Reference, from RFC 9204, Appendix B.1.
+	b := []byte{
+		0x00, 0x00,
+		0x51, 0x0b, '/', 'i', 'n', 'd', 'e', 'x', '.', 'h', 't', 'm', 'l',
+	}
+	got, err := DecodeFieldSection(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{{":path", "/index.html"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeFieldSection = %v, want %v", got, want)
+	}
+}
+
+func TestFieldSectionRoundTrip(t *testing.T) {
+	fields := []HeaderField{
+		{":method", "GET"},                   // static exact match
+		{":scheme", "https"},                 // static exact match
+		{":authority", "example.com"},        // static name match
+		{":path", "/index.html?q=1"},         // static name match
+		{"user-agent", "Go-http-client/3.0"}, // static name match
+		{"x-custom", "value"},                // literal name
+		{"x-empty", ""},                      // literal name, empty value
+		{"x-long", strings.Repeat("abcdefgh", 100)},
+		{"x-binary", "\x00\xff\x7f"}, // not shorter with Huffman
+	}
+	b := AppendFieldSection(nil, fields)
+	got, err := DecodeFieldSection(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("round trip:\ngot  %q\nwant %q", got, fields)
+	}
+}
+
+func TestDecodeFieldSectionErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		b    []byte
+	}{
+		{"empty", []byte{}},
+		{"missing base", []byte{0x00}},
+		{"required insert count", []byte{0x01, 0x00}},
+		{"dynamic indexed", []byte{0x00, 0x00, 0x80}},
+		{"dynamic name reference", []byte{0x00, 0x00, 0x40, 0x00}},
+		{"post-base indexed", []byte{0x00, 0x00, 0x10}},
+		{"post-base name reference", []byte{0x00, 0x00, 0x00, 0x00}},
+		{"static index out of range", []byte{0x00, 0x00, 0xff, 0x24}},
+		{"name reference without value", []byte{0x00, 0x00, 0x51}},
+		{"truncated value", []byte{0x00, 0x00, 0x51, 0x05, 'a'}},
+		{"literal name without value", []byte{0x00, 0x00, 0x21, 'a'}},
+		{"bad huffman", []byte{0x00, 0x00, 0x51, 0x81, 0x00}},
+	} {
+		if _, err := DecodeFieldSection(test.b, 0); err == nil {
+			t.Errorf("%v: DecodeFieldSection(%x) succeeded, want error", test.desc, test.b)
+		}
+	}
+}
+
+func TestDecodeFieldSectionMaxSize(t *testing.T) {
+	fields := []HeaderField{{"x-a", "1"}, {"x-b", "2"}}
+	b := AppendFieldSection(nil, fields)
+	size := fields[0].Size() + fields[1].Size()
+	if _, err := DecodeFieldSection(b, size); err != nil {
+		t.Errorf("DecodeFieldSection with maxSize = size: %v", err)
+	}
+	if _, err := DecodeFieldSection(b, size-1); err != ErrExcessiveLoad {
+		t.Errorf("DecodeFieldSection with maxSize = size-1: %v, want %v", err, ErrExcessiveLoad)
+	}
+}
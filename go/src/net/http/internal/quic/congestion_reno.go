@@ -0,0 +1,134 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// ccReno is the NewReno-based congestion controller defined in RFC 9002.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-7
+type ccReno struct {
+	maxDatagramSize int
+
+	// Maximum number of bytes allowed to be in flight.
+	congestionWindow int
+
+	// Sum of size of all packets that contain at least one ack-eliciting
+	// or PADDING frame (i.e., any non-ACK frame), and have neither been
+	// acknowledged nor declared lost.
+	bytesInFlight int
+
+	// When the congestion window is below the slow start threshold,
+	// the controller is in slow start.
+	slowStartThreshold int
+
+	// The time the current recovery period started, or zero when not
+	// in a recovery period.
+	recoveryStartTime time.Time
+}
+
+func newReno(maxDatagramSize int) *ccReno {
+	c := &ccReno{
+		maxDatagramSize: maxDatagramSize,
+	}
+
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.2-1
+	c.congestionWindow = min(10*maxDatagramSize, max(14720, c.minimumCongestionWindow()))
+
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.3.1-1
+	c.slowStartThreshold = 1<<63 - 1
+
+	return c
+}
+
+// canSend reports whether the congestion controller permits sending
+// a maximum-size datagram at this time.
+func (c *ccReno) canSend() bool {
+	return c.bytesInFlight+c.maxDatagramSize <= c.congestionWindow
+}
+
+// packetSent is called when a packet is sent.
+func (c *ccReno) packetSent(sent *sentPacket) {
+	if !sent.inFlight {
+		return
+	}
+	c.bytesInFlight += sent.size
+}
+
+// packetAcked is called when a packet containing ack-eliciting
+// or PADDING frames is acknowledged.
+func (c *ccReno) packetAcked(sent *sentPacket) {
+	if !sent.inFlight {
+		return
+	}
+	c.bytesInFlight -= sent.size
+
+	// Don't increase the congestion window during recovery.
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.3.2-2
+	if !c.recoveryStartTime.IsZero() && !sent.time.After(c.recoveryStartTime) {
+		return
+	}
+
+	if c.congestionWindow < c.slowStartThreshold {
+		// Slow start.
+		// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.3.1-2
+		c.congestionWindow += sent.size
+	} else {
+		// Congestion avoidance.
+		// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.3.3-2
+		c.congestionWindow += c.maxDatagramSize * sent.size / c.congestionWindow
+	}
+}
+
+// packetLost is called when a packet is declared lost.
+func (c *ccReno) packetLost(now time.Time, sent *sentPacket) {
+	if !sent.inFlight {
+		return
+	}
+	c.bytesInFlight -= sent.size
+
+	// Packets sent before the start of the current recovery period
+	// do not cause a further reduction.
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.3.2-1
+	if !c.recoveryStartTime.IsZero() && !sent.time.After(c.recoveryStartTime) {
+		return
+	}
+	c.recoveryStartTime = now
+
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.3.2-2
+	const lossReductionFactor = 2
+	c.slowStartThreshold = c.congestionWindow / lossReductionFactor
+	c.congestionWindow = max(c.slowStartThreshold, c.minimumCongestionWindow())
+}
+
+// packetDiscarded is called when the keys for a packet are discarded,
+// removing it from the bytes in flight without signaling congestion.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.4-2
+func (c *ccReno) packetDiscarded(sent *sentPacket) {
+	if !sent.inFlight {
+		return
+	}
+	c.bytesInFlight -= sent.size
+}
+
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-7.2-4
+func (c *ccReno) minimumCongestionWindow() int {
+	return 2 * c.maxDatagramSize
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
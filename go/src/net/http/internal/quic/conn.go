@@ -0,0 +1,630 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Conn is a QUIC connection.
+//
+// Multiple goroutines may invoke methods on a Conn simultaneously.
+type Conn struct {
+	side     connSide
+	endpoint *Endpoint
+	config   *Config
+
+	msgc  chan *datagram // datagrams received from the endpoint
+	wakec chan struct{}  // wakes the connection loop
+	donec chan struct{}  // closed when the connection loop exits
+
+	// mu guards all the fields below, and the state of the conn's streams.
+	// It is held by the connection loop while processing events, and by
+	// API methods while inspecting or changing connection state.
+	mu sync.Mutex
+
+	// changed is closed and replaced whenever the connection state changes,
+	// waking goroutines blocked in waitLocked.
+	changed chan struct{}
+
+	peerAddr net.Addr
+
+	tls           *tls.QUICConn
+	sessionCache  *sessionCache // client only; nil if not resuming sessions
+	keysInitial   fixedKeyPair
+	keysHandshake fixedKeyPair
+	keys0RTT      fixedKeyPair // client writes, server reads
+	keysAppData   updatingKeyPair
+	crypto        [numberSpaceCount]cryptoStream
+	acks          [numberSpaceCount]ackState
+	loss          lossState
+	w             packetWriter
+	sentPackets   []*sentPacket // packets in the datagram under construction
+
+	connIDState connIDState
+	streams     streamsState
+	path        pathState
+
+	// Peer transport parameters which must be retained after the handshake.
+	peerAckDelayExponent int8
+	receivedPeerParams   bool
+
+	// handshakeDone is set when the TLS handshake completes.
+	// handshakeConfirmed is set (on the server) when the handshake completes,
+	// and (on the client) when the server's HANDSHAKE_DONE frame arrives.
+	// On the server, it also tracks sending the HANDSHAKE_DONE frame.
+	handshakeDone      bool
+	handshakeConfirmed sentVal
+
+	// receivedFirstInitial is set by the client when it receives the server's
+	// first Initial packet, which sets the server's connection ID.
+	receivedFirstInitial bool
+
+	idle     idleState
+	lifetime lifetimeState
+	sendPing sentVal // keep-alive PING
+}
+
+// A datagram is a UDP datagram received from the network.
+type datagram struct {
+	b    []byte
+	addr net.Addr
+}
+
+func newConn(now time.Time, side connSide, originalDstConnID, peerSrcConnID []byte, peerAddr net.Addr, config *Config, e *Endpoint) (*Conn, error) {
+	c := &Conn{
+		side:                 side,
+		endpoint:             e,
+		config:               config,
+		peerAddr:             peerAddr,
+		msgc:                 make(chan *datagram, 128),
+		wakec:                make(chan struct{}, 1),
+		donec:                make(chan struct{}),
+		changed:              make(chan struct{}),
+		peerAckDelayExponent: defaultAckDelayExponent,
+	}
+
+	var initialConnID []byte
+	if side == clientSide {
+		if err := c.connIDState.initClient(c); err != nil {
+			return nil, err
+		}
+		initialConnID = c.connIDState.originalDstConnID
+	} else {
+		if err := c.connIDState.initServer(c, originalDstConnID, peerSrcConnID); err != nil {
+			return nil, err
+		}
+		initialConnID = originalDstConnID
+	}
+
+	c.loss.init(c.side, maxUDPPayloadSize, now)
+	c.streams.init(c)
+	c.lifetime.init()
+	c.idle.init(now, c.config)
+
+	params := c.config.transportParameters()
+	params.initialSrcConnID = c.connIDState.srcConnID()
+	params.originalDstConnID = originalDstConnID
+	if err := c.startTLS(now, initialConnID, params); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// start starts the connection loop.
+func (c *Conn) start() {
+	go c.loop()
+	c.wake()
+}
+
+func (c *Conn) String() string {
+	return c.side.String() + " " + c.peerAddr.String()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.endpoint.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peerAddr
+}
+
+// ConnectionState returns basic TLS details about the connection.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tls.ConnectionState()
+}
+
+// sendMsg delivers a datagram to the connection loop.
+// Datagrams are dropped if the connection is not keeping up.
+func (c *Conn) sendMsg(m *datagram) {
+	select {
+	case c.msgc <- m:
+	default:
+	}
+}
+
+// wake wakes up the connection loop.
+func (c *Conn) wake() {
+	select {
+	case c.wakec <- struct{}{}:
+	default:
+	}
+}
+
+// notifyLocked wakes goroutines waiting for a change in connection state.
+// The caller must hold c.mu.
+func (c *Conn) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// waitLocked blocks until cond reports true, ctx is done, or the connection is closing.
+// The caller must hold c.mu, which is released while waiting.
+func (c *Conn) waitLocked(ctx context.Context, cond func() bool) error {
+	for !cond() {
+		if c.lifetime.state != connStateAlive {
+			return c.lifetime.streamErr()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ch := c.changed
+		c.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+		c.mu.Lock()
+	}
+	return nil
+}
+
+// loop is the connection's main loop.
+// It handles received datagrams, timer expirations, and requests from API methods,
+// and sends packets.
+func (c *Conn) loop() {
+	defer c.exit()
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var next time.Time
+	for {
+		var timerc <-chan time.Time
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+			timerc = timer.C
+		}
+		var m *datagram
+		select {
+		case m = <-c.msgc:
+		case <-timerc:
+		case <-c.wakec:
+		}
+		timer.Stop()
+		select {
+		case <-timer.C:
+		default:
+		}
+
+		c.mu.Lock()
+		now := time.Now()
+		if m != nil {
+			c.handleDatagram(now, m)
+			// Process any other queued datagrams before sending,
+			// so ACKs and responses can be combined.
+		drain:
+			for i := 0; i < cap(c.msgc); i++ {
+				select {
+				case m = <-c.msgc:
+					c.handleDatagram(now, m)
+				default:
+					break drain
+				}
+			}
+		}
+		c.advance(now)
+		if c.lifetime.state != connStateDone {
+			c.maybeSend(now)
+		}
+		if c.lifetime.discard {
+			c.lifetime.state = connStateDone
+		}
+		next = c.nextTimeout()
+		done := c.lifetime.state == connStateDone
+		c.notifyLocked()
+		c.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// exit cleans up after the connection loop exits.
+func (c *Conn) exit() {
+	c.mu.Lock()
+	c.lifetime.state = connStateDone
+	c.streams.connClosed()
+	c.notifyLocked()
+	c.mu.Unlock()
+	c.tls.Close()
+	c.endpoint.connDone(c)
+	close(c.donec)
+}
+
+// advance handles timer expirations.
+func (c *Conn) advance(now time.Time) {
+	if c.lifetime.advance(now) {
+		return
+	}
+	if c.idle.advance(now) {
+		// The connection has been idle for too long, and is closed without
+		// sending anything to the peer.
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-10.1
+		c.lifetime.setDone(errIdleTimeout)
+		return
+	}
+	if !c.handshakeDone && c.idle.handshakeTimedOut(now) {
+		c.lifetime.setDone(errHandshakeTimeout)
+		return
+	}
+	if c.idle.shouldSendKeepAlive(now) {
+		c.sendPing.setUnsent()
+	}
+	c.advancePath(now)
+	c.loss.advance(now, c.handleAckOrLoss)
+}
+
+// nextTimeout returns the time of the next timer event.
+func (c *Conn) nextTimeout() time.Time {
+	var next time.Time
+	add := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if c.lifetime.state != connStateAlive {
+		add(c.lifetime.endTime)
+		return next
+	}
+	add(c.loss.timer)
+	for space := numberSpace(0); space < numberSpaceCount; space++ {
+		if c.canWrite(space) {
+			add(c.acks[space].nextAck)
+		}
+	}
+	add(c.idle.nextTimeout(c.handshakeDone))
+	add(c.pathTimeout())
+	return next
+}
+
+// canWrite reports whether we have write keys for a number space.
+func (c *Conn) canWrite(space numberSpace) bool {
+	switch space {
+	case initialSpace:
+		return c.keysInitial.canWrite()
+	case handshakeSpace:
+		return c.keysHandshake.canWrite()
+	default:
+		return c.keysAppData.canWrite()
+	}
+}
+
+// waitReady waits for the handshake to complete,
+// or for the client to be able to send 0-RTT data.
+func (c *Conn) waitReady(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waitLocked(ctx, func() bool {
+		return c.handshakeDone || c.keys0RTT.canWrite()
+	})
+}
+
+// WaitHandshake waits for the connection's handshake to complete.
+//
+// Connections returned by Dial and Accept have completed their handshake,
+// unless they use 0-RTT (see Config.Allow0RTT). An attacker may replay
+// 0-RTT data in a new connection, but cannot complete the handshake for it,
+// so an application should call WaitHandshake before acting on data
+// which is not safe to replay.
+func (c *Conn) WaitHandshake(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waitLocked(ctx, func() bool {
+		return c.handshakeDone
+	})
+}
+
+// Close closes the connection.
+//
+// Close is equivalent to:
+//
+//	conn.Abort(nil)
+//	err := conn.Wait(context.Background())
+func (c *Conn) Close() error {
+	c.Abort(nil)
+	return c.Wait(context.Background())
+}
+
+// Wait waits for the peer to close the connection.
+//
+// If the connection is closed locally and the peer does not close its end of the connection,
+// Wait will return with a non-nil error after the drain period expires.
+//
+// If the peer closes the connection with a NO_ERROR transport error, Wait returns nil.
+// If the peer closes the connection with an application error, Wait returns an ApplicationError
+// containing the peer's error code and reason.
+// If the peer closes the connection with any other status, Wait returns a non-nil error.
+func (c *Conn) Wait(ctx context.Context) error {
+	select {
+	case <-c.donec:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lifetime.finalErr
+}
+
+// Abort closes the connection and returns immediately.
+//
+// If err is nil, Abort sends a transport error of NO_ERROR to the peer.
+// If err is an ApplicationError, Abort sends its error code and text.
+// Otherwise, Abort sends a transport error of APPLICATION_ERROR with the error's text.
+func (c *Conn) Abort(err error) {
+	if err == nil {
+		err = localTransportError{code: errNo}
+	}
+	c.mu.Lock()
+	c.enterClosing(time.Now(), err)
+	c.notifyLocked()
+	c.mu.Unlock()
+	c.wake()
+}
+
+// abort closes the connection with an error detected while processing
+// events in the connection loop.
+func (c *Conn) abort(now time.Time, err error) {
+	c.enterClosing(now, err)
+}
+
+// startTLS starts the TLS handshake.
+func (c *Conn) startTLS(now time.Time, initialConnID []byte, params transportParameters) error {
+	c.keysInitial = initialKeys(initialConnID, c.side)
+
+	qconfig := &tls.QUICConfig{TLSConfig: c.config.TLSConfig}
+	if c.side == clientSide {
+		if cache := c.config.TLSConfig.ClientSessionCache; cache != nil && !c.config.TLSConfig.SessionTicketsDisabled {
+			// c.config is our own copy, made by Dial.
+			c.sessionCache = &sessionCache{ClientSessionCache: cache}
+			c.config.TLSConfig.ClientSessionCache = c.sessionCache
+		}
+		c.tls = tls.QUICClient(qconfig)
+	} else {
+		c.tls = tls.QUICServer(qconfig)
+	}
+	c.tls.SetTransportParameters(marshalTransportParams(params))
+	// The context is used only for the duration of the handshake;
+	// the handshake is canceled by closing the QUICConn.
+	if err := c.tls.Start(context.Background()); err != nil {
+		return err
+	}
+	return c.handleTLSEvents(now)
+}
+
+func (c *Conn) handleTLSEvents(now time.Time) error {
+	for {
+		e := c.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret:
+			if err := checkCipherSuite(e.Suite); err != nil {
+				return err
+			}
+			switch e.Level {
+			case tls.QUICEncryptionLevelEarly:
+				// We only issue tickets allowing 0-RTT
+				// when Config.Allow0RTT is set.
+				c.keys0RTT.r.init(e.Suite, e.Data)
+			case tls.QUICEncryptionLevelHandshake:
+				c.keysHandshake.r.init(e.Suite, e.Data)
+			case tls.QUICEncryptionLevelApplication:
+				c.keysAppData.setReadKey(e.Suite, e.Data)
+			}
+		case tls.QUICSetWriteSecret:
+			if err := checkCipherSuite(e.Suite); err != nil {
+				return err
+			}
+			switch e.Level {
+			case tls.QUICEncryptionLevelEarly:
+				c.start0RTT(e.Suite, e.Data)
+			case tls.QUICEncryptionLevelHandshake:
+				c.keysHandshake.w.init(e.Suite, e.Data)
+			case tls.QUICEncryptionLevelApplication:
+				c.keysAppData.setWriteKey(e.Suite, e.Data)
+				if c.side == clientSide {
+					// "[...] a client SHOULD discard 0-RTT keys
+					// as soon as it installs 1-RTT keys [...]"
+					// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.3-2
+					c.keys0RTT.discard()
+				} else if c.keys0RTT.canRead() {
+					// We have accepted 0-RTT data, and can now
+					// respond with 1-RTT packets.
+					c.endpoint.serverConnEstablished(c)
+				}
+			}
+		case tls.QUICWriteData:
+			space, err := spaceForLevel(e.Level)
+			if err != nil {
+				return err
+			}
+			c.crypto[space].write(e.Data)
+		case tls.QUICTransportParameters:
+			params, err := unmarshalTransportParams(e.Data)
+			if err != nil {
+				return err
+			}
+			if err := c.receiveTransportParameters(params); err != nil {
+				return err
+			}
+		case tls.QUICHandshakeDone:
+			c.handshakeDone = true
+			if c.side == serverSide {
+				// "[...] the TLS handshake is considered confirmed
+				// at the server when the handshake completes."
+				// https://www.rfc-editor.org/rfc/rfc9001#section-4.1.2-1
+				accepted0RTT := c.keys0RTT.canRead()
+				c.confirmHandshake(now)
+				if !accepted0RTT {
+					c.endpoint.serverConnEstablished(c)
+				}
+				// crypto/tls doesn't send session tickets on QUIC
+				// connections unless asked to.
+				if !c.config.TLSConfig.SessionTicketsDisabled {
+					if err := c.tls.SendSessionTicket(tls.QUICSessionTicketOptions{
+						EarlyData: c.config.Allow0RTT,
+					}); err != nil {
+						return tlsError(err)
+					}
+				}
+			}
+		case tls.QUICRejectedEarlyData:
+			c.reject0RTT(now)
+		}
+	}
+}
+
+// handleCrypto processes data received in a CRYPTO frame.
+func (c *Conn) handleCrypto(now time.Time, space numberSpace, off int64, data []byte) error {
+	var level tls.QUICEncryptionLevel
+	switch space {
+	case initialSpace:
+		level = tls.QUICEncryptionLevelInitial
+	case handshakeSpace:
+		level = tls.QUICEncryptionLevelHandshake
+	case appDataSpace:
+		level = tls.QUICEncryptionLevelApplication
+	}
+	return c.crypto[space].handleCrypto(off, data, func(b []byte) error {
+		if err := c.tls.HandleData(level, b); err != nil {
+			return tlsError(err)
+		}
+		return c.handleTLSEvents(now)
+	})
+}
+
+// tlsError converts an error from crypto/tls into a transport error.
+func tlsError(err error) error {
+	var alert tls.AlertError
+	if errors.As(err, &alert) {
+		return localTransportError{code: errTLSBase + transportError(alert), reason: err.Error()}
+	}
+	return localTransportError{code: errInternal, reason: err.Error()}
+}
+
+// checkCipherSuite rejects cipher suites QUIC does not permit.
+func checkCipherSuite(suite uint16) error {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256:
+		return nil
+	}
+	return localTransportError{code: errInternal, reason: "unsupported cipher suite"}
+}
+
+func spaceForLevel(level tls.QUICEncryptionLevel) (numberSpace, error) {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return initialSpace, nil
+	case tls.QUICEncryptionLevelHandshake:
+		return handshakeSpace, nil
+	case tls.QUICEncryptionLevelApplication:
+		return appDataSpace, nil
+	}
+	return 0, localTransportError{code: errInternal, reason: "unknown encryption level"}
+}
+
+// receiveTransportParameters applies transport parameters sent by the peer.
+func (c *Conn) receiveTransportParameters(p transportParameters) error {
+	if err := c.connIDState.validateTransportParameters(c.side, p); err != nil {
+		return err
+	}
+	c.receivedPeerParams = true
+	if c.sessionCache != nil {
+		c.sessionCache.peerParams = earlyDataParams(p)
+	}
+	c.peerAckDelayExponent = p.ackDelayExponent
+	c.loss.setMaxAckDelay(p.maxAckDelay)
+	c.streams.peerTransportParameters(p)
+	c.idle.receivePeerMaxIdleTimeout(p.maxIdleTimeout)
+	c.connIDState.peerActiveConnIDLimit = p.activeConnIDLimit
+	return nil
+}
+
+// confirmHandshake is called when the handshake is confirmed.
+// https://www.rfc-editor.org/rfc/rfc9001#section-4.1.2
+func (c *Conn) confirmHandshake(now time.Time) {
+	if c.handshakeConfirmed.isSet() && c.side == clientSide {
+		return
+	}
+	if c.side == serverSide {
+		// When the server confirms the handshake, it sends a HANDSHAKE_DONE.
+		c.handshakeConfirmed.setUnsent()
+	} else {
+		// The client never sends a HANDSHAKE_DONE, so we set handshakeConfirmed
+		// to the received state, indicating that the handshake is confirmed and we
+		// don't need to send anything.
+		c.handshakeConfirmed.setReceived()
+	}
+	c.loss.confirmHandshake()
+	// "An endpoint MUST discard its Handshake keys when the TLS handshake is confirmed"
+	// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.2-1
+	c.discardKeys(now, handshakeSpace)
+	// A server may keep its 0-RTT keys for a while to handle reordered packets,
+	// but any 0-RTT packets we drop will be retransmitted in 1-RTT ones.
+	// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.3
+	c.keys0RTT.discard()
+	c.connIDState.issueLocalIDs(c)
+}
+
+// discardKeys discards unused packet protection keys.
+// https://www.rfc-editor.org/rfc/rfc9001#section-4.9
+func (c *Conn) discardKeys(now time.Time, space numberSpace) {
+	switch space {
+	case initialSpace:
+		if !c.keysInitial.canWrite() && !c.keysInitial.canRead() {
+			return
+		}
+		c.keysInitial.discard()
+	case handshakeSpace:
+		if !c.keysHandshake.canWrite() && !c.keysHandshake.canRead() {
+			return
+		}
+		c.keysHandshake.discard()
+	}
+	c.loss.discardKeys(now, space)
+	c.crypto[space] = cryptoStream{}
+	c.acks[space] = ackState{}
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
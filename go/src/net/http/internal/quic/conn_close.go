@@ -0,0 +1,189 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	errConnClosed       = errors.New("quic: connection closed")
+	errIdleTimeout      = errors.New("quic: idle timeout")
+	errHandshakeTimeout = errors.New("quic: handshake timeout")
+)
+
+// A connState is the state of a connection.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-10
+type connState int
+
+const (
+	// The connection is open.
+	connStateAlive = connState(iota)
+
+	// The connection has been closed locally, and we are waiting for the peer
+	// to acknowledge the close. We periodically resend CONNECTION_CLOSE.
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-10.2.1
+	connStateClosing
+
+	// The peer has closed the connection.
+	// We send a single CONNECTION_CLOSE in response.
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-10.2.2
+	connStateDraining
+
+	// The connection is closed and all state has been discarded.
+	connStateDone
+)
+
+// lifetimeState tracks the state of a connection as it closes.
+type lifetimeState struct {
+	state connState
+
+	// localErr is the error sent to the peer in a CONNECTION_CLOSE frame.
+	localErr error
+
+	// finalErr is the error returned by Conn.Wait.
+	finalErr error
+
+	// endTime is the time at which the closing state ends.
+	endTime time.Time
+
+	// sendClose is set when we should send a CONNECTION_CLOSE frame.
+	sendClose bool
+
+	// discard is set when the endpoint is closing and no longer waits
+	// for the peer. The connection is done after its next send attempt.
+	discard bool
+}
+
+func (s *lifetimeState) init() {
+	s.state = connStateAlive
+}
+
+// streamErr is the error returned by stream operations after the connection closes.
+func (s *lifetimeState) streamErr() error {
+	if s.finalErr == nil {
+		return errConnClosed
+	}
+	return s.finalErr
+}
+
+// setDone moves the connection to the done state.
+func (s *lifetimeState) setDone(err error) {
+	if s.state == connStateAlive {
+		s.finalErr = err
+	}
+	s.state = connStateDone
+}
+
+// advance handles expiration of the closing period.
+// It reports whether the connection is done.
+func (s *lifetimeState) advance(now time.Time) (done bool) {
+	if s.state == connStateClosing && !now.Before(s.endTime) {
+		s.state = connStateDone
+	}
+	return s.state == connStateDone
+}
+
+// enterClosing starts an immediate close of the connection.
+// We will send a CONNECTION_CLOSE to the peer and wait for it to respond,
+// or for the closing period to expire.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-10.2.1
+func (c *Conn) enterClosing(now time.Time, err error) {
+	s := &c.lifetime
+	if s.state != connStateAlive {
+		return
+	}
+	s.state = connStateClosing
+	s.localErr = err
+	if e, ok := err.(localTransportError); ok && e.code == errNo {
+		s.finalErr = nil
+	} else {
+		s.finalErr = err
+	}
+	// "The closing and draining connection states exist to ensure that
+	// connections close cleanly [...] Three times the current PTO interval
+	// is RECOMMENDED."
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-10.2-2
+	s.endTime = now.Add(3 * c.loss.ptoPeriod())
+	s.sendClose = true
+	c.streams.connClosed()
+}
+
+// discard stops the connection from waiting for the peer to close.
+// Any pending CONNECTION_CLOSE is sent, after which the connection
+// state is discarded.
+func (c *Conn) discard() {
+	c.mu.Lock()
+	c.lifetime.discard = true
+	c.mu.Unlock()
+	c.wake()
+}
+
+// handlePeerConnectionClose handles a CONNECTION_CLOSE from the peer.
+//
+// Once the peer has closed the connection, nothing more can be sent
+// to it but a CONNECTION_CLOSE of our own, so we send one (if we have not
+// already done so) and discard the connection state immediately.
+// Packets arriving afterwards are dropped by the endpoint.
+func (c *Conn) handlePeerConnectionClose(now time.Time, err error) {
+	s := &c.lifetime
+	switch s.state {
+	case connStateAlive:
+		s.finalErr = err
+		s.localErr = localTransportError{code: errNo}
+		s.state = connStateDraining
+		s.sendClose = true
+		c.streams.connClosed()
+	case connStateClosing:
+		// The peer has acknowledged our close.
+		s.state = connStateDone
+	}
+}
+
+// receivedPacketWhileClosing is called when a packet arrives in the closing state.
+// We respond with another CONNECTION_CLOSE.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-10.2.1-2
+func (c *Conn) receivedPacketWhileClosing() {
+	if c.lifetime.state == connStateClosing {
+		c.lifetime.sendClose = true
+	}
+}
+
+// appendConnectionCloseFrame appends a CONNECTION_CLOSE frame carrying
+// the local close error to the packet under construction.
+func (c *Conn) appendConnectionCloseFrame(space numberSpace) {
+	switch err := c.lifetime.localErr.(type) {
+	case localTransportError:
+		c.w.appendConnectionCloseTransportFrame(err.code, 0, err.reason)
+	case *ApplicationError:
+		if space != appDataSpace {
+			// "CONNECTION_CLOSE frames signaling application errors (type 0x1d)
+			// MUST only appear in the application data packet number space."
+			// https://www.rfc-editor.org/rfc/rfc9000#section-12.5-2.2
+			c.w.appendConnectionCloseTransportFrame(errApplicationError, 0, "")
+		} else {
+			c.w.appendConnectionCloseApplicationFrame(err.Code, err.Reason)
+		}
+	default:
+		// "APPLICATION_ERROR: The application or application protocol
+		// caused the connection to be closed during the handshake."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-20.1-2.26.1
+		reason := ""
+		if space == appDataSpace {
+			reason = err.Error()
+		}
+		c.w.appendConnectionCloseTransportFrame(errApplicationError, 0, reason)
+	}
+}
+
+// peerCloseError converts a CONNECTION_CLOSE received from the peer into
+// the error returned by Conn.Wait.
+func peerCloseError(code transportError, reason string) error {
+	if code == errNo {
+		return nil
+	}
+	return peerTransportError{code: code, reason: reason}
+}
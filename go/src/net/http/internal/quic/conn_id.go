@@ -0,0 +1,361 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/rand"
+)
+
+// activeConnIDLimit is the number of connection IDs we are willing to store
+// for the peer, advertised in the active_connection_id_limit transport parameter.
+const activeConnIDLimit = 2
+
+// maxPeerActiveConnIDLimit is the maximum number of connection IDs we issue
+// to the peer, regardless of how many it is willing to store.
+const maxPeerActiveConnIDLimit = 4
+
+// connIDState tracks the connection IDs used on a connection.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-5.1
+type connIDState struct {
+	// local is the set of connection IDs we have issued to the peer.
+	// The peer uses these as the destination connection ID of packets it sends.
+	local []localConnID
+
+	// remote is the set of connection IDs the peer has issued to us.
+	// We use the first of these as the destination connection ID of packets we send.
+	remote []remoteConnID
+
+	// retired are sequence numbers of peer connection IDs we need to retire.
+	retired []retiredConnID
+
+	nextLocalSeq          int64
+	retireRemotePriorTo   int64
+	peerActiveConnIDLimit int64
+
+	// originalDstConnID is the Destination Connection ID in the client's first Initial packet.
+	originalDstConnID []byte
+
+	// peerInitialSrcConnID is the Source Connection ID in the peer's first Initial packet.
+	peerInitialSrcConnID []byte
+}
+
+// A localConnID is a connection ID issued by us.
+type localConnID struct {
+	seq   int64
+	cid   []byte
+	token [16]byte
+	send  sentVal // NEW_CONNECTION_ID frame
+}
+
+// A remoteConnID is a connection ID issued by the peer.
+type remoteConnID struct {
+	seq int64
+	cid []byte
+}
+
+// A retiredConnID is a peer connection ID we are retiring.
+type retiredConnID struct {
+	seq  int64
+	send sentVal // RETIRE_CONNECTION_ID frame
+}
+
+func (s *connIDState) initClient(c *Conn) error {
+	// Client chooses its initial connection ID, and sends it
+	// in the Source Connection ID field of the first Initial packet.
+	if _, err := s.newLocalID(c); err != nil {
+		return err
+	}
+	s.local[0].send.setReceived() // the peer learns this ID from the packet header
+
+	// Client chooses an initial, transient connection ID for the server,
+	// and sends it in the Destination Connection ID field of the first Initial packet.
+	remid, err := randomBytes(connIDLen)
+	if err != nil {
+		return err
+	}
+	s.remote = append(s.remote, remoteConnID{
+		seq: -1,
+		cid: remid,
+	})
+	s.originalDstConnID = remid
+	return nil
+}
+
+func (s *connIDState) initServer(c *Conn, dstConnID, srcConnID []byte) error {
+	// Client-chosen, transient connection ID received in the first Initial packet.
+	// The server will not use this as the Source Connection ID of packets it sends,
+	// but remembers it because it may receive packets sent to this destination.
+	s.originalDstConnID = cloneBytes(dstConnID)
+
+	// Server chooses a connection ID, and sends it in the Source Connection ID of
+	// the response to the client.
+	if _, err := s.newLocalID(c); err != nil {
+		return err
+	}
+	s.local[0].send.setReceived() // the peer learns this ID from the packet header
+
+	// Client chooses its own connection ID, and sends it
+	// in the Source Connection ID field of the first Initial packet.
+	s.remote = append(s.remote, remoteConnID{
+		seq: 0,
+		cid: cloneBytes(srcConnID),
+	})
+	s.peerInitialSrcConnID = s.remote[0].cid
+	return nil
+}
+
+// newLocalID creates and registers a new connection ID for the peer to use.
+func (s *connIDState) newLocalID(c *Conn) ([]byte, error) {
+	cid, err := randomBytes(connIDLen)
+	if err != nil {
+		return nil, err
+	}
+	id := localConnID{
+		seq: s.nextLocalSeq,
+		cid: cid,
+	}
+	if _, err := rand.Read(id.token[:]); err != nil {
+		return nil, err
+	}
+	s.nextLocalSeq++
+	s.local = append(s.local, id)
+	c.endpoint.registerConnID(c, cid)
+	return cid, nil
+}
+
+// srcConnID is the Source Connection ID to use in a sent packet.
+func (s *connIDState) srcConnID() []byte {
+	return s.local[0].cid
+}
+
+// dstConnID is the Destination Connection ID to use in a sent packet.
+func (s *connIDState) dstConnID() []byte {
+	return s.remote[0].cid
+}
+
+// isValidDstConnID reports whether a Destination Connection ID in a received packet
+// is one of ours.
+func (s *connIDState) isValidDstConnID(side connSide, cid []byte) bool {
+	for _, id := range s.local {
+		if bytes.Equal(id.cid, cid) {
+			return true
+		}
+	}
+	// The client's transient connection ID for the server remains valid
+	// for Initial packets sent before the client learns the server's choice.
+	return side == serverSide && bytes.Equal(s.originalDstConnID, cid)
+}
+
+// issueLocalIDs issues additional connection IDs to the peer,
+// up to the number it is willing to store.
+func (s *connIDState) issueLocalIDs(c *Conn) {
+	if len(s.remote) > 0 && len(s.remote[0].cid) == 0 {
+		// A peer using a zero-length connection ID cannot use more.
+		return
+	}
+	limit := s.peerActiveConnIDLimit
+	if limit > maxPeerActiveConnIDLimit {
+		limit = maxPeerActiveConnIDLimit
+	}
+	for int64(len(s.local)) < limit {
+		if _, err := s.newLocalID(c); err != nil {
+			return
+		}
+		s.local[len(s.local)-1].send.setUnsent()
+	}
+}
+
+// handleServerInitialSrcConnID is called by the client when it receives the server's
+// first Initial packet, which contains the server's chosen connection ID.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-7.2-4
+func (s *connIDState) handleServerInitialSrcConnID(srcConnID []byte) {
+	s.remote[0] = remoteConnID{
+		seq: 0,
+		cid: cloneBytes(srcConnID),
+	}
+	s.peerInitialSrcConnID = s.remote[0].cid
+}
+
+// validateTransportParameters verifies the connection ID related transport parameters
+// sent by the peer.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-7.3
+func (s *connIDState) validateTransportParameters(side connSide, p transportParameters) error {
+	if !bytes.Equal(s.peerInitialSrcConnID, p.initialSrcConnID) {
+		return localTransportError{
+			code:   errTransportParameter,
+			reason: "initial_source_connection_id does not match",
+		}
+	}
+	if side == clientSide {
+		if !bytes.Equal(s.originalDstConnID, p.originalDstConnID) {
+			return localTransportError{
+				code:   errTransportParameter,
+				reason: "original_destination_connection_id does not match",
+			}
+		}
+		if p.retrySrcConnID != nil {
+			// We never process Retry packets, so the server cannot have sent one.
+			return localTransportError{
+				code:   errTransportParameter,
+				reason: "retry_source_connection_id without Retry",
+			}
+		}
+	} else {
+		// "A client MUST NOT include any server-only transport parameter [...]"
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-18.2-4
+		if p.originalDstConnID != nil || p.statelessResetToken != nil ||
+			p.preferredAddress != nil || p.retrySrcConnID != nil {
+			return localTransportError{
+				code:   errTransportParameter,
+				reason: "client sent server-only transport parameter",
+			}
+		}
+	}
+	return nil
+}
+
+// handleNewConnectionID handles a NEW_CONNECTION_ID frame.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-19.15
+func (s *connIDState) handleNewConnectionID(seq, retire int64, cid []byte) error {
+	if len(s.remote) > 0 && len(s.remote[0].cid) == 0 {
+		// "An endpoint that is sending packets with a zero-length
+		// Destination Connection ID MUST treat receipt of a NEW_CONNECTION_ID
+		// frame as a connection error of type PROTOCOL_VIOLATION."
+		return localTransportError{
+			code:   errProtocolViolation,
+			reason: "NEW_CONNECTION_ID from peer with zero-length connection ID",
+		}
+	}
+	if seq < s.retireRemotePriorTo {
+		// "An endpoint that receives a NEW_CONNECTION_ID frame with a sequence
+		// number smaller than the Retire Prior To field of a previously received
+		// NEW_CONNECTION_ID frame MUST send a corresponding RETIRE_CONNECTION_ID
+		// frame that retires the newly received connection ID [...]"
+		s.retire(seq)
+		return nil
+	}
+	for _, r := range s.remote {
+		if r.seq == seq {
+			if !bytes.Equal(r.cid, cid) {
+				return localTransportError{
+					code:   errProtocolViolation,
+					reason: "NEW_CONNECTION_ID does not match previous frame with same sequence number",
+				}
+			}
+			return nil
+		}
+	}
+	if retire > s.retireRemotePriorTo {
+		s.retireRemotePriorTo = retire
+	}
+	// Retire connection IDs prior to retireRemotePriorTo.
+	kept := s.remote[:0]
+	for _, r := range s.remote {
+		if r.seq >= 0 && r.seq < s.retireRemotePriorTo {
+			s.retire(r.seq)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.remote = kept
+	s.remote = append(s.remote, remoteConnID{
+		seq: seq,
+		cid: cloneBytes(cid),
+	})
+	// Keep the IDs ordered by sequence number; the first is used for sending.
+	for i := len(s.remote) - 1; i > 0 && s.remote[i].seq < s.remote[i-1].seq; i-- {
+		s.remote[i], s.remote[i-1] = s.remote[i-1], s.remote[i]
+	}
+	if int64(len(s.remote)) > activeConnIDLimit {
+		return localTransportError{
+			code:   errConnectionIDLimit,
+			reason: "active_connection_id_limit exceeded",
+		}
+	}
+	return nil
+}
+
+func (s *connIDState) retire(seq int64) {
+	s.retired = append(s.retired, retiredConnID{seq: seq})
+	s.retired[len(s.retired)-1].send.setUnsent()
+}
+
+// handleRetireConnectionID handles a RETIRE_CONNECTION_ID frame.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-19.16
+func (s *connIDState) handleRetireConnectionID(c *Conn, seq int64) error {
+	if seq >= s.nextLocalSeq {
+		return localTransportError{
+			code:   errProtocolViolation,
+			reason: "RETIRE_CONNECTION_ID for unissued sequence number",
+		}
+	}
+	for i := range s.local {
+		if s.local[i].seq == seq {
+			if len(s.local) == 1 {
+				// Don't retire the only connection ID we have; issue another first.
+				if _, err := s.newLocalID(c); err != nil {
+					return err
+				}
+				s.local[len(s.local)-1].send.setUnsent()
+			}
+			c.endpoint.unregisterConnID(c, s.local[i].cid)
+			s.local = append(s.local[:i], s.local[i+1:]...)
+			break
+		}
+	}
+	s.issueLocalIDs(c)
+	return nil
+}
+
+// ackOrLossNewConnectionID records the fate of a NEW_CONNECTION_ID frame.
+func (s *connIDState) ackOrLossNewConnectionID(pnum packetNumber, seq int64, fate packetFate) {
+	for i := range s.local {
+		if s.local[i].seq == seq {
+			s.local[i].send.ackOrLoss(pnum, fate)
+			return
+		}
+	}
+}
+
+// ackOrLossRetireConnectionID records the fate of a RETIRE_CONNECTION_ID frame.
+func (s *connIDState) ackOrLossRetireConnectionID(pnum packetNumber, seq int64, fate packetFate) {
+	for i := range s.retired {
+		if s.retired[i].seq == seq {
+			s.retired[i].send.ackOrLoss(pnum, fate)
+			if s.retired[i].send.isReceived() {
+				s.retired = append(s.retired[:i], s.retired[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// appendFrames appends NEW_CONNECTION_ID and RETIRE_CONNECTION_ID frames
+// to the current packet.
+//
+// It returns true if no more frames need appending,
+// false if not everything fit in the current packet.
+func (s *connIDState) appendFrames(w *packetWriter, pnum packetNumber) bool {
+	for i := range s.local {
+		if !s.local[i].send.shouldSend() {
+			continue
+		}
+		if !w.appendNewConnectionIDFrame(s.local[i].seq, 0, s.local[i].cid, s.local[i].token) {
+			return false
+		}
+		s.local[i].send.setSent(pnum)
+	}
+	for i := range s.retired {
+		if !s.retired[i].send.shouldSend() {
+			continue
+		}
+		if !w.appendRetireConnectionIDFrame(s.retired[i].seq) {
+			return false
+		}
+		s.retired[i].send.setSent(pnum)
+	}
+	return true
+}
@@ -0,0 +1,417 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var errVersionNegotiation = errors.New("quic: server does not support QUIC version 1")
+
+// handleDatagram processes a datagram received from the peer.
+func (c *Conn) handleDatagram(now time.Time, dgram *datagram) {
+	buf := dgram.b
+	c.loss.datagramReceived(now, len(buf))
+	c.path.datagramReceived(dgram.addr, len(buf))
+	for len(buf) > 0 && c.lifetime.state != connStateDone {
+		var n int
+		switch ptype := getPacketType(buf); ptype {
+		case packetTypeInitial:
+			if c.side == serverSide && len(dgram.b) < minimumClientInitialDatagramSize {
+				// "[...] a server MUST discard an Initial packet that is carried
+				// in a UDP datagram with a payload that is smaller than the
+				// smallest allowed maximum datagram size of 1200 bytes."
+				// https://www.rfc-editor.org/rfc/rfc9000#section-14.1-4
+				return
+			}
+			n = c.handleLongHeader(now, ptype, initialSpace, c.keysInitial.r, buf)
+		case packetTypeHandshake:
+			n = c.handleLongHeader(now, ptype, handshakeSpace, c.keysHandshake.r, buf)
+		case packetType0RTT:
+			n = c.handleLongHeader(now, ptype, appDataSpace, c.keys0RTT.r, buf)
+		case packetType1RTT:
+			n = c.handle1RTT(now, dgram, buf)
+		case packetTypeVersionNegotiation:
+			c.handleVersionNegotiation(now, buf)
+			return
+		default:
+			// We never send anything that could provoke a Retry.
+			n = skipLongHeaderPacket(buf)
+		}
+		if n <= 0 {
+			// We can't find the end of this packet, so drop the rest of the datagram.
+			return
+		}
+		buf = buf[n:]
+	}
+}
+
+// handleLongHeader processes an Initial, 0-RTT, or Handshake packet.
+// It returns the length of the packet, or -1 if the packet cannot be parsed.
+func (c *Conn) handleLongHeader(now time.Time, ptype packetType, space numberSpace, k fixedKeys, buf []byte) int {
+	if !k.isSet() {
+		return skipLongHeaderPacket(buf)
+	}
+	pnumMax := c.acks[space].largestSeen()
+	p, n := parseLongHeaderPacket(buf, k, pnumMax)
+	if n < 0 {
+		return skipLongHeaderPacket(buf)
+	}
+	if p.version != quicVersion1 || !c.connIDState.isValidDstConnID(c.side, p.dstConnID) {
+		return n
+	}
+	if buf[0]&reservedBits != 0 {
+		// "An endpoint MUST treat receipt of a packet that has a non-zero value
+		// for these bits, after removing both packet and header protection,
+		// as a connection error of type PROTOCOL_VIOLATION."
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-17.2-8.2.1
+		c.abort(now, localTransportError{
+			code:   errProtocolViolation,
+			reason: "reserved header bits are not zero",
+		})
+		return -1
+	}
+	if !c.acks[space].shouldProcess(p.num) {
+		return n
+	}
+	if c.side == clientSide && ptype == packetTypeInitial && !c.receivedFirstInitial {
+		// The server's first Initial packet sets the connection ID we use
+		// for the remainder of the connection.
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-7.2-3
+		c.receivedFirstInitial = true
+		c.connIDState.handleServerInitialSrcConnID(p.srcConnID)
+	}
+	if c.side == serverSide && ptype == packetTypeHandshake {
+		// "[...] a server MUST discard Initial keys when it first successfully
+		// processes a Handshake packet."
+		// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.1-2
+		//
+		// "In particular, receipt of a packet protected with Handshake keys
+		// confirms that the peer successfully processed an Initial packet."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-8.1-2
+		c.loss.validateClientAddress()
+		c.discardKeys(now, initialSpace)
+	}
+	ackEliciting := c.handleFrames(now, ptype, space, p.payload)
+	c.acks[space].receive(now, space, p.num, ackEliciting)
+	c.idle.receivePacket(now, c.loss.ptoPeriod())
+	c.receivedPacketWhileClosing()
+	return n
+}
+
+// handle1RTT processes a 1-RTT packet.
+// It returns the length of the packet, or -1 if the packet cannot be parsed.
+func (c *Conn) handle1RTT(now time.Time, dgram *datagram, buf []byte) int {
+	if !c.keysAppData.canRead() {
+		// A 1-RTT packet extends to the end of the datagram,
+		// so skip the rest of the datagram.
+		return len(buf)
+	}
+	if !c.connIDState.isValidDstConnID(c.side, buf[1:][:connIDLen]) {
+		return len(buf)
+	}
+	pnumMax := c.acks[appDataSpace].largestSeen()
+	p, err := parse1RTTPacket(buf, &c.keysAppData, connIDLen, pnumMax)
+	if err != nil {
+		return len(buf)
+	}
+	if buf[0]&reserved1RTTBits != 0 {
+		// "An endpoint MUST treat receipt of a packet that has a non-zero value
+		// for these bits, after removing both packet and header protection,
+		// as a connection error of type PROTOCOL_VIOLATION."
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-17.3.1-4.8.1
+		c.abort(now, localTransportError{
+			code:   errProtocolViolation,
+			reason: "reserved header bits are not zero",
+		})
+		return len(buf)
+	}
+	if !c.acks[appDataSpace].shouldProcess(p.num) {
+		return len(buf)
+	}
+	if p.num > pnumMax {
+		// "[...] an endpoint only changes the address to which it sends packets
+		// in response to the highest-numbered non-probing packet."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-9.3-3
+		if !sameAddr(dgram.addr, c.peerAddr) {
+			c.peerAddressChanged(now, dgram.addr, len(dgram.b))
+		} else if c.path.validating() {
+			// The peer is back at the address we are sending to,
+			// so stop probing the new one.
+			c.path.abandon()
+		}
+	}
+	ackEliciting := c.handleFrames(now, packetType1RTT, appDataSpace, p.payload)
+	c.acks[appDataSpace].receive(now, appDataSpace, p.num, ackEliciting)
+	c.idle.receivePacket(now, c.loss.ptoPeriod())
+	c.receivedPacketWhileClosing()
+	return len(buf)
+}
+
+// handleVersionNegotiation processes a Version Negotiation packet.
+// https://www.rfc-editor.org/rfc/rfc9000#section-6.2
+func (c *Conn) handleVersionNegotiation(now time.Time, pkt []byte) {
+	if c.side != clientSide {
+		return // servers don't handle Version Negotiation packets
+	}
+	// "A client MUST discard any Version Negotiation packet if it has
+	// received and successfully processed any other packet [...]"
+	// https://www.rfc-editor.org/rfc/rfc9000#section-6.2-2
+	if c.receivedFirstInitial {
+		return
+	}
+	dstConnID, srcConnID, versions := parseVersionNegotiation(pkt)
+	if !bytes.Equal(dstConnID, c.connIDState.srcConnID()) || !bytes.Equal(srcConnID, c.connIDState.originalDstConnID) {
+		return
+	}
+	for len(versions) >= 4 {
+		if binary.BigEndian.Uint32(versions) == quicVersion1 {
+			// "A client MUST discard a Version Negotiation packet that lists
+			// the QUIC version selected by the client."
+			// https://www.rfc-editor.org/rfc/rfc9000#section-6.2-2
+			return
+		}
+		versions = versions[4:]
+	}
+	// "A client that supports only this version of QUIC MUST abandon the
+	// current connection attempt if it receives a Version Negotiation packet [...]"
+	// https://www.rfc-editor.org/rfc/rfc9000#section-6.2-2
+	c.lifetime.setDone(errVersionNegotiation)
+}
+
+// handleFrames processes the frames in a packet payload.
+// It reports whether the packet was ack-eliciting.
+func (c *Conn) handleFrames(now time.Time, ptype packetType, space numberSpace, payload []byte) (ackEliciting bool) {
+	if len(payload) == 0 {
+		// "An endpoint MUST treat receipt of a packet containing no frames
+		// as a connection error of type PROTOCOL_VIOLATION."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-12.4-3
+		c.abort(now, localTransportError{
+			code:   errProtocolViolation,
+			reason: "packet contains no frames",
+		})
+		return false
+	}
+	for len(payload) > 0 && c.lifetime.state == connStateAlive {
+		ftype := payload[0]
+		if !frameAllowed(c.side, ptype, ftype) {
+			c.abort(now, localTransportError{
+				code:   errProtocolViolation,
+				reason: "frame not allowed in packet",
+			})
+			return false
+		}
+		var n int
+		var err error
+		switch ftype {
+		case frameTypePadding:
+			n = 1
+			for n < len(payload) && payload[n] == frameTypePadding {
+				n++
+			}
+		case frameTypePing:
+			n = 1
+		case frameTypeAck, frameTypeAckECN:
+			n, err = c.handleAckFrame(now, space, payload)
+		case frameTypeResetStream:
+			id, code, finalSize, nn := consumeResetStreamFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.streams.handleResetStreamFrame(id, code, finalSize)
+			}
+		case frameTypeStopSending:
+			id, code, nn := consumeStopSendingFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.streams.handleStopSendingFrame(id, code)
+			}
+		case frameTypeCrypto:
+			off, data, nn := consumeCryptoFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.handleCrypto(now, space, off, data)
+			}
+		case frameTypeNewToken:
+			// We never send Retry packets or use tokens, so there is nothing to do.
+			_, n = consumeNewTokenFrame(payload)
+		case 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f: // STREAM
+			id, off, fin, data, nn := consumeStreamFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.streams.handleStreamFrame(id, off, fin, data)
+			}
+		case frameTypeMaxData:
+			max, nn := consumeMaxDataFrame(payload)
+			if n = nn; n >= 0 {
+				c.streams.handleMaxDataFrame(max)
+			}
+		case frameTypeMaxStreamData:
+			id, max, nn := consumeMaxStreamDataFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.streams.handleMaxStreamDataFrame(id, max)
+			}
+		case frameTypeMaxStreamsBidi, frameTypeMaxStreamsUni:
+			typ, max, nn := consumeMaxStreamsFrame(payload)
+			if n = nn; n >= 0 {
+				c.streams.handleMaxStreamsFrame(typ, max)
+			}
+		case frameTypeDataBlocked:
+			_, n = consumeDataBlockedFrame(payload)
+		case frameTypeStreamDataBlocked:
+			id, _, nn := consumeStreamDataBlockedFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.streams.handleStreamDataBlockedFrame(id)
+			}
+		case frameTypeStreamsBlockedBidi, frameTypeStreamsBlockedUni:
+			_, _, n = consumeStreamsBlockedFrame(payload)
+		case frameTypeNewConnectionID:
+			seq, retire, connID, _, nn := consumeNewConnectionIDFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.connIDState.handleNewConnectionID(seq, retire, connID)
+			}
+		case frameTypeRetireConnectionID:
+			seq, nn := consumeRetireConnectionIDFrame(payload)
+			if n = nn; n >= 0 {
+				err = c.connIDState.handleRetireConnectionID(c, seq)
+			}
+		case frameTypePathChallenge:
+			data, nn := consumePathChallengeFrame(payload)
+			if n = nn; n >= 0 {
+				c.handlePathChallenge(data)
+			}
+		case frameTypePathResponse:
+			data, nn := consumePathChallengeFrame(payload)
+			if n = nn; n >= 0 {
+				c.handlePathResponse(data)
+			}
+		case frameTypeConnectionCloseTransport:
+			code, _, reason, nn := consumeConnectionCloseTransportFrame(payload)
+			if n = nn; n >= 0 {
+				c.handlePeerConnectionClose(now, peerCloseError(code, reason))
+			}
+		case frameTypeConnectionCloseApplication:
+			code, reason, nn := consumeConnectionCloseApplicationFrame(payload)
+			if n = nn; n >= 0 {
+				c.handlePeerConnectionClose(now, &ApplicationError{Code: code, Reason: reason})
+			}
+		case frameTypeHandshakeDone:
+			n = 1
+			c.confirmHandshake(now)
+		default:
+			n = -1
+		}
+		if n < 0 {
+			// "An endpoint MUST treat the receipt of a frame of unknown type
+			// as a connection error of type FRAME_ENCODING_ERROR."
+			// https://www.rfc-editor.org/rfc/rfc9000#section-12.4-6
+			c.abort(now, localTransportError{
+				code:   errFrameEncoding,
+				reason: "invalid frame",
+			})
+			return false
+		}
+		if err != nil {
+			c.abort(now, err)
+			return false
+		}
+		switch ftype {
+		case frameTypePadding, frameTypeAck, frameTypeAckECN,
+			frameTypeConnectionCloseTransport, frameTypeConnectionCloseApplication:
+		default:
+			// https://www.rfc-editor.org/rfc/rfc9000#section-13.2-4.2.1
+			ackEliciting = true
+		}
+		payload = payload[n:]
+	}
+	return ackEliciting
+}
+
+// frameAllowed reports whether a frame type may appear in a packet of type ptype
+// received by side.
+// https://www.rfc-editor.org/rfc/rfc9000#section-12.4-3
+func frameAllowed(side connSide, ptype packetType, ftype byte) bool {
+	switch ftype {
+	case frameTypePadding, frameTypePing, frameTypeConnectionCloseTransport:
+		// Permitted in all packet types.
+		return true
+	case frameTypeAck, frameTypeAckECN, frameTypeCrypto:
+		// Permitted in all packet types except 0-RTT.
+		return ptype != packetType0RTT
+	case frameTypeNewToken, frameTypeHandshakeDone:
+		// "Clients MUST NOT send NEW_TOKEN/HANDSHAKE_DONE frames."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-19.7-3
+		// https://www.rfc-editor.org/rfc/rfc9000#section-19.20-2
+		if side == serverSide {
+			return false
+		}
+		return ptype == packetType1RTT
+	case frameTypeRetireConnectionID, frameTypePathResponse:
+		return ptype == packetType1RTT
+	}
+	return ptype == packetType1RTT || ptype == packetType0RTT
+}
+
+// handleAckFrame processes an ACK frame.
+func (c *Conn) handleAckFrame(now time.Time, space numberSpace, payload []byte) (int, error) {
+	c.loss.receiveAckStart()
+	invalid := false
+	_, ackDelay, n := consumeAckFrame(payload, func(rangeIndex int, start, end packetNumber) {
+		if rangeIndex == 0 && end > c.loss.nextNumber(space) {
+			// "An endpoint SHOULD treat receipt of an acknowledgment
+			// for a packet it did not send as a connection error of type
+			// PROTOCOL_VIOLATION [...]"
+			// https://www.rfc-editor.org/rfc/rfc9000#section-13.1-3
+			invalid = true
+		}
+		if invalid {
+			return
+		}
+		c.loss.receiveAckRange(now, space, rangeIndex, start, end, c.handleAckOrLoss)
+	})
+	if n < 0 {
+		return -1, nil
+	}
+	if invalid {
+		return n, localTransportError{
+			code:   errProtocolViolation,
+			reason: "acknowledgement for unsent packet",
+		}
+	}
+	// The ack delay is not used for Initial and Handshake packets.
+	// https://www.rfc-editor.org/rfc/rfc9000#section-19.3-4.4
+	var delay time.Duration
+	if space == appDataSpace {
+		delay = ackDelayToDuration(ackDelay, c.peerAckDelayExponent)
+	}
+	c.loss.receiveAckEnd(now, space, delay, c.handleAckOrLoss)
+	return n, nil
+}
+
+// handleAckOrLoss deals with the final fate of a packet we sent:
+// Either the peer acknowledges it, or we declare it lost.
+//
+// In order to handle packet loss, we must retain any information sent to the peer
+// until the peer has acknowledged it.
+//
+// When information is acknowledged, we can discard it.
+//
+// When information is lost, we mark it for retransmission.
+// See RFC 9000, Section 13.3 for a complete list of information which is retransmitted on loss.
+// https://www.rfc-editor.org/rfc/rfc9000#section-13.3
+func (c *Conn) handleAckOrLoss(space numberSpace, sent *sentPacket, fate packetFate) {
+	for _, f := range sent.frames {
+		switch f.typ {
+		case frameTypeCrypto:
+			c.crypto[space].ackOrLoss(f.start, f.end, fate)
+		case frameTypeNewConnectionID:
+			c.connIDState.ackOrLossNewConnectionID(sent.num, f.start, fate)
+		case frameTypeRetireConnectionID:
+			c.connIDState.ackOrLossRetireConnectionID(sent.num, f.start, fate)
+		case frameTypeHandshakeDone:
+			c.handshakeConfirmed.ackOrLoss(sent.num, fate)
+		default:
+			c.streams.ackOrLoss(sent.num, f, fate)
+		}
+	}
+}
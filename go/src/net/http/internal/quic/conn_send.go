@@ -0,0 +1,261 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// maybeSend sends datagrams, if possible.
+// It sends until there is nothing left to send, or until congestion control
+// or the anti-amplification limit prevents sending more.
+func (c *Conn) maybeSend(now time.Time) {
+	c.maybeSendPathChallenge(now)
+	for {
+		limit, dstSize := c.loss.sendLimit()
+		if limit == ccBlocked {
+			// If anti-amplification blocks sending, then no packet can be sent.
+			return
+		}
+		// We may still send ACKs, even if congestion control or pacing limit sending.
+
+		// Prepare to write a datagram of at most dstSize bytes.
+		c.w.reset(dstSize)
+		c.sentPackets = c.sentPackets[:0]
+
+		// The probe space is the space in which a PTO probe should be sent,
+		// or numberSpaceCount if no probe is needed.
+		probeSpace := numberSpaceCount
+		if c.loss.ptoExpired {
+			probeSpace = c.loss.ptoSpace()
+			if probeSpace == handshakeSpace && !c.keysHandshake.canWrite() {
+				probeSpace = initialSpace
+			}
+		}
+
+		pad := false
+		sentHandshake := false
+
+		// Initial packet.
+		if c.keysInitial.canWrite() {
+			pnumMaxAcked := c.loss.largestAcked(initialSpace)
+			pnum := c.loss.nextNumber(initialSpace)
+			p := longPacket{
+				ptype:     packetTypeInitial,
+				version:   quicVersion1,
+				num:       pnum,
+				dstConnID: c.connIDState.dstConnID(),
+				srcConnID: c.connIDState.srcConnID(),
+			}
+			c.w.startProtectedLongHeaderPacket(pnumMaxAcked, p)
+			c.appendFrames(now, initialSpace, pnum, limit, probeSpace == initialSpace)
+			if sent := c.w.finishProtectedLongHeaderPacket(c.keysInitial.w, p); sent != nil {
+				sent.space = initialSpace
+				c.sentPackets = append(c.sentPackets, sent)
+				// "Clients MUST ensure that UDP datagrams containing Initial
+				// packets have UDP payloads of at least 1200 bytes [...]"
+				// https://www.rfc-editor.org/rfc/rfc9000#section-14.1-1
+				//
+				// "[...] a server MUST expand the payload of all UDP datagrams
+				// carrying ack-eliciting Initial packets to at least the smallest
+				// allowed maximum datagram size of 1200 bytes."
+				// https://www.rfc-editor.org/rfc/rfc9000#section-14.1-1
+				if c.side == clientSide || sent.ackEliciting {
+					pad = true
+				}
+			}
+		}
+
+		// Handshake packet.
+		if c.keysHandshake.canWrite() {
+			pnumMaxAcked := c.loss.largestAcked(handshakeSpace)
+			pnum := c.loss.nextNumber(handshakeSpace)
+			p := longPacket{
+				ptype:     packetTypeHandshake,
+				version:   quicVersion1,
+				num:       pnum,
+				dstConnID: c.connIDState.dstConnID(),
+				srcConnID: c.connIDState.srcConnID(),
+			}
+			c.w.startProtectedLongHeaderPacket(pnumMaxAcked, p)
+			c.appendFrames(now, handshakeSpace, pnum, limit, probeSpace == handshakeSpace)
+			if sent := c.w.finishProtectedLongHeaderPacket(c.keysHandshake.w, p); sent != nil {
+				sent.space = handshakeSpace
+				c.sentPackets = append(c.sentPackets, sent)
+				sentHandshake = true
+			}
+		}
+
+		// 0-RTT packet.
+		// The client discards its 0-RTT keys when it has 1-RTT keys.
+		if c.keys0RTT.canWrite() {
+			pnumMaxAcked := c.loss.largestAcked(appDataSpace)
+			pnum := c.loss.nextNumber(appDataSpace)
+			p := longPacket{
+				ptype:     packetType0RTT,
+				version:   quicVersion1,
+				num:       pnum,
+				dstConnID: c.connIDState.dstConnID(),
+				srcConnID: c.connIDState.srcConnID(),
+			}
+			c.w.startProtectedLongHeaderPacket(pnumMaxAcked, p)
+			c.appendFrames(now, appDataSpace, pnum, limit, probeSpace == appDataSpace)
+			if sent := c.w.finishProtectedLongHeaderPacket(c.keys0RTT.w, p); sent != nil {
+				sent.space = appDataSpace
+				c.sentPackets = append(c.sentPackets, sent)
+			}
+		}
+
+		// 1-RTT packet.
+		if c.keysAppData.canWrite() {
+			pnumMaxAcked := c.loss.largestAcked(appDataSpace)
+			pnum := c.loss.nextNumber(appDataSpace)
+			c.w.start1RTTPacket(pnum, pnumMaxAcked, c.connIDState.dstConnID())
+			if c.appendFrames(now, appDataSpace, pnum, limit, probeSpace == appDataSpace) {
+				pad = true
+			}
+			if sent := c.w.finish1RTTPacket(pnum, &c.keysAppData); sent != nil {
+				sent.space = appDataSpace
+				c.sentPackets = append(c.sentPackets, sent)
+			}
+		}
+
+		padTo := 0
+		if pad {
+			padTo = min(minimumClientInitialDatagramSize, dstSize)
+		}
+		buf := c.w.finishDatagram(padTo)
+		if buf == nil {
+			return
+		}
+		for _, sent := range c.sentPackets {
+			c.loss.packetSent(now, sent)
+			if sent.ackEliciting {
+				c.idle.sentAckEliciting(now, c.loss.ptoPeriod())
+			}
+		}
+		c.loss.datagramSent(len(buf))
+		c.endpoint.sendDatagram(buf, c.peerAddr)
+
+		if sentHandshake && c.side == clientSide {
+			// "[...] a client MUST discard Initial keys when it first
+			// sends a Handshake packet [...]"
+			// https://www.rfc-editor.org/rfc/rfc9001.html#section-4.9.1-2
+			c.discardKeys(now, initialSpace)
+		}
+		if c.lifetime.state != connStateAlive {
+			// We have sent our CONNECTION_CLOSE, and need send nothing else
+			// until more packets arrive from the peer.
+			c.lifetime.sendClose = false
+			if c.lifetime.state == connStateDraining {
+				c.lifetime.state = connStateDone
+			}
+			return
+		}
+	}
+}
+
+// appendFrames appends frames to the packet under construction in the given space.
+// If pto is true, the packet is a PTO probe and must be ack-eliciting.
+// It reports whether the datagram should be padded to the minimum size
+// because it contains a PATH_CHALLENGE or PATH_RESPONSE frame.
+func (c *Conn) appendFrames(now time.Time, space numberSpace, pnum packetNumber, limit ccLimit, pto bool) (pad bool) {
+	if c.lifetime.state != connStateAlive {
+		if c.lifetime.sendClose {
+			c.appendConnectionCloseFrame(space)
+		}
+		return false
+	}
+
+	// ACK frames are sent first, when an ack is due.
+	// Otherwise, an ACK is sent at the end of any packet containing other frames.
+	ackSent := false
+	if c.acks[space].shouldSendAck(now) {
+		ackSent = c.appendAckFrame(now, space)
+	}
+	if limit != ccOK && !pto {
+		// Congestion control permits only ACK-only packets.
+		return false
+	}
+	defer func() {
+		if !ackSent && len(c.w.payload()) > 0 {
+			c.appendAckFrame(now, space)
+		}
+		if pto && (c.w.sent == nil || !c.w.sent.ackEliciting) {
+			// "When a PTO timer expires, a sender MUST send at least one
+			// ack-eliciting packet in the packet number space as a probe."
+			// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.4-1
+			c.w.appendPingFrame()
+		}
+	}()
+
+	if space == appDataSpace {
+		// HANDSHAKE_DONE
+		if c.side == serverSide && c.handshakeConfirmed.shouldSendPTO(pto) {
+			if !c.w.appendHandshakeDoneFrame() {
+				return false
+			}
+			c.handshakeConfirmed.setSent(pnum)
+		}
+		// PATH_CHALLENGE, PATH_RESPONSE
+		pad = c.appendPathFrames()
+		// NEW_CONNECTION_ID, RETIRE_CONNECTION_ID
+		if !c.connIDState.appendFrames(&c.w, pnum) {
+			return pad
+		}
+		// Keep-alive PING
+		if c.sendPing.shouldSend() {
+			if !c.w.appendPingFrame() {
+				return pad
+			}
+			c.sendPing.clear()
+		}
+	}
+
+	// CRYPTO
+	if !c.appendCryptoFrames(space, pto) {
+		return pad
+	}
+
+	if space == appDataSpace {
+		// MAX_DATA, MAX_STREAMS, and stream frames
+		c.streams.appendFrames(&c.w, pnum, pto)
+	}
+	return pad
+}
+
+// appendAckFrame appends an ACK frame to the current packet, if there is
+// anything to acknowledge. It reports whether a frame was appended.
+func (c *Conn) appendAckFrame(now time.Time, space numberSpace) bool {
+	seen, delay := c.acks[space].acksToSend(now)
+	if len(seen) == 0 {
+		return false
+	}
+	d := unscaledAckDelayFromDuration(delay)
+	if !c.w.appendAckFrame(seen, d) {
+		return false
+	}
+	c.acks[space].sentAck()
+	return true
+}
+
+// appendCryptoFrames appends CRYPTO frames to the current packet.
+// It reports whether all pending data fit in the packet.
+func (c *Conn) appendCryptoFrames(space numberSpace, pto bool) bool {
+	ok := true
+	c.crypto[space].dataToSend(pto, func(off, size int64) int64 {
+		b, added := c.w.appendCryptoFrame(off, int(size))
+		if !added {
+			ok = false
+			return 0
+		}
+		c.crypto[space].sendData(off, b)
+		if int64(len(b)) < size {
+			ok = false
+		}
+		return int64(len(b))
+	})
+	return ok
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// "Implementations MUST support buffering at least 4096 bytes of data
+// received in out-of-order CRYPTO frames."
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-7.5-2
+//
+// 4096 is too small for real-world cases, however, so we allow more.
+const cryptoBufferSize = 1 << 20
+
+// A cryptoStream is the stream of data passed in CRYPTO frames.
+// There is one cryptoStream per packet number space.
+type cryptoStream struct {
+	// CRYPTO data received from the peer.
+	in    pipe
+	inset rangeset // bytes received
+
+	// CRYPTO data queued for transmission to the peer.
+	out       pipe
+	outunsent rangeset // bytes in need of sending
+	outacked  rangeset // bytes acked by peer
+}
+
+// handleCrypto processes data received in a CRYPTO frame.
+// It calls f with each contiguous chunk of data which becomes available.
+func (s *cryptoStream) handleCrypto(off int64, b []byte, f func([]byte) error) error {
+	end := off + int64(len(b))
+	if end-s.in.start > cryptoBufferSize {
+		return localTransportError{
+			code:   errCryptoBufferExceeded,
+			reason: "crypto buffer exceeded",
+		}
+	}
+	if end <= s.in.start {
+		// Duplicate data.
+		return nil
+	}
+	s.in.writeAt(b, off)
+	s.inset.add(off, end)
+	if s.inset.numRanges() == 0 || s.inset[0].start > s.in.start {
+		return nil
+	}
+	// Deliver all contiguous data at the start of the stream.
+	start := s.in.start
+	avail := s.inset[0].end
+	data := make([]byte, avail-start)
+	s.in.copy(start, data)
+	s.in.discardBefore(avail)
+	return f(data)
+}
+
+// write queues data for sending to the peer.
+// It does not block or limit the amount of buffered data.
+// QUIC connections don't communicate the amount of CRYPTO data they are willing to buffer,
+// so we send what we have and the peer can close the connection if it is too much.
+func (s *cryptoStream) write(b []byte) {
+	start := s.out.end()
+	s.out.writeAt(b, start)
+	s.outunsent.add(start, s.out.end())
+}
+
+// ackOrLoss reports that a CRYPTO frame sent by us has been acknowledged by the peer, or lost.
+func (s *cryptoStream) ackOrLoss(start, end int64, fate packetFate) {
+	switch fate {
+	case packetAcked:
+		s.outacked.add(start, end)
+		s.outunsent.sub(start, end)
+		// If this ack is for data at the start of the send buffer, we can now discard it.
+		if s.outacked.contains(s.out.start) {
+			s.out.discardBefore(s.outacked[0].end)
+		}
+	case packetLost:
+		// Mark everything lost, but not previously acked, as needing retransmission.
+		// We do this by adding all the lost bytes to outunsent, and then
+		// removing everything already acked.
+		s.outunsent.add(start, end)
+		for _, a := range s.outacked {
+			s.outunsent.sub(a.start, a.end)
+		}
+	}
+}
+
+// dataToSend reports what data should be sent in CRYPTO frames to the peer.
+// It calls f with each range of data to send.
+// f uses sendData to get the bytes to send, and returns the number of bytes sent.
+// dataToSend calls f until no data is left, or f returns 0.
+//
+// This function is unusually indirect (why not just return a []byte,
+// or implement io.Reader?).
+//
+// Returning a []byte to the caller either requires that we store the
+// data in contiguous buffers, or that we copy the data.
+//
+// Using io.Reader requires us to track the position in the stream
+// on behalf of the caller.
+//
+// If pto is true, dataToSend sends all unacknowledged data
+// rather than only data not yet sent, to construct a probe packet.
+func (s *cryptoStream) dataToSend(pto bool, f func(off, size int64) (sent int64)) {
+	for {
+		off, size := dataToSend(s.out.start, s.out.end(), s.outunsent, s.outacked, pto)
+		if size == 0 {
+			return
+		}
+		n := f(off, size)
+		if n == 0 || pto {
+			return
+		}
+	}
+}
+
+// sendData fills b with data to send to the peer, starting at off,
+// and marks the data as sent.
+func (s *cryptoStream) sendData(off int64, b []byte) {
+	s.out.copy(off, b)
+	s.outunsent.sub(off, off+int64(len(b)))
+}
+
+// dataToSend returns the next range of data to send.
+// If pto is true, it returns the first unacknowledged range.
+func dataToSend(start, end int64, outunsent, outacked rangeset, pto bool) (sendStart, size int64) {
+	switch {
+	case pto:
+		// On PTO, resend unacked data that may have been lost.
+		for _, r := range outacked {
+			if r.start > start {
+				return start, r.start - start
+			}
+			start = r.end
+		}
+		return start, end - start
+	case outunsent.numRanges() > 0:
+		return outunsent.min(), outunsent[0].size()
+	default:
+		return end, 0
+	}
+}
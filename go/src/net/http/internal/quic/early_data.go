@@ -0,0 +1,154 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"strings"
+	"time"
+)
+
+// 0-RTT requires both endpoints to remember the server's transport parameters
+// from the connection in which the session ticket was issued.
+//
+// "A client that attempts to send 0-RTT data MUST remember all other
+// transport parameters used by the server that it is able to process.
+// [...] A server that accepts 0-RTT data MUST NOT reduce any limits or
+// alter any values that might be violated by the client with its 0-RTT data."
+// https://www.rfc-editor.org/rfc/rfc9000#section-7.4.1
+//
+// Both store the parameters in the session state's Extra field:
+// the client with a wrapper around its ClientSessionCache, and the
+// server with WrapSession and UnwrapSession hooks.
+
+// earlyDataParamsPrefix identifies the transport parameters in SessionState.Extra.
+const earlyDataParamsPrefix = "quic-0rtt-params-v1\x00"
+
+// earlyDataParams returns the encoded transport parameters in p
+// which a client must remember to send 0-RTT data.
+func earlyDataParams(p transportParameters) []byte {
+	return marshalTransportParams(transportParameters{
+		maxUDPPayloadSize:              maxVarint,
+		initialMaxData:                 p.initialMaxData,
+		initialMaxStreamDataBidiLocal:  p.initialMaxStreamDataBidiLocal,
+		initialMaxStreamDataBidiRemote: p.initialMaxStreamDataBidiRemote,
+		initialMaxStreamDataUni:        p.initialMaxStreamDataUni,
+		initialMaxStreamsBidi:          p.initialMaxStreamsBidi,
+		initialMaxStreamsUni:           p.initialMaxStreamsUni,
+		ackDelayExponent:               defaultAckDelayExponent,
+		maxAckDelay:                    defaultMaxAckDelay,
+		activeConnIDLimit:              p.activeConnIDLimit,
+	})
+}
+
+// findEarlyDataParams returns the transport parameters stored in a session's
+// Extra field, or nil if there are none.
+func findEarlyDataParams(extra [][]byte) []byte {
+	for _, e := range extra {
+		if strings.HasPrefix(string(e), earlyDataParamsPrefix) {
+			return e[len(earlyDataParamsPrefix):]
+		}
+	}
+	return nil
+}
+
+// A sessionCache wraps a client's tls.ClientSessionCache.
+// It stores the server's transport parameters with sessions that permit
+// 0-RTT, and records the parameters of the session being resumed.
+//
+// Its methods are called by crypto/tls while the connection's lock is held.
+type sessionCache struct {
+	tls.ClientSessionCache
+
+	peerParams []byte // server's parameters for this connection, set once received
+	resumed    []byte // parameters stored with the session offered for resumption
+}
+
+func (c *sessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	cs, ok := c.ClientSessionCache.Get(sessionKey)
+	c.resumed = nil
+	if ok && cs != nil {
+		if _, state, err := cs.ResumptionState(); err == nil && state.EarlyData {
+			c.resumed = findEarlyDataParams(state.Extra)
+		}
+	}
+	return cs, ok
+}
+
+func (c *sessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs != nil && c.peerParams != nil {
+		ticket, state, err := cs.ResumptionState()
+		if err == nil && state.EarlyData && findEarlyDataParams(state.Extra) == nil {
+			extra := append([]byte(earlyDataParamsPrefix), c.peerParams...)
+			state.Extra = append(state.Extra, extra)
+			if rcs, err := tls.NewResumptionState(ticket, state); err == nil {
+				cs = rcs
+			}
+		}
+	}
+	c.ClientSessionCache.Put(sessionKey, cs)
+}
+
+// setEarlyDataSessionHooks sets the WrapSession and UnwrapSession hooks of a
+// server's TLS configuration to store its transport parameters in session
+// tickets, and to refuse 0-RTT when resuming a session issued with different
+// transport parameters.
+func setEarlyDataSessionHooks(config *tls.Config, params []byte) {
+	wrap := config.WrapSession
+	if wrap == nil {
+		wrap = config.EncryptTicket
+	}
+	unwrap := config.UnwrapSession
+	if unwrap == nil {
+		unwrap = config.DecryptTicket
+	}
+	config.WrapSession = func(cs tls.ConnectionState, state *tls.SessionState) ([]byte, error) {
+		if state.EarlyData {
+			state.Extra = append(state.Extra, append([]byte(earlyDataParamsPrefix), params...))
+		}
+		return wrap(cs, state)
+	}
+	config.UnwrapSession = func(identity []byte, cs tls.ConnectionState) (*tls.SessionState, error) {
+		state, err := unwrap(identity, cs)
+		if err == nil && state != nil && state.EarlyData {
+			// We could accept 0-RTT if our limits have only increased,
+			// but don't bother: they are fixed for the life of an Endpoint.
+			state.EarlyData = bytes.Equal(findEarlyDataParams(state.Extra), params)
+		}
+		return state, err
+	}
+}
+
+// start0RTT is called when a client receives the secret for 0-RTT packets.
+func (c *Conn) start0RTT(suite uint16, secret []byte) {
+	if !c.config.Allow0RTT || c.sessionCache == nil || c.sessionCache.resumed == nil {
+		// Without the server's remembered transport parameters,
+		// we don't know how much data we may send.
+		return
+	}
+	p, err := unmarshalTransportParams(c.sessionCache.resumed)
+	if err != nil {
+		return
+	}
+	c.keys0RTT.w.init(suite, secret)
+	c.streams.peerTransportParameters(p)
+	c.connIDState.peerActiveConnIDLimit = p.activeConnIDLimit
+}
+
+// reject0RTT is called when the server rejects a client's 0-RTT data.
+//
+// The data is sent again in 1-RTT packets once the handshake completes.
+// The server's new transport parameters replace the remembered ones;
+// if they are lower than the limits we relied on, the server will close
+// the connection with a flow control or stream limit error.
+// https://www.rfc-editor.org/rfc/rfc9001#section-4.6.2
+func (c *Conn) reject0RTT(now time.Time) {
+	if !c.keys0RTT.canWrite() {
+		return
+	}
+	c.keys0RTT.discard()
+	c.loss.discard0RTT(now, c.handleAckOrLoss)
+}
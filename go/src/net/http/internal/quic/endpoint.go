@@ -0,0 +1,331 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errEndpointClosed = errors.New("quic: endpoint closed")
+
+// An Endpoint handles QUIC traffic on a network address.
+// It can accept inbound connections or create outbound ones.
+//
+// Multiple goroutines may invoke methods on an Endpoint simultaneously.
+type Endpoint struct {
+	config *Config // nil if the endpoint does not accept connections
+	pc     net.PacketConn
+	donec  chan struct{} // closed when the read loop exits
+
+	mu        sync.Mutex
+	conns     map[*Conn]struct{}
+	connsByID map[string]*Conn // keyed by local connection ID
+	acceptq   []*Conn
+	changed   chan struct{} // closed and replaced when acceptq or closing changes
+	closing   bool
+}
+
+// Listen listens on a local network address.
+// The configuration config must be non-nil to accept inbound connections.
+// If config is nil, the endpoint may only be used to create outbound connections.
+func Listen(network, address string, config *Config) (*Endpoint, error) {
+	if config != nil && config.TLSConfig == nil {
+		return nil, errors.New("quic: Config.TLSConfig is not set")
+	}
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewEndpoint(pc, config), nil
+}
+
+// NewEndpoint returns an endpoint using the provided packet connection,
+// which is closed when the endpoint is closed.
+// The configuration config must be non-nil to accept inbound connections.
+func NewEndpoint(pc net.PacketConn, config *Config) *Endpoint {
+	e := &Endpoint{
+		pc:        pc,
+		donec:     make(chan struct{}),
+		conns:     make(map[*Conn]struct{}),
+		connsByID: make(map[string]*Conn),
+		changed:   make(chan struct{}),
+	}
+	if config != nil {
+		e.config = configWithTLS13(config, "")
+		if config.Allow0RTT {
+			setEarlyDataSessionHooks(e.config.TLSConfig, earlyDataParams(e.config.transportParameters()))
+		}
+	}
+	go e.listen()
+	return e
+}
+
+// configWithTLS13 returns a copy of config whose TLS configuration
+// requires TLS 1.3, as QUIC does.
+// If serverName is non-empty and the configuration does not set a server name,
+// it is used as the server name.
+func configWithTLS13(config *Config, serverName string) *Config {
+	c := *config
+	c.TLSConfig = config.TLSConfig.Clone()
+	if c.TLSConfig.MinVersion < tls.VersionTLS13 {
+		c.TLSConfig.MinVersion = tls.VersionTLS13
+	}
+	if c.TLSConfig.ServerName == "" {
+		c.TLSConfig.ServerName = serverName
+	}
+	return &c
+}
+
+// LocalAddr returns the local network address.
+func (e *Endpoint) LocalAddr() net.Addr {
+	return e.pc.LocalAddr()
+}
+
+// Close closes the endpoint.
+//
+// Close closes all connections with a NO_ERROR transport error,
+// and waits for the peers to acknowledge the close or for the
+// closing period to expire, or until ctx is done.
+// If ctx is done first, the remaining connections are discarded
+// without waiting further.
+// It then closes the endpoint's packet connection.
+func (e *Endpoint) Close(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closing {
+		e.closing = true
+		close(e.changed)
+		e.changed = make(chan struct{})
+	}
+	conns := make([]*Conn, 0, len(e.conns))
+	for c := range e.conns {
+		conns = append(conns, c)
+	}
+	e.mu.Unlock()
+
+	var err error
+	for _, c := range conns {
+		c.Abort(nil)
+	}
+	for _, c := range conns {
+		select {
+		case <-c.donec:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		for _, c := range conns {
+			c.discard()
+		}
+		for _, c := range conns {
+			<-c.donec
+		}
+	}
+	if cerr := e.pc.Close(); err == nil && !errors.Is(cerr, net.ErrClosed) {
+		err = cerr
+	}
+	<-e.donec
+	return err
+}
+
+// Accept waits for and returns the next connection to the endpoint.
+// The connection's handshake has completed, unless the connection
+// accepted 0-RTT data (see Config.Allow0RTT).
+func (e *Endpoint) Accept(ctx context.Context) (*Conn, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.acceptq) == 0 {
+		if e.closing {
+			return nil, errEndpointClosed
+		}
+		ch := e.changed
+		e.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			e.mu.Lock()
+			return nil, ctx.Err()
+		}
+		e.mu.Lock()
+	}
+	c := e.acceptq[0]
+	e.acceptq[0] = nil
+	e.acceptq = e.acceptq[1:]
+	return c, nil
+}
+
+// Dial creates and returns a connection to a network address.
+// It returns once the connection's handshake has completed,
+// or once it can send 0-RTT data (see Config.Allow0RTT).
+func (e *Endpoint) Dial(ctx context.Context, network, address string, config *Config) (*Conn, error) {
+	if config == nil || config.TLSConfig == nil {
+		return nil, errors.New("quic: Config.TLSConfig is not set")
+	}
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	closing := e.closing
+	e.mu.Unlock()
+	if closing {
+		return nil, errEndpointClosed
+	}
+	c, err := newConn(time.Now(), clientSide, nil, nil, addr, configWithTLS13(config, host), e)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.conns[c] = struct{}{}
+	e.mu.Unlock()
+	c.start()
+	if err := c.waitReady(ctx); err != nil {
+		c.Abort(nil)
+		return nil, err
+	}
+	return c, nil
+}
+
+// listen is the endpoint's read loop.
+func (e *Endpoint) listen() {
+	defer close(e.donec)
+	for {
+		// The connection takes ownership of the buffer.
+		buf := make([]byte, maxRecvUDPPayloadSize)
+		n, addr, err := e.pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		e.handleDatagram(buf[:n:n], addr)
+	}
+}
+
+// handleDatagram dispatches a datagram to the connection it is addressed to,
+// or creates a new connection if the datagram starts one.
+func (e *Endpoint) handleDatagram(b []byte, addr net.Addr) {
+	dstConnID, ok := dstConnIDForDatagram(b)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	c := e.connsByID[string(dstConnID)]
+	closing := e.closing
+	e.mu.Unlock()
+	if c != nil {
+		c.sendMsg(&datagram{b: b, addr: addr})
+		return
+	}
+	if !isLongHeader(b[0]) {
+		// A short header packet for an unknown connection.
+		// We don't send stateless resets, so drop it.
+		return
+	}
+	p, ok := parseGenericLongHeaderPacket(b)
+	if !ok || len(b) < minimumClientInitialDatagramSize {
+		return
+	}
+	if p.version == 0 {
+		// Version Negotiation for an unknown connection.
+		return
+	}
+	if p.version != quicVersion1 {
+		// "A server sends a Version Negotiation packet in response to each
+		// packet that might initiate a new connection [...]"
+		// https://www.rfc-editor.org/rfc/rfc9000#section-6.1-1
+		//
+		// The Destination and Source Connection ID fields echo the client's
+		// Source and Destination Connection IDs.
+		e.sendDatagram(appendVersionNegotiation(nil, p.srcConnID, p.dstConnID, quicVersion1), addr)
+		return
+	}
+	if getPacketType(b) != packetTypeInitial || e.config == nil || closing {
+		return
+	}
+	if len(p.dstConnID) < 8 {
+		// "When an Initial packet is sent by a client that has not previously
+		// received an Initial or Retry packet from the server, the client
+		// populates the Destination Connection ID field with an unpredictable
+		// value. This Destination Connection ID MUST be at least 8 bytes in length."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-7.2-3
+		return
+	}
+	c, err := newConn(time.Now(), serverSide, p.dstConnID, p.srcConnID, addr, e.config, e)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	e.conns[c] = struct{}{}
+	// The client sends packets addressed to its chosen connection ID
+	// until it receives the server's first Initial packet.
+	e.connsByID[string(p.dstConnID)] = c
+	e.mu.Unlock()
+	c.sendMsg(&datagram{b: b, addr: addr})
+	c.start()
+}
+
+// sendDatagram sends a datagram to addr.
+func (e *Endpoint) sendDatagram(b []byte, addr net.Addr) {
+	// Send errors are treated as packet loss.
+	e.pc.WriteTo(b, addr)
+}
+
+// registerConnID associates a local connection ID with a connection.
+func (e *Endpoint) registerConnID(c *Conn, cid []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.connsByID[string(cid)] = c
+}
+
+// unregisterConnID removes the association of a local connection ID with a connection.
+func (e *Endpoint) unregisterConnID(c *Conn, cid []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.connsByID[string(cid)] == c {
+		delete(e.connsByID, string(cid))
+	}
+}
+
+// serverConnEstablished is called by a server connection when its handshake
+// completes, or when it accepts 0-RTT data.
+func (e *Endpoint) serverConnEstablished(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closing {
+		return
+	}
+	e.acceptq = append(e.acceptq, c)
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// connDone is called by a connection when it exits.
+func (e *Endpoint) connDone(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.conns, c)
+	for id, cc := range e.connsByID {
+		if cc == c {
+			delete(e.connsByID, id)
+		}
+	}
+}
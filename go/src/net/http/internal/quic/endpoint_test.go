@@ -0,0 +1,767 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testCertOnce sync.Once
+	testCert     tls.Certificate
+	testRoots    *x509.CertPool
+)
+
+// newTestTLSConfigs returns TLS configurations for a server
+// with a self-signed certificate for "example.com", and for a client
+// which trusts it.
+func newTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	testCertOnce.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "example.com"},
+			DNSNames:              []string{"example.com"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			panic(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			panic(err)
+		}
+		testCert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+		testRoots = x509.NewCertPool()
+		testRoots.AddCert(cert)
+	})
+	server = &tls.Config{
+		Certificates: []tls.Certificate{testCert},
+		NextProtos:   []string{"test"},
+	}
+	client = &tls.Config{
+		RootCAs:    testRoots,
+		ServerName: "example.com",
+		NextProtos: []string{"test"},
+	}
+	return server, client
+}
+
+// newTestEndpoints returns a listening server endpoint and a client endpoint.
+// The wrap function, if non-nil, wraps the server's PacketConn.
+func newTestEndpoints(t *testing.T, wrap func(net.PacketConn) net.PacketConn) (server, client *Endpoint, clientConfig *Config) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	if wrap != nil {
+		pc = wrap(pc)
+	}
+	server = NewEndpoint(pc, &Config{TLSConfig: serverTLS})
+	client, err = Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client.Close(ctx)
+		server.Close(ctx)
+	})
+	return server, client, &Config{TLSConfig: clientTLS}
+}
+
+// dialAndAccept connects a client to a server.
+func dialAndAccept(t *testing.T, server, client *Endpoint, config *Config) (cconn, sconn *Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	type result struct {
+		c   *Conn
+		err error
+	}
+	acceptc := make(chan result, 1)
+	go func() {
+		c, err := server.Accept(ctx)
+		acceptc <- result{c, err}
+	}()
+	cconn, err := client.Dial(ctx, "udp", server.LocalAddr().String(), config)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	r := <-acceptc
+	if r.err != nil {
+		t.Fatalf("Accept: %v", r.err)
+	}
+	return cconn, r.c
+}
+
+func TestEndpointHandshake(t *testing.T) {
+	server, client, config := newTestEndpoints(t, nil)
+	cconn, sconn := dialAndAccept(t, server, client, config)
+	if got := cconn.ConnectionState().NegotiatedProtocol; got != "test" {
+		t.Errorf("client NegotiatedProtocol = %q, want %q", got, "test")
+	}
+	if got := sconn.ConnectionState().Version; got != tls.VersionTLS13 {
+		t.Errorf("server TLS version = %x, want %x", got, tls.VersionTLS13)
+	}
+	if err := cconn.Close(); err != nil {
+		t.Errorf("client Close: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sconn.Wait(ctx); err != nil {
+		t.Errorf("server Wait after client close: %v", err)
+	}
+}
+
+// notifyingSessionCache is a ClientSessionCache which reports new sessions.
+type notifyingSessionCache struct {
+	tls.ClientSessionCache
+	putc chan struct{}
+}
+
+func (c *notifyingSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.ClientSessionCache.Put(sessionKey, cs)
+	if cs != nil {
+		select {
+		case c.putc <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func TestEndpointSessionResumption(t *testing.T) {
+	server, client, config := newTestEndpoints(t, nil)
+	cache := &notifyingSessionCache{
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		putc:               make(chan struct{}, 1),
+	}
+	config.TLSConfig.ClientSessionCache = cache
+
+	cconn, _ := dialAndAccept(t, server, client, config)
+	if cconn.ConnectionState().DidResume {
+		t.Errorf("first connection unexpectedly resumed a session")
+	}
+	select {
+	case <-cache.putc:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server did not send a session ticket")
+	}
+	cconn.Close()
+
+	cconn, _ = dialAndAccept(t, server, client, config)
+	if !cconn.ConnectionState().DidResume {
+		t.Errorf("second connection did not resume the session")
+	}
+}
+
+func TestEndpointHandshakeFailure(t *testing.T) {
+	server, client, config := newTestEndpoints(t, nil)
+	config.TLSConfig = config.TLSConfig.Clone()
+	config.TLSConfig.ServerName = "wrong.example.com"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := client.Dial(ctx, "udp", server.LocalAddr().String(), config)
+	if err == nil {
+		t.Fatal("Dial with bad server name succeeded, want error")
+	}
+	var te localTransportError
+	if !errors.As(err, &te) || te.code < errTLSBase || te.code > errTLSBase+0xff {
+		t.Errorf("Dial error = %v, want TLS alert", err)
+	}
+}
+
+func TestEndpointApplicationClose(t *testing.T) {
+	server, client, config := newTestEndpoints(t, nil)
+	cconn, sconn := dialAndAccept(t, server, client, config)
+	sconn.Abort(&ApplicationError{Code: 42, Reason: "bye"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := cconn.Wait(ctx)
+	var ae *ApplicationError
+	if !errors.As(err, &ae) || ae.Code != 42 || ae.Reason != "bye" {
+		t.Errorf("client Wait = %v, want application error 42 %q", err, "bye")
+	}
+}
+
+func TestStreamsEcho(t *testing.T) {
+	testStreamsEcho(t, 300000, nil)
+}
+
+// lossyPacketConn drops every nth datagram written.
+type lossyPacketConn struct {
+	net.PacketConn
+	n int
+
+	mu    sync.Mutex
+	count int
+}
+
+func (pc *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	pc.mu.Lock()
+	pc.count++
+	drop := pc.count%pc.n == 0
+	pc.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return pc.PacketConn.WriteTo(b, addr)
+}
+
+func TestStreamsEchoWithLoss(t *testing.T) {
+	testStreamsEcho(t, 30000, func(pc net.PacketConn) net.PacketConn {
+		return &lossyPacketConn{PacketConn: pc, n: 5}
+	})
+}
+
+func testStreamsEcho(t *testing.T, size int, wrap func(net.PacketConn) net.PacketConn) {
+	server, client, config := newTestEndpoints(t, wrap)
+	cconn, sconn := dialAndAccept(t, server, client, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// The server echoes every stream back to the client.
+	go func() {
+		for {
+			s, err := sconn.AcceptStream(ctx)
+			if err != nil {
+				return
+			}
+			go func() {
+				s.SetReadContext(ctx)
+				s.SetWriteContext(ctx)
+				io.Copy(s, s)
+				s.Close()
+			}()
+		}
+	}()
+
+	const numStreams = 5
+	want := make([]byte, size)
+	rand.Read(want)
+	var wg sync.WaitGroup
+	for i := 0; i < numStreams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := cconn.NewStream(ctx)
+			if err != nil {
+				t.Errorf("NewStream: %v", err)
+				return
+			}
+			s.SetReadContext(ctx)
+			s.SetWriteContext(ctx)
+			go func() {
+				if _, err := s.Write(want); err != nil {
+					t.Errorf("Write: %v", err)
+				}
+				s.CloseWrite()
+			}()
+			got, err := io.ReadAll(s)
+			if err != nil {
+				t.Errorf("ReadAll: %v", err)
+				return
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("echoed %v bytes, want the %v bytes sent", len(got), len(want))
+			}
+			if err := s.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestStreamReset(t *testing.T) {
+	server, client, config := newTestEndpoints(t, nil)
+	cconn, sconn := dialAndAccept(t, server, client, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cs, err := cconn.NewSendOnlyStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ss.IsReadOnly() {
+		t.Errorf("accepted unidirectional stream is not read-only")
+	}
+	cs.Reset(7)
+	ss.SetReadContext(ctx)
+	_, err = io.ReadAll(ss)
+	if err != StreamErrorCode(7) {
+		t.Errorf("Read after reset = %v, want StreamErrorCode(7)", err)
+	}
+}
+
+func TestStreamStopSending(t *testing.T) {
+	server, client, config := newTestEndpoints(t, nil)
+	cconn, sconn := dialAndAccept(t, server, client, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cs, err := cconn.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.SetWriteContext(ctx)
+	if _, err := cs.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.CloseRead()
+	buf := make([]byte, 1000)
+	for {
+		if _, err = cs.Write(buf); err != nil {
+			break
+		}
+	}
+	if err != StreamErrorCode(0) {
+		t.Errorf("Write after STOP_SENDING = %v, want StreamErrorCode(0)", err)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+	server, err := Listen("udp", "127.0.0.1:0", &Config{
+		TLSConfig:            serverTLS,
+		MaxBidiRemoteStreams: 2,
+	})
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	client, err := Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client.Close(ctx)
+		server.Close(ctx)
+	}()
+	cconn, sconn := dialAndAccept(t, server, client, &Config{TLSConfig: clientTLS})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		s, err := cconn.NewStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.CloseWrite()
+	}
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	if _, err := cconn.NewStream(shortCtx); err != context.DeadlineExceeded {
+		t.Fatalf("NewStream beyond limit = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Closing a stream on the server permits the client to open another.
+	ss, err := sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.SetReadContext(ctx)
+	if _, err := io.ReadAll(ss); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cconn.NewStream(ctx); err != nil {
+		t.Fatalf("NewStream after stream closed: %v", err)
+	}
+}
+
+func TestEndpointVersionNegotiation(t *testing.T) {
+	server, _, _ := newTestEndpoints(t, nil)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	dstConnID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	srcConnID := []byte{9, 10, 11, 12}
+	pkt := []byte{headerFormLong | fixedBit}
+	pkt = appendUint32(pkt, 0x0a0a0a0a)
+	pkt = appendUint8Bytes(pkt, dstConnID)
+	pkt = appendUint8Bytes(pkt, srcConnID)
+	pkt = append(pkt, make([]byte, minimumClientInitialDatagramSize-len(pkt))...)
+	if _, err := pc.WriteTo(pkt, server.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotDst, gotSrc, versions := parseVersionNegotiation(buf[:n])
+	if !bytes.Equal(gotDst, srcConnID) || !bytes.Equal(gotSrc, dstConnID) {
+		t.Errorf("Version Negotiation connection IDs = %x, %x; want %x, %x", gotDst, gotSrc, srcConnID, dstConnID)
+	}
+	if !bytes.Equal(versions, []byte{0, 0, 0, 1}) {
+		t.Errorf("Version Negotiation versions = %x, want 00000001", versions)
+	}
+}
+
+// rebindingPacketConn simulates a NAT rebinding the client's port:
+// once rebind is called, datagrams from the client appear to come from alias.
+// Datagrams the server sends to alias are delivered to the client,
+// or dropped if drop is set.
+type rebindingPacketConn struct {
+	net.PacketConn
+	alias net.Addr
+	drop  bool
+
+	mu        sync.Mutex
+	client    net.Addr
+	recvAlias int // bytes received from alias
+	sentAlias int // bytes sent to alias
+	amplified bool
+}
+
+func (pc *rebindingPacketConn) rebind(client net.Addr) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.client = client
+}
+
+func (pc *rebindingPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := pc.PacketConn.ReadFrom(b)
+	if err != nil {
+		return n, addr, err
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.client != nil && sameAddr(addr, pc.client) {
+		addr = pc.alias
+		pc.recvAlias += n
+	}
+	return n, addr, err
+}
+
+func (pc *rebindingPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	pc.mu.Lock()
+	if pc.client != nil && sameAddr(addr, pc.alias) {
+		pc.sentAlias += len(b)
+		if pc.sentAlias > 3*pc.recvAlias {
+			pc.amplified = true
+		}
+		addr = pc.client
+		if pc.drop {
+			pc.mu.Unlock()
+			return len(b), nil
+		}
+	}
+	pc.mu.Unlock()
+	return pc.PacketConn.WriteTo(b, addr)
+}
+
+// echo sends data from the client to the server on a new stream,
+// and checks that the server sends it back.
+func echo(ctx context.Context, t *testing.T, cconn, sconn *Conn, size int) {
+	t.Helper()
+	want := make([]byte, size)
+	rand.Read(want)
+	cs, err := cconn.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.SetReadContext(ctx)
+	cs.SetWriteContext(ctx)
+	if _, err := cs.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	cs.CloseWrite()
+	ss, err := sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.SetReadContext(ctx)
+	ss.SetWriteContext(ctx)
+	go func() {
+		io.Copy(ss, ss)
+		ss.Close()
+	}()
+	got, err := io.ReadAll(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echoed %v bytes, want the %v bytes sent", len(got), len(want))
+	}
+}
+
+func testPeerAddressChange(t *testing.T, drop bool) (sconn *Conn, pc *rebindingPacketConn) {
+	alias := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}
+	server, client, config := newTestEndpoints(t, func(p net.PacketConn) net.PacketConn {
+		pc = &rebindingPacketConn{PacketConn: p, alias: alias, drop: drop}
+		return pc
+	})
+	cconn, sconn := dialAndAccept(t, server, client, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pc.rebind(client.LocalAddr())
+	echo(ctx, t, cconn, sconn, 30000)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.recvAlias == 0 {
+		t.Fatalf("server received nothing from the new address")
+	}
+	return sconn, pc
+}
+
+func TestPeerAddressChange(t *testing.T) {
+	sconn, pc := testPeerAddressChange(t, false)
+	for start := time.Now(); !sameAddr(sconn.RemoteAddr(), pc.alias); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("server RemoteAddr = %v, want new address %v", sconn.RemoteAddr(), pc.alias)
+		}
+	}
+}
+
+func TestPeerAddressChangeValidationFailure(t *testing.T) {
+	sconn, pc := testPeerAddressChange(t, true)
+	// The server never hears a PATH_RESPONSE, so it keeps sending to the
+	// old address (which is why the echo worked) and eventually gives up.
+	if got := sconn.RemoteAddr(); sameAddr(got, pc.alias) {
+		t.Fatalf("server RemoteAddr = %v, want the old address", got)
+	}
+	pc.mu.Lock()
+	if pc.sentAlias == 0 {
+		t.Errorf("server sent no PATH_CHALLENGE to the new address")
+	}
+	if pc.amplified {
+		t.Errorf("server sent %v bytes to the unvalidated address, more than three times the %v received", pc.sentAlias, pc.recvAlias)
+	}
+	pc.mu.Unlock()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		sconn.mu.Lock()
+		validating := sconn.path.validating()
+		sconn.mu.Unlock()
+		if !validating {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("server did not abandon validation of the new address")
+		}
+	}
+	if got := sconn.RemoteAddr(); sameAddr(got, pc.alias) {
+		t.Fatalf("server RemoteAddr = %v, want the old address", got)
+	}
+}
+
+// earlyDataPacketConn counts the 0-RTT packets a server receives.
+// It delays the server's handshake packets, so that clients have time
+// to send 0-RTT data before learning whether it was accepted.
+type earlyDataPacketConn struct {
+	net.PacketConn
+
+	mu      sync.Mutex
+	packets int
+}
+
+func (pc *earlyDataPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := pc.PacketConn.ReadFrom(b)
+	if err != nil {
+		return n, addr, err
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for buf := b[:n]; len(buf) > 0 && isLongHeader(buf[0]); {
+		if getPacketType(buf) == packetType0RTT {
+			pc.packets++
+		}
+		size := skipLongHeaderPacket(buf)
+		if size < 0 {
+			break
+		}
+		buf = buf[size:]
+	}
+	return n, addr, err
+}
+
+func (pc *earlyDataPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > 0 && isLongHeader(b[0]) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return pc.PacketConn.WriteTo(b, addr)
+}
+
+func (pc *earlyDataPacketConn) count() int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.packets
+}
+
+// newEarlyDataServer returns a listening server endpoint which allows 0-RTT.
+func newEarlyDataServer(t *testing.T, config *Config) (*Endpoint, *earlyDataPacketConn) {
+	p, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	pc := &earlyDataPacketConn{PacketConn: p}
+	config.Allow0RTT = true
+	server := NewEndpoint(pc, config)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Close(ctx)
+	})
+	return server, pc
+}
+
+// testEarlyData connects to first and waits for a session ticket,
+// then resumes the session with second and echoes data written to a stream
+// as soon as Dial returns.
+func testEarlyData(t *testing.T, first, second *Endpoint) {
+	_, clientTLS := newTestTLSConfigs(t)
+	cache := &notifyingSessionCache{
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		putc:               make(chan struct{}, 1),
+	}
+	clientTLS.ClientSessionCache = cache
+	config := &Config{TLSConfig: clientTLS, Allow0RTT: true}
+	client, err := Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client.Close(ctx)
+	})
+
+	cconn, _ := dialAndAccept(t, first, client, config)
+	select {
+	case <-cache.putc:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server did not send a session ticket")
+	}
+	cconn.Close()
+
+	// The server only accepts the connection before the handshake completes
+	// if it accepts 0-RTT, so write to the stream before waiting for it.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	acceptc := make(chan *Conn, 1)
+	go func() {
+		c, err := second.Accept(ctx)
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+		}
+		acceptc <- c
+	}()
+	cconn, err = client.Dial(ctx, "udp", second.LocalAddr().String(), config)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	want := make([]byte, 5000)
+	rand.Read(want)
+	cs, err := cconn.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.SetReadContext(ctx)
+	cs.SetWriteContext(ctx)
+	if _, err := cs.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	cs.CloseWrite()
+	sconn := <-acceptc
+	if sconn == nil {
+		t.FailNow()
+	}
+	ss, err := sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.SetReadContext(ctx)
+	ss.SetWriteContext(ctx)
+	go func() {
+		io.Copy(ss, ss)
+		ss.Close()
+	}()
+	got, err := io.ReadAll(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echoed %v bytes, want the %v bytes sent", len(got), len(want))
+	}
+	if err := cconn.WaitHandshake(ctx); err != nil {
+		t.Fatalf("client WaitHandshake: %v", err)
+	}
+	if err := sconn.WaitHandshake(ctx); err != nil {
+		t.Fatalf("server WaitHandshake: %v", err)
+	}
+	if !cconn.ConnectionState().DidResume {
+		t.Errorf("second connection did not resume the session")
+	}
+}
+
+func TestEarlyData(t *testing.T) {
+	serverTLS, _ := newTestTLSConfigs(t)
+	server, pc := newEarlyDataServer(t, &Config{TLSConfig: serverTLS})
+	testEarlyData(t, server, server)
+	if pc.count() == 0 {
+		t.Errorf("server received no 0-RTT packets")
+	}
+}
+
+func TestEarlyDataRejected(t *testing.T) {
+	// Both servers accept the same session tickets, but the second
+	// has different transport parameters, so rejects 0-RTT.
+	serverTLS, _ := newTestTLSConfigs(t)
+	serverTLS.SessionTicketKey = [32]byte{1}
+	first, _ := newEarlyDataServer(t, &Config{TLSConfig: serverTLS})
+	second, pc := newEarlyDataServer(t, &Config{
+		TLSConfig:            serverTLS,
+		MaxBidiRemoteStreams: 200,
+	})
+	testEarlyData(t, first, second)
+	if pc.count() == 0 {
+		t.Errorf("client sent no 0-RTT packets to the second server")
+	}
+}
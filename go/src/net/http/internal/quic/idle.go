@@ -0,0 +1,140 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// idleState tracks connection idle events.
+//
+// The idle timeout is the minimum of Config.MaxIdleTimeout and the peer's
+// max_idle_timeout transport parameter. A connection which does not complete
+// its handshake within Config.HandshakeTimeout is abandoned.
+//
+// If KeepAlivePeriod is set, keep-alive pings are sent.
+//
+// https://www.rfc-editor.org/rfc/rfc9000#section-10.1
+type idleState struct {
+	// idleDuration is the negotiated idle timeout for the connection.
+	idleDuration time.Duration
+
+	// idleTimeout is the time at which the connection will be closed for lack of activity.
+	idleTimeout time.Time
+
+	// handshakeDeadline is the time at which an incomplete handshake is abandoned.
+	handshakeDeadline time.Time
+
+	// keepAlivePeriod is the period between keep-alive pings.
+	keepAlivePeriod time.Duration
+	configKeepAlive time.Duration
+
+	// nextKeepAlive is the time at which the next keep-alive ping should be sent.
+	nextKeepAlive time.Time
+
+	// sentSinceLastReceive is set if we have sent an ack-eliciting packet
+	// since the last time we received and processed a packet from the peer.
+	sentSinceLastReceive bool
+}
+
+func (s *idleState) init(now time.Time, config *Config) {
+	s.idleDuration = config.maxIdleTimeout()
+	if d := config.handshakeTimeout(); d > 0 {
+		s.handshakeDeadline = now.Add(d)
+	}
+	s.configKeepAlive = config.keepAlivePeriod()
+	s.setKeepAlivePeriod()
+	s.restartIdleTimer(now, 0)
+}
+
+// receivePeerMaxIdleTimeout handles the peer's max_idle_timeout transport parameter.
+func (s *idleState) receivePeerMaxIdleTimeout(peerMaxIdleTimeout time.Duration) {
+	if peerMaxIdleTimeout > 0 && (s.idleDuration <= 0 || peerMaxIdleTimeout < s.idleDuration) {
+		s.idleDuration = peerMaxIdleTimeout
+	}
+	s.setKeepAlivePeriod()
+}
+
+func (s *idleState) setKeepAlivePeriod() {
+	s.keepAlivePeriod = s.configKeepAlive
+	if s.keepAlivePeriod > 0 && s.idleDuration > 0 && s.keepAlivePeriod > s.idleDuration/2 {
+		s.keepAlivePeriod = s.idleDuration / 2
+	}
+}
+
+func (s *idleState) restartIdleTimer(now time.Time, pto time.Duration) {
+	if s.idleDuration <= 0 {
+		s.idleTimeout = time.Time{}
+	} else {
+		// "[...] to avoid excessively small idle timeout periods, endpoints
+		// MUST increase the idle timeout period to be at least three times
+		// the current Probe Timeout (PTO)."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-10.1-4
+		d := s.idleDuration
+		if d < 3*pto {
+			d = 3 * pto
+		}
+		s.idleTimeout = now.Add(d)
+	}
+	if s.keepAlivePeriod > 0 {
+		s.nextKeepAlive = now.Add(s.keepAlivePeriod)
+	}
+}
+
+// receivePacket records that a packet was received and processed.
+func (s *idleState) receivePacket(now time.Time, pto time.Duration) {
+	// "An endpoint restarts its idle timer when a packet from its peer is
+	// received and processed successfully."
+	// https://www.rfc-editor.org/rfc/rfc9000#section-10.1-3
+	s.sentSinceLastReceive = false
+	s.restartIdleTimer(now, pto)
+}
+
+// sentAckEliciting records that an ack-eliciting packet was sent.
+func (s *idleState) sentAckEliciting(now time.Time, pto time.Duration) {
+	// "An endpoint also restarts its idle timer when sending an ack-eliciting
+	// packet if no other ack-eliciting packets have been sent since last
+	// receiving and processing a packet."
+	// https://www.rfc-editor.org/rfc/rfc9000#section-10.1-3
+	if s.sentSinceLastReceive {
+		return
+	}
+	s.sentSinceLastReceive = true
+	s.restartIdleTimer(now, pto)
+}
+
+// advance reports whether the idle timeout has expired.
+func (s *idleState) advance(now time.Time) bool {
+	return !s.idleTimeout.IsZero() && !now.Before(s.idleTimeout)
+}
+
+// handshakeTimedOut reports whether the handshake deadline has passed.
+func (s *idleState) handshakeTimedOut(now time.Time) bool {
+	return !s.handshakeDeadline.IsZero() && !now.Before(s.handshakeDeadline)
+}
+
+// shouldSendKeepAlive reports whether a keep-alive ping should be sent.
+func (s *idleState) shouldSendKeepAlive(now time.Time) bool {
+	if s.nextKeepAlive.IsZero() || now.Before(s.nextKeepAlive) {
+		return false
+	}
+	s.nextKeepAlive = now.Add(s.keepAlivePeriod)
+	return true
+}
+
+// nextTimeout returns the time of the next idle event.
+func (s *idleState) nextTimeout(handshakeDone bool) time.Time {
+	next := s.idleTimeout
+	add := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	add(s.nextKeepAlive)
+	if !handshakeDone {
+		add(s.handshakeDeadline)
+	}
+	return next
+}
@@ -0,0 +1,467 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// lossState tracks sent packets and detects their loss,
+// as described in RFC 9002.
+type lossState struct {
+	side connSide
+
+	// True when the handshake is confirmed.
+	// https://www.rfc-editor.org/rfc/rfc9001#section-4.1.2
+	handshakeConfirmed bool
+
+	// Peer's max_ack_delay transport parameter.
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-18.2-4.28.1
+	maxAckDelay time.Duration
+
+	// Time of the next event: PTO expiration (if ptoTimerArmed is true),
+	// or loss detection.
+	// The connection must call lossState.advance when the timer expires.
+	timer time.Time
+
+	// True when the PTO timer is set.
+	ptoTimerArmed bool
+
+	// True when the PTO timer has expired and a probe packet has not yet been sent.
+	ptoExpired bool
+
+	// Count of PTO expirations since the last received acknowledgement.
+	// https://www.rfc-editor.org/rfc/rfc9002#section-6.2.1-9
+	ptoBackoffCount int
+
+	// Anti-amplification limit: Three times the amount of data received from
+	// the peer, less the amount of data sent.
+	//
+	// Set to antiAmplificationUnlimited (MaxInt) to disable the limit.
+	// The limit is always disabled for clients, and for servers after the
+	// peer's address is validated.
+	//
+	// Anti-amplification is per-address. This is the limit for the peer
+	// address we are sending to; pathState tracks the limit for a new
+	// address while it is validated.
+	//
+	// https://www.rfc-editor.org/rfc/rfc9000#section-8-2
+	antiAmplificationLimit int
+
+	rtt rttState
+	cc  *ccReno
+
+	// Per-space loss detection state.
+	spaces [numberSpaceCount]struct {
+		sent                 []*sentPacket // unacknowledged, ordered by packet number
+		nextNum              packetNumber
+		maxAcked             packetNumber
+		lossTime             time.Time
+		lastAckElicitingTime time.Time
+		// Set while processing an ACK frame: whether the largest
+		// acknowledged packet was newly acknowledged and ack-eliciting.
+		newlyAckedLargest *sentPacket
+		ackEliciting      bool // any newly acked packet is ack-eliciting
+	}
+}
+
+const antiAmplificationUnlimited = int(^uint(0) >> 1)
+
+func (c *lossState) init(side connSide, maxDatagramSize int, now time.Time) {
+	c.side = side
+	if side == clientSide {
+		// Clients don't have an anti-amplification limit.
+		c.antiAmplificationLimit = antiAmplificationUnlimited
+	}
+	c.rtt.init()
+	c.cc = newReno(maxDatagramSize)
+	c.maxAckDelay = defaultMaxAckDelay
+	for space := range c.spaces {
+		c.spaces[space].maxAcked = -1
+	}
+}
+
+// setMaxAckDelay sets the max_ack_delay transport parameter received from the peer.
+func (c *lossState) setMaxAckDelay(d time.Duration) {
+	c.maxAckDelay = d
+}
+
+// confirmHandshake indicates the handshake has been confirmed.
+func (c *lossState) confirmHandshake() {
+	c.handshakeConfirmed = true
+}
+
+// resetPath resets the congestion controller and RTT estimator to their
+// initial values when the peer moves to a new path.
+func (c *lossState) resetPath() {
+	// Packets sent on the old path remain in flight
+	// until they are acknowledged or declared lost.
+	bytesInFlight := c.cc.bytesInFlight
+	c.cc = newReno(c.cc.maxDatagramSize)
+	c.cc.bytesInFlight = bytesInFlight
+	c.rtt = rttState{}
+	c.rtt.init()
+}
+
+// validateClientAddress disables the anti-amplification limit after
+// a server validates a client's address.
+func (c *lossState) validateClientAddress() {
+	c.antiAmplificationLimit = antiAmplificationUnlimited
+}
+
+// minPacketSize is the minimum datagram size permitted by
+// anti-amplification protection.
+//
+// Defining a minimum size avoids the case where, say, anti-amplification
+// technically allows us to send a 1-byte datagram, but no such datagram
+// can be constructed.
+const minPacketSize = 128
+
+type ccLimit int
+
+const (
+	ccOK      = ccLimit(iota) // OK to send
+	ccBlocked                 // sending blocked by anti-amplification
+	ccLimited                 // sending blocked by congestion control
+)
+
+// sendLimit reports whether sending is possible at this time.
+// When sending is limited, it returns the limit and the size of the
+// largest datagram that may be sent.
+func (c *lossState) sendLimit() (limit ccLimit, maxDatagramSize int) {
+	maxDatagramSize = c.cc.maxDatagramSize
+	if c.antiAmplificationLimit != antiAmplificationUnlimited {
+		if c.antiAmplificationLimit < minPacketSize {
+			// When at the anti-amplification limit, we may not send anything.
+			return ccBlocked, 0
+		}
+		if c.antiAmplificationLimit < maxDatagramSize {
+			maxDatagramSize = c.antiAmplificationLimit
+		}
+	}
+	if c.ptoExpired {
+		// On PTO expiry, send a probe.
+		return ccOK, maxDatagramSize
+	}
+	if !c.cc.canSend() {
+		// ACK-only packets may still be sent.
+		return ccLimited, maxDatagramSize
+	}
+	return ccOK, maxDatagramSize
+}
+
+// nextNumber returns the next packet number to use in a space.
+func (c *lossState) nextNumber(space numberSpace) packetNumber {
+	return c.spaces[space].nextNum
+}
+
+// largestAcked returns the largest packet number acknowledged by the peer in a space,
+// or -1 if no packets have been acknowledged.
+func (c *lossState) largestAcked(space numberSpace) packetNumber {
+	return c.spaces[space].maxAcked
+}
+
+// packetSent records a sent packet.
+func (c *lossState) packetSent(now time.Time, sent *sentPacket) {
+	sent.time = now
+	s := &c.spaces[sent.space]
+	s.nextNum++
+	if sent.ackEliciting {
+		s.lastAckElicitingTime = now
+		c.ptoExpired = false
+	}
+	if sent.inFlight {
+		s.sent = append(s.sent, sent)
+		c.cc.packetSent(sent)
+	}
+	c.scheduleTimer(now)
+}
+
+// datagramReceived records a datagram (not packet!) received from the peer.
+func (c *lossState) datagramReceived(now time.Time, size int) {
+	if c.antiAmplificationLimit != antiAmplificationUnlimited {
+		c.antiAmplificationLimit += 3 * size
+		// Reset the PTO timer, possibly to a point in the past, in which
+		// case we'll send a PTO probe in the next send.
+		c.scheduleTimer(now)
+	}
+}
+
+// datagramSent records a datagram (not packet!) sent to the peer.
+func (c *lossState) datagramSent(size int) {
+	if c.antiAmplificationLimit != antiAmplificationUnlimited {
+		c.antiAmplificationLimit -= size
+	}
+}
+
+// receiveAckStart starts processing an ACK frame.
+// Call receiveAckRange for each range in the frame.
+// Call receiveAckEnd after all ranges are processed.
+func (c *lossState) receiveAckStart() {
+	for space := range c.spaces {
+		c.spaces[space].newlyAckedLargest = nil
+		c.spaces[space].ackEliciting = false
+	}
+}
+
+// receiveAckRange processes a range within an ACK frame.
+// The ackf function is called for each newly-acknowledged packet.
+func (c *lossState) receiveAckRange(now time.Time, space numberSpace, rangeIndex int, start, end packetNumber, ackf func(numberSpace, *sentPacket, packetFate)) {
+	s := &c.spaces[space]
+	kept := s.sent[:0]
+	for _, sent := range s.sent {
+		if sent.num < start || sent.num >= end {
+			kept = append(kept, sent)
+			continue
+		}
+		if rangeIndex == 0 && sent.num == end-1 {
+			s.newlyAckedLargest = sent
+		}
+		if sent.ackEliciting {
+			s.ackEliciting = true
+		}
+		c.cc.packetAcked(sent)
+		ackf(space, sent, packetAcked)
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+	if rangeIndex == 0 && end-1 > s.maxAcked {
+		s.maxAcked = end - 1
+	}
+}
+
+// receiveAckEnd finishes processing an ack frame.
+// The lossf function is called for each packet newly detected as lost.
+func (c *lossState) receiveAckEnd(now time.Time, space numberSpace, ackDelay time.Duration, lossf func(numberSpace, *sentPacket, packetFate)) {
+	s := &c.spaces[space]
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.1-2.1.1
+	if largest := s.newlyAckedLargest; largest != nil && s.ackEliciting {
+		latestRTT := now.Sub(largest.time)
+		c.rtt.updateSample(now, c.handshakeConfirmed, space, latestRTT, ackDelay, c.maxAckDelay)
+	}
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.1-9
+	if s.newlyAckedLargest != nil || s.ackEliciting {
+		c.ptoBackoffCount = 0
+	}
+	c.detectLoss(now, lossf)
+	c.scheduleTimer(now)
+}
+
+// discardKeys is called when dropping packet protection keys for a number space.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.4
+func (c *lossState) discardKeys(now time.Time, space numberSpace) {
+	s := &c.spaces[space]
+	for _, sent := range s.sent {
+		c.cc.packetDiscarded(sent)
+	}
+	s.sent = nil
+	s.lossTime = time.Time{}
+	s.lastAckElicitingTime = time.Time{}
+	c.ptoBackoffCount = 0
+	c.scheduleTimer(now)
+}
+
+// discard0RTT is called when the server rejects a client's 0-RTT packets.
+// A client has no 1-RTT keys when it learns of the rejection, so every
+// packet sent in the application data space is a 0-RTT packet.
+// The packets are removed from flight without signaling congestion,
+// and reported lost so their contents will be sent again.
+func (c *lossState) discard0RTT(now time.Time, lossf func(numberSpace, *sentPacket, packetFate)) {
+	s := &c.spaces[appDataSpace]
+	sent := s.sent
+	s.sent = nil
+	s.lossTime = time.Time{}
+	s.lastAckElicitingTime = time.Time{}
+	for _, p := range sent {
+		c.cc.packetDiscarded(p)
+		lossf(appDataSpace, p, packetLost)
+	}
+	c.scheduleTimer(now)
+}
+
+// lossDuration returns the time threshold for declaring a packet lost.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.1.2
+func (c *lossState) lossDuration() time.Duration {
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.1.2-2
+	d := c.rtt.smoothedRTT
+	if c.rtt.latestRTT > d {
+		d = c.rtt.latestRTT
+	}
+	d = d * 9 / 8
+	if d < timerGranularity {
+		d = timerGranularity
+	}
+	return d
+}
+
+// detectLoss detects lost packets in all spaces.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.1
+func (c *lossState) detectLoss(now time.Time, lossf func(numberSpace, *sentPacket, packetFate)) {
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.1.1-1
+	const lossThreshold = 3
+
+	lossTime := now.Add(-c.lossDuration())
+	for space := numberSpace(0); space < numberSpaceCount; space++ {
+		s := &c.spaces[space]
+		s.lossTime = time.Time{}
+		if s.maxAcked < 0 {
+			continue
+		}
+		kept := s.sent[:0]
+		var lost []*sentPacket
+		for _, sent := range s.sent {
+			if sent.num > s.maxAcked {
+				kept = append(kept, sent)
+				continue
+			}
+			if s.maxAcked-sent.num >= lossThreshold || !sent.time.After(lossTime) {
+				lost = append(lost, sent)
+				continue
+			}
+			// Not yet lost; set the time at which it would be.
+			t := sent.time.Add(c.lossDuration())
+			if s.lossTime.IsZero() || t.Before(s.lossTime) {
+				s.lossTime = t
+			}
+			kept = append(kept, sent)
+		}
+		for i := len(kept); i < len(s.sent); i++ {
+			s.sent[i] = nil
+		}
+		s.sent = kept
+		for _, sent := range lost {
+			c.cc.packetLost(now, sent)
+			lossf(space, sent, packetLost)
+		}
+	}
+}
+
+// advance is called when time passes.
+// The lossf function is called for each packet newly detected as lost.
+func (c *lossState) advance(now time.Time, lossf func(numberSpace, *sentPacket, packetFate)) {
+	if c.timer.IsZero() || now.Before(c.timer) {
+		return
+	}
+	if !c.ptoTimerArmed {
+		c.detectLoss(now, lossf)
+	} else {
+		c.ptoExpired = true
+		c.ptoBackoffCount++
+	}
+	c.scheduleTimer(now)
+}
+
+// ptoBasePeriod returns the PTO for a space, without backoff.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.1
+func (c *lossState) ptoBasePeriod(space numberSpace) time.Duration {
+	pto := c.rtt.smoothedRTT + max64d(4*c.rtt.rttvar, timerGranularity)
+	if space == appDataSpace {
+		// "When the PTO is armed for Initial or Handshake packet number spaces,
+		// the max_ack_delay in the PTO period computation is set to 0 [...]"
+		// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.1-4
+		pto += c.maxAckDelay
+	}
+	return pto
+}
+
+// ptoPeriod returns the current PTO period for the application data space,
+// including backoff.
+func (c *lossState) ptoPeriod() time.Duration {
+	return c.ptoBasePeriod(appDataSpace) << c.ptoBackoffCount
+}
+
+// ptoSpace returns the number space in which a PTO probe should be sent.
+func (c *lossState) ptoSpace() numberSpace {
+	space := appDataSpace
+	if !c.handshakeConfirmed {
+		space = handshakeSpace
+	}
+	var earliest time.Time
+	for s := numberSpace(0); s < numberSpaceCount; s++ {
+		t := c.spaces[s].lastAckElicitingTime
+		if t.IsZero() || (s == appDataSpace && !c.handshakeConfirmed) {
+			continue
+		}
+		t = t.Add(c.ptoBasePeriod(s))
+		if earliest.IsZero() || t.Before(earliest) {
+			space, earliest = s, t
+		}
+	}
+	return space
+}
+
+// scheduleTimer sets the loss or PTO timer.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.1
+func (c *lossState) scheduleTimer(now time.Time) {
+	c.ptoTimerArmed = false
+
+	// Loss timer for sent packets.
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.1.2-5
+	var lossTime time.Time
+	for space := range c.spaces {
+		t := c.spaces[space].lossTime
+		if !t.IsZero() && (lossTime.IsZero() || t.Before(lossTime)) {
+			lossTime = t
+		}
+	}
+	if !lossTime.IsZero() {
+		c.timer = lossTime
+		return
+	}
+
+	// "[...] when the server reaches the anti-amplification limit, [...]
+	// the server MUST cancel the PTO timer."
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.2.1-1
+	if c.antiAmplificationLimit != antiAmplificationUnlimited && c.antiAmplificationLimit < minPacketSize {
+		c.timer = time.Time{}
+		return
+	}
+
+	var last time.Time
+	var pto time.Duration
+	inFlight := false
+	for space := numberSpace(0); space < numberSpaceCount; space++ {
+		s := &c.spaces[space]
+		if len(s.sent) == 0 || s.lastAckElicitingTime.IsZero() {
+			continue
+		}
+		if space == appDataSpace && !c.handshakeConfirmed {
+			// Don't arm the PTO timer for application data until
+			// the handshake is confirmed.
+			// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.1-7
+			continue
+		}
+		inFlight = true
+		t := s.lastAckElicitingTime
+		p := c.ptoBasePeriod(space)
+		if last.IsZero() || t.Add(p).Before(last.Add(pto)) {
+			last, pto = t, p
+		}
+	}
+	if !inFlight {
+		if c.side == serverSide || c.handshakeConfirmed {
+			// Nothing in flight, no PTO.
+			c.timer = time.Time{}
+			return
+		}
+		// "[...] the client MUST set the PTO timer if the client has not
+		// received an acknowledgment for any of its Handshake packets and
+		// the handshake is not confirmed [...]"
+		// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.2.1-3
+		last = now
+		pto = c.ptoBasePeriod(handshakeSpace)
+	}
+	c.timer = last.Add(pto << c.ptoBackoffCount)
+	c.ptoTimerArmed = true
+}
+
+func max64d(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,361 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// Frame parsing functions.
+//
+// Each consumeXFrame function parses a frame of type X at the start of b,
+// including the frame type. It returns the frame contents and the number
+// of bytes consumed, or a negative length if the frame is malformed.
+//
+// Byte slices returned by these functions refer to the input buffer.
+
+// consumeAckFrame parses an ACK or ACK_ECN frame.
+// It calls f for each acknowledged range, in descending order.
+// ECN counts are ignored.
+func consumeAckFrame(frame []byte, f func(rangeIndex int, start, end packetNumber)) (largest packetNumber, ackDelay uint64, n int) {
+	b := frame[1:] // type
+
+	largestAck, n := consumeVarint(b)
+	if n < 0 {
+		return 0, 0, -1
+	}
+	b = b[n:]
+
+	ackDelay, n = consumeVarint(b)
+	if n < 0 {
+		return 0, 0, -1
+	}
+	b = b[n:]
+
+	ackRangeCount, n := consumeVarint(b)
+	if n < 0 {
+		return 0, 0, -1
+	}
+	b = b[n:]
+
+	rangeMax := packetNumber(largestAck)
+	for i := uint64(0); ; i++ {
+		rangeLen, n := consumeVarint(b)
+		if n < 0 {
+			return 0, 0, -1
+		}
+		b = b[n:]
+		if uint64(rangeMax) < rangeLen {
+			return 0, 0, -1
+		}
+		rangeMin := rangeMax - packetNumber(rangeLen)
+		f(int(i), rangeMin, rangeMax+1)
+
+		if i == ackRangeCount {
+			break
+		}
+
+		gap, n := consumeVarint(b)
+		if n < 0 {
+			return 0, 0, -1
+		}
+		b = b[n:]
+
+		if uint64(rangeMin) < gap+2 {
+			return 0, 0, -1
+		}
+		rangeMax = rangeMin - packetNumber(gap) - 2
+	}
+
+	if frame[0] != frameTypeAckECN {
+		return packetNumber(largestAck), ackDelay, len(frame) - len(b)
+	}
+
+	// ECT0 Count, ECT1 Count, ECN-CE Count.
+	for i := 0; i < 3; i++ {
+		_, n := consumeVarint(b)
+		if n < 0 {
+			return 0, 0, -1
+		}
+		b = b[n:]
+	}
+	return packetNumber(largestAck), ackDelay, len(frame) - len(b)
+}
+
+func consumeResetStreamFrame(b []byte) (id streamID, code uint64, finalSize int64, n int) {
+	n = 1
+	idInt, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, 0, -1
+	}
+	n += nn
+	code, nn = consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, 0, -1
+	}
+	n += nn
+	v, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, 0, -1
+	}
+	n += nn
+	return streamID(idInt), code, int64(v), n
+}
+
+func consumeStopSendingFrame(b []byte) (id streamID, code uint64, n int) {
+	n = 1
+	idInt, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	code, nn = consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	return streamID(idInt), code, n
+}
+
+func consumeCryptoFrame(b []byte) (off int64, data []byte, n int) {
+	n = 1
+	v, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, nil, -1
+	}
+	off = int64(v)
+	n += nn
+	data, nn = consumeVarintBytes(b[n:])
+	if nn < 0 {
+		return 0, nil, -1
+	}
+	n += nn
+	return off, data, n
+}
+
+func consumeNewTokenFrame(b []byte) (token []byte, n int) {
+	n = 1
+	data, nn := consumeVarintBytes(b[n:])
+	if nn < 0 {
+		return nil, -1
+	}
+	if len(data) == 0 {
+		return nil, -1
+	}
+	n += nn
+	return data, n
+}
+
+func consumeStreamFrame(b []byte) (id streamID, off int64, fin bool, data []byte, n int) {
+	fin = (b[0] & streamFinBit) != 0
+	n = 1
+	idInt, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, false, nil, -1
+	}
+	n += nn
+	if b[0]&streamOffBit != 0 {
+		v, nn := consumeVarint(b[n:])
+		if nn < 0 {
+			return 0, 0, false, nil, -1
+		}
+		n += nn
+		off = int64(v)
+	}
+	if b[0]&streamLenBit != 0 {
+		data, nn = consumeVarintBytes(b[n:])
+		if nn < 0 {
+			return 0, 0, false, nil, -1
+		}
+		n += nn
+	} else {
+		data = b[n:]
+		n += len(data)
+	}
+	if off+int64(len(data)) > maxVarint {
+		return 0, 0, false, nil, -1
+	}
+	return streamID(idInt), off, fin, data, n
+}
+
+func consumeMaxDataFrame(b []byte) (max int64, n int) {
+	n = 1
+	v, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, -1
+	}
+	n += nn
+	return int64(v), n
+}
+
+func consumeMaxStreamDataFrame(b []byte) (id streamID, max int64, n int) {
+	n = 1
+	v, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	id = streamID(v)
+	v, nn = consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	max = int64(v)
+	return id, max, n
+}
+
+func consumeMaxStreamsFrame(b []byte) (typ streamType, max int64, n int) {
+	switch b[0] {
+	case frameTypeMaxStreamsBidi:
+		typ = bidiStream
+	case frameTypeMaxStreamsUni:
+		typ = uniStream
+	default:
+		return 0, 0, -1
+	}
+	n = 1
+	v, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	if v > maxStreamsLimit {
+		return 0, 0, -1
+	}
+	return typ, int64(v), n
+}
+
+func consumeStreamDataBlockedFrame(b []byte) (id streamID, max int64, n int) {
+	n = 1
+	v, nn := consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	id = streamID(v)
+	max, nn = consumeVarintInt64(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	return id, max, n
+}
+
+func consumeDataBlockedFrame(b []byte) (max int64, n int) {
+	n = 1
+	max, nn := consumeVarintInt64(b[n:])
+	if nn < 0 {
+		return 0, -1
+	}
+	n += nn
+	return max, n
+}
+
+func consumeStreamsBlockedFrame(b []byte) (typ streamType, max int64, n int) {
+	if b[0] == frameTypeStreamsBlockedBidi {
+		typ = bidiStream
+	} else {
+		typ = uniStream
+	}
+	n = 1
+	max, nn := consumeVarintInt64(b[n:])
+	if nn < 0 {
+		return 0, 0, -1
+	}
+	n += nn
+	return typ, max, n
+}
+
+func consumeNewConnectionIDFrame(b []byte) (seq, retire int64, connID []byte, resetToken [16]byte, n int) {
+	n = 1
+	var nn int
+	seq, nn = consumeVarintInt64(b[n:])
+	if nn < 0 {
+		return 0, 0, nil, [16]byte{}, -1
+	}
+	n += nn
+	retire, nn = consumeVarintInt64(b[n:])
+	if nn < 0 {
+		return 0, 0, nil, [16]byte{}, -1
+	}
+	n += nn
+	if seq < retire {
+		return 0, 0, nil, [16]byte{}, -1
+	}
+	connID, nn = consumeUint8Bytes(b[n:])
+	if nn < 0 {
+		return 0, 0, nil, [16]byte{}, -1
+	}
+	if len(connID) < 1 || len(connID) > maxConnIDLen {
+		return 0, 0, nil, [16]byte{}, -1
+	}
+	n += nn
+	if len(b[n:]) < len(resetToken) {
+		return 0, 0, nil, [16]byte{}, -1
+	}
+	copy(resetToken[:], b[n:])
+	n += len(resetToken)
+	return seq, retire, connID, resetToken, n
+}
+
+func consumeRetireConnectionIDFrame(b []byte) (seq int64, n int) {
+	n = 1
+	var nn int
+	seq, nn = consumeVarintInt64(b[n:])
+	if nn < 0 {
+		return 0, -1
+	}
+	n += nn
+	return seq, n
+}
+
+// consumePathChallengeFrame parses a PATH_CHALLENGE or PATH_RESPONSE frame.
+func consumePathChallengeFrame(b []byte) (data pathChallengeData, n int) {
+	n = 1
+	nn := copy(data[:], b[n:])
+	if nn != len(data) {
+		return data, -1
+	}
+	n += nn
+	return data, n
+}
+
+func consumeConnectionCloseTransportFrame(b []byte) (code transportError, frameType uint64, reason string, n int) {
+	n = 1
+	var nn int
+	var codeInt uint64
+	codeInt, nn = consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, "", -1
+	}
+	code = transportError(codeInt)
+	n += nn
+	frameType, nn = consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, 0, "", -1
+	}
+	n += nn
+	reasonb, nn := consumeVarintBytes(b[n:])
+	if nn < 0 {
+		return 0, 0, "", -1
+	}
+	n += nn
+	reason = string(reasonb)
+	return code, frameType, reason, n
+}
+
+func consumeConnectionCloseApplicationFrame(b []byte) (code uint64, reason string, n int) {
+	n = 1
+	var nn int
+	code, nn = consumeVarint(b[n:])
+	if nn < 0 {
+		return 0, "", -1
+	}
+	n += nn
+	reasonb, nn := consumeVarintBytes(b[n:])
+	if nn < 0 {
+		return 0, "", -1
+	}
+	n += nn
+	reason = string(reasonb)
+	return code, reason, n
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestInitialKeys(t *testing.T) {
+	// Test vectors from RFC 9001, Appendix A.1.
+	cid := unhex("8394c8f03e515708")
+	for _, test := range []struct {
+		side    connSide
+		key, iv []byte
+	}{{
+		side: clientSide,
+		key:  unhex("1f369613dd76d5467730efcbe3b1a22d"),
+		iv:   unhex("fa044b2f42a3fd3b46fb255c"),
+	}, {
+		side: serverSide,
+		key:  unhex("cf3a5331653c364c88f0f379b6067e37"),
+		iv:   unhex("0ac1493ca1905853b0bba03e"),
+	}} {
+		k := initialKeys(cid, test.side)
+		if !bytes.Equal(k.w.pkt.iv, test.iv) {
+			t.Errorf("%v: initial IV = %x, want %x", test.side, k.w.pkt.iv, test.iv)
+		}
+		// The key is not exposed, so compare the output of the AEADs.
+		want := newAESAEAD(test.key).Seal(nil, test.iv, []byte("payload"), nil)
+		got := k.w.pkt.aead.Seal(nil, k.w.pkt.iv, []byte("payload"), nil)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v: initial key does not match RFC 9001 test vector", test.side)
+		}
+	}
+}
+
+func TestPacketProtectionChaCha20(t *testing.T) {
+	// Test vector from RFC 9001, Appendix A.5.
+	secret := unhex("9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b")
+	hdr := unhex("4200bff4")
+	pay := unhex("01")
+	const pnum = packetNumber(654360564)
+	want := unhex("4cfe4189655e5cd55c41f69080575d7999c25a5bfb")
+
+	var k fixedKeys
+	k.init(tls.TLS_CHACHA20_POLY1305_SHA256, secret)
+	got := k.protect(hdr, pay, 1, pnum)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("protect:\ngot  %x\nwant %x", got, want)
+	}
+
+	gotPay, gotNum, err := k.unprotect(got, 1, pnum-1)
+	if err != nil {
+		t.Fatalf("unprotect: %v", err)
+	}
+	if !bytes.Equal(gotPay, pay) || gotNum != pnum {
+		t.Errorf("unprotect = %x, %v; want %x, %v", gotPay, gotNum, pay, pnum)
+	}
+}
+
+func TestPacketProtectionCorrupted(t *testing.T) {
+	var k fixedKeys
+	k.init(tls.TLS_AES_128_GCM_SHA256, make([]byte, 32))
+	pkt := k.protect(unhex("4000"), make([]byte, 20), 1, 0)
+	pkt[len(pkt)-1] ^= 1
+	if _, _, err := k.unprotect(pkt, 1, -1); err == nil {
+		t.Errorf("unprotect of corrupted packet succeeded, want error")
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// A packetWriter constructs QUIC datagrams.
+//
+// A datagram consists of one or more packets.
+// A packet consists of a header followed by one or more frames.
+//
+// Packets are written in three steps:
+//   - startProtectedLongHeaderPacket or start1RTTPacket prepare the packet;
+//   - append*Frame appends frames to the payload; and
+//   - finishProtectedLongHeaderPacket or finish1RTTPacket finalize the packet.
+//
+// Packet protection is applied to all packets in the datagram by finishDatagram,
+// so that the final packet may be padded after the fact.
+type packetWriter struct {
+	dgramLim int // max datagram size
+	pktOff   int // offset of the start of the current packet
+	pnumOff  int // offset of the packet number in the current packet
+	payOff   int // offset of the payload of the current packet
+	b        []byte
+	sent     *sentPacket
+	pending  []pendingPacket
+}
+
+// A pendingPacket is a packet in a datagram awaiting protection.
+type pendingPacket struct {
+	pktOff  int // offset of the start of the packet
+	pnumOff int // offset of the packet number
+	payOff  int // offset of the payload
+	end     int // offset of the end of the payload; the AEAD tag follows
+	pnum    packetNumber
+	long    bool
+	k       fixedKeys        // long header packets
+	uk      *updatingKeyPair // 1-RTT packets
+	sent    *sentPacket
+}
+
+// minPacketPayload is the space reserved in each packet for padding
+// required to provide a large enough sample for header protection.
+// https://www.rfc-editor.org/rfc/rfc9001#section-5.4.2
+const minPacketPayload = 4
+
+// reset prepares to write a datagram of at most lim bytes.
+func (w *packetWriter) reset(lim int) {
+	if cap(w.b) < lim {
+		w.b = make([]byte, 0, lim)
+	}
+	w.dgramLim = lim
+	w.b = w.b[:0]
+	w.pending = w.pending[:0]
+}
+
+// datagram returns the current datagram.
+func (w *packetWriter) datagram() []byte {
+	return w.b
+}
+
+// packetLen returns the size of the current packet.
+func (w *packetWriter) packetLen() int {
+	return len(w.b[w.pktOff:]) + aeadOverhead
+}
+
+// payload returns the payload of the current packet.
+func (w *packetWriter) payload() []byte {
+	return w.b[w.payOff:]
+}
+
+// avail reports how many more bytes may be written to the current packet.
+func (w *packetWriter) avail() int {
+	n := w.dgramLim - len(w.b) - aeadOverhead - minPacketPayload
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// startProtectedLongHeaderPacket starts writing an Initial or Handshake packet.
+func (w *packetWriter) startProtectedLongHeaderPacket(pnumMaxAcked packetNumber, p longPacket) {
+	w.pktOff = len(w.b)
+	pnumLen := packetNumberLength(p.num, pnumMaxAcked)
+	hdrSize := 1 + 4 + 1 + len(p.dstConnID) + 1 + len(p.srcConnID) + 2 + pnumLen
+	if p.ptype == packetTypeInitial {
+		hdrSize += sizeVarint(uint64(len(p.extra))) + len(p.extra)
+	}
+	if w.pktOff+hdrSize+aeadOverhead+minPacketPayload > w.dgramLim {
+		// No room for the packet; make sure no frames are written to it.
+		w.dgramLim = 0
+	}
+	var typeBits byte
+	switch p.ptype {
+	case packetTypeInitial:
+		typeBits = longPacketTypeInitial
+	case packetType0RTT:
+		typeBits = longPacketType0RTT
+	case packetTypeHandshake:
+		typeBits = longPacketTypeHandshake
+	}
+	w.b = append(w.b, headerFormLong|fixedBit|typeBits|byte(pnumLen-1))
+	w.b = appendUint32(w.b, p.version)
+	w.b = appendUint8Bytes(w.b, p.dstConnID)
+	w.b = appendUint8Bytes(w.b, p.srcConnID)
+	if p.ptype == packetTypeInitial {
+		w.b = appendVarintBytes(w.b, p.extra) // token
+	}
+	w.b = append(w.b, 0, 0) // Length; filled in when the packet is protected
+	w.pnumOff = len(w.b)
+	w.b = appendPacketNumber(w.b, p.num, pnumMaxAcked)
+	w.payOff = len(w.b)
+	w.sent = &sentPacket{num: p.num}
+}
+
+// finishProtectedLongHeaderPacket finishes writing an Initial or Handshake packet.
+// It returns a sentPacket describing the packet,
+// or nil if no packet was written.
+func (w *packetWriter) finishProtectedLongHeaderPacket(k fixedKeys, p longPacket) *sentPacket {
+	if len(w.payload()) == 0 {
+		w.abandonPacket()
+		return nil
+	}
+	w.padMinPayload()
+	w.pending = append(w.pending, pendingPacket{
+		pktOff:  w.pktOff,
+		pnumOff: w.pnumOff,
+		payOff:  w.payOff,
+		end:     len(w.b),
+		pnum:    p.num,
+		long:    true,
+		k:       k,
+		sent:    w.sent,
+	})
+	return w.finishPacket()
+}
+
+// start1RTTPacket starts writing a 1-RTT (short header) packet.
+func (w *packetWriter) start1RTTPacket(pnum, pnumMaxAcked packetNumber, dstConnID []byte) {
+	w.pktOff = len(w.b)
+	pnumLen := packetNumberLength(pnum, pnumMaxAcked)
+	hdrSize := 1 + len(dstConnID) + pnumLen
+	if w.pktOff+hdrSize+aeadOverhead+minPacketPayload > w.dgramLim {
+		w.dgramLim = 0
+	}
+	w.b = append(w.b, fixedBit|byte(pnumLen-1))
+	w.b = append(w.b, dstConnID...)
+	w.pnumOff = len(w.b)
+	w.b = appendPacketNumber(w.b, pnum, pnumMaxAcked)
+	w.payOff = len(w.b)
+	w.sent = &sentPacket{num: pnum}
+}
+
+// finish1RTTPacket finishes writing a 1-RTT packet.
+// It returns a sentPacket describing the packet,
+// or nil if no packet was written.
+func (w *packetWriter) finish1RTTPacket(pnum packetNumber, k *updatingKeyPair) *sentPacket {
+	if len(w.payload()) == 0 {
+		w.abandonPacket()
+		return nil
+	}
+	w.padMinPayload()
+	w.pending = append(w.pending, pendingPacket{
+		pktOff:  w.pktOff,
+		pnumOff: w.pnumOff,
+		payOff:  w.payOff,
+		end:     len(w.b),
+		pnum:    pnum,
+		uk:      k,
+		sent:    w.sent,
+	})
+	return w.finishPacket()
+}
+
+func (w *packetWriter) finishPacket() *sentPacket {
+	sent := w.sent
+	sent.size = w.packetLen()
+	// Reserve space for the AEAD tag.
+	for i := 0; i < aeadOverhead; i++ {
+		w.b = append(w.b, 0)
+	}
+	w.sent = nil
+	return sent
+}
+
+func (w *packetWriter) abandonPacket() {
+	w.b = w.b[:w.pktOff]
+	w.sent = nil
+}
+
+// padMinPayload pads the current packet so that the packet number and payload
+// are at least 4 bytes long, as required for header protection sampling.
+func (w *packetWriter) padMinPayload() {
+	for len(w.b)-w.pnumOff < minPacketPayload {
+		w.b = append(w.b, frameTypePadding)
+	}
+}
+
+// finishDatagram applies packet protection to the packets in the datagram.
+// If padTo is non-zero, the last packet is padded so the datagram is at least
+// padTo bytes long.
+// It returns the datagram, or nil if the datagram is empty.
+func (w *packetWriter) finishDatagram(padTo int) []byte {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if n := padTo - len(w.b); n > 0 {
+		// The AEAD tag placeholder at the end of the datagram is zeroed,
+		// so extending it adds PADDING frames to the payload of the last packet.
+		last := &w.pending[len(w.pending)-1]
+		for i := 0; i < n; i++ {
+			w.b = append(w.b, 0)
+		}
+		last.end += n
+		last.sent.size += n
+	}
+	for _, p := range w.pending {
+		hdr := w.b[p.pktOff:p.payOff]
+		pay := w.b[p.payOff:p.end]
+		if p.long {
+			length := p.end - p.pnumOff + aeadOverhead
+			w.b[p.pnumOff-2] = 0x40 | byte(length>>8)
+			w.b[p.pnumOff-1] = byte(length)
+			p.k.protect(hdr, pay, p.pnumOff-p.pktOff, p.pnum)
+		} else {
+			p.uk.protect(hdr, pay, p.pnumOff-p.pktOff, p.pnum)
+		}
+	}
+	w.pending = w.pending[:0]
+	return w.b
+}
+
+func (w *packetWriter) recordFrame(f sentFrame) {
+	w.sent.frames = append(w.sent.frames, f)
+}
+
+func (w *packetWriter) setAckEliciting() {
+	w.sent.ackEliciting = true
+	w.sent.inFlight = true
+}
+
+// appendPingFrame appends a PING frame to the packet.
+func (w *packetWriter) appendPingFrame() (added bool) {
+	if w.avail() < 1 {
+		return false
+	}
+	w.b = append(w.b, frameTypePing)
+	w.setAckEliciting()
+	return true
+}
+
+// appendAckFrame appends an ACK frame to the packet.
+// It includes at least the most recent range in the rangeset
+// (the range with the largest packet numbers),
+// followed by as many additional ranges as fit within the packet.
+//
+// We always write at least one ACK range, so the caller must ensure
+// the rangeset is not empty.
+//
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-19.3
+func (w *packetWriter) appendAckFrame(seen rangeset, delay uint64) (added bool) {
+	if len(seen) == 0 {
+		panic("BUG: appendAckFrame with empty rangeset")
+	}
+	largest := uint64(seen.max())
+	firstRange := uint64(seen[len(seen)-1].size() - 1)
+	if w.avail() < 1+sizeVarint(largest)+sizeVarint(delay)+1+sizeVarint(firstRange) {
+		return false
+	}
+	w.b = append(w.b, frameTypeAck)
+	w.b = appendVarint(w.b, largest)
+	w.b = appendVarint(w.b, delay)
+	// The range count is technically a varint, but we'll reserve a single byte for it
+	// and never add more than 62 ranges (the maximum value that fits in one byte).
+	rangeCountOff := len(w.b)
+	w.b = append(w.b, 0)
+	w.b = appendVarint(w.b, firstRange)
+	rangeCount := byte(0)
+	for i := len(seen) - 2; i >= 0; i-- {
+		gap := uint64(seen[i+1].start - seen[i].end - 1)
+		size := uint64(seen[i].size() - 1)
+		if w.avail() < sizeVarint(gap)+sizeVarint(size) || rangeCount > 62 {
+			break
+		}
+		w.b = appendVarint(w.b, gap)
+		w.b = appendVarint(w.b, size)
+		rangeCount++
+	}
+	w.b[rangeCountOff] = rangeCount
+	return true
+}
+
+// appendCryptoFrame appends a CRYPTO frame with up to size bytes of data
+// starting at offset off.
+// It returns a []byte into which the data should be written and whether a frame was added.
+// The returned []byte may be smaller than size if the packet cannot hold all the data.
+func (w *packetWriter) appendCryptoFrame(off int64, size int) (_ []byte, added bool) {
+	max := w.avail()
+	max -= 1                           // frame type
+	max -= sizeVarint(uint64(off))     // offset
+	max -= sizeVarint(uint64(off) + 1) // maximum length
+	if max <= 0 {
+		return nil, false
+	}
+	if max < size {
+		size = max
+	}
+	w.b = append(w.b, frameTypeCrypto)
+	w.b = appendVarint(w.b, uint64(off))
+	w.b = appendVarint(w.b, uint64(size))
+	start := len(w.b)
+	w.b = w.b[:start+size]
+	w.recordFrame(sentFrame{typ: frameTypeCrypto, start: off, end: off + int64(size)})
+	w.setAckEliciting()
+	return w.b[start:][:size], true
+}
+
+// appendStreamFrame appends a STREAM frame with up to size bytes of data
+// starting at offset off.
+// It returns a []byte into which the data should be written and whether a frame was added.
+// The returned []byte may be smaller than size if the packet cannot hold all the data.
+// If fin is true and the returned []byte is not truncated, the frame carries the FIN bit.
+func (w *packetWriter) appendStreamFrame(id streamID, off int64, size int, fin bool) (_ []byte, added bool) {
+	typ := uint8(frameTypeStreamBase | streamLenBit)
+	max := w.avail()
+	max -= 1 // frame type
+	max -= sizeVarint(uint64(id))
+	if off != 0 {
+		max -= sizeVarint(uint64(off))
+		typ |= streamOffBit
+	}
+	max -= sizeVarint(uint64(size)) // maximum length
+	if max < 0 || (max == 0 && size > 0) {
+		return nil, false
+	}
+	if max < size {
+		size = max
+		fin = false
+	}
+	if fin {
+		typ |= streamFinBit
+	}
+	w.b = append(w.b, typ)
+	w.b = appendVarint(w.b, uint64(id))
+	if off != 0 {
+		w.b = appendVarint(w.b, uint64(off))
+	}
+	w.b = appendVarint(w.b, uint64(size))
+	start := len(w.b)
+	w.b = w.b[:start+size]
+	w.recordFrame(sentFrame{typ: frameTypeStreamBase, id: id, start: off, end: off + int64(size), fin: fin})
+	w.setAckEliciting()
+	return w.b[start:][:size], true
+}
+
+func (w *packetWriter) appendResetStreamFrame(id streamID, code uint64, finalSize int64) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(id))+sizeVarint(code)+sizeVarint(uint64(finalSize)) {
+		return false
+	}
+	w.b = append(w.b, frameTypeResetStream)
+	w.b = appendVarint(w.b, uint64(id))
+	w.b = appendVarint(w.b, code)
+	w.b = appendVarint(w.b, uint64(finalSize))
+	w.recordFrame(sentFrame{typ: frameTypeResetStream, id: id})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendStopSendingFrame(id streamID, code uint64) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(id))+sizeVarint(code) {
+		return false
+	}
+	w.b = append(w.b, frameTypeStopSending)
+	w.b = appendVarint(w.b, uint64(id))
+	w.b = appendVarint(w.b, code)
+	w.recordFrame(sentFrame{typ: frameTypeStopSending, id: id})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendMaxDataFrame(max int64) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(max)) {
+		return false
+	}
+	w.b = append(w.b, frameTypeMaxData)
+	w.b = appendVarint(w.b, uint64(max))
+	w.recordFrame(sentFrame{typ: frameTypeMaxData})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendMaxStreamDataFrame(id streamID, max int64) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(id))+sizeVarint(uint64(max)) {
+		return false
+	}
+	w.b = append(w.b, frameTypeMaxStreamData)
+	w.b = appendVarint(w.b, uint64(id))
+	w.b = appendVarint(w.b, uint64(max))
+	w.recordFrame(sentFrame{typ: frameTypeMaxStreamData, id: id})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendMaxStreamsFrame(typ streamType, max int64) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(max)) {
+		return false
+	}
+	var ftype byte
+	if typ == bidiStream {
+		ftype = frameTypeMaxStreamsBidi
+	} else {
+		ftype = frameTypeMaxStreamsUni
+	}
+	w.b = append(w.b, ftype)
+	w.b = appendVarint(w.b, uint64(max))
+	w.recordFrame(sentFrame{typ: ftype})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendNewConnectionIDFrame(seq, retirePriorTo int64, connID []byte, token [16]byte) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(seq))+sizeVarint(uint64(retirePriorTo))+1+len(connID)+len(token) {
+		return false
+	}
+	w.b = append(w.b, frameTypeNewConnectionID)
+	w.b = appendVarint(w.b, uint64(seq))
+	w.b = appendVarint(w.b, uint64(retirePriorTo))
+	w.b = appendUint8Bytes(w.b, connID)
+	w.b = append(w.b, token[:]...)
+	w.recordFrame(sentFrame{typ: frameTypeNewConnectionID, start: seq})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendRetireConnectionIDFrame(seq int64) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(seq)) {
+		return false
+	}
+	w.b = append(w.b, frameTypeRetireConnectionID)
+	w.b = appendVarint(w.b, uint64(seq))
+	w.recordFrame(sentFrame{typ: frameTypeRetireConnectionID, start: seq})
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendPathChallengeFrame(data pathChallengeData) (added bool) {
+	if w.avail() < 1+len(data) {
+		return false
+	}
+	w.b = append(w.b, frameTypePathChallenge)
+	w.b = append(w.b, data[:]...)
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendPathResponseFrame(data pathChallengeData) (added bool) {
+	if w.avail() < 1+len(data) {
+		return false
+	}
+	w.b = append(w.b, frameTypePathResponse)
+	w.b = append(w.b, data[:]...)
+	w.setAckEliciting()
+	return true
+}
+
+func (w *packetWriter) appendHandshakeDoneFrame() (added bool) {
+	if w.avail() < 1 {
+		return false
+	}
+	w.b = append(w.b, frameTypeHandshakeDone)
+	w.recordFrame(sentFrame{typ: frameTypeHandshakeDone})
+	w.setAckEliciting()
+	return true
+}
+
+// appendConnectionCloseTransportFrame appends a CONNECTION_CLOSE frame
+// carrying a transport error code.
+func (w *packetWriter) appendConnectionCloseTransportFrame(code transportError, frameType uint64, reason string) (added bool) {
+	if w.avail() < 1+sizeVarint(uint64(code))+sizeVarint(frameType)+sizeVarint(uint64(len(reason)))+len(reason) {
+		return false
+	}
+	w.b = append(w.b, frameTypeConnectionCloseTransport)
+	w.b = appendVarint(w.b, uint64(code))
+	w.b = appendVarint(w.b, frameType)
+	w.b = appendVarintBytes(w.b, []byte(reason))
+	// We don't record CONNECTION_CLOSE frames in w.sent, since they are never acked or
+	// detected as lost.
+	return true
+}
+
+// appendConnectionCloseApplicationFrame appends a CONNECTION_CLOSE frame
+// carrying an application protocol error code.
+func (w *packetWriter) appendConnectionCloseApplicationFrame(code uint64, reason string) (added bool) {
+	if w.avail() < 1+sizeVarint(code)+sizeVarint(uint64(len(reason)))+len(reason) {
+		return false
+	}
+	w.b = append(w.b, frameTypeConnectionCloseApplication)
+	w.b = appendVarint(w.b, code)
+	w.b = appendVarintBytes(w.b, []byte(reason))
+	return true
+}
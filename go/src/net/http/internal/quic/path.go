@@ -0,0 +1,211 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"crypto/rand"
+	"net"
+	"time"
+)
+
+// pathChallengeData is the payload of a PATH_CHALLENGE or PATH_RESPONSE frame.
+type pathChallengeData [64 / 8]byte
+
+// pathState tracks validation of the peer's address.
+//
+// We do not initiate connection migration, but a peer's address may change
+// (for example, when a NAT rebinds the client's port). When a server sees
+// a new peer address, it validates the address with a PATH_CHALLENGE.
+// Until the peer responds, the server continues to send to the old,
+// validated address, and sends only PATH_CHALLENGE probes to the new one.
+// If the peer does not respond in time, the server abandons the new address.
+//
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-8.2
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-9.3
+type pathState struct {
+	// newAddr is the address being validated, or nil if none.
+	newAddr net.Addr
+
+	// challenge is the data in our outstanding PATH_CHALLENGE.
+	challenge pathChallengeData
+
+	// nextChallenge is when to send the next PATH_CHALLENGE probe to newAddr,
+	// and deadline is when we give up on validating it.
+	nextChallenge time.Time
+	deadline      time.Time
+
+	// Anti-amplification limit for newAddr: Three times the amount of data
+	// received from it, less the amount of data sent to it.
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-9.3-5
+	antiAmplificationLimit int
+
+	// responses are PATH_RESPONSE frames we need to send to the peer.
+	responses []pathChallengeData
+}
+
+// validating reports whether we are validating a new peer address.
+func (s *pathState) validating() bool {
+	return s.newAddr != nil
+}
+
+// handlePathChallenge handles a PATH_CHALLENGE frame from the peer.
+func (c *Conn) handlePathChallenge(data pathChallengeData) {
+	// Don't let a peer make us accumulate an unbounded number of responses.
+	const maxPendingResponses = 4
+	if len(c.path.responses) < maxPendingResponses {
+		c.path.responses = append(c.path.responses, data)
+	}
+}
+
+// handlePathResponse handles a PATH_RESPONSE frame from the peer.
+//
+// "A PATH_RESPONSE frame received on any network path validates the path
+// on which the PATH_CHALLENGE was sent."
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-8.2.2-2
+func (c *Conn) handlePathResponse(data pathChallengeData) {
+	if c.path.validating() && data == c.path.challenge {
+		// "On confirming a peer's ownership of its new address, an endpoint
+		// MUST immediately reset the congestion controller and round-trip
+		// time estimator for the new path to initial values [...] unless
+		// the only change in the peer's address is its port number."
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-9.4-3
+		if !sameHost(c.peerAddr, c.path.newAddr) {
+			c.loss.resetPath()
+		}
+		c.peerAddr = c.path.newAddr
+		c.path.abandon()
+	}
+}
+
+// abandon stops validating the new peer address.
+func (s *pathState) abandon() {
+	s.newAddr = nil
+	s.nextChallenge = time.Time{}
+	s.deadline = time.Time{}
+	s.antiAmplificationLimit = 0
+}
+
+// datagramReceived records a datagram received from addr.
+func (s *pathState) datagramReceived(addr net.Addr, size int) {
+	if s.validating() && sameAddr(addr, s.newAddr) {
+		s.antiAmplificationLimit += 3 * size
+	}
+}
+
+// peerAddressChanged is called when a packet with the largest packet number
+// seen so far arrives in a datagram of the given size from an address other
+// than the one we are sending to.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-9.3
+func (c *Conn) peerAddressChanged(now time.Time, addr net.Addr, size int) {
+	if c.side == clientSide {
+		// Servers don't migrate.
+		return
+	}
+	if c.path.validating() && sameAddr(addr, c.path.newAddr) {
+		// Already validating this address.
+		return
+	}
+	if _, err := rand.Read(c.path.challenge[:]); err != nil {
+		return
+	}
+	c.path.newAddr = addr
+	c.path.antiAmplificationLimit = 3 * size
+	c.path.nextChallenge = now
+	// "[...] a value of three times the larger of the current PTO
+	// or the PTO for the new path (using kInitialRtt [...]) is RECOMMENDED."
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-8.2.4-2
+	const initialPathPTO = 2 * 333 * time.Millisecond
+	c.path.deadline = now.Add(3 * max64d(c.loss.ptoPeriod(), initialPathPTO))
+}
+
+// advancePath handles path validation timer expirations.
+func (c *Conn) advancePath(now time.Time) {
+	if c.path.validating() && !now.Before(c.path.deadline) {
+		// "If path validation fails, [...] the endpoint MUST continue
+		// sending all future packets to the old peer address."
+		// https://www.rfc-editor.org/rfc/rfc9000.html#section-9.3.2-2
+		c.path.abandon()
+	}
+}
+
+// pathTimeout returns the time of the next path validation event.
+func (c *Conn) pathTimeout() time.Time {
+	if !c.path.validating() {
+		return time.Time{}
+	}
+	if c.path.nextChallenge.Before(c.path.deadline) {
+		return c.path.nextChallenge
+	}
+	return c.path.deadline
+}
+
+// maybeSendPathChallenge sends a PATH_CHALLENGE to the address being validated,
+// if one is due and the new path's anti-amplification limit permits.
+func (c *Conn) maybeSendPathChallenge(now time.Time) {
+	if !c.path.validating() || now.Before(c.path.nextChallenge) || !c.keysAppData.canWrite() || c.lifetime.state != connStateAlive {
+		return
+	}
+	size := min(minimumClientInitialDatagramSize, c.path.antiAmplificationLimit)
+	if size < minPacketSize {
+		// Wait for more data from the peer on the new path.
+		return
+	}
+	c.w.reset(size)
+	pnumMaxAcked := c.loss.largestAcked(appDataSpace)
+	pnum := c.loss.nextNumber(appDataSpace)
+	c.w.start1RTTPacket(pnum, pnumMaxAcked, c.connIDState.dstConnID())
+	c.w.appendPathChallengeFrame(c.path.challenge)
+	sent := c.w.finish1RTTPacket(pnum, &c.keysAppData)
+	if sent == nil {
+		return
+	}
+	sent.space = appDataSpace
+	// "An endpoint MUST expand datagrams that contain a PATH_CHALLENGE frame
+	// to at least the smallest allowed maximum datagram size of 1200 bytes,
+	// unless the anti-amplification limit for the path does not permit
+	// sending a datagram of this size."
+	// https://www.rfc-editor.org/rfc/rfc9000.html#section-8.2.1-3
+	buf := c.w.finishDatagram(size)
+	if buf == nil {
+		return
+	}
+	c.loss.packetSent(now, sent)
+	c.path.antiAmplificationLimit -= len(buf)
+	c.path.nextChallenge = now.Add(c.loss.ptoPeriod())
+	c.endpoint.sendDatagram(buf, c.path.newAddr)
+}
+
+// appendPathFrames appends PATH_RESPONSE frames.
+// It reports whether the datagram should be padded.
+func (c *Conn) appendPathFrames() (pad bool) {
+	for len(c.path.responses) > 0 {
+		if !c.w.appendPathResponseFrame(c.path.responses[0]) {
+			return pad
+		}
+		c.path.responses = c.path.responses[1:]
+		pad = true
+	}
+	return pad
+}
+
+// sameAddr reports whether two network addresses are the same.
+func sameAddr(a, b net.Addr) bool {
+	if a, ok := a.(*net.UDPAddr); ok {
+		if b, ok := b.(*net.UDPAddr); ok {
+			return a.Port == b.Port && a.IP.Equal(b.IP) && a.Zone == b.Zone
+		}
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// sameHost reports whether two network addresses differ at most in port.
+func sameHost(a, b net.Addr) bool {
+	if a, ok := a.(*net.UDPAddr); ok {
+		if b, ok := b.(*net.UDPAddr); ok {
+			return a.IP.Equal(b.IP) && a.Zone == b.Zone
+		}
+	}
+	return sameAddr(a, b)
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPathResponseResetsRecoveryState(t *testing.T) {
+	oldAddr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000}
+	for _, test := range []struct {
+		name    string
+		newAddr net.Addr
+		reset   bool
+	}{{
+		name:    "new port",
+		newAddr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2000},
+		reset:   false,
+	}, {
+		name:    "new IP",
+		newAddr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1000},
+		reset:   true,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			c := &Conn{side: serverSide, peerAddr: oldAddr}
+			c.loss.init(serverSide, 1200, now)
+			initialWindow := c.loss.cc.congestionWindow
+			initialRTT := c.loss.rtt.smoothedRTT
+
+			c.loss.rtt.updateSample(now, true, appDataSpace, 10*time.Millisecond, 0, 0)
+			c.loss.cc.congestionWindow = 4 * initialWindow
+			c.loss.cc.bytesInFlight = 3000
+			c.path.newAddr = test.newAddr
+			c.path.challenge = pathChallengeData{1, 2, 3}
+
+			c.handlePathResponse(pathChallengeData{4, 5, 6})
+			if sameAddr(c.peerAddr, test.newAddr) {
+				t.Fatalf("mismatched PATH_RESPONSE validated the new address")
+			}
+			c.handlePathResponse(c.path.challenge)
+			if !sameAddr(c.peerAddr, test.newAddr) {
+				t.Fatalf("peer address = %v, want %v", c.peerAddr, test.newAddr)
+			}
+
+			wantWindow, wantRTT, wantMinRTT := 4*initialWindow, 10*time.Millisecond, 10*time.Millisecond
+			if test.reset {
+				wantWindow, wantRTT, wantMinRTT = initialWindow, initialRTT, -1
+			}
+			if got := c.loss.cc.congestionWindow; got != wantWindow {
+				t.Errorf("congestion window = %v, want %v", got, wantWindow)
+			}
+			if got := c.loss.rtt.smoothedRTT; got != wantRTT {
+				t.Errorf("smoothed RTT = %v, want %v", got, wantRTT)
+			}
+			if got := c.loss.rtt.minRTT; got != wantMinRTT {
+				t.Errorf("min RTT = %v, want %v", got, wantMinRTT)
+			}
+			// Packets sent on the old path are still in flight.
+			if got := c.loss.cc.bytesInFlight; got != 3000 {
+				t.Errorf("bytes in flight = %v, want 3000", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// A pipe is a byte buffer used in implementing streams.
+//
+// A pipe contains a window of stream data.
+// Random access reads and writes are supported within the window.
+// Writing past the end of the window extends it.
+// Data may be discarded from the start of the pipe, advancing the window.
+type pipe struct {
+	start int64  // stream position of first stored byte
+	buf   []byte // stored data; buf[0] is at stream position start
+}
+
+// end returns the stream position just past the last stored byte.
+func (p *pipe) end() int64 {
+	return p.start + int64(len(p.buf))
+}
+
+// writeAt writes len(b) bytes to the pipe at stream position off.
+//
+// Writes to positions before the start of the pipe are discarded.
+// Writes beyond the end of the pipe extend it, zero-filling any gap.
+func (p *pipe) writeAt(b []byte, off int64) {
+	if off < p.start {
+		if off+int64(len(b)) <= p.start {
+			return
+		}
+		b = b[p.start-off:]
+		off = p.start
+	}
+	end := off + int64(len(b))
+	if end > p.end() {
+		n := int(end - p.end())
+		if cap(p.buf)-len(p.buf) >= n {
+			p.buf = p.buf[:len(p.buf)+n]
+		} else {
+			p.buf = append(p.buf, make([]byte, n)...)
+		}
+	}
+	copy(p.buf[off-p.start:], b)
+}
+
+// copy copies len(b) bytes into b starting from off.
+// The pipe must contain [off, off+len(b)).
+func (p *pipe) copy(off int64, b []byte) {
+	copy(b, p.buf[off-p.start:])
+}
+
+// discardBefore discards all data prior to off.
+func (p *pipe) discardBefore(off int64) {
+	if off <= p.start {
+		return
+	}
+	if off >= p.end() {
+		p.start = off
+		p.buf = p.buf[:0]
+		return
+	}
+	n := off - p.start
+	if n > int64(cap(p.buf)/2) {
+		// Reclaim the space at the start of the buffer.
+		p.buf = p.buf[:copy(p.buf, p.buf[n:])]
+	} else {
+		p.buf = p.buf[n:]
+	}
+	p.start = off
+}
@@ -0,0 +1,368 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quic implements the QUIC transport protocol
+// (RFC 9000, RFC 9001 and RFC 9002) for use by net/http's HTTP/3 support.
+//
+// The TLS 1.3 handshake is provided by crypto/tls's QUICConn.
+// Packets are exchanged over a net.PacketConn owned by an Endpoint,
+// which demultiplexes datagrams to connections by connection ID.
+//
+// The implementation supports QUIC version 1 only. It does not send
+// Retry packets or stateless resets, and it does not perform path MTU
+// discovery: all datagrams are limited to 1200 bytes.
+package quic
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// quicVersion1 is the only QUIC version supported.
+const quicVersion1 = 0x00000001
+
+// connIDLen is the length of the connection IDs we issue.
+// Short header packets do not carry the length of the destination
+// connection ID, so it must be fixed for an endpoint.
+const connIDLen = 8
+
+// maxConnIDLen is the maximum length of a connection ID in QUIC version 1.
+const maxConnIDLen = 20
+
+// minimumClientInitialDatagramSize is the minimum size of a UDP datagram
+// carrying an ack-eliciting Initial packet.
+//
+// https://www.rfc-editor.org/rfc/rfc9000#section-14.1
+const minimumClientInitialDatagramSize = 1200
+
+// maxUDPPayloadSize is the size of the datagrams we send.
+// We do not perform path MTU discovery, and use the smallest size
+// every QUIC path is required to support.
+//
+// https://www.rfc-editor.org/rfc/rfc9000#section-14
+const maxUDPPayloadSize = 1200
+
+// maxRecvUDPPayloadSize is the maximum size of datagrams we accept,
+// advertised in the max_udp_payload_size transport parameter.
+const maxRecvUDPPayloadSize = 65527
+
+// Local timer granularity.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.1.2-6
+const timerGranularity = 1 * time.Millisecond
+
+// Default values of transport parameters, used when the peer omits them.
+// https://www.rfc-editor.org/rfc/rfc9000#section-18.2
+const (
+	defaultAckDelayExponent  = 3
+	defaultMaxAckDelay       = 25 * time.Millisecond
+	defaultActiveConnIDLimit = 2
+)
+
+// maxAckDelay is the maximum time by which we delay sending ACKs.
+const maxAckDelay = 25 * time.Millisecond
+
+// ackDelayExponent is the ack_delay_exponent we advertise.
+const ackDelayExponent = defaultAckDelayExponent
+
+// A side distinguishes the client and server ends of a connection.
+type connSide int8
+
+const (
+	clientSide = connSide(iota)
+	serverSide
+)
+
+func (s connSide) String() string {
+	switch s {
+	case clientSide:
+		return "client"
+	case serverSide:
+		return "server"
+	default:
+		return "BUG"
+	}
+}
+
+func (s connSide) peer() connSide {
+	if s == clientSide {
+		return serverSide
+	}
+	return clientSide
+}
+
+// A Config structure is used to configure a QUIC endpoint.
+// A Config should not be modified after it has been passed to a QUIC function.
+// A Config may be reused; the quic package will also not modify it.
+type Config struct {
+	// TLSConfig is the endpoint's TLS configuration.
+	// It must be non-nil and set MinVersion to at least tls.VersionTLS13.
+	TLSConfig *tls.Config
+
+	// MaxBidiRemoteStreams limits the number of simultaneous bidirectional streams
+	// a peer may open.
+	// If zero, the default value of 100 is used.
+	// If negative, the limit is zero.
+	MaxBidiRemoteStreams int64
+
+	// MaxUniRemoteStreams limits the number of simultaneous unidirectional streams
+	// a peer may open.
+	// If zero, the default value of 100 is used.
+	// If negative, the limit is zero.
+	MaxUniRemoteStreams int64
+
+	// MaxStreamReadBufferSize is the maximum amount of data sent by the peer that a
+	// stream will buffer for reading.
+	// If zero, the default value of 1MiB is used.
+	// If negative, the limit is zero.
+	MaxStreamReadBufferSize int64
+
+	// MaxStreamWriteBufferSize is the maximum amount of data a stream will buffer for
+	// sending to the peer.
+	// If zero, the default value of 1MiB is used.
+	// If negative, the limit is zero.
+	MaxStreamWriteBufferSize int64
+
+	// MaxConnReadBufferSize is the maximum amount of data sent by the peer that a
+	// connection will buffer for reading, across all streams.
+	// If zero, the default value of 1MiB is used.
+	// If negative, the limit is zero.
+	MaxConnReadBufferSize int64
+
+	// HandshakeTimeout is the maximum time in which a connection handshake must complete.
+	// If zero, the default of 10 seconds is used.
+	// If negative, there is no handshake timeout.
+	HandshakeTimeout time.Duration
+
+	// MaxIdleTimeout is the maximum time after which an idle connection will be closed.
+	// If zero, the default of 30 seconds is used.
+	// If negative, idle connections are never closed.
+	//
+	// The idle timeout for a connection is the minimum of the maximum idle timeouts
+	// of the endpoints.
+	MaxIdleTimeout time.Duration
+
+	// KeepAlivePeriod is the time after which a packet will be sent to keep
+	// an idle connection alive.
+	// If zero, keep alive packets are not sent.
+	// If greater than zero, the keep alive period is the smaller of KeepAlivePeriod and
+	// half the connection idle timeout.
+	KeepAlivePeriod time.Duration
+
+	// Allow0RTT enables 0-RTT data, which a client resuming a session may
+	// send before the handshake completes.
+	//
+	// A server which allows 0-RTT issues session tickets permitting it,
+	// and Accept returns a connection as soon as it accepts 0-RTT data.
+	// Data received before the handshake completes may be replayed by an
+	// attacker; see Conn.WaitHandshake.
+	//
+	// A client which allows 0-RTT sends it when resuming a session whose
+	// ticket permits it, and Dial returns as soon as 0-RTT data can be sent.
+	// If the server rejects 0-RTT, the data is sent again after the
+	// handshake completes.
+	Allow0RTT bool
+}
+
+func configDefault(v, def, limit int64) int64 {
+	switch {
+	case v == 0:
+		return def
+	case v < 0:
+		return 0
+	default:
+		return min64(v, limit)
+	}
+}
+
+func (c *Config) maxBidiRemoteStreams() int64 {
+	return configDefault(c.MaxBidiRemoteStreams, 100, maxStreamsLimit)
+}
+
+func (c *Config) maxUniRemoteStreams() int64 {
+	return configDefault(c.MaxUniRemoteStreams, 100, maxStreamsLimit)
+}
+
+func (c *Config) maxStreamReadBufferSize() int64 {
+	return configDefault(c.MaxStreamReadBufferSize, 1<<20, maxVarint)
+}
+
+func (c *Config) maxStreamWriteBufferSize() int64 {
+	return configDefault(c.MaxStreamWriteBufferSize, 1<<20, maxVarint)
+}
+
+func (c *Config) maxConnReadBufferSize() int64 {
+	return configDefault(c.MaxConnReadBufferSize, 1<<20, maxVarint)
+}
+
+func (c *Config) handshakeTimeout() time.Duration {
+	return time.Duration(configDefault(int64(c.HandshakeTimeout), int64(10*time.Second), 1<<63-1))
+}
+
+func (c *Config) maxIdleTimeout() time.Duration {
+	return time.Duration(configDefault(int64(c.MaxIdleTimeout), int64(30*time.Second), 1<<63-1))
+}
+
+func (c *Config) keepAlivePeriod() time.Duration {
+	return time.Duration(configDefault(int64(c.KeepAlivePeriod), 0, 1<<63-1))
+}
+
+// transportParameters returns the transport parameters we send to the peer,
+// except for the connection IDs.
+func (c *Config) transportParameters() transportParameters {
+	return transportParameters{
+		maxIdleTimeout:                 c.maxIdleTimeout(),
+		maxUDPPayloadSize:              maxRecvUDPPayloadSize,
+		initialMaxData:                 c.maxConnReadBufferSize(),
+		initialMaxStreamDataBidiLocal:  c.maxStreamReadBufferSize(),
+		initialMaxStreamDataBidiRemote: c.maxStreamReadBufferSize(),
+		initialMaxStreamDataUni:        c.maxStreamReadBufferSize(),
+		initialMaxStreamsBidi:          c.maxBidiRemoteStreams(),
+		initialMaxStreamsUni:           c.maxUniRemoteStreams(),
+		ackDelayExponent:               ackDelayExponent,
+		maxAckDelay:                    maxAckDelay,
+		activeConnIDLimit:              activeConnIDLimit,
+	}
+}
+
+// A transportError is a transport error code from RFC 9000 Section 20.1.
+//
+// The transportError type doesn't implement the error interface to ensure we
+// always distinguish between errors sent to and received from the peer.
+// See the localTransportError and peerTransportError types below.
+type transportError uint64
+
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-20.1
+const (
+	errNo                   = transportError(0x00)
+	errInternal             = transportError(0x01)
+	errConnectionRefused    = transportError(0x02)
+	errFlowControl          = transportError(0x03)
+	errStreamLimit          = transportError(0x04)
+	errStreamState          = transportError(0x05)
+	errFinalSize            = transportError(0x06)
+	errFrameEncoding        = transportError(0x07)
+	errTransportParameter   = transportError(0x08)
+	errConnectionIDLimit    = transportError(0x09)
+	errProtocolViolation    = transportError(0x0a)
+	errInvalidToken         = transportError(0x0b)
+	errApplicationError     = transportError(0x0c)
+	errCryptoBufferExceeded = transportError(0x0d)
+	errKeyUpdateError       = transportError(0x0e)
+	errAEADLimitReached     = transportError(0x0f)
+	errNoViablePath         = transportError(0x10)
+	errTLSBase              = transportError(0x0100) // 0x0100-0x01ff; base + TLS code
+)
+
+func (e transportError) String() string {
+	switch e {
+	case errNo:
+		return "NO_ERROR"
+	case errInternal:
+		return "INTERNAL_ERROR"
+	case errConnectionRefused:
+		return "CONNECTION_REFUSED"
+	case errFlowControl:
+		return "FLOW_CONTROL_ERROR"
+	case errStreamLimit:
+		return "STREAM_LIMIT_ERROR"
+	case errStreamState:
+		return "STREAM_STATE_ERROR"
+	case errFinalSize:
+		return "FINAL_SIZE_ERROR"
+	case errFrameEncoding:
+		return "FRAME_ENCODING_ERROR"
+	case errTransportParameter:
+		return "TRANSPORT_PARAMETER_ERROR"
+	case errConnectionIDLimit:
+		return "CONNECTION_ID_LIMIT_ERROR"
+	case errProtocolViolation:
+		return "PROTOCOL_VIOLATION"
+	case errInvalidToken:
+		return "INVALID_TOKEN"
+	case errApplicationError:
+		return "APPLICATION_ERROR"
+	case errCryptoBufferExceeded:
+		return "CRYPTO_BUFFER_EXCEEDED"
+	case errKeyUpdateError:
+		return "KEY_UPDATE_ERROR"
+	case errAEADLimitReached:
+		return "AEAD_LIMIT_REACHED"
+	case errNoViablePath:
+		return "NO_VIABLE_PATH"
+	}
+	if e >= 0x0100 && e <= 0x01ff {
+		return fmt.Sprintf("CRYPTO_ERROR(%v)", tls.AlertError(e&0xff))
+	}
+	return fmt.Sprintf("ERROR %d", uint64(e))
+}
+
+// A localTransportError is an error sent to the peer.
+type localTransportError struct {
+	code   transportError
+	reason string
+}
+
+func (e localTransportError) Error() string {
+	if e.reason == "" {
+		return fmt.Sprintf("closed connection: %v", e.code)
+	}
+	return fmt.Sprintf("closed connection: %v: %q", e.code, e.reason)
+}
+
+// A peerTransportError is an error received from the peer.
+type peerTransportError struct {
+	code   transportError
+	reason string
+}
+
+func (e peerTransportError) Error() string {
+	return fmt.Sprintf("peer closed connection: %v: %q", e.code, e.reason)
+}
+
+// A StreamErrorCode is an application protocol error code (RFC 9000, Section 20.2)
+// indicating why a stream is being closed.
+type StreamErrorCode uint64
+
+func (e StreamErrorCode) Error() string {
+	return fmt.Sprintf("stream error code %v", uint64(e))
+}
+
+// An ApplicationError is an application protocol error code (RFC 9000, Section 20.2).
+// Application protocol errors may be sent when terminating a stream or connection.
+type ApplicationError struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *ApplicationError) Error() string {
+	return fmt.Sprintf("peer closed connection: %v: %q", e.Code, e.Reason)
+}
+
+// Is reports a match if err is an *ApplicationError with a matching Code.
+func (e *ApplicationError) Is(err error) bool {
+	e2, ok := err.(*ApplicationError)
+	return ok && e2.Code == e.Code
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs64(a int64) int64 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRangeset(t *testing.T) {
+	type op struct {
+		sub        bool
+		start, end int64
+	}
+	for _, test := range []struct {
+		desc string
+		ops  []op
+		want rangeset
+	}{{
+		desc: "add disjoint",
+		ops:  []op{{false, 10, 20}, {false, 0, 5}, {false, 30, 40}},
+		want: rangeset{{0, 5}, {10, 20}, {30, 40}},
+	}, {
+		desc: "add adjacent",
+		ops:  []op{{false, 0, 10}, {false, 10, 20}, {false, 20, 30}},
+		want: rangeset{{0, 30}},
+	}, {
+		desc: "add spanning",
+		ops:  []op{{false, 0, 5}, {false, 10, 15}, {false, 20, 25}, {false, 3, 22}},
+		want: rangeset{{0, 25}},
+	}, {
+		desc: "add empty",
+		ops:  []op{{false, 0, 5}, {false, 10, 10}},
+		want: rangeset{{0, 5}},
+	}, {
+		desc: "sub middle",
+		ops:  []op{{false, 0, 30}, {true, 10, 20}},
+		want: rangeset{{0, 10}, {20, 30}},
+	}, {
+		desc: "sub spanning",
+		ops:  []op{{false, 0, 5}, {false, 10, 15}, {false, 20, 25}, {true, 3, 22}},
+		want: rangeset{{0, 3}, {22, 25}},
+	}, {
+		desc: "sub all",
+		ops:  []op{{false, 0, 5}, {false, 10, 15}, {true, 0, 15}},
+		want: nil,
+	}} {
+		var s rangeset
+		for _, o := range test.ops {
+			if o.sub {
+				s.sub(o.start, o.end)
+			} else {
+				s.add(o.start, o.end)
+			}
+		}
+		if len(s) == 0 {
+			s = nil
+		}
+		if !reflect.DeepEqual(s, test.want) {
+			t.Errorf("%v: got %v, want %v", test.desc, s, test.want)
+		}
+	}
+}
+
+func TestRangesetQueries(t *testing.T) {
+	var s rangeset
+	s.add(10, 20)
+	s.add(30, 40)
+	for _, v := range []int64{10, 19, 30, 39} {
+		if !s.contains(v) {
+			t.Errorf("%v.contains(%v) = false, want true", s, v)
+		}
+	}
+	for _, v := range []int64{0, 9, 20, 29, 40} {
+		if s.contains(v) {
+			t.Errorf("%v.contains(%v) = true, want false", s, v)
+		}
+	}
+	if got, want := s.rangeContaining(35), (i64range{30, 40}); got != want {
+		t.Errorf("%v.rangeContaining(35) = %v, want %v", s, got, want)
+	}
+	if got, want := s.rangeContaining(25), (i64range{0, 0}); got != want {
+		t.Errorf("%v.rangeContaining(25) = %v, want %v", s, got, want)
+	}
+	if s.min() != 10 || s.max() != 39 || s.end() != 40 || s.numRanges() != 2 {
+		t.Errorf("%v: min, max, end, numRanges = %v, %v, %v, %v; want 10, 39, 40, 2", s, s.min(), s.max(), s.end(), s.numRanges())
+	}
+	if s.isrange(10, 40) {
+		t.Errorf("%v.isrange(10, 40) = true, want false", s)
+	}
+	s.add(20, 30)
+	if !s.isrange(10, 40) {
+		t.Errorf("%v.isrange(10, 40) = false, want true", s)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// An rttState holds the round-trip time estimates for a connection.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-5
+type rttState struct {
+	minRTT          time.Duration
+	latestRTT       time.Duration
+	smoothedRTT     time.Duration
+	rttvar          time.Duration // RTT variation
+	firstSampleTime time.Time     // time of first RTT sample
+}
+
+func (r *rttState) init() {
+	r.minRTT = -1 // not set
+	// "[...] the initial RTT SHOULD be set to 333 milliseconds."
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-6.2.2-1
+	const initialRTT = 333 * time.Millisecond
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.3-12
+	r.smoothedRTT = initialRTT
+	r.rttvar = initialRTT / 2
+}
+
+// updateSample incorporates a new RTT sample.
+// https://www.rfc-editor.org/rfc/rfc9002.html#section-5
+func (r *rttState) updateSample(now time.Time, handshakeConfirmed bool, spaceID numberSpace, latestRTT, ackDelay, maxAckDelay time.Duration) {
+	r.latestRTT = latestRTT
+
+	if r.minRTT < 0 {
+		// First RTT sample.
+		// "min_rtt MUST be set to the latest_rtt on the first RTT sample."
+		// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.2-2
+		r.minRTT = latestRTT
+		// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.3-14
+		r.smoothedRTT = latestRTT
+		r.rttvar = latestRTT / 2
+		r.firstSampleTime = now
+		return
+	}
+
+	// "min_rtt MUST be set to the lesser of min_rtt and latest_rtt [...]
+	// on all other samples."
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.2-2
+	if latestRTT < r.minRTT {
+		r.minRTT = latestRTT
+	}
+
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.3-7.2
+	// "[...] MAY ignore the acknowledgment delay for Initial packets [...]"
+	if spaceID == initialSpace {
+		ackDelay = 0
+	}
+	// "[...] SHOULD use a value of ack_delay that is the lesser of the value
+	// reported in the ack frame and the peer's max_ack_delay [...]"
+	if handshakeConfirmed && ackDelay > maxAckDelay {
+		ackDelay = maxAckDelay
+	}
+	// "The endpoint MUST NOT subtract the acknowledgment delay from
+	// the RTT sample if the resulting value is smaller than the min_rtt."
+	adjustedRTT := latestRTT
+	if latestRTT >= r.minRTT+ackDelay {
+		adjustedRTT = latestRTT - ackDelay
+	}
+
+	// https://www.rfc-editor.org/rfc/rfc9002.html#section-5.3-16
+	rttvarSample := r.smoothedRTT - adjustedRTT
+	if rttvarSample < 0 {
+		rttvarSample = -rttvarSample
+	}
+	r.rttvar = (3*r.rttvar + rttvarSample) / 4
+	r.smoothedRTT = ((7 * r.smoothedRTT) + adjustedRTT) / 8
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// A sentPacket tracks state related to an in-flight packet we sent,
+// to be committed when the peer acks it or resent if the packet is lost.
+type sentPacket struct {
+	num          packetNumber
+	space        numberSpace
+	size         int       // size in bytes
+	time         time.Time // time sent
+	ackEliciting bool      // https://www.rfc-editor.org/rfc/rfc9002.html#section-2-3.4.1
+	inFlight     bool      // https://www.rfc-editor.org/rfc/rfc9002.html#section-2-3.6.1
+
+	// frames records the retransmittable frames in the packet.
+	frames []sentFrame
+}
+
+// A sentFrame records the contents of a frame in a sentPacket.
+// Only the fields relevant to the frame type are set.
+type sentFrame struct {
+	typ   byte
+	id    streamID // stream frames; the stream type for MAX_STREAMS
+	start int64    // CRYPTO and STREAM data offset; connection ID sequence number
+	end   int64    // CRYPTO and STREAM data end offset
+	fin   bool     // STREAM frames
+}
+
+// A packetFate is the fate of a sent packet: Either acknowledged by the peer,
+// or declared lost.
+type packetFate byte
+
+const (
+	packetLost = packetFate(iota)
+	packetAcked
+)
+
+// A numberSpace is the context in which a packet number applies.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-12.3-7
+type numberSpace byte
+
+const (
+	initialSpace = numberSpace(iota)
+	handshakeSpace
+	appDataSpace
+	numberSpaceCount
+)
+
+func (n numberSpace) String() string {
+	switch n {
+	case initialSpace:
+		return "Initial"
+	case handshakeSpace:
+		return "Handshake"
+	case appDataSpace:
+		return "AppData"
+	default:
+		return "BUG"
+	}
+}
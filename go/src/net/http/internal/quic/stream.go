@@ -0,0 +1,571 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	errReadClosed  = errors.New("quic: read from closed stream")
+	errWriteClosed = errors.New("quic: write to closed stream")
+	errStreamReset = errors.New("quic: write to reset stream")
+	errSendOnly    = errors.New("quic: read from send-only stream")
+	errReceiveOnly = errors.New("quic: write to receive-only stream")
+)
+
+// A Stream is an ordered byte stream.
+//
+// Streams may be bidirectional, read-only, or write-only.
+// Methods inappropriate for a stream's direction
+// (for example, writing to a read-only stream)
+// return errors.
+//
+// It is not safe to perform concurrent reads from or writes to a stream.
+// It is safe, however, to read and write at the same time.
+type Stream struct {
+	id   streamID
+	conn *Conn
+
+	// The remaining fields are guarded by conn.mu.
+
+	inctx  context.Context
+	outctx context.Context
+
+	// Receive side. Unused for send-only streams.
+	in          pipe     // received data, starting at the read position
+	inset       rangeset // received ranges
+	inwin       int64    // last byte we've allowed the peer to send
+	inmaxbuf    int64    // maximum amount of data we will buffer
+	incredit    int64    // data credited to connection-level flow control
+	insize      int64    // stream final size; -1 before this is known
+	insendmax   sentVal  // set when we should send MAX_STREAM_DATA
+	inclosed    sentVal  // set by CloseRead; tracks sending STOP_SENDING
+	inresetcode int64    // RESET_STREAM code received from the peer; -1 if not reset
+
+	// Send side. Unused for receive-only streams.
+	out          pipe     // buffered data, starting at the first unacked byte
+	outwin       int64    // maximum MAX_STREAM_DATA received from the peer
+	outmaxbuf    int64    // maximum amount of data we will buffer
+	outmaxsent   int64    // largest offset sent, plus one
+	outunsent    rangeset // ranges in need of sending
+	outacked     rangeset // ranges acked by the peer
+	outclosed    sentVal  // set by CloseWrite; tracks sending the FIN
+	outreset     sentVal  // set by Reset or STOP_SENDING; tracks sending RESET_STREAM
+	outresetcode uint64   // reset code sent in RESET_STREAM
+	outstopped   bool     // set when the peer sent STOP_SENDING
+
+	inqueue bool // stream is in the conn's send queue
+	removed bool // stream has been removed from the conn's stream map
+}
+
+func newStream(c *Conn, id streamID) *Stream {
+	s := &Stream{
+		conn:        c,
+		id:          id,
+		inctx:       context.Background(),
+		outctx:      context.Background(),
+		insize:      -1,
+		inresetcode: -1,
+	}
+	if s.hasRecv() {
+		s.inmaxbuf = c.config.maxStreamReadBufferSize()
+		s.inwin = s.inmaxbuf
+	}
+	if s.hasSend() {
+		s.outmaxbuf = c.config.maxStreamWriteBufferSize()
+		s.outwin = c.streams.peerInitialMaxStreamData(id)
+	}
+	return s
+}
+
+// hasRecv reports whether data can be read from the stream.
+func (s *Stream) hasRecv() bool {
+	return s.id.streamType() == bidiStream || s.id.initiator() != s.conn.side
+}
+
+// hasSend reports whether data can be written to the stream.
+func (s *Stream) hasSend() bool {
+	return s.id.streamType() == bidiStream || s.id.initiator() == s.conn.side
+}
+
+// ID returns the QUIC stream ID of s.
+func (s *Stream) ID() int64 {
+	return int64(s.id)
+}
+
+// IsReadOnly reports whether the stream is read-only
+// (a unidirectional stream created by the peer).
+func (s *Stream) IsReadOnly() bool {
+	return !s.hasSend()
+}
+
+// IsWriteOnly reports whether the stream is write-only
+// (a unidirectional stream created locally).
+func (s *Stream) IsWriteOnly() bool {
+	return !s.hasRecv()
+}
+
+// SetReadContext sets the context used when reading from the stream.
+//
+// It is not safe to call SetReadContext concurrently.
+func (s *Stream) SetReadContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	s.inctx = ctx
+	s.conn.mu.Unlock()
+}
+
+// SetWriteContext sets the context used when writing to the stream.
+// The write context is also used by Close when waiting for writes to be
+// received by the peer.
+//
+// It is not safe to call SetWriteContext concurrently.
+func (s *Stream) SetWriteContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	s.outctx = ctx
+	s.conn.mu.Unlock()
+}
+
+// Read reads data from the stream.
+//
+// Read returns as soon as at least one byte of data is available.
+//
+// If the peer closes the stream cleanly, Read returns io.EOF after
+// returning all data sent by the peer.
+// If the peer resets the stream, Read returns the peer's StreamErrorCode.
+func (s *Stream) Read(b []byte) (n int, err error) {
+	if !s.hasRecv() {
+		return 0, errSendOnly
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.waitLocked(s.inctx, s.readableLocked)
+	switch {
+	case s.inresetcode >= 0:
+		return 0, StreamErrorCode(s.inresetcode)
+	case s.inclosed.isSet():
+		return 0, errReadClosed
+	case err != nil:
+		return 0, err
+	case s.in.start == s.insize:
+		return 0, io.EOF
+	}
+	avail := s.inset[0].end - s.in.start
+	n = int(min64(avail, int64(len(b))))
+	s.in.copy(s.in.start, b[:n])
+	s.in.discardBefore(s.in.start + int64(n))
+	s.creditTo(s.in.start)
+	if s.insize < 0 && s.in.start+s.inmaxbuf-s.inwin >= s.inmaxbuf/2 {
+		// Extend the peer's flow control window.
+		s.insendmax.setUnsent()
+		c.streams.queueSend(s)
+	}
+	c.streams.maybeRemove(s)
+	c.wake()
+	return n, nil
+}
+
+// readableLocked reports whether Read can return without blocking.
+func (s *Stream) readableLocked() bool {
+	if s.inresetcode >= 0 || s.inclosed.isSet() || s.in.start == s.insize {
+		return true
+	}
+	return len(s.inset) > 0 && s.inset[0].start <= s.in.start && s.inset[0].end > s.in.start
+}
+
+// creditTo returns the flow control credit for data up to off
+// to the connection.
+func (s *Stream) creditTo(off int64) {
+	if off > s.incredit {
+		s.conn.streams.inflowConsumed(off - s.incredit)
+		s.incredit = off
+	}
+}
+
+// Write writes data to the stream.
+//
+// Write copies data into the stream's send buffer, blocking while the
+// buffer is full. Buffered data is sent as flow control permits.
+//
+// If the peer aborts reads on the stream, Write returns
+// the peer's StreamErrorCode.
+func (s *Stream) Write(b []byte) (n int, err error) {
+	if !s.hasSend() {
+		return 0, errReceiveOnly
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		switch {
+		case s.outstopped:
+			return n, StreamErrorCode(s.outresetcode)
+		case s.outreset.isSet():
+			return n, errStreamReset
+		case s.outclosed.isSet():
+			return n, errWriteClosed
+		case len(b) == 0:
+			return n, nil
+		}
+		err := c.waitLocked(s.outctx, func() bool {
+			return s.outreset.isSet() || s.out.end()-s.out.start < s.outmaxbuf
+		})
+		if err != nil {
+			return n, err
+		}
+		if s.outreset.isSet() {
+			continue
+		}
+		size := min64(s.outmaxbuf-(s.out.end()-s.out.start), int64(len(b)))
+		off := s.out.end()
+		s.out.writeAt(b[:size], off)
+		s.outunsent.add(off, off+size)
+		b = b[size:]
+		n += int(size)
+		c.streams.queueSend(s)
+		c.wake()
+	}
+}
+
+// Close closes the stream.
+// Any blocked stream operations will be unblocked and return errors.
+//
+// Close flushes any data in the stream write buffer and waits for the peer to
+// acknowledge receipt of the data.
+// If the context expires before the peer receives the stream's data,
+// Close discards the buffer and returns the context error.
+func (s *Stream) Close() error {
+	s.CloseRead()
+	if !s.hasSend() {
+		return nil
+	}
+	s.CloseWrite()
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.waitLocked(s.outctx, func() bool {
+		return s.sendDone() || s.outreset.isSet()
+	})
+	if err != nil {
+		s.resetLocked(0)
+		c.wake()
+		return err
+	}
+	if s.outstopped {
+		return StreamErrorCode(s.outresetcode)
+	}
+	return nil
+}
+
+// CloseRead aborts reads on the stream.
+// Any blocked reads will be unblocked and return errors.
+//
+// CloseRead notifies the peer that the stream has been closed for reading.
+// It does not wait for the peer to acknowledge the closure.
+// Use Close to wait for the peer's acknowledgement.
+func (s *Stream) CloseRead() {
+	if !s.hasRecv() {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.inclosed.isSet() {
+		return
+	}
+	if s.inresetcode >= 0 || s.in.start == s.insize {
+		// Nothing more will arrive; there is no need to tell the peer.
+		s.inclosed.setReceived()
+	} else {
+		s.inclosed.setUnsent()
+		s.insendmax.clear()
+		c.streams.queueSend(s)
+	}
+	// Discard buffered data and return its flow control credit.
+	end := s.inset.end()
+	s.creditTo(end)
+	s.in.discardBefore(end)
+	c.streams.maybeRemove(s)
+	c.notifyLocked()
+	c.wake()
+}
+
+// CloseWrite aborts writes on the stream.
+// Any blocked writes will be unblocked and return errors.
+//
+// CloseWrite sends any data in the stream write buffer to the peer.
+// It does not wait for the peer to acknowledge receipt of the data.
+// Use Close to wait for the peer's acknowledgement.
+func (s *Stream) CloseWrite() {
+	if !s.hasSend() {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.outclosed.isSet() || s.outreset.isSet() {
+		return
+	}
+	s.outclosed.setUnsent()
+	c.streams.queueSend(s)
+	c.notifyLocked()
+	c.wake()
+}
+
+// Reset aborts writes on the stream and notifies the peer
+// that the stream was terminated abruptly.
+// Any blocked writes will be unblocked and return errors.
+//
+// Reset sends the application protocol error code, which must be
+// less than 2^62, to the peer.
+// It does not wait for the peer to acknowledge receipt of the error.
+// Use Close to wait for the peer's acknowledgement.
+//
+// Reset does not affect reads.
+// Use CloseRead to abort reads on the stream.
+func (s *Stream) Reset(code uint64) {
+	if !s.hasSend() {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.resetLocked(code)
+	c.notifyLocked()
+	c.wake()
+}
+
+func (s *Stream) resetLocked(code uint64) {
+	if s.outreset.isSet() || s.sendDone() {
+		return
+	}
+	s.outreset.setUnsent()
+	s.outresetcode = code
+	s.out.discardBefore(s.out.end())
+	s.outunsent = nil
+	s.conn.streams.queueSend(s)
+}
+
+// sendDone reports whether the send side of the stream is complete:
+// All data and the FIN have been acknowledged, or a reset has been acknowledged.
+func (s *Stream) sendDone() bool {
+	if !s.hasSend() || s.outreset.isReceived() {
+		return true
+	}
+	return s.outclosed.isReceived() && s.outacked.isrange(0, s.out.end())
+}
+
+// recvDone reports whether the receive side of the stream is complete:
+// The peer has reset the stream, or the final size is known and the reader
+// has consumed or discarded all data.
+func (s *Stream) recvDone() bool {
+	if !s.hasRecv() || s.inresetcode >= 0 {
+		return true
+	}
+	return s.insize >= 0 && (s.in.start == s.insize || s.inclosed.isSet())
+}
+
+// wantsSend reports whether the stream has frames to send.
+func (s *Stream) wantsSend() bool {
+	if s.inclosed.shouldSend() || s.insendmax.shouldSend() {
+		return true
+	}
+	if s.outreset.isSet() {
+		return s.outreset.shouldSend()
+	}
+	return len(s.outunsent) > 0 || s.outclosed.shouldSend()
+}
+
+// handleData handles data received in a STREAM frame.
+func (s *Stream) handleData(off int64, b []byte, fin bool) error {
+	end := off + int64(len(b))
+	if end > s.inwin {
+		return localTransportError{
+			code:   errFlowControl,
+			reason: "stream flow control window exceeded",
+		}
+	}
+	if s.insize >= 0 && end > s.insize {
+		return localTransportError{
+			code:   errFinalSize,
+			reason: "data received past end of stream",
+		}
+	}
+	if fin {
+		if (s.insize >= 0 && end != s.insize) || end < s.inset.end() {
+			return localTransportError{
+				code:   errFinalSize,
+				reason: "final size of stream changed",
+			}
+		}
+		s.insize = end
+		s.insendmax.clear()
+	}
+	if s.inresetcode >= 0 {
+		// Data received after a reset has already been accounted for.
+		return nil
+	}
+	if err := s.conn.streams.inflowReceived(s.inset.end(), end); err != nil {
+		return err
+	}
+	if len(b) > 0 {
+		s.inset.add(off, end)
+		if s.inclosed.isSet() {
+			s.creditTo(s.inset.end())
+		} else {
+			s.in.writeAt(b, off)
+		}
+	}
+	s.conn.streams.maybeRemove(s)
+	return nil
+}
+
+// handleReset handles a RESET_STREAM frame.
+func (s *Stream) handleReset(code uint64, finalSize int64) error {
+	if (s.insize >= 0 && finalSize != s.insize) || finalSize < s.inset.end() {
+		return localTransportError{
+			code:   errFinalSize,
+			reason: "final size of stream changed",
+		}
+	}
+	if finalSize > s.inwin {
+		return localTransportError{
+			code:   errFlowControl,
+			reason: "stream flow control window exceeded",
+		}
+	}
+	if s.inresetcode >= 0 {
+		return nil
+	}
+	if err := s.conn.streams.inflowReceived(s.inset.end(), finalSize); err != nil {
+		return err
+	}
+	s.insize = finalSize
+	s.inresetcode = int64(code)
+	s.in.discardBefore(s.in.end())
+	s.creditTo(finalSize)
+	s.insendmax.clear()
+	if s.inclosed.shouldSend() {
+		// The peer has already stopped sending.
+		s.inclosed.setReceived()
+	}
+	s.conn.streams.maybeRemove(s)
+	return nil
+}
+
+// handleStopSending handles a STOP_SENDING frame.
+func (s *Stream) handleStopSending(code uint64) {
+	// "An endpoint that receives a STOP_SENDING frame MUST send a RESET_STREAM
+	// frame if the stream is in the "Ready" or "Send" state."
+	// https://www.rfc-editor.org/rfc/rfc9000#section-3.5-4
+	if s.outreset.isSet() || s.sendDone() {
+		return
+	}
+	s.resetLocked(code)
+	s.outstopped = true
+}
+
+// handleMaxStreamData handles a MAX_STREAM_DATA frame.
+func (s *Stream) handleMaxStreamData(max int64) {
+	if max > s.outwin {
+		s.outwin = max
+		if len(s.outunsent) > 0 {
+			s.conn.streams.queueSend(s)
+		}
+	}
+}
+
+// ackOrLossData handles the fate of a STREAM frame.
+func (s *Stream) ackOrLossData(pnum packetNumber, start, end int64, fin bool, fate packetFate) {
+	if fin {
+		s.outclosed.ackOrLoss(pnum, fate)
+	}
+	if s.outreset.isSet() {
+		// The stream's data has been discarded.
+		return
+	}
+	switch fate {
+	case packetAcked:
+		s.outacked.add(start, end)
+		s.outunsent.sub(start, end)
+		// If this ack is for data at the start of the send buffer, we can now discard it.
+		if s.outacked.contains(s.out.start) {
+			s.out.discardBefore(s.outacked[0].end)
+		}
+	case packetLost:
+		// Mark everything lost, but not previously acked, as needing retransmission.
+		s.outunsent.add(start, end)
+		for _, a := range s.outacked {
+			s.outunsent.sub(a.start, a.end)
+		}
+	}
+}
+
+// appendFrames appends the stream's pending frames to the current packet.
+//
+// It returns true if no more frames need appending,
+// false if not everything fit in the current packet.
+func (s *Stream) appendFrames(w *packetWriter, pnum packetNumber, pto bool) bool {
+	if s.inclosed.shouldSendPTO(pto) {
+		// We don't currently have an API for setting the error code.
+		// Just send zero.
+		if !w.appendStopSendingFrame(s.id, 0) {
+			return false
+		}
+		s.inclosed.setSent(pnum)
+	}
+	if s.insendmax.shouldSendPTO(pto) {
+		s.inwin = max64(s.inwin, s.in.start+s.inmaxbuf)
+		if !w.appendMaxStreamDataFrame(s.id, s.inwin) {
+			return false
+		}
+		s.insendmax.setSent(pnum)
+	}
+	if s.outreset.isSet() {
+		if s.outreset.shouldSendPTO(pto) {
+			if !w.appendResetStreamFrame(s.id, s.outresetcode, s.outmaxsent) {
+				return false
+			}
+			s.outreset.setSent(pnum)
+		}
+		return true
+	}
+	ss := &s.conn.streams
+	for {
+		off, size := dataToSend(s.out.start, s.out.end(), s.outunsent, s.outacked, false)
+		if end := off + size; end > s.outmaxsent {
+			// New data is limited by stream and connection flow control.
+			limit := min64(s.outwin, s.outmaxsent+ss.outflowAvail())
+			if end > limit {
+				size = max64(0, limit-off)
+			}
+		}
+		fin := s.outclosed.shouldSendPTO(pto) && off+size == s.out.end()
+		if size == 0 && !fin {
+			return true
+		}
+		b, added := w.appendStreamFrame(s.id, off, int(size), fin)
+		if !added {
+			return false
+		}
+		s.out.copy(off, b)
+		end := off + int64(len(b))
+		s.outunsent.sub(off, end)
+		if end > s.outmaxsent {
+			ss.outflowSent(end - s.outmaxsent)
+			s.outmaxsent = end
+		}
+		if int64(len(b)) < size {
+			return false
+		}
+		if fin {
+			s.outclosed.setSent(pnum)
+			return true
+		}
+	}
+}
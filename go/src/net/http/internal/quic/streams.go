@@ -0,0 +1,473 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+)
+
+// A streamID is a QUIC stream ID.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-2.1
+type streamID uint64
+
+// A streamType is the type of a stream: bidirectional or unidirectional.
+type streamType uint8
+
+const (
+	bidiStream = streamType(iota)
+	uniStream
+	streamTypeCount
+)
+
+// maxStreamsLimit is the maximum number of streams of a type which may be opened.
+// https://www.rfc-editor.org/rfc/rfc9000.html#section-4.6-2
+const maxStreamsLimit = 1 << 60
+
+func newStreamID(initiator connSide, typ streamType, num int64) streamID {
+	id := streamID(num << 2)
+	if typ == uniStream {
+		id |= 2
+	}
+	if initiator == serverSide {
+		id |= 1
+	}
+	return id
+}
+
+func (s streamID) initiator() connSide {
+	if s&1 != 0 {
+		return serverSide
+	}
+	return clientSide
+}
+
+func (s streamID) num() int64 {
+	return int64(s) >> 2
+}
+
+func (s streamID) streamType() streamType {
+	if s&2 != 0 {
+		return uniStream
+	}
+	return bidiStream
+}
+
+// streamsState is the state of a connection's streams.
+// It is guarded by the Conn's mutex.
+type streamsState struct {
+	c *Conn
+
+	streams map[streamID]*Stream
+
+	// Limits on the number of streams, indexed by streamType.
+	localLimit  [streamTypeCount]localStreamLimits
+	remoteLimit [streamTypeCount]remoteStreamLimits
+
+	// Peer-created streams waiting to be accepted.
+	queue []*Stream
+
+	// Connection-level flow control.
+	inflow  connInflow
+	outflow connOutflow
+
+	// Streams with frames to send, in round-robin order.
+	sendq []*Stream
+
+	// Peer's initial limits on stream data.
+	peerInitialMaxStreamDataBidiLocal  int64 // streams opened by the peer
+	peerInitialMaxStreamDataBidiRemote int64 // streams opened by us
+	peerInitialMaxStreamDataUni        int64
+}
+
+// localStreamLimits are limits on the number of streams we may open.
+type localStreamLimits struct {
+	opened int64 // number of streams opened
+	max    int64 // peer's MAX_STREAMS
+}
+
+// remoteStreamLimits are limits on the number of streams the peer may open.
+type remoteStreamLimits struct {
+	opened  int64   // number of streams opened by the peer
+	closed  int64   // number of peer streams which have been removed
+	max     int64   // MAX_STREAMS limit
+	limit   int64   // configured number of simultaneous streams
+	sendMax sentVal // set when we should send MAX_STREAMS
+}
+
+// connInflow is connection-level flow control for data sent by the peer.
+type connInflow struct {
+	window   int64   // configured window size
+	max      int64   // last MAX_DATA sent to the peer
+	used     int64   // sum of largest offsets received on each stream
+	consumed int64   // data read or discarded by the application
+	sendMax  sentVal // set when we should send MAX_DATA
+}
+
+// connOutflow is connection-level flow control for data sent by us.
+type connOutflow struct {
+	max  int64 // peer's MAX_DATA
+	used int64 // sum of largest offsets sent on each stream
+}
+
+func (ss *streamsState) init(c *Conn) {
+	ss.c = c
+	ss.streams = make(map[streamID]*Stream)
+	ss.remoteLimit[bidiStream].limit = c.config.maxBidiRemoteStreams()
+	ss.remoteLimit[uniStream].limit = c.config.maxUniRemoteStreams()
+	for i := range ss.remoteLimit {
+		ss.remoteLimit[i].max = ss.remoteLimit[i].limit
+	}
+	ss.inflow.window = c.config.maxConnReadBufferSize()
+	ss.inflow.max = ss.inflow.window
+}
+
+// peerTransportParameters applies the peer's transport parameters.
+func (ss *streamsState) peerTransportParameters(p transportParameters) {
+	ss.localLimit[bidiStream].max = p.initialMaxStreamsBidi
+	ss.localLimit[uniStream].max = p.initialMaxStreamsUni
+	ss.outflow.max = p.initialMaxData
+	ss.peerInitialMaxStreamDataBidiLocal = p.initialMaxStreamDataBidiLocal
+	ss.peerInitialMaxStreamDataBidiRemote = p.initialMaxStreamDataBidiRemote
+	ss.peerInitialMaxStreamDataUni = p.initialMaxStreamDataUni
+	for _, s := range ss.streams {
+		if s.hasSend() {
+			s.outwin = max64(s.outwin, ss.peerInitialMaxStreamData(s.id))
+		}
+	}
+}
+
+// peerInitialMaxStreamData returns the peer's initial flow control limit
+// for data we send on a stream.
+func (ss *streamsState) peerInitialMaxStreamData(id streamID) int64 {
+	switch {
+	case id.streamType() == uniStream:
+		return ss.peerInitialMaxStreamDataUni
+	case id.initiator() == ss.c.side:
+		return ss.peerInitialMaxStreamDataBidiRemote
+	default:
+		return ss.peerInitialMaxStreamDataBidiLocal
+	}
+}
+
+// connClosed is called when the connection begins to close.
+func (ss *streamsState) connClosed() {
+	for _, s := range ss.sendq {
+		s.inqueue = false
+	}
+	ss.sendq = nil
+}
+
+// NewStream creates a stream.
+//
+// If the peer's maximum stream limit for the connection has been reached,
+// NewStream blocks until the limit is increased or the context expires.
+func (c *Conn) NewStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, bidiStream)
+}
+
+// NewSendOnlyStream creates a unidirectional, send-only stream.
+//
+// If the peer's maximum stream limit for the connection has been reached,
+// NewSendOnlyStream blocks until the limit is increased or the context expires.
+func (c *Conn) NewSendOnlyStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, uniStream)
+}
+
+func (c *Conn) newLocalStream(ctx context.Context, typ streamType) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lim := &c.streams.localLimit[typ]
+	if err := c.waitLocked(ctx, func() bool {
+		return lim.opened < lim.max
+	}); err != nil {
+		return nil, err
+	}
+	id := newStreamID(c.side, typ, lim.opened)
+	lim.opened++
+	s := newStream(c, id)
+	c.streams.streams[id] = s
+	return s, nil
+}
+
+// AcceptStream waits for and returns the next stream created by the peer.
+func (c *Conn) AcceptStream(ctx context.Context) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.waitLocked(ctx, func() bool {
+		return len(c.streams.queue) > 0
+	}); err != nil {
+		return nil, err
+	}
+	s := c.streams.queue[0]
+	c.streams.queue[0] = nil
+	c.streams.queue = c.streams.queue[1:]
+	return s, nil
+}
+
+// streamForFrame returns the stream a frame received from the peer applies to,
+// creating it if necessary.
+// It returns nil if the stream has been closed and discarded.
+func (ss *streamsState) streamForFrame(id streamID, ftype byte) (*Stream, error) {
+	local := id.initiator() == ss.c.side
+	typ := id.streamType()
+	if typ == uniStream {
+		switch ftype {
+		case frameTypeStreamBase, frameTypeResetStream, frameTypeStreamDataBlocked:
+			// Frames sent by the sender of a stream.
+			if local {
+				return nil, localTransportError{
+					code:   errStreamState,
+					reason: "received data-sending frame for send-only stream",
+				}
+			}
+		case frameTypeMaxStreamData, frameTypeStopSending:
+			// Frames sent by the receiver of a stream.
+			if !local {
+				return nil, localTransportError{
+					code:   errStreamState,
+					reason: "received data-receiving frame for receive-only stream",
+				}
+			}
+		}
+	}
+	num := id.num()
+	if local {
+		if num >= ss.localLimit[typ].opened {
+			return nil, localTransportError{
+				code:   errStreamState,
+				reason: "received frame for unopened stream",
+			}
+		}
+		return ss.streams[id], nil
+	}
+	lim := &ss.remoteLimit[typ]
+	if num >= lim.max {
+		return nil, localTransportError{
+			code:   errStreamLimit,
+			reason: "stream limit exceeded",
+		}
+	}
+	// "[...] opening a stream causes all lower-numbered streams of the
+	// same type to be implicitly opened."
+	// https://www.rfc-editor.org/rfc/rfc9000#section-3.2-6
+	for lim.opened <= num {
+		sid := newStreamID(id.initiator(), typ, lim.opened)
+		s := newStream(ss.c, sid)
+		ss.streams[sid] = s
+		ss.queue = append(ss.queue, s)
+		lim.opened++
+	}
+	return ss.streams[id], nil
+}
+
+// handleStreamFrame handles a STREAM frame.
+func (ss *streamsState) handleStreamFrame(id streamID, off int64, fin bool, data []byte) error {
+	s, err := ss.streamForFrame(id, frameTypeStreamBase)
+	if s == nil || err != nil {
+		return err
+	}
+	return s.handleData(off, data, fin)
+}
+
+// handleResetStreamFrame handles a RESET_STREAM frame.
+func (ss *streamsState) handleResetStreamFrame(id streamID, code uint64, finalSize int64) error {
+	s, err := ss.streamForFrame(id, frameTypeResetStream)
+	if s == nil || err != nil {
+		return err
+	}
+	return s.handleReset(code, finalSize)
+}
+
+// handleStopSendingFrame handles a STOP_SENDING frame.
+func (ss *streamsState) handleStopSendingFrame(id streamID, code uint64) error {
+	s, err := ss.streamForFrame(id, frameTypeStopSending)
+	if s == nil || err != nil {
+		return err
+	}
+	s.handleStopSending(code)
+	return nil
+}
+
+// handleMaxStreamDataFrame handles a MAX_STREAM_DATA frame.
+func (ss *streamsState) handleMaxStreamDataFrame(id streamID, max int64) error {
+	s, err := ss.streamForFrame(id, frameTypeMaxStreamData)
+	if s == nil || err != nil {
+		return err
+	}
+	s.handleMaxStreamData(max)
+	return nil
+}
+
+// handleStreamDataBlockedFrame handles a STREAM_DATA_BLOCKED frame.
+func (ss *streamsState) handleStreamDataBlockedFrame(id streamID) error {
+	// We don't need to do anything in response to STREAM_DATA_BLOCKED,
+	// but the stream ID must be valid.
+	_, err := ss.streamForFrame(id, frameTypeStreamDataBlocked)
+	return err
+}
+
+// handleMaxDataFrame handles a MAX_DATA frame.
+func (ss *streamsState) handleMaxDataFrame(max int64) {
+	if max <= ss.outflow.max {
+		return
+	}
+	ss.outflow.max = max
+	// Streams may have been blocked by connection-level flow control.
+	for _, s := range ss.streams {
+		if len(s.outunsent) > 0 {
+			ss.queueSend(s)
+		}
+	}
+}
+
+// handleMaxStreamsFrame handles a MAX_STREAMS frame.
+func (ss *streamsState) handleMaxStreamsFrame(typ streamType, max int64) {
+	if max > ss.localLimit[typ].max {
+		ss.localLimit[typ].max = max
+	}
+}
+
+// inflowReceived records the receipt of stream data from offset prevEnd to end,
+// where prevEnd is the previous largest offset received on the stream.
+func (ss *streamsState) inflowReceived(prevEnd, end int64) error {
+	if end <= prevEnd {
+		return nil
+	}
+	ss.inflow.used += end - prevEnd
+	if ss.inflow.used > ss.inflow.max {
+		return localTransportError{
+			code:   errFlowControl,
+			reason: "connection flow control window exceeded",
+		}
+	}
+	return nil
+}
+
+// inflowConsumed records that n bytes of stream data have been read
+// or discarded by the application.
+func (ss *streamsState) inflowConsumed(n int64) {
+	ss.inflow.consumed += n
+	if ss.inflow.consumed+ss.inflow.window-ss.inflow.max >= ss.inflow.window/2 {
+		ss.inflow.sendMax.setUnsent()
+	}
+}
+
+// outflowAvail returns the amount of new stream data connection-level
+// flow control permits us to send.
+func (ss *streamsState) outflowAvail() int64 {
+	return ss.outflow.max - ss.outflow.used
+}
+
+// outflowSent records the sending of n bytes of new stream data.
+func (ss *streamsState) outflowSent(n int64) {
+	ss.outflow.used += n
+}
+
+// queueSend adds a stream to the send queue.
+func (ss *streamsState) queueSend(s *Stream) {
+	if s.inqueue || s.removed || ss.c.lifetime.state != connStateAlive {
+		return
+	}
+	s.inqueue = true
+	ss.sendq = append(ss.sendq, s)
+}
+
+// maybeRemove removes a stream from the stream map once both of its sides
+// are complete. Removing a peer-created stream permits the peer to open another.
+func (ss *streamsState) maybeRemove(s *Stream) {
+	if s.removed || !s.sendDone() || !s.recvDone() {
+		return
+	}
+	if s.hasRecv() {
+		// Return credit for any data the peer sent that we never received.
+		s.creditTo(s.insize)
+	}
+	s.removed = true
+	delete(ss.streams, s.id)
+	if s.id.initiator() == ss.c.side {
+		return
+	}
+	lim := &ss.remoteLimit[s.id.streamType()]
+	lim.closed++
+	// Raise the peer's limit once a reasonable number of streams have closed,
+	// rather than sending MAX_STREAMS every time a stream is closed.
+	if newMax := lim.closed + lim.limit; newMax-lim.max >= max64(1, lim.limit/8) {
+		lim.max = newMax
+		lim.sendMax.setUnsent()
+	}
+}
+
+// ackOrLoss handles the fate of a stream-related frame.
+func (ss *streamsState) ackOrLoss(pnum packetNumber, f sentFrame, fate packetFate) {
+	switch f.typ {
+	case frameTypeMaxData:
+		ss.inflow.sendMax.ackLatestOrLoss(pnum, fate)
+		return
+	case frameTypeMaxStreamsBidi:
+		ss.remoteLimit[bidiStream].sendMax.ackLatestOrLoss(pnum, fate)
+		return
+	case frameTypeMaxStreamsUni:
+		ss.remoteLimit[uniStream].sendMax.ackLatestOrLoss(pnum, fate)
+		return
+	}
+	s := ss.streams[f.id]
+	if s == nil {
+		return
+	}
+	switch f.typ {
+	case frameTypeStreamBase:
+		s.ackOrLossData(pnum, f.start, f.end, f.fin, fate)
+	case frameTypeResetStream:
+		s.outreset.ackLatestOrLoss(pnum, fate)
+	case frameTypeStopSending:
+		s.inclosed.ackLatestOrLoss(pnum, fate)
+	case frameTypeMaxStreamData:
+		s.insendmax.ackLatestOrLoss(pnum, fate)
+	}
+	if fate == packetLost && s.wantsSend() {
+		ss.queueSend(s)
+	}
+	ss.maybeRemove(s)
+}
+
+// appendFrames appends stream-related frames to the current packet.
+//
+// It returns true if no more frames need appending,
+// false if not everything fit in the current packet.
+func (ss *streamsState) appendFrames(w *packetWriter, pnum packetNumber, pto bool) bool {
+	if ss.inflow.sendMax.shouldSendPTO(pto) {
+		ss.inflow.max = max64(ss.inflow.max, ss.inflow.consumed+ss.inflow.window)
+		if !w.appendMaxDataFrame(ss.inflow.max) {
+			return false
+		}
+		ss.inflow.sendMax.setSent(pnum)
+	}
+	for typ := range ss.remoteLimit {
+		lim := &ss.remoteLimit[typ]
+		if lim.sendMax.shouldSendPTO(pto) {
+			if !w.appendMaxStreamsFrame(streamType(typ), lim.max) {
+				return false
+			}
+			lim.sendMax.setSent(pnum)
+		}
+	}
+	// Visit each queued stream at most once, moving it to the back of the queue
+	// if it still has frames to send, so that streams share the connection fairly.
+	for n := len(ss.sendq); n > 0; n-- {
+		s := ss.sendq[0]
+		ss.sendq[0] = nil
+		ss.sendq = ss.sendq[1:]
+		ok := s.appendFrames(w, pnum, pto)
+		if s.wantsSend() {
+			ss.sendq = append(ss.sendq, s)
+		} else {
+			s.inqueue = false
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
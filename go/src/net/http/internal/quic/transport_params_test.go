@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransportParametersRoundTrip(t *testing.T) {
+	want := defaultTransportParameters()
+	want.originalDstConnID = []byte{1, 2, 3, 4}
+	want.maxIdleTimeout = 30 * time.Second
+	want.statelessResetToken = make([]byte, 16)
+	want.maxUDPPayloadSize = 1500
+	want.initialMaxData = 1 << 20
+	want.initialMaxStreamDataBidiLocal = 1 << 16
+	want.initialMaxStreamDataBidiRemote = 1 << 17
+	want.initialMaxStreamDataUni = 1 << 18
+	want.initialMaxStreamsBidi = 100
+	want.initialMaxStreamsUni = 3
+	want.ackDelayExponent = 5
+	want.maxAckDelay = 20 * time.Millisecond
+	want.disableActiveMigration = true
+	want.activeConnIDLimit = 4
+	want.initialSrcConnID = []byte{5, 6, 7, 8}
+	want.retrySrcConnID = []byte{9}
+
+	got, err := unmarshalTransportParams(marshalTransportParams(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTransportParametersErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		b    []byte
+	}{
+		{"truncated id", []byte{0x40}},
+		{"truncated value", []byte{paramInitialMaxData, 4, 0}},
+		{"duplicate", []byte{paramInitialMaxData, 1, 0, paramInitialMaxData, 1, 0}},
+		{"ack_delay_exponent too large", []byte{paramAckDelayExponent, 1, 21}},
+		{"max_ack_delay too large", []byte{paramMaxAckDelay, 4, 0x80, 0x00, 0x40, 0x00}},
+		{"max_udp_payload_size too small", []byte{paramMaxUDPPayloadSize, 2, 0x44, 0xaf}},
+		{"active_connection_id_limit too small", []byte{paramActiveConnectionIDLimit, 1, 1}},
+		{"bad stateless_reset_token", []byte{paramStatelessResetToken, 1, 0}},
+	} {
+		if _, err := unmarshalTransportParams(test.b); err == nil {
+			t.Errorf("%v: unmarshalTransportParams(%x) succeeded, want error", test.desc, test.b)
+		}
+	}
+}
+
+func TestTransportParametersIgnoreUnknown(t *testing.T) {
+	b := marshalTransportParams(defaultTransportParameters())
+	b = appendVarint(b, 0x1f*7+27) // reserved for greasing
+	b = appendVarintBytes(b, []byte{1, 2, 3})
+	got, err := unmarshalTransportParams(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := defaultTransportParameters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConsumeVarint(t *testing.T) {
+	for _, test := range []struct {
+		b       []byte
+		want    uint64
+		wantLen int
+	}{
+		// Sample values from RFC 9000, Appendix A.1.
+		{[]byte{0xc2, 0x19, 0x7c, 0x5e, 0xff, 0x14, 0xe8, 0x8c}, 151288809941952652, 8},
+		{[]byte{0x9d, 0x7f, 0x3e, 0x7d}, 494878333, 4},
+		{[]byte{0x7b, 0xbd}, 15293, 2},
+		{[]byte{0x25}, 37, 1},
+		{[]byte{0x40, 0x25}, 37, 2},
+		// Truncated values.
+		{[]byte{}, 0, -1},
+		{[]byte{0x40}, 0, -1},
+		{[]byte{0x80, 0x00, 0x00}, 0, -1},
+		{[]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 0, -1},
+	} {
+		got, n := consumeVarint(test.b)
+		if got != test.want || n != test.wantLen {
+			t.Errorf("consumeVarint(%x) = %v, %v; want %v, %v", test.b, got, n, test.want, test.wantLen)
+		}
+	}
+}
+
+func TestAppendVarint(t *testing.T) {
+	for _, v := range []uint64{
+		0, 63, 64, 16383, 16384, 1073741823, 1073741824, maxVarint,
+	} {
+		b := appendVarint(nil, v)
+		if len(b) != sizeVarint(v) {
+			t.Errorf("appendVarint(%v) is %v bytes, sizeVarint = %v", v, len(b), sizeVarint(v))
+		}
+		got, n := consumeVarint(b)
+		if got != v || n != len(b) {
+			t.Errorf("consumeVarint(appendVarint(%v)) = %v, %v; want %v, %v", v, got, n, v, len(b))
+		}
+	}
+}
+
+func TestVarintBytes(t *testing.T) {
+	v := []byte("hello")
+	b := appendVarintBytes(nil, v)
+	got, n := consumeVarintBytes(b)
+	if !bytes.Equal(got, v) || n != len(b) {
+		t.Errorf("consumeVarintBytes(%x) = %q, %v; want %q, %v", b, got, n, v, len(b))
+	}
+	if _, n := consumeVarintBytes(b[:len(b)-1]); n >= 0 {
+		t.Errorf("consumeVarintBytes(truncated) = %v, want error", n)
+	}
+
+	b = appendUint8Bytes(nil, v)
+	got, n = consumeUint8Bytes(b)
+	if !bytes.Equal(got, v) || n != len(b) {
+		t.Errorf("consumeUint8Bytes(%x) = %q, %v; want %q, %v", b, got, n, v, len(b))
+	}
+	if _, n := consumeUint8Bytes(b[:len(b)-1]); n >= 0 {
+		t.Errorf("consumeUint8Bytes(truncated) = %v, want error", n)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRoutingFirstSegment(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+	}{
+		{"/a/b/c", []string{"a", "b", "c"}},
+		{"/a/b/", []string{"a", "b", "/"}},
+		{"/", []string{"/"}},
+		{"/a/%62/c", []string{"a", "b", "c"}},
+		{"/a%2Fb%2fc", []string{"a/b/c"}},
+	} {
+		var got []string
+		rest := test.in
+		for len(rest) > 0 {
+			var seg string
+			seg, rest = firstSegment(rest)
+			got = append(got, seg)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func getTestTree(tb testing.TB) *routingNode {
+	root := &routingNode{}
+	for _, p := range []string{
+		"/a",
+		"/a/b",
+		"/a/{x}",
+		"/g/h/i",
+		"/g/{x}/j",
+		"/a/b/{x...}",
+		"/a/b/{y}",
+		"/a/b/{$}",
+		"GET /h/",
+		"GET /h/{x}",
+		"POST /a/b",
+		"example.com/",
+		"example.com/a",
+		"example.com/a/{x}",
+	} {
+		root.addPattern(mustParsePattern(tb, p), nil)
+	}
+	return root
+}
+
+func TestRoutingNodeMatch(t *testing.T) {
+	type testCase struct {
+		method, host, path string
+		wantPat            string // "" for nil (no match)
+		wantMatches        []string
+	}
+
+	test := func(tree *routingNode, tests []testCase) {
+		t.Helper()
+		for _, test := range tests {
+			gotNode, gotMatches := tree.match(test.host, test.method, test.path)
+			got := ""
+			if gotNode != nil {
+				got = gotNode.pattern.String()
+			}
+			if got != test.wantPat {
+				t.Errorf("%s, %s, %s: got %q, want %q", test.host, test.method, test.path, got, test.wantPat)
+			}
+			if !reflect.DeepEqual(gotMatches, test.wantMatches) {
+				t.Errorf("%s, %s, %s: got matches %v, want %v", test.host, test.method, test.path, gotMatches, test.wantMatches)
+			}
+		}
+	}
+
+	test(getTestTree(t), []testCase{
+		{"GET", "", "/a", "/a", nil},
+		{"Get", "", "/b", "", nil},
+		{"Get", "", "/a/b", "/a/b", nil},
+		{"Get", "", "/a/c", "/a/{x}", []string{"c"}},
+		{"Get", "", "/a/b/", "/a/b/{$}", nil},
+		{"Get", "", "/a/b/c", "/a/b/{y}", []string{"c"}},
+		{"Get", "", "/a/b/c/d", "/a/b/{x...}", []string{"c/d"}},
+		{"Get", "", "/g/h/i", "/g/h/i", nil},
+		{"Get", "", "/g/h/j", "/g/{x}/j", []string{"h"}},
+		{"Get", "", "/g/h/k", "", nil},
+		{"Get", "", "/a%2Fb", "", nil},
+		{"GET", "", "/h/a%2Fb", "GET /h/{x}", []string{"a/b"}},
+		{"GET", "", "/h/", "GET /h/", nil},
+		{"GET", "", "/h/b", "GET /h/{x}", []string{"b"}},
+		{"HEAD", "", "/h/b", "GET /h/{x}", []string{"b"}},
+		{"GET", "", "/h/b/c", "GET /h/", nil},
+		{"POST", "", "/h/b", "", nil},
+		{"POST", "", "/a/b", "POST /a/b", nil},
+		{"GET", "", "/a/b", "/a/b", nil},
+		{"GET", "example.com", "/a", "example.com/a", nil},
+		{"GET", "example.com", "/a/b", "example.com/a/{x}", []string{"b"}},
+		{"GET", "example.com", "/b", "example.com/", nil},
+		{"GET", "example.com", "/a/b/c", "example.com/", nil},
+		{"GET", "other.com", "/a/b/c", "/a/b/{y}", []string{"c"}},
+	})
+}
+
+func TestMatchingMethods(t *testing.T) {
+	hostTree := &routingNode{}
+	for _, p := range []string{"GET a.com/", "PUT b.com/", "POST /foo/{x}"} {
+		hostTree.addPattern(mustParsePattern(t, p), nil)
+	}
+	for _, test := range []struct {
+		name       string
+		tree       *routingNode
+		host, path string
+		want       string
+	}{
+		{
+			"post",
+			getTestTree(t),
+			"", "/a/b",
+			"POST",
+		},
+		{
+			"get",
+			getTestTree(t),
+			"", "/h/b",
+			"GET,HEAD",
+		},
+		{
+			"host",
+			hostTree,
+			"", "/a",
+			"",
+		},
+		{
+			"host",
+			hostTree,
+			"", "/foo/bar",
+			"POST",
+		},
+		{
+			"host2",
+			hostTree,
+			"a.com", "/foo/bar",
+			"GET,HEAD,POST",
+		},
+		{
+			"host3",
+			hostTree,
+			"b.com", "/bar",
+			"PUT",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ms := map[string]bool{}
+			test.tree.matchingMethods(test.host, test.path, ms)
+			keys := make([]string, 0, len(ms))
+			for k := range ms {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			got := ""
+			for i, k := range keys {
+				if i > 0 {
+					got += ","
+				}
+				got += k
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -398,6 +398,136 @@ func TestServeMuxHandleFuncWithNilHandler(t *testing.T) {
 	mux.HandleFunc("/", nil)
 }
 
+func TestServeMuxMethodAndWildcardPatterns(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w ResponseWriter, r *Request) {
+		w.Header().Set("Result", "get "+r.PathValue("id"))
+	})
+	mux.HandleFunc("POST /users/{id}", func(w ResponseWriter, r *Request) {
+		w.Header().Set("Result", "post "+r.PathValue("id"))
+	})
+	mux.HandleFunc("/files/{path...}", func(w ResponseWriter, r *Request) {
+		w.Header().Set("Result", "files "+r.PathValue("path"))
+	})
+	mux.HandleFunc("/{$}", func(w ResponseWriter, r *Request) {
+		w.Header().Set("Result", "root")
+	})
+	for _, tt := range []struct {
+		method, path string
+		code         int
+		want         string // Result header
+		allow        string // Allow header
+	}{
+		{"GET", "/users/42", 200, "get 42", ""},
+		{"HEAD", "/users/42", 200, "get 42", ""},
+		{"POST", "/users/42", 200, "post 42", ""},
+		{"DELETE", "/users/42", 405, "", "GET, HEAD, POST"},
+		{"GET", "/users/42/x", 404, "", ""},
+		{"GET", "/files/a/b/c", 200, "files a/b/c", ""},
+		{"GET", "/files/a%2Fb", 200, "files a/b", ""},
+		{"GET", "/files", 301, "", ""},
+		{"GET", "/", 200, "root", ""},
+		{"GET", "/other", 404, "", ""},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: code = %d; want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if got := w.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s %s: Result = %q; want %q", tt.method, tt.path, got, tt.want)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow = %q; want %q", tt.method, tt.path, got, tt.allow)
+		}
+	}
+}
+
+func TestServeMuxPatternPrecedence(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	for _, p := range []string{
+		"/",
+		"/images/",
+		"/images/thumbnails/",
+		"GET /images/{name}",
+		"example.com/images/",
+	} {
+		p := p
+		mux.HandleFunc(p, func(w ResponseWriter, r *Request) {})
+	}
+	for _, tt := range []struct {
+		method, host, path string
+		want               string
+	}{
+		{"GET", "x.com", "/a", "/"},
+		{"GET", "x.com", "/images/a.png", "GET /images/{name}"},
+		{"POST", "x.com", "/images/a.png", "/images/"},
+		{"GET", "x.com", "/images/thumbnails/a.png", "/images/thumbnails/"},
+		{"GET", "example.com", "/images/a.png", "example.com/images/"},
+	} {
+		r := &Request{Method: tt.method, Host: tt.host, URL: &url.URL{Path: tt.path}}
+		if _, got := mux.Handler(r); got != tt.want {
+			t.Errorf("%s %s%s: pattern = %q; want %q", tt.method, tt.host, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestServeMuxRegistrationConflict(t *testing.T) {
+	setParallel(t)
+	for _, tt := range []struct {
+		p1, p2 string
+		want   string // substring of the panic value; "" means no panic
+	}{
+		{"/a", "/a", "matches the same requests"},
+		{"/a/{x}", "/a/{y}", "matches the same requests"},
+		{"/a/{x}", "/{y}/b", "both match some paths"},
+		{"GET /", "/index.html", "has a more specific path pattern"},
+		{"/a/{x}", "/a/b", ""},
+		{"GET /a", "POST /a", ""},
+		{"/a", "example.com/a", ""},
+		{"/{x", "", "bad wildcard segment"},
+	} {
+		mux := NewServeMux()
+		var got string
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					got = fmt.Sprint(e)
+				}
+			}()
+			mux.HandleFunc(tt.p1, func(ResponseWriter, *Request) {})
+			mux.HandleFunc(tt.p2, func(ResponseWriter, *Request) {})
+		}()
+		if tt.want == "" && got != "" {
+			t.Errorf("%q, %q: unexpected panic: %s", tt.p1, tt.p2, got)
+		}
+		if tt.want != "" && !strings.Contains(got, tt.want) {
+			t.Errorf("%q, %q: panic = %q; want it to contain %q", tt.p1, tt.p2, got, tt.want)
+		}
+	}
+}
+
+func TestRequestSetPathValue(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/a/{b}/{c...}", func(w ResponseWriter, r *Request) {
+		r.SetPathValue("c", "C")
+		r.SetPathValue("d", "D")
+		for _, name := range []string{"b", "c", "d"} {
+			w.Header().Set(name, r.PathValue(name))
+		}
+	})
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/a/B/x/y", nil))
+	for name, want := range map[string]string{"b": "B", "c": "C", "d": "D"} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("PathValue(%q) = %q; want %q", name, got, want)
+		}
+	}
+}
+
 var serveMuxTests2 = []struct {
 	method  string
 	host    string
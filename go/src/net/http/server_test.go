@@ -37,7 +37,11 @@ func BenchmarkServerMatch(b *testing.B) {
 		"/products/", "/products/3/image.jpg"}
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		if h, p := mux.match(paths[i%len(paths)]); h != nil && p == "" {
+		r, err := NewRequest("GET", "http://example.com"+paths[i%len(paths)], nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if h, p, _, _ := mux.findHandler(r); h != nil && p == "" {
 			b.Error("impossible")
 		}
 	}
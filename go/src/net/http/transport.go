@@ -281,6 +281,21 @@ type Transport struct {
 	// To use a custom dialer or TLS config and still attempt HTTP/2
 	// upgrades, set this to true.
 	ForceAttemptHTTP2 bool
+
+	// EnableHTTP3 enables HTTP/3 for https requests to servers that
+	// advertise it with an Alt-Svc response header field.
+	// The first request to a server is sent over TCP, using HTTP/1.1
+	// or HTTP/2; once the server has advertised HTTP/3, subsequent
+	// requests are sent over QUIC. If a QUIC connection cannot be
+	// established, the request is sent over TCP instead and HTTP/3
+	// is not attempted on that server for several minutes.
+	//
+	// HTTP/3 is not used for requests sent through a proxy.
+	// QUIC connections do not use the Dial, DialContext, DialTLS,
+	// or DialTLSContext funcs.
+	EnableHTTP3 bool
+
+	h3 http3Transport
 }
 
 // A cancelKey is the key of the reqCanceler map.
@@ -326,6 +341,7 @@ func (t *Transport) Clone() *Transport {
 		GetProxyConnectHeader:  t.GetProxyConnectHeader,
 		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
 		ForceAttemptHTTP2:      t.ForceAttemptHTTP2,
+		EnableHTTP3:            t.EnableHTTP3,
 		WriteBufferSize:        t.WriteBufferSize,
 		ReadBufferSize:         t.ReadBufferSize,
 	}
@@ -558,6 +574,17 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 		return nil, errors.New("http: no Host in request URL")
 	}
 
+	useHTTP3 := t.useHTTP3(req)
+	if useHTTP3 {
+		resp, err := t.h3.roundTrip(t, req)
+		if err != errHTTP3Unavailable {
+			if err == nil {
+				resp.Request = origReq
+			}
+			return resp, err
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -597,6 +624,9 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 		}
 		if err == nil {
 			resp.Request = origReq
+			if useHTTP3 && resp.TLS != nil {
+				t.h3.handleAltSvc(canonicalAddr(req.URL), resp.Header["Alt-Svc"])
+			}
 			return resp, nil
 		}
 
@@ -775,6 +805,7 @@ func (t *Transport) CloseIdleConnections() {
 	if t2 := t.h2transport; t2 != nil {
 		t2.CloseIdleConnections()
 	}
+	t.h3.closeIdleConnections()
 }
 
 // CancelRequest cancels an in-flight request by closing its connection.
@@ -15,6 +15,7 @@ package net
 import (
 	"internal/bytealg"
 	"internal/itoa"
+	"net/netip"
 )
 
 // IP address lengths (bytes).
@@ -556,6 +557,51 @@ func (n *IPNet) String() string {
 	return nn.String() + "/" + itoa.Uitoa(uint(l))
 }
 
+// Prefix returns n as a netip.Prefix. As with String, a network whose IP
+// is an IPv4 address, including an IPv4-mapped IPv6 address, is returned
+// as an IPv4 prefix. The address is not masked.
+//
+// It returns false if n is nil, if n.IP and n.Mask are not valid for
+// the same address family, or if n.Mask is not in the canonical form
+// of ones followed by zeros.
+func (n *IPNet) Prefix() (netip.Prefix, bool) {
+	if n == nil {
+		return netip.Prefix{}, false
+	}
+	ip, _ := networkNumberAndMask(n)
+	if ip == nil {
+		return netip.Prefix{}, false
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 0 {
+		return netip.Prefix{}, false
+	}
+	if len(ip) == IPv4len {
+		// Only the last 4 bytes of a 16-byte mask apply to an IPv4
+		// address, so the others must all be ones.
+		ones -= bits - 8*IPv4len
+		if ones < 0 {
+			return netip.Prefix{}, false
+		}
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return netip.PrefixFrom(addr, ones), true
+}
+
+// IPNetFromPrefix returns p as an IPNet, or nil if p.IsValid() is false.
+// The IP and Mask fields have the length of p's address family: 4 bytes
+// for IPv4 and 16 bytes for IPv6, including IPv4-mapped IPv6 prefixes.
+func IPNetFromPrefix(p netip.Prefix) *IPNet {
+	if !p.IsValid() {
+		return nil
+	}
+	addr := p.Addr()
+	return &IPNet{
+		IP:   addr.AsSlice(),
+		Mask: CIDRMask(p.Bits(), addr.BitLen()),
+	}
+}
+
 // Parse IPv4 address (d.d.d.d).
 func parseIPv4(s string) IP {
 	var p [IPv4len]byte
@@ -10,6 +10,7 @@ package net
 import (
 	"bytes"
 	"math/rand"
+	"net/netip"
 	"reflect"
 	"runtime"
 	"testing"
@@ -418,6 +419,71 @@ func TestIPNetString(t *testing.T) {
 	}
 }
 
+var ipNetPrefixTests = []struct {
+	in   *IPNet
+	want netip.Prefix
+	ok   bool
+}{
+	{&IPNet{IP: IP{192, 168, 1, 0}, Mask: CIDRMask(26, 32)}, netip.MustParsePrefix("192.168.1.0/26"), true},
+	{&IPNet{IP: IPv4(192, 168, 1, 0), Mask: CIDRMask(26, 32)}, netip.MustParsePrefix("192.168.1.0/26"), true},
+	{&IPNet{IP: IPv4(192, 168, 1, 0), Mask: CIDRMask(122, 128)}, netip.MustParsePrefix("192.168.1.0/26"), true},
+	{&IPNet{IP: IPv4(192, 168, 1, 7), Mask: CIDRMask(24, 32)}, netip.MustParsePrefix("192.168.1.7/24"), true},
+	{&IPNet{IP: IPv4(0, 0, 0, 0), Mask: CIDRMask(0, 32)}, netip.MustParsePrefix("0.0.0.0/0"), true},
+	{&IPNet{IP: ParseIP("2001:db8::"), Mask: CIDRMask(55, 128)}, netip.MustParsePrefix("2001:db8::/55"), true},
+	{&IPNet{IP: ParseIP("::"), Mask: CIDRMask(0, 128)}, netip.MustParsePrefix("::/0"), true},
+
+	// Non-canonical masks.
+	{&IPNet{IP: IPv4(192, 168, 1, 0), Mask: IPv4Mask(255, 0, 255, 0)}, netip.Prefix{}, false},
+	{&IPNet{IP: ParseIP("2001:db8::"), Mask: IPMask(ParseIP("8000:f123:0:cafe::"))}, netip.Prefix{}, false},
+	// A 16-byte mask which doesn't cover the IPv4-mapped prefix.
+	{&IPNet{IP: IPv4(192, 168, 1, 0), Mask: CIDRMask(24, 128)}, netip.Prefix{}, false},
+	// Mismatched address families.
+	{&IPNet{IP: ParseIP("2001:db8::"), Mask: CIDRMask(24, 32)}, netip.Prefix{}, false},
+	{&IPNet{IP: IP{1, 2, 3}, Mask: CIDRMask(24, 32)}, netip.Prefix{}, false},
+	{&IPNet{IP: IPv4(192, 168, 1, 0)}, netip.Prefix{}, false},
+	{nil, netip.Prefix{}, false},
+}
+
+func TestIPNetPrefix(t *testing.T) {
+	for _, tt := range ipNetPrefixTests {
+		got, ok := tt.in.Prefix()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("IPNet.Prefix(%v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+var ipNetFromPrefixTests = []struct {
+	in   netip.Prefix
+	want *IPNet
+}{
+	{netip.MustParsePrefix("192.168.1.0/26"), &IPNet{IP: IP{192, 168, 1, 0}, Mask: CIDRMask(26, 32)}},
+	{netip.MustParsePrefix("2001:db8::/55"), &IPNet{IP: ParseIP("2001:db8::"), Mask: CIDRMask(55, 128)}},
+	{netip.MustParsePrefix("::ffff:192.168.1.0/122"), &IPNet{IP: IPv4(192, 168, 1, 0), Mask: CIDRMask(122, 128)}},
+	{netip.Prefix{}, nil},
+}
+
+func TestIPNetFromPrefix(t *testing.T) {
+	for _, tt := range ipNetFromPrefixTests {
+		got := IPNetFromPrefix(tt.in)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("IPNetFromPrefix(%v) = %#v, want %#v", tt.in, got, tt.want)
+			continue
+		}
+		if got == nil {
+			continue
+		}
+		// An IPv4-mapped IPv6 prefix comes back as an IPv4 one.
+		want := tt.in
+		if want.Addr().Is4In6() {
+			want = netip.PrefixFrom(want.Addr().Unmap(), want.Bits()-96)
+		}
+		if back, ok := got.Prefix(); !ok || back != want {
+			t.Errorf("IPNetFromPrefix(%v).Prefix() = %v, %v; want %v, true", tt.in, back, ok, want)
+		}
+	}
+}
+
 var cidrMaskTests = []struct {
 	ones int
 	bits int
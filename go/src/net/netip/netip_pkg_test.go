@@ -0,0 +1,273 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netip
+
+import (
+	"bytes"
+	"encoding"
+	"strings"
+	"testing"
+)
+
+var corpus = []string{
+	// Basic zero IPv4 address.
+	"0.0.0.0",
+	// Basic non-zero IPv4 address.
+	"192.168.140.255",
+	// IPv4 address in windows-style "print all the digits" form.
+	"010.000.015.001",
+	// IPv4 address with a silly amount of leading zeros.
+	"000001.00000002.00000003.000000004",
+	// 4-in-6 with octet with leading zero
+	"::ffff:1.2.03.4",
+	// Basic zero IPv6 address.
+	"::",
+	// Localhost IPv6.
+	"::1",
+	// Fully expanded IPv6 address.
+	"fd7a:115c:a1e0:ab12:4843:cd96:626b:430b",
+	// IPv6 with elided fields in the middle.
+	"fd7a:115c::626b:430b",
+	// IPv6 with elided fields at the end.
+	"fd7a:115c:a1e0:ab12:4843:cd96::",
+	// IPv6 with single elided field at the end.
+	"fd7a:115c:a1e0:ab12:4843:cd96:626b::",
+	"fd7a:115c:a1e0:ab12:4843:cd96:626b:0",
+	// IPv6 with single elided field in the middle.
+	"fd7a:115c:a1e0::4843:cd96:626b:430b",
+	"fd7a:115c:a1e0:0:4843:cd96:626b:430b",
+	// IPv6 with the trailing 32 bits written as IPv4 dotted decimal. (4in6)
+	"::ffff:192.168.140.255",
+	"::ffff:192.168.140.255",
+	// IPv6 with a zone specifier.
+	"fd7a:115c:a1e0:ab12:4843:cd96:626b:430b%eth0",
+	// IPv6 with dotted decimal and zone specifier.
+	"1:2::ffff:192.168.140.255%eth1",
+	"1:2::ffff:c0a8:8cff%eth1",
+	// IPv6 with capital letters.
+	"FD9E:1A04:F01D::1",
+	"fd9e:1a04:f01d::1",
+	// Empty string.
+	"",
+	// Garbage non-IP.
+	"bad",
+	// Single number. Some parsers accept this as an IPv4 address in
+	// big-endian uint32 form, but we don't.
+	"1234",
+	// IPv4 with a zone specifier.
+	"1.2.3.4%eth0",
+	// IPv4 field must have at least one digit.
+	".1.2.3",
+	"1.2.3.",
+	"1..2.3",
+	// IPv4 address too long.
+	"1.2.3.4.5",
+	// IPv4 in dotted octal form.
+	"0300.0250.0214.0377",
+	// IPv4 in dotted hex form.
+	"0xc0.0xa8.0x8c.0xff",
+	// IPv4 in class B form.
+	"192.168.12345",
+	// IPv4 in class B form, with a small enough number to be
+	// parseable as a regular dotted decimal field.
+	"127.0.1",
+	// IPv4 in class A form.
+	"192.1234567",
+	// IPv4 in class A form, with a small enough number to be
+	// parseable as a regular dotted decimal field.
+	"127.1",
+	// IPv4 field has value >255.
+	"192.168.300.1",
+	// IPv4 with too many fields.
+	"192.168.0.1.5.6",
+	// IPv6 with not enough fields.
+	"1:2:3:4:5:6:7",
+	// IPv6 with too many fields.
+	"1:2:3:4:5:6:7:8:9",
+	// IPv6 with 8 fields and a :: expander.
+	"1:2:3:4::5:6:7:8",
+	// IPv6 with a field bigger than 2b.
+	"fe801::1",
+	// IPv6 with non-hex values in field.
+	"fe80:tail:scale:is:great::1",
+	// IPv6 with a zone delimiter but no zone.
+	"fe80::1%",
+	// IPv6 with a zone specifier of zero.
+	"::ffff:0:0%0",
+	// IPv6 (without ellipsis) with too many fields for trailing embedded IPv4.
+	"ffff:ffff:ffff:ffff:ffff:ffff:ffff:192.168.140.255",
+	// IPv6 (with ellipsis) with too many fields for trailing embedded IPv4.
+	"ffff::ffff:ffff:ffff:ffff:ffff:ffff:192.168.140.255",
+	// IPv6 with invalid embedded IPv4.
+	"::ffff:192.168.140.bad",
+	// IPv6 with multiple ellipsis ::.
+	"fe80::1::1",
+	// IPv6 with invalid non hex/colon character.
+	"fe80:1?:1",
+	// IPv6 with truncated bytes after single colon.
+	"fe80:",
+	// AddrPort strings.
+	"1.2.3.4:51820",
+	"[fd7a:115c:a1e0:ab12:4843:cd96:626b:430b]:80",
+	"[::ffff:c000:0280]:65535",
+	"[::ffff:c000:0280%eth0]:1",
+	// Prefix strings.
+	"1.2.3.4/24",
+	"fd7a:115c:a1e0:ab12:4843:cd96:626b:430b/118",
+	"::ffff:c000:0280/96",
+	"::ffff:c000:0280%eth0/37",
+}
+
+func TestParseNoPanic(t *testing.T) {
+	// Make sure that nothing in the corpus panics, and that
+	// whatever parses round-trips through its text encoding.
+	for _, s := range corpus {
+		if ip, err := ParseAddr(s); err == nil {
+			checkStringParseRoundTrip(t, ip, ParseAddr)
+			checkEncoding(t, &ip)
+		}
+		if ipp, err := ParseAddrPort(s); err == nil {
+			checkStringParseRoundTrip(t, ipp, ParseAddrPort)
+			checkEncoding(t, &ipp)
+		}
+		if p, err := ParsePrefix(s); err == nil {
+			checkStringParseRoundTrip(t, p, ParsePrefix)
+			checkEncoding(t, &p)
+		}
+	}
+}
+
+type textAndBinaryMarshaler interface {
+	encoding.TextMarshaler
+	encoding.TextUnmarshaler
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	String() string
+}
+
+// checkEncoding verifies that x round-trips through its text
+// and binary encodings, and that its text encoding matches String.
+func checkEncoding(t *testing.T, x textAndBinaryMarshaler) {
+	t.Helper()
+	tb, err := x.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText(%v): %v", x, err)
+	}
+	if s := x.String(); !strings.Contains(s, "invalid") && string(tb) != s {
+		t.Errorf("MarshalText(%v) = %q, String = %q", x, tb, s)
+	}
+	bb, err := x.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary(%v): %v", x, err)
+	}
+	var tx, bx textAndBinaryMarshaler
+	switch x.(type) {
+	case *Addr:
+		tx, bx = new(Addr), new(Addr)
+	case *AddrPort:
+		tx, bx = new(AddrPort), new(AddrPort)
+	case *Prefix:
+		tx, bx = new(Prefix), new(Prefix)
+	}
+	if err := tx.UnmarshalText(tb); err != nil {
+		t.Fatalf("UnmarshalText(%q): %v", tb, err)
+	}
+	if err := bx.UnmarshalBinary(bb); err != nil {
+		t.Fatalf("UnmarshalBinary(%x): %v", bb, err)
+	}
+	tb2, _ := tx.MarshalText()
+	bb2, _ := bx.MarshalBinary()
+	if !bytes.Equal(tb, tb2) {
+		t.Errorf("text round trip of %v: got %q, want %q", x, tb2, tb)
+	}
+	if !bytes.Equal(bb, bb2) {
+		t.Errorf("binary round trip of %v: got %x, want %x", x, bb2, bb)
+	}
+}
+
+func checkStringParseRoundTrip(t *testing.T, x interface{ String() string }, parse interface{}) {
+	t.Helper()
+	s := x.String()
+	var got interface{ String() string }
+	var err error
+	switch parse := parse.(type) {
+	case func(string) (Addr, error):
+		got, err = parse(s)
+	case func(string) (AddrPort, error):
+		got, err = parse(s)
+	case func(string) (Prefix, error):
+		got, err = parse(s)
+	}
+	if err != nil {
+		t.Fatalf("parsing String() output %q: %v", s, err)
+	}
+	if got != x {
+		t.Errorf("String/parse round trip of %q: got %v", s, got)
+	}
+}
+
+func TestV6u16AndV6(t *testing.T) {
+	ip := MustParseAddr("1:2:3:4:5:6:7:8")
+	for i := uint8(0); i < 8; i++ {
+		if got, want := ip.v6u16(i), uint16(i+1); got != want {
+			t.Errorf("v6u16(%d) = %d; want %d", i, got, want)
+		}
+	}
+	for i := uint8(0); i < 16; i++ {
+		want := uint8(0)
+		if i%2 == 1 {
+			want = i/2 + 1
+		}
+		if got := ip.v6(i); got != want {
+			t.Errorf("v6(%d) = %d; want %d", i, got, want)
+		}
+	}
+}
+
+func TestMask6(t *testing.T) {
+	tests := []struct {
+		n    int
+		want uint128
+	}{
+		{0, uint128{0, 0}},
+		{1, uint128{1 << 63, 0}},
+		{64, uint128{^uint64(0), 0}},
+		{65, uint128{^uint64(0), 1 << 63}},
+		{128, uint128{^uint64(0), ^uint64(0)}},
+	}
+	for _, tt := range tests {
+		if got := mask6(tt.n); got != tt.want {
+			t.Errorf("mask6(%d) = %x; want %x", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixHasZone(t *testing.T) {
+	// PrefixFrom drops zones, so Contains never sees a zoned prefix address.
+	p := PrefixFrom(MustParseAddr("fe80::1%eth0"), 64)
+	if p.Addr().hasZone() {
+		t.Errorf("PrefixFrom kept zone: %v", p)
+	}
+}
+
+type appendMarshaler interface {
+	encoding.TextMarshaler
+	AppendTo([]byte) []byte
+}
+
+// testAppendToMarshal tests that x's AppendTo and MarshalText methods yield the same results.
+// x's MarshalText method must not return an error.
+func testAppendToMarshal(t *testing.T, x appendMarshaler) {
+	t.Helper()
+	m, err := x.MarshalText()
+	if err != nil {
+		t.Fatalf("(%v).MarshalText: %v", x, err)
+	}
+	a := make([]byte, 0, len(m))
+	a = x.AppendTo(a)
+	if !bytes.Equal(m, a) {
+		t.Errorf("(%v).MarshalText = %q, (%v).AppendTo = %q", x, m, x, a)
+	}
+}
@@ -10,6 +10,7 @@ package net
 import (
 	"errors"
 	"internal/testenv"
+	"net/netip"
 	"os"
 	"reflect"
 	"runtime"
@@ -168,6 +169,24 @@ func testWriteToConn(t *testing.T, raddr string) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	_, err = c.(*UDPConn).WriteToUDPAddrPort(b, ra.AddrPort())
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if err != nil && err.(*OpError).Err != ErrWriteToConnected {
+		t.Fatalf("should fail as ErrWriteToConnected: %v", err)
+	}
+	_, _, err = c.(*UDPConn).WriteMsgUDPAddrPort(b, nil, ra.AddrPort())
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if err != nil && err.(*OpError).Err != ErrWriteToConnected {
+		t.Fatalf("should fail as ErrWriteToConnected: %v", err)
+	}
+	_, _, err = c.(*UDPConn).WriteMsgUDPAddrPort(b, nil, netip.AddrPort{})
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 func testWriteToPacketConn(t *testing.T, raddr string) {
@@ -206,6 +225,21 @@ func testWriteToPacketConn(t *testing.T, raddr string) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	_, err = c.(*UDPConn).WriteToUDPAddrPort(b, ra.AddrPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.(*UDPConn).WriteMsgUDPAddrPort(b, nil, netip.AddrPort{})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if err != nil && err.(*OpError).Err != errMissingAddress {
+		t.Fatalf("should fail as errMissingAddress: %v", err)
+	}
+	_, _, err = c.(*UDPConn).WriteMsgUDPAddrPort(b, nil, ra.AddrPort())
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 var udpConnLocalNameTests = []struct {
@@ -495,3 +529,147 @@ func BenchmarkWriteToReadFromUDP(b *testing.B) {
 		}
 	}
 }
+
+func TestUDPAddrPortRoundTrip(t *testing.T) {
+	switch runtime.GOOS {
+	case "plan9":
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+
+	for _, network := range []string{"udp4", "udp6"} {
+		if network == "udp6" && !supportsIPv6() {
+			continue
+		}
+		t.Run(network, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if network == "udp6" {
+				addr = "[::1]:0"
+			}
+			c, err := ListenPacket(network, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			uc := c.(*UDPConn)
+			ap := uc.LocalAddr().(*UDPAddr).AddrPort()
+
+			wb := []byte("ADDRPORT")
+			if _, err := uc.WriteToUDPAddrPort(wb, ap); err != nil {
+				t.Fatal(err)
+			}
+			rb := make([]byte, 16)
+			n, from, err := uc.ReadFromUDPAddrPort(rb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rb[:n]) != string(wb) {
+				t.Errorf("got %q; want %q", rb[:n], wb)
+			}
+			if from.Addr().Unmap() != ap.Addr().Unmap() || from.Port() != ap.Port() {
+				t.Errorf("got source %v; want %v", from, ap)
+			}
+
+			if _, _, err := uc.WriteMsgUDPAddrPort(wb, nil, ap); err != nil {
+				t.Fatal(err)
+			}
+			n, _, _, from, err = uc.ReadMsgUDPAddrPort(rb, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rb[:n]) != string(wb) {
+				t.Errorf("got %q; want %q", rb[:n], wb)
+			}
+			if from.Addr().Unmap() != ap.Addr().Unmap() || from.Port() != ap.Port() {
+				t.Errorf("got source %v; want %v", from, ap)
+			}
+		})
+	}
+}
+
+func TestUDPAddrAddrPort(t *testing.T) {
+	tests := []struct {
+		addr *UDPAddr
+		want netip.AddrPort
+	}{
+		{nil, netip.AddrPort{}},
+		{&UDPAddr{}, netip.AddrPort{}},
+		{&UDPAddr{IP: IPv4(192, 0, 2, 1).To4(), Port: 53}, netip.MustParseAddrPort("192.0.2.1:53")},
+		{&UDPAddr{IP: ParseIP("fe80::1"), Port: 53, Zone: "eth0"}, netip.MustParseAddrPort("[fe80::1%eth0]:53")},
+	}
+	for _, tt := range tests {
+		if got := tt.addr.AddrPort(); got != tt.want {
+			t.Errorf("%v.AddrPort() = %v; want %v", tt.addr, got, tt.want)
+		}
+		if !tt.want.IsValid() {
+			continue
+		}
+		back := UDPAddrFromAddrPort(tt.want)
+		if !back.IP.Equal(tt.addr.IP) || back.Port != tt.addr.Port || back.Zone != tt.addr.Zone {
+			t.Errorf("UDPAddrFromAddrPort(%v) = %v; want %v", tt.want, back, tt.addr)
+		}
+	}
+}
+
+func TestAllocsAddrPort(t *testing.T) {
+	switch runtime.GOOS {
+	case "plan9":
+		// Plan 9 wasn't optimized.
+		t.Skipf("skipping on %v", runtime.GOOS)
+	}
+	conn, err := ListenUDP("udp4", &UDPAddr{IP: IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	addr := conn.LocalAddr().(*UDPAddr).AddrPort()
+	buf := make([]byte, 8)
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		_, err := conn.WriteToUDPAddrPort(buf, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if got := int(allocs); got != 0 {
+		t.Errorf("WriteToUDPAddrPort/ReadFromUDPAddrPort allocated %d objects", got)
+	}
+
+	allocs = testing.AllocsPerRun(1000, func() {
+		_, _, err := conn.WriteMsgUDPAddrPort(buf, nil, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, _, err = conn.ReadMsgUDPAddrPort(buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if got := int(allocs); got != 0 {
+		t.Errorf("WriteMsgUDPAddrPort/ReadMsgUDPAddrPort allocated %d objects", got)
+	}
+}
+
+func BenchmarkWriteToReadFromUDPAddrPort(b *testing.B) {
+	conn, err := ListenUDP("udp4", &UDPAddr{IP: IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	addr := conn.LocalAddr().(*UDPAddr).AddrPort()
+	buf := make([]byte, 8)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := conn.WriteToUDPAddrPort(buf, addr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _, err = conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
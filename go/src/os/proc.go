@@ -67,12 +67,15 @@ func Exit(code int) {
 			// unexpected call to os.Exit(0).
 			panic("unexpected call to os.Exit(0) during test")
 		}
-
-		// Give race detector a chance to fail the program.
-		// Racy programs do not have the right to finish successfully.
-		runtime_beforeExit()
 	}
+
+	// Inform the runtime that os.Exit is being called. This runs the
+	// exit hooks, such as writing out coverage data. For a zero
+	// status, it also gives the race detector a chance to fail the
+	// program: racy programs do not have the right to finish
+	// successfully.
+	runtime_beforeExit(code)
 	syscall.Exit(code)
 }
 
-func runtime_beforeExit() // implemented in runtime
+func runtime_beforeExit(exitCode int) // implemented in runtime
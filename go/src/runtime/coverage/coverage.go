@@ -0,0 +1,139 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package coverage gives access to the code coverage data of a program
+// built with 'go build -cover'.
+//
+// When such a program exits, either by returning from main.main or by
+// calling os.Exit, it writes its coverage data into the directory
+// named by the GOCOVERDIR environment variable: a meta-data file,
+// describing the instrumented code, and a counter data file, holding
+// the block counters of the run. The 'go tool covdata' command merges
+// these files and converts them to the profile format read by
+// 'go tool cover'.
+//
+// Programs that never exit, such as servers, and programs that want
+// to write coverage data at particular points, can instead use the
+// functions of this package.
+package coverage
+
+import (
+	"errors"
+	"internal/coverage"
+	"internal/coverage/rtcov"
+	"io"
+	"sync/atomic"
+)
+
+var errNotCovered = errors.New("coverage: program not built with -cover")
+
+// WriteMetaDir writes the coverage meta-data of the program into the
+// directory dir, unless it is already there.
+func WriteMetaDir(dir string) error {
+	m, err := meta()
+	if err != nil {
+		return err
+	}
+	return writeMetaDir(dir, m)
+}
+
+// WriteMeta writes the coverage meta-data of the program to w.
+func WriteMeta(w io.Writer) error {
+	m, err := meta()
+	if err != nil {
+		return err
+	}
+	return coverage.WriteMeta(w, m)
+}
+
+// WriteCountersDir writes the current values of the coverage counters
+// of the program into a new counter data file in the directory dir.
+// The meta-data the counters refer to must be written with
+// WriteMetaDir for the directory to be read by 'go tool covdata'.
+//
+// Unless the program was built with -covermode=atomic, the values of
+// counters that change while they are being written are approximate.
+func WriteCountersDir(dir string) error {
+	m, err := meta()
+	if err != nil {
+		return err
+	}
+	return writeCountersDir(dir, m)
+}
+
+// WriteCounters writes the current values of the coverage counters of
+// the program to w. See WriteCountersDir.
+func WriteCounters(w io.Writer) error {
+	m, err := meta()
+	if err != nil {
+		return err
+	}
+	return coverage.WriteCounters(w, counters(m))
+}
+
+// ClearCounters resets the coverage counters of the program to zero.
+// A program can, for example, write and clear its counters after each
+// request it serves, so that each counter data file covers one request.
+//
+// ClearCounters requires the program to have been built with
+// -covermode=atomic: in the other modes, counters are updated without
+// synchronization, and clearing them would race with their updates.
+func ClearCounters() error {
+	if len(rtcov.Files) == 0 {
+		return errNotCovered
+	}
+	if rtcov.Files[0].Mode != "atomic" {
+		return errors.New("coverage: ClearCounters requires -covermode=atomic")
+	}
+	for _, f := range rtcov.Files {
+		for i := range f.Counts {
+			atomic.StoreUint32(&f.Counts[i], 0)
+		}
+	}
+	return nil
+}
+
+// meta returns the meta-data of the instrumented files.
+func meta() (*coverage.Meta, error) {
+	if len(rtcov.Files) == 0 {
+		return nil, errNotCovered
+	}
+	m := &coverage.Meta{Mode: rtcov.Files[0].Mode}
+	for _, f := range rtcov.Files {
+		mf := coverage.MetaFile{
+			Name:   f.Name,
+			Blocks: make([]coverage.Block, len(f.NumStmt)),
+		}
+		for i := range mf.Blocks {
+			pos := f.Pos[3*i : 3*i+3]
+			mf.Blocks[i] = coverage.Block{
+				StartLine: pos[0],
+				StartCol:  pos[2] & 0xFFFF,
+				EndLine:   pos[1],
+				EndCol:    pos[2] >> 16,
+				NumStmt:   f.NumStmt[i],
+			}
+		}
+		m.Files = append(m.Files, mf)
+	}
+	return m, nil
+}
+
+// counters returns a snapshot of the counters of the instrumented
+// files, which are described by m.
+func counters(m *coverage.Meta) *coverage.Counters {
+	c := &coverage.Counters{MetaHash: m.Hash()}
+	for _, f := range rtcov.Files {
+		counts := make([]uint32, len(f.Counts))
+		if m.Mode == "atomic" {
+			for i := range counts {
+				counts[i] = atomic.LoadUint32(&f.Counts[i])
+			}
+		} else {
+			copy(counts, f.Counts)
+		}
+		c.Counts = append(c.Counts, counts)
+	}
+	return c
+}
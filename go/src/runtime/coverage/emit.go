@@ -0,0 +1,84 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coverage
+
+import (
+	"fmt"
+	"internal/coverage"
+	"internal/coverage/rtcov"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Implemented in the runtime.
+func runtime_addExitHook(f func(), runOnNonZeroExit bool)
+
+func init() {
+	runtime_addExitHook(emitOnExit, true)
+}
+
+// emitOnExit writes the coverage data of an exiting program into
+// $GOCOVERDIR.
+func emitOnExit() {
+	if len(rtcov.Files) == 0 {
+		return
+	}
+	dir := os.Getenv("GOCOVERDIR")
+	if dir == "" {
+		fmt.Fprintf(os.Stderr, "warning: GOCOVERDIR not set, no coverage data emitted\n")
+		return
+	}
+	m, err := meta()
+	if err == nil {
+		err = writeMetaDir(dir, m)
+	}
+	if err == nil {
+		err = writeCountersDir(dir, m)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: writing coverage data: %v\n", err)
+	}
+}
+
+func writeMetaDir(dir string, m *coverage.Meta) error {
+	name := filepath.Join(dir, coverage.MetaFileName(m.Hash()))
+	if _, err := os.Stat(name); err == nil {
+		// All runs of the program have the same meta-data.
+		return nil
+	}
+	return writeFile(name, func(w io.Writer) error {
+		return coverage.WriteMeta(w, m)
+	})
+}
+
+func writeCountersDir(dir string, m *coverage.Meta) error {
+	c := counters(m)
+	name := filepath.Join(dir, coverage.CountersFileName(c.MetaHash, os.Getpid(), time.Now().UnixNano()))
+	return writeFile(name, func(w io.Writer) error {
+		return coverage.WriteCounters(w, c)
+	})
+}
+
+// writeFile writes the file name with write. It writes to a temporary
+// file first, so that readers never see a partially written file.
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
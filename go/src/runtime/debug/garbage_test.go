@@ -172,6 +172,46 @@ func TestSetGCPercent(t *testing.T) {
 	}
 }
 
+func TestSetMemoryLimit(t *testing.T) {
+	// Test that the limit is being set and returned correctly.
+	old := SetMemoryLimit(123 << 20)
+	if got := SetMemoryLimit(-1); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(123<<20); SetMemoryLimit(-1) = %d, want %d", got, 123<<20)
+	}
+	if got := SetMemoryLimit(old); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(123<<20); SetMemoryLimit(x) = %d, want %d", got, 123<<20)
+	}
+	if got := SetMemoryLimit(-1); got != old {
+		t.Errorf("memory limit not restored: got %d, want %d", got, old)
+	}
+
+	// Test that the limit drives the GC even with GOGC=off.
+	oldGCPercent := SetGCPercent(-1)
+	defer func() {
+		SetMemoryLimit(old)
+		SetGCPercent(oldGCPercent)
+		setGCPercentSink = nil
+	}()
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	limit := int64(ms.Sys-ms.HeapReleased) + 64<<20
+	SetMemoryLimit(limit)
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC > uint64(limit) {
+		t.Errorf("NextGC = %d MB with a %d MB memory limit", ms.NextGC>>20, limit>>20)
+	}
+	ngc := ms.NumGC
+	// Allocate well past the limit.
+	for i := 0; i < 256; i++ {
+		setGCPercentSink = make([]byte, 1<<20)
+	}
+	runtime.ReadMemStats(&ms)
+	if ms.NumGC == ngc {
+		t.Errorf("expected the memory limit to trigger a GC but it did not")
+	}
+}
+
 func abs64(a int64) int64 {
 	if a < 0 {
 		return -a
@@ -0,0 +1,49 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import _ "unsafe" // for go:linkname
+
+// An exitHook is a function to be run when the program exits, either
+// by returning from main.main or by calling os.Exit.
+type exitHook struct {
+	f                func()
+	runOnNonZeroExit bool
+}
+
+// exitHooks holds the registered hooks. Hooks are only registered
+// during package initialization, so no locking is needed.
+var exitHooks struct {
+	hooks   []exitHook
+	running bool
+}
+
+// coverage_addExitHook registers f to be run when the program exits.
+// If runOnNonZeroExit is false, f is only run for a zero exit status.
+// Hooks run in the reverse order of registration, and must not call
+// os.Exit. It must be called during package initialization.
+//
+//go:linkname coverage_addExitHook runtime/coverage.runtime_addExitHook
+func coverage_addExitHook(f func(), runOnNonZeroExit bool) {
+	exitHooks.hooks = append(exitHooks.hooks, exitHook{f: f, runOnNonZeroExit: runOnNonZeroExit})
+}
+
+// runExitHooks runs the registered exit hooks for the exit status
+// exitCode.
+func runExitHooks(exitCode int) {
+	if exitHooks.running {
+		throw("exit hook invoked exit")
+	}
+	exitHooks.running = true
+	for i := len(exitHooks.hooks) - 1; i >= 0; i-- {
+		h := exitHooks.hooks[i]
+		if exitCode != 0 && !h.runOnNonZeroExit {
+			continue
+		}
+		h.f()
+	}
+	exitHooks.hooks = nil
+	exitHooks.running = false
+}
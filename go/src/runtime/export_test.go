@@ -33,6 +33,7 @@ var Fastlog2 = fastlog2
 
 var Atoi = atoi
 var Atoi32 = atoi32
+var ParseByteCount = parseByteCount
 
 var Nanotime = nanotime
 var NetpollBreak = netpollBreak
@@ -1256,3 +1257,28 @@ func GCTestPointerClass(p unsafe.Pointer) string {
 }
 
 const Raceenabled = raceenabled
+
+// MemoryLimitPacing sets the memory limit and starts a simulated GC
+// cycle with GC otherwise disabled, then reports the heap goal and
+// trigger before and after the runtime's non-heap memory grows by
+// grow bytes. It restores all the state it changes.
+func MemoryLimitPacing(limit int64, grow uint64) (goal0, trigger0, goal1, trigger1 uint64) {
+	stopTheWorld("MemoryLimitPacing")
+
+	systemstack(func() {
+		oldLimit := gcController.setMemoryLimit(limit)
+		triggered := gcController.triggered
+		gcController.triggered = gcController.heapLive
+
+		goal0, trigger0 = gcController.heapGoal(), gcController.trigger()
+		memstats.other_sys.add(int64(grow))
+		goal1, trigger1 = gcController.heapGoal(), gcController.trigger()
+		memstats.other_sys.add(-int64(grow))
+
+		gcController.triggered = triggered
+		gcController.setMemoryLimit(oldLimit)
+	})
+
+	startTheWorld()
+	return
+}
@@ -17,10 +17,23 @@ and use may change from release to release.
 The GOGC variable sets the initial garbage collection target percentage.
 A collection is triggered when the ratio of freshly allocated data to live data
 remaining after the previous collection reaches this percentage. The default
-is GOGC=100. Setting GOGC=off disables the garbage collector entirely.
+is GOGC=100. Setting GOGC=off disables the garbage collector entirely,
+unless the GOMEMLIMIT variable is set.
 The runtime/debug package's SetGCPercent function allows changing this
 percentage at run time. See https://golang.org/pkg/runtime/debug/#SetGCPercent.
 
+The GOMEMLIMIT variable sets a soft memory limit for the runtime. This memory
+limit includes the Go heap and all other memory managed by the runtime, and
+excludes external memory sources such as mappings of the binary itself, memory
+managed in other languages, and memory held by the operating system on behalf
+of the Go program. GOMEMLIMIT is a numeric value in bytes with an optional unit
+suffix. The supported suffixes include B, KiB, MiB, GiB, and TiB. These suffixes
+represent quantities of bytes as defined by the IEC 80000-13 standard. That is,
+they are based on powers of two: KiB means 2^10 bytes, MiB means 2^20 bytes,
+and so on. The default setting is math.MaxInt64, which effectively disables the
+memory limit. The runtime/debug package's SetMemoryLimit function allows changing
+this limit at run time. See https://golang.org/pkg/runtime/debug/#SetMemoryLimit.
+
 The GODEBUG variable controls debugging variables within the runtime.
 It is a comma-separated list of name=val pairs setting these named variables:
 
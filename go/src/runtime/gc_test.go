@@ -193,6 +193,32 @@ func TestPeriodicGC(t *testing.T) {
 	}
 }
 
+func TestMemoryLimitNonHeapGrowth(t *testing.T) {
+	// Disable GOGC so the memory limit alone sets the goal, and make
+	// sure we're not in the middle of a GC.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	runtime.GC()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	limit := int64(ms.Sys-ms.HeapReleased) + 64<<20
+	const grow = 32 << 20
+
+	// Memory outside the heap that the runtime maps during a cycle
+	// leaves that much less room for the heap under the limit, so the
+	// goal and trigger must come down without waiting for the next cycle.
+	goal0, trigger0, goal1, trigger1 := runtime.MemoryLimitPacing(limit, grow)
+	if goal0 < goal1 || goal0-goal1 < grow*96/100 || goal0-goal1 > grow {
+		t.Errorf("heap goal went from %d to %d after %d bytes of non-heap growth", goal0, goal1, grow)
+	}
+	if trigger1 >= trigger0 {
+		t.Errorf("trigger went from %d to %d after %d bytes of non-heap growth", trigger0, trigger1, grow)
+	}
+	if trigger1 > goal1 {
+		t.Errorf("trigger %d is past heap goal %d", trigger1, goal1)
+	}
+}
+
 func TestGcZombieReporting(t *testing.T) {
 	// This test is somewhat sensitive to how the allocator works.
 	got := runTestProg(t, "testprog", "GCZombie")
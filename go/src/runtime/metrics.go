@@ -79,6 +79,13 @@ func initMetrics() {
 				out.scalar = in.sysStats.gcCyclesForced
 			},
 		},
+		"/gc/cycles/limit-driven:gc-cycles": {
+			deps: makeStatDepSet(sysStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.sysStats.gcCyclesLimited
+			},
+		},
 		"/gc/cycles/total:gc-cycles": {
 			deps: makeStatDepSet(sysStatsDep),
 			compute: func(in *statAggregate, out *metricValue) {
@@ -86,6 +93,13 @@ func initMetrics() {
 				out.scalar = in.sysStats.gcCyclesDone
 			},
 		},
+		"/gc/gomemlimit:bytes": {
+			deps: makeStatDepSet(sysStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.sysStats.memoryLimit
+			},
+		},
 		"/gc/heap/allocs-by-size:bytes": {
 			deps: makeStatDepSet(heapStatsDep),
 			compute: func(in *statAggregate, out *metricValue) {
@@ -159,6 +173,13 @@ func initMetrics() {
 				out.scalar = uint64(in.heapStats.tinyAllocCount)
 			},
 		},
+		"/gc/limiter/last-enabled:gc-cycle": {
+			deps: makeStatDepSet(sysStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.sysStats.gcLimiterLastEnabled
+			},
+		},
 		"/gc/pauses:seconds": {
 			compute: func(_ *statAggregate, out *metricValue) {
 				hist := out.float64HistOrInit(timeHistBuckets)
@@ -423,6 +444,10 @@ type sysStatsAggregate struct {
 	heapGoal       uint64
 	gcCyclesDone   uint64
 	gcCyclesForced uint64
+
+	gcCyclesLimited      uint64
+	memoryLimit          uint64
+	gcLimiterLastEnabled uint64
 }
 
 // compute populates the sysStatsAggregate with values from the runtime.
@@ -431,9 +456,12 @@ func (a *sysStatsAggregate) compute() {
 	a.buckHashSys = memstats.buckhash_sys.load()
 	a.gcMiscSys = memstats.gcMiscSys.load()
 	a.otherSys = memstats.other_sys.load()
-	a.heapGoal = atomic.Load64(&gcController.heapGoal)
+	a.heapGoal = gcController.heapGoal()
 	a.gcCyclesDone = uint64(memstats.numgc)
 	a.gcCyclesForced = uint64(memstats.numforcedgc)
+	a.gcCyclesLimited = uint64(memstats.numlimitedgc)
+	a.memoryLimit = uint64(atomic.Loadint64(&gcController.memoryLimit))
+	a.gcLimiterLastEnabled = uint64(atomic.Load(&gcCPULimiter.lastEnabledCycle))
 
 	systemstack(func() {
 		lock(&mheap_.lock)
@@ -63,12 +63,27 @@ var allDesc = []Description{
 		Kind:        KindUint64,
 		Cumulative:  true,
 	},
+	{
+		Name: "/gc/cycles/limit-driven:gc-cycles",
+		Description: "Count of completed GC cycles generated by the Go runtime " +
+			"whose heap goal was lowered to stay under the memory limit " +
+			"set by GOMEMLIMIT or runtime/debug.SetMemoryLimit.",
+		Kind:       KindUint64,
+		Cumulative: true,
+	},
 	{
 		Name:        "/gc/cycles/total:gc-cycles",
 		Description: "Count of all completed GC cycles.",
 		Kind:        KindUint64,
 		Cumulative:  true,
 	},
+	{
+		Name: "/gc/gomemlimit:bytes",
+		Description: "Go runtime memory limit configured by the user, otherwise " +
+			"math.MaxInt64. This value is set by the GOMEMLIMIT environment " +
+			"variable, and the runtime/debug.SetMemoryLimit function.",
+		Kind: KindUint64,
+	},
 	{
 		Name: "/gc/heap/allocs-by-size:bytes",
 		Description: "Distribution of heap allocations by approximate size. " +
@@ -134,6 +149,15 @@ var allDesc = []Description{
 		Kind:       KindUint64,
 		Cumulative: true,
 	},
+	{
+		Name: "/gc/limiter/last-enabled:gc-cycle",
+		Description: "GC cycle in which the GC CPU limiter was last enabled. " +
+			"The limiter lets the heap exceed the memory limit when the GC " +
+			"would otherwise use too much CPU, so this helps diagnose " +
+			"out-of-memory errors when a memory limit is set. " +
+			"GC cycles are numbered from 1, so 0 means the limiter was never enabled.",
+		Kind: KindUint64,
+	},
 	{
 		Name:        "/gc/pauses:seconds",
 		Description: "Distribution individual GC-related stop-the-world pause latencies.",
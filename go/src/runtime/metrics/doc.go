@@ -57,9 +57,19 @@ Below is the full list of supported metrics, ordered lexicographically.
 	/gc/cycles/forced:gc-cycles
 		Count of completed GC cycles forced by the application.
 
+	/gc/cycles/limit-driven:gc-cycles
+		Count of completed GC cycles generated by the Go runtime
+		whose heap goal was lowered to stay under the memory limit
+		set by GOMEMLIMIT or runtime/debug.SetMemoryLimit.
+
 	/gc/cycles/total:gc-cycles
 		Count of all completed GC cycles.
 
+	/gc/gomemlimit:bytes
+		Go runtime memory limit configured by the user, otherwise
+		math.MaxInt64. This value is set by the GOMEMLIMIT environment
+		variable, and the runtime/debug.SetMemoryLimit function.
+
 	/gc/heap/allocs-by-size:bytes
 		Distribution of heap allocations by approximate size.
 		Note that this does not include tiny objects as defined by /gc/heap/tiny/allocs:objects,
@@ -99,6 +109,13 @@ Below is the full list of supported metrics, ordered lexicographically.
 		only their block. Each block is already accounted for in
 		allocs-by-size and frees-by-size.
 
+	/gc/limiter/last-enabled:gc-cycle
+		GC cycle in which the GC CPU limiter was last enabled.
+		The limiter lets the heap exceed the memory limit when the GC
+		would otherwise use too much CPU, so this helps diagnose
+		out-of-memory errors when a memory limit is set.
+		GC cycles are numbered from 1, so 0 means the limiter was never enabled.
+
 	/gc/pauses:seconds
 		Distribution individual GC-related stop-the-world pause latencies.
 
@@ -113,7 +113,7 @@
 // Next GC is after we've allocated an extra amount of memory proportional to
 // the amount already in use. The proportion is controlled by GOGC environment variable
 // (100 by default). If GOGC=100 and we're using 4M, we'll GC again when we get to 8M
-// (this mark is tracked in gcController.heapGoal variable). This keeps the GC cost in
+// (this mark is computed by gcController.heapGoal). This keeps the GC cost in
 // linear proportion to the allocation cost. Adjusting GOGC just changes the linear constant
 // (and also the amount of extra memory used).
 
@@ -158,7 +158,7 @@ func gcinit() {
 
 	// Initialize GC pacer state.
 	// Use the environment variable GOGC for the initial gcPercent value.
-	gcController.init(readGOGC())
+	gcController.init(readGOGC(), readGOMEMLIMIT())
 
 	work.startSema = 1
 	work.markDoneSema = 1
@@ -388,6 +388,23 @@ var work struct {
 	// incremented at mark termination.
 	cycles uint32
 
+	// goroutineLeak is the state of goroutine leak detection. See
+	// mgcleak.go.
+	goroutineLeak struct {
+		// requested is set to 1 to ask the next cycle to find
+		// leaked goroutines. It is updated atomically.
+		requested uint32
+
+		// pending indicates that the current cycle is finding
+		// leaked goroutines and has not found them yet. It is set
+		// and cleared with the world stopped.
+		pending bool
+
+		// done is the last cycle that found leaked goroutines. It
+		// is updated atomically.
+		done uint32
+	}
+
 	// Timing/utilization stats for this cycle.
 	stwprocs, maxprocs                 int32
 	tSweepTerm, tMark, tMarkTerm, tEnd int64 // nanotime() of phase start
@@ -548,7 +565,7 @@ func (t gcTrigger) test() bool {
 		// we are going to trigger on this, this thread just
 		// atomically wrote gcController.heapLive anyway and we'll see our
 		// own write.
-		return gcController.heapLive >= gcController.trigger
+		return gcController.heapLive >= gcController.trigger()
 	case gcTriggerTime:
 		if gcController.gcPercent < 0 {
 			return false
@@ -667,7 +684,7 @@ func gcStart(trigger gcTrigger) {
 	work.cycles++
 
 	gcController.startCycle()
-	work.heapGoal = gcController.heapGoal
+	work.heapGoal = gcController.heapGoal()
 
 	// In STW mode, disable scheduling of user Gs. This may also
 	// disable scheduling of this goroutine, so it may block as
@@ -702,6 +719,12 @@ func gcStart(trigger gcTrigger) {
 	// would slow down the tiny allocator.
 	gcMarkTinyAllocs()
 
+	// If leaked goroutines were asked for, hide the blocking
+	// objects of goroutines from this cycle.
+	if atomic.Cas(&work.goroutineLeak.requested, 1, 0) {
+		gcPrepareLeakDetection()
+	}
+
 	// At this point all Ps have enabled the write
 	// barrier, thus maintaining the no white to
 	// black invariant. Enable mutator assists to
@@ -864,6 +887,11 @@ top:
 				break
 			}
 		}
+		// If this cycle is finding leaked goroutines, marking
+		// must resume until it has found them.
+		if !restart && work.goroutineLeak.pending {
+			restart = gcFindLeakedGoroutines()
+		}
 	})
 	if restart {
 		getg().m.preemptoff = ""
@@ -971,9 +999,17 @@ func gcMarkTermination(nextTriggerRatio float64) {
 	}
 
 	// Record heapGoal and heap_inuse for scavenger.
-	gcController.lastHeapGoal = gcController.heapGoal
+	gcController.lastHeapGoal = gcController.heapGoal()
 	memstats.last_heap_inuse = memstats.heap_inuse
 
+	// Record whether the memory limit paced this cycle before
+	// commit sets up the next one.
+	_, limited := gcController.heapGoalInternal()
+
+	// The cycle is over, so the next heap goal needs no runway
+	// beyond where this one started.
+	gcController.triggered = ^uint64(0)
+
 	// Update GC trigger and pacing for the next cycle.
 	gcController.commit(nextTriggerRatio)
 
@@ -998,6 +1034,7 @@ func gcMarkTermination(nextTriggerRatio float64) {
 	markTermCpu := int64(work.stwprocs) * (work.tEnd - work.tMarkTerm)
 	cycleCpu := sweepTermCpu + markCpu + markTermCpu
 	work.totaltime += cycleCpu
+	gcCPULimiter.addGCTime(sweepTermCpu + markTermCpu)
 
 	// Compute overall GC CPU utilization.
 	totalCpu := sched.totaltime + (now-sched.procresizetime)*int64(gomaxprocs)
@@ -1009,6 +1046,8 @@ func gcMarkTermination(nextTriggerRatio float64) {
 
 	if work.userForced {
 		memstats.numforcedgc++
+	} else if limited {
+		memstats.numlimitedgc++
 	}
 
 	// Bump GC cycle count and wake goroutines waiting on sweep.
@@ -1296,9 +1335,11 @@ func gcBgMarkWorker() {
 		case gcMarkWorkerDedicatedMode:
 			atomic.Xaddint64(&gcController.dedicatedMarkTime, duration)
 			atomic.Xaddint64(&gcController.dedicatedMarkWorkersNeeded, 1)
+			gcCPULimiter.addGCTime(duration)
 		case gcMarkWorkerFractionalMode:
 			atomic.Xaddint64(&gcController.fractionalMarkTime, duration)
 			atomic.Xaddint64(&pp.gcFractionalMarkTime, duration)
+			gcCPULimiter.addGCTime(duration)
 		case gcMarkWorkerIdleMode:
 			atomic.Xaddint64(&gcController.idleMarkTime, duration)
 		}
@@ -0,0 +1,229 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Garbage collector: goroutine leak detection.
+//
+// A goroutine blocked on a channel, a sync.Mutex, sync.RWMutex,
+// sync.WaitGroup or sync.Cond can only be woken by a goroutine that
+// can reach the object it is blocked on. If no goroutine that may run
+// again can reach that object, the goroutine is blocked forever: it
+// is leaked, together with everything its stack refers to.
+//
+// A GC cycle finds such goroutines with the reachability information
+// it computes anyway. When asked to, the cycle does not treat the
+// stacks of these blocked goroutines as roots. It marks from the other
+// roots, then, when there is no marking work left, it scans the stacks
+// of the blocked goroutines whose blocking objects have been marked
+// and resumes marking, until it reaches a fixed point where the
+// goroutines left are blocked on objects only reachable from leaked
+// goroutines. It records these for the goroutine leak profile, and
+// scans their stacks too, so that the cycle does not free anything
+// they refer to.
+//
+// The runtime itself refers to the blocking objects through the sudogs
+// of the goroutines blocked on channels, found from gp.waiting, and of
+// those blocked on semaphores, found from semtable. To hide these
+// references, the cycle marks these sudogs when it starts, without
+// scanning them, and scans them once it has found the leaked
+// goroutines. A sync.Cond refers to the sudogs of its waiters, but
+// nothing refers to it but their stacks.
+//
+// The detection is conservative: a goroutine it reports is leaked, but
+// it may miss leaked goroutines, for example when a heap-allocated
+// defer record of the goroutine refers to its blocking object.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"unsafe"
+)
+
+//go:linkname runtime_goroutineLeakGC runtime/pprof.runtime_goroutineLeakGC
+func runtime_goroutineLeakGC() {
+	goroutineLeakGC()
+}
+
+// goroutineLeakGC runs GC cycles until one that started after the call
+// has found the leaked goroutines.
+func goroutineLeakGC() {
+	n := atomic.Load(&work.cycles)
+	atomic.Store(&work.goroutineLeak.requested, 1)
+	for int32(atomic.Load(&work.goroutineLeak.done)-n) <= 0 {
+		// Finish the current cycle and start a new one, as GC
+		// does. If another goroutine starts it first, the request
+		// may carry over to the cycle after it.
+		c := atomic.Load(&work.cycles)
+		gcWaitOnMark(c)
+		gcStart(gcTrigger{kind: gcTriggerCycle, n: c + 1})
+		gcWaitOnMark(c + 1)
+	}
+}
+
+// gcPrepareLeakDetection makes the current cycle find the leaked
+// goroutines. It marks the sudogs of the goroutines blocked on
+// channels and semaphores without scanning them, so that the objects
+// they are blocked on are only reachable from user code.
+//
+// The world must be stopped.
+func gcPrepareLeakDetection() {
+	assertWorldStopped()
+
+	work.goroutineLeak.pending = true
+	gcw := &getg().m.p.ptr().gcw
+	forEachGRace(func(gp *g) {
+		gp.leaked = false
+		if gp.maybeLeaked() {
+			for sg := gp.waiting; sg != nil; sg = sg.waitlink {
+				gcMarkSudog(sg, gcw)
+			}
+		}
+	})
+	forEachSemaWaiter(func(s *sudog) {
+		gcMarkSudog(s, gcw)
+	})
+}
+
+// gcFindLeakedGoroutines is called with the world stopped when the
+// current cycle has no marking work left and has not found the leaked
+// goroutines yet. It scans the stacks that markroot skipped of the
+// goroutines that are no longer blocked or are blocked on a marked
+// object. If there are none, the goroutines left are leaked: it
+// records them, and scans their stacks and the sudogs hidden from the
+// collector. It reports whether it queued marking work, in which case
+// marking must resume.
+func gcFindLeakedGoroutines() bool {
+	assertWorldStopped()
+
+	gcw := &getg().m.p.ptr().gcw
+	for {
+		found := false
+		forEachUnscannedG(func(gp *g) {
+			if !gp.blockedOnUnmarked() {
+				markrootStack(gp, gcw)
+				gcScanSudogs(gp.waiting, gcw)
+				found = true
+			}
+		})
+		if !found {
+			break
+		}
+		if !gcw.empty() {
+			return true
+		}
+		// The stacks only referred to objects without pointers,
+		// which are marked without queueing marking work, but may
+		// be blocking objects. Look again.
+	}
+
+	forEachUnscannedG(func(gp *g) {
+		gp.leaked = true
+		markrootStack(gp, gcw)
+	})
+	forEachGRace(func(gp *g) {
+		gcScanSudogs(gp.waiting, gcw)
+	})
+	forEachSemaWaiter(func(s *sudog) {
+		scanobject(uintptr(unsafe.Pointer(s)), gcw)
+	})
+	work.goroutineLeak.pending = false
+	atomic.Store(&work.goroutineLeak.done, work.cycles)
+	return !gcw.empty()
+}
+
+// forEachUnscannedG calls f for each goroutine whose stack this cycle
+// has to scan but has not scanned yet.
+func forEachUnscannedG(f func(gp *g)) {
+	// As in gcMarkRootCheck, only the first nStackRoots Gs have
+	// stacks to scan.
+	i := 0
+	forEachGRace(func(gp *g) {
+		if i >= work.nStackRoots {
+			return
+		}
+		i++
+		if !gp.gcscandone {
+			f(gp)
+		}
+	})
+}
+
+// maybeLeaked reports whether gp is blocked on a channel, or on a
+// semaphore or sync.Cond in the heap, so that it may be leaked.
+func (gp *g) maybeLeaked() bool {
+	if readgstatus(gp)&^_Gscan != _Gwaiting {
+		return false
+	}
+	switch gp.waitreason {
+	case waitReasonChanReceive, waitReasonChanSend, waitReasonSelect:
+		return true
+	case waitReasonSemacquire, waitReasonSyncCondWait:
+		// The runtime's own semaphores are not in the heap.
+		return spanOfHeap(gp.waitobj) != nil
+	}
+	return false
+}
+
+// blockedOnUnmarked reports whether gp is blocked on objects none of
+// which is marked.
+func (gp *g) blockedOnUnmarked() bool {
+	if !gp.maybeLeaked() {
+		return false
+	}
+	switch gp.waitreason {
+	case waitReasonSemacquire, waitReasonSyncCondWait:
+		return !isMarkedObject(gp.waitobj)
+	}
+	for sg := gp.waiting; sg != nil; sg = sg.waitlink {
+		if sg.c != nil && isMarkedObject(uintptr(unsafe.Pointer(sg.c))) {
+			return false
+		}
+	}
+	return true
+}
+
+// isMarkedObject reports whether the heap object containing p is
+// marked. It reports true if p is not in the heap.
+func isMarkedObject(p uintptr) bool {
+	s := spanOfHeap(p)
+	if s == nil {
+		return true
+	}
+	return s.markBitsForIndex(s.objIndex(p)).isMarked()
+}
+
+// gcMarkSudog marks s black without scanning it. Unlike greyobject, it
+// does not queue s for scanning, so the objects s refers to are not
+// marked unless something else refers to them.
+//
+//go:nowritebarrier
+func gcMarkSudog(s *sudog, gcw *gcWork) {
+	obj := uintptr(unsafe.Pointer(s))
+	span := spanOfHeap(obj)
+	if span == nil {
+		return
+	}
+	mbits := span.markBitsForIndex(span.objIndex(obj))
+	if mbits.isMarked() {
+		return
+	}
+	mbits.setMarked()
+
+	// Mark span.
+	arena, pageIdx, pageMask := pageIndexOf(span.base())
+	if arena.pageMarks[pageIdx]&pageMask == 0 {
+		atomic.Or8(&arena.pageMarks[pageIdx], pageMask)
+	}
+	gcw.bytesMarked += uint64(span.elemsize)
+}
+
+// gcScanSudogs scans the sudogs of the list that starts with sg and
+// continues through waitlink.
+//
+//go:nowritebarrier
+func gcScanSudogs(sg *sudog, gcw *gcWork) {
+	for ; sg != nil; sg = sg.waitlink {
+		scanobject(uintptr(unsafe.Pointer(sg)), gcw)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "runtime/internal/atomic"
+
+const (
+	// gcCPULimiterCap is the maximum fraction of total CPU time,
+	// sustained over gcCPULimiterBucketDuration, that the GC may
+	// use before the limiter starts cutting back on GC work.
+	gcCPULimiterCap = 0.5
+
+	// gcCPULimiterBucketDuration is the wall-clock duration per P of
+	// GC CPU time in excess of gcCPULimiterCap the limiter tolerates
+	// before it kicks in.
+	gcCPULimiterBucketDuration = 1e9
+)
+
+// gcCPULimiter bounds the CPU time spent in the GC.
+//
+// Normally the pacer keeps the GC well under gcCPULimiterCap. But when
+// the heap goal is set by the memory limit and the live heap doesn't
+// fit comfortably under it, GC cycles run back to back and mutator
+// assists take over more and more of the CPU, until the application
+// makes hardly any progress (a "death spiral"). In that case it's
+// better to let the heap exceed the memory limit than to stop doing
+// useful work, so the limiter disables mutator assists while GC CPU
+// utilization stays above the cap.
+//
+// The limiter is a leaky bucket: GC CPU time fills it, and CPU time
+// spent outside the GC drains it, such that its level is stable at
+// exactly gcCPULimiterCap utilization. The limiter is enabled while the
+// bucket is full.
+var gcCPULimiter gcCPULimiterState
+
+type gcCPULimiterState struct {
+	// gcTime is the total CPU time in nanoseconds spent in mutator
+	// assists and dedicated and fractional mark workers. Idle mark
+	// workers use otherwise idle Ps, so they aren't counted.
+	//
+	// Updated atomically.
+	gcTime int64
+
+	// lastUpdate is the nanotime of the last call to update.
+	lastUpdate int64
+
+	// lastGCTime is gcTime as of lastUpdate.
+	lastGCTime int64
+
+	// bucketFill is the current level of the bucket in CPU
+	// nanoseconds, in [0, bucketCapacity].
+	bucketFill int64
+
+	// updating is 1 while update is running, and serializes
+	// updates. Accessed atomically.
+	updating uint32
+
+	// enabled is 1 while the limiter is limiting GC CPU
+	// utilization. Accessed atomically.
+	enabled uint32
+
+	// lastEnabledCycle is the GC cycle (work.cycles) in which the
+	// limiter was last enabled. GC cycles are numbered from 1, and
+	// there's no GC time to limit before the first one starts, so 0
+	// means the limiter was never enabled.
+	//
+	// Accessed atomically.
+	lastEnabledCycle uint32
+}
+
+// addGCTime accounts for ns nanoseconds of GC CPU time.
+//
+//go:nosplit
+func (l *gcCPULimiterState) addGCTime(ns int64) {
+	atomic.Xaddint64(&l.gcTime, ns)
+}
+
+// limiting reports whether the limiter is currently enabled, in which
+// case callers should avoid doing optional GC work such as assists.
+//
+//go:nosplit
+func (l *gcCPULimiterState) limiting() bool {
+	return atomic.Load(&l.enabled) != 0
+}
+
+// update refills and drains the bucket with the CPU time spent since
+// the last update, and enables or disables the limiter accordingly.
+// It's called periodically by sysmon. If another update is in
+// progress, update does nothing.
+//
+// May run without a P.
+//
+//go:nowritebarrierrec
+func (l *gcCPULimiterState) update(now int64) {
+	if !atomic.Cas(&l.updating, 0, 1) {
+		return
+	}
+	if l.lastUpdate == 0 || now <= l.lastUpdate {
+		// First update, or the clock went backwards. Just
+		// establish a new baseline.
+		l.lastUpdate = now
+		l.lastGCTime = atomic.Loadint64(&l.gcTime)
+		atomic.Store(&l.updating, 0)
+		return
+	}
+	procs := int64(gomaxprocs)
+	gcTime := atomic.Loadint64(&l.gcTime)
+	windowGCTime := gcTime - l.lastGCTime
+	windowTotalTime := (now - l.lastUpdate) * procs
+	l.lastUpdate = now
+	l.lastGCTime = gcTime
+
+	// GC time fills the bucket at a rate of (1 - cap), and the
+	// remaining time drains it at a rate of cap.
+	fill := l.bucketFill + windowGCTime - int64(gcCPULimiterCap*float64(windowTotalTime))
+	capacity := gcCPULimiterBucketDuration * procs
+	if fill < 0 {
+		fill = 0
+	}
+	if fill >= capacity {
+		fill = capacity
+		if atomic.Load(&l.enabled) == 0 {
+			atomic.Store(&l.lastEnabledCycle, atomic.Load(&work.cycles))
+			atomic.Store(&l.enabled, 1)
+		}
+	} else {
+		atomic.Store(&l.enabled, 0)
+	}
+	l.bucketFill = fill
+
+	atomic.Store(&l.updating, 0)
+}
@@ -200,43 +200,60 @@ func markroot(gcw *gcWork, i uint32) {
 			gp.waitsince = work.tstart
 		}
 
+		// While this cycle looks for leaked goroutines, the stacks
+		// of goroutines blocked on channels and sync objects are
+		// scanned by gcFindLeakedGoroutines instead.
+		if work.goroutineLeak.pending && gp.maybeLeaked() {
+			return
+		}
+
 		// scanstack must be done on the system stack in case
 		// we're trying to scan our own stack.
 		systemstack(func() {
-			// If this is a self-scan, put the user G in
-			// _Gwaiting to prevent self-deadlock. It may
-			// already be in _Gwaiting if this is a mark
-			// worker or we're in mark termination.
-			userG := getg().m.curg
-			selfScan := gp == userG && readgstatus(userG) == _Grunning
-			if selfScan {
-				casgstatus(userG, _Grunning, _Gwaiting)
-				userG.waitreason = waitReasonGarbageCollectionScan
-			}
+			markrootStack(gp, gcw)
+		})
+	}
+}
 
-			// TODO: suspendG blocks (and spins) until gp
-			// stops, which may take a while for
-			// running goroutines. Consider doing this in
-			// two phases where the first is non-blocking:
-			// we scan the stacks we can and ask running
-			// goroutines to scan themselves; and the
-			// second blocks.
-			stopped := suspendG(gp)
-			if stopped.dead {
-				gp.gcscandone = true
-				return
-			}
-			if gp.gcscandone {
-				throw("g already scanned")
-			}
-			scanstack(gp, gcw)
-			gp.gcscandone = true
-			resumeG(stopped)
+// markrootStack scans the stack of gp.
+//
+// This must run on the system stack.
+//
+//go:nowritebarrier
+//go:systemstack
+func markrootStack(gp *g, gcw *gcWork) {
+	// If this is a self-scan, put the user G in
+	// _Gwaiting to prevent self-deadlock. It may
+	// already be in _Gwaiting if this is a mark
+	// worker or we're in mark termination.
+	userG := getg().m.curg
+	selfScan := gp == userG && readgstatus(userG) == _Grunning
+	if selfScan {
+		casgstatus(userG, _Grunning, _Gwaiting)
+		userG.waitreason = waitReasonGarbageCollectionScan
+	}
+
+	// TODO: suspendG blocks (and spins) until gp
+	// stops, which may take a while for
+	// running goroutines. Consider doing this in
+	// two phases where the first is non-blocking:
+	// we scan the stacks we can and ask running
+	// goroutines to scan themselves; and the
+	// second blocks.
+	stopped := suspendG(gp)
+	if stopped.dead {
+		gp.gcscandone = true
+		return
+	}
+	if gp.gcscandone {
+		throw("g already scanned")
+	}
+	scanstack(gp, gcw)
+	gp.gcscandone = true
+	resumeG(stopped)
 
-			if selfScan {
-				casgstatus(userG, _Gwaiting, _Grunning)
-			}
-		})
+	if selfScan {
+		casgstatus(userG, _Gwaiting, _Grunning)
 	}
 }
 
@@ -392,6 +409,12 @@ func gcAssistAlloc(gp *g) {
 	if mp := getg().m; mp.locks > 0 || mp.preemptoff != "" {
 		return
 	}
+	// If the GC is using too much CPU, don't assist. The
+	// allocation goes through, and the heap may overshoot the
+	// goal, but the mutator keeps making progress.
+	if gcCPULimiter.limiting() {
+		return
+	}
 
 	traced := false
 retry:
@@ -568,6 +591,7 @@ func gcAssistAlloc1(gp *g, scanWork int64) {
 	_p_.gcAssistTime += duration
 	if _p_.gcAssistTime > gcAssistTimeSlack {
 		atomic.Xaddint64(&gcController.assistTime, _p_.gcAssistTime)
+		gcCPULimiter.addGCTime(_p_.gcAssistTime)
 		_p_.gcAssistTime = 0
 	}
 }
@@ -47,6 +47,21 @@ const (
 
 	// defaultHeapMinimum is the value of heapMinimum for GOGC==100.
 	defaultHeapMinimum = 4 << 20
+
+	// maxInt64 is the value of memoryLimit when there is no limit.
+	maxInt64 = 1<<63 - 1
+
+	// memoryLimitHeadroomPercent is the percentage of the heap goal
+	// derived from the memory limit that is held back, to absorb
+	// fragmentation and growth of non-heap memory between the time
+	// the goal is computed and the time the heap reaches it.
+	memoryLimitHeadroomPercent = 3
+
+	// memoryLimitTriggerFraction is how far, as a fraction of the
+	// distance from heapMarked to a heap goal set by the memory limit,
+	// the heap may grow before the next GC is triggered when there is
+	// no GOGC-based trigger ratio to go by (GOGC=off).
+	memoryLimitTriggerFraction = 0.7
 )
 
 func init() {
@@ -77,6 +92,14 @@ type gcControllerState struct {
 
 	_ uint32 // padding so following 64-bit values are 8-byte aligned
 
+	// memoryLimit is the soft limit in bytes on the total memory
+	// mapped and in use by the runtime. Initialized from $GOMEMLIMIT
+	// and set by debug.SetMemoryLimit. maxInt64 means no limit.
+	//
+	// Read atomically. Written atomically with mheap_.lock held or
+	// the world stopped.
+	memoryLimit int64
+
 	// heapMinimum is the minimum heap size at which to trigger GC.
 	// For small heaps, this overrides the usual GOGC*live set rule.
 	//
@@ -102,23 +125,46 @@ type gcControllerState struct {
 	// Protected by mheap_.lock or a STW.
 	triggerRatio float64
 
-	// trigger is the heap size that triggers marking.
-	//
-	// When heapLive ≥ trigger, the mark phase will start.
-	// This is also the heap size by which proportional sweeping
-	// must be complete.
+	// gcPercentTrigger is the heap size that triggers marking
+	// according to GOGC alone. See trigger for the actual trigger,
+	// which also accounts for the memory limit.
 	//
 	// This is computed from triggerRatio during mark termination
 	// for the next cycle's trigger.
 	//
-	// Protected by mheap_.lock or a STW.
-	trigger uint64
+	// Read and written atomically, unless the world is stopped.
+	gcPercentTrigger uint64
+
+	// gcPercentHeapGoal is the goal heapLive for when next GC ends
+	// according to GOGC alone. Set to ^uint64(0) if disabled.
+	// See heapGoal for the actual goal, which also accounts for
+	// the memory limit.
+	//
+	// Read and written atomically, unless the world is stopped.
+	gcPercentHeapGoal uint64
+
+	// sweepDistMinTrigger is the minimum trigger that leaves
+	// concurrent sweep some heap growth in which to finish, or 0 if
+	// sweeping was done when the trigger was last computed.
+	//
+	// Read and written atomically, unless the world is stopped.
+	sweepDistMinTrigger uint64
+
+	// limitTriggerFraction is how far, as a fraction of the distance
+	// from heapMarked to a heap goal set by the memory limit, the heap
+	// may grow before the next GC is triggered.
+	//
+	// Stored as a uint64, but it's actually a float64. Use
+	// float64frombits to get the value.
+	//
+	// Read and written atomically, unless the world is stopped.
+	limitTriggerFraction uint64
 
-	// heapGoal is the goal heapLive for when next GC ends.
-	// Set to ^uint64(0) if disabled.
+	// triggered is the value of heapLive when the current GC cycle
+	// started, or ^uint64(0) outside of a cycle.
 	//
 	// Read and written atomically, unless the world is stopped.
-	heapGoal uint64
+	triggered uint64
 
 	// lastHeapGoal is the value of heapGoal for the previous GC.
 	// Note that this is distinct from the last value heapGoal had,
@@ -256,8 +302,10 @@ type gcControllerState struct {
 	_ cpu.CacheLinePad
 }
 
-func (c *gcControllerState) init(gcPercent int32) {
+func (c *gcControllerState) init(gcPercent int32, memoryLimit int64) {
 	c.heapMinimum = defaultHeapMinimum
+	c.memoryLimit = memoryLimit
+	c.triggered = ^uint64(0)
 
 	// Set a reasonable initial GC trigger.
 	c.triggerRatio = 7 / 8.0
@@ -282,16 +330,9 @@ func (c *gcControllerState) startCycle() {
 	c.fractionalMarkTime = 0
 	c.idleMarkTime = 0
 
-	// Ensure that the heap goal is at least a little larger than
-	// the current live heap size. This may not be the case if GC
-	// start is delayed or if the allocation that pushed gcController.heapLive
-	// over trigger is large or if the trigger is really close to
-	// GOGC. Assist is proportional to this distance, so enforce a
-	// minimum distance, even if it means going over the GOGC goal
-	// by a tiny bit.
-	if c.heapGoal < c.heapLive+1024*1024 {
-		c.heapGoal = c.heapLive + 1024*1024
-	}
+	// Record where the cycle started, so that heapGoal can
+	// keep some runway beyond it.
+	c.triggered = c.heapLive
 
 	// Compute the background mark utilization goal. In general,
 	// this may not come out exactly. We round the number of
@@ -337,7 +378,7 @@ func (c *gcControllerState) startCycle() {
 		print("pacer: assist ratio=", assistRatio,
 			" (scan ", gcController.heapScan>>20, " MB in ",
 			work.initialHeapLive>>20, "->",
-			c.heapGoal>>20, " MB)",
+			c.heapGoal()>>20, " MB)",
 			" workers=", c.dedicatedMarkWorkersNeeded,
 			"+", c.fractionalUtilizationGoal, "\n")
 	}
@@ -345,7 +386,7 @@ func (c *gcControllerState) startCycle() {
 
 // revise updates the assist ratio during the GC cycle to account for
 // improved estimates. This should be called whenever gcController.heapScan,
-// gcController.heapLive, or gcController.heapGoal is updated. It is safe to
+// gcController.heapLive, or the heap goal is updated. It is safe to
 // call concurrently, but it may race with other calls to revise.
 //
 // The result of this race is that the two assist ratio values may not line
@@ -377,7 +418,7 @@ func (c *gcControllerState) revise() {
 
 	// Assume we're under the soft goal. Pace GC to complete at
 	// heapGoal assuming the heap is in steady-state.
-	heapGoal := int64(atomic.Load64(&c.heapGoal))
+	heapGoal := int64(c.heapGoal())
 
 	// Compute the expected scan work remaining.
 	//
@@ -454,6 +495,12 @@ func (c *gcControllerState) endCycle(userForced bool) float64 {
 		// Just leave it where it is.
 		return c.triggerRatio
 	}
+	if _, limited := c.heapGoalInternal(); limited {
+		// Likewise, this cycle was paced against the memory
+		// limit rather than GOGC, so it says little about the
+		// GOGC trigger ratio.
+		return c.triggerRatio
+	}
 
 	// Proportional response gain for the trigger controller. Must
 	// be in [0, 1]. Lower values smooth out transient effects but
@@ -493,7 +540,7 @@ func (c *gcControllerState) endCycle(userForced bool) float64 {
 		// document.
 		H_m_prev := c.heapMarked
 		h_t := c.triggerRatio
-		H_T := c.trigger
+		H_T := c.trigger()
 		h_a := actualGrowthRatio
 		H_a := c.heapLive
 		h_g := goalGrowthRatio
@@ -643,7 +690,7 @@ func (c *gcControllerState) findRunnableGCWorker(_p_ *p) *g {
 // This can be called any time. If GC is the in the middle of a
 // concurrent phase, it will adjust the pacing of that phase.
 //
-// This depends on gcPercent, gcController.heapMarked, and
+// This depends on gcPercent, memoryLimit, gcController.heapMarked, and
 // gcController.heapLive. These must be up to date.
 //
 // mheap_.lock must be held or the world must be stopped.
@@ -699,27 +746,28 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 	//
 	// We trigger the next GC cycle when the allocated heap has
 	// grown by the trigger ratio over the marked heap size.
+	var sweepDistMinTrigger uint64
+	if !isSweepDone() {
+		// Concurrent sweep happens in the heap growth
+		// from gcController.heapLive to trigger, so ensure
+		// that concurrent sweep has some heap growth
+		// in which to perform sweeping before we
+		// start the next GC cycle.
+		sweepDistMinTrigger = atomic.Load64(&c.heapLive) + sweepMinHeapDistance
+	}
 	trigger := ^uint64(0)
 	if c.gcPercent >= 0 {
 		trigger = uint64(float64(c.heapMarked) * (1 + triggerRatio))
 		// Don't trigger below the minimum heap size.
 		minTrigger := c.heapMinimum
-		if !isSweepDone() {
-			// Concurrent sweep happens in the heap growth
-			// from gcController.heapLive to trigger, so ensure
-			// that concurrent sweep has some heap growth
-			// in which to perform sweeping before we
-			// start the next GC cycle.
-			sweepMin := atomic.Load64(&c.heapLive) + sweepMinHeapDistance
-			if sweepMin > minTrigger {
-				minTrigger = sweepMin
-			}
+		if sweepDistMinTrigger > minTrigger {
+			minTrigger = sweepDistMinTrigger
 		}
 		if trigger < minTrigger {
 			trigger = minTrigger
 		}
 		if int64(trigger) < 0 {
-			print("runtime: heapGoal=", c.heapGoal, " heapMarked=", c.heapMarked, " gcController.heapLive=", c.heapLive, " initialHeapLive=", work.initialHeapLive, "triggerRatio=", triggerRatio, " minTrigger=", minTrigger, "\n")
+			print("runtime: heapGoal=", goal, " heapMarked=", c.heapMarked, " gcController.heapLive=", c.heapLive, " initialHeapLive=", work.initialHeapLive, "triggerRatio=", triggerRatio, " minTrigger=", minTrigger, "\n")
 			throw("trigger underflow")
 		}
 		if trigger > goal {
@@ -730,9 +778,20 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 		}
 	}
 
-	// Commit to the trigger and goal.
-	c.trigger = trigger
-	atomic.Store64(&c.heapGoal, goal)
+	// If the memory limit lowers the goal, trigger the same fraction
+	// of the way to it as the trigger ratio would under GOGC alone.
+	fraction := memoryLimitTriggerFraction
+	if c.gcPercent > 0 {
+		fraction = triggerRatio / (float64(c.gcPercent) / 100)
+	}
+
+	// Commit to the trigger and goal. The memory limit is applied
+	// to them as they are read; see heapGoal and trigger.
+	atomic.Store64(&c.limitTriggerFraction, float64bits(fraction))
+	atomic.Store64(&c.sweepDistMinTrigger, sweepDistMinTrigger)
+	atomic.Store64(&c.gcPercentTrigger, trigger)
+	atomic.Store64(&c.gcPercentHeapGoal, goal)
+	trigger = c.trigger()
 	if trace.enabled {
 		traceHeapGoal()
 	}
@@ -779,6 +838,104 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 	gcPaceScavenger()
 }
 
+// heapGoal returns the goal heapLive for when the current or next GC
+// ends, or ^uint64(0) if GC is disabled.
+//
+// It is safe to call concurrently.
+func (c *gcControllerState) heapGoal() uint64 {
+	goal, _ := c.heapGoalInternal()
+	return goal
+}
+
+// heapGoalInternal is the implementation of heapGoal, which also
+// reports whether the memory limit rather than GOGC sets the goal.
+//
+// The memory limit lowers the goal even when GOGC=off, and unlike the
+// GOGC goal the result isn't bounded below by heapMinimum: keeping total
+// memory under the limit takes priority. If the heap can't fit under the
+// limit at all, GC runs back to back and gcCPULimiter bounds its cost.
+//
+// The memory the rest of the runtime uses changes between GC cycles,
+// so the limit is applied to the goal as of the call rather than when
+// the pacer last committed to a goal.
+func (c *gcControllerState) heapGoalInternal() (goal uint64, limited bool) {
+	goal = atomic.Load64(&c.gcPercentHeapGoal)
+	if limitGoal := c.memoryLimitHeapGoal(); limitGoal < goal {
+		goal, limited = limitGoal, true
+	}
+
+	// Ensure that the heap goal is at least a little larger than
+	// the live heap size when the current cycle started. This may
+	// not be the case if GC start is delayed or if the allocation
+	// that pushed gcController.heapLive over trigger is large or if
+	// the trigger is really close to GOGC. Assist is proportional to
+	// this distance, so enforce a minimum distance, even if it means
+	// going over the goal by a tiny bit.
+	if triggered := atomic.Load64(&c.triggered); triggered != ^uint64(0) && goal < triggered+1024*1024 {
+		goal = triggered + 1024*1024
+	}
+	return goal, limited
+}
+
+// trigger returns the heap size that triggers marking.
+//
+// When heapLive ≥ trigger, the mark phase will start.
+// This is also the heap size by which proportional sweeping
+// must be complete.
+//
+// Like heapGoal, it accounts for the memory limit as of the call.
+// It is safe to call concurrently.
+func (c *gcControllerState) trigger() uint64 {
+	trigger := atomic.Load64(&c.gcPercentTrigger)
+	goal, limited := c.heapGoalInternal()
+	if !limited {
+		return trigger
+	}
+	fraction := float64frombits(atomic.Load64(&c.limitTriggerFraction))
+	limitTrigger := c.heapMarked
+	if goal > c.heapMarked {
+		limitTrigger += uint64(float64(goal-c.heapMarked) * fraction)
+	}
+	// As for the GOGC trigger, leave room for concurrent sweep.
+	if sweepMin := atomic.Load64(&c.sweepDistMinTrigger); limitTrigger < sweepMin {
+		limitTrigger = sweepMin
+	}
+	if limitTrigger < trigger {
+		trigger = limitTrigger
+	}
+	return trigger
+}
+
+// memoryLimitHeapGoal returns the heap goal that keeps the total memory
+// used by the runtime under memoryLimit, or ^uint64(0) if there is no
+// memory limit.
+//
+// The heap may use whatever the limit leaves once the rest of the
+// runtime's memory (stacks, metadata, and so on) is accounted for. Free
+// heap memory that hasn't been released to the OS counts toward the
+// heap here, because it's the scavenger's job to release it; see
+// gcPaceScavenger.
+//
+// It is safe to call concurrently.
+func (c *gcControllerState) memoryLimitHeapGoal() uint64 {
+	limit := atomic.Loadint64(&c.memoryLimit)
+	if limit == maxInt64 {
+		return ^uint64(0)
+	}
+	mappedReady := memstats.mappedReady()
+	retained := heapRetained()
+	var nonHeap uint64
+	if mappedReady > retained {
+		nonHeap = mappedReady - retained
+	}
+	if uint64(limit) <= nonHeap {
+		// The limit is already exceeded without any heap at all.
+		return 0
+	}
+	goal := uint64(limit) - nonHeap
+	return goal - goal/100*memoryLimitHeadroomPercent
+}
+
 // effectiveGrowthRatio returns the current effective heap growth
 // ratio (GOGC/100) based on heapMarked from the previous GC and
 // heapGoal for the current GC.
@@ -791,7 +948,7 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 func (c *gcControllerState) effectiveGrowthRatio() float64 {
 	assertWorldStoppedOrLockHeld(&mheap_.lock)
 
-	egogc := float64(atomic.Load64(&c.heapGoal)-c.heapMarked) / float64(c.heapMarked)
+	egogc := float64(c.heapGoal()-c.heapMarked) / float64(c.heapMarked)
 	if egogc < 0 {
 		// Shouldn't happen, but just in case.
 		egogc = 0
@@ -846,3 +1003,45 @@ func readGOGC() int32 {
 	}
 	return 100
 }
+
+// setMemoryLimit updates memoryLimit and all related pacer state.
+// A negative limit leaves the limit unchanged. Returns the old value
+// of memoryLimit.
+//
+// The world must be stopped, or mheap_.lock must be held.
+func (c *gcControllerState) setMemoryLimit(in int64) int64 {
+	assertWorldStoppedOrLockHeld(&mheap_.lock)
+
+	out := c.memoryLimit
+	if in >= 0 {
+		atomic.Storeint64(&c.memoryLimit, in)
+	}
+	// Update pacing in response to memoryLimit change.
+	c.commit(c.triggerRatio)
+
+	return out
+}
+
+//go:linkname setMemoryLimit runtime/debug.setMemoryLimit
+func setMemoryLimit(in int64) (out int64) {
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		out = gcController.setMemoryLimit(in)
+		unlock(&mheap_.lock)
+	})
+	return out
+}
+
+func readGOMEMLIMIT() int64 {
+	p := gogetenv("GOMEMLIMIT")
+	if p == "" || p == "off" {
+		return maxInt64
+	}
+	n, ok := parseByteCount(p)
+	if !ok {
+		print("GOMEMLIMIT=", p, "\n")
+		throw("malformed GOMEMLIMIT; see `go doc runtime/debug.SetMemoryLimit`")
+	}
+	return n
+}
@@ -47,6 +47,12 @@
 // horizontal axis is time and vertical axis is estimated heap RSS, and the
 // scavenger attempts to stay below that line at all times.
 //
+// If a memory limit is set, the goal is further capped so that the total memory
+// mapped and in use by the runtime stays under memoryLimitScavengePercent of
+// the limit. The GC keeps the heap itself under the limit, but only the
+// scavenger can return the free pages the heap leaves behind, for example
+// after the live heap shrinks, or as stacks and other non-heap memory grow.
+//
 // The synchronous heap-growth scavenging happens whenever the heap grows in
 // size, for some definition of heap-growth. The intuition behind this is that
 // the application had to grow the heap because existing fragments were
@@ -77,6 +83,11 @@ const (
 	// the ever-changing layout of the heap.
 	retainExtraPercent = 10
 
+	// memoryLimitScavengePercent is the percentage of the memory limit
+	// that the scavenger aims to keep total runtime memory under. It is
+	// less than 100 so that there's some slack before the limit is hit.
+	memoryLimitScavengePercent = 95
+
 	// maxPagesPerPhysPage is the maximum number of supported runtime pages per
 	// physical page, based on maxPhysPageSize.
 	maxPagesPerPhysPage = maxPhysPageSize / pageSize
@@ -123,13 +134,17 @@ func gcPaceScavenger() {
 		return
 	}
 	// Compute our scavenging goal.
-	goalRatio := float64(atomic.Load64(&gcController.heapGoal)) / float64(gcController.lastHeapGoal)
+	goalRatio := float64(gcController.heapGoal()) / float64(gcController.lastHeapGoal)
 	retainedGoal := uint64(float64(memstats.last_heap_inuse) * goalRatio)
 	// Add retainExtraPercent overhead to retainedGoal. This calculation
 	// looks strange but the purpose is to arrive at an integer division
 	// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
 	// that also avoids the overflow from a multiplication.
 	retainedGoal += retainedGoal / (1.0 / (retainExtraPercent / 100.0))
+	// Cap the retained heap by what the memory limit leaves for it.
+	if limitGoal := memoryLimitRetainedGoal(); limitGoal < retainedGoal {
+		retainedGoal = limitGoal
+	}
 	// Align it to a physical page boundary to make the following calculations
 	// a bit more exact.
 	retainedGoal = (retainedGoal + uint64(physPageSize) - 1) &^ (uint64(physPageSize) - 1)
@@ -157,6 +172,27 @@ func gcPaceScavenger() {
 	mheap_.scavengeGoal = retainedGoal
 }
 
+// memoryLimitRetainedGoal returns the heap RSS under which total runtime
+// memory stays under memoryLimitScavengePercent of the memory limit, or
+// ^uint64(0) if there is no memory limit.
+func memoryLimitRetainedGoal() uint64 {
+	limit := atomic.Loadint64(&gcController.memoryLimit)
+	if limit == maxInt64 {
+		return ^uint64(0)
+	}
+	target := uint64(limit) / 100 * memoryLimitScavengePercent
+	mappedReady := memstats.mappedReady()
+	retained := heapRetained()
+	var nonHeap uint64
+	if mappedReady > retained {
+		nonHeap = mappedReady - retained
+	}
+	if target <= nonHeap {
+		return 0
+	}
+	return target - nonHeap
+}
+
 // Sleep/wait state of the background scavenger.
 var scavenge struct {
 	lock       mutex
@@ -811,6 +811,77 @@ func goroutineProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int
 	return n, ok
 }
 
+//go:linkname runtime_goroutineLeakProfileWithLabels runtime/pprof.runtime_goroutineLeakProfileWithLabels
+func runtime_goroutineLeakProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int, ok bool) {
+	return goroutineLeakProfileWithLabels(p, labels)
+}
+
+// goroutineLeakProfileWithLabels is like goroutineProfileWithLabels,
+// but only records the goroutines found leaked by the last GC cycle
+// that looked for them. See mgcleak.go.
+func goroutineLeakProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int, ok bool) {
+	if labels != nil && len(labels) != len(p) {
+		labels = nil
+	}
+
+	isOK := func(gp1 *g) bool {
+		return gp1.leaked && gp1.maybeLeaked()
+	}
+
+	stopTheWorld("profile")
+
+	// World is stopped, no locking required.
+	forEachGRace(func(gp1 *g) {
+		if isOK(gp1) {
+			n++
+		}
+	})
+
+	if n <= len(p) {
+		ok = true
+		r, lbl := p, labels
+		forEachGRace(func(gp1 *g) {
+			if !isOK(gp1) {
+				return
+			}
+
+			if len(r) == 0 {
+				// Should be impossible, but better to return a
+				// truncated profile than to crash the entire process.
+				return
+			}
+			saveLeakedg(gp1, &r[0])
+			if labels != nil {
+				lbl[0] = gp1.labels
+				lbl = lbl[1:]
+			}
+			r = r[1:]
+		})
+	}
+
+	startTheWorld()
+	return n, ok
+}
+
+// saveLeakedg is like saveg for a goroutine that is not running, but
+// records the go statement that created gp as the caller of its
+// entry function, instead of goexit.
+func saveLeakedg(gp *g, r *StackRecord) {
+	n := gentraceback(^uintptr(0), ^uintptr(0), 0, gp, 0, &r.Stack0[0], len(r.Stack0), nil, nil, 0)
+	if n > 0 {
+		if f := findfunc(r.Stack0[n-1]); f.valid() && f.funcID == funcID_goexit {
+			n--
+		}
+	}
+	if n < len(r.Stack0) && gp.gopc != 0 {
+		r.Stack0[n] = gp.gopc
+		n++
+	}
+	if n < len(r.Stack0) {
+		r.Stack0[n] = 0
+	}
+}
+
 // GoroutineProfile returns n, the number of records in the active goroutine stack profile.
 // If len(p) >= n, GoroutineProfile copies the profile into p and returns n, true.
 // If len(p) < n, GoroutineProfile does not change p and returns n, false.
@@ -36,6 +36,7 @@ type mstats struct {
 	heap_sys      sysMemStat // virtual address space obtained from system for GC'd heap
 	heap_inuse    uint64     // bytes in mSpanInUse spans
 	heap_released uint64     // bytes released to the os
+	manual_inuse  uint64     // bytes in manually-managed spans, which heap_sys excludes
 
 	// heap_objects is not used by the runtime directly and instead
 	// computed on the fly by updatememstats.
@@ -70,6 +71,8 @@ type mstats struct {
 	pause_end       [256]uint64 // circular buffer of recent gc end times (nanoseconds since 1970)
 	numgc           uint32
 	numforcedgc     uint32  // number of user-forced GCs
+	numlimitedgc    uint32  // number of automatic GCs paced against the memory limit
+	_               uint32  // keep the fields below 64-bit aligned on 32-bit platforms
 	gc_cpu_fraction float64 // fraction of CPU time used by GC
 	enablegc        bool
 	debuggc         bool
@@ -453,7 +456,7 @@ func readmemstats_m(stats *MemStats) {
 	// at a more granular level in the runtime.
 	stats.GCSys = memstats.gcMiscSys.load() + memstats.gcWorkBufInUse + memstats.gcProgPtrScalarBitsInUse
 	stats.OtherSys = memstats.other_sys.load()
-	stats.NextGC = gcController.heapGoal
+	stats.NextGC = gcController.heapGoal()
 	stats.LastGC = memstats.last_gc_unix
 	stats.PauseTotalNs = memstats.pause_total_ns
 	stats.PauseNs = memstats.pause_ns
@@ -606,6 +609,7 @@ func updatememstats() {
 	//
 	// * heap_inuse == inHeap
 	// * heap_released == released
+	// * manual_inuse == inStacks + inWorkBufs + inPtrScalarBits
 	// * heap_sys - heap_released == committed - inStacks - inWorkBufs - inPtrScalarBits
 	//
 	// Check if that's actually true.
@@ -623,6 +627,11 @@ func updatememstats() {
 		print("runtime: consistent value=", consStats.released, "\n")
 		throw("heap_released and consistent stats are not equal")
 	}
+	if consManual := uint64(consStats.inStacks + consStats.inWorkBufs + consStats.inPtrScalarBits); memstats.manual_inuse != consManual {
+		print("runtime: manual_inuse=", memstats.manual_inuse, "\n")
+		print("runtime: consistent value=", consManual, "\n")
+		throw("manual_inuse and consistent stats are not equal")
+	}
 	globalRetained := memstats.heap_sys.load() - memstats.heap_released
 	consRetained := uint64(consStats.committed - consStats.inStacks - consStats.inWorkBufs - consStats.inPtrScalarBits)
 	if globalRetained != consRetained {
@@ -662,6 +671,20 @@ func flushallmcaches() {
 	}
 }
 
+// mappedReady returns the total bytes of memory the runtime has mapped
+// and is using, or could use without faulting in more memory: every
+// *_sys statistic, including heap memory handed out to manually-managed
+// spans, but not heap memory released to the OS. This is what the
+// memory limit is measured against.
+//
+// The result is computed from independently updated statistics, so it
+// may be slightly skewed, but it doesn't require stopping the world.
+func (s *mstats) mappedReady() uint64 {
+	return s.heap_sys.load() + atomic.Load64(&s.manual_inuse) - atomic.Load64(&s.heap_released) +
+		s.stacks_sys.load() + s.mspan_sys.load() + s.mcache_sys.load() +
+		s.buckhash_sys.load() + s.gcMiscSys.load() + s.other_sys.load()
+}
+
 // sysMemStat represents a global system statistic that is managed atomically.
 //
 // This type must structurally be a uint64 so that mstats aligns with MemStats.
@@ -99,12 +99,13 @@ import (
 //
 // Each Profile has a unique name. A few profiles are predefined:
 //
-//	goroutine    - stack traces of all current goroutines
-//	heap         - a sampling of memory allocations of live objects
-//	allocs       - a sampling of all past memory allocations
-//	threadcreate - stack traces that led to the creation of new OS threads
-//	block        - stack traces that led to blocking on synchronization primitives
-//	mutex        - stack traces of holders of contended mutexes
+//	goroutine     - stack traces of all current goroutines
+//	goroutineleak - stack traces of goroutines blocked forever
+//	heap          - a sampling of memory allocations of live objects
+//	allocs        - a sampling of all past memory allocations
+//	threadcreate  - stack traces that led to the creation of new OS threads
+//	block         - stack traces that led to blocking on synchronization primitives
+//	mutex         - stack traces of holders of contended mutexes
 //
 // These predefined profiles maintain themselves and panic on an explicit
 // Add or Remove method call.
@@ -126,6 +127,17 @@ import (
 // pprof display to -alloc_space, the total number of bytes allocated since
 // the program began (including garbage-collected bytes).
 //
+// The goroutineleak profile reports the goroutines blocked on a channel,
+// sync.Mutex, sync.RWMutex, sync.WaitGroup or sync.Cond that no
+// goroutine that may run again can reach, and that can therefore never
+// be woken. Writing the profile runs a garbage collection to find them.
+// Each stack trace starts with the operation the goroutine is blocked in,
+// and ends with the go statement that created the goroutine. Goroutines
+// that are blocked forever on other operations, on nil channels or in
+// an empty select statement are not reported, and neither are those
+// whose blocking object is referred to by a deferred call that is not
+// allocated on their stack.
+//
 // The CPU profile is not available as a Profile. It has a special API,
 // the StartCPUProfile and StopCPUProfile functions, because it streams
 // output to a writer during profiling.
@@ -150,6 +162,12 @@ var goroutineProfile = &Profile{
 	write: writeGoroutine,
 }
 
+var goroutineLeakProfile = &Profile{
+	name:  "goroutineleak",
+	count: countGoroutineLeak,
+	write: writeGoroutineLeak,
+}
+
 var threadcreateProfile = &Profile{
 	name:  "threadcreate",
 	count: countThreadCreate,
@@ -185,12 +203,13 @@ func lockProfiles() {
 	if profiles.m == nil {
 		// Initial built-in profiles.
 		profiles.m = map[string]*Profile{
-			"goroutine":    goroutineProfile,
-			"threadcreate": threadcreateProfile,
-			"heap":         heapProfile,
-			"allocs":       allocsProfile,
-			"block":        blockProfile,
-			"mutex":        mutexProfile,
+			"goroutine":     goroutineProfile,
+			"goroutineleak": goroutineLeakProfile,
+			"threadcreate":  threadcreateProfile,
+			"heap":          heapProfile,
+			"allocs":        allocsProfile,
+			"block":         blockProfile,
+			"mutex":         mutexProfile,
 		}
 	}
 }
@@ -684,6 +703,26 @@ func writeGoroutine(w io.Writer, debug int) error {
 	return writeRuntimeProfile(w, debug, "goroutine", runtime_goroutineProfileWithLabels)
 }
 
+// countGoroutineLeak returns the number of leaked goroutines found by
+// the last goroutineleak profile written.
+func countGoroutineLeak() int {
+	n, _ := runtime_goroutineLeakProfileWithLabels(nil, nil)
+	return n
+}
+
+// runtime_goroutineLeakGC is defined in runtime/mgcleak.go
+func runtime_goroutineLeakGC()
+
+// runtime_goroutineLeakProfileWithLabels is defined in runtime/mprof.go
+func runtime_goroutineLeakProfileWithLabels(p []runtime.StackRecord, labels []unsafe.Pointer) (n int, ok bool)
+
+// writeGoroutineLeak runs a garbage collection that finds the leaked
+// goroutines, and writes their profile to w.
+func writeGoroutineLeak(w io.Writer, debug int) error {
+	runtime_goroutineLeakGC()
+	return writeRuntimeProfile(w, debug, "goroutineleak", runtime_goroutineLeakProfileWithLabels)
+}
+
 func writeGoroutineStacks(w io.Writer) error {
 	// We don't know how big the buffer needs to be to collect
 	// all the goroutines. Start with 1 MB and try a few times, doubling each time.
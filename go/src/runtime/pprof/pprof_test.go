@@ -1130,6 +1130,154 @@ func TestGoroutineCounts(t *testing.T) {
 	time.Sleep(10 * time.Millisecond) // let goroutines exit
 }
 
+// leakTestChan is reachable from a global variable, so goroutines
+// blocked on it are not leaked.
+var leakTestChan chan int
+
+//go:noinline
+func leakChanRecv() {
+	c := make(chan int)
+	go func() {
+		<-c
+	}()
+}
+
+//go:noinline
+func leakSelect() {
+	c1, c2 := make(chan int), make(chan int)
+	go func() {
+		select {
+		case <-c1:
+		case c2 <- 1:
+		}
+	}()
+}
+
+//go:noinline
+func leakMutex() {
+	var mu sync.Mutex
+	mu.Lock()
+	go func() {
+		mu.Lock()
+	}()
+}
+
+//go:noinline
+func leakWaitGroup() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wg.Wait()
+	}()
+}
+
+//go:noinline
+func leakCond() {
+	c := sync.NewCond(new(sync.Mutex))
+	go func() {
+		c.L.Lock()
+		c.Wait()
+	}()
+}
+
+// leakChain leaks a goroutine blocked on a channel that only another
+// leaked goroutine can reach.
+//
+//go:noinline
+func leakChain() {
+	c := make(chan int)
+	go func() {
+		<-c
+	}()
+	go func() {
+		d := make(chan int)
+		<-d
+		c <- 1
+	}()
+}
+
+func TestGoroutineLeakProfile(t *testing.T) {
+	leakTestChan = make(chan int)
+	defer close(leakTestChan)
+	go func() {
+		<-leakTestChan
+	}()
+
+	leakChanRecv()
+	leakSelect()
+	leakMutex()
+	leakWaitGroup()
+	leakCond()
+	leakChain()
+
+	const pkg = "runtime/pprof."
+	want := []struct {
+		fn, creator string
+	}{
+		{"leakChanRecv.func1", "leakChanRecv"},
+		{"leakSelect.func1", "leakSelect"},
+		{"leakMutex.func1", "leakMutex"},
+		{"leakWaitGroup.func1", "leakWaitGroup"},
+		{"leakCond.func1", "leakCond"},
+		{"leakChain.func1", "leakChain"},
+		{"leakChain.func2", "leakChain"},
+	}
+	found := func(stks [][]string, fn, creator string) bool {
+		for _, stk := range stks {
+			if len(stk) > 0 && stk[len(stk)-1] == pkg+creator && contains(stk, pkg+fn) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The goroutines may take a while to block.
+	var stks [][]string
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		if err := Lookup("goroutineleak").WriteTo(&buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		p, err := profile.Parse(&buf)
+		if err != nil {
+			t.Fatalf("error parsing protobuf profile: %v", err)
+		}
+		if err := p.CheckValid(); err != nil {
+			t.Fatalf("protobuf profile is invalid: %v", err)
+		}
+		stks = stacks(p)
+		missing := false
+		for _, w := range want {
+			if !found(stks, w.fn, w.creator) {
+				missing = true
+			}
+		}
+		if !missing {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, w := range want {
+		if !found(stks, w.fn, w.creator) {
+			t.Errorf("no leaked goroutine running %s%s created by %s%s", pkg, w.fn, pkg, w.creator)
+		}
+	}
+	if found(stks, "TestGoroutineLeakProfile.func1", "TestGoroutineLeakProfile") {
+		t.Errorf("goroutine blocked on a reachable channel reported as leaked")
+	}
+	if t.Failed() {
+		t.Logf("leaked goroutines: %v", stks)
+	}
+
+	// The debug=1 form lists the same goroutines.
+	var buf bytes.Buffer
+	Lookup("goroutineleak").WriteTo(&buf, 1)
+	if prof := buf.String(); !strings.HasPrefix(prof, "goroutineleak profile: total ") || !strings.Contains(prof, pkg+"leakChanRecv.func1") {
+		t.Errorf("unexpected debug=1 goroutineleak profile:\n%s", prof)
+	}
+}
+
 func containsInOrder(s string, all ...string) bool {
 	for _, t := range all {
 		i := strings.Index(s, t)
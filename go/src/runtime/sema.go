@@ -141,6 +141,7 @@ func semacquire1(addr *uint32, lifo bool, profile semaProfileFlags, skipframes i
 		// Any semrelease after the cansemacquire knows we're waiting
 		// (we set nwait above), so go to sleep.
 		root.queue(addr, s, lifo)
+		gp.waitobj = uintptr(unsafe.Pointer(addr))
 		goparkunlock(&root.lock, waitReasonSemacquire, traceEvGoBlockSync, 4+skipframes)
 		if s.ticket != 0 || cansemacquire(addr) {
 			break
@@ -218,6 +219,30 @@ func semroot(addr *uint32) *semaRoot {
 	return &semtable[(uintptr(unsafe.Pointer(addr))>>3)%semTabSize].root
 }
 
+// forEachSemaWaiter calls f for each sudog queued on a semaphore.
+// The world must be stopped.
+func forEachSemaWaiter(f func(s *sudog)) {
+	assertWorldStopped()
+
+	for i := range semtable {
+		semaForEachWaiter(semtable[i].root.treap, f)
+	}
+}
+
+// semaForEachWaiter calls f for each sudog in the subtree of a
+// semaRoot treap rooted at t, and in their lists of waiters for the
+// same address.
+func semaForEachWaiter(t *sudog, f func(s *sudog)) {
+	if t == nil {
+		return
+	}
+	semaForEachWaiter(t.prev, f)
+	for s := t; s != nil; s = s.waitlink {
+		f(s)
+	}
+	semaForEachWaiter(t.next, f)
+}
+
 func cansemacquire(addr *uint32) bool {
 	for {
 		v := atomic.Load(addr)
@@ -510,6 +535,7 @@ func notifyListWait(l *notifyList, t uint32) {
 		l.tail.next = s
 	}
 	l.tail = s
+	s.g.waitobj = uintptr(unsafe.Pointer(l))
 	goparkunlock(&l.lock, waitReasonSyncCondWait, traceEvGoBlockCond, 3)
 	if t0 != 0 {
 		blockevent(s.releasetime-t0, 2)
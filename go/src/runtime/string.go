@@ -401,6 +401,62 @@ func atoi32(s string) (int32, bool) {
 	return 0, false
 }
 
+// parseByteCount parses a non-negative count of bytes with an optional
+// unit suffix: B, or one of the binary prefixed units KiB, MiB, GiB and
+// TiB. That is, s must match
+//
+//	^[0-9]+(([KMGT]i)?B)?$
+//
+// The bool result reports whether s is well-formed and the count is
+// representable by a value of type int64.
+func parseByteCount(s string) (int64, bool) {
+	shift := uint(0)
+	if len(s) > 0 && s[len(s)-1] == 'B' {
+		s = s[:len(s)-1]
+		if len(s) > 0 && s[len(s)-1] == 'i' {
+			if len(s) < 2 {
+				return 0, false
+			}
+			switch s[len(s)-2] {
+			case 'K':
+				shift = 10
+			case 'M':
+				shift = 20
+			case 'G':
+				shift = 30
+			case 'T':
+				shift = 40
+			default:
+				return 0, false
+			}
+			s = s[:len(s)-2]
+		}
+	}
+	if s == "" {
+		return 0, false
+	}
+	un := uint64(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		if un > maxInt64/10 {
+			// overflow
+			return 0, false
+		}
+		un = un*10 + uint64(c-'0')
+		if un > maxInt64 {
+			// overflow
+			return 0, false
+		}
+	}
+	if un > maxInt64>>shift {
+		return 0, false
+	}
+	return int64(un << shift), true
+}
+
 //go:nosplit
 func findnull(s *byte) int {
 	if s == nil {
@@ -9,11 +9,19 @@
 // in a compact form. A precise nanosecond-precision timestamp and a stack
 // trace is captured for most events.
 // See https://golang.org/s/go15trace for more info.
+//
+// The trace is divided into partitions, which the tracer ends every
+// time traceAdvance is called, and when tracing stops. Each partition
+// is self-contained: it has its own string dictionary and stack table,
+// it starts with the state of all goroutines, as the trace itself did
+// before partitions existed, and it ends with a traceEvPartition event
+// that gives the clock readings needed to interpret its timestamps.
+// A reader can therefore parse the trace one partition at a time, and
+// start from any partition.
 
 package runtime
 
 import (
-	"runtime/internal/atomic"
 	"runtime/internal/sys"
 	"unsafe"
 )
@@ -22,7 +30,7 @@ import (
 const (
 	traceEvNone              = 0  // unused
 	traceEvBatch             = 1  // start of per-P batch of events [pid, timestamp]
-	traceEvFrequency         = 2  // contains tracer timer frequency [frequency (ticks per second)]
+	traceEvFrequency         = 2  // not currently used; previously contained tracer timer frequency [frequency (ticks per second)]
 	traceEvStack             = 3  // stack [stack id, number of PCs, array of {PC, func string ID, file string ID, line}]
 	traceEvGomaxprocs        = 4  // current value of GOMAXPROCS [timestamp, GOMAXPROCS, stack id]
 	traceEvProcStart         = 5  // start of P [timestamp, thread id]
@@ -69,7 +77,8 @@ const (
 	traceEvUserTaskEnd       = 46 // end of a task [timestamp, internal task id, stack]
 	traceEvUserRegion        = 47 // trace.WithRegion [timestamp, internal task id, mode(0:start, 1:end), stack, name string]
 	traceEvUserLog           = 48 // trace.Log [timestamp, internal task id, key string id, stack, value string]
-	traceEvCount             = 49
+	traceEvPartition         = 49 // end of partition [partition seq, start ticks, start nanotime, end ticks, end nanotime]
+	traceEvCount             = 50
 	// Byte is used but only 6 bits are available for event type.
 	// The remaining 2 bits are used to specify the number of arguments.
 	// That means, the max event type value is 63.
@@ -107,35 +116,41 @@ const (
 
 // trace is global tracing context.
 var trace struct {
-	lock          mutex       // protects the following members
-	lockOwner     *g          // to avoid deadlocks during recursive lock locks
-	enabled       bool        // when set runtime traces events
-	shutdown      bool        // set when we are waiting for trace reader to finish after setting enabled to false
-	headerWritten bool        // whether ReadTrace has emitted trace header
-	footerWritten bool        // whether ReadTrace has emitted trace footer
-	shutdownSema  uint32      // used to wait for ReadTrace completion
-	seqStart      uint64      // sequence number when tracing was started
-	ticksStart    int64       // cputicks when tracing was started
-	ticksEnd      int64       // cputicks when tracing was stopped
-	timeStart     int64       // nanotime when tracing was started
-	timeEnd       int64       // nanotime when tracing was stopped
-	seqGC         uint64      // GC start/done sequencer
-	reading       traceBufPtr // buffer currently handed off to user
-	empty         traceBufPtr // stack of empty buffers
-	fullHead      traceBufPtr // queue of full buffers
-	fullTail      traceBufPtr
-	reader        guintptr        // goroutine that called ReadTrace, or nil
-	stackTab      traceStackTable // maps stack traces to unique ids
-
-	// Dictionary for traceEvString.
-	//
-	// TODO: central lock to access the map is not ideal.
-	//   option: pre-assign ids to all user annotation region names and tags
-	//   option: per-P cache
-	//   option: sync.Map like data structure
-	stringsLock mutex
-	strings     map[string]uint64
-	stringSeq   uint64
+	lock          mutex         // protects the following members
+	lockOwner     *g            // to avoid deadlocks during recursive lock locks
+	enabled       bool          // when set runtime traces events
+	shutdown      bool          // set when we are waiting for trace reader to finish after setting enabled to false
+	headerWritten bool          // whether ReadTrace has emitted trace header
+	shutdownSema  uint32        // used to wait for ReadTrace completion
+	sealedSema    uint32        // used to wait for ReadTrace to return the sealed partition
+	sealedWaiters uint32        // number of goroutines waiting on sealedSema
+	partition     uint64        // sequence number of the current partition
+	ticksStart    int64         // cputicks when the current partition was started
+	timeStart     int64         // nanotime when the current partition was started
+	seqGC         uint64        // GC start/done sequencer
+	reading       traceBufPtr   // buffer currently handed off to user
+	empty         traceBufPtr   // stack of empty buffers
+	full          traceBufQueue // queue of full buffers of the current partition
+	reader        guintptr      // goroutine that called ReadTrace, or nil
+
+	// sealed is the partition that was ended last, as long as
+	// ReadTrace has not returned all of it.
+	sealed struct {
+		pending    bool          // ReadTrace has not returned the end of the partition
+		dumped     bool          // the stack table has been dumped to bufs
+		seq        uint64        // partition sequence number
+		ticksStart int64         // cputicks when the partition was started
+		ticksEnd   int64         // cputicks when the partition was ended
+		timeStart  int64         // nanotime when the partition was started
+		timeEnd    int64         // nanotime when the partition was ended
+		bufs       traceBufQueue // full buffers not yet returned by ReadTrace
+	}
+
+	// Stack tables and dictionaries for traceEvString, indexed by
+	// partition%2: the current partition uses one, while the reader
+	// dumps the stacks of the sealed partition from the other.
+	stackTab [2]traceStackTable  // maps stack traces to unique ids
+	strings  [2]traceStringTable // maps strings to unique ids
 
 	// markWorkerLabels maps gcMarkWorkerMode to string ID.
 	markWorkerLabels [len(gcMarkWorkerModeStrings)]uint64
@@ -175,6 +190,52 @@ func traceBufPtrOf(b *traceBuf) traceBufPtr {
 	return traceBufPtr(unsafe.Pointer(b))
 }
 
+// traceBufQueue is a FIFO of traceBufs.
+type traceBufQueue struct {
+	head, tail traceBufPtr
+}
+
+// push queues buf into queue of buffers.
+func (q *traceBufQueue) push(buf traceBufPtr) {
+	buf.ptr().link = 0
+	if q.head == 0 {
+		q.head = buf
+	} else {
+		q.tail.ptr().link = buf
+	}
+	q.tail = buf
+}
+
+// pop dequeues from the queue of buffers.
+func (q *traceBufQueue) pop() traceBufPtr {
+	buf := q.head
+	if buf == 0 {
+		return 0
+	}
+	q.head = buf.ptr().link
+	if q.head == 0 {
+		q.tail = 0
+	}
+	buf.ptr().link = 0
+	return buf
+}
+
+func (q *traceBufQueue) empty() bool {
+	return q.head == 0
+}
+
+// traceStringTable is a dictionary for traceEvString.
+//
+// TODO: central lock to access the map is not ideal.
+//   option: pre-assign ids to all user annotation region names and tags
+//   option: per-P cache
+//   option: sync.Map like data structure
+type traceStringTable struct {
+	lock mutex
+	seq  uint64
+	tab  map[string]uint64
+}
+
 // StartTrace enables tracing for the current process.
 // While tracing, the data will be buffered and available via ReadTrace.
 // StartTrace returns an error if tracing is already enabled.
@@ -205,6 +266,14 @@ func StartTrace() error {
 		return errorString("tracing is already enabled")
 	}
 
+	// string to id mapping
+	//  0 : reserved for an empty string
+	//  remaining: other strings registered by traceString
+	trace.partition = 0
+	trace.strings[0].seq = 0
+	trace.strings[0].tab = make(map[string]uint64)
+	trace.headerWritten = false
+
 	// Can't set trace.enabled yet. While the world is stopped, exitsyscall could
 	// already emit a delayed event (see exitTicks in exitsyscall) if we set trace.enabled here.
 	// That would lead to an inconsistent trace:
@@ -221,56 +290,11 @@ func StartTrace() error {
 	stackID := traceStackID(mp, stkBuf, 2)
 	releasem(mp)
 
-	// World is stopped, no need to lock.
-	forEachGRace(func(gp *g) {
-		status := readgstatus(gp)
-		if status != _Gdead {
-			gp.traceseq = 0
-			gp.tracelastp = getg().m.p
-			// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
-			id := trace.stackTab.put([]uintptr{gp.startpc + sys.PCQuantum})
-			traceEvent(traceEvGoCreate, -1, uint64(gp.goid), uint64(id), stackID)
-		}
-		if status == _Gwaiting {
-			// traceEvGoWaiting is implied to have seq=1.
-			gp.traceseq++
-			traceEvent(traceEvGoWaiting, -1, uint64(gp.goid))
-		}
-		if status == _Gsyscall {
-			gp.traceseq++
-			traceEvent(traceEvGoInSyscall, -1, uint64(gp.goid))
-		} else {
-			gp.sysblocktraced = false
-		}
-	})
-	traceProcStart()
-	traceGoStart()
-	// Note: ticksStart needs to be set after we emit traceEvGoInSyscall events.
-	// If we do it the other way around, it is possible that exitsyscall will
-	// query sysexitticks after ticksStart but before traceEvGoInSyscall timestamp.
-	// It will lead to a false conclusion that cputicks is broken.
-	trace.ticksStart = cputicks()
-	trace.timeStart = nanotime()
-	trace.headerWritten = false
-	trace.footerWritten = false
+	traceStartPartition(stackID)
 
-	// string to id mapping
-	//  0 : reserved for an empty string
-	//  remaining: other strings registered by traceString
-	trace.stringSeq = 0
-	trace.strings = make(map[string]uint64)
-
-	trace.seqGC = 0
 	_g_.m.startingtrace = false
 	trace.enabled = true
 
-	// Register runtime goroutine labels.
-	_, pid, bufp := traceAcquireBuffer()
-	for i, label := range gcMarkWorkerModeStrings[:] {
-		trace.markWorkerLabels[i], bufp = traceString(bufp, pid, label)
-	}
-	traceReleaseBuffer(pid)
-
 	unlock(&trace.bufLock)
 
 	unlock(&sched.sysmonlock)
@@ -284,49 +308,12 @@ func StartTrace() error {
 func StopTrace() {
 	// Stop the world so that we can collect the trace buffers from all p's below,
 	// and also to avoid races with traceEvent.
-	stopTheWorldGC("stop tracing")
-
-	// See the comment in StartTrace.
-	lock(&sched.sysmonlock)
-
-	// See the comment in StartTrace.
-	lock(&trace.bufLock)
-
-	if !trace.enabled {
-		unlock(&trace.bufLock)
-		unlock(&sched.sysmonlock)
-		startTheWorldGC()
+	if !traceStopTheWorld("stop tracing") {
 		return
 	}
 
 	traceGoSched()
-
-	// Loop over all allocated Ps because dead Ps may still have
-	// trace buffers.
-	for _, p := range allp[:cap(allp)] {
-		buf := p.tracebuf
-		if buf != 0 {
-			traceFullQueue(buf)
-			p.tracebuf = 0
-		}
-	}
-	if trace.buf != 0 {
-		buf := trace.buf
-		trace.buf = 0
-		if buf.ptr().pos != 0 {
-			traceFullQueue(buf)
-		}
-	}
-
-	for {
-		trace.ticksEnd = cputicks()
-		trace.timeEnd = nanotime()
-		// Windows time can tick only every 15ms, wait for at least one tick.
-		if trace.timeEnd != trace.timeStart {
-			break
-		}
-		osyield()
-	}
+	traceEndPartition()
 
 	trace.enabled = false
 	trace.shutdown = true
@@ -353,7 +340,7 @@ func StopTrace() {
 	if trace.buf != 0 {
 		throw("trace: non-empty global trace buffer")
 	}
-	if trace.fullHead != 0 || trace.fullTail != 0 {
+	if !trace.full.empty() || trace.sealed.pending || !trace.sealed.bufs.empty() {
 		throw("trace: non-empty full trace buffer")
 	}
 	if trace.reading != 0 || trace.reader != 0 {
@@ -364,11 +351,204 @@ func StopTrace() {
 		trace.empty = buf.ptr().link
 		sysFree(unsafe.Pointer(buf), unsafe.Sizeof(*buf.ptr()), &memstats.other_sys)
 	}
-	trace.strings = nil
+	for i := range trace.strings {
+		trace.strings[i].tab = nil
+	}
 	trace.shutdown = false
 	unlock(&trace.lock)
 }
 
+// traceAdvance ends the current partition of the trace and starts a
+// new one. It returns the sequence number of the partition it ended,
+// and false if tracing is not enabled.
+//
+// Only one ended partition can be pending, so traceAdvance first waits
+// for ReadTrace to return all of the previous one. It blocks for as long
+// as that takes, without stopping the world.
+func traceAdvance() (uint64, bool) {
+	if !traceStopTheWorld("trace partition") {
+		return 0, false
+	}
+
+	// Allocate before ending the partition: allocation can emit events,
+	// which must not precede the goroutine states of the next partition.
+	next := trace.partition + 1
+	strs := make(map[string]uint64)
+	stkBuf := make([]uintptr, traceStackSize)
+
+	// End the partition as StopTrace does, and also stop the P, which
+	// the next partition starts as StartTrace does. This makes the
+	// events of consecutive partitions consistent with each other.
+	traceGoSched()
+	traceEvent(traceEvProcStop, -1)
+	seq := trace.partition
+	traceEndPartition()
+
+	trace.partition = next
+	trace.strings[next%2].seq = 0
+	trace.strings[next%2].tab = strs
+
+	// Obtain current stack ID to use in all traceEvGoCreate events below.
+	mp := acquirem()
+	stackID := traceStackID(mp, stkBuf, 2)
+	releasem(mp)
+
+	traceStartPartition(stackID)
+
+	unlock(&trace.bufLock)
+
+	unlock(&sched.sysmonlock)
+
+	startTheWorldGC()
+	return seq, true
+}
+
+// traceStopTheWorld stops the world, and acquires the locks StopTrace
+// and traceAdvance need, for ending the current partition. If a sealed
+// partition is pending, it waits for ReadTrace to return all of it
+// first, with the world running. traceStopTheWorld returns false, with
+// the world started and the locks released, if tracing is not enabled.
+func traceStopTheWorld(reason string) bool {
+	for {
+		traceWaitSealed()
+
+		stopTheWorldGC(reason)
+
+		// See the comment in StartTrace.
+		lock(&sched.sysmonlock)
+
+		// See the comment in StartTrace.
+		lock(&trace.bufLock)
+
+		if !trace.enabled {
+			unlock(&trace.bufLock)
+			unlock(&sched.sysmonlock)
+			startTheWorldGC()
+			return false
+		}
+
+		lock(&trace.lock)
+		pending := trace.sealed.pending
+		unlock(&trace.lock)
+		if !pending {
+			return true
+		}
+
+		// Another goroutine ended a partition after we waited.
+		unlock(&trace.bufLock)
+		unlock(&sched.sysmonlock)
+		startTheWorldGC()
+	}
+}
+
+// traceWaitSealed waits until ReadTrace has returned all of the
+// sealed partition, if one is pending.
+func traceWaitSealed() {
+	for {
+		lock(&trace.lock)
+		if !trace.sealed.pending {
+			unlock(&trace.lock)
+			return
+		}
+		trace.sealedWaiters++
+		unlock(&trace.lock)
+		semacquire(&trace.sealedSema)
+	}
+}
+
+// traceStartPartition emits the events that the rest of the current
+// partition builds on: the state of all goroutines, using stackID as the
+// stack of their traceEvGoCreate events, and the start of the current
+// goroutine and P. The world must be stopped, trace.bufLock held, and
+// the string dictionary of the partition allocated.
+func traceStartPartition(stackID uint64) {
+	// World is stopped, no need to lock.
+	forEachGRace(func(gp *g) {
+		status := readgstatus(gp)
+		if status != _Gdead {
+			gp.traceseq = 0
+			gp.tracelastp = getg().m.p
+			// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
+			id := trace.stackTab[trace.partition%2].put([]uintptr{gp.startpc + sys.PCQuantum})
+			traceEvent(traceEvGoCreate, -1, uint64(gp.goid), uint64(id), stackID)
+		}
+		if status == _Gwaiting {
+			// traceEvGoWaiting is implied to have seq=1.
+			gp.traceseq++
+			traceEvent(traceEvGoWaiting, -1, uint64(gp.goid))
+		}
+		if status == _Gsyscall {
+			gp.traceseq++
+			traceEvent(traceEvGoInSyscall, -1, uint64(gp.goid))
+		} else {
+			gp.sysblocktraced = false
+		}
+	})
+	traceProcStart()
+	traceGoStart()
+	// Note: ticksStart needs to be set after we emit traceEvGoInSyscall events.
+	// If we do it the other way around, it is possible that exitsyscall will
+	// query sysexitticks after ticksStart but before traceEvGoInSyscall timestamp.
+	// It will lead to a false conclusion that cputicks is broken.
+	trace.ticksStart = cputicks()
+	trace.timeStart = nanotime()
+
+	trace.seqGC = 0
+
+	// Register runtime goroutine labels.
+	_, pid, bufp := traceAcquireBuffer()
+	for i, label := range gcMarkWorkerModeStrings[:] {
+		trace.markWorkerLabels[i], bufp = traceString(bufp, pid, label)
+	}
+	traceReleaseBuffer(pid)
+}
+
+// traceEndPartition seals the current partition: it queues the trace
+// buffers of all Ps onto trace.sealed, which ReadTrace returns before
+// any buffer of the next partition. The world must be stopped,
+// trace.bufLock held, and no sealed partition pending.
+func traceEndPartition() {
+	var ticksEnd, timeEnd int64
+	for {
+		ticksEnd = cputicks()
+		timeEnd = nanotime()
+		// Windows time can tick only every 15ms, wait for at least one tick.
+		if timeEnd != trace.timeStart {
+			break
+		}
+		osyield()
+	}
+
+	lock(&trace.lock)
+	// Loop over all allocated Ps because dead Ps may still have
+	// trace buffers.
+	for _, p := range allp[:cap(allp)] {
+		buf := p.tracebuf
+		if buf != 0 {
+			trace.full.push(buf)
+			p.tracebuf = 0
+		}
+	}
+	if trace.buf != 0 {
+		buf := trace.buf
+		trace.buf = 0
+		if buf.ptr().pos != 0 {
+			trace.full.push(buf)
+		}
+	}
+	s := &trace.sealed
+	s.pending = true
+	s.dumped = false
+	s.seq = trace.partition
+	s.ticksStart = trace.ticksStart
+	s.ticksEnd = ticksEnd
+	s.timeStart = trace.timeStart
+	s.timeEnd = timeEnd
+	s.bufs = trace.full
+	trace.full = traceBufQueue{}
+	unlock(&trace.lock)
+}
+
 // ReadTrace returns the next chunk of binary tracing data, blocking until data
 // is available. If tracing is turned off and all the data accumulated while it
 // was on has been returned, ReadTrace returns nil. The caller must copy the
@@ -404,36 +584,62 @@ func ReadTrace() []byte {
 		trace.headerWritten = true
 		trace.lockOwner = nil
 		unlock(&trace.lock)
-		return []byte("go 1.11 trace\x00\x00\x00")
+		return []byte("go 1.18 trace\x00\x00\x00")
 	}
 	// Wait for new data.
-	if trace.fullHead == 0 && !trace.shutdown {
+	if trace.full.empty() && !trace.sealed.pending && !trace.shutdown {
 		trace.reader.set(getg())
 		goparkunlock(&trace.lock, waitReasonTraceReaderBlocked, traceEvGoBlock, 2)
 		lock(&trace.lock)
 	}
-	// Write a buffer.
-	if trace.fullHead != 0 {
-		buf := traceFullDequeue()
-		trace.reading = buf
+	// Write the sealed partition: its buffers, its stacks and its end,
+	// in that order, before anything from the next partition.
+	if s := &trace.sealed; s.pending {
+		if !s.dumped {
+			s.dumped = true
+			tab := s.seq % 2
+			trace.lockOwner = nil
+			unlock(&trace.lock)
+			// This will queue a bunch of buffers onto s.bufs.
+			trace.stackTab[tab].dump(&trace.strings[tab], &s.bufs)
+			lock(&trace.lock)
+			trace.lockOwner = getg()
+		}
+		if buf := s.bufs.pop(); buf != 0 {
+			trace.reading = buf
+			trace.lockOwner = nil
+			unlock(&trace.lock)
+			return buf.ptr().arr[:buf.ptr().pos]
+		}
+		s.pending = false
+		seq := s.seq
+		ticksStart, ticksEnd := s.ticksStart/traceTickDiv, s.ticksEnd/traceTickDiv
+		timeStart, timeEnd := s.timeStart, s.timeEnd
+		waiters := trace.sealedWaiters
+		trace.sealedWaiters = 0
 		trace.lockOwner = nil
 		unlock(&trace.lock)
-		return buf.ptr().arr[:buf.ptr().pos]
+		// Wake anyone waiting in traceStopTheWorld to end the next partition.
+		for ; waiters > 0; waiters-- {
+			semrelease(&trace.sealedSema)
+		}
+		// The end of a partition is returned on its own, which lets
+		// runtime/trace find the partitions in the data.
+		data := []byte{traceEvPartition | 3<<traceArgCountShift, 0}
+		data = traceAppend(data, seq)
+		data = traceAppend(data, uint64(ticksStart))
+		data = traceAppend(data, uint64(timeStart))
+		data = traceAppend(data, uint64(ticksEnd))
+		data = traceAppend(data, uint64(timeEnd))
+		data[1] = byte(len(data) - 2)
+		return data
 	}
-	// Write footer with timer frequency.
-	if !trace.footerWritten {
-		trace.footerWritten = true
-		// Use float64 because (trace.ticksEnd - trace.ticksStart) * 1e9 can overflow int64.
-		freq := float64(trace.ticksEnd-trace.ticksStart) * 1e9 / float64(trace.timeEnd-trace.timeStart) / traceTickDiv
+	// Write a buffer.
+	if buf := trace.full.pop(); buf != 0 {
+		trace.reading = buf
 		trace.lockOwner = nil
 		unlock(&trace.lock)
-		var data []byte
-		data = append(data, traceEvFrequency|0<<traceArgCountShift)
-		data = traceAppend(data, uint64(freq))
-		// This will emit a bunch of full buffers, we will pick them up
-		// on the next iteration.
-		trace.stackTab.dump()
-		return data
+		return buf.ptr().arr[:buf.ptr().pos]
 	}
 	// Done.
 	if trace.shutdown {
@@ -458,11 +664,11 @@ func ReadTrace() []byte {
 
 // traceReader returns the trace reader that should be woken up, if any.
 func traceReader() *g {
-	if trace.reader == 0 || (trace.fullHead == 0 && !trace.shutdown) {
+	if !traceReaderAvailable() {
 		return nil
 	}
 	lock(&trace.lock)
-	if trace.reader == 0 || (trace.fullHead == 0 && !trace.shutdown) {
+	if !traceReaderAvailable() {
 		unlock(&trace.lock)
 		return nil
 	}
@@ -472,6 +678,12 @@ func traceReader() *g {
 	return gp
 }
 
+// traceReaderAvailable reports whether the trace reader is blocked
+// and there is data for it, or tracing is shutting down.
+func traceReaderAvailable() bool {
+	return trace.reader != 0 && (!trace.full.empty() || trace.sealed.pending || trace.shutdown)
+}
+
 // traceProcFree frees trace buffer associated with pp.
 func traceProcFree(pp *p) {
 	buf := pp.tracebuf
@@ -480,35 +692,10 @@ func traceProcFree(pp *p) {
 		return
 	}
 	lock(&trace.lock)
-	traceFullQueue(buf)
+	trace.full.push(buf)
 	unlock(&trace.lock)
 }
 
-// traceFullQueue queues buf into queue of full buffers.
-func traceFullQueue(buf traceBufPtr) {
-	buf.ptr().link = 0
-	if trace.fullHead == 0 {
-		trace.fullHead = buf
-	} else {
-		trace.fullTail.ptr().link = buf
-	}
-	trace.fullTail = buf
-}
-
-// traceFullDequeue dequeues from queue of full buffers.
-func traceFullDequeue() traceBufPtr {
-	buf := trace.fullHead
-	if buf == 0 {
-		return 0
-	}
-	trace.fullHead = buf.ptr().link
-	if trace.fullHead == 0 {
-		trace.fullTail = 0
-	}
-	buf.ptr().link = 0
-	return buf
-}
-
 // traceEvent writes a single event to trace buffer, flushing the buffer if necessary.
 // ev is event type.
 // If skip > 0, write current stack id as the last argument (skipping skip top frames).
@@ -605,7 +792,7 @@ func traceStackID(mp *m, buf []uintptr, skip int) uint64 {
 	if nstk > 0 && gp.goid == 1 {
 		nstk-- // skip runtime.main
 	}
-	id := trace.stackTab.put(buf[:nstk])
+	id := trace.stackTab[trace.partition%2].put(buf[:nstk])
 	return uint64(id)
 }
 
@@ -627,15 +814,20 @@ func traceReleaseBuffer(pid int32) {
 	releasem(getg().m)
 }
 
-// traceFlush puts buf onto stack of full buffers and returns an empty buffer.
+// traceFlush puts buf onto queue of full buffers and returns an empty buffer.
 func traceFlush(buf traceBufPtr, pid int32) traceBufPtr {
+	return traceFlushTo(&trace.full, buf, pid)
+}
+
+// traceFlushTo puts buf onto q and returns an empty buffer.
+func traceFlushTo(q *traceBufQueue, buf traceBufPtr, pid int32) traceBufPtr {
 	owner := trace.lockOwner
 	dolock := owner == nil || owner != getg().m.curg
 	if dolock {
 		lock(&trace.lock)
 	}
 	if buf != 0 {
-		traceFullQueue(buf)
+		q.push(buf)
 	}
 	if trace.empty != 0 {
 		buf = trace.empty
@@ -663,36 +855,44 @@ func traceFlush(buf traceBufPtr, pid int32) traceBufPtr {
 	return buf
 }
 
-// traceString adds a string to the trace.strings and returns the id.
+// traceString adds a string to the dictionary of the current partition
+// and returns the id.
 func traceString(bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr) {
+	return trace.strings[trace.partition%2].put(&trace.full, bufp, pid, s)
+}
+
+// put adds a string to the dictionary and returns the id.
+// The traceEvString entry is written to *bufp, which is flushed to q
+// if it is full.
+func (tab *traceStringTable) put(q *traceBufQueue, bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr) {
 	if s == "" {
 		return 0, bufp
 	}
 
-	lock(&trace.stringsLock)
+	lock(&tab.lock)
 	if raceenabled {
 		// raceacquire is necessary because the map access
 		// below is race annotated.
-		raceacquire(unsafe.Pointer(&trace.stringsLock))
+		raceacquire(unsafe.Pointer(&tab.lock))
 	}
 
-	if id, ok := trace.strings[s]; ok {
+	if id, ok := tab.tab[s]; ok {
 		if raceenabled {
-			racerelease(unsafe.Pointer(&trace.stringsLock))
+			racerelease(unsafe.Pointer(&tab.lock))
 		}
-		unlock(&trace.stringsLock)
+		unlock(&tab.lock)
 
 		return id, bufp
 	}
 
-	trace.stringSeq++
-	id := trace.stringSeq
-	trace.strings[s] = id
+	tab.seq++
+	id := tab.seq
+	tab.tab[s] = id
 
 	if raceenabled {
-		racerelease(unsafe.Pointer(&trace.stringsLock))
+		racerelease(unsafe.Pointer(&tab.lock))
 	}
-	unlock(&trace.stringsLock)
+	unlock(&tab.lock)
 
 	// memory allocation in above may trigger tracing and
 	// cause *bufp changes. Following code now works with *bufp,
@@ -702,7 +902,7 @@ func traceString(bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr)
 	buf := bufp.ptr()
 	size := 1 + 2*traceBytesPerNumber + len(s)
 	if buf == nil || len(buf.arr)-buf.pos < size {
-		buf = traceFlush(traceBufPtrOf(buf), pid).ptr()
+		buf = traceFlushTo(q, traceBufPtrOf(buf), pid).ptr()
 		bufp.set(buf)
 	}
 	buf.byte(traceEvString)
@@ -845,11 +1045,12 @@ func allFrames(pcs []uintptr) []Frame {
 	}
 }
 
-// dump writes all previously cached stacks to trace buffers,
-// releases all memory and resets state.
-func (tab *traceStackTable) dump() {
+// dump writes all previously cached stacks to trace buffers queued
+// onto q, releases all memory and resets state. strings is the
+// dictionary of the partition the stacks belong to; it is released too.
+func (tab *traceStackTable) dump(strings *traceStringTable, q *traceBufQueue) {
 	var tmp [(2 + 4*traceStackSize) * traceBytesPerNumber]byte
-	bufp := traceFlush(0, 0)
+	bufp := traceFlushTo(q, 0, 0)
 	for _, stk := range tab.tab {
 		stk := stk.ptr()
 		for ; stk != nil; stk = stk.link.ptr() {
@@ -859,7 +1060,7 @@ func (tab *traceStackTable) dump() {
 			tmpbuf = traceAppend(tmpbuf, uint64(len(frames)))
 			for _, f := range frames {
 				var frame traceFrame
-				frame, bufp = traceFrameForPC(bufp, 0, f)
+				frame, bufp = traceFrameForPC(strings, q, bufp, 0, f)
 				tmpbuf = traceAppend(tmpbuf, uint64(f.PC))
 				tmpbuf = traceAppend(tmpbuf, uint64(frame.funcID))
 				tmpbuf = traceAppend(tmpbuf, uint64(frame.fileID))
@@ -868,7 +1069,7 @@ func (tab *traceStackTable) dump() {
 			// Now copy to the buffer.
 			size := 1 + traceBytesPerNumber + len(tmpbuf)
 			if buf := bufp.ptr(); len(buf.arr)-buf.pos < size {
-				bufp = traceFlush(bufp, 0)
+				bufp = traceFlushTo(q, bufp, 0)
 			}
 			buf := bufp.ptr()
 			buf.byte(traceEvStack | 3<<traceArgCountShift)
@@ -878,12 +1079,17 @@ func (tab *traceStackTable) dump() {
 	}
 
 	lock(&trace.lock)
-	traceFullQueue(bufp)
+	q.push(bufp)
 	unlock(&trace.lock)
 
 	tab.mem.drop()
 	*tab = traceStackTable{}
 	lockInit(&((*tab).lock), lockRankTraceStackTab)
+
+	lock(&strings.lock)
+	strings.tab = nil
+	strings.seq = 0
+	unlock(&strings.lock)
 }
 
 type traceFrame struct {
@@ -892,9 +1098,9 @@ type traceFrame struct {
 	line   uint64
 }
 
-// traceFrameForPC records the frame information.
-// It may allocate memory.
-func traceFrameForPC(buf traceBufPtr, pid int32, f Frame) (traceFrame, traceBufPtr) {
+// traceFrameForPC records the frame information, adding its strings to
+// the dictionary strings. It may allocate memory.
+func traceFrameForPC(strings *traceStringTable, q *traceBufQueue, buf traceBufPtr, pid int32, f Frame) (traceFrame, traceBufPtr) {
 	bufp := &buf
 	var frame traceFrame
 
@@ -903,13 +1109,13 @@ func traceFrameForPC(buf traceBufPtr, pid int32, f Frame) (traceFrame, traceBufP
 	if len(fn) > maxLen {
 		fn = fn[len(fn)-maxLen:]
 	}
-	frame.funcID, bufp = traceString(bufp, pid, fn)
+	frame.funcID, bufp = strings.put(q, bufp, pid, fn)
 	frame.line = uint64(f.Line)
 	file := f.File
 	if len(file) > maxLen {
 		file = file[len(file)-maxLen:]
 	}
-	frame.fileID, bufp = traceString(bufp, pid, file)
+	frame.fileID, bufp = strings.put(q, bufp, pid, file)
 	return frame, (*bufp)
 }
 
@@ -1057,7 +1263,7 @@ func traceGoCreate(newg *g, pc uintptr) {
 	newg.traceseq = 0
 	newg.tracelastp = getg().m.p
 	// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
-	id := trace.stackTab.put([]uintptr{pc + sys.PCQuantum})
+	id := trace.stackTab[trace.partition%2].put([]uintptr{pc + sys.PCQuantum})
 	traceEvent(traceEvGoCreate, 2, uint64(newg.goid), uint64(id))
 }
 
@@ -1148,7 +1354,7 @@ func traceHeapAlloc() {
 }
 
 func traceHeapGoal() {
-	if heapGoal := atomic.Load64(&gcController.heapGoal); heapGoal == ^uint64(0) {
+	if heapGoal := gcController.heapGoal(); heapGoal == ^uint64(0) {
 		// Heap-based triggering is disabled.
 		traceEvent(traceEvHeapGoal, -1, 0)
 	} else {
@@ -1159,6 +1365,11 @@ func traceHeapGoal() {
 // To access runtime functions from runtime/trace.
 // See runtime/trace/annotation.go
 
+//go:linkname trace_advancePartition runtime/trace.advancePartition
+func trace_advancePartition() (seq uint64, ok bool) {
+	return traceAdvance()
+}
+
 //go:linkname trace_userTaskCreate runtime/trace.userTaskCreate
 func trace_userTaskCreate(id, parentID uint64, taskType string) {
 	if !trace.enabled {
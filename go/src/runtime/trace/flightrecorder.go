@@ -0,0 +1,265 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMinAge   = 10 * time.Second
+	defaultMaxBytes = 10 << 20
+
+	// maxPeriod is the longest time between the ends of partitions.
+	maxPeriod = time.Second
+
+	// partitionEnd is the first byte of the data that ends a partition
+	// of the trace, which runtime.ReadTrace returns on its own: the
+	// header of a traceEvPartition event with 4 or more arguments.
+	partitionEnd = 49 | 3<<6
+)
+
+// FlightRecorderConfig is the configuration of a FlightRecorder.
+type FlightRecorderConfig struct {
+	// MinAge is how much of the most recent execution the flight
+	// recorder keeps the trace of, unless MaxBytes is reached first.
+	// The trace it keeps may cover somewhat more.
+	// If zero, it is 10 seconds.
+	MinAge time.Duration
+
+	// MaxBytes is how large the trace the flight recorder keeps may
+	// grow. It takes precedence over MinAge. It is approximate: the
+	// flight recorder keeps the trace in partitions, and always keeps
+	// at least one of them.
+	// If zero, it is 10 MiB.
+	MaxBytes uint64
+}
+
+// A FlightRecorder traces the program, keeping only the most recent
+// part of the trace in memory. WriteTo writes that part out, for
+// example when the program notices that a request was slow, which
+// makes it possible to understand rare events without the cost of
+// writing out, and then sifting through, a trace of the whole run.
+//
+// Only one FlightRecorder, or Start, can trace the program at a time.
+// A FlightRecorder must be created with NewFlightRecorder.
+type FlightRecorder struct {
+	cfg      FlightRecorderConfig
+	cut      chan struct{} // requests the end of the current partition
+	advancer *advancer
+	done     chan struct{} // closed when the reader has returned
+
+	writing sync.Mutex // serializes WriteTo and Stop
+
+	mu     sync.Mutex // protects the following members
+	cond   sync.Cond  // broadcast when a partition has been read
+	active bool
+	header []byte
+	parts  []frPartition // partitions read, oldest first
+	size   uint64        // total size of parts
+	cur    frPartition   // partition being read
+	next   uint64        // sequence number of the partition being read
+}
+
+// frPartition is a partition of the trace kept by a FlightRecorder.
+type frPartition struct {
+	data [][]byte
+	size uint64
+	end  time.Time // when the end of the partition was read
+}
+
+// NewFlightRecorder returns a FlightRecorder with the configuration
+// cfg. It does not start recording.
+func NewFlightRecorder(cfg FlightRecorderConfig) *FlightRecorder {
+	if cfg.MinAge <= 0 {
+		cfg.MinAge = defaultMinAge
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+	fr := &FlightRecorder{
+		cfg: cfg,
+		cut: make(chan struct{}, 1),
+	}
+	fr.cond.L = &fr.mu
+	return fr
+}
+
+// Start starts recording the trace. It returns an error if the program
+// is already being traced.
+func (fr *FlightRecorder) Start() error {
+	tracing.Lock()
+	defer tracing.Unlock()
+
+	if err := runtime.StartTrace(); err != nil {
+		return err
+	}
+	fr.mu.Lock()
+	fr.active = true
+	fr.header = nil
+	fr.parts = nil
+	fr.size = 0
+	fr.cur = frPartition{}
+	fr.next = 0
+	fr.mu.Unlock()
+
+	fr.done = make(chan struct{})
+	go fr.read()
+	fr.advancer = startAdvancer(fr.period(), fr.cut)
+	tracing.recorder = fr
+	atomic.StoreInt32(&tracing.enabled, 1)
+	return nil
+}
+
+// Stop stops recording the trace, and discards the part it kept.
+// If WriteTo is running, Stop waits for it to return first.
+func (fr *FlightRecorder) Stop() {
+	fr.writing.Lock()
+	defer fr.writing.Unlock()
+	tracing.Lock()
+	defer tracing.Unlock()
+
+	if tracing.recorder != fr {
+		return
+	}
+	fr.advancer.stop()
+	fr.advancer = nil
+	atomic.StoreInt32(&tracing.enabled, 0)
+	runtime.StopTrace()
+	<-fr.done
+	tracing.recorder = nil
+
+	fr.mu.Lock()
+	fr.active = false
+	fr.header = nil
+	fr.parts = nil
+	fr.size = 0
+	fr.cur = frPartition{}
+	fr.mu.Unlock()
+}
+
+// Enabled reports whether the flight recorder is recording the trace.
+func (fr *FlightRecorder) Enabled() bool {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.active
+}
+
+// WriteTo writes the part of the trace the flight recorder keeps to w.
+// It first ends the current partition of the trace, so that what it
+// writes includes the most recent events. WriteTo returns an error if
+// the flight recorder is not recording. Concurrent calls to WriteTo
+// are serialized.
+func (fr *FlightRecorder) WriteTo(w io.Writer) (n int64, err error) {
+	fr.writing.Lock()
+	defer fr.writing.Unlock()
+
+	if !fr.Enabled() {
+		return 0, errors.New("flight recorder is not enabled")
+	}
+	seq, ok := advancePartition()
+	if !ok {
+		return 0, errors.New("flight recorder is not enabled")
+	}
+	fr.mu.Lock()
+	for fr.next <= seq {
+		fr.cond.Wait()
+	}
+	header := fr.header
+	parts := append([]frPartition(nil), fr.parts...)
+	fr.mu.Unlock()
+
+	m, err := w.Write(header)
+	n += int64(m)
+	if err != nil {
+		return n, err
+	}
+	for _, p := range parts {
+		for _, data := range p.data {
+			m, err := w.Write(data)
+			n += int64(m)
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// period returns how often the flight recorder ends a partition of the
+// trace. It drops whole partitions, so shorter partitions make the
+// part of the trace it keeps closer to MinAge.
+func (fr *FlightRecorder) period() time.Duration {
+	p := fr.cfg.MinAge / 4
+	if p > maxPeriod {
+		p = maxPeriod
+	}
+	if p < 10*time.Millisecond {
+		p = 10 * time.Millisecond
+	}
+	return p
+}
+
+// read reads the trace from the runtime until tracing stops.
+func (fr *FlightRecorder) read() {
+	defer close(fr.done)
+	for {
+		data := runtime.ReadTrace()
+		if data == nil {
+			return
+		}
+		fr.add(append([]byte(nil), data...))
+	}
+}
+
+// add adds data read from the runtime to the trace, dropping the oldest
+// partitions that the configuration does not require keeping.
+func (fr *FlightRecorder) add(data []byte) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if fr.header == nil {
+		fr.header = data
+		return
+	}
+	fr.cur.data = append(fr.cur.data, data)
+	fr.cur.size += uint64(len(data))
+	if data[0] != partitionEnd {
+		// Keep partitions small compared to MaxBytes, since the
+		// flight recorder keeps or drops them whole.
+		if fr.cur.size > fr.cfg.MaxBytes/4 {
+			select {
+			case fr.cut <- struct{}{}:
+			default:
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	fr.cur.end = now
+	fr.parts = append(fr.parts, fr.cur)
+	fr.size += fr.cur.size
+	fr.cur = frPartition{}
+	fr.next++
+	// The partitions after the oldest one cover the execution since
+	// the oldest one ended. Drop it if they cover at least MinAge, or
+	// if the trace is too large.
+	for len(fr.parts) > 1 {
+		oldest := fr.parts[0]
+		if now.Sub(oldest.end) < fr.cfg.MinAge && fr.size <= fr.cfg.MaxBytes {
+			break
+		}
+		fr.parts[0] = frPartition{}
+		fr.parts = fr.parts[1:]
+		fr.size -= oldest.size
+	}
+	fr.cond.Broadcast()
+}
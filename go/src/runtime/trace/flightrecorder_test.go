@@ -0,0 +1,136 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"internal/trace"
+	"io"
+	. "runtime/trace"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	fr := NewFlightRecorder(FlightRecorderConfig{})
+	if fr.Enabled() {
+		t.Fatalf("flight recorder is enabled before Start")
+	}
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	if !fr.Enabled() || !IsEnabled() {
+		t.Errorf("flight recorder is not enabled after Start")
+	}
+	if err := fr.Start(); err == nil {
+		t.Errorf("started flight recorder a second time")
+	}
+	if err := Start(io.Discard); err == nil {
+		t.Errorf("started tracing while the flight recorder is enabled")
+	}
+	Stop() // no effect on the flight recorder
+	Log(context.Background(), "flight", "recorder")
+
+	buf := new(bytes.Buffer)
+	n, err := fr.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("failed to write trace: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+	saveTrace(t, buf, "TestFlightRecorder")
+	events, _ := parseTrace(t, buf)
+	found := false
+	for _, ev := range events {
+		if ev.Type == trace.EvUserLog && ev.SArgs[0] == "flight" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("trace does not contain the logged message")
+	}
+
+	fr.Stop()
+	if fr.Enabled() || IsEnabled() {
+		t.Errorf("flight recorder is enabled after Stop")
+	}
+	if _, err := fr.WriteTo(io.Discard); err == nil {
+		t.Errorf("wrote trace after Stop")
+	}
+	// The flight recorder can start again.
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to restart flight recorder: %v", err)
+	}
+	fr.Stop()
+}
+
+func TestFlightRecorderMinAge(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	fr := NewFlightRecorder(FlightRecorderConfig{MinAge: 50 * time.Millisecond})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+	const n = 100
+	for i := 0; i < n; i++ {
+		Log(context.Background(), "i", strconv.Itoa(i))
+		time.Sleep(10 * time.Millisecond)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := fr.WriteTo(buf); err != nil {
+		t.Fatalf("failed to write trace: %v", err)
+	}
+	events, _ := parseTrace(t, buf)
+	var logged []int
+	for _, ev := range events {
+		if ev.Type == trace.EvUserLog && ev.SArgs[0] == "i" {
+			i, _ := strconv.Atoi(ev.SArgs[1])
+			logged = append(logged, i)
+		}
+	}
+	if len(logged) == 0 || logged[0] == 0 || logged[len(logged)-1] != n-1 {
+		t.Errorf("trace has messages %v, want the most recent ones", logged)
+	}
+}
+
+func TestFlightRecorderMaxBytes(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	const maxBytes = 64 << 10
+	fr := NewFlightRecorder(FlightRecorderConfig{MinAge: time.Hour, MaxBytes: maxBytes})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+	// Write about 4 MiB of trace.
+	msg := strings.Repeat("x", 100)
+	for i := 0; i < 4<<20/len(msg); i++ {
+		Log(context.Background(), "msg", msg)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := fr.WriteTo(buf); err != nil {
+		t.Fatalf("failed to write trace: %v", err)
+	}
+	if buf.Len() > 16*maxBytes {
+		t.Errorf("wrote %d bytes of trace, want about %d", buf.Len(), maxBytes)
+	}
+	parseTrace(t, buf)
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package parse parses the execution traces written by the runtime/trace
+// package and by "go test -trace", for programs that analyze them.
+//
+// Traces written by Go 1.18 and later are divided into partitions: one
+// ends whenever tracing stops, and periodically when tracing with a
+// FlightRecorder or runtime/trace.StartPartitioned. A Reader parses a
+// trace one partition at a time, so it can read such a trace while it is
+// being written, for example over a network connection, and only holds
+// one partition in memory. Traces written by older versions of Go are
+// parsed in one piece. Traces written by Go 1.6 and earlier are not
+// supported.
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"internal/trace"
+	"io"
+)
+
+// An Event is an event in a trace.
+type Event struct {
+	Type EventType
+	Ts   int64  // timestamp in nanoseconds, relative to the first event of the trace
+	P    int    // P on which the event happened (can be one of TimerP, NetpollP, SyscallP, GCP)
+	G    uint64 // goroutine on which the event happened
+	// Stack is the stack trace of the event, if any. For the first
+	// EvGoStart of a goroutine, it is the function the goroutine was
+	// created with.
+	Stack []Frame
+	// Args are the arguments of the event, named by Type.Args.
+	Args []uint64
+	// Strings are the string arguments of the event, named by
+	// Type.Strings.
+	Strings []string
+	// Link is the event that ends the state the event starts, if any:
+	// for EvGCStart, the EvGCDone; for EvGoCreate, the first EvGoStart
+	// of the created goroutine; for EvGoStart, the event that stops the
+	// goroutine; for blocking events, the EvGoUnblock; for EvGoUnblock,
+	// EvGoSched, EvGoPreempt and EvGoSysExit, the next EvGoStart; for
+	// EvGoSysCall that blocks, the EvGoSysExit; for EvUserTaskCreate,
+	// the EvUserTaskEnd; and for an EvUserRegion that starts a region,
+	// the EvUserRegion that ends it.
+	//
+	// Since a Reader returns the events of a partition before parsing
+	// the next one, the Link of an event can be set after the Reader
+	// returned it, when it reads the event linked to.
+	Link *Event
+}
+
+// String returns a description of the event, for debugging.
+func (ev *Event) String() string {
+	s := fmt.Sprintf("%d %s p=%d g=%d", ev.Ts, ev.Type, ev.P, ev.G)
+	for i, a := range ev.Type.Args() {
+		s += fmt.Sprintf(" %s=%d", a, ev.Args[i])
+	}
+	for i, a := range ev.Type.Strings() {
+		if i < len(ev.Strings) {
+			s += fmt.Sprintf(" %s=%s", a, ev.Strings[i])
+		}
+	}
+	return s
+}
+
+// A Frame is a frame of a stack trace.
+type Frame struct {
+	PC   uint64
+	Func string
+	File string
+	Line int
+}
+
+// Special values of Event.P for events that do not happen on a P.
+const (
+	TimerP   = trace.TimerP   // timer unblocks
+	NetpollP = trace.NetpollP // network unblocks
+	SyscallP = trace.SyscallP // returns from syscalls
+	GCP      = trace.GCP      // GC state
+)
+
+// EventType is the type of an event.
+type EventType uint8
+
+// Event types. The names of their arguments are given in brackets,
+// and those of their string arguments in braces.
+const (
+	EvGomaxprocs        EventType = trace.EvGomaxprocs        // current value of GOMAXPROCS [procs]
+	EvProcStart         EventType = trace.EvProcStart         // start of P [thread]
+	EvProcStop          EventType = trace.EvProcStop          // stop of P []
+	EvGCStart           EventType = trace.EvGCStart           // GC start [seq]
+	EvGCDone            EventType = trace.EvGCDone            // GC done []
+	EvGCSTWStart        EventType = trace.EvGCSTWStart        // GC STW start [kindid] {kind}
+	EvGCSTWDone         EventType = trace.EvGCSTWDone         // GC STW done []
+	EvGCSweepStart      EventType = trace.EvGCSweepStart      // GC sweep start []
+	EvGCSweepDone       EventType = trace.EvGCSweepDone       // GC sweep done [swept, reclaimed]
+	EvGoCreate          EventType = trace.EvGoCreate          // goroutine creation [g, stack]
+	EvGoStart           EventType = trace.EvGoStart           // goroutine starts running [g, seq]
+	EvGoEnd             EventType = trace.EvGoEnd             // goroutine ends []
+	EvGoStop            EventType = trace.EvGoStop            // goroutine stops, like in select{} []
+	EvGoSched           EventType = trace.EvGoSched           // goroutine calls Gosched []
+	EvGoPreempt         EventType = trace.EvGoPreempt         // goroutine is preempted []
+	EvGoSleep           EventType = trace.EvGoSleep           // goroutine calls Sleep []
+	EvGoBlock           EventType = trace.EvGoBlock           // goroutine blocks []
+	EvGoUnblock         EventType = trace.EvGoUnblock         // goroutine is unblocked [g, seq]
+	EvGoBlockSend       EventType = trace.EvGoBlockSend       // goroutine blocks on chan send []
+	EvGoBlockRecv       EventType = trace.EvGoBlockRecv       // goroutine blocks on chan recv []
+	EvGoBlockSelect     EventType = trace.EvGoBlockSelect     // goroutine blocks on select []
+	EvGoBlockSync       EventType = trace.EvGoBlockSync       // goroutine blocks on Mutex/RWMutex []
+	EvGoBlockCond       EventType = trace.EvGoBlockCond       // goroutine blocks on Cond []
+	EvGoBlockNet        EventType = trace.EvGoBlockNet        // goroutine blocks on network []
+	EvGoSysCall         EventType = trace.EvGoSysCall         // syscall enter []
+	EvGoSysExit         EventType = trace.EvGoSysExit         // syscall exit [g, seq, ts]
+	EvGoSysBlock        EventType = trace.EvGoSysBlock        // syscall blocks []
+	EvGoWaiting         EventType = trace.EvGoWaiting         // goroutine is blocked when tracing starts [g]
+	EvGoInSyscall       EventType = trace.EvGoInSyscall       // goroutine is in syscall when tracing starts [g]
+	EvHeapAlloc         EventType = trace.EvHeapAlloc         // heap live bytes change [mem]
+	EvHeapGoal          EventType = trace.EvHeapGoal          // heap goal change [mem]
+	EvFutileWakeup      EventType = trace.EvFutileWakeup      // the previous wakeup of the goroutine was futile []
+	EvGoStartLabel      EventType = trace.EvGoStartLabel      // goroutine starts running with label [g, seq, labelid] {label}
+	EvGoBlockGC         EventType = trace.EvGoBlockGC         // goroutine blocks on GC assist []
+	EvGCMarkAssistStart EventType = trace.EvGCMarkAssistStart // GC mark assist start []
+	EvGCMarkAssistDone  EventType = trace.EvGCMarkAssistDone  // GC mark assist done []
+	EvUserTaskCreate    EventType = trace.EvUserTaskCreate    // trace.NewTask [taskid, pid, typeid] {name}
+	EvUserTaskEnd       EventType = trace.EvUserTaskEnd       // end of a task [taskid]
+	EvUserRegion        EventType = trace.EvUserRegion        // trace.WithRegion [taskid, mode, typeid] {name}
+	EvUserLog           EventType = trace.EvUserLog           // trace.Log [id, keyid] {category, message}
+)
+
+// String returns the name of the event type, such as "GoCreate".
+func (t EventType) String() string {
+	if int(t) >= len(trace.EventDescriptions) || trace.EventDescriptions[t].Name == "" {
+		return fmt.Sprintf("EventType(%d)", t)
+	}
+	return trace.EventDescriptions[t].Name
+}
+
+// Args returns the names of the arguments of events of type t.
+func (t EventType) Args() []string {
+	if int(t) >= len(trace.EventDescriptions) {
+		return nil
+	}
+	return trace.EventDescriptions[t].Args
+}
+
+// Strings returns the names of the string arguments of events of type t.
+func (t EventType) Strings() []string {
+	if int(t) >= len(trace.EventDescriptions) {
+		return nil
+	}
+	return trace.EventDescriptions[t].SArgs
+}
+
+// A Reader reads the events of a trace.
+type Reader struct {
+	r      *trace.Reader
+	events []*Event // rest of the events of the current partition
+
+	// unlinked maps the events of earlier partitions that a later one
+	// may set the Link of to the Events returned for them.
+	unlinked map[*trace.Event]*Event
+}
+
+// NewReader reads the header of the trace in r, and returns a Reader
+// for its events.
+func NewReader(r io.Reader) (*Reader, error) {
+	tr, err := trace.NewReader(r, "")
+	if err != nil {
+		return nil, err
+	}
+	if tr.Version() < 1007 {
+		return nil, errors.New("traces written by Go 1.6 or earlier are not supported")
+	}
+	return &Reader{r: tr, unlinked: make(map[*trace.Event]*Event)}, nil
+}
+
+// ReadEvent returns the next event of the trace, and io.EOF if there
+// are no more events. The events are ordered by time.
+func (r *Reader) ReadEvent() (*Event, error) {
+	for len(r.events) == 0 {
+		res, err := r.r.Next()
+		if err != nil {
+			return nil, err
+		}
+		r.events = r.convert(res.Events)
+	}
+	ev := r.events[0]
+	r.events[0] = nil
+	r.events = r.events[1:]
+	return ev, nil
+}
+
+// convert converts the events of a partition, and sets the Links that
+// they complete in earlier partitions.
+func (r *Reader) convert(events []*trace.Event) []*Event {
+	conv := make(map[*trace.Event]*Event, len(events))
+	res := make([]*Event, len(events))
+	for i, ev := range events {
+		desc := trace.EventDescriptions[ev.Type]
+		e := &Event{
+			Type:    EventType(ev.Type),
+			Ts:      ev.Ts,
+			P:       ev.P,
+			G:       ev.G,
+			Args:    append([]uint64(nil), ev.Args[:len(desc.Args)]...),
+			Strings: ev.SArgs,
+		}
+		if len(ev.Stk) > 0 {
+			e.Stack = make([]Frame, len(ev.Stk))
+			for j, f := range ev.Stk {
+				e.Stack[j] = Frame{PC: f.PC, Func: f.Fn, File: f.File, Line: f.Line}
+			}
+		}
+		conv[ev] = e
+		res[i] = e
+	}
+	for i, ev := range events {
+		if ev.Link != nil {
+			res[i].Link = conv[ev.Link]
+		}
+	}
+	for ev, e := range r.unlinked {
+		if ev.Link != nil {
+			e.Link = conv[ev.Link]
+		}
+	}
+	unlinked := make(map[*trace.Event]*Event)
+	for _, ev := range r.r.Unlinked() {
+		if e := conv[ev]; e != nil {
+			unlinked[ev] = e
+		} else if e := r.unlinked[ev]; e != nil {
+			unlinked[ev] = e
+		}
+	}
+	r.unlinked = unlinked
+	return res
+}
+
+// Parse reads the whole trace from r, and returns its events ordered
+// by time.
+func Parse(r io.Reader) ([]*Event, error) {
+	pr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	for {
+		ev, err := pr.ReadEvent()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+}
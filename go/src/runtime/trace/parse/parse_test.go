@@ -0,0 +1,147 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parse_test
+
+import (
+	"bytes"
+	"context"
+	"internal/trace"
+	"io"
+	rtrace "runtime/trace"
+	. "runtime/trace/parse"
+	"sync"
+	"testing"
+)
+
+// writePartitions writes a trace with two partitions. Goroutine 1
+// blocks in the first partition, and goroutine 2 unblocks it in the
+// second one.
+func writePartitions() *trace.Writer {
+	w := trace.NewWriterVersion(1018)
+	w.Emit(trace.EvBatch, 0, 0)
+	w.Emit(trace.EvGoCreate, 1, 1, 1, 0)
+	w.Emit(trace.EvGoCreate, 1, 2, 1, 0)
+	w.Emit(trace.EvProcStart, 1, 0)
+	w.Emit(trace.EvGoStart, 1, 1, 1)
+	w.Emit(trace.EvGoBlock, 1, 0)
+	w.Emit(trace.EvGoStart, 1, 2, 1)
+	w.Emit(trace.EvGoSched, 1, 0)
+	w.Emit(trace.EvProcStop, 1)
+	w.Emit(trace.EvStack, 1, 1, 0x100, 0, 0, 10)
+	w.Emit(trace.EvPartition, 0, 0, 1000, 10, 1010)
+
+	w.Emit(trace.EvBatch, 0, 11)
+	w.Emit(trace.EvGoCreate, 1, 1, 1, 0)
+	w.Emit(trace.EvGoWaiting, 1, 1)
+	w.Emit(trace.EvGoCreate, 1, 2, 1, 0)
+	w.Emit(trace.EvProcStart, 1, 0)
+	w.Emit(trace.EvGoStart, 1, 2, 1)
+	w.Emit(trace.EvGoUnblock, 1, 1, 2, 0)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStart, 1, 1, 3)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvProcStop, 1)
+	w.Emit(trace.EvStack, 1, 1, 0x200, 0, 0, 20)
+	w.Emit(trace.EvPartition, 1, 11, 1011, 22, 1022)
+	return w
+}
+
+func TestReader(t *testing.T) {
+	r, err := NewReader(writePartitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*Event
+	for {
+		ev, err := r.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		if n := len(events); n > 0 && ev.Ts < events[n-1].Ts {
+			t.Errorf("%v is before %v", ev, events[n-1])
+		}
+		events = append(events, ev)
+		if len(events) == 8 {
+			// The end of the first partition.
+			if block := events[4]; block.Type != EvGoBlock || block.Link != nil {
+				t.Fatalf("got %v linked to %v, want unlinked EvGoBlock", block, block.Link)
+			}
+		}
+	}
+	if len(events) != 15 {
+		t.Fatalf("got %d events, want 15", len(events))
+	}
+	if block, unblock := events[4], events[10]; block.Link != unblock || unblock.Type != EvGoUnblock {
+		t.Errorf("%v is linked to %v, want %v", block, block.Link, unblock)
+	}
+	if start := events[9]; start.Type != EvGoStart || len(start.Stack) != 1 || start.Stack[0].PC != 0x200 {
+		t.Errorf("got %v with stack %v, want EvGoStart with PC 0x200", start, start.Stack)
+	}
+	if unblock := events[10]; len(unblock.Args) != 2 || unblock.Args[0] != 1 {
+		t.Errorf("got %v, want EvGoUnblock of goroutine 1", unblock)
+	}
+}
+
+func TestEventType(t *testing.T) {
+	if s := EvGoCreate.String(); s != "GoCreate" {
+		t.Errorf("got %q, want GoCreate", s)
+	}
+	if s := EventType(255).String(); s != "EventType(255)" {
+		t.Errorf("got %q, want EventType(255)", s)
+	}
+	if args := EvUserLog.Strings(); len(args) != 2 || args[0] != "category" {
+		t.Errorf("got string arguments %q for EvUserLog", args)
+	}
+}
+
+func TestParseRuntimeTrace(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	buf := new(bytes.Buffer)
+	if err := rtrace.Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtrace.Log(context.Background(), "category", "message")
+		}()
+	}
+	wg.Wait()
+	rtrace.Stop()
+
+	events, err := Parse(buf)
+	if err == trace.ErrTimeOrder {
+		t.Skipf("skipping trace: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+	logs := 0
+	for _, ev := range events {
+		if ev.Type == EvUserLog {
+			if len(ev.Strings) != 2 || ev.Strings[0] != "category" || ev.Strings[1] != "message" {
+				t.Errorf("got %v", ev)
+			}
+			logs++
+		}
+	}
+	if logs != 10 {
+		t.Errorf("got %d EvUserLog events, want 10", logs)
+	}
+}
+
+func TestParseOld(t *testing.T) {
+	w := trace.NewWriterVersion(1005)
+	if _, err := Parse(w); err == nil {
+		t.Errorf("no error for a Go 1.5 trace")
+	}
+}
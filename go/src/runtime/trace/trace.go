@@ -34,6 +34,26 @@
 // See the net/http/pprof package for more details about all of the
 // debug endpoints installed by this import.
 //
+// Flight recording
+//
+// Tracing a program for its whole run is often too costly, and the
+// interesting part of the trace hard to find. Instead, a FlightRecorder
+// traces the program while keeping only the last few seconds of the
+// trace in memory, and writes them out on demand, for example when a
+// request turns out to be slow:
+//
+//     fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{
+//             MinAge: 5 * time.Second,
+//     })
+//     fr.Start()
+//     ...
+//     if time.Since(start) > 300*time.Millisecond {
+//             fr.WriteTo(f)
+//     }
+//
+// The runtime/trace/parse package reads traces, including the partial
+// ones written by a FlightRecorder, for programs that analyze them.
+//
 // User annotation
 //
 // Package trace provides user annotation APIs that can be used to
@@ -108,16 +128,39 @@
 package trace
 
 import (
+	"errors"
 	"io"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Start enables tracing for the current program.
 // While tracing, the trace will be buffered and written to w.
 // Start returns an error if tracing is already enabled.
 func Start(w io.Writer) error {
+	return start(w, 0)
+}
+
+// StartPartitioned is like Start, but ends a partition of the trace
+// every period, so that a program reading the trace, for example from
+// a network connection, can parse it while it is being written.
+// See the runtime/trace/parse package.
+//
+// Ending a partition briefly stops the world, so short periods add
+// overhead. A partition does not end until the previous one has been
+// written to w.
+func StartPartitioned(w io.Writer, period time.Duration) error {
+	if period <= 0 {
+		return errors.New("trace: non-positive partition period")
+	}
+	return start(w, period)
+}
+
+// start starts tracing to w, ending a partition every period if it is
+// positive.
+func start(w io.Writer, period time.Duration) error {
 	tracing.Lock()
 	defer tracing.Unlock()
 
@@ -133,21 +176,81 @@ func Start(w io.Writer) error {
 			w.Write(data)
 		}
 	}()
+	if period > 0 {
+		tracing.advancer = startAdvancer(period, nil)
+	}
 	atomic.StoreInt32(&tracing.enabled, 1)
 	return nil
 }
 
 // Stop stops the current tracing, if any.
 // Stop only returns after all the writes for the trace have completed.
+// It does not stop a FlightRecorder; use its Stop method instead.
 func Stop() {
 	tracing.Lock()
 	defer tracing.Unlock()
+	if tracing.recorder != nil {
+		// The flight recorder is stopped by its Stop method.
+		return
+	}
+	if tracing.advancer != nil {
+		tracing.advancer.stop()
+		tracing.advancer = nil
+	}
 	atomic.StoreInt32(&tracing.enabled, 0)
 
 	runtime.StopTrace()
 }
 
 var tracing struct {
-	sync.Mutex       // gate mutators (Start, Stop)
-	enabled    int32 // accessed via atomic
+	sync.Mutex                 // gate mutators (Start, Stop)
+	enabled    int32           // accessed via atomic
+	advancer   *advancer       // ends the partitions of the trace
+	recorder   *FlightRecorder // the flight recorder that is tracing, if any
 }
+
+// An advancer ends a partition of the trace periodically, or when
+// requested, from its own goroutine.
+type advancer struct {
+	cut  chan struct{} // requests the end of the current partition
+	quit chan struct{} // closed to stop the advancer
+	done chan struct{} // closed when the advancer has stopped
+}
+
+// startAdvancer starts an advancer that ends a partition of the trace
+// every period, and whenever a value is sent on cut, which may be nil.
+func startAdvancer(period time.Duration, cut chan struct{}) *advancer {
+	a := &advancer{
+		cut:  cut,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(a.done)
+		t := time.NewTicker(period)
+		defer t.Stop()
+		for {
+			select {
+			case <-a.quit:
+				return
+			case <-t.C:
+			case <-a.cut:
+			}
+			advancePartition()
+		}
+	}()
+	return a
+}
+
+// stop stops the advancer and waits for it to finish.
+func (a *advancer) stop() {
+	close(a.quit)
+	<-a.done
+}
+
+// advancePartition ends the current partition of the trace. It returns
+// the sequence number of the partition it ended, and false if tracing
+// is not enabled.
+//
+// The function body is defined in runtime/trace.go.
+func advancePartition() (seq uint64, ok bool)
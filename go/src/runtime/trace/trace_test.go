@@ -137,6 +137,82 @@ func TestTrace(t *testing.T) {
 	}
 }
 
+func TestTracePartitions(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	buf := new(bytes.Buffer)
+	if err := Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	// A goroutine that stays blocked across partitions.
+	done := make(chan bool)
+	go func() {
+		done <- <-done
+	}()
+	for i := 0; i < 3; i++ {
+		if _, ok := AdvancePartition(); !ok {
+			t.Fatalf("failed to end partition %d", i)
+		}
+		runtime.Gosched()
+	}
+	done <- true
+	<-done
+	Stop()
+	if _, ok := AdvancePartition(); ok {
+		t.Errorf("ended a partition after Stop")
+	}
+	saveTrace(t, buf, "TestTracePartitions")
+
+	// Stop ends the last partition.
+	if n := countPartitions(t, buf); n != 4 {
+		t.Errorf("got %d partitions, want 4", n)
+	}
+	parseTrace(t, buf)
+}
+
+func TestStartPartitioned(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	buf := new(bytes.Buffer)
+	if err := StartPartitioned(buf, 10*time.Millisecond); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	Stop()
+	saveTrace(t, buf, "TestStartPartitioned")
+
+	if n := countPartitions(t, buf); n < 2 {
+		t.Errorf("got %d partitions, want at least 2", n)
+	}
+	parseTrace(t, buf)
+}
+
+// countPartitions returns the number of partitions in the trace in buf.
+func countPartitions(t *testing.T, buf *bytes.Buffer) int {
+	t.Helper()
+	r, err := trace.NewReader(bytes.NewReader(buf.Bytes()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == trace.ErrTimeOrder {
+			t.Skipf("skipping trace: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("failed to parse partition %d: %v", n, err)
+		}
+		n++
+	}
+	return n
+}
+
 func parseTrace(t *testing.T, r io.Reader) ([]*trace.Event, map[uint64]*trace.GDesc) {
 	res, err := trace.Parse(r, "")
 	if err == trace.ErrTimeOrder {
@@ -28,6 +28,9 @@ import (
 
 var fset = token.NewFileSet()
 
+// variants records the names of the functions that get a _func variant.
+var variants = map[string]bool{}
+
 func main() {
 	af, err := parser.ParseFile(fset, "sort.go", nil, 0)
 	if err != nil {
@@ -59,6 +62,7 @@ func main() {
 		arg0Type.Name = "lessSwap"
 
 		newDecl = append(newDecl, fd)
+		variants[fd.Name.Name] = true
 	}
 	af.Decls = newDecl
 	ast.Walk(visitFunc(rewriteCalls), af)
@@ -116,11 +120,9 @@ func rewriteCall(ce *ast.CallExpr) {
 		// e.g. skip SelectorExpr (data.Less(..) calls)
 		return
 	}
-	// skip casts
-	if ident.Name == "int" || ident.Name == "uint" {
-		return
-	}
-	if len(ce.Args) < 1 {
+	// skip casts and calls to helpers that have no _func variant,
+	// such as nextPowerOfTwo
+	if !variants[ident.Name] {
 		return
 	}
 	ident.Name += "_func"
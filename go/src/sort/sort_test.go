@@ -289,6 +289,147 @@ func BenchmarkStableInt64K(b *testing.B) {
 	}
 }
 
+// intPatterns are input distributions that defeat a naive quicksort:
+// already sorted or reversed input, input with few distinct values,
+// and input that is sorted except for a few elements.
+var intPatterns = []struct {
+	name string
+	gen  func(data []int)
+}{
+	{"Random", func(data []int) {
+		r := rand.New(rand.NewSource(1))
+		for i := range data {
+			data[i] = r.Int()
+		}
+	}},
+	{"Sorted", func(data []int) {
+		for i := range data {
+			data[i] = i
+		}
+	}},
+	{"Reversed", func(data []int) {
+		for i := range data {
+			data[i] = len(data) - i
+		}
+	}},
+	{"NearlySorted", func(data []int) {
+		r := rand.New(rand.NewSource(1))
+		for i := range data {
+			data[i] = i
+		}
+		for i := 0; i < 10; i++ {
+			a, b := r.Intn(len(data)), r.Intn(len(data))
+			data[a], data[b] = data[b], data[a]
+		}
+	}},
+	{"Mod8", func(data []int) {
+		for i := range data {
+			data[i] = i % 8
+		}
+	}},
+	{"AllEqual", func(data []int) {
+		for i := range data {
+			data[i] = 42
+		}
+	}},
+	{"Organ", func(data []int) {
+		n := len(data)
+		for i := range data {
+			if i < n/2 {
+				data[i] = i
+			} else {
+				data[i] = n - i
+			}
+		}
+	}},
+}
+
+func TestSortPatterns(t *testing.T) {
+	const n = 10000
+	for _, p := range intPatterns {
+		data := make([]int, n)
+		p.gen(data)
+		Sort(IntSlice(data))
+		if !IntsAreSorted(data) {
+			t.Errorf("%s: Sort did not sort", p.name)
+		}
+		p.gen(data)
+		Slice(data, func(i, j int) bool { return data[i] < data[j] })
+		if !IntsAreSorted(data) {
+			t.Errorf("%s: Slice did not sort", p.name)
+		}
+	}
+}
+
+// countingInts counts the calls to Less made while sorting.
+type countingInts struct {
+	IntSlice
+	ncmp int
+}
+
+func (d *countingInts) Less(i, j int) bool {
+	d.ncmp++
+	return d.IntSlice.Less(i, j)
+}
+
+// Sorted, reversed and constant input should be detected and sorted
+// in linear time.
+func TestSortPatternsLinear(t *testing.T) {
+	const n = 10000
+	for _, p := range intPatterns {
+		switch p.name {
+		case "Sorted", "Reversed", "AllEqual":
+		default:
+			continue
+		}
+		d := &countingInts{IntSlice: make([]int, n)}
+		p.gen(d.IntSlice)
+		Sort(d)
+		if !IsSorted(d.IntSlice) {
+			t.Errorf("%s: Sort did not sort", p.name)
+		}
+		if max := 2 * n; d.ncmp > max {
+			t.Errorf("%s: Sort made %d calls to Less, want at most %d", p.name, d.ncmp, max)
+		}
+	}
+}
+
+func BenchmarkSortPatterns(b *testing.B) {
+	const n = 1 << 16
+	for _, p := range intPatterns {
+		b.Run(p.name, func(b *testing.B) {
+			unsorted := make([]int, n)
+			p.gen(unsorted)
+			data := make([]int, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				copy(data, unsorted)
+				b.StartTimer()
+				Sort(IntSlice(data))
+			}
+		})
+	}
+}
+
+func BenchmarkSortPatterns_Slice(b *testing.B) {
+	const n = 1 << 16
+	for _, p := range intPatterns {
+		b.Run(p.name, func(b *testing.B) {
+			unsorted := make([]int, n)
+			p.gen(unsorted)
+			data := make([]int, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				copy(data, unsorted)
+				b.StartTimer()
+				Slice(data, func(i, j int) bool { return data[i] < data[j] })
+			}
+		})
+	}
+}
+
 const (
 	_Sawtooth = iota
 	_Rand